@@ -0,0 +1,349 @@
+//! Errors as the API reports them: an HTTP status and a JSON envelope
+//! `{ "error": { "code": "...", "message": "...", "details": { ... } } }`.
+//!
+//! `code` is a stable snake_case name clients can match on; `message` is for people;
+//! `details` carries the values behind the error (ids, limits, the offending field) and is
+//! `{}` when there are none.
+
+use crate::avatars::{AvatarError, MAX_AVATAR_BYTES, MAX_AVATAR_SIDE};
+use crate::backup::BackupError;
+use crate::deadline::Expired;
+use crate::idempotency::IdempotencyError;
+use crate::models::TournamentError;
+use crate::registry::RegistryError;
+use crate::scoring::ScoringError;
+use crate::seasons::SeasonError;
+use crate::sessions::SessionError;
+use crate::templates::TemplateError;
+use crate::validation::ValidationErrors;
+use crate::webhooks::{WebhookError, MAX_WEBHOOKS};
+use serde_json::{json, Map, Value};
+
+/// An error response: status, code, message and details.
+#[derive(Clone, Debug, PartialEq)]
+pub struct ApiError {
+    pub status: u16,
+    pub code: &'static str,
+    pub message: String,
+    pub details: Map<String, Value>,
+}
+
+impl ApiError {
+    pub fn new(status: u16, code: &'static str, message: impl Into<String>) -> Self {
+        Self {
+            status,
+            code,
+            message: message.into(),
+            details: Map::new(),
+        }
+    }
+
+    /// Add one entry to `details`.
+    pub fn with_detail(mut self, key: &str, value: impl Into<Value>) -> Self {
+        self.details.insert(key.to_string(), value.into());
+        self
+    }
+
+    /// A malformed request (body, query or path that could not be read): 400. `field` is the
+    /// field named in the parse error, if any.
+    pub fn invalid_request(message: impl Into<String>, field: Option<&str>) -> Self {
+        let e = Self::new(400, "invalid_request", message);
+        match field {
+            Some(field) => e.with_detail("field", field),
+            None => e,
+        }
+    }
+
+    /// Missing or wrong site password: 401.
+    pub fn unauthorized(message: impl Into<String>) -> Self {
+        Self::new(401, "unauthorized", message)
+    }
+
+    /// A failure on the server's side (including a handler panic): 500.
+    pub fn internal() -> Self {
+        Self::new(500, "internal_error", "Internal server error")
+    }
+
+    /// The JSON body for this error.
+    pub fn envelope(&self) -> Value {
+        json!({
+            "error": {
+                "code": self.code,
+                "message": self.message,
+                "details": self.details,
+            }
+        })
+    }
+}
+
+impl From<AvatarError> for ApiError {
+    /// 413 for a photo over the size cap, 415 for one that isn't a PNG or JPEG, 422 for one
+    /// that is damaged or has too many pixels.
+    fn from(e: AvatarError) -> Self {
+        let message = e.to_string();
+        match e {
+            AvatarError::TooLarge => Self::new(413, "payload_too_large", message)
+                .with_detail("max_bytes", MAX_AVATAR_BYTES),
+            AvatarError::UnsupportedType => Self::new(415, "unsupported_image_type", message)
+                .with_detail("accepted", json!(["image/png", "image/jpeg"])),
+            AvatarError::Damaged => Self::new(422, "invalid_image", message),
+            AvatarError::TooManyPixels { width, height } => {
+                Self::new(422, "image_too_large", message)
+                    .with_detail("width", width)
+                    .with_detail("height", height)
+                    .with_detail("max_side", MAX_AVATAR_SIDE)
+            }
+            AvatarError::Storage(_) => Self::internal(),
+        }
+    }
+}
+
+impl From<BackupError> for ApiError {
+    /// 400 for a document that isn't a readable backup, 422 for one from a newer schema.
+    fn from(e: BackupError) -> Self {
+        let message = e.to_string();
+        match e {
+            BackupError::Invalid(_) => Self::new(400, "invalid_backup", message),
+            BackupError::Ahead { found, known } => {
+                Self::new(422, "unsupported_backup_version", message)
+                    .with_detail("schema_version", found)
+                    .with_detail("supported", known)
+            }
+            BackupError::Registry(e) => e.into(),
+            BackupError::Season(e) => e.into(),
+            BackupError::Template(e) => e.into(),
+        }
+    }
+}
+
+impl From<Expired> for ApiError {
+    /// 503: the request ran out of time; trying again may well work.
+    fn from(e: Expired) -> Self {
+        Self::new(503, "request_timeout", e.to_string())
+    }
+}
+
+impl From<IdempotencyError> for ApiError {
+    /// 400 for a malformed key, 422 for a key reused on a different request, 409 while the
+    /// first request with the key is still running.
+    fn from(e: IdempotencyError) -> Self {
+        let message = e.to_string();
+        match e {
+            IdempotencyError::InvalidKey => {
+                Self::invalid_request(message, None).with_detail("header", "Idempotency-Key")
+            }
+            IdempotencyError::KeyReused => Self::new(422, "idempotency_key_reused", message),
+            IdempotencyError::InProgress => Self::new(409, "idempotency_in_progress", message),
+            IdempotencyError::Storage(_) => Self::internal(),
+        }
+    }
+}
+
+impl From<RegistryError> for ApiError {
+    fn from(e: RegistryError) -> Self {
+        match e {
+            RegistryError::TournamentNotFound(id) => {
+                Self::new(404, "tournament_not_found", e.to_string())
+                    .with_detail("tournament_id", id.to_string())
+            }
+            RegistryError::LockPoisoned | RegistryError::Storage(_) => Self::internal(),
+            RegistryError::Tournament(e) => e.into(),
+            // The tournament as it is now, for the client to catch up from.
+            RegistryError::Stale(ref stale) => Self::new(412, "precondition_failed", e.to_string())
+                .with_detail("etag", stale.etag.as_str())
+                .with_detail(
+                    "tournament",
+                    serde_json::to_value(&stale.tournament).unwrap_or_default(),
+                ),
+        }
+    }
+}
+
+impl From<SeasonError> for ApiError {
+    fn from(e: SeasonError) -> Self {
+        let message = e.to_string();
+        match e {
+            SeasonError::NotFound(id) => {
+                Self::new(404, "season_not_found", message).with_detail("season_id", id.to_string())
+            }
+            SeasonError::InvalidPointsTable => validation(message, "points")
+                .with_detail("max_places", crate::seasons::MAX_POINTS_PLACES),
+            SeasonError::InvalidBestOf => validation(message, "best_of"),
+            SeasonError::TournamentNotFinished(id) => {
+                Self::new(409, "tournament_not_finished", message)
+                    .with_detail("tournament_id", id.to_string())
+            }
+            SeasonError::AlreadyAttached(id) => Self::new(409, "already_in_season", message)
+                .with_detail("tournament_id", id.to_string()),
+            SeasonError::Tournament(e) => e.into(),
+            SeasonError::Storage(_) => Self::internal(),
+        }
+    }
+}
+
+impl From<SessionError> for ApiError {
+    fn from(e: SessionError) -> Self {
+        match e {
+            SessionError::NotFound(id) => Self::new(404, "session_not_found", e.to_string())
+                .with_detail("session_id", id.to_string()),
+            SessionError::InvalidGamesPerRound => validation(e.to_string(), "games_per_round")
+                .with_detail("max", crate::models::MAX_BOARDS),
+            SessionError::Tournament(e) => e.into(),
+        }
+    }
+}
+
+impl From<TemplateError> for ApiError {
+    /// Template settings are checked like a new tournament's, and fail the same way.
+    fn from(e: TemplateError) -> Self {
+        match e {
+            TemplateError::InvalidName => validation(e.to_string(), "name"),
+            TemplateError::NotFound(ref name) => {
+                Self::new(404, "template_not_found", e.to_string())
+                    .with_detail("name", name.clone())
+            }
+            TemplateError::Storage(_) => Self::internal(),
+            TemplateError::Tournament(e) => e.into(),
+        }
+    }
+}
+
+impl From<WebhookError> for ApiError {
+    fn from(e: WebhookError) -> Self {
+        let message = e.to_string();
+        match e {
+            WebhookError::InvalidUrl => validation(message, "url"),
+            WebhookError::NoEvents => validation(message, "events"),
+            WebhookError::TooMany => {
+                Self::new(409, "too_many_webhooks", message).with_detail("max", MAX_WEBHOOKS)
+            }
+            WebhookError::NotFound(id) => Self::new(404, "webhook_not_found", message)
+                .with_detail("webhook_id", id.to_string()),
+            WebhookError::Storage(_) => Self::internal(),
+        }
+    }
+}
+
+impl From<ValidationErrors> for ApiError {
+    /// 400 `validation_failed`: `details.field` is the first field at fault and
+    /// `details.fields` has the message for each, e.g. `{ "score": "score must be between 0
+    /// and 180" }`.
+    fn from(e: ValidationErrors) -> Self {
+        let fields: Map<String, Value> =
+            e.0.iter()
+                .map(|f| (f.field.clone(), Value::from(f.message.clone())))
+                .collect();
+        let first = e.0.first().map(|f| f.field.clone()).unwrap_or_default();
+        validation(e.to_string(), &first).with_detail("fields", fields)
+    }
+}
+
+impl From<TournamentError> for ApiError {
+    /// 404 unknown ids; 409 conflicts with the current state of the tournament (duplicate
+    /// name, result already in, seeding after start, nothing to undo, merging drawn players,
+    /// reformatting a played round, a person already in a team, a withdrawn player, a deleted
+    /// player's name, deleting a player still entered or with matches, scoring a match as the
+    /// other game); 422 requests that are well-formed but can't be carried out (too few
+    /// players, rejected import, simulating the elimination format); 400 for the rest, with
+    /// `details.field` when one field of the request is at fault.
+    fn from(e: TournamentError) -> Self {
+        use TournamentError as E;
+        let message = e.to_string();
+        match e {
+            E::PlayerNotFound(id) => {
+                Self::new(404, "player_not_found", message).with_detail("player_id", id.to_string())
+            }
+            E::MatchNotFound(id) => {
+                Self::new(404, "match_not_found", message).with_detail("match_id", id.to_string())
+            }
+            E::DuplicatePlayerName => {
+                Self::new(409, "duplicate_player", message).with_detail("field", "name")
+            }
+            E::ResultAlreadyRecorded => Self::new(409, "result_already_recorded", message),
+            E::NextMatchAlreadyPlayed => Self::new(409, "next_match_already_played", message),
+            E::SeedingLocked => Self::new(409, "seeding_locked", message),
+            E::NothingToUndo => Self::new(409, "nothing_to_undo", message),
+            E::MergeAfterStart => Self::new(409, "merge_after_start", message),
+            E::TournamentFinished => Self::new(409, "tournament_finished", message),
+            E::MatchFormatLocked => Self::new(409, "match_format_locked", message),
+            E::Scoring(ScoringError::WrongGameType) => {
+                Self::new(409, "game_type_mismatch", message)
+            }
+            E::OddPlayerCount => Self::new(422, "odd_player_count", message),
+            E::SimulationUnsupported => Self::new(422, "simulation_unsupported", message),
+            E::PlayerDeleted(ref name) => Self::new(409, "player_deleted", message)
+                .with_detail("name", name.clone())
+                .with_detail("restore", format!("/api/players/{}/restore", name)),
+            E::PlayerStillEntered(ref name) => {
+                Self::new(409, "player_still_entered", message).with_detail("name", name.clone())
+            }
+            E::PlayerHasMatches { matches } => {
+                Self::new(409, "player_has_matches", message).with_detail("matches", matches)
+            }
+            E::PlayerWithdrawn(id) => {
+                Self::new(409, "player_withdrawn", message).with_detail("player_id", id.to_string())
+            }
+            E::PlayerInAnotherPair(ref name) => {
+                Self::new(409, "player_in_another_team", message).with_detail("name", name.clone())
+            }
+            E::NotEnoughPlayersToStart { required } => {
+                Self::new(422, "not_enough_players", message).with_detail("required", required)
+            }
+            E::InvalidImport(issues) => Self::new(422, "invalid_import", message)
+                .with_detail("issues", serde_json::to_value(issues).unwrap_or_default()),
+            E::ImportRowCount { max } => {
+                Self::new(422, "invalid_import", message).with_detail("max_rows", max)
+            }
+            E::EmptyPlayerName => validation(message, "name"),
+            E::PlayerNameTooLong { max } | E::TournamentNameTooLong { max } => {
+                validation(message, "name").with_detail("max", max)
+            }
+            E::EmptyBoardName | E::DuplicateBoardName => validation(message, "boards"),
+            E::BoardNameTooLong { max } | E::TooManyBoards { max } => {
+                validation(message, "boards").with_detail("max", max)
+            }
+            E::InvalidGroupCount { max } => {
+                validation(message, "group_count").with_detail("max", max)
+            }
+            E::InvalidAdvanceCount { max } => {
+                validation(message, "advance_per_group").with_detail("max", max)
+            }
+            E::InvalidScore => validation(message, "score"),
+            E::InvalidMatchFormat => validation(message, "match_formats"),
+            E::InvalidPair => validation(message, "members"),
+            E::InvalidProtectedSeeds { max } => {
+                validation(message, "protected_seeds").with_detail("max", max)
+            }
+            E::InvalidSeedOrder => validation(message, "players"),
+            E::WrongNumberOfPlayers { needed, selected } => validation(message, "player_ids")
+                .with_detail("needed", needed)
+                .with_detail("selected", selected),
+            E::NotInMatch(id) | E::PlayerNotInLastEliminated(id) => {
+                Self::new(400, error_code(&e), message).with_detail("player_id", id.to_string())
+            }
+            e => Self::new(400, error_code(&e), message),
+        }
+    }
+}
+
+/// A request value that breaks a rule: 400 `validation_failed` naming the field.
+fn validation(message: String, field: &str) -> ApiError {
+    ApiError::new(400, "validation_failed", message).with_detail("field", field)
+}
+
+fn error_code(e: &TournamentError) -> &'static str {
+    use TournamentError as E;
+    match e {
+        E::IncompleteResults => "incomplete_results",
+        E::NotEnoughPlayers => "not_enough_players",
+        E::InvalidState => "invalid_state",
+        E::UnsupportedMode => "unsupported_mode",
+        E::NotInMatch(_) => "not_in_match",
+        E::PlayerNotInLastEliminated(_) => "player_not_in_last_eliminated",
+        E::MatchNotReady => "match_not_ready",
+        E::Scoring(_) => "invalid_visit",
+        E::NoValidPairing => "no_valid_pairing",
+        E::WrongEntryType => "wrong_entry_type",
+        _ => "bad_request",
+    }
+}
@@ -0,0 +1,278 @@
+//! Queries over past and current tournaments: filtered listings and a player's history.
+//!
+//! A player's lifetime record is never stored: it is summed from the tournaments that exist
+//! each time it is asked for. Deleting a tournament therefore removes its contribution, and
+//! restarting one clears it (the restarted run starts every player from zero).
+
+use crate::models::{
+    Player, ResultType, Tournament, TournamentFormat, TournamentId, TournamentMode, TournamentState,
+};
+use chrono::{DateTime, NaiveDate, Utc};
+use serde::{Deserialize, Serialize};
+
+/// Whether a tournament has been finished (archived).
+#[derive(Clone, Copy, Debug, Eq, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum TournamentStatus {
+    Active,
+    Finished,
+}
+
+impl TournamentStatus {
+    pub fn of(tournament: &Tournament) -> Self {
+        match tournament.finished_at {
+            Some(_) => TournamentStatus::Finished,
+            None => TournamentStatus::Active,
+        }
+    }
+}
+
+/// Which tournaments to list; every field left out matches everything.
+#[derive(Clone, Debug, Default, Deserialize)]
+pub struct TournamentFilter {
+    pub status: Option<TournamentStatus>,
+    /// Someone of this name (case-insensitive) entered.
+    pub player: Option<String>,
+    pub format: Option<TournamentFormat>,
+    /// Created on or after this day (UTC).
+    pub from: Option<NaiveDate>,
+    /// Created on or before this day (UTC).
+    pub to: Option<NaiveDate>,
+}
+
+impl TournamentFilter {
+    pub fn matches(&self, tournament: &Tournament) -> bool {
+        let day = tournament.created_at.date_naive();
+        self.status
+            .is_none_or(|s| s == TournamentStatus::of(tournament))
+            && self.format.is_none_or(|f| f == tournament.format)
+            && self.from.is_none_or(|from| day >= from)
+            && self.to.is_none_or(|to| day <= to)
+            && self
+                .player
+                .as_deref()
+                .is_none_or(|name| entered(tournament, name.trim()))
+    }
+}
+
+/// One tournament in a listing.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct TournamentSummary {
+    pub id: TournamentId,
+    pub name: String,
+    pub format: TournamentFormat,
+    pub mode: TournamentMode,
+    pub state: TournamentState,
+    pub status: TournamentStatus,
+    pub created_at: DateTime<Utc>,
+    pub finished_at: Option<DateTime<Utc>>,
+    pub players: usize,
+    /// Everyone placed first (two in a 2v2 final), once finished.
+    pub winners: Vec<String>,
+}
+
+impl From<&Tournament> for TournamentSummary {
+    fn from(t: &Tournament) -> Self {
+        let winners = t
+            .placements
+            .iter()
+            .filter(|p| p.place == 1)
+            .filter_map(|p| t.find_player(p.player))
+            .map(|p| p.name.clone())
+            .collect();
+        TournamentSummary {
+            id: t.id,
+            name: t.name.clone(),
+            format: t.format,
+            mode: t.mode,
+            state: t.state,
+            status: TournamentStatus::of(t),
+            created_at: t.created_at,
+            finished_at: t.finished_at,
+            players: t.all_players().len(),
+            winners,
+        }
+    }
+}
+
+/// Tournaments matching `filter`, newest first.
+pub fn list_tournaments<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    filter: &TournamentFilter,
+) -> Vec<TournamentSummary> {
+    let mut listed: Vec<TournamentSummary> = tournaments
+        .into_iter()
+        .filter(|t| filter.matches(t))
+        .map(TournamentSummary::from)
+        .collect();
+    listed.sort_by(|a, b| b.created_at.cmp(&a.created_at));
+    listed
+}
+
+/// One tournament a player entered.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct HistoryEntry {
+    pub tournament_id: TournamentId,
+    pub tournament_name: String,
+    pub format: TournamentFormat,
+    pub created_at: DateTime<Utc>,
+    pub finished_at: Option<DateTime<Utc>>,
+    /// Finishing position; None until the tournament is finished.
+    pub place: Option<u32>,
+    pub wins: u32,
+    pub losses: u32,
+}
+
+/// Every tournament someone named `name` (case-insensitive) entered, newest first.
+pub fn player_history<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    name: &str,
+) -> Vec<HistoryEntry> {
+    let mut history: Vec<HistoryEntry> = tournaments
+        .into_iter()
+        .filter_map(|t| {
+            let p = t
+                .all_players()
+                .into_iter()
+                .find(|p| p.name.eq_ignore_ascii_case(name))?;
+            Some(HistoryEntry {
+                tournament_id: t.id,
+                tournament_name: t.name.clone(),
+                format: t.format,
+                created_at: t.created_at,
+                finished_at: t.finished_at,
+                place: t
+                    .placements
+                    .iter()
+                    .find(|pl| pl.player == p.id)
+                    .map(|pl| pl.place),
+                wins: p.wins,
+                losses: p.losses,
+            })
+        })
+        .collect();
+    history.sort_by(|a, b| b.created_at.cmp(&a.created_at));
+    history
+}
+
+/// A player's numbers for one tournament, or summed over several. Legs come from bracket and
+/// group matches recorded with a leg score (void results left out).
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq, Serialize)]
+pub struct EventStats {
+    /// Plate wins included.
+    pub wins: u32,
+    /// Wins in a plate, the consolation knockout for first-round losers.
+    pub plate_wins: u32,
+    pub losses: u32,
+    pub times_sat_out: u32,
+    pub legs_won: u32,
+    pub legs_lost: u32,
+    pub count_180s: u32,
+    pub highest_checkout: u32,
+}
+
+impl EventStats {
+    /// `player`'s numbers in `tournament`.
+    pub fn of(tournament: &Tournament, player: &Player) -> Self {
+        let bracket = tournament.bracket.iter().flat_map(|b| &b.matches);
+        let groups = tournament.group_stage.iter().flat_map(|s| &s.matches);
+        let (mut legs_won, mut legs_lost) = (0, 0);
+        for m in bracket
+            .chain(groups)
+            .filter(|m| m.result_type != ResultType::Void)
+        {
+            if let (Some(score), Some(side)) = (m.score, m.side_of(player.id)) {
+                legs_won += score.get(side);
+                legs_lost += score.get(side.other());
+            }
+        }
+        Self {
+            wins: player.wins,
+            plate_wins: player.plate_wins,
+            losses: player.losses,
+            times_sat_out: player.times_sat_out,
+            legs_won,
+            legs_lost,
+            count_180s: player.count_180s,
+            highest_checkout: player.highest_checkout,
+        }
+    }
+
+    fn add(&mut self, other: &EventStats) {
+        self.wins += other.wins;
+        self.plate_wins += other.plate_wins;
+        self.losses += other.losses;
+        self.times_sat_out += other.times_sat_out;
+        self.legs_won += other.legs_won;
+        self.legs_lost += other.legs_lost;
+        self.count_180s += other.count_180s;
+        self.highest_checkout = self.highest_checkout.max(other.highest_checkout);
+    }
+}
+
+/// One tournament's share of a player's record.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct EventBreakdown {
+    pub tournament_id: TournamentId,
+    pub tournament_name: String,
+    pub created_at: DateTime<Utc>,
+    #[serde(flatten)]
+    pub stats: EventStats,
+}
+
+/// A player's lifetime totals and the tournaments they add up from, newest first.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct PlayerRecord {
+    /// The spelling used in the newest tournament.
+    pub name: String,
+    /// Set once the player has been deleted; their record stays readable.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub deleted_at: Option<DateTime<Utc>>,
+    pub lifetime: EventStats,
+    pub tournaments: Vec<EventBreakdown>,
+}
+
+/// Record of the player named `name` (case-insensitive) over `tournaments`; None if no
+/// tournament has them.
+pub fn player_record<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    name: &str,
+) -> Option<PlayerRecord> {
+    let mut deleted_at = None;
+    let mut entries: Vec<(EventBreakdown, &str)> = tournaments
+        .into_iter()
+        .filter_map(|t| {
+            let p = t
+                .all_players()
+                .into_iter()
+                .find(|p| p.name.eq_ignore_ascii_case(name))?;
+            deleted_at = deleted_at.max(p.deleted_at);
+            let entry = EventBreakdown {
+                tournament_id: t.id,
+                tournament_name: t.name.clone(),
+                created_at: t.created_at,
+                stats: EventStats::of(t, p),
+            };
+            Some((entry, p.name.as_str()))
+        })
+        .collect();
+    entries.sort_by(|a, b| b.0.created_at.cmp(&a.0.created_at));
+    let name = entries.first()?.1.to_string();
+    let mut lifetime = EventStats::default();
+    for (entry, _) in &entries {
+        lifetime.add(&entry.stats);
+    }
+    Some(PlayerRecord {
+        name,
+        deleted_at,
+        lifetime,
+        tournaments: entries.into_iter().map(|(entry, _)| entry).collect(),
+    })
+}
+
+fn entered(tournament: &Tournament, name: &str) -> bool {
+    tournament
+        .all_players()
+        .iter()
+        .any(|p| p.name.eq_ignore_ascii_case(name))
+}
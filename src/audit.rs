@@ -0,0 +1,330 @@
+//! Audit log: who changed what, and when, for every change that matters when a bracket looks
+//! wrong afterwards (players added, results recorded, changed or undone, re-seeding, match
+//! formats).
+//!
+//! Changes are found by comparing a tournament before and after an operation rather than by
+//! each operation reporting itself, so a result that lands through any route (a reported
+//! result, the winning visit, a selected winner) is logged the same way, and an operation that
+//! turned out to change nothing logs nothing. Entries are appended to a JSONL file and never
+//! rewritten.
+
+use crate::models::{GameMatch, PlayerId, ResultType, Team, Tournament, TournamentId};
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use serde_json::{json, Value};
+use std::collections::{HashMap, HashSet};
+use std::fs::{self, File, OpenOptions};
+use std::io::{self, BufRead, BufReader, Write};
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+use uuid::Uuid;
+
+/// Most entries one query returns.
+pub const MAX_AUDIT_LIMIT: usize = 1000;
+
+/// What was done.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum Operation {
+    PlayerAdded,
+    /// A match got its first result.
+    ResultRecorded,
+    /// A result was overwritten with a different one.
+    ResultChanged,
+    /// A result was taken back.
+    ResultUndone,
+    Reseeded,
+    FormatChanged,
+}
+
+/// Kind of thing an entry is about.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum EntityType {
+    Tournament,
+    Player,
+    Match,
+}
+
+/// One change, without who made it or when.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct Change {
+    pub operation: Operation,
+    pub entity_type: EntityType,
+    pub entity_id: Uuid,
+    /// Summary of the entity before the change (null if it didn't exist or had no result).
+    pub before: Value,
+    pub after: Value,
+}
+
+/// One logged change.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct AuditEntry {
+    pub at: DateTime<Utc>,
+    /// Who made it: the API key's role and id (see [`crate::auth::ApiKeys::actor`]).
+    pub actor: String,
+    pub tournament_id: TournamentId,
+    #[serde(flatten)]
+    pub change: Change,
+}
+
+/// Which entries to return; fields left out match everything.
+#[derive(Clone, Debug, Default, Deserialize)]
+pub struct AuditQuery {
+    pub tournament_id: Option<TournamentId>,
+    /// Only entries at or after this time.
+    pub since: Option<DateTime<Utc>>,
+    /// At most this many (newest kept); capped at [`MAX_AUDIT_LIMIT`].
+    pub limit: Option<usize>,
+}
+
+/// Everything `before` → `after` changed that the log keeps: new players, results recorded,
+/// changed or undone, the seed order and the match formats.
+pub fn changes(before: &Tournament, after: &Tournament) -> Vec<Change> {
+    let mut changes = players_added(before, after);
+    changes.extend(result_changes(before, after));
+    let seeds = (seed_summary(before), seed_summary(after));
+    // Adding or removing a player moves seeds too; only the same players in a new order is a
+    // re-seed.
+    if seeds.0 != seeds.1 && player_ids(before) == player_ids(after) {
+        changes.push(tournament_change(Operation::Reseeded, after, seeds));
+    }
+    let formats = (json!(before.match_formats), json!(after.match_formats));
+    if formats.0 != formats.1 {
+        changes.push(tournament_change(Operation::FormatChanged, after, formats));
+    }
+    changes
+}
+
+fn tournament_change(
+    operation: Operation,
+    t: &Tournament,
+    (before, after): (Value, Value),
+) -> Change {
+    Change {
+        operation,
+        entity_type: EntityType::Tournament,
+        entity_id: t.id,
+        before,
+        after,
+    }
+}
+
+fn players_added(before: &Tournament, after: &Tournament) -> Vec<Change> {
+    let known = player_ids(before);
+    after
+        .all_players()
+        .into_iter()
+        .filter(|p| !known.contains(&p.id))
+        .map(|p| Change {
+            operation: Operation::PlayerAdded,
+            entity_type: EntityType::Player,
+            entity_id: p.id,
+            before: Value::Null,
+            after: json!({ "name": p.name, "seed": p.seed, "members": p.members }),
+        })
+        .collect()
+}
+
+/// Results that differ between `before` and `after`, for every match `after` still has.
+/// Matches that leave (a finished group-play round replaced by the next) aren't undone, and
+/// byes are decided by the draw, not by anyone.
+fn result_changes(before: &Tournament, after: &Tournament) -> Vec<Change> {
+    let old = results(before);
+    let mut changes = Vec::new();
+    for (id, new) in ordered_results(after) {
+        let old = old.get(&id).cloned().unwrap_or(Value::Null);
+        let operation = match (&old, &new) {
+            (o, n) if o == n => continue,
+            (Value::Null, _) => Operation::ResultRecorded,
+            (_, Value::Null) => Operation::ResultUndone,
+            _ => Operation::ResultChanged,
+        };
+        changes.push(Change {
+            operation,
+            entity_type: EntityType::Match,
+            entity_id: id,
+            before: old,
+            after: new,
+        });
+    }
+    changes
+}
+
+fn results(t: &Tournament) -> HashMap<Uuid, Value> {
+    ordered_results(t).into_iter().collect()
+}
+
+/// Each match's result summary (null while undecided), bracket order then group play. Walkovers
+/// and void results say so.
+fn ordered_results(t: &Tournament) -> Vec<(Uuid, Value)> {
+    let name = |id: PlayerId| t.find_player(id).map(|p| p.name.clone());
+    let mut out: Vec<(Uuid, Value)> = Vec::new();
+    let bracket = t.bracket.iter().flat_map(|b| &b.matches);
+    let groups = t.group_stage.iter().flat_map(|s| &s.matches);
+    for m in bracket.chain(groups).filter(|m| !m.bye) {
+        let mut summary = match m.winner_id() {
+            Some(winner) => json!({
+                "winner_id": winner,
+                "winner": name(winner),
+                "score": m.score,
+            }),
+            None => Value::Null,
+        };
+        if m.result_type != ResultType::Played {
+            summary["result_type"] = json!(m.result_type);
+        }
+        out.push((m.id, summary));
+    }
+    let semis = t.bracket_semi_final_matches.iter().flatten();
+    let played: Vec<&GameMatch> = t
+        .matches
+        .iter()
+        .chain(semis)
+        .chain(&t.bracket_finals_match)
+        .collect();
+    let mut seen = HashSet::new();
+    for m in played.into_iter().filter(|m| seen.insert(m.id)) {
+        let semi_results = t.bracket_semi_final_results.as_ref();
+        let winner: Option<Team> = t
+            .match_results
+            .get(&m.id)
+            .or_else(|| t.final_match_results.get(&m.id))
+            .or_else(|| semi_results.and_then(|r| r.get(&m.id)))
+            .copied()
+            .or_else(|| finals_winner(t, m));
+        let summary = match winner {
+            Some(team) => {
+                let players: Vec<Option<String>> =
+                    m.team(team).iter().map(|&id| name(id)).collect();
+                json!({ "winner_team": team, "winners": players })
+            }
+            None => Value::Null,
+        };
+        out.push((m.id, summary));
+    }
+    out
+}
+
+/// Winner of the group-play format's final once the results have been processed.
+fn finals_winner(t: &Tournament, m: &GameMatch) -> Option<Team> {
+    let finals = t.bracket_finals_match.as_ref()?;
+    (finals.id == m.id)
+        .then_some(t.bracket_finals_result)
+        .flatten()
+}
+
+/// Player names in seed order.
+fn seed_summary(t: &Tournament) -> Value {
+    let mut players = t.all_players();
+    players.sort_by_key(|p| p.seed);
+    json!(players.iter().map(|p| p.name.as_str()).collect::<Vec<_>>())
+}
+
+fn player_ids(t: &Tournament) -> HashSet<PlayerId> {
+    t.all_players().iter().map(|p| p.id).collect()
+}
+
+/// The log: every entry in memory, each also appended to a JSONL file when one is set.
+pub struct AuditLog {
+    path: Option<PathBuf>,
+    entries: Mutex<Vec<AuditEntry>>,
+}
+
+impl AuditLog {
+    /// A log kept in memory only (lost on restart).
+    pub fn in_memory() -> Self {
+        Self {
+            path: None,
+            entries: Mutex::new(Vec::new()),
+        }
+    }
+
+    /// A log appended to the JSONL file at `path`, with the entries already there loaded.
+    /// The file (and its directory) is created if needed.
+    pub fn open(path: impl Into<PathBuf>) -> io::Result<Self> {
+        let path = path.into();
+        if let Some(dir) = path.parent().filter(|d| !d.as_os_str().is_empty()) {
+            fs::create_dir_all(dir)?;
+        }
+        let entries = match File::open(&path) {
+            Ok(file) => read_entries(BufReader::new(file), &path)?,
+            Err(e) if e.kind() == io::ErrorKind::NotFound => Vec::new(),
+            Err(e) => return Err(e),
+        };
+        Ok(Self {
+            path: Some(path),
+            entries: Mutex::new(entries),
+        })
+    }
+
+    /// Log `changes` to `tournament_id` by `actor`, stamped now. Nothing is kept in memory
+    /// unless the file write succeeds.
+    pub fn record(
+        &self,
+        actor: &str,
+        tournament_id: TournamentId,
+        changes: Vec<Change>,
+    ) -> io::Result<()> {
+        if changes.is_empty() {
+            return Ok(());
+        }
+        let at = Utc::now();
+        let new: Vec<AuditEntry> = changes
+            .into_iter()
+            .map(|change| AuditEntry {
+                at,
+                actor: actor.to_string(),
+                tournament_id,
+                change,
+            })
+            .collect();
+        let mut entries = self.entries.lock().unwrap_or_else(|e| e.into_inner());
+        if let Some(path) = &self.path {
+            let mut lines = Vec::new();
+            for entry in &new {
+                serde_json::to_writer(&mut lines, entry)?;
+                lines.push(b'\n');
+            }
+            OpenOptions::new()
+                .create(true)
+                .append(true)
+                .open(path)?
+                .write_all(&lines)?;
+        }
+        entries.extend(new);
+        Ok(())
+    }
+
+    /// Entries matching `query`, newest first.
+    pub fn query(&self, query: &AuditQuery) -> Vec<AuditEntry> {
+        let limit = query.limit.unwrap_or(MAX_AUDIT_LIMIT).min(MAX_AUDIT_LIMIT);
+        let entries = self.entries.lock().unwrap_or_else(|e| e.into_inner());
+        entries
+            .iter()
+            .rev()
+            .filter(|e| query.tournament_id.is_none_or(|id| e.tournament_id == id))
+            .filter(|e| query.since.is_none_or(|since| e.at >= since))
+            .take(limit)
+            .cloned()
+            .collect()
+    }
+}
+
+fn read_entries(reader: impl BufRead, path: &Path) -> io::Result<Vec<AuditEntry>> {
+    let mut entries = Vec::new();
+    for (i, line) in reader.lines().enumerate() {
+        let line = line?;
+        if line.trim().is_empty() {
+            continue;
+        }
+        let entry = serde_json::from_str(&line).map_err(|e| {
+            io::Error::new(
+                io::ErrorKind::InvalidData,
+                format!("{} line {}: {}", path.display(), i + 1, e),
+            )
+        })?;
+        entries.push(entry);
+    }
+    Ok(entries)
+}
@@ -0,0 +1,180 @@
+//! API keys for write access: every POST/PUT/DELETE needs `Authorization: Bearer <key>`,
+//! reads stay open for scoreboard displays (except the audit log and backups, which are for
+//! admins).
+//!
+//! A key is either `admin` (everything) or `scorer` (record visits and results, nothing that
+//! creates, changes or deletes a tournament's setup). Keys are held as SHA-256 digests so a
+//! lookup never compares the secret itself.
+
+use crate::api_error::ApiError;
+use serde::Deserialize;
+use sha2::{Digest, Sha256};
+use std::collections::HashMap;
+use std::io;
+use std::path::Path;
+
+/// What a key may do. `Admin` includes everything a `Scorer` may do.
+#[derive(Clone, Copy, Debug, Deserialize, Eq, Hash, Ord, PartialEq, PartialOrd)]
+#[serde(rename_all = "lowercase")]
+pub enum Role {
+    Scorer,
+    Admin,
+}
+
+impl Role {
+    /// Name used in keys files and error details.
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Role::Scorer => "scorer",
+            Role::Admin => "admin",
+        }
+    }
+}
+
+/// One entry of a keys file: `[{ "key": "...", "role": "scorer" }, ...]`.
+#[derive(Deserialize)]
+struct KeyEntry {
+    key: String,
+    role: Role,
+}
+
+/// The configured keys. With none configured, auth is off and every request is allowed.
+#[derive(Clone, Debug, Default)]
+pub struct ApiKeys {
+    roles: HashMap<String, Role>,
+}
+
+fn digest(key: &str) -> String {
+    hex::encode(Sha256::digest(key.as_bytes()))
+}
+
+impl ApiKeys {
+    /// Admin keys from a comma-separated list (e.g. `ADMIN_API_KEYS`). Blank entries are skipped.
+    pub fn from_admin_list(list: &str) -> Self {
+        let mut keys = Self::default();
+        for key in list.split(',').map(str::trim).filter(|k| !k.is_empty()) {
+            keys.add(key, Role::Admin);
+        }
+        keys
+    }
+
+    /// Add the keys in the JSON keys file at `path`. Returns how many were read.
+    pub fn load_file(&mut self, path: &Path) -> io::Result<usize> {
+        let entries: Vec<KeyEntry> = serde_json::from_slice(&std::fs::read(path)?)?;
+        let count = entries.len();
+        for entry in entries {
+            let key = entry.key.trim();
+            if key.is_empty() {
+                return Err(io::Error::new(
+                    io::ErrorKind::InvalidData,
+                    "API key cannot be empty",
+                ));
+            }
+            self.add(key, entry.role);
+        }
+        Ok(count)
+    }
+
+    /// Add one key. A key already present keeps the higher of its two roles.
+    pub fn add(&mut self, key: &str, role: Role) {
+        let current = self.roles.entry(digest(key)).or_insert(role);
+        *current = (*current).max(role);
+    }
+
+    /// True if no keys are configured (auth off).
+    pub fn is_empty(&self) -> bool {
+        self.roles.is_empty()
+    }
+
+    /// Role of `key`, or `None` for an unknown key.
+    pub fn role_for(&self, key: &str) -> Option<Role> {
+        self.roles.get(&digest(key)).copied()
+    }
+
+    /// Who a request's key belongs to, for the audit log: `"<role>:<first 12 hex digits of the
+    /// key's digest>"`, so entries can be told apart without logging the secret. `"anonymous"`
+    /// with no key (auth off, or an open route), `"unknown"` for a key that isn't configured.
+    pub fn actor(&self, authorization: Option<&str>) -> String {
+        let Some(key) = authorization
+            .and_then(|h| h.strip_prefix("Bearer "))
+            .map(str::trim)
+            .filter(|k| !k.is_empty())
+        else {
+            return "anonymous".to_string();
+        };
+        match self.role_for(key) {
+            Some(role) => format!("{}:{}", role.as_str(), &digest(key)[..12]),
+            None => "unknown".to_string(),
+        }
+    }
+
+    /// Check a request: `Ok(None)` if it needs no key, `Ok(Some(role))` with the key's role if
+    /// the key is good enough, 401 for a missing or unknown key and 403 for a scorer key on an
+    /// admin route. `authorization` is the raw `Authorization` header.
+    pub fn authorize(
+        &self,
+        method: &str,
+        path: &str,
+        authorization: Option<&str>,
+    ) -> Result<Option<Role>, ApiError> {
+        let Some(required) = required_role(method, path) else {
+            return Ok(None);
+        };
+        if self.is_empty() {
+            return Ok(None);
+        }
+        let key = authorization
+            .and_then(|h| h.strip_prefix("Bearer "))
+            .map(str::trim)
+            .filter(|k| !k.is_empty())
+            .ok_or_else(|| ApiError::unauthorized("API key required"))?;
+        let role = self
+            .role_for(key)
+            .ok_or_else(|| ApiError::unauthorized("Invalid API key"))?;
+        if role < required {
+            return Err(
+                ApiError::new(403, "forbidden", "This API key may not do that")
+                    .with_detail("role", role.as_str())
+                    .with_detail("required_role", required.as_str()),
+            );
+        }
+        Ok(Some(role))
+    }
+}
+
+/// Role a request needs, or `None` if it is open: reads, the health check and the site gate.
+/// Scoring a match (visits, undo, results, walkovers and winners) needs a scorer key; every other write,
+/// and reading the audit log, a tournament's webhooks (their URLs can hold tokens) or anything
+/// under `/api/admin/` (backups), needs an admin key.
+pub fn required_role(method: &str, path: &str) -> Option<Role> {
+    if path.trim_end_matches('/') == "/api/audit" || path.starts_with("/api/admin/") {
+        return Some(Role::Admin);
+    }
+    if matches!(
+        path.trim_matches('/')
+            .split('/')
+            .collect::<Vec<_>>()
+            .as_slice(),
+        ["api", "tournaments", _, "webhooks", ..]
+    ) {
+        return Some(Role::Admin);
+    }
+    if !matches!(method, "POST" | "PUT" | "PATCH" | "DELETE") {
+        return None;
+    }
+    if matches!(path, "/api/health" | "/ping" | "/api/site-gate") {
+        return None;
+    }
+    let segments: Vec<&str> = path.trim_matches('/').split('/').collect();
+    let scoring = match segments.as_slice() {
+        ["api", "tournaments", _, rest @ ..] => matches!(
+            rest,
+            ["matches", _, "visits" | "undo"]
+                | ["bracket", "matches", _, "result" | "walkover"]
+                | ["matches", "winner" | "submit"]
+                | ["finals", "winner" | "submit"]
+        ),
+        _ => false,
+    };
+    Some(if scoring { Role::Scorer } else { Role::Admin })
+}
@@ -0,0 +1,357 @@
+//! Player photos for the bracket display, and a placeholder with the player's initials for
+//! those without one.
+//!
+//! An upload is taken for what its bytes are, not what it says it is: it must start like a
+//! PNG or JPEG and have a readable size in its header, within [`MAX_AVATAR_SIDE`] pixels a
+//! side. Photos are kept as uploaded (there is no image codec in this build to scale them
+//! down); the display sizes them. They are stored per player name, compared without case,
+//! like the rest of the roster across tournaments.
+
+use sha2::{Digest, Sha256};
+use std::collections::BTreeMap;
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::{Arc, Mutex};
+
+/// Largest photo accepted.
+pub const MAX_AVATAR_BYTES: usize = 2 * 1024 * 1024;
+
+/// Widest or tallest photo accepted, in pixels.
+pub const MAX_AVATAR_SIDE: u32 = 4096;
+
+/// Width and height of the initials placeholder.
+pub const PLACEHOLDER_SIZE: u32 = 256;
+
+const PNG_SIGNATURE: &[u8] = b"\x89PNG\r\n\x1a\n";
+
+/// The image formats a photo may be in.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum ImageKind {
+    Png,
+    Jpeg,
+}
+
+impl ImageKind {
+    /// The format `bytes` start with, whatever the upload claimed.
+    pub fn sniff(bytes: &[u8]) -> Option<Self> {
+        if bytes.starts_with(PNG_SIGNATURE) {
+            Some(ImageKind::Png)
+        } else if bytes.starts_with(&[0xFF, 0xD8, 0xFF]) {
+            Some(ImageKind::Jpeg)
+        } else {
+            None
+        }
+    }
+
+    pub fn content_type(self) -> &'static str {
+        match self {
+            ImageKind::Png => "image/png",
+            ImageKind::Jpeg => "image/jpeg",
+        }
+    }
+
+    fn extension(self) -> &'static str {
+        match self {
+            ImageKind::Png => "png",
+            ImageKind::Jpeg => "jpg",
+        }
+    }
+
+    fn from_extension(extension: &str) -> Option<Self> {
+        match extension {
+            "png" => Some(ImageKind::Png),
+            "jpg" => Some(ImageKind::Jpeg),
+            _ => None,
+        }
+    }
+}
+
+/// Why a photo was refused or could not be kept.
+#[derive(Clone, Debug, PartialEq)]
+pub enum AvatarError {
+    /// Over [`MAX_AVATAR_BYTES`].
+    TooLarge,
+    /// Not a PNG or JPEG.
+    UnsupportedType,
+    /// Starts like an image but its size can't be read.
+    Damaged,
+    /// Wider or taller than [`MAX_AVATAR_SIDE`].
+    TooManyPixels { width: u32, height: u32 },
+    /// The photo could not be written to or removed from its file.
+    Storage(String),
+}
+
+impl std::fmt::Display for AvatarError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            AvatarError::TooLarge => write!(
+                f,
+                "Photo is larger than {} MiB",
+                MAX_AVATAR_BYTES / (1024 * 1024)
+            ),
+            AvatarError::UnsupportedType => write!(f, "Photo must be a PNG or JPEG image"),
+            AvatarError::Damaged => write!(f, "Photo is damaged or incomplete"),
+            AvatarError::TooManyPixels { width, height } => write!(
+                f,
+                "Photo is {}×{}; at most {} pixels a side are accepted",
+                width, height, MAX_AVATAR_SIDE
+            ),
+            AvatarError::Storage(e) => write!(f, "Could not save photo: {}", e),
+        }
+    }
+}
+
+/// A checked player photo.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Avatar {
+    pub kind: ImageKind,
+    pub width: u32,
+    pub height: u32,
+    pub bytes: Vec<u8>,
+}
+
+impl Avatar {
+    /// Check an uploaded photo by its contents; see the module docs.
+    pub fn from_upload(bytes: Vec<u8>) -> Result<Self, AvatarError> {
+        if bytes.len() > MAX_AVATAR_BYTES {
+            return Err(AvatarError::TooLarge);
+        }
+        let kind = ImageKind::sniff(&bytes).ok_or(AvatarError::UnsupportedType)?;
+        let (width, height) = match kind {
+            ImageKind::Png => png_size(&bytes),
+            ImageKind::Jpeg => jpeg_size(&bytes),
+        }
+        .filter(|&(w, h)| w > 0 && h > 0)
+        .ok_or(AvatarError::Damaged)?;
+        if width > MAX_AVATAR_SIDE || height > MAX_AVATAR_SIDE {
+            return Err(AvatarError::TooManyPixels { width, height });
+        }
+        Ok(Self {
+            kind,
+            width,
+            height,
+            bytes,
+        })
+    }
+
+    /// Fingerprint of the photo, for `ETag`.
+    pub fn etag(&self) -> String {
+        hex::encode(&Sha256::digest(&self.bytes)[..16])
+    }
+}
+
+fn be16(bytes: &[u8], at: usize) -> Option<u32> {
+    let b = bytes.get(at..at + 2)?;
+    Some(u32::from(u16::from_be_bytes([b[0], b[1]])))
+}
+
+fn be32(bytes: &[u8], at: usize) -> Option<u32> {
+    let b = bytes.get(at..at + 4)?;
+    Some(u32::from_be_bytes([b[0], b[1], b[2], b[3]]))
+}
+
+/// Width and height from the IHDR chunk, which must come first.
+fn png_size(bytes: &[u8]) -> Option<(u32, u32)> {
+    if bytes.get(12..16)? != b"IHDR" {
+        return None;
+    }
+    Some((be32(bytes, 16)?, be32(bytes, 20)?))
+}
+
+/// Width and height from the first start-of-frame segment, walking the segments before it.
+fn jpeg_size(bytes: &[u8]) -> Option<(u32, u32)> {
+    let mut at = 2;
+    loop {
+        if *bytes.get(at)? != 0xFF {
+            return None;
+        }
+        while *bytes.get(at)? == 0xFF {
+            at += 1;
+        }
+        let marker = bytes[at];
+        at += 1;
+        match marker {
+            // Standalone markers: no length follows.
+            0x01 | 0xD0..=0xD7 => continue,
+            // Start of scan or end of image before any frame.
+            0xDA | 0xD9 => return None,
+            // Every start of frame except DHT, JPG and DAC, which share the range.
+            0xC0..=0xCF if !matches!(marker, 0xC4 | 0xC8 | 0xCC) => {
+                return Some((be16(bytes, at + 5)?, be16(bytes, at + 3)?));
+            }
+            _ => at += usize::try_from(be16(bytes, at)?).ok()?,
+        }
+    }
+}
+
+/// An SVG of `name`'s initials (up to two) on a colour picked from the name, for players
+/// without a photo.
+pub fn initials_svg(name: &str) -> String {
+    let key = name.trim().to_lowercase();
+    let initials: String = key
+        .split_whitespace()
+        .take(2)
+        .filter_map(|word| word.chars().next())
+        .flat_map(char::to_uppercase)
+        .collect();
+    let initials = if initials.is_empty() {
+        "?".to_string()
+    } else {
+        initials
+    };
+    let digest = Sha256::digest(key.as_bytes());
+    let hue = u16::from_be_bytes([digest[0], digest[1]]) % 360;
+    let size = PLACEHOLDER_SIZE;
+    format!(
+        concat!(
+            r#"<svg xmlns="http://www.w3.org/2000/svg" width="{size}" height="{size}" "#,
+            r#"viewBox="0 0 {size} {size}"><rect width="{size}" height="{size}" "#,
+            r#"fill="hsl({hue}, 45%, 42%)"/><text x="50%" y="50%" dy=".35em" "#,
+            r#"text-anchor="middle" font-family="sans-serif" font-size="{font}" "#,
+            r#"fill="white">{initials}</text></svg>"#
+        ),
+        size = size,
+        hue = hue,
+        font = size * 2 / 5,
+        initials = escape_xml(&initials),
+    )
+}
+
+fn escape_xml(text: &str) -> String {
+    text.chars()
+        .map(|c| match c {
+            '&' => "&amp;".to_string(),
+            '<' => "&lt;".to_string(),
+            '>' => "&gt;".to_string(),
+            '"' => "&quot;".to_string(),
+            c => c.to_string(),
+        })
+        .collect()
+}
+
+/// Photos by player name (without case), each also written to `<dir>/<hex of name>.<png|jpg>`
+/// when a directory is set.
+pub struct AvatarStore {
+    dir: Option<PathBuf>,
+    avatars: Mutex<BTreeMap<String, Arc<Avatar>>>,
+}
+
+fn key(name: &str) -> String {
+    name.trim().to_lowercase()
+}
+
+impl AvatarStore {
+    /// Photos kept in memory only (lost on restart).
+    pub fn in_memory() -> Self {
+        Self {
+            dir: None,
+            avatars: Mutex::new(BTreeMap::new()),
+        }
+    }
+
+    /// Photos kept as files in `dir` (created if needed), with the ones there loaded.
+    pub fn open(dir: impl Into<PathBuf>) -> io::Result<Self> {
+        let dir = dir.into();
+        fs::create_dir_all(&dir)?;
+        let mut avatars = BTreeMap::new();
+        for entry in fs::read_dir(&dir)? {
+            let path = entry?.path();
+            let Some(kind) = path
+                .extension()
+                .and_then(|e| e.to_str())
+                .and_then(ImageKind::from_extension)
+            else {
+                continue;
+            };
+            let (name, avatar) = read_avatar(&path)?;
+            if avatar.kind != kind {
+                return Err(invalid_file(&path, "contents don't match the extension"));
+            }
+            avatars.insert(name, Arc::new(avatar));
+        }
+        Ok(Self {
+            dir: Some(dir),
+            avatars: Mutex::new(avatars),
+        })
+    }
+
+    pub fn get(&self, name: &str) -> Option<Arc<Avatar>> {
+        let avatars = self.avatars.lock().unwrap_or_else(|e| e.into_inner());
+        avatars.get(&key(name)).cloned()
+    }
+
+    /// Give `name` this photo, replacing any they had.
+    pub fn put(&self, name: &str, avatar: Avatar) -> Result<(), AvatarError> {
+        let key = key(name);
+        let mut avatars = self.avatars.lock().unwrap_or_else(|e| e.into_inner());
+        if let Some(dir) = &self.dir {
+            let storage = |e: io::Error| AvatarError::Storage(e.to_string());
+            fs::write(file_path(dir, &key, avatar.kind), &avatar.bytes).map_err(storage)?;
+            if let Some(old) = avatars.get(&key).filter(|old| old.kind != avatar.kind) {
+                remove_file(&file_path(dir, &key, old.kind)).map_err(storage)?;
+            }
+        }
+        avatars.insert(key, Arc::new(avatar));
+        Ok(())
+    }
+
+    /// Drop `name`'s photo, file and all. Returns whether they had one.
+    pub fn remove(&self, name: &str) -> Result<bool, AvatarError> {
+        let key = key(name);
+        let mut avatars = self.avatars.lock().unwrap_or_else(|e| e.into_inner());
+        let Some(old) = avatars.get(&key) else {
+            return Ok(false);
+        };
+        if let Some(dir) = &self.dir {
+            remove_file(&file_path(dir, &key, old.kind))
+                .map_err(|e| AvatarError::Storage(e.to_string()))?;
+        }
+        avatars.remove(&key);
+        Ok(true)
+    }
+
+    /// Follow a player from `from` to `to` (a rename or merge). If `to` already has a photo
+    /// it is kept and `from`'s dropped.
+    pub fn rename(&self, from: &str, to: &str) -> Result<(), AvatarError> {
+        if key(from) == key(to) {
+            return Ok(());
+        }
+        let Some(avatar) = self.get(from) else {
+            return Ok(());
+        };
+        if self.get(to).is_none() {
+            self.put(to, Avatar::clone(&avatar))?;
+        }
+        self.remove(from).map(|_| ())
+    }
+}
+
+fn file_path(dir: &Path, key: &str, kind: ImageKind) -> PathBuf {
+    dir.join(format!("{}.{}", hex::encode(key), kind.extension()))
+}
+
+fn remove_file(path: &Path) -> io::Result<()> {
+    match fs::remove_file(path) {
+        Err(e) if e.kind() != io::ErrorKind::NotFound => Err(e),
+        _ => Ok(()),
+    }
+}
+
+fn invalid_file(path: &Path, e: impl std::fmt::Display) -> io::Error {
+    io::Error::new(
+        io::ErrorKind::InvalidData,
+        format!("{}: {}", path.display(), e),
+    )
+}
+
+fn read_avatar(path: &Path) -> io::Result<(String, Avatar)> {
+    let name = path
+        .file_stem()
+        .and_then(|s| s.to_str())
+        .and_then(|s| hex::decode(s).ok())
+        .and_then(|b| String::from_utf8(b).ok())
+        .ok_or_else(|| invalid_file(path, "file name is not a hex-encoded player name"))?;
+    let avatar = Avatar::from_upload(fs::read(path)?).map_err(|e| invalid_file(path, e))?;
+    Ok((name, avatar))
+}
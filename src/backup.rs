@@ -0,0 +1,221 @@
+//! Backup and restore of everything the server keeps: tournaments, league seasons and
+//! tournament templates, in one JSON document.
+//!
+//! A backup carries the [`SCHEMA_VERSION`] it was written at. Restoring one migrates its
+//! tournaments up from that version (see [`crate::migrations`]) and refuses one from a newer
+//! version. The document holds no timestamp and lists everything in a fixed order with its
+//! keys sorted, so backing up what a backup restored gives the same bytes back.
+//!
+//! Restoring replaces all current state: every part of the backup is read and checked before
+//! anything changes, and if one store fails to take its part the ones already replaced are put
+//! back. The audit log, casual sessions and player photos aren't included: the log records
+//! what happened, not what there is, sessions only ever live in memory, and photos are files
+//! best copied as they are (see [`crate::avatars`]).
+
+use crate::deadline::{Deadline, Expired};
+use crate::migrations::{upgrade, MigrateError, SCHEMA_VERSION};
+use crate::models::{Tournament, TournamentId};
+use crate::registry::{RegistryError, TournamentRegistry};
+use crate::seasons::{Season, SeasonError, SeasonStore};
+use crate::templates::{TemplateError, TemplateStore, TournamentTemplate};
+use chrono::Utc;
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+use std::collections::HashSet;
+
+/// The `format` every backup document carries, so another JSON file isn't taken for one.
+pub const BACKUP_FORMAT: &str = "dart-tournament-backup";
+
+/// Everything the server keeps, as written to a backup.
+#[derive(Clone, Debug, Serialize)]
+pub struct Backup {
+    /// Always [`BACKUP_FORMAT`].
+    pub format: String,
+    pub schema_version: u32,
+    /// Oldest first.
+    pub tournaments: Vec<Tournament>,
+    /// By id.
+    pub seasons: Vec<Season>,
+    /// By name.
+    pub templates: Vec<TournamentTemplate>,
+}
+
+/// A backup as read, before its tournaments are migrated.
+#[derive(Deserialize)]
+struct StoredBackup {
+    format: String,
+    schema_version: u32,
+    tournaments: Vec<Value>,
+    seasons: Vec<Season>,
+    templates: Vec<TournamentTemplate>,
+}
+
+/// Why a backup could not be read or restored.
+#[derive(Clone, Debug, PartialEq)]
+pub enum BackupError {
+    /// Not a backup document, or one that is damaged.
+    Invalid(String),
+    /// Written by a newer version than this one knows.
+    Ahead {
+        found: u32,
+        known: u32,
+    },
+    Registry(RegistryError),
+    Season(SeasonError),
+    Template(TemplateError),
+}
+
+impl std::fmt::Display for BackupError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            BackupError::Invalid(e) => write!(f, "Not a valid backup: {}", e),
+            BackupError::Ahead { found, known } => write!(
+                f,
+                "Backup is at schema version {}, but this version only knows up to {}",
+                found, known
+            ),
+            BackupError::Registry(e) => write!(f, "{}", e),
+            BackupError::Season(e) => write!(f, "{}", e),
+            BackupError::Template(e) => write!(f, "{}", e),
+        }
+    }
+}
+
+impl From<RegistryError> for BackupError {
+    fn from(e: RegistryError) -> Self {
+        BackupError::Registry(e)
+    }
+}
+
+impl From<SeasonError> for BackupError {
+    fn from(e: SeasonError) -> Self {
+        BackupError::Season(e)
+    }
+}
+
+impl From<TemplateError> for BackupError {
+    fn from(e: TemplateError) -> Self {
+        BackupError::Template(e)
+    }
+}
+
+impl Backup {
+    /// Everything currently in `registry`, `seasons` and `templates`.
+    pub fn take(
+        registry: &TournamentRegistry,
+        seasons: &SeasonStore,
+        templates: &TemplateStore,
+    ) -> Result<Self, RegistryError> {
+        let mut tournaments = registry.list()?;
+        tournaments.sort_by_key(|t| (t.created_at, t.id));
+        Ok(Self {
+            format: BACKUP_FORMAT.to_string(),
+            schema_version: SCHEMA_VERSION,
+            tournaments,
+            seasons: seasons.list(),
+            templates: templates.list(),
+        })
+    }
+
+    /// The backup document. Keys are sorted (tournaments keep some maps in hash order).
+    pub fn to_json(&self) -> Vec<u8> {
+        self.to_json_within(&Deadline::never())
+            .expect("a deadline that never passes isn't cancelled here")
+    }
+
+    /// [`Backup::to_json`], giving up between tournaments once `deadline` has passed.
+    pub fn to_json_within(&self, deadline: &Deadline) -> Result<Vec<u8>, Expired> {
+        let mut tournaments = Vec::with_capacity(self.tournaments.len());
+        for t in &self.tournaments {
+            deadline.check()?;
+            tournaments.push(serde_json::to_value(t).expect("a tournament always serializes"));
+        }
+        deadline.check()?;
+        // The same document `to_value(self)` gives: serde_json's map keeps its keys sorted.
+        let value = serde_json::json!({
+            "format": self.format,
+            "schema_version": self.schema_version,
+            "tournaments": tournaments,
+            "seasons": self.seasons,
+            "templates": self.templates,
+        });
+        Ok(serde_json::to_vec_pretty(&value).expect("a JSON value always serializes"))
+    }
+
+    /// Read a backup document, migrating its tournaments to the current schema.
+    pub fn parse(bytes: &[u8]) -> Result<Self, BackupError> {
+        let invalid = |e: &dyn std::fmt::Display| BackupError::Invalid(e.to_string());
+        let stored: StoredBackup = serde_json::from_slice(bytes).map_err(|e| invalid(&e))?;
+        if stored.format != BACKUP_FORMAT {
+            return Err(invalid(&format!("format is not {}", BACKUP_FORMAT)));
+        }
+        if stored.schema_version > SCHEMA_VERSION {
+            return Err(BackupError::Ahead {
+                found: stored.schema_version,
+                known: SCHEMA_VERSION,
+            });
+        }
+        // Migrations date what they fill in by when the document was written; a backup doesn't
+        // say, so the time of the restore stands in.
+        let written = Utc::now();
+        let mut tournaments = Vec::with_capacity(stored.tournaments.len());
+        let mut ids: HashSet<TournamentId> = HashSet::new();
+        for mut doc in stored.tournaments {
+            upgrade(&mut doc, stored.schema_version, written).map_err(|e| match e {
+                MigrateError::Ahead { found, known } => BackupError::Ahead { found, known },
+                e => invalid(&e),
+            })?;
+            let tournament: Tournament = serde_json::from_value(doc).map_err(|e| invalid(&e))?;
+            if !ids.insert(tournament.id) {
+                return Err(invalid(&format!(
+                    "tournament {} appears twice",
+                    tournament.id
+                )));
+            }
+            tournaments.push(tournament);
+        }
+        let mut season_ids = HashSet::new();
+        if let Some(s) = stored.seasons.iter().find(|s| !season_ids.insert(s.id)) {
+            return Err(invalid(&format!("season {} appears twice", s.id)));
+        }
+        let mut names = HashSet::new();
+        if let Some(t) = stored
+            .templates
+            .iter()
+            .find(|t| !names.insert(t.name.as_str()))
+        {
+            return Err(invalid(&format!("template {} appears twice", t.name)));
+        }
+        Ok(Self {
+            format: stored.format,
+            schema_version: SCHEMA_VERSION,
+            tournaments,
+            seasons: stored.seasons,
+            templates: stored.templates,
+        })
+    }
+
+    /// Replace everything in `registry`, `seasons` and `templates` with this backup. On an
+    /// error nothing is replaced: the templates are checked and swapped first, and put back
+    /// if the seasons or tournaments can't be written.
+    pub fn restore(
+        self,
+        registry: &TournamentRegistry,
+        seasons: &SeasonStore,
+        templates: &TemplateStore,
+    ) -> Result<(), BackupError> {
+        let old_templates = templates.list();
+        let old_seasons = seasons.list();
+        templates.replace_all(self.templates)?;
+        if let Err(e) = seasons.replace_all(self.seasons) {
+            let _ = templates.replace_all(old_templates);
+            return Err(e.into());
+        }
+        if let Err(e) = registry.replace_all(self.tournaments) {
+            let _ = seasons.replace_all(old_seasons);
+            let _ = templates.replace_all(old_templates);
+            return Err(e.into());
+        }
+        Ok(())
+    }
+}
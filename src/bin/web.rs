@@ -2,39 +2,166 @@
 //! Run with: cargo run --bin web
 //! Listens on 0.0.0.0:8080 by default so the app is reachable via DNS on a VPS.
 //! Override with env: HOST (e.g. 0.0.0.0), PORT (e.g. 8080).
+//! Set DATA_DIR to keep tournaments as JSON files there (reloaded on startup); otherwise memory only.
+//! The directory is migrated to the current schema on startup; the server refuses to start on
+//! one written by a newer version.
+//! STORAGE_DRIVER picks the store instead: memory, file (DATA_DIR) or sqlite (SQLITE_PATH, or
+//! tournaments.db in DATA_DIR; needs `--features sqlite`). Any other value stops startup.
+//! ELO_K_FACTOR sets how far one result moves a rating (default 32).
+//! Set SNAPSHOT_PATH to save every tournament to that JSON file on shutdown (SIGINT/SIGTERM)
+//! and load it back on startup.
+//! GET /healthz is the liveness probe; GET /readyz the readiness probe (503 when the data
+//! directory can't be written, or the store or snapshot failed to load at startup).
+//! Writes (POST/PUT/DELETE) need `Authorization: Bearer <key>` once keys are configured:
+//! ADMIN_API_KEYS holds comma-separated admin keys, API_KEYS_FILE a JSON file of
+//! `[{ "key", "role": "admin" | "scorer" }]`. Scorer keys may only score matches.
+//! /api requests are rate limited per client IP: RATE_LIMIT_RPS requests a second (default
+//! 20) with bursts of RATE_LIMIT_BURST (default 40); over the limit is 429 with Retry-After.
+//! Players added, results, undo, seeds and match formats are written to an audit log (JSONL):
+//! AUDIT_LOG_PATH, else `audit.jsonl` in DATA_DIR, else `audit.jsonl` here. Admins read it at
+//! GET /api/audit.
+//! GET /api/admin/backup downloads every tournament, season and template as one JSON document;
+//! POST /api/admin/restore?confirm=true replaces all of them with a backup (up to 64 MiB).
+//! Both need an admin key.
+//! /api requests get REQUEST_TIMEOUT_SECS (default 10) to be answered, else 503; the scoreboard
+//! long-poll and the restore have none. Exports and backups stop where they are once it passes.
+//! Request bodies are capped at 1 MiB (4 MiB for the player import, a little over 2 MiB for a
+//! player photo); larger is 413.
+//! Tournament responses carry an ETag (`"t<n>"`) and the match score an ETag of its own
+//! (`"m<n>"`). A change sent with `If-Match` is only made if the tag is still current, the
+//! match's on routes with a `{match_id}`, else the tournament's; otherwise it is 412 with the
+//! current tournament, so the client can catch up.
+//! Recording a result or a visit takes an `Idempotency-Key` header: a retry with the same key
+//! gets the first response back without the change being made twice, and the same key with a
+//! different body or query string is 422. Responses are kept 24 hours, in the `idempotency` folder in DATA_DIR
+//! or else in memory.
+//! Tournament templates (POST/GET /api/templates) are saved in TEMPLATES_DIR, else the
+//! `templates` folder in DATA_DIR, else kept in memory only.
+//! Casual sit-out rotation sessions (/api/sessions) are kept in memory only.
+//! Deleting a player (DELETE /api/players/{name}) keeps them in the history they played in,
+//! marked deleted; POST /api/players/{name}/restore undoes it, and until then their name can't
+//! be entered again (409). `?hard=true` removes a player with no recorded matches outright.
+//! Handicaps (PUT /api/players/{name}/handicap) give a player points off every leg's start or
+//! legs of head start; matches played with one aren't counted in averages or ratings.
+//! Player photos: POST /api/players/{name}/avatar takes a PNG or JPEG (multipart field
+//! `image`, up to 2 MiB) and GET serves it back, or an SVG of the player's initials when there
+//! is none. They are saved in AVATAR_DIR, else the `avatars` folder in DATA_DIR, else kept in
+//! memory only.
+//! League seasons (/api/seasons) add up finished tournaments' placements into one table; they
+//! are saved in SEASONS_DIR, else the `seasons` folder in DATA_DIR, else kept in memory only.
+//! Single-elimination tournaments can give first-round losers a plate (PUT
+//! /api/tournaments/{id}/plate): a knockout of their own, drawn when the first round is over.
+//! POST /api/tournaments/{id}/simulate plays a tournament that hasn't started out on a copy,
+//! with random or seed-weighted results, and estimates how long it takes on the boards.
+//! Matches are scored as 501 unless their first visit has `"game_type": "cricket"`: cricket
+//! visits are dart by dart, and the match score then carries the marks grid.
+//! GET /api/tournaments/{id}/full is everything a tournament page shows, read from one copy
+//! of the tournament so its parts agree; `?include=` picks the sections, to leave out visits.
+//! GET /api/tournaments/{id}/bracket-view lays the knockout bracket out for drawing: each
+//! match's column and slot and the matches that feed it.
+//! Webhooks (POST/GET /api/tournaments/{id}/webhooks, admin key) are sent a signed JSON POST
+//! when a round's pairings are set, a match is decided or the tournament is won. Three
+//! attempts each, from a thread of their own; five failed deliveries in a row disable one.
+//! They are saved in WEBHOOKS_DIR, else the `webhooks` folder in DATA_DIR, else kept in memory
+//! only.
+//! GET /api/tournaments/{id}/display is the venue scoreboard, long-polled with ETags.
+//! GET /metrics serves Prometheus metrics: request counts and latencies by route and status,
+//! active tournaments, and matches, visits and 180s recorded since startup.
 //! Whole-site password gate: correct password is `SITE_GATE_PLAIN` in this file.
 //! After POST `/api/site-gate`, the client stores the returned token (sessionStorage) and sends
 //! header `X-Dart-Site-Gate` on requests; no cookie (avoids browser cookie UI / SameSite quirks).
 
 use actix_files::Files;
+use actix_multipart::form::{bytes::Bytes as MultipartBytes, MultipartForm, MultipartFormConfig};
 use actix_web::body::BoxBody;
-use actix_web::dev::{ServiceRequest, ServiceResponse};
-use actix_web::middleware::{from_fn, Next};
+use actix_web::dev::{Payload, ServiceRequest, ServiceResponse};
+use actix_web::error::{ErrorInternalServerError, PayloadError};
+use actix_web::http::header::{
+    self, ContentDisposition, DispositionParam, DispositionType, HeaderName, HeaderValue,
+};
+use actix_web::http::StatusCode;
+use actix_web::middleware::{from_fn, Compress, Next};
 use actix_web::{
-    delete, get, post, put,
+    delete, get, patch, post, put,
     web::{self, Data, Json, Path},
-    App, Error, HttpRequest, HttpResponse, HttpServer, Responder,
+    App, Error, FromRequest, HttpRequest, HttpResponse, HttpServer, Responder,
+};
+use dart_tournament_web::api_error::ApiError;
+use dart_tournament_web::archive::{
+    list_tournaments, player_history, player_record, TournamentFilter,
+};
+use dart_tournament_web::audit::{self, AuditLog, AuditQuery};
+use dart_tournament_web::auth::ApiKeys;
+use dart_tournament_web::avatars::{initials_svg, Avatar, AvatarStore};
+use dart_tournament_web::backup::Backup;
+use dart_tournament_web::bracket_view::bracket_view;
+use dart_tournament_web::deadline::{has_timeout, Deadline, Expired, DEFAULT_REQUEST_TIMEOUT};
+use dart_tournament_web::display::{etag, scoreboard};
+use dart_tournament_web::export::{csv_lines, match_rows, player_rows, CsvRow};
+use dart_tournament_web::full::{
+    standing_rows, EventPlayerResponse, FullResponse, GroupResponse, PlayerResponse,
+};
+use dart_tournament_web::handicap::{set_handicap, suggest_handicaps};
+use dart_tournament_web::health::{readiness, HealthReport, Startup};
+use dart_tournament_web::history::{head_to_head, match_history, MatchQuery};
+use dart_tournament_web::idempotency::{
+    fingerprint, Claim, FileIdempotencyStore, Idempotency, IdempotencyError, StoredResponse,
+    DEFAULT_IDEMPOTENCY_TTL, IDEMPOTENCY_KEY_HEADER,
+};
+use dart_tournament_web::import::{import_players, parse_players_csv, rows_from_names};
+use dart_tournament_web::metrics::{render, Gauges, HttpMetrics, UNMATCHED_ROUTE};
+use dart_tournament_web::migrations::{migrate, MigrateError, MIGRATIONS};
+use dart_tournament_web::rate_limit::{
+    body_limit, is_rate_limited, RateLimiter, DEFAULT_BURST, DEFAULT_REQUESTS_PER_SECOND,
+    MAX_BODY_BYTES, MAX_IMPORT_BODY_BYTES, MAX_RESTORE_BODY_BYTES,
+};
+use dart_tournament_web::rating::{latest_rating, rating_history, DEFAULT_K_FACTOR};
+use dart_tournament_web::roster::{
+    check_hard_delete, delete_player, hard_delete_player, player_deleted, player_exists,
+    rename_player, restore_player,
+};
+use dart_tournament_web::scoring::{
+    checkout_route, CricketMarks, CricketMatch, Dart, GameType, X01Match,
+};
+use dart_tournament_web::seasons::{
+    season_standings, PointsTable, Season, SeasonError, SeasonId, SeasonStore,
 };
+use dart_tournament_web::sessions::{Session, SessionError, SessionId, SessionStore};
+use dart_tournament_web::simulate::{simulate, SimulationSettings, DEFAULT_MINUTES_PER_LEG};
+use dart_tournament_web::templates::{
+    clone_tournament, TemplateError, TemplateStore, TournamentSettings, TournamentTemplate,
+};
+use dart_tournament_web::validation::{
+    collect, darts, include_sections, CreatePlayerRequest, RecordResultRequest, RecordVisitRequest,
+    SimulateRequest, Validate,
+};
+use dart_tournament_web::versions::{match_etag, tournament_etag, Precondition};
+use dart_tournament_web::visits::{player_visits, visit_distribution, VisitQuery};
+use dart_tournament_web::webhooks::{Dispatcher, EventKind, WebhookError, WebhookStore};
 use dart_tournament_web::{
-    add_players_back_from_last_eliminated, generate_group_play_matches,
-    generate_semi_final_matches, process_finals_results, process_group_play_results,
-    process_semi_final_results, set_finals_match_winner, start_semi_finals, start_tournament, Team,
-    Tournament, TournamentId,
+    add_players_back_from_last_eliminated, advance_to_knockout, carry_form, finish_tournament,
+    generate_group_play_matches, generate_semi_final_matches, group_standings, leaderboard,
+    next_matches, numbered_boards, process_finals_results, process_group_play_results,
+    process_semi_final_results, record_bracket_result, record_cricket_visit, record_match_visit,
+    record_walkover, round_robin_standings, set_boards, set_finals_match_winner, set_match_formats,
+    start_groups_knockout, start_match, start_next_swiss_round, start_semi_finals,
+    start_tournament, start_with_draw, timing_report, undo_last_action, withdraw_player,
+    BracketMatch, DrawMode, DrawSettings, FileStore, GroupSettings, Handicap, LeaderboardSort,
+    MatchFormats, PairMetric, PlayerId, RatingChange, RegistryError, StorageDriver, Team,
+    Tournament, TournamentError, TournamentFormat, TournamentId, TournamentMode,
+    TournamentRegistry, TournamentState, UnknownDriver, MAX_BOARDS,
 };
+use futures_util::{FutureExt, Stream, StreamExt};
 use serde::{Deserialize, Serialize};
 use sha2::{Digest, Sha256};
-use std::collections::HashMap;
-use std::sync::RwLock;
+use std::panic::AssertUnwindSafe;
+use std::path::PathBuf;
+use std::pin::Pin;
+use std::sync::Arc;
 use std::time::{Duration, Instant};
 use subtle::ConstantTimeEq;
 use uuid::Uuid;
 
-/// Per-tournament entry: tournament data + last activity time (for auto-cleanup).
-struct TournamentEntry {
-    tournament: Tournament,
-    last_activity: Instant,
-}
-
 /// Plaintext site password (intentionally not secret for this deployment).
 const SITE_GATE_PLAIN: &str = "bøh";
 
@@ -90,6 +217,9 @@ async fn site_gate_middleware(
     let method = req.method().clone();
 
     let exempt = path == "/api/health"
+        || path == "/healthz"
+        || path == "/metrics"
+        || path == "/readyz"
         || path == "/favicon.ico"
         || path.starts_with("/static/")
         || (path == "/" && method == actix_web::http::Method::GET)
@@ -100,19 +230,646 @@ async fn site_gate_middleware(
         return next.call(req).await;
     }
 
-    Ok(
-        req.into_response(HttpResponse::Unauthorized().json(serde_json::json!({
-            "error": "Site password required"
-        }))),
-    )
+    Ok(req.into_response(api_error_response(ApiError::unauthorized(
+        "Site password required",
+    ))))
+}
+
+/// Requires an API key with the right role on every write (see [`ApiKeys::authorize`]).
+/// Runs inside the site gate; with no keys configured it lets everything through.
+async fn api_key_middleware(
+    req: ServiceRequest,
+    next: Next<BoxBody>,
+) -> Result<ServiceResponse<BoxBody>, Error> {
+    let keys = req
+        .app_data::<web::Data<ApiKeys>>()
+        .expect("ApiKeys missing")
+        .clone();
+    let authorization = req
+        .headers()
+        .get(header::AUTHORIZATION)
+        .and_then(|h| h.to_str().ok());
+    match keys.authorize(req.method().as_str(), req.path(), authorization) {
+        Ok(_) => {
+            let actor = Actor(keys.actor(authorization));
+            req.extensions_mut().insert(actor);
+            next.call(req).await
+        }
+        Err(e) => Ok(req.into_response(api_error_response(e))),
+    }
+}
+
+/// Limits each client (by peer address) to its token bucket on the routes
+/// [`is_rate_limited`] covers: 429 with `Retry-After` (whole seconds) once the bucket is empty.
+/// Runs outside the site gate, so password guessing is limited too.
+async fn rate_limit_middleware(
+    req: ServiceRequest,
+    next: Next<BoxBody>,
+) -> Result<ServiceResponse<BoxBody>, Error> {
+    let upgrade = req
+        .headers()
+        .get(header::UPGRADE)
+        .and_then(|h| h.to_str().ok());
+    let Some(ip) = req.peer_addr().map(|a| a.ip()) else {
+        return next.call(req).await;
+    };
+    if !is_rate_limited(req.path(), upgrade) {
+        return next.call(req).await;
+    }
+    let limiter = req
+        .app_data::<web::Data<RateLimiter>>()
+        .expect("RateLimiter missing")
+        .clone();
+    match limiter.check(ip, Instant::now()) {
+        Ok(()) => next.call(req).await,
+        Err(wait) => {
+            let retry_after = wait.as_secs_f64().ceil().max(1.0) as u64;
+            let mut res = api_error_response(
+                ApiError::new(429, "rate_limited", "Too many requests; slow down")
+                    .with_detail("retry_after_secs", retry_after),
+            );
+            res.headers_mut()
+                .insert(header::RETRY_AFTER, HeaderValue::from(retry_after));
+            Ok(req.into_response(res))
+        }
+    }
+}
+
+/// How long a timed request may run: `REQUEST_TIMEOUT_SECS`, else [`DEFAULT_REQUEST_TIMEOUT`].
+#[derive(Clone, Copy)]
+struct RequestTimeout(Duration);
+
+/// Gives each /api request that has a timeout (see [`has_timeout`]) until its [`Deadline`];
+/// past that the handler is dropped where it is waiting, the deadline cancelled, and the
+/// request answered 503. The deadline goes in the request's extensions so handlers can pass
+/// it to work they hand off (see [`request_deadline`]), which stops at its next check.
+async fn timeout_middleware(
+    req: ServiceRequest,
+    next: Next<BoxBody>,
+) -> Result<ServiceResponse<BoxBody>, Error> {
+    if !has_timeout(req.path()) {
+        return next.call(req).await;
+    }
+    let timeout = req
+        .app_data::<web::Data<RequestTimeout>>()
+        .expect("RequestTimeout missing")
+        .0;
+    let deadline = Deadline::after(timeout);
+    req.extensions_mut().insert(deadline.clone());
+    let http_req = req.request().clone();
+    // A handler already done when first polled counts as in time, however long it took.
+    match actix_web::rt::time::timeout(timeout, next.call(req)).await {
+        Ok(res) => res,
+        Err(_) => {
+            deadline.cancel();
+            log::warn!(
+                "{} {} timed out after {:?}",
+                http_req.method(),
+                http_req.path(),
+                timeout
+            );
+            let res = api_error_response(Expired.into());
+            Ok(ServiceResponse::new(http_req, res))
+        }
+    }
+}
+
+/// The request's deadline (set by [`timeout_middleware`]); one that never passes on routes
+/// without a timeout.
+fn request_deadline(req: &HttpRequest) -> Deadline {
+    req.extensions()
+        .get::<Deadline>()
+        .cloned()
+        .unwrap_or_else(Deadline::never)
+}
+
+/// Records each request's route, status and latency for /metrics. Routes are labelled by their
+/// pattern (`/api/tournaments/{id}`), so each id doesn't add a series.
+async fn metrics_middleware(
+    req: ServiceRequest,
+    next: Next<BoxBody>,
+) -> Result<ServiceResponse<BoxBody>, Error> {
+    let metrics = req
+        .app_data::<web::Data<HttpMetrics>>()
+        .expect("HttpMetrics missing")
+        .clone();
+    let started = Instant::now();
+    let res = next.call(req).await;
+    let (route, status) = match &res {
+        Ok(res) => (res.request().match_pattern(), res.status()),
+        Err(e) => (None, e.as_response_error().status_code()),
+    };
+    metrics.observe(
+        route.as_deref().unwrap_or(UNMATCHED_ROUTE),
+        status.as_u16(),
+        started.elapsed(),
+    );
+    res
+}
+
+/// Rejects a request whose declared body is over [`body_limit`] for its route with 413 before
+/// it is read. Bodies without a length are capped by the JSON and multipart configs.
+async fn body_limit_middleware(
+    req: ServiceRequest,
+    next: Next<BoxBody>,
+) -> Result<ServiceResponse<BoxBody>, Error> {
+    let max = body_limit(req.path());
+    let length = req
+        .headers()
+        .get(header::CONTENT_LENGTH)
+        .and_then(|h| h.to_str().ok())
+        .and_then(|v| v.parse::<usize>().ok());
+    if length.is_some_and(|len| len > max) {
+        return Ok(req.into_response(api_error_response(
+            ApiError::new(413, "payload_too_large", "Request body is too large")
+                .with_detail("max_bytes", max),
+        )));
+    }
+    next.call(req).await
+}
+
+/// Longest a retry waits for the request holding its idempotency key to finish before
+/// answering 409, on a route without a request timeout.
+const IDEMPOTENCY_WAIT: Duration = Duration::from_secs(10);
+
+/// Time a waiting retry keeps back from its own request deadline, so it answers 409 itself
+/// rather than being cut off with the timeout's 503.
+const IDEMPOTENCY_WAIT_MARGIN: Duration = Duration::from_secs(1);
+
+/// How often a waiting retry checks whether the first request has finished.
+const IDEMPOTENCY_POLL_INTERVAL: Duration = Duration::from_millis(50);
+
+/// Opt-in for mutating routes (`wrap = "from_fn(idempotency_middleware)"`): a request with an
+/// `Idempotency-Key` is carried out once and its response stored; a retry with the same key
+/// and request gets that response back (with `Idempotent-Replayed: true`) and the same key with
+/// a different body or query string is 422. A retry racing the first waits for it, up to
+/// [`IDEMPOTENCY_WAIT_MARGIN`] before its own deadline (and at most [`IDEMPOTENCY_WAIT`]), then
+/// gets 409 `idempotency_in_progress`. Server errors, and errors actix raised before the
+/// handler, aren't stored, so the retry is carried out afresh.
+async fn idempotency_middleware(
+    req: ServiceRequest,
+    next: Next<BoxBody>,
+) -> Result<ServiceResponse<BoxBody>, Error> {
+    // A key that isn't valid UTF-8 is as malformed as any other bad key.
+    let key = req
+        .headers()
+        .get(IDEMPOTENCY_KEY_HEADER)
+        .map(|h| h.to_str().unwrap_or_default().to_string());
+    let Some(key) = key else {
+        return next.call(req).await;
+    };
+    let idempotency = req
+        .app_data::<Data<Idempotency>>()
+        .expect("Idempotency missing")
+        .clone();
+    let (http_req, mut payload) = req.into_parts();
+    let body = web::Bytes::from_request(&http_req, &mut payload).await?;
+    let target = http_req
+        .uri()
+        .path_and_query()
+        .map_or(http_req.path(), |p| p.as_str());
+    let request = fingerprint(http_req.method().as_str(), target, &body);
+
+    let wait = request_deadline(&http_req)
+        .remaining()
+        .map_or(IDEMPOTENCY_WAIT, |left| {
+            left.saturating_sub(IDEMPOTENCY_WAIT_MARGIN)
+                .min(IDEMPOTENCY_WAIT)
+        });
+    let waiting = Instant::now();
+    loop {
+        match idempotency.begin(&key, &request, chrono::Utc::now()) {
+            Ok(Claim::Proceed) => break,
+            Ok(Claim::Replay(stored)) => {
+                return Ok(ServiceResponse::new(http_req, replayed(stored)));
+            }
+            Err(IdempotencyError::InProgress) if waiting.elapsed() < wait => {
+                actix_web::rt::time::sleep(IDEMPOTENCY_POLL_INTERVAL).await;
+            }
+            Err(e) => {
+                if let IdempotencyError::Storage(ref cause) = e {
+                    log::error!("Could not read idempotency records: {}", cause);
+                }
+                return Ok(ServiceResponse::new(http_req, api_error_response(e.into())));
+            }
+        }
+    }
+
+    let stream: Pin<Box<dyn Stream<Item = Result<web::Bytes, PayloadError>>>> =
+        Box::pin(futures_util::stream::once(async move { Ok(body) }));
+    let res = match next
+        .call(ServiceRequest::from_parts(http_req, Payload::from(stream)))
+        .await
+    {
+        Ok(res) => res,
+        Err(e) => {
+            idempotency.release(&key);
+            return Err(e);
+        }
+    };
+    if res.status().is_server_error() || res.response().error().is_some() {
+        idempotency.release(&key);
+        return Ok(res);
+    }
+    let (http_req, res) = res.into_parts();
+    let status = res.status().as_u16();
+    let content_type = res
+        .headers()
+        .get(header::CONTENT_TYPE)
+        .and_then(|h| h.to_str().ok())
+        .map(str::to_string);
+    let (res, body) = res.into_parts();
+    let body = match actix_web::body::to_bytes(body).await {
+        Ok(body) => body,
+        Err(e) => {
+            idempotency.release(&key);
+            return Err(ErrorInternalServerError(e));
+        }
+    };
+    let stored = StoredResponse {
+        status,
+        content_type,
+        body: body.to_vec(),
+    };
+    if let Err(e) = idempotency.complete(&key, &request, stored, chrono::Utc::now()) {
+        // The change is made; only a retry's replay is lost.
+        log::error!("Could not store the idempotent response: {}", e);
+    }
+    Ok(ServiceResponse::new(
+        http_req,
+        res.set_body(BoxBody::new(body)),
+    ))
+}
+
+/// A stored response sent again to a retry.
+fn replayed(stored: StoredResponse) -> HttpResponse {
+    let status = StatusCode::from_u16(stored.status).unwrap_or(StatusCode::OK);
+    let mut res = HttpResponse::build(status);
+    if let Some(content_type) = stored.content_type {
+        res.insert_header((header::CONTENT_TYPE, content_type));
+    }
+    res.insert_header((HeaderName::from_static("idempotent-replayed"), "true"))
+        .body(stored.body)
+}
+
+/// Idempotency records in the `idempotency` folder of DATA_DIR, else in memory only.
+fn open_idempotency() -> Idempotency {
+    let Some(dir) = std::env::var_os("DATA_DIR").map(|d| PathBuf::from(d).join("idempotency"))
+    else {
+        return Idempotency::in_memory();
+    };
+    match FileIdempotencyStore::open(&dir) {
+        Ok(store) => {
+            log::info!("Idempotency records in {}", dir.display());
+            Idempotency::new(store, DEFAULT_IDEMPOTENCY_TTL)
+        }
+        Err(e) => {
+            log::error!(
+                "Could not open idempotency records in {}: {}; keeping them in memory only",
+                dir.display(),
+                e
+            );
+            Idempotency::in_memory()
+        }
+    }
+}
+
+/// Rate limit from the environment: `RATE_LIMIT_RPS` and `RATE_LIMIT_BURST`.
+fn rate_limiter_from_env() -> RateLimiter {
+    let per_second = match std::env::var("RATE_LIMIT_RPS") {
+        Ok(v) => match v.parse::<f64>() {
+            Ok(rps) if rps.is_finite() && rps >= 1.0 => rps,
+            _ => {
+                log::warn!("Ignoring invalid RATE_LIMIT_RPS {:?}", v);
+                DEFAULT_REQUESTS_PER_SECOND
+            }
+        },
+        Err(_) => DEFAULT_REQUESTS_PER_SECOND,
+    };
+    let burst = match std::env::var("RATE_LIMIT_BURST") {
+        Ok(v) => match v.parse::<u32>() {
+            Ok(burst) if burst > 0 => burst,
+            _ => {
+                log::warn!("Ignoring invalid RATE_LIMIT_BURST {:?}", v);
+                DEFAULT_BURST
+            }
+        },
+        Err(_) => DEFAULT_BURST,
+    };
+    RateLimiter::new(per_second, burst)
+}
+
+/// Request timeout from the environment: `REQUEST_TIMEOUT_SECS`.
+fn request_timeout_from_env() -> RequestTimeout {
+    let timeout = match std::env::var("REQUEST_TIMEOUT_SECS") {
+        Ok(v) => match v.parse::<u64>() {
+            Ok(secs) if secs > 0 => Duration::from_secs(secs),
+            _ => {
+                log::warn!("Ignoring invalid REQUEST_TIMEOUT_SECS {:?}", v);
+                DEFAULT_REQUEST_TIMEOUT
+            }
+        },
+        Err(_) => DEFAULT_REQUEST_TIMEOUT,
+    };
+    RequestTimeout(timeout)
+}
+
+/// Admin keys from `ADMIN_API_KEYS` (comma-separated) plus any keys with roles in the JSON
+/// file at `API_KEYS_FILE`.
+fn load_api_keys() -> std::io::Result<ApiKeys> {
+    let mut keys = ApiKeys::from_admin_list(&std::env::var("ADMIN_API_KEYS").unwrap_or_default());
+    if let Some(path) = std::env::var_os("API_KEYS_FILE").map(PathBuf::from) {
+        let loaded = keys.load_file(&path)?;
+        log::info!("Loaded {} API key(s) from {}", loaded, path.display());
+    }
+    Ok(keys)
+}
+
+/// Templates from `TEMPLATES_DIR`, else the `templates` folder in DATA_DIR, else kept in
+/// memory only.
+fn open_templates() -> TemplateStore {
+    let dir = std::env::var_os("TEMPLATES_DIR")
+        .map(PathBuf::from)
+        .or_else(|| std::env::var_os("DATA_DIR").map(|d| PathBuf::from(d).join("templates")));
+    let Some(dir) = dir else {
+        return TemplateStore::in_memory();
+    };
+    match TemplateStore::open(&dir) {
+        Ok(templates) => {
+            log::info!(
+                "Tournament templates in {} ({} loaded)",
+                dir.display(),
+                templates.list().len()
+            );
+            templates
+        }
+        Err(e) => {
+            log::error!(
+                "Could not load templates from {}: {}; keeping them in memory only",
+                dir.display(),
+                e
+            );
+            TemplateStore::in_memory()
+        }
+    }
+}
+
+/// Player photos from `AVATAR_DIR`, else the `avatars` folder in DATA_DIR, else kept in memory
+/// only.
+fn open_avatars() -> AvatarStore {
+    let dir = std::env::var_os("AVATAR_DIR")
+        .map(PathBuf::from)
+        .or_else(|| std::env::var_os("DATA_DIR").map(|d| PathBuf::from(d).join("avatars")));
+    let Some(dir) = dir else {
+        return AvatarStore::in_memory();
+    };
+    match AvatarStore::open(&dir) {
+        Ok(avatars) => {
+            log::info!("Player photos in {}", dir.display());
+            avatars
+        }
+        Err(e) => {
+            log::error!(
+                "Could not load player photos from {}: {}; keeping them in memory only",
+                dir.display(),
+                e
+            );
+            AvatarStore::in_memory()
+        }
+    }
+}
+
+/// Webhooks from `WEBHOOKS_DIR`, else the `webhooks` folder in DATA_DIR, else kept in memory
+/// only.
+fn open_webhooks() -> WebhookStore {
+    let dir = std::env::var_os("WEBHOOKS_DIR")
+        .map(PathBuf::from)
+        .or_else(|| std::env::var_os("DATA_DIR").map(|d| PathBuf::from(d).join("webhooks")));
+    let Some(dir) = dir else {
+        return WebhookStore::in_memory();
+    };
+    match WebhookStore::open(&dir) {
+        Ok(webhooks) => {
+            log::info!("Webhooks in {}", dir.display());
+            webhooks
+        }
+        Err(e) => {
+            log::error!(
+                "Could not load webhooks from {}: {}; keeping them in memory only",
+                dir.display(),
+                e
+            );
+            WebhookStore::in_memory()
+        }
+    }
+}
+
+/// Seasons from `SEASONS_DIR`, else the `seasons` folder in DATA_DIR, else kept in memory only.
+fn open_seasons() -> SeasonStore {
+    let dir = std::env::var_os("SEASONS_DIR")
+        .map(PathBuf::from)
+        .or_else(|| std::env::var_os("DATA_DIR").map(|d| PathBuf::from(d).join("seasons")));
+    let Some(dir) = dir else {
+        return SeasonStore::in_memory();
+    };
+    match SeasonStore::open(&dir) {
+        Ok(seasons) => {
+            log::info!(
+                "Seasons in {} ({} loaded)",
+                dir.display(),
+                seasons.list().len()
+            );
+            seasons
+        }
+        Err(e) => {
+            log::error!(
+                "Could not load seasons from {}: {}; keeping them in memory only",
+                dir.display(),
+                e
+            );
+            SeasonStore::in_memory()
+        }
+    }
+}
+
+/// Who made a request, for the audit log; set by [`api_key_middleware`].
+#[derive(Clone)]
+struct Actor(String);
+
+/// A request's `If-Match` precondition, when it sends one (see `versions`). On routes with a
+/// `{match_id}` it is checked against that match's ETag, elsewhere against the tournament's.
+struct IfMatch(Option<Precondition>);
+
+impl IfMatch {
+    fn get(&self) -> Option<&Precondition> {
+        self.0.as_ref()
+    }
+}
+
+impl FromRequest for IfMatch {
+    type Error = Error;
+    type Future = std::future::Ready<Result<Self, Error>>;
+
+    fn from_request(req: &HttpRequest, _: &mut Payload) -> Self::Future {
+        std::future::ready(Ok(IfMatch(if_match(req))))
+    }
+}
+
+fn if_match(req: &HttpRequest) -> Option<Precondition> {
+    let value = req.headers().get(header::IF_MATCH)?;
+    let match_id = req
+        .match_info()
+        .get("match_id")
+        .and_then(|id| id.parse().ok());
+    // A value that isn't text names no tag we gave out, so it never holds.
+    Precondition::parse(value.to_str().unwrap_or_default(), match_id)
+}
+
+/// [`TournamentRegistry::update_if`] with the request's `If-Match`, then log what the operation changed (see
+/// [`audit::changes`]) as done by the request's actor. A failed log write is logged, not
+/// returned: the change itself has already been saved.
+fn audited_update<F>(
+    state: &AppState,
+    audit: &AuditLog,
+    req: &HttpRequest,
+    id: TournamentId,
+    f: F,
+) -> Result<Tournament, RegistryError>
+where
+    F: FnOnce(&mut Tournament) -> Result<(), TournamentError>,
+{
+    audited_update_seeing_all(state, audit, req, id, |_, t| f(t))
+}
+
+/// [`audited_update`] where `f` also sees every tournament under the same lock (see
+/// [`TournamentRegistry::update_if_seeing_all`]).
+fn audited_update_seeing_all<F>(
+    state: &AppState,
+    audit: &AuditLog,
+    req: &HttpRequest,
+    id: TournamentId,
+    f: F,
+) -> Result<Tournament, RegistryError>
+where
+    F: FnOnce(&[&Tournament], &mut Tournament) -> Result<(), TournamentError>,
+{
+    let mut before = None;
+    let precondition = if_match(req);
+    let after = state.update_if_seeing_all(id, precondition.as_ref(), |all, t| {
+        before = Some(t.clone());
+        f(all, t)
+    })?;
+    let actor = req
+        .extensions()
+        .get::<Actor>()
+        .map_or_else(|| "anonymous".to_string(), |a| a.0.clone());
+    if let Some(before) = before {
+        if let Err(e) = audit.record(&actor, id, audit::changes(&before, &after)) {
+            log::error!("Could not write the audit log: {}", e);
+        }
+    }
+    Ok(after)
+}
+
+/// Header carrying the request id: the client's own when it sends a usable one, else generated.
+const REQUEST_ID_HEADER: &str = "x-request-id";
+
+/// Outermost middleware. Tags every response with a request id and logs failed requests with
+/// it. A handler panic becomes a 500, and error responses from actix itself (e.g. a body that
+/// isn't valid JSON) are rewritten into the JSON error envelope.
+async fn error_middleware(
+    req: ServiceRequest,
+    next: Next<BoxBody>,
+) -> Result<ServiceResponse<BoxBody>, Error> {
+    let request_id = req
+        .headers()
+        .get(REQUEST_ID_HEADER)
+        .and_then(|h| h.to_str().ok())
+        .filter(|id| !id.is_empty() && id.len() <= 128 && id.bytes().all(|b| b.is_ascii_graphic()))
+        .map(str::to_string)
+        .unwrap_or_else(|| Uuid::new_v4().to_string());
+    let http_req = req.request().clone();
+    let method = req.method().clone();
+    let path = req.path().to_string();
+
+    let mut res = match AssertUnwindSafe(next.call(req)).catch_unwind().await {
+        Ok(Ok(res)) => match res.response().error() {
+            Some(e) => {
+                let err = request_error(res.status(), e.to_string());
+                res.into_response(api_error_response(err))
+            }
+            None => res,
+        },
+        Ok(Err(e)) => {
+            let err = request_error(e.as_response_error().status_code(), e.to_string());
+            ServiceResponse::new(http_req, api_error_response(err))
+        }
+        Err(_) => {
+            log::error!(
+                "Handler panicked: {} {} [request {}]",
+                method,
+                path,
+                request_id
+            );
+            ServiceResponse::new(http_req, api_error_response(ApiError::internal()))
+        }
+    };
+    if res.status().is_client_error() || res.status().is_server_error() {
+        log::warn!(
+            "{} {} -> {} [request {}]",
+            method,
+            path,
+            res.status().as_u16(),
+            request_id
+        );
+    }
+    if let Ok(value) = HeaderValue::from_str(&request_id) {
+        res.headers_mut()
+            .insert(HeaderName::from_static(REQUEST_ID_HEADER), value);
+    }
+    Ok(res)
+}
+
+/// [`ApiError`] for an error actix raised before or instead of a handler.
+fn request_error(status: StatusCode, message: String) -> ApiError {
+    match status {
+        StatusCode::BAD_REQUEST => {
+            let field = named_field(&message).map(str::to_string);
+            ApiError::invalid_request(message, field.as_deref())
+        }
+        StatusCode::NOT_FOUND => ApiError::new(404, "not_found", message),
+        StatusCode::PAYLOAD_TOO_LARGE => ApiError::new(413, "payload_too_large", message),
+        StatusCode::UNSUPPORTED_MEDIA_TYPE => ApiError::new(415, "unsupported_media_type", message),
+        s if s.is_client_error() => ApiError::new(s.as_u16(), "invalid_request", message),
+        _ => {
+            log::error!("{}", message);
+            ApiError::internal()
+        }
+    }
+}
+
+/// The field a serde error names ("missing field `name`", "unknown field `nmae`").
+fn named_field(message: &str) -> Option<&str> {
+    let start = message.find("field `")? + "field `".len();
+    let len = message[start..].find('`')?;
+    Some(&message[start..start + len])
 }
 
-/// In-memory state: many tournaments by ID (sessioned). Entries are removed after 6h inactivity.
-type AppState = Data<RwLock<HashMap<TournamentId, TournamentEntry>>>;
+/// In-memory state: many tournaments by ID (sessioned). Entries are removed after 12h inactivity.
+type AppState = Data<TournamentRegistry>;
 
 /// Inactivity threshold: tournaments not accessed for this long are removed.
 const INACTIVITY_TIMEOUT: Duration = Duration::from_secs(12 * 3600);
 
+/// Seconds in-flight requests get to finish after a shutdown signal.
+const SHUTDOWN_TIMEOUT_SECS: u64 = 30;
+
+/// Rate-limit buckets of clients idle this long are dropped.
+const RATE_LIMIT_IDLE: Duration = Duration::from_secs(10 * 60);
+
+/// How long /readyz waits for the store check before reporting it failed.
+const READY_CHECK_TIMEOUT: Duration = Duration::from_secs(2);
+
 #[derive(Serialize)]
 struct HealthResponse {
     ok: bool,
@@ -120,25 +877,96 @@ struct HealthResponse {
 }
 
 #[derive(Deserialize)]
-struct CreateTournamentBody {
-    #[serde(default = "default_max_losses")]
-    max_losses: u32,
+struct CreateTournamentQuery {
+    template: Option<String>,
+}
+
+#[derive(Deserialize)]
+struct CreateSessionBody {
     #[serde(default)]
-    mode: dart_tournament_web::TournamentMode,
+    name: String,
+    players: Vec<String>,
+    #[serde(default = "default_games_per_round")]
+    games_per_round: usize,
+    #[serde(default = "default_session_mode")]
+    mode: TournamentMode,
+}
+
+fn default_games_per_round() -> usize {
+    1
+}
+
+fn default_session_mode() -> TournamentMode {
+    TournamentMode::OneVOne
 }
 
 #[derive(Deserialize)]
-struct SiteGateLoginBody {
-    password: String,
+struct SessionPath {
+    id: SessionId,
 }
 
-fn default_max_losses() -> u32 {
-    3
+#[derive(Deserialize)]
+struct SessionPlayerPath {
+    id: SessionId,
+    player_id: PlayerId,
+}
+
+#[derive(Deserialize)]
+struct CreateSeasonBody {
+    #[serde(default)]
+    name: String,
+    #[serde(default)]
+    points: PointsTable,
+    best_of: Option<usize>,
+}
+
+#[derive(Deserialize)]
+struct SeasonPath {
+    id: SeasonId,
+}
+
+#[derive(Deserialize)]
+struct SeasonTournamentPath {
+    id: SeasonId,
+    tournament_id: TournamentId,
+}
+
+/// `?best=` for season standings: count each player's best this many weeks.
+#[derive(Deserialize)]
+struct SeasonStandingsQuery {
+    best: Option<usize>,
 }
 
 #[derive(Deserialize)]
-struct AddPlayerBody {
+struct CloneTournamentBody {
+    #[serde(default)]
+    include_players: bool,
+}
+
+#[derive(Deserialize)]
+struct SiteGateLoginBody {
+    password: String,
+}
+
+#[derive(Deserialize)]
+struct AddTeamBody {
     name: String,
+    members: Vec<String>,
+}
+
+/// Multipart upload for the player import: one CSV file field named `file`.
+#[derive(MultipartForm)]
+struct PlayerImportUpload {
+    #[multipart(limit = "4 MiB")]
+    file: MultipartBytes,
+}
+
+/// Multipart upload of a player photo: one PNG or JPEG file field named `image`. The field
+/// may run a little over the photo cap so an oversized photo is refused by its own check.
+#[derive(MultipartForm)]
+struct AvatarUpload {
+    #[multipart(limit = "3 MiB")]
+    image: MultipartBytes,
 }
 
 #[derive(Deserialize)]
@@ -146,6 +974,16 @@ struct MaxLossesBody {
     max_losses: u32,
 }
 
+#[derive(Deserialize)]
+struct WalkoverWinsBody {
+    counts_as_win: bool,
+}
+
+#[derive(Deserialize)]
+struct PlateBody {
+    plate: bool,
+}
+
 #[derive(Deserialize)]
 struct SetMatchWinnerBody {
     match_id: Uuid,
@@ -153,490 +991,2234 @@ struct SetMatchWinnerBody {
 }
 
 #[derive(Deserialize)]
-struct FinalSelectionAddBackBody {
-    player_ids: Vec<Uuid>,
+struct CheckoutQuery {
+    remaining: u32,
+    #[serde(default = "default_darts")]
+    darts: u32,
 }
 
-#[derive(Deserialize)]
-struct SetPlayerLossesBody {
-    losses: u32,
+#[derive(Serialize)]
+struct CheckoutResponse {
+    remaining: u32,
+    darts: u32,
+    /// None when the score can't be finished with those darts.
+    route: Option<Vec<Dart>>,
+}
+
+/// Live score plus the suggested checkout for the side to throw (None once the match is won
+/// or when there is no finish from their score).
+#[derive(Serialize)]
+struct MatchScoreResponse<'a> {
+    game_type: GameType,
+    #[serde(flatten)]
+    score: &'a X01Match,
+    checkout: Option<Vec<Dart>>,
+}
+
+impl<'a> From<&'a X01Match> for MatchScoreResponse<'a> {
+    fn from(score: &'a X01Match) -> Self {
+        let leg = score.current_leg();
+        let checkout = match score.winner {
+            Some(_) => None,
+            None => checkout_route(leg.remaining(leg.thrower), 3),
+        };
+        Self {
+            game_type: GameType::X01,
+            score,
+            checkout,
+        }
+    }
+}
+
+/// Live cricket score plus the current leg's marks, one row per number from 20 to the bull.
+#[derive(Serialize)]
+struct CricketScoreResponse<'a> {
+    game_type: GameType,
+    #[serde(flatten)]
+    score: &'a CricketMatch,
+    marks: Vec<CricketMarks>,
+}
+
+impl<'a> From<&'a CricketMatch> for CricketScoreResponse<'a> {
+    fn from(score: &'a CricketMatch) -> Self {
+        Self {
+            game_type: GameType::Cricket,
+            score,
+            marks: score.current_leg().grid(),
+        }
+    }
+}
+
+fn default_darts() -> u32 {
+    3
+}
+
+/// Elo settings from the environment: `ELO_K_FACTOR` (default 32).
+struct RatingSettings {
+    k_factor: f64,
+}
+
+impl RatingSettings {
+    fn from_env() -> Self {
+        let k_factor = match std::env::var("ELO_K_FACTOR") {
+            Ok(v) => match v.parse::<f64>() {
+                Ok(k) if k.is_finite() && k > 0.0 => k,
+                _ => {
+                    log::warn!("Ignoring invalid ELO_K_FACTOR {:?}", v);
+                    DEFAULT_K_FACTOR
+                }
+            },
+            Err(_) => DEFAULT_K_FACTOR,
+        };
+        Self { k_factor }
+    }
+}
+
+#[derive(Serialize)]
+struct RatingHistoryEntry {
+    tournament_id: TournamentId,
+    #[serde(flatten)]
+    change: RatingChange,
+}
+
+/// Most leaderboard entries returned per page.
+const MAX_LEADERBOARD_LIMIT: usize = 100;
+
+#[derive(Deserialize)]
+struct LeaderboardQuery {
+    #[serde(default)]
+    sort: LeaderboardSort,
+    #[serde(default)]
+    offset: usize,
+    #[serde(default = "default_leaderboard_limit")]
+    limit: usize,
+    /// Only this tournament; all tournaments when absent.
+    tournament_id: Option<TournamentId>,
+}
+
+fn default_leaderboard_limit() -> usize {
+    20
+}
+
+/// Minutes a match can run before the timing report lists it as slow, unless asked otherwise.
+const DEFAULT_SLOW_MATCH_MINUTES: i64 = 30;
+
+#[derive(Deserialize)]
+struct TimingQuery {
+    #[serde(default = "default_slow_match_minutes")]
+    slow_after_minutes: i64,
+}
+
+fn default_slow_match_minutes() -> i64 {
+    DEFAULT_SLOW_MATCH_MINUTES
+}
+
+/// `?format=` for the export endpoints: a CSV download (default) or the same rows as JSON.
+#[derive(Clone, Copy, Default, Deserialize, PartialEq)]
+#[serde(rename_all = "lowercase")]
+enum ExportFormat {
+    #[default]
+    Csv,
+    Json,
+}
+
+#[derive(Deserialize)]
+struct ExportQuery {
+    #[serde(default)]
+    format: ExportFormat,
+}
+
+#[derive(Deserialize)]
+struct WalkoverBody {
+    absent: Uuid,
+}
+
+#[derive(Deserialize)]
+struct WithdrawBody {
+    #[serde(default)]
+    void_results: bool,
+}
+
+#[derive(Deserialize)]
+struct OverwriteQuery {
+    #[serde(default)]
+    overwrite: bool,
+}
+
+#[derive(Deserialize)]
+struct FinalSelectionAddBackBody {
+    player_ids: Vec<Uuid>,
+}
+
+#[derive(Deserialize)]
+struct SetPlayerLossesBody {
+    losses: u32,
+}
+
+#[derive(Deserialize)]
+struct SetNameBody {
+    name: String,
+}
+
+#[derive(Deserialize)]
+struct RenamePlayerBody {
+    name: String,
+    /// Merge into the player already using `name` instead of failing with 409.
+    #[serde(default)]
+    merge: bool,
+}
+
+#[derive(Deserialize)]
+struct MergePlayersBody {
+    from: String,
+    into: String,
+}
+
+#[derive(Serialize)]
+struct HandicapResponse {
+    name: String,
+    handicap: Handicap,
+    /// Tournaments that changed.
+    tournaments: usize,
+}
+
+#[derive(Serialize)]
+struct RenameResponse {
+    name: String,
+    /// Tournaments that changed.
+    tournaments: usize,
+}
+
+#[derive(Deserialize)]
+struct DeletePlayerQuery {
+    /// Remove the player outright rather than marking them deleted.
+    #[serde(default)]
+    hard: bool,
+}
+
+#[derive(Serialize)]
+struct DeletePlayerResponse {
+    name: String,
+    deleted_at: chrono::DateTime<chrono::Utc>,
+    /// Tournaments that changed.
+    tournaments: usize,
+}
+
+#[derive(Serialize)]
+struct AvatarResponse {
+    name: String,
+    content_type: &'static str,
+    width: u32,
+    height: u32,
+}
+
+#[derive(Deserialize)]
+struct SetSeedsBody {
+    players: Vec<Uuid>,
+}
+
+/// Boards as a count (`{ "boards": 4 }` names them "Board 1".."Board 4") or as names.
+#[derive(Deserialize)]
+#[serde(untagged)]
+enum BoardsSpec {
+    Count(usize),
+    Names(Vec<String>),
+}
+
+#[derive(Deserialize)]
+struct SetBoardsBody {
+    boards: BoardsSpec,
+}
+
+#[derive(Serialize)]
+struct NextMatchResponse<'a> {
+    board: &'a str,
+    #[serde(rename = "match")]
+    bracket_match: &'a BracketMatch,
+}
+
+/// `?etag=` for the scoreboard: the last one the display saw, for browsers that can't set
+/// `If-None-Match` themselves.
+#[derive(Deserialize)]
+struct DisplayQuery {
+    etag: Option<String>,
+}
+
+/// Longest a scoreboard poll waits for a change before answering 304.
+const DISPLAY_POLL_TIMEOUT: Duration = Duration::from_secs(25);
+
+/// How often a waiting scoreboard poll looks again.
+const DISPLAY_POLL_INTERVAL: Duration = Duration::from_millis(500);
+
+/// Groups-then-knockout draw; either field falls back to the default for the player count.
+#[derive(Deserialize)]
+struct StartBody {
+    group_count: Option<usize>,
+    advance_per_group: Option<usize>,
+    /// The tournament's own draw mode when left out.
+    draw_mode: Option<DrawMode>,
+    protected_seeds: Option<usize>,
+    draw_seed: Option<u64>,
+    /// Balanced draws: `average` (the default) or `rating`.
+    balance_by: Option<PairMetric>,
+}
+
+/// Seeds kept in place by a protected draw unless the request says otherwise.
+const DEFAULT_PROTECTED_SEEDS: usize = 4;
+
+/// The knockout draw a start asks for, for `players` entrants.
+fn draw_settings(body: Option<&StartBody>, draw_mode: DrawMode, players: usize) -> DrawSettings {
+    DrawSettings {
+        mode: body.and_then(|b| b.draw_mode).unwrap_or(draw_mode),
+        protected_seeds: body
+            .and_then(|b| b.protected_seeds)
+            .unwrap_or(DEFAULT_PROTECTED_SEEDS.min(players)),
+        seed: body.and_then(|b| b.draw_seed),
+        balance_by: body.and_then(|b| b.balance_by).unwrap_or_default(),
+    }
+}
+
+/// The groups a start asks for, for `players` entrants.
+fn group_settings(body: Option<&StartBody>, players: usize) -> GroupSettings {
+    let default = GroupSettings::default_for(players);
+    GroupSettings {
+        group_count: body
+            .and_then(|b| b.group_count)
+            .unwrap_or(default.group_count),
+        advance_per_group: body
+            .and_then(|b| b.advance_per_group)
+            .unwrap_or(default.advance_per_group),
+    }
+}
+
+/// A simulation and, as for a start, its draw.
+#[derive(Deserialize)]
+struct SimulateBody {
+    #[serde(flatten)]
+    simulation: SimulateRequest,
+    #[serde(flatten)]
+    start: StartBody,
+}
+
+#[derive(Deserialize)]
+struct SetModeBody {
+    mode: dart_tournament_web::TournamentMode,
+}
+
+/// Path segment: tournament id (e.g. /api/tournaments/{id})
+#[derive(Deserialize)]
+struct TournamentPath {
+    id: TournamentId,
+}
+
+/// Path segments: tournament id and match id (e.g. /api/tournaments/{id}/bracket/matches/{match_id})
+#[derive(Deserialize)]
+struct TournamentMatchPath {
+    id: TournamentId,
+    match_id: Uuid,
+}
+
+/// Path segments: tournament id and player id (e.g. /api/tournaments/{id}/players/{player_id})
+#[derive(Deserialize)]
+struct TournamentPlayerPath {
+    id: TournamentId,
+    player_id: Uuid,
+}
+
+#[get("/api/health")]
+async fn api_health() -> impl Responder {
+    HttpResponse::Ok().json(HealthResponse {
+        ok: true,
+        service: "dart-tournament-web",
+    })
+}
+
+/// Liveness: the process is up and serving requests.
+#[get("/healthz")]
+async fn healthz() -> HttpResponse {
+    HttpResponse::Ok().json(HealthReport::live())
+}
+
+/// Prometheus scrape endpoint (text format). Open like the health checks, so a scraper needs
+/// no site password.
+#[get("/metrics")]
+async fn metrics(state: AppState, http: Data<HttpMetrics>) -> HttpResponse {
+    let gauges = Gauges {
+        active_tournaments: state.active_count(),
+    };
+    HttpResponse::Ok()
+        .content_type("text/plain; version=0.0.4")
+        .body(render(&http, gauges))
+}
+
+/// Readiness: checks the store can take writes (with a timeout) and that everything loaded at
+/// startup. 503 when any check fails.
+#[get("/readyz")]
+async fn readyz(state: AppState, startup: Data<Startup>) -> HttpResponse {
+    let check = web::block(move || state.check_store());
+    let store_check = match actix_web::rt::time::timeout(READY_CHECK_TIMEOUT, check).await {
+        Ok(Ok(result)) => result,
+        Ok(Err(e)) => Some(Err(std::io::Error::other(e.to_string()))),
+        Err(_) => Some(Err(std::io::ErrorKind::TimedOut.into())),
+    };
+    if let Some(Err(e)) = &store_check {
+        log::warn!("Readiness: store check failed: {}", e);
+    }
+    let report = readiness(store_check.as_ref(), &startup);
+    if report.is_ok() {
+        HttpResponse::Ok().json(report)
+    } else {
+        HttpResponse::ServiceUnavailable().json(report)
+    }
+}
+
+/// Avoid 404 in browser tab: favicon not required for app logic.
+#[get("/favicon.ico")]
+async fn favicon() -> HttpResponse {
+    HttpResponse::NoContent().finish()
+}
+
+/// Returns 204 if `X-Dart-Site-Gate` matches; 401 if not unlocked yet.
+#[get("/api/site-gate/check")]
+async fn api_site_gate_check(req: HttpRequest, gate: web::Data<SiteGate>) -> HttpResponse {
+    if site_gate_header_ok(&req, gate.get_ref()) {
+        HttpResponse::NoContent().finish()
+    } else {
+        HttpResponse::Unauthorized().finish()
+    }
+}
+
+/// POST JSON `{ "password": "..." }` — returns `{ "token": "<hex>" }` on success (must match [`SITE_GATE_PLAIN`]).
+#[post("/api/site-gate")]
+async fn api_site_gate_login(
+    gate: web::Data<SiteGate>,
+    body: Json<SiteGateLoginBody>,
+) -> HttpResponse {
+    let expected = gate.expected_token.as_str();
+    let got = site_gate_token(body.password.trim());
+    if got.as_bytes().ct_eq(expected.as_bytes()).into() {
+        HttpResponse::Ok().json(serde_json::json!({ "token": expected }))
+    } else {
+        api_error_response(ApiError::unauthorized("Wrong password"))
+    }
+}
+
+/// Error envelope for a failed registry operation, with the status from [`ApiError`]. Server
+/// faults are logged here since their cause is not sent to the client.
+fn error_response(e: RegistryError) -> HttpResponse {
+    if matches!(e, RegistryError::LockPoisoned | RegistryError::Storage(_)) {
+        log::error!("{}", e);
+    }
+    let etag = match &e {
+        RegistryError::Stale(stale) => Some(stale.etag.clone()),
+        _ => None,
+    };
+    let mut res = api_error_response(e.into());
+    if let Some(etag) = etag.and_then(|t| HeaderValue::from_str(&t).ok()) {
+        res.headers_mut().insert(header::ETAG, etag);
+    }
+    res
+}
+
+/// `{ "error": { "code", "message", "details" } }` with the error's status.
+fn api_error_response(e: ApiError) -> HttpResponse {
+    let status = StatusCode::from_u16(e.status).unwrap_or(StatusCode::INTERNAL_SERVER_ERROR);
+    HttpResponse::build(status).json(e.envelope())
+}
+
+/// JSON response for a registry result: the tournament on success, [`error_response`] otherwise.
+fn tournament_response(result: Result<Tournament, RegistryError>) -> HttpResponse {
+    match result {
+        Ok(t) => HttpResponse::Ok()
+            .insert_header((header::ETAG, tournament_etag(&t)))
+            .json(t),
+        Err(e) => error_response(e),
+    }
+}
+
+/// Ranked players: `?sort=wins|win_pct|average|checkouts|180s&limit=&offset=&tournament_id=`.
+/// Returns `{ "total": n, "entries": [...] }`; all tournaments unless `tournament_id` is given.
+#[get("/api/leaderboard")]
+async fn api_leaderboard(state: AppState, query: web::Query<LeaderboardQuery>) -> HttpResponse {
+    let tournaments = match query.tournament_id {
+        Some(id) => state.get(id).map(|t| vec![t]),
+        None => state.list(),
+    };
+    match tournaments {
+        Ok(ts) => HttpResponse::Ok().json(leaderboard(
+            &ts,
+            query.sort,
+            query.offset,
+            query.limit.min(MAX_LEADERBOARD_LIMIT),
+        )),
+        Err(e) => error_response(e),
+    }
+}
+
+/// Export rows as a CSV attachment named `filename`, streamed one record at a time until
+/// `deadline` passes, or as a JSON array.
+fn export_response<R>(
+    rows: Vec<R>,
+    format: ExportFormat,
+    filename: String,
+    deadline: Deadline,
+) -> HttpResponse
+where
+    R: CsvRow + Serialize + 'static,
+{
+    if format == ExportFormat::Json {
+        return HttpResponse::Ok().json(rows);
+    }
+    let lines = csv_lines(rows, deadline).map(|r| r.map(web::Bytes::from));
+    let body = futures_util::stream::iter(lines);
+    HttpResponse::Ok()
+        .content_type("text/csv; charset=utf-8")
+        .insert_header(ContentDisposition {
+            disposition: DispositionType::Attachment,
+            parameters: vec![DispositionParam::Filename(filename)],
+        })
+        .streaming(body)
+}
+
+/// File name for a tournament export: its name with anything but letters, digits, `-` and `_`
+/// replaced by `-` ("tournament" when unnamed).
+fn export_filename(tournament: &Tournament, suffix: &str) -> String {
+    let stem: String = tournament
+        .name
+        .trim()
+        .chars()
+        .map(|c| match c {
+            'a'..='z' | 'A'..='Z' | '0'..='9' | '-' | '_' => c,
+            _ => '-',
+        })
+        .collect();
+    match stem.trim_matches('-') {
+        "" => format!("tournament-{suffix}.csv"),
+        stem => format!("{stem}-{suffix}.csv"),
+    }
+}
+
+/// Completed matches of one tournament (round, player A, player B, winner, legs).
+#[get("/api/tournaments/{id}/export.csv")]
+async fn api_export_tournament(
+    req: HttpRequest,
+    state: AppState,
+    path: Path<TournamentPath>,
+    query: web::Query<ExportQuery>,
+) -> HttpResponse {
+    match state.get(path.id) {
+        Ok(t) => export_response(
+            match_rows(&t),
+            query.format,
+            export_filename(&t, "results"),
+            request_deadline(&req),
+        ),
+        Err(e) => error_response(e),
+    }
+}
+
+/// Totals per player (by name) across every tournament.
+#[get("/api/players/export.csv")]
+async fn api_export_players(
+    req: HttpRequest,
+    state: AppState,
+    query: web::Query<ExportQuery>,
+) -> HttpResponse {
+    match state.list() {
+        Ok(ts) => export_response(
+            player_rows(&ts),
+            query.format,
+            "players.csv".to_string(),
+            request_deadline(&req),
+        ),
+        Err(e) => error_response(e),
+    }
+}
+
+/// Recorded matches across tournaments, one page at a time: `?tournament_id=&player=&round=
+/// &completed=true|false&from=YYYY-MM-DD&to=YYYY-MM-DD&limit=&offset=` (all optional; at most
+/// 200 a page). Undecided matches first, then newest result first.
+#[get("/api/matches")]
+async fn api_match_history(state: AppState, query: web::Query<MatchQuery>) -> HttpResponse {
+    match state.list() {
+        Ok(ts) => HttpResponse::Ok().json(match_history(&ts, &query)),
+        Err(e) => error_response(e),
+    }
+}
+
+/// Tournaments, newest first:
+/// `?status=active|finished&player=&format=&from=YYYY-MM-DD&to=YYYY-MM-DD` (all optional;
+/// dates are the day the tournament was created, both ends included).
+#[get("/api/tournaments")]
+async fn api_list_tournaments(
+    state: AppState,
+    query: web::Query<TournamentFilter>,
+) -> HttpResponse {
+    match state.list() {
+        Ok(ts) => HttpResponse::Ok().json(list_tournaments(&ts, &query)),
+        Err(e) => error_response(e),
+    }
+}
+
+/// Create a new tournament from the body's settings: JSON `{ "name", "format", "mode",
+/// "max_losses", "entry_type", "match_formats", "boards", "draw_mode", "plate" }`, all
+/// optional. With
+/// `?template=<name>` the settings come from that template (404 if there is none) and only a
+/// `name` in the body is used. Invalid settings are rejected the same way either way.
+#[post("/api/tournaments")]
+async fn api_create_tournament(
+    state: AppState,
+    templates: Data<TemplateStore>,
+    rating: Data<RatingSettings>,
+    query: web::Query<CreateTournamentQuery>,
+    body: Option<Json<TournamentSettings>>,
+) -> HttpResponse {
+    let body = body.map(Json::into_inner);
+    let settings = match &query.template {
+        Some(name) => match templates.get(name) {
+            Ok(template) => TournamentSettings {
+                name: body
+                    .map(|b| b.name)
+                    .filter(|n| !n.trim().is_empty())
+                    .unwrap_or(template.settings.name),
+                ..template.settings
+            },
+            Err(e) => return api_error_response(e.into()),
+        },
+        None => body.unwrap_or_default(),
+    };
+    if let Err(e) = settings.validate() {
+        return api_error_response(e.into());
+    }
+    let mut tournament = match settings.build() {
+        Ok(t) => t,
+        Err(e) => return error_response(e.into()),
+    };
+    tournament.rating_k = rating.k_factor;
+    tournament_response(state.insert(tournament))
+}
+
+/// Start a new tournament set up like this one (configuration only, no results): JSON
+/// `{ "include_players": true }` enters the same players again, seeded from their results here.
+#[post("/api/tournaments/{id}/clone")]
+async fn api_clone_tournament(
+    state: AppState,
+    path: Path<TournamentPath>,
+    body: Option<Json<CloneTournamentBody>>,
+) -> HttpResponse {
+    let source = match state.get(path.id) {
+        Ok(t) => t,
+        Err(e) => return error_response(e),
+    };
+    let include_players = body.is_some_and(|b| b.include_players);
+    match clone_tournament(&source, include_players) {
+        Ok(clone) => tournament_response(state.insert(clone)),
+        Err(e) => error_response(e.into()),
+    }
+}
+
+/// Saved templates, by name.
+#[get("/api/templates")]
+async fn api_list_templates(templates: Data<TemplateStore>) -> HttpResponse {
+    HttpResponse::Ok().json(templates.list())
+}
+
+/// Save a template (replacing one with the same name): JSON `{ "name": "thursday-league",
+/// "settings": { "format": "single_elimination", "match_formats": { ... }, "boards": 4,
+/// "draw_mode": "random" } }`, with the same settings and checks as creating a tournament.
+#[post("/api/templates")]
+async fn api_save_template(
+    templates: Data<TemplateStore>,
+    body: Json<TournamentTemplate>,
+) -> HttpResponse {
+    if let Err(e) = body.settings.validate() {
+        return api_error_response(e.into());
+    }
+    match templates.save(body.into_inner()) {
+        Ok(template) => HttpResponse::Ok().json(template),
+        Err(e) => {
+            if let TemplateError::Storage(msg) = &e {
+                log::error!("{}", msg);
+            }
+            api_error_response(e.into())
+        }
+    }
+}
+
+/// Start a casual session: JSON `{ "name": "Tuesday", "players": ["Anna", "Ben", "Cara"],
+/// "games_per_round": 1, "mode": "1v1" }` (name, games per round and mode optional).
+#[post("/api/sessions")]
+async fn api_create_session(
+    sessions: Data<SessionStore>,
+    body: Json<CreateSessionBody>,
+) -> HttpResponse {
+    match Session::new(&body.name, body.mode, body.games_per_round, &body.players) {
+        Ok(session) => HttpResponse::Ok().json(sessions.insert(session)),
+        Err(e) => api_error_response(e.into()),
+    }
+}
+
+#[get("/api/sessions/{id}")]
+async fn api_get_session(sessions: Data<SessionStore>, path: Path<SessionPath>) -> HttpResponse {
+    session_response(sessions.get(path.id))
+}
+
+/// A player arrives: JSON `{ "name": "Dan" }`. They play the next game.
+#[post("/api/sessions/{id}/players")]
+async fn api_join_session(
+    sessions: Data<SessionStore>,
+    path: Path<SessionPath>,
+    body: Json<CreatePlayerRequest>,
+) -> HttpResponse {
+    session_response(sessions.update(path.id, |s| s.join(&body.name).map(|_| ())))
+}
+
+#[delete("/api/sessions/{id}/players/{player_id}")]
+async fn api_leave_session(
+    sessions: Data<SessionStore>,
+    path: Path<SessionPlayerPath>,
+) -> HttpResponse {
+    session_response(sessions.update(path.id, |s| s.leave(path.player_id)))
+}
+
+/// Hand out the next game: who plays whom, and who sits out (those who have sat out least,
+/// then longest ago). The session comes back with the game as `current_game`.
+#[post("/api/sessions/{id}/next-game")]
+async fn api_next_session_game(
+    sessions: Data<SessionStore>,
+    path: Path<SessionPath>,
+) -> HttpResponse {
+    session_response(sessions.update(path.id, |s| {
+        s.next_game(&mut rand::thread_rng()).map(|_| ())
+    }))
+}
+
+fn session_response(result: Result<Session, SessionError>) -> HttpResponse {
+    match result {
+        Ok(session) => HttpResponse::Ok().json(session),
+        Err(e) => api_error_response(e.into()),
+    }
+}
+
+/// Start a league season: JSON `{ "name": "Winter league", "points": { "places": [12, 9, 7],
+/// "participation": 1 }, "best_of": 8 }` (all optional; the default table gives 12 to the
+/// winner down to 1 for taking part, and every week counts).
+#[post("/api/seasons")]
+async fn api_create_season(
+    seasons: Data<SeasonStore>,
+    body: Json<CreateSeasonBody>,
+) -> HttpResponse {
+    let body = body.into_inner();
+    season_response(
+        Season::new(&body.name, body.points, body.best_of).and_then(|s| seasons.insert(s)),
+    )
+}
+
+#[get("/api/seasons")]
+async fn api_list_seasons(seasons: Data<SeasonStore>) -> HttpResponse {
+    HttpResponse::Ok().json(seasons.list())
+}
+
+#[get("/api/seasons/{id}")]
+async fn api_get_season(seasons: Data<SeasonStore>, path: Path<SeasonPath>) -> HttpResponse {
+    season_response(seasons.get(path.id))
+}
+
+/// Add a finished tournament to the season as a week, its placements turned into points. 409
+/// if the tournament isn't finished yet or is already in the season.
+#[post("/api/seasons/{id}/tournaments/{tournament_id}")]
+async fn api_attach_season_tournament(
+    state: AppState,
+    seasons: Data<SeasonStore>,
+    path: Path<SeasonTournamentPath>,
+) -> HttpResponse {
+    let t = match state.get(path.tournament_id) {
+        Ok(t) => t,
+        Err(e) => return error_response(e),
+    };
+    season_response(seasons.update(path.id, |s| s.attach(&t)))
+}
+
+/// The season table: points from each player's best `?best=` weeks (the season's own setting
+/// by default), ties split by wins and then head-to-head in the final week.
+#[get("/api/seasons/{id}/standings")]
+async fn api_season_standings(
+    seasons: Data<SeasonStore>,
+    path: Path<SeasonPath>,
+    query: web::Query<SeasonStandingsQuery>,
+) -> HttpResponse {
+    match seasons
+        .get(path.id)
+        .and_then(|s| season_standings(&s, query.best))
+    {
+        Ok(standings) => HttpResponse::Ok().json(standings),
+        Err(e) => api_error_response(e.into()),
+    }
+}
+
+fn season_response(result: Result<Season, SeasonError>) -> HttpResponse {
+    match result {
+        Ok(season) => HttpResponse::Ok().json(season),
+        Err(e) => api_error_response(e.into()),
+    }
+}
+
+/// Get a tournament by id (404 if not found). Touching it refreshes last_activity.
+#[get("/api/tournaments/{id}")]
+async fn api_get_tournament(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
+    tournament_response(state.get(path.id))
+}
+
+/// Delete a tournament (admin key), and its webhooks. 204 on success, 404 if it doesn't exist.
+#[delete("/api/tournaments/{id}")]
+async fn api_delete_tournament(
+    state: AppState,
+    webhooks: Data<WebhookStore>,
+    path: Path<TournamentPath>,
+) -> HttpResponse {
+    match state.remove(path.id) {
+        Ok(_) => {
+            if let Err(e) = webhooks.remove_tournament(path.id) {
+                log::warn!("Could not remove webhooks of {}: {}", path.id, e);
+            }
+            HttpResponse::NoContent().finish()
+        }
+        Err(e) => error_response(e),
+    }
+}
+
+#[post("/api/tournaments/{id}/players")]
+async fn api_add_player(
+    state: AppState,
+    audit: Data<AuditLog>,
+    req: HttpRequest,
+    path: Path<TournamentPath>,
+    body: Json<CreatePlayerRequest>,
+) -> HttpResponse {
+    if let Err(e) = body.validate() {
+        return api_error_response(e.into());
+    }
+    let name = body.name.trim();
+    // Checked under the lock the player is added under, so a delete can't slip in between.
+    let add = |all: &[&Tournament], t: &mut Tournament| {
+        if player_deleted(all.iter().copied(), name) {
+            return Err(TournamentError::PlayerDeleted(name.to_string()));
+        }
+        // Players keep their rating from earlier tournaments (matched by name).
+        let carried = latest_rating(all.iter().copied(), name);
+        t.add_player(name)?;
+        if let (Some(rating), Some(p)) = (carried, t.players.last_mut()) {
+            p.rating = rating;
+        }
+        Ok(())
+    };
+    tournament_response(audited_update_seeing_all(
+        &state, &audit, &req, path.id, add,
+    ))
+}
+
+/// Enter a team in a pairs tournament: JSON `{ "name": "Team A", "members": ["Ann", "Bob"] }`.
+/// A person can be in one team per tournament (409 otherwise). Teams keep their rating from
+/// earlier tournaments (matched by team name).
+#[post("/api/tournaments/{id}/teams")]
+async fn api_add_team(
+    state: AppState,
+    audit: Data<AuditLog>,
+    req: HttpRequest,
+    path: Path<TournamentPath>,
+    body: Json<AddTeamBody>,
+) -> HttpResponse {
+    let name = body.name.trim();
+    let add = |all: &[&Tournament], t: &mut Tournament| {
+        let deleted = std::iter::once(name)
+            .chain(body.members.iter().map(|m| m.trim()))
+            .find(|n| player_deleted(all.iter().copied(), n));
+        if let Some(deleted) = deleted {
+            return Err(TournamentError::PlayerDeleted(deleted.to_string()));
+        }
+        let carried = latest_rating(all.iter().copied(), name);
+        t.add_pair(name, &body.members)?;
+        if let (Some(rating), Some(p)) = (carried, t.players.last_mut()) {
+            p.rating = rating;
+        }
+        Ok(())
+    };
+    tournament_response(audited_update_seeing_all(
+        &state, &audit, &req, path.id, add,
+    ))
+}
+
+/// Register many players at once: a JSON array of names, or a multipart CSV upload (`file`
+/// field; columns name and optional seed). All-or-nothing: any bad line rejects the import with
+/// 422 and the offending lines. Returns the created players with their seeds.
+/// POST /api/tournaments/{id}/players/import, registered with [`MAX_IMPORT_BODY_BYTES`] for
+/// JSON as well as CSV.
+async fn api_import_players(
+    state: AppState,
+    audit: Data<AuditLog>,
+    req: HttpRequest,
+    path: Path<TournamentPath>,
+    body: web::Either<Json<Vec<String>>, MultipartForm<PlayerImportUpload>>,
+) -> HttpResponse {
+    let rows = match body {
+        web::Either::Left(names) => rows_from_names(names.into_inner()),
+        web::Either::Right(upload) => match parse_players_csv(&upload.file.data) {
+            Ok(rows) => rows,
+            Err(e) => return error_response(e.into()),
+        },
+    };
+    // As with single adds, players keep their rating from earlier tournaments, and deleted
+    // players can't be entered.
+    let mut created = Vec::new();
+    let result = audited_update_seeing_all(&state, &audit, &req, path.id, |all, t| {
+        let all = || all.iter().copied();
+        if let Some(row) = rows.iter().find(|r| player_deleted(all(), &r.name)) {
+            return Err(TournamentError::PlayerDeleted(row.name.trim().to_string()));
+        }
+        created = import_players(t, &rows)?;
+        for &id in &created {
+            let Some(p) = t.get_player_mut(id) else {
+                continue;
+            };
+            if let Some(rating) = latest_rating(all(), &p.name) {
+                p.rating = rating;
+            }
+        }
+        Ok(())
+    });
+    match result {
+        Ok(t) => {
+            let players: Vec<PlayerResponse> = created
+                .iter()
+                .filter_map(|&id| t.find_player(id))
+                .map(PlayerResponse::from)
+                .collect();
+            HttpResponse::Ok().json(players)
+        }
+        Err(e) => error_response(e),
+    }
+}
+
+/// Rating changes for a player (by name, across all tournaments), oldest first.
+#[get("/api/players/{name}/rating-history")]
+async fn api_rating_history(state: AppState, path: Path<String>) -> HttpResponse {
+    let tournaments = match state.list() {
+        Ok(ts) => ts,
+        Err(e) => return error_response(e),
+    };
+    let history: Vec<RatingHistoryEntry> = rating_history(&tournaments, path.trim())
+        .into_iter()
+        .map(|(tournament_id, change)| RatingHistoryEntry {
+            tournament_id,
+            change,
+        })
+        .collect();
+    HttpResponse::Ok().json(history)
+}
+
+/// Every tournament a player (by name) entered, newest first, with their finishing place once
+/// the tournament is finished. 404 if no tournament has a player called `{name}`.
+#[get("/api/players/{name}/history")]
+async fn api_player_history(state: AppState, path: Path<String>) -> HttpResponse {
+    let tournaments = match state.list() {
+        Ok(ts) => ts,
+        Err(e) => return error_response(e),
+    };
+    let name = path.trim();
+    if !player_exists(&tournaments, name) {
+        return api_error_response(
+            ApiError::new(404, "player_not_found", "Player not found").with_detail("name", name),
+        );
+    }
+    HttpResponse::Ok().json(player_history(&tournaments, name))
+}
+
+/// Two players' record against each other (by name, across every stored tournament), with
+/// every meeting newest first. 404 if either name isn't a player in any tournament.
+#[get("/api/players/{name}/head-to-head/{opponent}")]
+async fn api_head_to_head(state: AppState, path: Path<(String, String)>) -> HttpResponse {
+    let tournaments = match state.list() {
+        Ok(ts) => ts,
+        Err(e) => return error_response(e),
+    };
+    let (name, opponent) = (path.0.trim(), path.1.trim());
+    if let Some(missing) = [name, opponent]
+        .into_iter()
+        .find(|n| !player_exists(&tournaments, n))
+    {
+        return api_error_response(
+            ApiError::new(404, "player_not_found", "Player not found").with_detail("name", missing),
+        );
+    }
+    HttpResponse::Ok().json(head_to_head(&tournaments, name, opponent))
+}
+
+/// `?tournament_id=` for a player's visit distribution: one tournament instead of all of them.
+#[derive(Deserialize)]
+struct DistributionQuery {
+    tournament_id: Option<TournamentId>,
+}
+
+/// A player's scored visits (by name, across every stored tournament), newest first, a page at
+/// a time. 404 if no tournament has a player called `{name}`.
+#[get("/api/players/{name}/visits")]
+async fn api_player_visits(
+    state: AppState,
+    path: Path<String>,
+    query: web::Query<VisitQuery>,
+) -> HttpResponse {
+    let tournaments = match state.list() {
+        Ok(ts) => ts,
+        Err(e) => return error_response(e),
+    };
+    let name = path.trim();
+    if !player_exists(&tournaments, name) {
+        return api_error_response(
+            ApiError::new(404, "player_not_found", "Player not found").with_detail("name", name),
+        );
+    }
+    HttpResponse::Ok().json(player_visits(&tournaments, name, &query))
+}
+
+/// How a player's visit scores spread over the score bands, with their first-nine averages, for
+/// a heatmap. 404 if no tournament has a player called `{name}`.
+#[get("/api/players/{name}/visit-distribution")]
+async fn api_visit_distribution(
+    state: AppState,
+    path: Path<String>,
+    query: web::Query<DistributionQuery>,
+) -> HttpResponse {
+    let tournaments = match state.list() {
+        Ok(ts) => ts,
+        Err(e) => return error_response(e),
+    };
+    let name = path.trim();
+    if !player_exists(&tournaments, name) {
+        return api_error_response(
+            ApiError::new(404, "player_not_found", "Player not found").with_detail("name", name),
+        );
+    }
+    HttpResponse::Ok().json(visit_distribution(&tournaments, name, query.tournament_id))
+}
+
+/// A player's lifetime totals (by name, across every stored tournament) and the per-tournament
+/// numbers they add up from, newest first. 404 if no tournament has a player called `{name}`.
+#[get("/api/players/{name}")]
+async fn api_player_record(state: AppState, path: Path<String>) -> HttpResponse {
+    let tournaments = match state.list() {
+        Ok(ts) => ts,
+        Err(e) => return error_response(e),
+    };
+    let name = path.trim();
+    match player_record(&tournaments, name) {
+        Some(record) => HttpResponse::Ok().json(record),
+        None => api_error_response(
+            ApiError::new(404, "player_not_found", "Player not found").with_detail("name", name),
+        ),
+    }
+}
+
+/// Rename a player in every tournament: JSON `{ "name": "...", "merge": false }`. 404 if no
+/// tournament has a player called `{name}`; 409 if the new name is taken, unless `merge` is set.
+#[patch("/api/players/{name}")]
+async fn api_rename_player(
+    state: AppState,
+    avatars: Data<AvatarStore>,
+    path: Path<String>,
+    body: Json<RenamePlayerBody>,
+) -> HttpResponse {
+    rename_everywhere(&state, &avatars, &path, &body.name, body.merge)
+}
+
+/// Merge one player into another in every tournament: JSON `{ "from": "dave", "into": "Dave" }`.
+/// Where only `from` entered it is renamed; where both registered for a tournament that
+/// hasn't started, their records are combined and `from` is removed (409 once it has started).
+#[post("/api/players/merge")]
+async fn api_merge_players(
+    state: AppState,
+    avatars: Data<AvatarStore>,
+    body: Json<MergePlayersBody>,
+) -> HttpResponse {
+    rename_everywhere(&state, &avatars, &body.from, &body.into, true)
+}
+
+/// The photo follows the player to their new name; on a merge the one already there is kept.
+fn rename_everywhere(
+    state: &AppState,
+    avatars: &AvatarStore,
+    from: &str,
+    to: &str,
+    merge: bool,
+) -> HttpResponse {
+    let tournaments = match state.list() {
+        Ok(ts) => ts,
+        Err(e) => return error_response(e),
+    };
+    if !player_exists(&tournaments, from) {
+        return api_error_response(
+            ApiError::new(404, "player_not_found", "Player not found").with_detail("name", from),
+        );
+    }
+    // Checked under the lock of the rename itself, so a delete can't slip in between.
+    let renamed = !to.trim().eq_ignore_ascii_case(from.trim());
+    let check = |all: &[&Tournament]| {
+        if renamed && player_deleted(all.iter().copied(), to) {
+            return Err(TournamentError::PlayerDeleted(to.trim().to_string()));
+        }
+        Ok(())
+    };
+    match state.update_all_checked(check, |t| rename_player(t, from, to, merge)) {
+        Ok(tournaments) => {
+            if let Err(e) = avatars.rename(from, to) {
+                log::error!("Could not move the photo of {} to {}: {}", from, to, e);
+            }
+            HttpResponse::Ok().json(RenameResponse {
+                name: to.trim().to_string(),
+                tournaments,
+            })
+        }
+        Err(e) => error_response(e),
+    }
+}
+
+/// Delete a player (admin key). They are marked deleted in every tournament: their matches
+/// still show them and the leaderboard lists them as inactive, but they are left out of the
+/// player export and can't be entered again until restored. 409 while they are entered in a
+/// tournament that hasn't finished. With `?hard=true` a player with no recorded matches is
+/// removed outright, photo and all (204); 409 if they have played, or are in a started draw.
+/// 404 if no tournament has a player called `{name}`.
+#[delete("/api/players/{name}")]
+async fn api_delete_player(
+    state: AppState,
+    avatars: Data<AvatarStore>,
+    path: Path<String>,
+    query: web::Query<DeletePlayerQuery>,
+) -> HttpResponse {
+    let tournaments = match state.list() {
+        Ok(ts) => ts,
+        Err(e) => return error_response(e),
+    };
+    let name = path.trim();
+    if !player_exists(&tournaments, name) {
+        return api_error_response(
+            ApiError::new(404, "player_not_found", "Player not found").with_detail("name", name),
+        );
+    }
+    if !query.hard {
+        let now = chrono::Utc::now();
+        // Deleting again keeps the time they were first deleted.
+        let deleted_at = player_record(&tournaments, name)
+            .and_then(|r| r.deleted_at)
+            .unwrap_or(now);
+        return match state.update_all(|t| delete_player(t, name, now)) {
+            Ok(tournaments) => HttpResponse::Ok().json(DeletePlayerResponse {
+                name: name.to_string(),
+                deleted_at,
+                tournaments,
+            }),
+            Err(e) => error_response(e),
+        };
+    }
+    if let Err(e) = check_hard_delete(&tournaments, name) {
+        return error_response(e.into());
+    }
+    match state.update_all(|t| hard_delete_player(t, name)) {
+        Ok(_) => {
+            if let Err(e) = avatars.remove(name) {
+                log::error!("Could not remove the photo of {}: {}", name, e);
+            }
+            HttpResponse::NoContent().finish()
+        }
+        Err(e) => error_response(e),
+    }
+}
+
+/// Restore a deleted player (admin key) in every tournament, so they can be entered again.
+/// 404 if no tournament has a player called `{name}`.
+#[post("/api/players/{name}/restore")]
+async fn api_restore_player(state: AppState, path: Path<String>) -> HttpResponse {
+    let tournaments = match state.list() {
+        Ok(ts) => ts,
+        Err(e) => return error_response(e),
+    };
+    let name = path.trim();
+    if !player_exists(&tournaments, name) {
+        return api_error_response(
+            ApiError::new(404, "player_not_found", "Player not found").with_detail("name", name),
+        );
+    }
+    match state.update_all(|t| Ok(restore_player(t, name))) {
+        Ok(tournaments) => HttpResponse::Ok().json(RenameResponse {
+            name: name.to_string(),
+            tournaments,
+        }),
+        Err(e) => error_response(e),
+    }
+}
+
+/// Give a player a handicap in every tournament not yet finished: JSON `{ "points": 100,
+/// "legs": 1 }` (`{}` clears it). Matches already being scored keep the handicap they started
+/// with. 404 if no tournament has a player called `{name}`.
+#[put("/api/players/{name}/handicap")]
+async fn api_set_handicap(
+    state: AppState,
+    path: Path<String>,
+    body: Json<Handicap>,
+) -> HttpResponse {
+    if let Err(e) = body.validate() {
+        return api_error_response(e.into());
+    }
+    let tournaments = match state.list() {
+        Ok(ts) => ts,
+        Err(e) => return error_response(e),
+    };
+    let name = path.trim();
+    if !player_exists(&tournaments, name) {
+        return api_error_response(
+            ApiError::new(404, "player_not_found", "Player not found").with_detail("name", name),
+        );
+    }
+    let handicap = body.into_inner();
+    match state.update_all(|t| Ok(set_handicap(t, name, handicap))) {
+        Ok(tournaments) => HttpResponse::Ok().json(HandicapResponse {
+            name: name.to_string(),
+            handicap,
+            tournaments,
+        }),
+        Err(e) => error_response(e),
+    }
+}
+
+/// Upload a player's photo: multipart field `image`, a PNG or JPEG of up to 2 MiB and 4096
+/// pixels a side, checked by its contents rather than its declared type (413, 415 or 422
+/// otherwise). Replaces any photo they had. 404 if no tournament has a player called `{name}`.
+#[post("/api/players/{name}/avatar")]
+async fn api_upload_avatar(
+    state: AppState,
+    avatars: Data<AvatarStore>,
+    path: Path<String>,
+    upload: MultipartForm<AvatarUpload>,
+) -> HttpResponse {
+    let tournaments = match state.list() {
+        Ok(ts) => ts,
+        Err(e) => return error_response(e),
+    };
+    let name = path.trim();
+    if !player_exists(&tournaments, name) {
+        return api_error_response(
+            ApiError::new(404, "player_not_found", "Player not found").with_detail("name", name),
+        );
+    }
+    let avatar = match Avatar::from_upload(upload.into_inner().image.data.to_vec()) {
+        Ok(avatar) => avatar,
+        Err(e) => return api_error_response(e.into()),
+    };
+    let response = AvatarResponse {
+        name: name.to_string(),
+        content_type: avatar.kind.content_type(),
+        width: avatar.width,
+        height: avatar.height,
+    };
+    match avatars.put(name, avatar) {
+        Ok(()) => HttpResponse::Ok().json(response),
+        Err(e) => api_error_response(e.into()),
+    }
+}
+
+/// A player's photo, or an SVG of their initials when they have none. Both carry an `ETag`
+/// and are revalidated on every use (`no-cache`), so a new photo shows at once while an
+/// unchanged one costs a 304.
+#[get("/api/players/{name}/avatar")]
+async fn api_get_avatar(
+    avatars: Data<AvatarStore>,
+    req: HttpRequest,
+    path: Path<String>,
+) -> HttpResponse {
+    let (content_type, body, tag) = match avatars.get(&path) {
+        Some(avatar) => (
+            avatar.kind.content_type(),
+            avatar.bytes.clone(),
+            avatar.etag(),
+        ),
+        None => {
+            let svg = initials_svg(&path).into_bytes();
+            let tag = hex::encode(&Sha256::digest(&svg)[..16]);
+            ("image/svg+xml", svg, tag)
+        }
+    };
+    let quoted = format!("\"{}\"", tag);
+    let seen = req
+        .headers()
+        .get(header::IF_NONE_MATCH)
+        .and_then(|v| v.to_str().ok())
+        .is_some_and(|v| {
+            v.split(',')
+                .any(|t| t.trim().trim_start_matches("W/") == quoted)
+        });
+    if seen {
+        return HttpResponse::NotModified()
+            .insert_header((header::ETAG, quoted))
+            .insert_header((header::CACHE_CONTROL, "no-cache"))
+            .finish();
+    }
+    HttpResponse::Ok()
+        .content_type(content_type)
+        .insert_header((header::ETAG, quoted))
+        .insert_header((header::CACHE_CONTROL, "no-cache"))
+        .body(body)
+}
+
+/// Suggested start-score handicaps for the tournament's players, from their three-dart
+/// averages across every tournament (see `handicap::auto_handicap` for the formula).
+#[get("/api/tournaments/{id}/handicaps")]
+async fn api_suggest_handicaps(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
+    let tournaments = match state.list() {
+        Ok(ts) => ts,
+        Err(e) => return error_response(e),
+    };
+    match tournaments.iter().find(|t| t.id == path.id) {
+        Some(t) => HttpResponse::Ok().json(suggest_handicaps(t, &tournaments)),
+        None => error_response(RegistryError::TournamentNotFound(path.id)),
+    }
+}
+
+/// List every player in the tournament (active, eliminated, semi-final losers) with their stats
+/// for this tournament under `event`.
+#[get("/api/tournaments/{id}/players")]
+async fn api_list_players(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
+    match state.get(path.id) {
+        Ok(t) => HttpResponse::Ok().json(
+            t.all_players()
+                .into_iter()
+                .map(|p| EventPlayerResponse::new(&t, p))
+                .collect::<Vec<_>>(),
+        ),
+        Err(e) => error_response(e),
+    }
+}
+
+/// Get one player by id (404 if not in the tournament).
+#[get("/api/tournaments/{id}/players/{player_id}")]
+async fn api_get_player(state: AppState, path: Path<TournamentPlayerPath>) -> HttpResponse {
+    let t = match state.get(path.id) {
+        Ok(t) => t,
+        Err(e) => return error_response(e),
+    };
+    match t.find_player(path.player_id) {
+        Some(p) => HttpResponse::Ok().json(EventPlayerResponse::new(&t, p)),
+        None => error_response(TournamentError::PlayerNotFound(path.player_id).into()),
+    }
+}
+
+/// Remove a player by id (tournament must be in Setup). Their photo goes too once no
+/// tournament has a player by their name.
+#[delete("/api/tournaments/{id}/players/{player_id}")]
+async fn api_remove_player(
+    if_match: IfMatch,
+    state: AppState,
+    avatars: Data<AvatarStore>,
+    path: Path<TournamentPlayerPath>,
+) -> HttpResponse {
+    let mut name = None;
+    let result = state.update_if(path.id, if_match.get(), |t| {
+        name = t.find_player(path.player_id).map(|p| p.name.clone());
+        t.remove_player(path.player_id)
+    });
+    if let (Ok(_), Some(name)) = (&result, name) {
+        let still_entered = state.list().map_or(true, |ts| player_exists(&ts, &name));
+        if !still_entered {
+            if let Err(e) = avatars.remove(&name) {
+                log::error!("Could not remove the photo of {}: {}", name, e);
+            }
+        }
+    }
+    tournament_response(result)
+}
+
+/// Reassign seeds: JSON `{ "players": [id, ...] }`, top seed first, every player once
+/// (409 once the tournament has started).
+#[put("/api/tournaments/{id}/seeds")]
+async fn api_set_seeds(
+    state: AppState,
+    audit: Data<AuditLog>,
+    req: HttpRequest,
+    path: Path<TournamentPath>,
+    body: Json<SetSeedsBody>,
+) -> HttpResponse {
+    tournament_response(audited_update(&state, &audit, &req, path.id, |t| {
+        t.set_seeds(&body.players)
+    }))
+}
+
+/// Update max losses (tournament must be in Setup).
+#[put("/api/tournaments/{id}/max-losses")]
+async fn api_set_max_losses(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+    body: Json<MaxLossesBody>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), |t| {
+        t.set_max_losses(body.max_losses)
+    }))
+}
+
+/// Whether walkovers count towards the winner's wins: JSON `{ "counts_as_win": true }`
+/// (tournament must be in Setup). Walkovers always put the winner through.
+#[put("/api/tournaments/{id}/walkover-wins")]
+async fn api_set_walkover_wins(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+    body: Json<WalkoverWinsBody>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), |t| {
+        t.set_walkover_counts_as_win(body.counts_as_win)
+    }))
+}
+
+/// Whether the first-round losers of a single-elimination tournament play a plate: JSON
+/// `{ "plate": true }` (tournament must be in Setup). The plate is drawn as soon as the
+/// first round is over; its matches have `"section": "plate"`.
+#[put("/api/tournaments/{id}/plate")]
+async fn api_set_plate(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+    body: Json<PlateBody>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), |t| t.set_plate(body.plate)))
+}
+
+/// Finish a completed tournament: record final placements and archive it. From then on it
+/// can't be changed (409) and is never cleaned up for inactivity.
+#[post("/api/tournaments/{id}/finish")]
+async fn api_finish_tournament(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), finish_tournament))
+}
+
+/// Start the tournament (Setup -> GroupPlay or FinalSelection). Groups then knockout takes
+/// optional JSON `{ "group_count": 4, "advance_per_group": 2 }`. Knockouts take an optional
+/// draw: `{ "draw_mode": "seeded" | "random" | "protected", "protected_seeds": 4,
+/// "draw_seed": 42 }` (the mode defaults to the tournament's `draw_mode`); the tournament's
+/// `draw` then shows the seed used, and passing it again repeats the same draw. A pairs
+/// tournament with draw mode `balanced` draws its people into teams first, ranked by
+/// `"balance_by": "average" | "rating"` over their earlier tournaments; 422
+/// `odd_player_count` if someone would be left without a partner.
+#[post("/api/tournaments/{id}/start")]
+async fn api_start_tournament(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+    body: Option<Json<StartBody>>,
+) -> HttpResponse {
+    let history = match state.get(path.id) {
+        Ok(t) if t.draws_pairs() => state.list().unwrap_or_default(),
+        _ => Vec::new(),
+    };
+    let body = body.as_deref();
+    tournament_response(state.update_if(path.id, if_match.get(), |t| {
+        if t.format != dart_tournament_web::TournamentFormat::GroupsKnockout {
+            carry_form(t, &history);
+            return start_with_draw(t, draw_settings(body, t.draw_mode, t.players.len()));
+        }
+        start_groups_knockout(t, group_settings(body, t.players.len()))
+    }))
+}
+
+/// Play a tournament that hasn't started out on a copy, to check its format before the
+/// night: JSON `{ "outcomes": "random" | "seeded", "minutes_per_leg": 5, "boards": 3,
+/// "entrants": 27, "seed": 42 }`, every field optional, and the draw and group fields a start
+/// takes. Boards default to the tournament's (one if it has none), entrants to those entered
+/// (stand-ins fill up to the number given). Returns the matches, rounds and estimated minutes,
+/// and each entrant's games, the games they are sure of, and place; the seed used repeats it
+/// exactly. The tournament itself is left as it is. 400 once it has started; 422 for the
+/// elimination format.
+#[post("/api/tournaments/{id}/simulate")]
+async fn api_simulate(
+    state: AppState,
+    path: Path<TournamentPath>,
+    body: Option<Json<SimulateBody>>,
+) -> HttpResponse {
+    let body = body.map(Json::into_inner);
+    let request = body
+        .as_ref()
+        .map(|b| b.simulation.clone())
+        .unwrap_or_default();
+    if let Err(e) = request.validate() {
+        return api_error_response(e.into());
+    }
+    let t = match state.get(path.id) {
+        Ok(t) => t,
+        Err(e) => return error_response(e),
+    };
+    let start = body.as_ref().map(|b| &b.start);
+    let entrants = request.entrants.unwrap_or(0).max(t.players.len());
+    let settings = SimulationSettings {
+        outcomes: request.outcomes,
+        minutes_per_leg: request.minutes_per_leg.unwrap_or(DEFAULT_MINUTES_PER_LEG),
+        boards: request.boards.unwrap_or(t.boards.len()).max(1),
+        entrants,
+        seed: request.seed,
+        draw: draw_settings(start, t.draw_mode, entrants),
+        groups: Some(group_settings(start, entrants)),
+    };
+    match simulate(&t, &settings) {
+        Ok(simulation) => HttpResponse::Ok().json(simulation),
+        Err(e) => error_response(e.into()),
+    }
+}
+
+/// Groups then knockout: draw the knockout from the group standings (400 while a group match
+/// has no result).
+#[post("/api/tournaments/{id}/advance-to-knockout")]
+async fn api_advance_to_knockout(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), advance_to_knockout))
+}
+
+/// Generate group play matches (tournament must be in GroupPlay).
+#[post("/api/tournaments/{id}/matches/generate")]
+async fn api_generate_matches(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), generate_group_play_matches))
+}
+
+/// Set winner for one match (tournament must be in GroupPlay).
+#[put("/api/tournaments/{id}/matches/winner")]
+async fn api_set_match_winner(
+    state: AppState,
+    audit: Data<AuditLog>,
+    req: HttpRequest,
+    path: Path<TournamentPath>,
+    body: Json<SetMatchWinnerBody>,
+) -> HttpResponse {
+    tournament_response(audited_update(&state, &audit, &req, path.id, |t| {
+        if !t.matches.iter().any(|m| m.id == body.match_id) {
+            return Err(TournamentError::MatchNotFound(body.match_id));
+        }
+        t.match_results.insert(body.match_id, body.team);
+        Ok(())
+    }))
+}
+
+/// Submit group play results and process (tournament must be in GroupPlay).
+#[post("/api/tournaments/{id}/matches/submit")]
+async fn api_submit_match_results(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), process_group_play_results))
+}
+
+/// Set a player's losses manually (GroupPlay or FinalSelection).
+#[put("/api/tournaments/{id}/players/{player_id}/losses")]
+async fn api_set_player_losses(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPlayerPath>,
+    body: Json<SetPlayerLossesBody>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), |t| {
+        t.set_player_losses(path.player_id, body.losses)
+    }))
+}
+
+/// Withdraw a player from a bracket tournament (BracketPlay): they are out and their remaining
+/// matches become walkovers. Round robin takes optional JSON `{ "void_results": true }` to void
+/// all their matches instead, taking back the wins, losses and rating changes of the ones
+/// already played (scoring totals stay). 409 if they have already withdrawn.
+#[post("/api/tournaments/{id}/players/{player_id}/withdraw")]
+async fn api_withdraw_player(
+    state: AppState,
+    audit: Data<AuditLog>,
+    req: HttpRequest,
+    path: Path<TournamentPlayerPath>,
+    body: Option<Json<WithdrawBody>>,
+) -> HttpResponse {
+    let void_results = body.is_some_and(|b| b.void_results);
+    tournament_response(audited_update(&state, &audit, &req, path.id, |t| {
+        withdraw_player(t, path.player_id, void_results)
+    }))
+}
+
+/// Manually eliminate a player (GroupPlay or FinalSelection).
+#[post("/api/tournaments/{id}/players/{player_id}/eliminate")]
+async fn api_eliminate_player(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPlayerPath>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), |t| {
+        t.eliminate_player(path.player_id)
+    }))
+}
+
+/// Rename the tournament (any state; empty name clears it).
+#[put("/api/tournaments/{id}/name")]
+async fn api_set_name(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+    body: Json<SetNameBody>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), |t| t.set_name(&body.name)))
+}
+
+/// Set tournament mode 1v1 or 2v2 (Setup only).
+#[put("/api/tournaments/{id}/mode")]
+async fn api_set_mode(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+    body: Json<SetModeBody>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), |t| t.set_mode(body.mode)))
+}
+
+/// Restart tournament: back to Setup with same player names.
+#[post("/api/tournaments/{id}/restart")]
+async fn api_restart_tournament(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), |t| t.restart_tournament()))
+}
+
+/// Add selected players from last eliminated back to reach 8 (FinalSelection only).
+#[post("/api/tournaments/{id}/final-selection/add-back")]
+async fn api_final_selection_add_back(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+    body: Json<FinalSelectionAddBackBody>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), |t| {
+        add_players_back_from_last_eliminated(t, &body.player_ids)
+    }))
+}
+
+/// Transition to semi-finals when 8 players in final selection (no add-back needed).
+#[post("/api/tournaments/{id}/final-selection/start-semi")]
+async fn api_final_selection_start_semi(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), start_semi_finals))
+}
+
+/// Generate semi-final matches (SemiFinals only, 8 players).
+#[post("/api/tournaments/{id}/finals/matches")]
+async fn api_finals_generate_matches(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), generate_semi_final_matches))
+}
+
+/// Set winner for a final-round match (semi, finals, or grand finals).
+#[put("/api/tournaments/{id}/finals/winner")]
+async fn api_finals_set_winner(
+    state: AppState,
+    audit: Data<AuditLog>,
+    req: HttpRequest,
+    path: Path<TournamentPath>,
+    body: Json<SetMatchWinnerBody>,
+) -> HttpResponse {
+    tournament_response(audited_update(&state, &audit, &req, path.id, |t| {
+        set_finals_match_winner(t, body.match_id, body.team)
+    }))
 }
 
-#[derive(Deserialize)]
-struct SetModeBody {
-    mode: dart_tournament_web::TournamentMode,
+/// Record a bracket match result (BracketPlay). JSON `{ "winner": "<player id>", "score": { "team_1": 3, "team_2": 1 } }`;
+/// score is optional. A second result for the same match is 409 unless `?overwrite=true`.
+#[post(
+    "/api/tournaments/{id}/bracket/matches/{match_id}/result",
+    wrap = "from_fn(idempotency_middleware)"
+)]
+async fn api_record_bracket_result(
+    state: AppState,
+    audit: Data<AuditLog>,
+    req: HttpRequest,
+    path: Path<TournamentMatchPath>,
+    query: web::Query<OverwriteQuery>,
+    body: Json<RecordResultRequest>,
+) -> HttpResponse {
+    if let Err(e) = body.validate() {
+        return api_error_response(e.into());
+    }
+    tournament_response(audited_update(&state, &audit, &req, path.id, |t| {
+        record_bracket_result(t, path.match_id, body.winner, body.score, query.overwrite)
+    }))
 }
 
-/// Path segment: tournament id (e.g. /api/tournaments/{id})
-#[derive(Deserialize)]
-struct TournamentPath {
-    id: TournamentId,
+/// Give a bracket match to the opponent of a player who didn't turn up (BracketPlay). JSON
+/// `{ "absent": "<player id>" }`. The match is marked `result_type: "walkover"`: no score and
+/// no rating change, and the winner's win only counts if the tournament's walkover setting
+/// says so. 409 if the match already has a result.
+#[post("/api/tournaments/{id}/bracket/matches/{match_id}/walkover")]
+async fn api_record_walkover(
+    state: AppState,
+    audit: Data<AuditLog>,
+    req: HttpRequest,
+    path: Path<TournamentMatchPath>,
+    body: Json<WalkoverBody>,
+) -> HttpResponse {
+    tournament_response(audited_update(&state, &audit, &req, path.id, |t| {
+        record_walkover(t, path.match_id, body.absent)
+    }))
 }
 
-/// Path segments: tournament id and player id (e.g. /api/tournaments/{id}/players/{player_id})
-#[derive(Deserialize)]
-struct TournamentPlayerPath {
-    id: TournamentId,
-    player_id: Uuid,
+/// Swiss: pair the next round once the current one is finished.
+#[post("/api/tournaments/{id}/bracket/next-round")]
+async fn api_next_swiss_round(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), start_next_swiss_round))
 }
 
-#[get("/api/health")]
-async fn api_health() -> impl Responder {
-    HttpResponse::Ok().json(HealthResponse {
-        ok: true,
-        service: "dart-tournament-web",
+/// Preferred checkout for a score: `?remaining=100&darts=2` (darts defaults to 3). `route` is
+/// null when there is no finish, e.g. a bogey number or 120 with two darts.
+#[get("/api/checkout")]
+async fn api_checkout(query: web::Query<CheckoutQuery>) -> HttpResponse {
+    if let Err(e) = collect([darts("darts", query.darts)]) {
+        return api_error_response(e.into());
+    }
+    HttpResponse::Ok().json(CheckoutResponse {
+        remaining: query.remaining,
+        darts: query.darts,
+        route: checkout_route(query.remaining, query.darts),
     })
 }
 
-/// Avoid 404 in browser tab: favicon not required for app logic.
-#[get("/favicon.ico")]
-async fn favicon() -> HttpResponse {
-    HttpResponse::NoContent().finish()
-}
-
-/// Returns 204 if `X-Dart-Site-Gate` matches; 401 if not unlocked yet.
-#[get("/api/site-gate/check")]
-async fn api_site_gate_check(req: HttpRequest, gate: web::Data<SiteGate>) -> HttpResponse {
-    if site_gate_header_ok(&req, gate.get_ref()) {
-        HttpResponse::NoContent().finish()
-    } else {
-        HttpResponse::Unauthorized().finish()
+/// Live score for a match (404 if no visits have been recorded for it), by `game_type`: x01
+/// with the checkout for the side to throw, or cricket with the current leg's marks grid.
+#[get("/api/tournaments/{id}/matches/{match_id}/score")]
+async fn api_get_match_score(state: AppState, path: Path<TournamentMatchPath>) -> HttpResponse {
+    let t = match state.get(path.id) {
+        Ok(t) => t,
+        Err(e) => return error_response(e),
+    };
+    let etag = (header::ETAG, match_etag(&t, path.match_id));
+    if let Some(score) = t.cricket.get(&path.match_id) {
+        return HttpResponse::Ok()
+            .insert_header(etag)
+            .json(CricketScoreResponse::from(score));
+    }
+    match t.scores.get(&path.match_id) {
+        Some(score) => HttpResponse::Ok()
+            .insert_header(etag)
+            .json(MatchScoreResponse::from(score)),
+        None => api_error_response(
+            ApiError::new(404, "match_not_scored", "Match is not being scored")
+                .with_detail("match_id", path.match_id.to_string()),
+        ),
     }
 }
 
-/// POST JSON `{ "password": "..." }` — returns `{ "token": "<hex>" }` on success (must match [`SITE_GATE_PLAIN`]).
-#[post("/api/site-gate")]
-async fn api_site_gate_login(
-    gate: web::Data<SiteGate>,
-    body: Json<SiteGateLoginBody>,
+/// Record one visit. x01: JSON `{ "team": "one", "score": 60, "darts": 3, "double_out": false,
+/// "darts_at_double": 0 }`. Cricket: `{ "team": "one", "game_type": "cricket", "throws": [{
+/// "number": 20, "multiplier": 3 }, ...], "cut_throat": false }`, three darts unless the last
+/// one wins the leg (0 is a miss). The first visit sets the match's game; a visit of the other
+/// game is then 409.
+/// Winning the match records its result (bracket) or selects its winner (group play / finals).
+#[post(
+    "/api/tournaments/{id}/matches/{match_id}/visits",
+    wrap = "from_fn(idempotency_middleware)"
+)]
+async fn api_record_visit(
+    state: AppState,
+    audit: Data<AuditLog>,
+    req: HttpRequest,
+    path: Path<TournamentMatchPath>,
+    body: Json<RecordVisitRequest>,
 ) -> HttpResponse {
-    let expected = gate.expected_token.as_str();
-    let got = site_gate_token(body.password.trim());
-    if got.as_bytes().ct_eq(expected.as_bytes()).into() {
-        HttpResponse::Ok().json(serde_json::json!({ "token": expected }))
-    } else {
-        HttpResponse::Unauthorized().json(serde_json::json!({ "error": "Wrong password" }))
+    if let Err(e) = body.validate() {
+        return api_error_response(e.into());
     }
+    tournament_response(audited_update(
+        &state,
+        &audit,
+        &req,
+        path.id,
+        |t| match body.game_type {
+            GameType::X01 => record_match_visit(
+                t,
+                path.match_id,
+                body.team,
+                body.score.unwrap_or_default(),
+                body.darts,
+                body.double_out,
+                body.darts_at_double,
+            ),
+            GameType::Cricket => {
+                record_cricket_visit(t, path.match_id, body.team, &body.throws, body.cut_throat)
+            }
+        },
+    ))
 }
 
-/// Create a new tournament.
-#[post("/api/tournaments")]
-async fn api_create_tournament(
+/// Undo the last change on a match: a bracket result (409 once the next match has started) or
+/// a scored visit. Repeat to step further back.
+#[post("/api/tournaments/{id}/matches/{match_id}/undo")]
+async fn api_undo_match_action(
     state: AppState,
-    body: Option<Json<CreateTournamentBody>>,
+    audit: Data<AuditLog>,
+    req: HttpRequest,
+    path: Path<TournamentMatchPath>,
 ) -> HttpResponse {
-    let max_losses = body
-        .as_ref()
-        .map(|b| b.max_losses)
-        .unwrap_or_else(default_max_losses);
-    let mode = body
-        .as_ref()
-        .map(|b| b.mode)
-        .unwrap_or(dart_tournament_web::TournamentMode::TwoVTwo);
-
-    let tournament = Tournament::new(max_losses, mode);
-    let id = tournament.id;
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
-    };
-    g.insert(
-        id,
-        TournamentEntry {
-            tournament,
-            last_activity: Instant::now(),
-        },
-    );
-    let entry = g.get(&id).unwrap();
-    HttpResponse::Ok().json(&entry.tournament)
+    tournament_response(audited_update(&state, &audit, &req, path.id, |t| {
+        undo_last_action(t, path.match_id).map(|_| ())
+    }))
 }
 
-/// Get a tournament by id (404 if not found). Touching it refreshes last_activity.
-#[get("/api/tournaments/{id}")]
-async fn api_get_tournament(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
-    };
-    match g.get_mut(&path.id) {
-        Some(entry) => {
-            entry.last_activity = Instant::now();
-            HttpResponse::Ok().json(&entry.tournament)
-        }
-        None => HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" })),
-    }
+/// Start a match's clock by hand, for matches not played on a board (409 if it is decided,
+/// 400 if its players aren't known yet). Matches put on a board start on their own.
+#[post("/api/tournaments/{id}/matches/{match_id}/start")]
+async fn api_start_match(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentMatchPath>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), |t| start_match(t, path.match_id)))
 }
 
-#[post("/api/tournaments/{id}/players")]
-async fn api_add_player(
+/// How long matches are taking: each match's duration, the average per round, the matches
+/// running longer than `?slow_after_minutes=` (default 30), and the estimated finish time
+/// from the recent average and the number of boards.
+#[get("/api/tournaments/{id}/timing")]
+async fn api_timing(
     state: AppState,
     path: Path<TournamentPath>,
-    body: Json<AddPlayerBody>,
+    query: web::Query<TimingQuery>,
 ) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
-    };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
-        }
+    let t = match state.get(path.id) {
+        Ok(t) => t,
+        Err(e) => return error_response(e),
     };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match t.add_player(body.name.trim()) {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
-    }
+    let slow_after = chrono::Duration::minutes(query.slow_after_minutes.max(0));
+    HttpResponse::Ok().json(timing_report(&t, chrono::Utc::now(), slow_after))
 }
 
-/// Remove a player by id (tournament must be in Setup).
-#[delete("/api/tournaments/{id}/players/{player_id}")]
-async fn api_remove_player(state: AppState, path: Path<TournamentPlayerPath>) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
+/// The audit log, newest first: `?tournament_id=&since=<RFC 3339>&limit=` (at most 1000).
+/// Admin key required.
+#[get("/api/audit")]
+async fn api_audit(audit: Data<AuditLog>, query: web::Query<AuditQuery>) -> HttpResponse {
+    HttpResponse::Ok().json(audit.query(&query))
+}
+
+/// Every tournament, season and template as one JSON document, downloaded as a file. Admin
+/// key required. The document is written off the async workers, and stops between
+/// tournaments once the request has timed out.
+#[get("/api/admin/backup")]
+async fn api_backup(
+    req: HttpRequest,
+    state: AppState,
+    seasons: Data<SeasonStore>,
+    templates: Data<TemplateStore>,
+) -> HttpResponse {
+    let backup = match Backup::take(&state, &seasons, &templates) {
+        Ok(backup) => backup,
+        Err(e) => return error_response(e),
     };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
+    let deadline = request_deadline(&req);
+    match web::block(move || backup.to_json_within(&deadline)).await {
+        Ok(Ok(body)) => HttpResponse::Ok()
+            .content_type("application/json")
+            .insert_header(ContentDisposition {
+                disposition: DispositionType::Attachment,
+                parameters: vec![DispositionParam::Filename(format!(
+                    "dart-backup-{}.json",
+                    chrono::Utc::now().format("%Y%m%d-%H%M%S")
+                ))],
+            })
+            .body(body),
+        Ok(Err(e)) => api_error_response(e.into()),
+        Err(e) => {
+            log::error!("Backup could not be written: {}", e);
+            api_error_response(ApiError::internal())
         }
-    };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match t.remove_player(path.player_id) {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
     }
 }
 
-/// Update max losses (tournament must be in Setup).
-#[put("/api/tournaments/{id}/max-losses")]
-async fn api_set_max_losses(
+#[derive(Deserialize)]
+struct RestoreQuery {
+    #[serde(default)]
+    confirm: bool,
+}
+
+/// Replace every tournament, season and template with a backup from `/api/admin/backup` (the
+/// raw document as the body). Needs `?confirm=true`, as everything current is lost; nothing
+/// changes unless the whole backup is read and stored. Admin key required.
+#[post("/api/admin/restore")]
+async fn api_restore(
     state: AppState,
-    path: Path<TournamentPath>,
-    body: Json<MaxLossesBody>,
+    seasons: Data<SeasonStore>,
+    templates: Data<TemplateStore>,
+    query: web::Query<RestoreQuery>,
+    mut payload: web::Payload,
 ) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
-    };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
+    if !query.confirm {
+        return api_error_response(ApiError::invalid_request(
+            "Restoring replaces everything; add ?confirm=true",
+            Some("confirm"),
+        ));
+    }
+    // Read here rather than with a `Bytes` extractor, whose cap is far below a backup's.
+    let mut body = Vec::new();
+    while let Some(chunk) = payload.next().await {
+        let chunk = match chunk {
+            Ok(chunk) => chunk,
+            Err(e) => return api_error_response(ApiError::invalid_request(e.to_string(), None)),
+        };
+        if body.len() + chunk.len() > MAX_RESTORE_BODY_BYTES {
+            return api_error_response(
+                ApiError::new(413, "payload_too_large", "Request body is too large")
+                    .with_detail("max_bytes", MAX_RESTORE_BODY_BYTES),
+            );
         }
-    };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match t.set_max_losses(body.max_losses) {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
+        body.extend_from_slice(&chunk);
+    }
+    let restored = Backup::parse(&body).and_then(|backup| {
+        let counts = (
+            backup.tournaments.len(),
+            backup.seasons.len(),
+            backup.templates.len(),
+        );
+        backup
+            .restore(&state, &seasons, &templates)
+            .map(|()| counts)
+    });
+    match restored {
+        Ok((tournaments, seasons, templates)) => {
+            log::info!(
+                "Restored a backup: {} tournament(s), {} season(s), {} template(s)",
+                tournaments,
+                seasons,
+                templates
+            );
+            HttpResponse::Ok().json(serde_json::json!({
+                "tournaments": tournaments,
+                "seasons": seasons,
+                "templates": templates,
+            }))
+        }
+        Err(e) => api_error_response(e.into()),
     }
 }
 
-/// Start the tournament (Setup -> GroupPlay or FinalSelection).
-#[post("/api/tournaments/{id}/start")]
-async fn api_start_tournament(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
+/// Round-robin standings table, best first, recomputed from the recorded results: wins, then
+/// head-to-head among players level on wins, then leg difference, then seed.
+#[get("/api/tournaments/{id}/standings")]
+async fn api_standings(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
+    let t = match state.get(path.id) {
+        Ok(t) => t,
+        Err(e) => return error_response(e),
     };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
-        }
+    let standings = match round_robin_standings(&t) {
+        Ok(s) => s,
+        Err(e) => return error_response(e.into()),
     };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match start_tournament(t) {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
-    }
+    HttpResponse::Ok().json(standing_rows(&t, &standings))
 }
 
-/// Generate group play matches (tournament must be in GroupPlay).
-#[post("/api/tournaments/{id}/matches/generate")]
-async fn api_generate_matches(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
+/// The knockout bracket laid out for drawing: each match's column, slot and the matches that
+/// feed it (see `bracket_view`). 400 `invalid_state` for a tournament with no knockout to draw.
+#[get("/api/tournaments/{id}/bracket-view")]
+async fn api_bracket_view(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
+    let t = match state.get(path.id) {
+        Ok(t) => t,
+        Err(e) => return error_response(e),
     };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
-        }
-    };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match generate_group_play_matches(t) {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
+    match bracket_view(&t) {
+        Ok(view) => HttpResponse::Ok().json(view),
+        Err(e) => error_response(e.into()),
     }
 }
 
-/// Set winner for one match (tournament must be in GroupPlay).
-#[put("/api/tournaments/{id}/matches/winner")]
-async fn api_set_match_winner(
+#[derive(Deserialize)]
+struct WebhookPath {
+    id: TournamentId,
+    webhook_id: Uuid,
+}
+
+#[derive(Deserialize)]
+struct RegisterWebhookBody {
+    url: String,
+    /// Every event when left out.
+    #[serde(default)]
+    events: Option<Vec<EventKind>>,
+}
+
+fn webhook_error_response(e: WebhookError) -> HttpResponse {
+    if let WebhookError::Storage(msg) = &e {
+        log::error!("{}", msg);
+    }
+    api_error_response(e.into())
+}
+
+/// Register a webhook: JSON `{ "url": "https://bot.example/darts", "events": ["round_started",
+/// "tournament_finished"] }` (events `round_started`, `match_completed` and
+/// `tournament_finished`; all of them when left out). The response holds the webhook's
+/// `secret`, shown this once: deliveries carry `X-Dart-Signature: sha256=<hex HMAC-SHA256 of
+/// the body>` under it.
+#[post("/api/tournaments/{id}/webhooks")]
+async fn api_register_webhook(
     state: AppState,
+    webhooks: Data<WebhookStore>,
     path: Path<TournamentPath>,
-    body: Json<SetMatchWinnerBody>,
+    body: Json<RegisterWebhookBody>,
 ) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
-    };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
-        }
-    };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    if !t.matches.iter().any(|m| m.id == body.match_id) {
-        return HttpResponse::BadRequest().json(serde_json::json!({ "error": "Match not found" }));
+    if let Err(e) = state.get(path.id) {
+        return error_response(e);
     }
-    t.match_results.insert(body.match_id, body.team);
-    HttpResponse::Ok().json(t)
-}
-
-/// Submit group play results and process (tournament must be in GroupPlay).
-#[post("/api/tournaments/{id}/matches/submit")]
-async fn api_submit_match_results(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
-    };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
-        }
-    };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match process_group_play_results(t) {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
+    match webhooks.register(path.id, &body.url, body.events.as_deref()) {
+        Ok(webhook) => HttpResponse::Ok().json(webhook),
+        Err(e) => webhook_error_response(e),
     }
 }
 
-/// Set a player's losses manually (GroupPlay or FinalSelection).
-#[put("/api/tournaments/{id}/players/{player_id}/losses")]
-async fn api_set_player_losses(
+/// A tournament's webhooks without their secrets: each with its status (`active`, or
+/// `disabled` after repeated failures), failures in a row and how the last delivery went.
+#[get("/api/tournaments/{id}/webhooks")]
+async fn api_list_webhooks(
     state: AppState,
-    path: Path<TournamentPlayerPath>,
-    body: Json<SetPlayerLossesBody>,
+    webhooks: Data<WebhookStore>,
+    path: Path<TournamentPath>,
 ) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
-    };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
-        }
-    };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match t.set_player_losses(path.player_id, body.losses) {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
+    if let Err(e) = state.get(path.id) {
+        return error_response(e);
     }
+    let list: Vec<_> = webhooks
+        .list(path.id)
+        .into_iter()
+        .map(|w| w.without_secret())
+        .collect();
+    HttpResponse::Ok().json(list)
 }
 
-/// Manually eliminate a player (GroupPlay or FinalSelection).
-#[post("/api/tournaments/{id}/players/{player_id}/eliminate")]
-async fn api_eliminate_player(state: AppState, path: Path<TournamentPlayerPath>) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
-    };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
-        }
-    };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match t.eliminate_player(path.player_id) {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
+#[delete("/api/tournaments/{id}/webhooks/{webhook_id}")]
+async fn api_remove_webhook(webhooks: Data<WebhookStore>, path: Path<WebhookPath>) -> HttpResponse {
+    match webhooks.remove(path.id, path.webhook_id) {
+        Ok(()) => HttpResponse::NoContent().finish(),
+        Err(e) => webhook_error_response(e),
     }
 }
 
-/// Set tournament mode 1v1 or 2v2 (Setup only).
-#[put("/api/tournaments/{id}/mode")]
-async fn api_set_mode(
-    state: AppState,
-    path: Path<TournamentPath>,
-    body: Json<SetModeBody>,
-) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
-    };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
-        }
-    };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match t.set_mode(body.mode) {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
+/// Send a disabled webhook its events again, its failure count cleared.
+#[put("/api/tournaments/{id}/webhooks/{webhook_id}/enable")]
+async fn api_enable_webhook(webhooks: Data<WebhookStore>, path: Path<WebhookPath>) -> HttpResponse {
+    match webhooks.enable(path.id, path.webhook_id) {
+        Ok(webhook) => HttpResponse::Ok().json(webhook.without_secret()),
+        Err(e) => webhook_error_response(e),
     }
 }
 
-/// Restart tournament: back to Setup with same player names.
-#[post("/api/tournaments/{id}/restart")]
-async fn api_restart_tournament(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
+/// Groups then knockout: each group with its standings (same order and tiebreakers as
+/// `/standings`), final once the knockout is drawn.
+#[get("/api/tournaments/{id}/groups")]
+async fn api_groups(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
+    let t = match state.get(path.id) {
+        Ok(t) => t,
+        Err(e) => return error_response(e),
     };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
-        }
+    let groups = match group_standings(&t) {
+        Ok(g) => g,
+        Err(e) => return error_response(e.into()),
     };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match t.restart_tournament() {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
-    }
+    let body: Vec<GroupResponse> = groups
+        .iter()
+        .map(|(g, standings)| GroupResponse {
+            name: &g.name,
+            standings: standing_rows(&t, standings),
+        })
+        .collect();
+    HttpResponse::Ok().json(body)
 }
 
-/// Add selected players from last eliminated back to reach 8 (FinalSelection only).
-#[post("/api/tournaments/{id}/final-selection/add-back")]
-async fn api_final_selection_add_back(
+#[derive(Deserialize)]
+struct FullQuery {
+    /// Comma-separated sections; all of them when absent.
+    include: Option<String>,
+}
+
+/// Everything a tournament page shows, in one response read from a single copy of the
+/// tournament, so no part can be ahead of another (a winner shown but not yet in the next
+/// round): the tournament, and the sections `?include=players,matches,standings,boards,visits`
+/// names (all of them by default; leave out `visits` on a big event). `state_version` is the
+/// tournament's version, as in the ETag. Compressed when the client accepts gzip, brotli or
+/// zstd.
+#[get("/api/tournaments/{id}/full", wrap = "Compress::default()")]
+async fn api_full_tournament(
     state: AppState,
     path: Path<TournamentPath>,
-    body: Json<FinalSelectionAddBackBody>,
+    query: web::Query<FullQuery>,
 ) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
+    let sections = match include_sections(query.include.as_deref()) {
+        Ok(sections) => sections,
+        Err(e) => return api_error_response(e.into()),
     };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
-        }
+    let t = match state.get(path.id) {
+        Ok(t) => t,
+        Err(e) => return error_response(e),
     };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match add_players_back_from_last_eliminated(t, &body.player_ids) {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
-    }
+    HttpResponse::Ok()
+        .insert_header((header::ETAG, tournament_etag(&t)))
+        .json(FullResponse::new(&t, &sections))
 }
 
-/// Transition to semi-finals when 8 players in final selection (no add-back needed).
-#[post("/api/tournaments/{id}/final-selection/start-semi")]
-async fn api_final_selection_start_semi(
+/// Set the legs (or sets) each round is played over, replacing the current formats: JSON
+/// `{ "rounds": { "1": { "legs": 3 } }, "semi_final": { "legs": 5 }, "final": { "legs": 5,
+/// "sets": 5 } }`. Counts must be odd; a round with completed matches is 409.
+#[put("/api/tournaments/{id}/format")]
+async fn api_set_match_formats(
     state: AppState,
+    audit: Data<AuditLog>,
+    req: HttpRequest,
     path: Path<TournamentPath>,
+    body: Json<MatchFormats>,
 ) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
-    };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
-        }
-    };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match start_semi_finals(t) {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": format!("{}", e) })),
-    }
+    tournament_response(audited_update(&state, &audit, &req, path.id, |t| {
+        set_match_formats(t, body.into_inner())
+    }))
 }
 
-/// Generate semi-final matches (SemiFinals only, 8 players).
-#[post("/api/tournaments/{id}/finals/matches")]
-async fn api_finals_generate_matches(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
+/// Set the venue's boards: JSON `{ "boards": 4 }` or `{ "boards": ["Main", "Side"] }`.
+/// Ready bracket matches are assigned to free boards straight away.
+#[put("/api/tournaments/{id}/boards")]
+async fn api_set_boards(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+    body: Json<SetBoardsBody>,
+) -> HttpResponse {
+    let names = match &body.boards {
+        BoardsSpec::Count(n) => numbered_boards((*n).min(MAX_BOARDS + 1)),
+        BoardsSpec::Names(names) => names.clone(),
     };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
-        }
+    tournament_response(state.update_if(path.id, if_match.get(), |t| set_boards(t, &names)))
+}
+
+/// Matches on the boards now: `[{ "board", "match" }]` in board order. A board frees up when
+/// its match gets a result and takes the next match whose players are both free.
+#[get("/api/tournaments/{id}/next-matches")]
+async fn api_next_matches(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
+    let t = match state.get(path.id) {
+        Ok(t) => t,
+        Err(e) => return error_response(e),
     };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match generate_semi_final_matches(t) {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
-    }
+    let body: Vec<NextMatchResponse> = next_matches(&t)
+        .into_iter()
+        .map(|(board, m)| NextMatchResponse {
+            board: &board.name,
+            bracket_match: m,
+        })
+        .collect();
+    HttpResponse::Ok().json(body)
 }
 
-/// Set winner for a final-round match (semi, finals, or grand finals).
-#[put("/api/tournaments/{id}/finals/winner")]
-async fn api_finals_set_winner(
+/// The venue scoreboard: each board with the match on it (players, leg score, legs and sets
+/// won, who throws, and their checkout when they're on one) and the next two matches up.
+/// Long-poll by sending the last `ETag` back as `If-None-Match` (or `?etag=`): the request
+/// waits up to 25 s for the scoreboard to change, then answers 304 if it didn't.
+#[get("/api/tournaments/{id}/display")]
+async fn api_display(
     state: AppState,
+    req: HttpRequest,
     path: Path<TournamentPath>,
-    body: Json<SetMatchWinnerBody>,
+    query: web::Query<DisplayQuery>,
 ) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
-    };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
+    let seen = query.etag.clone().or_else(|| {
+        req.headers()
+            .get(header::IF_NONE_MATCH)
+            .and_then(|v| v.to_str().ok())
+            .map(|v| v.trim_start_matches("W/").trim_matches('"').to_string())
+    });
+    let deadline = Instant::now() + DISPLAY_POLL_TIMEOUT;
+    loop {
+        let board = match state.get(path.id) {
+            Ok(t) => scoreboard(&t),
+            Err(e) => return error_response(e),
+        };
+        let tag = etag(&board);
+        let quoted = format!("\"{}\"", tag);
+        if seen.as_deref() != Some(tag.as_str()) {
+            return HttpResponse::Ok()
+                .insert_header((header::ETAG, quoted))
+                .insert_header((header::CACHE_CONTROL, "no-cache"))
+                .json(board);
         }
-    };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    match set_finals_match_winner(t, body.match_id, body.team) {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
+        if Instant::now() >= deadline {
+            return HttpResponse::NotModified()
+                .insert_header((header::ETAG, quoted))
+                .finish();
+        }
+        actix_web::rt::time::sleep(DISPLAY_POLL_INTERVAL).await;
     }
 }
 
 /// Submit current final round (semi → finals, finals → completed).
 #[post("/api/tournaments/{id}/finals/submit")]
-async fn api_finals_submit(state: AppState, path: Path<TournamentPath>) -> HttpResponse {
-    let mut g = match state.write() {
-        Ok(guard) => guard,
-        Err(_) => return HttpResponse::InternalServerError().body("lock error"),
-    };
-    let entry = match g.get_mut(&path.id) {
-        Some(e) => e,
-        None => {
-            return HttpResponse::NotFound().json(serde_json::json!({ "error": "No tournament" }))
-        }
-    };
-    entry.last_activity = Instant::now();
-    let t = &mut entry.tournament;
-    let result = match t.state {
-        dart_tournament_web::TournamentState::SemiFinals => process_semi_final_results(t),
-        dart_tournament_web::TournamentState::Finals => process_finals_results(t),
-        _ => Err(dart_tournament_web::TournamentError::InvalidState),
-    };
-    match result {
-        Ok(()) => HttpResponse::Ok().json(t),
-        Err(e) => HttpResponse::BadRequest().json(serde_json::json!({ "error": e.to_string() })),
+async fn api_finals_submit(
+    if_match: IfMatch,
+    state: AppState,
+    path: Path<TournamentPath>,
+) -> HttpResponse {
+    tournament_response(state.update_if(path.id, if_match.get(), |t| match t.state {
+        TournamentState::SemiFinals => process_semi_final_results(t),
+        TournamentState::Finals => process_finals_results(t),
+        _ => Err(TournamentError::InvalidState),
+    }))
+}
+
+/// Registry backed by the file store in `dir`, with every tournament already in it loaded.
+/// Migrate the data directory to the current schema, then load it.
+fn open_store(dir: &str) -> Result<TournamentRegistry, MigrateError> {
+    for version in migrate(dir.as_ref())? {
+        log::info!(
+            "Applied migration {} ({}) to {}",
+            version,
+            MIGRATIONS[version as usize - 1].name,
+            dir
+        );
     }
+    let store = FileStore::open(dir)?;
+    Ok(TournamentRegistry::with_store(Box::new(store))?)
+}
+
+/// Database file in DATA_DIR when STORAGE_DRIVER=sqlite and SQLITE_PATH isn't set.
+const SQLITE_FILE: &str = "tournaments.db";
+
+/// Registry backed by the SQLite database at `path`, with every tournament already in it
+/// loaded (rows from an older schema version are migrated as they are read).
+#[cfg(feature = "sqlite")]
+fn open_sqlite(path: &std::path::Path) -> std::io::Result<TournamentRegistry> {
+    let store = dart_tournament_web::SqliteStore::open(path)?;
+    TournamentRegistry::with_store(Box::new(store))
+}
+
+#[cfg(not(feature = "sqlite"))]
+fn open_sqlite(_: &std::path::Path) -> std::io::Result<TournamentRegistry> {
+    Err(std::io::Error::new(
+        std::io::ErrorKind::Unsupported,
+        "STORAGE_DRIVER=sqlite needs a build with `--features sqlite`",
+    ))
 }
 
 fn default_host() -> String {
@@ -659,53 +3241,284 @@ async fn main() -> std::io::Result<()> {
     let bind = (host.as_str(), port);
     log::info!("Starting server at http://{}:{}", bind.0, bind.1);
 
-    let state = Data::new(RwLock::new(HashMap::<TournamentId, TournamentEntry>::new()));
+    // Load failures are logged and reported by /readyz rather than stopping the server.
+    let mut startup = Startup::default();
+    let data_dir = std::env::var("DATA_DIR").ok();
+    let driver = match std::env::var("STORAGE_DRIVER") {
+        Ok(value) => value.parse::<StorageDriver>().map_err(|e: UnknownDriver| {
+            log::error!("{}", e);
+            std::io::Error::other(e)
+        })?,
+        Err(_) if data_dir.is_some() => StorageDriver::File,
+        Err(_) => StorageDriver::Memory,
+    };
+    let registry = match driver {
+        StorageDriver::Memory => TournamentRegistry::new(),
+        StorageDriver::File => {
+            let Some(dir) = data_dir else {
+                log::error!("STORAGE_DRIVER=file needs DATA_DIR");
+                return Err(std::io::Error::other("DATA_DIR is not set"));
+            };
+            match open_store(&dir) {
+                Ok(registry) => {
+                    log::info!(
+                        "Persisting tournaments in {} ({} loaded)",
+                        dir,
+                        registry.len()
+                    );
+                    registry
+                }
+                Err(e @ MigrateError::Ahead { .. }) => {
+                    // A newer binary wrote this data; saving over it could lose what it added.
+                    log::error!("Refusing to start on {}: {}", dir, e);
+                    return Err(std::io::Error::other(e));
+                }
+                Err(e) => {
+                    log::error!(
+                        "Could not load tournaments from {}: {}; serving from memory, not ready",
+                        dir,
+                        e
+                    );
+                    startup.store_failed = true;
+                    TournamentRegistry::new()
+                }
+            }
+        }
+        StorageDriver::Sqlite => {
+            let Some(path) = std::env::var_os("SQLITE_PATH")
+                .map(PathBuf::from)
+                .or_else(|| data_dir.map(|dir| PathBuf::from(dir).join(SQLITE_FILE)))
+            else {
+                log::error!("STORAGE_DRIVER=sqlite needs SQLITE_PATH or DATA_DIR");
+                return Err(std::io::Error::other("SQLITE_PATH is not set"));
+            };
+            match open_sqlite(&path) {
+                Ok(registry) => {
+                    log::info!(
+                        "Persisting tournaments in {} ({} loaded)",
+                        path.display(),
+                        registry.len()
+                    );
+                    registry
+                }
+                Err(e) if e.kind() == std::io::ErrorKind::Unsupported => {
+                    log::error!("{}", e);
+                    return Err(e);
+                }
+                Err(e) => {
+                    log::error!(
+                        "Could not load tournaments from {}: {}; serving from memory, not ready",
+                        path.display(),
+                        e
+                    );
+                    startup.store_failed = true;
+                    TournamentRegistry::new()
+                }
+            }
+        }
+    };
+    let mut snapshot_path = std::env::var_os("SNAPSHOT_PATH").map(PathBuf::from);
+    if let Some(path) = &snapshot_path {
+        match registry.load_snapshot(path) {
+            Ok(loaded) => {
+                log::info!("Loaded {} tournament(s) from {}", loaded, path.display());
+                startup.snapshot_loaded = Some(true);
+            }
+            Err(e) => {
+                log::error!(
+                    "Could not load snapshot {}: {}; not ready",
+                    path.display(),
+                    e
+                );
+                startup.snapshot_loaded = Some(false);
+            }
+        }
+    }
+    if startup.snapshot_loaded == Some(false) {
+        // Don't replace a snapshot that couldn't be read with whatever is in memory at shutdown.
+        snapshot_path = None;
+    }
+    let startup = Data::new(startup);
+    let webhooks = Arc::new(open_webhooks());
+    let dispatcher = Dispatcher::start(Arc::clone(&webhooks));
+    let webhooks = Data::from(webhooks);
+    let state = Data::new(registry.with_listener(dispatcher));
+    let snapshot_state = state.clone();
     let site_gate = web::Data::new(SiteGate::new());
+    let rating = Data::new(RatingSettings::from_env());
+    log::info!("Elo K-factor {}", rating.k_factor);
     log::info!("Site gate active (see SITE_GATE_PLAIN in web.rs)");
+    let rate_limiter = Data::new(rate_limiter_from_env());
+    log::info!(
+        "Rate limit {} requests/s per client, burst {}",
+        rate_limiter.per_second(),
+        rate_limiter.burst()
+    );
+    let request_timeout = Data::new(request_timeout_from_env());
+    log::info!("Request timeout {:?}", request_timeout.0);
+    let audit_path = std::env::var_os("AUDIT_LOG_PATH")
+        .map(PathBuf::from)
+        .or_else(|| std::env::var_os("DATA_DIR").map(|d| PathBuf::from(d).join("audit.jsonl")))
+        .unwrap_or_else(|| PathBuf::from("audit.jsonl"));
+    let audit_log = Data::new(match AuditLog::open(&audit_path) {
+        Ok(audit) => {
+            log::info!("Audit log at {}", audit_path.display());
+            audit
+        }
+        Err(e) => {
+            log::error!(
+                "Could not open audit log {}: {}; keeping it in memory only",
+                audit_path.display(),
+                e
+            );
+            AuditLog::in_memory()
+        }
+    });
+    let templates = Data::new(open_templates());
+    let sessions = Data::new(SessionStore::new());
+    let seasons = Data::new(open_seasons());
+    let avatars = Data::new(open_avatars());
+    let idempotency = Data::new(open_idempotency());
+    let api_keys = Data::new(load_api_keys()?);
+    let http_metrics = Data::new(HttpMetrics::new());
+    if api_keys.is_empty() {
+        log::warn!("No API keys configured: write endpoints are open to anyone");
+    }
 
-    // Background task: every 30 minutes, remove tournaments inactive for 12+ hours
+    // Background task: every 30 minutes, remove tournaments inactive for 12+ hours (and
+    // their webhooks, secrets included)
     let state_cleanup = state.clone();
+    let webhooks_cleanup = webhooks.clone();
     actix_web::rt::spawn(async move {
         let mut interval = actix_web::rt::time::interval(Duration::from_secs(30 * 60));
         loop {
             interval.tick().await;
-            let mut g = match state_cleanup.write() {
-                Ok(guard) => guard,
-                Err(_) => continue,
+            let removed = match state_cleanup.remove_inactive(INACTIVITY_TIMEOUT) {
+                Ok(ids) => ids,
+                Err(e) => {
+                    log::error!("Could not clean up inactive tournaments: {}", e);
+                    continue;
+                }
             };
-            let before = g.len();
-            g.retain(|_, entry| entry.last_activity.elapsed() < INACTIVITY_TIMEOUT);
-            let removed = before - g.len();
-            if removed > 0 {
+            for id in &removed {
+                if let Err(e) = webhooks_cleanup.remove_tournament(*id) {
+                    log::warn!("Could not remove webhooks of {}: {}", id, e);
+                }
+            }
+            if !removed.is_empty() {
                 log::info!(
                     "Cleaned up {} inactive tournament(s) (no activity for 12h)",
-                    removed
+                    removed.len()
                 );
             }
         }
     });
 
+    // Background task: every 5 minutes, forget rate-limit buckets of clients gone quiet.
+    let limiter_cleanup = rate_limiter.clone();
+    actix_web::rt::spawn(async move {
+        let mut interval = actix_web::rt::time::interval(Duration::from_secs(5 * 60));
+        loop {
+            interval.tick().await;
+            limiter_cleanup.evict_idle(Instant::now(), RATE_LIMIT_IDLE);
+        }
+    });
+
+    // Background task: every hour, drop idempotency records past their time.
+    let idempotency_cleanup = idempotency.clone();
+    actix_web::rt::spawn(async move {
+        let mut interval = actix_web::rt::time::interval(Duration::from_secs(60 * 60));
+        loop {
+            interval.tick().await;
+            if let Err(e) = idempotency_cleanup.remove_expired(chrono::Utc::now()) {
+                log::warn!("Could not drop expired idempotency records: {}", e);
+            }
+        }
+    });
+
     HttpServer::new(move || {
         App::new()
+            .wrap(from_fn(api_key_middleware))
             .wrap(from_fn(site_gate_middleware))
+            .wrap(from_fn(body_limit_middleware))
+            .wrap(from_fn(rate_limit_middleware))
+            .wrap(from_fn(timeout_middleware))
+            .wrap(from_fn(metrics_middleware))
+            .wrap(from_fn(error_middleware))
+            .app_data(web::JsonConfig::default().limit(MAX_BODY_BYTES))
+            .app_data(MultipartFormConfig::default().total_limit(MAX_IMPORT_BODY_BYTES))
+            .app_data(rate_limiter.clone())
+            .app_data(request_timeout.clone())
+            .app_data(audit_log.clone())
             .app_data(state.clone())
             .app_data(site_gate.clone())
+            .app_data(rating.clone())
+            .app_data(api_keys.clone())
+            .app_data(startup.clone())
+            .app_data(http_metrics.clone())
+            .app_data(templates.clone())
+            .app_data(sessions.clone())
+            .app_data(seasons.clone())
+            .app_data(avatars.clone())
+            .app_data(idempotency.clone())
+            .app_data(webhooks.clone())
             .route("/", web::get().to(serve_index_async))
             .service(api_health)
+            .service(healthz)
+            .service(readyz)
+            .service(metrics)
             .service(favicon)
             .service(api_site_gate_check)
             .service(api_site_gate_login)
+            .service(api_list_tournaments)
+            .service(api_match_history)
             .service(api_create_tournament)
+            .service(api_clone_tournament)
+            .service(api_list_templates)
+            .service(api_save_template)
             .service(api_get_tournament)
+            .service(api_full_tournament)
+            .service(api_delete_tournament)
+            .service(api_leaderboard)
+            .service(api_export_players)
+            .service(api_export_tournament)
+            .service(api_list_players)
+            .service(api_get_player)
+            .service(api_rating_history)
+            .service(api_player_history)
+            .service(api_head_to_head)
+            .service(api_player_visits)
+            .service(api_visit_distribution)
+            .service(api_player_record)
+            .service(api_merge_players)
+            .service(api_rename_player)
+            .service(api_delete_player)
+            .service(api_restore_player)
+            .service(api_set_handicap)
+            .service(api_suggest_handicaps)
+            .service(api_upload_avatar)
+            .service(api_get_avatar)
             .service(api_add_player)
+            .service(api_add_team)
+            .service(
+                web::resource("/api/tournaments/{id}/players/import")
+                    .app_data(web::JsonConfig::default().limit(MAX_IMPORT_BODY_BYTES))
+                    .route(web::post().to(api_import_players)),
+            )
             .service(api_remove_player)
             .service(api_set_max_losses)
+            .service(api_set_walkover_wins)
+            .service(api_set_plate)
+            .service(api_set_seeds)
+            .service(api_set_name)
             .service(api_set_mode)
             .service(api_start_tournament)
+            .service(api_finish_tournament)
             .service(api_generate_matches)
             .service(api_set_match_winner)
             .service(api_submit_match_results)
             .service(api_set_player_losses)
+            .service(api_withdraw_player)
             .service(api_eliminate_player)
             .service(api_restart_tournament)
             .service(api_final_selection_add_back)
@@ -713,18 +3526,63 @@ async fn main() -> std::io::Result<()> {
             .service(api_finals_generate_matches)
             .service(api_finals_set_winner)
             .service(api_finals_submit)
+            .service(api_record_bracket_result)
+            .service(api_record_walkover)
+            .service(api_next_swiss_round)
+            .service(api_advance_to_knockout)
+            .service(api_simulate)
+            .service(api_checkout)
+            .service(api_get_match_score)
+            .service(api_record_visit)
+            .service(api_undo_match_action)
+            .service(api_start_match)
+            .service(api_audit)
+            .service(api_backup)
+            .service(api_restore)
+            .service(api_timing)
+            .service(api_set_match_formats)
+            .service(api_set_boards)
+            .service(api_next_matches)
+            .service(api_display)
+            .service(api_create_session)
+            .service(api_get_session)
+            .service(api_join_session)
+            .service(api_leave_session)
+            .service(api_next_session_game)
+            .service(api_create_season)
+            .service(api_list_seasons)
+            .service(api_get_season)
+            .service(api_attach_season_tournament)
+            .service(api_season_standings)
+            .service(api_standings)
+            .service(api_groups)
+            .service(api_bracket_view)
+            .service(api_register_webhook)
+            .service(api_list_webhooks)
+            .service(api_remove_webhook)
+            .service(api_enable_webhook)
             .service(Files::new("/static", "static").show_files_listing())
     })
+    // SIGINT/SIGTERM stop accepting connections and let in-flight requests finish.
+    .shutdown_timeout(SHUTDOWN_TIMEOUT_SECS)
     .bind(bind)?
     .run()
-    .await
+    .await?;
+
+    if let Some(path) = snapshot_path {
+        match snapshot_state.write_snapshot(&path) {
+            Ok(n) => log::info!("Saved {} tournament(s) to {}", n, path.display()),
+            Err(e) => log::error!("Could not write snapshot {}: {}", path.display(), e),
+        }
+    }
+    Ok(())
 }
 
 async fn serve_index_async() -> HttpResponse {
     let html = include_str!("../../templates/index.html");
     let html = html.replacen(
         "</head>",
-        r#"<script src="/static/site-gate-temp.js"></script></head>"#,
+        r#"<script src="/static/site-gate-temp.js"></script><script src="/static/api-key.js"></script></head>"#,
         1,
     );
     HttpResponse::Ok()
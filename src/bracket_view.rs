@@ -0,0 +1,191 @@
+//! The knockout bracket laid out for drawing: every match with where it sits and which
+//! matches feed it, so a page can draw the boxes and the lines between them without working
+//! out the tree itself.
+//!
+//! Each section (winners, losers, grand final, plate) is drawn as a block of its own, a
+//! column per round. A match's `slot` is its centre line, counted in half first-round boxes
+//! from the top of its block: the first round sits on slots 1, 3, 5, …, and a match fed by
+//! two sits midway between them. The losers bracket and grand final are as tall as the winners
+//! bracket, so their finals line up with the winners final; the plate is as tall as its own
+//! first round. Columns count across the whole drawing: the losers bracket and the plate start
+//! under the winners' first round, and the grand final follows whichever of the winners and
+//! losers brackets is longer.
+//!
+//! Positions follow from a match's section, round and number alone, which it keeps for life,
+//! so results coming in never move a match.
+
+use crate::export::bracket_round_label;
+use crate::models::{
+    BracketMatch, BracketSection, LegScore, MatchId, PlayerId, Team, Tournament, TournamentError,
+    TournamentFormat, TournamentId,
+};
+use serde::Serialize;
+use std::collections::HashMap;
+
+/// A tournament's knockout bracket as [`bracket_view`] lays it out.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct BracketView {
+    pub tournament_id: TournamentId,
+    pub format: TournamentFormat,
+    /// Winners, losers, grand final, plate: those the bracket has.
+    pub sections: Vec<SectionView>,
+}
+
+/// One block of the drawing.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct SectionView {
+    pub section: BracketSection,
+    /// Column of the section's first round.
+    pub first_column: u32,
+    pub rounds: u32,
+    /// Height of the block in slots.
+    pub slots: u32,
+    /// Round by round, top to bottom.
+    pub matches: Vec<MatchView>,
+}
+
+/// One match box.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct MatchView {
+    pub match_id: MatchId,
+    pub label: String,
+    /// 0-based round within the section.
+    pub round_index: u32,
+    /// 1-based position within the round, top to bottom.
+    pub number: u32,
+    pub column: u32,
+    pub slot: u32,
+    pub player_1: Option<PlayerView>,
+    pub player_2: Option<PlayerView>,
+    pub winner: Option<Team>,
+    pub score: Option<LegScore>,
+    pub bye: bool,
+    /// The matches whose winners (or losers) take this one's sides, side one first. Empty in
+    /// the first round and in the plate's, whose players are drawn from results instead.
+    pub sources: Vec<MatchSource>,
+}
+
+/// A side of a match box, once the player is known.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct PlayerView {
+    pub player_id: PlayerId,
+    pub name: String,
+}
+
+/// A line into a match box: which match it comes from and which side it fills.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, Serialize)]
+pub struct MatchSource {
+    pub match_id: MatchId,
+    pub team: Team,
+    /// It is that match's loser who comes (a drop into the losers bracket, or the grand final
+    /// reset), not its winner.
+    pub loser: bool,
+}
+
+const SECTIONS: [BracketSection; 4] = [
+    BracketSection::Winners,
+    BracketSection::Losers,
+    BracketSection::GrandFinal,
+    BracketSection::Plate,
+];
+
+/// The bracket of a knockout tournament laid out for drawing (see the module docs). Round
+/// robin and Swiss tournaments have no knockout to draw, and one of groups then knockout
+/// doesn't until the knockout is drawn: [`TournamentError::InvalidState`].
+pub fn bracket_view(tournament: &Tournament) -> Result<BracketView, TournamentError> {
+    let knockout = match tournament.format {
+        TournamentFormat::SingleElimination | TournamentFormat::DoubleElimination => true,
+        TournamentFormat::GroupsKnockout => tournament
+            .group_stage
+            .as_ref()
+            .is_some_and(|s| s.knockout_started),
+        _ => false,
+    };
+    let bracket = tournament
+        .bracket
+        .as_ref()
+        .filter(|_| knockout)
+        .ok_or(TournamentError::InvalidState)?;
+
+    let mut sources: HashMap<MatchId, Vec<MatchSource>> = HashMap::new();
+    for m in &bracket.matches {
+        let to = [(m.winner_to, false), (m.loser_to, true)];
+        for (slot, loser) in to {
+            if let Some(slot) = slot {
+                sources.entry(slot.match_id).or_default().push(MatchSource {
+                    match_id: m.id,
+                    team: slot.team,
+                    loser,
+                });
+            }
+        }
+    }
+    for feeds in sources.values_mut() {
+        feeds.sort_by_key(|s| s.team == Team::Two);
+    }
+
+    let rounds = |section| bracket.section_round_count(section);
+    let first_round = |section| bracket.section_round(section, 1).count() as u32;
+    let mut sections = Vec::new();
+    for section in SECTIONS {
+        if rounds(section) == 0 {
+            continue;
+        }
+        let (first_column, height_of) = match section {
+            BracketSection::GrandFinal => (
+                rounds(BracketSection::Winners).max(rounds(BracketSection::Losers)),
+                BracketSection::Winners,
+            ),
+            BracketSection::Plate => (0, BracketSection::Plate),
+            _ => (0, BracketSection::Winners),
+        };
+        let base = first_round(height_of).max(1);
+        let mut matches: Vec<&BracketMatch> = bracket
+            .matches
+            .iter()
+            .filter(|m| m.section == section)
+            .collect();
+        matches.sort_by_key(|m| (m.round, m.number));
+        let matches = matches
+            .into_iter()
+            .map(|m| {
+                let in_round = bracket.section_round(section, m.round).count().max(1) as u32;
+                MatchView {
+                    match_id: m.id,
+                    label: bracket_round_label(tournament, m),
+                    round_index: m.round - 1,
+                    number: m.number,
+                    column: first_column + m.round - 1,
+                    slot: (2 * m.number - 1) * base / in_round,
+                    player_1: m.team_1.map(|id| player(tournament, id)),
+                    player_2: m.team_2.map(|id| player(tournament, id)),
+                    winner: m.winner,
+                    score: m.score,
+                    bye: m.bye,
+                    sources: sources.remove(&m.id).unwrap_or_default(),
+                }
+            })
+            .collect();
+        sections.push(SectionView {
+            section,
+            first_column,
+            rounds: rounds(section),
+            slots: 2 * base,
+            matches,
+        });
+    }
+    Ok(BracketView {
+        tournament_id: tournament.id,
+        format: tournament.format,
+        sections,
+    })
+}
+
+fn player(t: &Tournament, id: PlayerId) -> PlayerView {
+    PlayerView {
+        player_id: id,
+        name: t
+            .find_player(id)
+            .map_or_else(|| id.to_string(), |p| p.name.clone()),
+    }
+}
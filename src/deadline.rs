@@ -0,0 +1,86 @@
+//! Request deadlines: how long an API request may run before it is answered with 503, and the
+//! check long-running work makes between chunks so it stops once nobody is waiting for it.
+//!
+//! A [`Deadline`] passes at a set time or as soon as it is cancelled; clones share the
+//! cancellation, so work handed to another thread sees it too. The server cancels a request's
+//! deadline when it stops waiting for it. Work that can't be interrupted (a file write, say)
+//! still runs to the end, but anything that checks in between chunks (the CSV export, the
+//! backup) gives up at the next one.
+
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::Arc;
+use std::time::{Duration, Instant};
+
+/// How long a request may take unless configured otherwise.
+pub const DEFAULT_REQUEST_TIMEOUT: Duration = Duration::from_secs(10);
+
+/// The deadline passed (or was cancelled) before the work was done.
+#[derive(Clone, Copy, Debug, Eq, PartialEq)]
+pub struct Expired;
+
+impl std::fmt::Display for Expired {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "The request took too long and was stopped")
+    }
+}
+
+impl std::error::Error for Expired {}
+
+/// When a piece of work must be done by; see the module docs.
+#[derive(Clone, Debug)]
+pub struct Deadline {
+    at: Option<Instant>,
+    cancelled: Arc<AtomicBool>,
+}
+
+impl Deadline {
+    /// Passes `timeout` from now.
+    pub fn after(timeout: Duration) -> Self {
+        Self {
+            at: Instant::now().checked_add(timeout),
+            cancelled: Arc::new(AtomicBool::new(false)),
+        }
+    }
+
+    /// Passes only when cancelled.
+    pub fn never() -> Self {
+        Self {
+            at: None,
+            cancelled: Arc::new(AtomicBool::new(false)),
+        }
+    }
+
+    /// Make the deadline pass now, for this and every clone of it.
+    pub fn cancel(&self) {
+        self.cancelled.store(true, Ordering::Relaxed);
+    }
+
+    /// Time left (zero once passed); None for a deadline that only passes when cancelled.
+    pub fn remaining(&self) -> Option<Duration> {
+        if self.cancelled.load(Ordering::Relaxed) {
+            return Some(Duration::ZERO);
+        }
+        self.at
+            .map(|at| at.saturating_duration_since(Instant::now()))
+    }
+
+    /// Err once the deadline has passed: the point to stop between chunks of work.
+    pub fn check(&self) -> Result<(), Expired> {
+        match self.remaining() {
+            Some(left) if left.is_zero() => Err(Expired),
+            _ => Ok(()),
+        }
+    }
+}
+
+/// Whether requests to `path` run under the request timeout: every `/api` route except the
+/// scoreboard long-poll, which waits longer on purpose, and the restore, whose upload can
+/// take a while.
+pub fn has_timeout(path: &str) -> bool {
+    let segments: Vec<&str> = path.trim_matches('/').split('/').collect();
+    match segments.as_slice() {
+        ["api", "tournaments", _, "display"] | ["api", "admin", "restore"] => false,
+        ["api", ..] => true,
+        _ => false,
+    }
+}
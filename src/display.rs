@@ -0,0 +1,162 @@
+//! The venue scoreboard: what is on each board right now, and what is up next.
+//!
+//! [`scoreboard`] projects a tournament into everything a display needs, names and scores
+//! included, so a display page only has to show it. [`etag`] fingerprints a projection; a
+//! display polling for changes sends back the last one it saw and is only sent a new board
+//! when it differs.
+
+use crate::export::bracket_round_label;
+use crate::models::{
+    BracketMatch, MatchId, PlayerId, Team, Tournament, TournamentId, TournamentState,
+};
+use crate::scoring::{checkout_route, Dart, MAX_CHECKOUT, START_SCORE};
+use serde::Serialize;
+use sha2::{Digest, Sha256};
+use std::collections::HashSet;
+
+/// Upcoming matches shown after the boards.
+pub const UPCOMING_MATCHES: usize = 2;
+
+/// A tournament as the scoreboard shows it.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct Scoreboard {
+    pub tournament_id: TournamentId,
+    pub tournament_name: String,
+    pub state: TournamentState,
+    /// Every board, in board order.
+    pub boards: Vec<BoardDisplay>,
+    /// The next [`UPCOMING_MATCHES`] ready matches not yet on a board, in the order boards
+    /// will take them.
+    pub upcoming: Vec<UpcomingMatch>,
+}
+
+/// One board and the match on it.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct BoardDisplay {
+    pub board: String,
+    /// None while the board is free.
+    pub current: Option<MatchDisplay>,
+}
+
+/// A match being played: both sides' scores and who throws next.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct MatchDisplay {
+    pub match_id: MatchId,
+    pub round_label: String,
+    pub player_1: SideDisplay,
+    pub player_2: SideDisplay,
+    /// Side throwing next (side one before the first visit).
+    pub throwing: Team,
+    /// Suggested finish for the side throwing, when they are on one (170 or less).
+    pub checkout: Option<Vec<Dart>>,
+}
+
+/// One side of a match on a board.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct SideDisplay {
+    pub name: String,
+    /// Score left in the current leg.
+    pub remaining: u32,
+    /// Legs won (in the current set, for matches played in sets).
+    pub legs: u32,
+    /// Sets won, for matches played in sets.
+    pub sets: Option<u32>,
+}
+
+/// A match waiting for a board.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct UpcomingMatch {
+    pub match_id: MatchId,
+    pub round_label: String,
+    pub player_1: String,
+    pub player_2: String,
+}
+
+/// The scoreboard for `tournament` as it stands.
+pub fn scoreboard(tournament: &Tournament) -> Scoreboard {
+    let bracket = tournament.bracket.as_ref();
+    let on_board = |id: Option<MatchId>| bracket.and_then(|b| b.get(id?));
+    let boards = tournament
+        .boards
+        .iter()
+        .map(|b| BoardDisplay {
+            board: b.name.clone(),
+            current: on_board(b.match_id).and_then(|m| match_display(tournament, m)),
+        })
+        .collect();
+    let assigned: HashSet<MatchId> = tournament
+        .boards
+        .iter()
+        .filter_map(|b| b.match_id)
+        .collect();
+    let upcoming = bracket
+        .into_iter()
+        .flat_map(|b| &b.matches)
+        .filter(|m| m.is_ready() && !m.bye && !assigned.contains(&m.id))
+        .filter_map(|m| {
+            Some(UpcomingMatch {
+                match_id: m.id,
+                round_label: bracket_round_label(tournament, m),
+                player_1: name(tournament, m.team_1?),
+                player_2: name(tournament, m.team_2?),
+            })
+        })
+        .take(UPCOMING_MATCHES)
+        .collect();
+    Scoreboard {
+        tournament_id: tournament.id,
+        tournament_name: tournament.name.clone(),
+        state: tournament.state,
+        boards,
+        upcoming,
+    }
+}
+
+/// Fingerprint of a scoreboard: the same for the same board, different once anything on it
+/// changes.
+pub fn etag(board: &Scoreboard) -> String {
+    let json = serde_json::to_vec(board).unwrap_or_default();
+    hex::encode(&Sha256::digest(&json)[..16])
+}
+
+fn match_display(t: &Tournament, m: &BracketMatch) -> Option<MatchDisplay> {
+    let (id_1, id_2) = (m.team_1?, m.team_2?);
+    let scored = t.scores.get(&m.id);
+    let leg = scored.map(|s| s.current_leg());
+    let side = |id: PlayerId, team: Team| SideDisplay {
+        name: name(t, id),
+        remaining: leg.map_or(START_SCORE, |l| l.remaining(team)),
+        legs: scored.map_or(0, |s| match team {
+            Team::One => s.legs_won.team_1,
+            Team::Two => s.legs_won.team_2,
+        }),
+        sets: scored.and_then(|s| {
+            s.best_of_sets.map(|_| match team {
+                Team::One => s.sets_won.team_1,
+                Team::Two => s.sets_won.team_2,
+            })
+        }),
+    };
+    let throwing = leg.map_or(Team::One, |l| l.thrower);
+    let player_1 = side(id_1, Team::One);
+    let player_2 = side(id_2, Team::Two);
+    let remaining = match throwing {
+        Team::One => player_1.remaining,
+        Team::Two => player_2.remaining,
+    };
+    Some(MatchDisplay {
+        match_id: m.id,
+        round_label: bracket_round_label(t, m),
+        player_1,
+        player_2,
+        throwing,
+        checkout: (remaining <= MAX_CHECKOUT)
+            .then(|| checkout_route(remaining, 3))
+            .flatten(),
+    })
+}
+
+fn name(t: &Tournament, id: PlayerId) -> String {
+    t.find_player(id)
+        .map_or_else(|| id.to_string(), |p| p.name.clone())
+}
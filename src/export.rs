@@ -0,0 +1,276 @@
+//! Spreadsheet exports: completed matches of a tournament and per-player totals, as CSV rows
+//! (or the same rows as JSON).
+
+use crate::deadline::Deadline;
+use crate::leaderboard::totals_by_name;
+use crate::models::{
+    BracketMatch, BracketSection, GameMatch, LegScore, MatchId, PlayerId, RoundType, Team,
+    Tournament, TournamentFormat,
+};
+use serde::Serialize;
+use std::io;
+
+/// A row type that can be written as one CSV record under a fixed header.
+pub trait CsvRow {
+    /// Column names, in the order `fields` returns values.
+    const HEADER: &'static [&'static str];
+
+    fn fields(&self) -> Vec<String>;
+}
+
+/// One completed match.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct MatchRow {
+    /// Round label, e.g. "Round 2", "Losers round 3", "Semi-final", "Final".
+    pub round: String,
+    /// Side one's name; both names joined with " & " in 2v2.
+    pub player_a: String,
+    pub player_b: String,
+    pub winner: String,
+    /// Legs won as "a-b", when the match was scored leg by leg.
+    pub legs: Option<String>,
+}
+
+impl CsvRow for MatchRow {
+    const HEADER: &'static [&'static str] = &["round", "player_a", "player_b", "winner", "legs"];
+
+    fn fields(&self) -> Vec<String> {
+        vec![
+            self.round.clone(),
+            self.player_a.clone(),
+            self.player_b.clone(),
+            self.winner.clone(),
+            self.legs.clone().unwrap_or_default(),
+        ]
+    }
+}
+
+/// One player's totals across the exported tournaments (same name, case-insensitive, is one
+/// player).
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct PlayerRow {
+    pub name: String,
+    pub total_wins: u32,
+    pub total_losses: u32,
+    pub total_sat_out: u32,
+    pub win_percentage: f64,
+    pub three_dart_average: f64,
+    pub checkouts: u32,
+    pub highest_checkout: u32,
+    pub count_180s: u32,
+}
+
+impl CsvRow for PlayerRow {
+    const HEADER: &'static [&'static str] = &[
+        "name",
+        "total_wins",
+        "total_losses",
+        "total_sat_out",
+        "win_percentage",
+        "three_dart_average",
+        "checkouts",
+        "highest_checkout",
+        "count_180s",
+    ];
+
+    fn fields(&self) -> Vec<String> {
+        vec![
+            self.name.clone(),
+            self.total_wins.to_string(),
+            self.total_losses.to_string(),
+            self.total_sat_out.to_string(),
+            format!("{:.2}", self.win_percentage),
+            format!("{:.2}", self.three_dart_average),
+            self.checkouts.to_string(),
+            self.highest_checkout.to_string(),
+            self.count_180s.to_string(),
+        ]
+    }
+}
+
+/// Encode one CSV record (with its line terminator). Fields containing commas, quotes or line
+/// breaks are quoted, with quotes doubled.
+pub fn csv_record<I, T>(fields: I) -> csv::Result<Vec<u8>>
+where
+    I: IntoIterator<Item = T>,
+    T: AsRef<[u8]>,
+{
+    let mut writer = csv::Writer::from_writer(Vec::new());
+    writer.write_record(fields)?;
+    writer
+        .into_inner()
+        .map_err(|e| csv::Error::from(e.into_error()))
+}
+
+/// The CSV document for `rows`, header first, one record at a time. A deadline that passes
+/// part way ends it with a `TimedOut` error rather than encoding records nobody will read.
+pub fn csv_lines<R: CsvRow>(
+    rows: Vec<R>,
+    deadline: Deadline,
+) -> impl Iterator<Item = io::Result<Vec<u8>>> {
+    let header = std::iter::once(csv_record(R::HEADER));
+    let mut records = header.chain(rows.into_iter().map(|r| csv_record(r.fields())));
+    let mut done = false;
+    std::iter::from_fn(move || {
+        if done {
+            return None;
+        }
+        if let Err(e) = deadline.check() {
+            done = true;
+            return Some(Err(io::Error::new(io::ErrorKind::TimedOut, e)));
+        }
+        records.next().map(|r| r.map_err(io::Error::other))
+    })
+}
+
+/// Every decided match of `tournament`, round by round: group matches of a finished group stage,
+/// bracket matches (byes and sit-outs left out), then the semi-finals and final of the
+/// group-play format.
+pub fn match_rows(tournament: &Tournament) -> Vec<MatchRow> {
+    let mut rows: Vec<MatchRow> = Vec::new();
+    let group_matches = tournament.group_stage.iter().map(|s| &s.matches);
+    for matches in group_matches.chain(tournament.bracket.iter().map(|b| &b.matches)) {
+        let mut played: Vec<&BracketMatch> = matches
+            .iter()
+            .filter(|m| m.winner.is_some() && !m.bye)
+            .collect();
+        played.sort_by_key(|m| (section_order(m.section), m.round, m.number));
+        for m in played {
+            let (Some(a), Some(b), Some(winner)) = (m.team_1, m.team_2, m.winner) else {
+                continue;
+            };
+            let legs = m.score.or_else(|| scored_legs(tournament, m.id));
+            rows.push(row(
+                tournament,
+                bracket_round_label(tournament, m),
+                &[a],
+                &[b],
+                winner,
+                legs,
+            ));
+        }
+    }
+
+    let semis = tournament
+        .bracket_semi_final_matches
+        .iter()
+        .flatten()
+        .filter_map(|m| {
+            let results = tournament.bracket_semi_final_results.as_ref()?;
+            Some((m, *results.get(&m.id)?))
+        });
+    let finals = tournament
+        .bracket_finals_match
+        .iter()
+        .zip(tournament.bracket_finals_result);
+    for (m, winner) in semis.chain(finals) {
+        rows.push(game_row(tournament, m, winner));
+    }
+    rows
+}
+
+/// One row per player across `tournaments`, ordered by name (case-insensitive). Deleted
+/// players are left out.
+pub fn player_rows<'a>(tournaments: impl IntoIterator<Item = &'a Tournament>) -> Vec<PlayerRow> {
+    let mut rows: Vec<PlayerRow> = totals_by_name(tournaments)
+        .into_iter()
+        .filter(|t| !t.deleted)
+        .map(|t| PlayerRow {
+            total_wins: t.wins,
+            total_losses: t.losses,
+            total_sat_out: t.times_sat_out,
+            win_percentage: t.win_percentage(),
+            three_dart_average: t.average(),
+            checkouts: t.checkouts,
+            highest_checkout: t.highest_checkout,
+            count_180s: t.count_180s,
+            name: t.name,
+        })
+        .collect();
+    rows.sort_by_key(|r| r.name.to_lowercase());
+    rows
+}
+
+fn game_row(tournament: &Tournament, m: &GameMatch, winner: Team) -> MatchRow {
+    let label = match m.round {
+        RoundType::GroupPlay => "Group play",
+        RoundType::SemiFinals => "Semi-final",
+        RoundType::Finals => "Final",
+    };
+    row(
+        tournament,
+        label.to_string(),
+        &m.team_1,
+        &m.team_2,
+        winner,
+        scored_legs(tournament, m.id),
+    )
+}
+
+fn row(
+    tournament: &Tournament,
+    round: String,
+    team_1: &[PlayerId],
+    team_2: &[PlayerId],
+    winner: Team,
+    legs: Option<LegScore>,
+) -> MatchRow {
+    let player_a = side_name(tournament, team_1);
+    let player_b = side_name(tournament, team_2);
+    MatchRow {
+        round,
+        winner: match winner {
+            Team::One => player_a.clone(),
+            Team::Two => player_b.clone(),
+        },
+        player_a,
+        player_b,
+        legs: legs.map(|l| format!("{}-{}", l.team_1, l.team_2)),
+    }
+}
+
+/// Names of a side joined with " & "; a player no longer in the tournament shows as their id.
+fn side_name(tournament: &Tournament, ids: &[PlayerId]) -> String {
+    let names: Vec<String> = ids
+        .iter()
+        .map(|&id| match tournament.find_player(id) {
+            Some(p) => p.name.clone(),
+            None => id.to_string(),
+        })
+        .collect();
+    names.join(" & ")
+}
+
+pub(crate) fn scored_legs(tournament: &Tournament, match_id: MatchId) -> Option<LegScore> {
+    tournament.scores.get(&match_id).map(|s| s.legs_won)
+}
+
+fn section_order(section: BracketSection) -> u8 {
+    match section {
+        BracketSection::Winners => 0,
+        BracketSection::Losers => 1,
+        BracketSection::GrandFinal => 2,
+        BracketSection::Plate => 3,
+    }
+}
+
+pub(crate) fn bracket_round_label(tournament: &Tournament, m: &BracketMatch) -> String {
+    let group = tournament
+        .group_stage
+        .as_ref()
+        .filter(|s| !s.knockout_started || s.matches.iter().any(|g| g.id == m.id));
+    if let Some(group) = group.and_then(|s| s.group_of(m.team_1?)) {
+        return format!("Group {} round {}", group.name, m.round);
+    }
+    match (tournament.format, m.section) {
+        (TournamentFormat::DoubleElimination, BracketSection::Winners) => {
+            format!("Winners round {}", m.round)
+        }
+        (_, BracketSection::Losers) => format!("Losers round {}", m.round),
+        (_, BracketSection::GrandFinal) if m.round == 1 => "Grand final".to_string(),
+        (_, BracketSection::GrandFinal) => "Grand final reset".to_string(),
+        (_, BracketSection::Plate) if m.winner_to.is_none() => "Plate final".to_string(),
+        (_, BracketSection::Plate) => format!("Plate round {}", m.round),
+        _ => format!("Round {}", m.round),
+    }
+}
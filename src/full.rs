@@ -0,0 +1,234 @@
+//! The full tournament read: everything a tournament page shows, projected from one copy of
+//! the tournament so no part can be ahead of another (a winner shown but not yet in the next
+//! round).
+//!
+//! [`FullResponse::new`] borrows the tournament it projects; read it once (e.g. with
+//! [`crate::TournamentRegistry::get`]) and build the response from that copy. The player and
+//! standings rows here are the ones the other reads of the API return too.
+
+use crate::archive::EventStats;
+use crate::logic::{group_standings, round_robin_standings, GroupStanding};
+use crate::models::{
+    Board, Bracket, EntryType, GameMatch, GroupStage, MatchAction, MatchFormats, MatchId,
+    Placement, Player, PlayerId, PlayerStats, Team, Tournament, TournamentFormat, TournamentId,
+    TournamentMode, TournamentState,
+};
+use crate::scoring::{CricketMatch, X01Match};
+use crate::validation::Section;
+use chrono::{DateTime, Utc};
+use serde::Serialize;
+use std::collections::HashMap;
+
+/// A player with derived stats (three-dart average, checkout percentage) alongside the raw totals.
+#[derive(Serialize)]
+pub struct PlayerResponse<'a> {
+    #[serde(flatten)]
+    pub player: &'a Player,
+    pub stats: PlayerStats,
+}
+
+impl<'a> From<&'a Player> for PlayerResponse<'a> {
+    fn from(player: &'a Player) -> Self {
+        Self {
+            player,
+            stats: player.stats(),
+        }
+    }
+}
+
+/// A tournament's player with their numbers for that event (legs included).
+#[derive(Serialize)]
+pub struct EventPlayerResponse<'a> {
+    #[serde(flatten)]
+    pub player: PlayerResponse<'a>,
+    pub event: EventStats,
+}
+
+impl<'a> EventPlayerResponse<'a> {
+    pub fn new(tournament: &Tournament, player: &'a Player) -> Self {
+        Self {
+            player: PlayerResponse::from(player),
+            event: EventStats::of(tournament, player),
+        }
+    }
+}
+
+#[derive(Serialize)]
+pub struct StandingResponse<'a> {
+    pub rank: usize,
+    pub player_id: PlayerId,
+    pub name: &'a str,
+    pub played: u32,
+    pub wins: u32,
+    pub losses: u32,
+    pub legs_for: u32,
+    pub legs_against: u32,
+    pub leg_difference: i64,
+}
+
+#[derive(Serialize)]
+pub struct GroupResponse<'a> {
+    pub name: &'a str,
+    pub standings: Vec<StandingResponse<'a>>,
+}
+
+/// Ranked rows for `standings`, best first, with the players' names from `t`.
+pub fn standing_rows<'a>(
+    t: &'a Tournament,
+    standings: &[GroupStanding],
+) -> Vec<StandingResponse<'a>> {
+    standings
+        .iter()
+        .enumerate()
+        .map(|(i, s)| StandingResponse {
+            rank: i + 1,
+            player_id: s.player,
+            name: t.find_player(s.player).map_or("", |p| p.name.as_str()),
+            played: s.played,
+            wins: s.wins,
+            losses: s.losses,
+            legs_for: s.legs_for,
+            legs_against: s.legs_against,
+            leg_difference: s.leg_difference(),
+        })
+        .collect()
+}
+
+/// The tournament in a full read: its settings and how far it has got.
+#[derive(Serialize)]
+pub struct TournamentInfo<'a> {
+    pub id: TournamentId,
+    pub name: &'a str,
+    pub created_at: DateTime<Utc>,
+    pub format: TournamentFormat,
+    pub mode: TournamentMode,
+    pub entry_type: EntryType,
+    pub state: TournamentState,
+    pub max_losses: u32,
+    pub swiss_rounds: u32,
+    pub plate: bool,
+    pub walkover_counts_as_win: bool,
+    pub match_formats: &'a MatchFormats,
+    pub placements: &'a [Placement],
+    pub finished_at: Option<DateTime<Utc>>,
+}
+
+/// Every match of the tournament, whichever stage it belongs to, with its result and version.
+#[derive(Serialize)]
+pub struct FullMatches<'a> {
+    pub bracket: Option<&'a Bracket>,
+    pub group_stage: Option<&'a GroupStage>,
+    /// Group play: the current round, and the winners selected for it.
+    pub round: &'a [GameMatch],
+    pub round_results: &'a HashMap<MatchId, Team>,
+    pub semi_finals: Option<&'a Vec<GameMatch>>,
+    pub semi_final_results: Option<&'a HashMap<MatchId, Team>>,
+    pub final_round_results: &'a HashMap<MatchId, Team>,
+    pub finals: Option<&'a GameMatch>,
+    pub finals_result: Option<Team>,
+    pub match_versions: &'a HashMap<MatchId, u64>,
+}
+
+/// The tables for formats that have them: one for round robin, one per group for groups.
+#[derive(Serialize)]
+pub struct FullStandings<'a> {
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub table: Option<Vec<StandingResponse<'a>>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub groups: Option<Vec<GroupResponse<'a>>>,
+}
+
+/// Every scored visit and the change log of each match.
+#[derive(Serialize)]
+pub struct FullVisits<'a> {
+    pub x01: &'a HashMap<MatchId, X01Match>,
+    pub cricket: &'a HashMap<MatchId, CricketMatch>,
+    pub match_log: &'a HashMap<MatchId, Vec<MatchAction>>,
+}
+
+/// `GET /api/tournaments/{id}/full`: the sections asked for, all from the same copy of the
+/// tournament. Sections left out of `?include=` are left out of the body.
+#[derive(Serialize)]
+pub struct FullResponse<'a> {
+    /// The tournament's version, as in its ETag.
+    pub state_version: u64,
+    pub tournament: TournamentInfo<'a>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub players: Option<Vec<EventPlayerResponse<'a>>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub matches: Option<FullMatches<'a>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub standings: Option<FullStandings<'a>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub boards: Option<&'a [Board]>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub visits: Option<FullVisits<'a>>,
+}
+
+impl<'a> FullResponse<'a> {
+    /// `t` with the `sections` asked for.
+    pub fn new(t: &'a Tournament, sections: &[Section]) -> Self {
+        let wanted = |section| sections.contains(&section);
+        let players = wanted(Section::Players).then(|| {
+            t.all_players()
+                .into_iter()
+                .map(|p| EventPlayerResponse::new(t, p))
+                .collect()
+        });
+        let matches = wanted(Section::Matches).then(|| FullMatches {
+            bracket: t.bracket.as_ref(),
+            group_stage: t.group_stage.as_ref(),
+            round: &t.matches,
+            round_results: &t.match_results,
+            semi_finals: t.bracket_semi_final_matches.as_ref(),
+            semi_final_results: t.bracket_semi_final_results.as_ref(),
+            final_round_results: &t.final_match_results,
+            finals: t.bracket_finals_match.as_ref(),
+            finals_result: t.bracket_finals_result,
+            match_versions: &t.match_versions,
+        });
+        let standings = wanted(Section::Standings).then(|| FullStandings {
+            table: round_robin_standings(t)
+                .ok()
+                .map(|standings| standing_rows(t, &standings)),
+            groups: group_standings(t).ok().map(|groups| {
+                groups
+                    .into_iter()
+                    .map(|(g, standings)| GroupResponse {
+                        name: &g.name,
+                        standings: standing_rows(t, &standings),
+                    })
+                    .collect()
+            }),
+        });
+        let visits = wanted(Section::Visits).then_some(FullVisits {
+            x01: &t.scores,
+            cricket: &t.cricket,
+            match_log: &t.match_log,
+        });
+        Self {
+            state_version: t.version,
+            tournament: TournamentInfo {
+                id: t.id,
+                name: &t.name,
+                created_at: t.created_at,
+                format: t.format,
+                mode: t.mode,
+                entry_type: t.entry_type,
+                state: t.state,
+                max_losses: t.max_losses,
+                swiss_rounds: t.swiss_rounds,
+                plate: t.plate,
+                walkover_counts_as_win: t.walkover_counts_as_win,
+                match_formats: &t.match_formats,
+                placements: &t.placements,
+                finished_at: t.finished_at,
+            },
+            players,
+            matches,
+            standings,
+            boards: wanted(Section::Boards).then_some(t.boards.as_slice()),
+            visits,
+        }
+    }
+}
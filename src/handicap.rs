@@ -0,0 +1,129 @@
+//! Handicaps for mixed-ability nights: a weaker player starts legs lower, or a match with legs
+//! already won (see [`Handicap`]).
+//!
+//! A scored match takes its players' handicaps when its first visit is recorded and keeps them
+//! for good. A match played with a handicap is flagged: its visits add nothing to the players'
+//! averages and other scoring stats, and its result moves no rating. Results recorded without
+//! scoring count as handicapped when either player has a handicap at the time.
+
+use crate::history::bracket_matches;
+use crate::models::{Handicap, MatchId, Player, PlayerId, Team, Tournament, MAX_HANDICAP_POINTS};
+use crate::scoring::START_SCORE;
+use serde::Serialize;
+
+/// Handicaps are suggested in steps of this many points.
+pub const HANDICAP_STEP: u32 = 10;
+
+/// A handicap [`auto_handicap`] proposes for one player.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct HandicapSuggestion {
+    pub player_id: PlayerId,
+    pub player: String,
+    /// None for a player with no darts thrown yet, who is suggested no handicap.
+    pub three_dart_average: Option<f64>,
+    pub handicap: Handicap,
+}
+
+/// Propose start-score handicaps from three-dart averages, so everyone needs about as many
+/// darts for a leg as the best player does for a full 501.
+///
+/// Against the highest average `best`, a player averaging `a` gets
+/// `501 × (1 − a / best)` points off, rounded down to a multiple of [`HANDICAP_STEP`] and at
+/// most [`MAX_HANDICAP_POINTS`]. Starting on `501 × a / best`, they take `501 / best` visits a
+/// leg at their own average, just as the best player does. No legs of head start are proposed.
+pub fn auto_handicap(players: &[Player]) -> Vec<HandicapSuggestion> {
+    let average = |p: &Player| (p.darts_thrown > 0).then(|| p.three_dart_average());
+    let best = players.iter().filter_map(average).fold(0.0_f64, f64::max);
+    players
+        .iter()
+        .map(|p| {
+            let three_dart_average = average(p);
+            let points = match three_dart_average {
+                Some(a) if best > 0.0 => {
+                    let off = (f64::from(START_SCORE) * (1.0 - a / best)).floor() as u32;
+                    (off / HANDICAP_STEP * HANDICAP_STEP).min(MAX_HANDICAP_POINTS)
+                }
+                _ => 0,
+            };
+            HandicapSuggestion {
+                player_id: p.id,
+                player: p.name.clone(),
+                three_dart_average,
+                handicap: Handicap { points, legs: 0 },
+            }
+        })
+        .collect()
+}
+
+/// [`auto_handicap`] for `tournament`'s players, from their averages over every one of
+/// `tournaments` they played in (matched by name) rather than this one alone.
+pub fn suggest_handicaps(
+    tournament: &Tournament,
+    tournaments: &[Tournament],
+) -> Vec<HandicapSuggestion> {
+    let players: Vec<Player> = tournament
+        .all_players()
+        .into_iter()
+        .map(|p| {
+            let mut career = p.clone();
+            (career.points_scored, career.darts_thrown) = tournaments
+                .iter()
+                .flat_map(|t| t.all_players())
+                .filter(|other| other.name.eq_ignore_ascii_case(&p.name))
+                .fold((0, 0), |(points, darts), other| {
+                    (points + other.points_scored, darts + other.darts_thrown)
+                });
+            career
+        })
+        .collect();
+    auto_handicap(&players)
+}
+
+/// Give every copy of the player called `name` (case-insensitive) `handicap`. A finished
+/// tournament is left as it was. Returns whether anything changed.
+pub fn set_handicap(tournament: &mut Tournament, name: &str, handicap: Handicap) -> bool {
+    if tournament.finished_at.is_some() {
+        return false;
+    }
+    let name = name.trim();
+    let mut changed = false;
+    for p in tournament
+        .player_copies_mut()
+        .filter(|p| p.name.eq_ignore_ascii_case(name))
+    {
+        changed |= p.handicap != handicap;
+        p.handicap = handicap;
+    }
+    changed
+}
+
+/// The handicap of each side of a match, as its players have them now (none for a side of
+/// more than one player).
+pub(crate) fn match_handicaps(tournament: &Tournament, match_id: MatchId) -> [Handicap; 2] {
+    let bracket = bracket_matches(tournament).find(|m| m.id == match_id);
+    let game = tournament.matches.iter().find(|m| m.id == match_id);
+    [Team::One, Team::Two].map(|team| {
+        let player = match (bracket, game) {
+            (Some(m), _) => m.player(team),
+            (None, Some(m)) => match m.team(team) {
+                [id] => Some(*id),
+                _ => None,
+            },
+            (None, None) => None,
+        };
+        player
+            .and_then(|id| tournament.find_player(id))
+            .map_or_else(Handicap::default, |p| p.handicap)
+    })
+}
+
+/// Whether a match is played with a handicap: a scored match if it started with one, else if
+/// either side has one now.
+pub fn played_with_handicap(tournament: &Tournament, match_id: MatchId) -> bool {
+    match tournament.scores.get(&match_id) {
+        Some(scored) => scored.is_handicapped(),
+        None => match_handicaps(tournament, match_id)
+            .iter()
+            .any(|h| !h.is_none()),
+    }
+}
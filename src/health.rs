@@ -0,0 +1,74 @@
+//! Liveness and readiness reports for container and orchestrator health checks.
+//!
+//! Liveness only says the process is serving requests. Readiness also covers persistence: the
+//! data directory (if configured) must take writes, and the store and snapshot must have loaded
+//! at startup. A failed load doesn't stop the server; it serves from memory and reports not
+//! ready instead, so the failure shows up in the probe rather than as a crash loop.
+
+use serde::Serialize;
+use std::collections::BTreeMap;
+use std::io;
+
+/// Result of one check.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum CheckStatus {
+    Ok,
+    Error,
+    /// Not configured (e.g. no data directory); never fails the report.
+    Disabled,
+}
+
+/// `{"status": "ok", "checks": {"store": "ok", "snapshot": "disabled"}}`; status is "error"
+/// when any check failed.
+#[derive(Clone, Debug, Eq, PartialEq, Serialize)]
+pub struct HealthReport {
+    pub status: CheckStatus,
+    pub checks: BTreeMap<&'static str, CheckStatus>,
+}
+
+impl HealthReport {
+    /// Liveness: no checks, always ok.
+    pub fn live() -> Self {
+        Self::from_checks([])
+    }
+
+    pub fn from_checks(checks: impl IntoIterator<Item = (&'static str, CheckStatus)>) -> Self {
+        let checks: BTreeMap<_, _> = checks.into_iter().collect();
+        let status = if checks.values().any(|c| *c == CheckStatus::Error) {
+            CheckStatus::Error
+        } else {
+            CheckStatus::Ok
+        };
+        HealthReport { status, checks }
+    }
+
+    pub fn is_ok(&self) -> bool {
+        self.status == CheckStatus::Ok
+    }
+}
+
+/// What loaded when the server started.
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq)]
+pub struct Startup {
+    /// The data directory was configured but couldn't be opened or read.
+    pub store_failed: bool,
+    /// Whether the snapshot file loaded; None without a snapshot path.
+    pub snapshot_loaded: Option<bool>,
+}
+
+/// Readiness from the startup state and a store check just made (None: memory-only registry).
+pub fn readiness(store_check: Option<&io::Result<()>>, startup: &Startup) -> HealthReport {
+    let store = match store_check {
+        _ if startup.store_failed => CheckStatus::Error,
+        None => CheckStatus::Disabled,
+        Some(Ok(())) => CheckStatus::Ok,
+        Some(Err(_)) => CheckStatus::Error,
+    };
+    let snapshot = match startup.snapshot_loaded {
+        None => CheckStatus::Disabled,
+        Some(true) => CheckStatus::Ok,
+        Some(false) => CheckStatus::Error,
+    };
+    HealthReport::from_checks([("store", store), ("snapshot", snapshot)])
+}
@@ -0,0 +1,252 @@
+//! Match history across tournaments, and the head-to-head record of two players.
+//!
+//! History covers bracket and group matches (every format but group play, whose rounds are
+//! replaced as they are played). Like a player's record, it is read from the tournaments that
+//! exist each time it is asked for, and players are matched by name (case-insensitive) from
+//! one tournament to the next.
+
+use crate::export::{bracket_round_label, scored_legs};
+use crate::handicap::played_with_handicap;
+use crate::models::{
+    BracketMatch, BracketSection, LegScore, MatchId, PlayerId, ResultType, Tournament, TournamentId,
+};
+use chrono::{DateTime, NaiveDate, Utc};
+use serde::{Deserialize, Serialize};
+use std::cmp::Reverse;
+
+/// Matches one page returns unless the query says otherwise.
+pub const DEFAULT_MATCH_LIMIT: usize = 50;
+
+/// Most matches one page returns.
+pub const MAX_MATCH_LIMIT: usize = 200;
+
+/// Which matches to list; fields left out match everything.
+#[derive(Clone, Debug, Default, Deserialize)]
+pub struct MatchQuery {
+    pub tournament_id: Option<TournamentId>,
+    /// Someone of this name (case-insensitive) on either side.
+    pub player: Option<String>,
+    pub round: Option<u32>,
+    /// Only matches with a result (true) or without one (false).
+    pub completed: Option<bool>,
+    /// Played on or after this day (UTC): the day of the result, or for a match still to be
+    /// decided, the day its tournament was created.
+    pub from: Option<NaiveDate>,
+    /// Played on or before this day (UTC).
+    pub to: Option<NaiveDate>,
+    /// Page size, [`DEFAULT_MATCH_LIMIT`] by default and at most [`MAX_MATCH_LIMIT`].
+    pub limit: Option<usize>,
+    pub offset: Option<usize>,
+}
+
+/// One match in the history.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct MatchSummary {
+    pub match_id: MatchId,
+    pub tournament_id: TournamentId,
+    pub tournament_name: String,
+    pub round: u32,
+    /// Round label, e.g. "Round 2", "Losers round 3", "Plate final".
+    pub round_label: String,
+    /// Part of the bracket: "winners" (the main draw), "losers", "grand_final" or "plate".
+    pub bracket: BracketSection,
+    pub player_1: String,
+    pub player_2: String,
+    /// None until decided.
+    pub winner: Option<String>,
+    /// Legs won by each side (sets, for matches played in sets), if known.
+    pub score: Option<LegScore>,
+    pub result_type: ResultType,
+    pub board: Option<String>,
+    pub started_at: Option<DateTime<Utc>>,
+    pub completed_at: Option<DateTime<Utc>>,
+    /// Start to result, for matches started and played.
+    pub duration_secs: Option<i64>,
+    /// Played with a handicap (not rated; see [`crate::handicap`]).
+    pub handicapped: bool,
+}
+
+/// One page of matches.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct MatchPage {
+    /// Matches matching the query, on every page.
+    pub total: usize,
+    pub offset: usize,
+    pub limit: usize,
+    pub matches: Vec<MatchSummary>,
+}
+
+/// The page of matches over `tournaments` that `query` asks for. Matches still to be decided
+/// come first, then the rest newest result first; ties are broken by match id, so pages don't
+/// shift between requests. Byes, sit-outs and matches still waiting for a player are left out.
+pub fn match_history<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    query: &MatchQuery,
+) -> MatchPage {
+    let player = query.player.as_deref().map(str::trim);
+    let mut found: Vec<MatchSummary> = tournaments
+        .into_iter()
+        .filter(|t| query.tournament_id.is_none_or(|id| id == t.id))
+        .flat_map(|t| {
+            bracket_matches(t).filter_map(move |m| {
+                let summary = summary(t, m)?;
+                let day = summary.completed_at.unwrap_or(t.created_at).date_naive();
+                let on_side = |name: &str| {
+                    summary.player_1.eq_ignore_ascii_case(name)
+                        || summary.player_2.eq_ignore_ascii_case(name)
+                };
+                let keep = query.round.is_none_or(|r| r == m.round)
+                    && query.completed.is_none_or(|c| c == m.winner.is_some())
+                    && query.from.is_none_or(|from| day >= from)
+                    && query.to.is_none_or(|to| day <= to)
+                    && player.is_none_or(on_side);
+                keep.then_some(summary)
+            })
+        })
+        .collect();
+    sort_newest_first(&mut found);
+    let total = found.len();
+    let limit = query
+        .limit
+        .unwrap_or(DEFAULT_MATCH_LIMIT)
+        .min(MAX_MATCH_LIMIT);
+    let offset = query.offset.unwrap_or(0);
+    MatchPage {
+        total,
+        offset,
+        limit,
+        matches: found.into_iter().skip(offset).take(limit).collect(),
+    }
+}
+
+/// Two players' record against each other, over every tournament both entered. Only results
+/// played over the board count; walkovers and void results are listed but not counted.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct HeadToHead {
+    /// The spellings used in the newest meeting (or as asked, if they never met).
+    pub player: String,
+    pub opponent: String,
+    pub played: u32,
+    pub player_wins: u32,
+    pub opponent_wins: u32,
+    pub player_legs: u32,
+    pub opponent_legs: u32,
+    /// Every decided match between them, newest first.
+    pub meetings: Vec<MatchSummary>,
+}
+
+/// Head-to-head of the players named `player` and `opponent` (case-insensitive).
+pub fn head_to_head<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    player: &str,
+    opponent: &str,
+) -> HeadToHead {
+    let (player, opponent) = (player.trim(), opponent.trim());
+    let mut meetings: Vec<MatchSummary> = tournaments
+        .into_iter()
+        .flat_map(|t| bracket_matches(t).filter_map(move |m| summary(t, m)))
+        .filter(|s| s.winner.is_some())
+        .filter(|s| {
+            let (a, b) = (&s.player_1, &s.player_2);
+            (a.eq_ignore_ascii_case(player) && b.eq_ignore_ascii_case(opponent))
+                || (a.eq_ignore_ascii_case(opponent) && b.eq_ignore_ascii_case(player))
+        })
+        .collect();
+    sort_newest_first(&mut meetings);
+
+    let mut record = HeadToHead {
+        player: player.to_string(),
+        opponent: opponent.to_string(),
+        played: 0,
+        player_wins: 0,
+        opponent_wins: 0,
+        player_legs: 0,
+        opponent_legs: 0,
+        meetings: Vec::new(),
+    };
+    if let Some(newest) = meetings.first() {
+        let player_first = newest.player_1.eq_ignore_ascii_case(player);
+        let (p, o) = (&newest.player_1, &newest.player_2);
+        (record.player, record.opponent) = if player_first {
+            (p.clone(), o.clone())
+        } else {
+            (o.clone(), p.clone())
+        };
+    }
+    for m in meetings
+        .iter()
+        .filter(|m| m.result_type == ResultType::Played)
+    {
+        let player_first = m.player_1.eq_ignore_ascii_case(player);
+        record.played += 1;
+        if m.winner
+            .as_deref()
+            .is_some_and(|w| w.eq_ignore_ascii_case(player))
+        {
+            record.player_wins += 1;
+        } else {
+            record.opponent_wins += 1;
+        }
+        if let Some(score) = m.score {
+            let (mine, theirs) = if player_first {
+                (score.team_1, score.team_2)
+            } else {
+                (score.team_2, score.team_1)
+            };
+            record.player_legs += mine;
+            record.opponent_legs += theirs;
+        }
+    }
+    record.meetings = meetings;
+    record
+}
+
+/// Bracket matches, then group matches of a finished group stage (once the knockout is
+/// drawn the group matches are no longer in the bracket).
+pub(crate) fn bracket_matches(t: &Tournament) -> impl Iterator<Item = &BracketMatch> {
+    let groups = t.group_stage.iter().flat_map(|s| &s.matches);
+    let bracket = t.bracket.iter().flat_map(|b| &b.matches);
+    let mut seen = std::collections::HashSet::new();
+    groups.chain(bracket).filter(move |m| seen.insert(m.id))
+}
+
+/// History entry for a match with both players known; None for byes and open slots.
+fn summary(t: &Tournament, m: &BracketMatch) -> Option<MatchSummary> {
+    if m.bye {
+        return None;
+    }
+    let name = |id: PlayerId| {
+        t.find_player(id)
+            .map_or_else(|| id.to_string(), |p| p.name.clone())
+    };
+    let (player_1, player_2) = (name(m.team_1?), name(m.team_2?));
+    Some(MatchSummary {
+        match_id: m.id,
+        tournament_id: t.id,
+        tournament_name: t.name.clone(),
+        round: m.round,
+        round_label: bracket_round_label(t, m),
+        bracket: m.section,
+        winner: m.winner_id().map(name),
+        score: m.score.or_else(|| scored_legs(t, m.id)),
+        result_type: m.result_type,
+        board: m.board.clone(),
+        started_at: m.started_at,
+        completed_at: m.completed_at,
+        duration_secs: m.duration().map(|d| d.num_seconds()),
+        handicapped: played_with_handicap(t, m.id),
+        player_1,
+        player_2,
+    })
+}
+
+/// Undecided first, then newest result first, then by match id.
+fn sort_newest_first(matches: &mut [MatchSummary]) {
+    matches.sort_by_key(|m| {
+        (
+            m.completed_at.is_some(),
+            Reverse(m.completed_at),
+            m.match_id,
+        )
+    });
+}
@@ -0,0 +1,312 @@
+//! Idempotency keys, so a scorer's retried POST doesn't count a win or a visit twice.
+//!
+//! A client sends a key of its own with a request. The first request with a key is carried
+//! out and its response stored under the key; a retry with the same key and the same request
+//! gets that response back without the change being made again, and a retry with a different
+//! request is refused. While the first is still running, the key is held in memory so a
+//! retry racing it can't slip through: it waits for the stored response instead.
+//!
+//! Responses are kept in an [`IdempotencyStore`] for a while ([`DEFAULT_IDEMPOTENCY_TTL`]):
+//! in memory, or as files beside the tournaments when they are kept on disk, so a retry after
+//! a restart is still recognised.
+
+use chrono::{DateTime, Duration, Utc};
+use serde::{Deserialize, Serialize};
+use sha2::{Digest, Sha256};
+use std::collections::{HashMap, HashSet};
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+
+/// Header a client sends its key in.
+pub const IDEMPOTENCY_KEY_HEADER: &str = "idempotency-key";
+
+/// Longest key accepted.
+pub const MAX_IDEMPOTENCY_KEY_LEN: usize = 255;
+
+/// How long a stored response is replayed for, unless configured otherwise.
+pub const DEFAULT_IDEMPOTENCY_TTL: Duration = Duration::hours(24);
+
+/// A response as stored for replay.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct StoredResponse {
+    pub status: u16,
+    pub content_type: Option<String>,
+    pub body: Vec<u8>,
+}
+
+/// What a key was first used for, and the response it got.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct IdempotencyRecord {
+    /// [`fingerprint`] of the request.
+    pub fingerprint: String,
+    pub response: StoredResponse,
+    pub expires_at: DateTime<Utc>,
+}
+
+/// Why a request with a key can't go ahead.
+#[derive(Clone, Debug, PartialEq)]
+pub enum IdempotencyError {
+    /// Empty, longer than [`MAX_IDEMPOTENCY_KEY_LEN`], or not printable ASCII.
+    InvalidKey,
+    /// The key was used for a different request.
+    KeyReused,
+    /// A request with the key is still being carried out.
+    InProgress,
+    /// The stored responses could not be read or written.
+    Storage(String),
+}
+
+impl std::fmt::Display for IdempotencyError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            IdempotencyError::InvalidKey => write!(
+                f,
+                "Idempotency-Key must be 1 to {} printable characters",
+                MAX_IDEMPOTENCY_KEY_LEN
+            ),
+            IdempotencyError::KeyReused => {
+                write!(
+                    f,
+                    "Idempotency-Key was already used for a different request"
+                )
+            }
+            IdempotencyError::InProgress => {
+                write!(
+                    f,
+                    "A request with this Idempotency-Key is still in progress"
+                )
+            }
+            IdempotencyError::Storage(e) => write!(f, "Idempotency store failed: {}", e),
+        }
+    }
+}
+
+impl From<io::Error> for IdempotencyError {
+    fn from(e: io::Error) -> Self {
+        IdempotencyError::Storage(e.to_string())
+    }
+}
+
+/// Whether `key` is usable: 1 to [`MAX_IDEMPOTENCY_KEY_LEN`] printable ASCII characters.
+pub fn valid_key(key: &str) -> bool {
+    (1..=MAX_IDEMPOTENCY_KEY_LEN).contains(&key.len()) && key.bytes().all(|b| b.is_ascii_graphic())
+}
+
+/// Fingerprint of a request: the same for the same method, path with query string
+/// (`?overwrite=true` changes what a result does) and body.
+pub fn fingerprint(method: &str, path_and_query: &str, body: &[u8]) -> String {
+    let mut hash = Sha256::new();
+    for part in [method.as_bytes(), path_and_query.as_bytes(), body] {
+        hash.update((part.len() as u64).to_be_bytes());
+        hash.update(part);
+    }
+    hex::encode(hash.finalize())
+}
+
+/// Where responses are kept for replay.
+pub trait IdempotencyStore: Send + Sync {
+    /// The record stored under `key`, expired or not.
+    fn get(&self, key: &str) -> io::Result<Option<IdempotencyRecord>>;
+    /// Store `record` under `key`, replacing any.
+    fn put(&self, key: &str, record: &IdempotencyRecord) -> io::Result<()>;
+    /// Drop every record expired at `now`. Returns how many were dropped.
+    fn remove_expired(&self, now: DateTime<Utc>) -> io::Result<usize>;
+}
+
+/// Records in memory only (lost on restart).
+#[derive(Default)]
+pub struct MemoryIdempotencyStore {
+    records: Mutex<HashMap<String, IdempotencyRecord>>,
+}
+
+impl MemoryIdempotencyStore {
+    pub fn new() -> Self {
+        Self::default()
+    }
+}
+
+impl IdempotencyStore for MemoryIdempotencyStore {
+    fn get(&self, key: &str) -> io::Result<Option<IdempotencyRecord>> {
+        let records = self.records.lock().unwrap_or_else(|e| e.into_inner());
+        Ok(records.get(key).cloned())
+    }
+
+    fn put(&self, key: &str, record: &IdempotencyRecord) -> io::Result<()> {
+        let mut records = self.records.lock().unwrap_or_else(|e| e.into_inner());
+        records.insert(key.to_string(), record.clone());
+        Ok(())
+    }
+
+    fn remove_expired(&self, now: DateTime<Utc>) -> io::Result<usize> {
+        let mut records = self.records.lock().unwrap_or_else(|e| e.into_inner());
+        let before = records.len();
+        records.retain(|_, r| r.expires_at > now);
+        Ok(before - records.len())
+    }
+}
+
+/// One JSON file per key in a directory, named by a hash of the key (keys are the client's
+/// and needn't make safe file names).
+pub struct FileIdempotencyStore {
+    dir: PathBuf,
+}
+
+impl FileIdempotencyStore {
+    /// Use `dir` for records, creating it if needed.
+    pub fn open(dir: impl Into<PathBuf>) -> io::Result<Self> {
+        let dir = dir.into();
+        fs::create_dir_all(&dir)?;
+        Ok(Self { dir })
+    }
+
+    fn path_for(&self, key: &str) -> PathBuf {
+        let name = hex::encode(Sha256::digest(key.as_bytes()));
+        self.dir.join(format!("{}.json", name))
+    }
+}
+
+impl IdempotencyStore for FileIdempotencyStore {
+    fn get(&self, key: &str) -> io::Result<Option<IdempotencyRecord>> {
+        let path = self.path_for(key);
+        match fs::read(&path) {
+            Ok(bytes) => read_record(&path, &bytes).map(Some),
+            Err(e) if e.kind() == io::ErrorKind::NotFound => Ok(None),
+            Err(e) => Err(e),
+        }
+    }
+
+    fn put(&self, key: &str, record: &IdempotencyRecord) -> io::Result<()> {
+        let json = serde_json::to_vec(record)?;
+        let path = self.path_for(key);
+        let tmp = path.with_extension("json.tmp");
+        fs::write(&tmp, json)?;
+        fs::rename(&tmp, &path)
+    }
+
+    fn remove_expired(&self, now: DateTime<Utc>) -> io::Result<usize> {
+        let mut removed = 0;
+        for entry in fs::read_dir(&self.dir)? {
+            let path = entry?.path();
+            if path.extension().and_then(|e| e.to_str()) != Some("json") {
+                continue;
+            }
+            // A record that can't be read can't be replayed either.
+            let expired = fs::read(&path)
+                .and_then(|bytes| read_record(&path, &bytes))
+                .map_or(true, |r| r.expires_at <= now);
+            if expired {
+                match fs::remove_file(&path) {
+                    Err(e) if e.kind() == io::ErrorKind::NotFound => {}
+                    Err(e) => return Err(e),
+                    Ok(()) => removed += 1,
+                }
+            }
+        }
+        Ok(removed)
+    }
+}
+
+fn read_record(path: &Path, bytes: &[u8]) -> io::Result<IdempotencyRecord> {
+    serde_json::from_slice(bytes).map_err(|e| {
+        io::Error::new(
+            io::ErrorKind::InvalidData,
+            format!("{}: {}", path.display(), e),
+        )
+    })
+}
+
+/// What to do with a request carrying a key.
+#[derive(Clone, Debug, PartialEq)]
+pub enum Claim {
+    /// First use of the key: carry the request out, then [`Idempotency::complete`] or
+    /// [`Idempotency::release`] it.
+    Proceed,
+    /// A retry: answer with the stored response.
+    Replay(StoredResponse),
+}
+
+/// Keys in use: the stored responses, and the requests still running.
+pub struct Idempotency {
+    store: Box<dyn IdempotencyStore>,
+    ttl: Duration,
+    in_flight: Mutex<HashSet<String>>,
+}
+
+impl Idempotency {
+    /// Responses kept in `store` and replayed for `ttl`.
+    pub fn new(store: impl IdempotencyStore + 'static, ttl: Duration) -> Self {
+        Self {
+            store: Box::new(store),
+            ttl,
+            in_flight: Mutex::new(HashSet::new()),
+        }
+    }
+
+    /// Responses kept in memory for [`DEFAULT_IDEMPOTENCY_TTL`].
+    pub fn in_memory() -> Self {
+        Self::new(MemoryIdempotencyStore::new(), DEFAULT_IDEMPOTENCY_TTL)
+    }
+
+    /// Claim `key` at `now` for a request with `fingerprint`. Err(InProgress) while another
+    /// request holds the key: try again once it has finished.
+    pub fn begin(
+        &self,
+        key: &str,
+        fingerprint: &str,
+        now: DateTime<Utc>,
+    ) -> Result<Claim, IdempotencyError> {
+        if !valid_key(key) {
+            return Err(IdempotencyError::InvalidKey);
+        }
+        // Held across the store lookup so a request finishing can't be missed in between.
+        let mut in_flight = self.in_flight.lock().unwrap_or_else(|e| e.into_inner());
+        if in_flight.contains(key) {
+            return Err(IdempotencyError::InProgress);
+        }
+        match self.store.get(key)? {
+            Some(record) if record.expires_at > now => {
+                if record.fingerprint != fingerprint {
+                    return Err(IdempotencyError::KeyReused);
+                }
+                Ok(Claim::Replay(record.response))
+            }
+            _ => {
+                in_flight.insert(key.to_string());
+                Ok(Claim::Proceed)
+            }
+        }
+    }
+
+    /// Store the response to the request that claimed `key`, and let retries have it.
+    pub fn complete(
+        &self,
+        key: &str,
+        fingerprint: &str,
+        response: StoredResponse,
+        now: DateTime<Utc>,
+    ) -> Result<(), IdempotencyError> {
+        let mut in_flight = self.in_flight.lock().unwrap_or_else(|e| e.into_inner());
+        in_flight.remove(key);
+        let record = IdempotencyRecord {
+            fingerprint: fingerprint.to_string(),
+            response,
+            expires_at: now + self.ttl,
+        };
+        self.store.put(key, &record)?;
+        Ok(())
+    }
+
+    /// Give up `key` without storing a response (the request failed on the server's side), so
+    /// a retry is carried out afresh.
+    pub fn release(&self, key: &str) {
+        let mut in_flight = self.in_flight.lock().unwrap_or_else(|e| e.into_inner());
+        in_flight.remove(key);
+    }
+
+    /// Drop the responses expired at `now`. Returns how many were dropped.
+    pub fn remove_expired(&self, now: DateTime<Utc>) -> io::Result<usize> {
+        self.store.remove_expired(now)
+    }
+}
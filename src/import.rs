@@ -0,0 +1,185 @@
+//! Bulk player registration from a CSV file (name, optional seed) or a list of names.
+//!
+//! Imports are all-or-nothing: every row is checked first, and any problem rejects the whole
+//! import with the offending lines listed.
+
+use crate::models::{PlayerId, Tournament, TournamentError, TournamentState};
+use serde::Serialize;
+use std::collections::HashMap;
+
+/// Most players one import may add.
+pub const MAX_IMPORT_ROWS: usize = 500;
+
+/// One player to register.
+#[derive(Clone, Debug, Eq, PartialEq)]
+pub struct ImportRow {
+    /// 1-based line in the CSV file, or position in the list of names.
+    pub line: usize,
+    pub name: String,
+    /// Requested seed; players without one are seeded after the requested seeds are placed.
+    pub seed: Option<u32>,
+}
+
+/// A problem with one line of an import.
+#[derive(Clone, Debug, Eq, PartialEq, Serialize)]
+pub struct ImportIssue {
+    pub line: usize,
+    pub message: String,
+}
+
+/// Rows for a plain list of names, numbered from 1 in list order.
+pub fn rows_from_names(names: Vec<String>) -> Vec<ImportRow> {
+    (1..)
+        .zip(names)
+        .map(|(line, name)| ImportRow {
+            line,
+            name,
+            seed: None,
+        })
+        .collect()
+}
+
+/// Parse a CSV file with columns `name` and an optional `seed`. A first line reading `name`
+/// (any case) is taken as a header and skipped; blank lines are ignored.
+pub fn parse_players_csv(data: &[u8]) -> Result<Vec<ImportRow>, TournamentError> {
+    let mut reader = csv::ReaderBuilder::new()
+        .has_headers(false)
+        .flexible(true)
+        .from_reader(data);
+    let mut rows = Vec::new();
+    let mut issues = Vec::new();
+    for (i, record) in reader.records().enumerate() {
+        let record = match record {
+            Ok(r) => r,
+            Err(e) => {
+                let line = e.position().map_or(0, |p| p.line() as usize);
+                issues.push(issue(line, format!("Unreadable CSV: {}", e)));
+                continue;
+            }
+        };
+        let line = record.position().map_or(i + 1, |p| p.line() as usize);
+        let name = record.get(0).unwrap_or_default().trim();
+        let seed = record.get(1).map(str::trim).unwrap_or_default();
+        if i == 0 && name.eq_ignore_ascii_case("name") {
+            continue;
+        }
+        if record.iter().skip(2).any(|f| !f.trim().is_empty()) {
+            issues.push(issue(line, "Expected a name and an optional seed"));
+            continue;
+        }
+        let seed = match seed {
+            "" => None,
+            s => match s.parse::<u32>() {
+                Ok(n) if n > 0 => Some(n),
+                _ => {
+                    issues.push(issue(line, "Seed must be a whole number from 1"));
+                    continue;
+                }
+            },
+        };
+        rows.push(ImportRow {
+            line,
+            name: name.to_string(),
+            seed,
+        });
+    }
+    if !issues.is_empty() {
+        return Err(TournamentError::InvalidImport(issues));
+    }
+    Ok(rows)
+}
+
+/// Register every row as a player, or none of them.
+///
+/// Each name goes through the same checks as [`Tournament::add_player`] (blank, too long,
+/// already registered), and must not repeat an earlier line. Requested seeds must be unique
+/// and within the final player count, and can only be given in Setup. Any problem returns
+/// [`TournamentError::InvalidImport`] with every offending line and leaves the tournament
+/// unchanged. Returns the new players' ids in row order.
+pub fn import_players(
+    tournament: &mut Tournament,
+    rows: &[ImportRow],
+) -> Result<Vec<PlayerId>, TournamentError> {
+    if rows.is_empty() || rows.len() > MAX_IMPORT_ROWS {
+        return Err(TournamentError::ImportRowCount {
+            max: MAX_IMPORT_ROWS,
+        });
+    }
+    if rows.iter().any(|r| r.seed.is_some()) && tournament.state != TournamentState::Setup {
+        return Err(TournamentError::SeedingLocked);
+    }
+
+    let mut next = tournament.clone();
+    let total = next.players.len() + rows.len();
+    let mut issues = Vec::new();
+    let mut names: HashMap<String, usize> = HashMap::new();
+    let mut seeds: HashMap<u32, usize> = HashMap::new();
+    let mut added = Vec::new();
+    for row in rows {
+        let name = row.name.trim();
+        if let Some(&first) = names.get(&name.to_lowercase()) {
+            issues.push(issue(row.line, format!("Same name as line {}", first)));
+        } else {
+            match next.add_player(name) {
+                Ok(()) => {
+                    names.insert(name.to_lowercase(), row.line);
+                    added.push(next.players[next.players.len() - 1].id);
+                }
+                Err(TournamentError::InvalidState) => return Err(TournamentError::InvalidState),
+                Err(e) => issues.push(issue(row.line, e.to_string())),
+            }
+        }
+        if let Some(seed) = row.seed {
+            if seed as usize > total {
+                issues.push(issue(
+                    row.line,
+                    format!("Seed {} is above the player count ({})", seed, total),
+                ));
+            } else if let Some(&first) = seeds.get(&seed) {
+                issues.push(issue(
+                    row.line,
+                    format!("Seed {} is already used on line {}", seed, first),
+                ));
+            } else {
+                seeds.insert(seed, row.line);
+            }
+        }
+    }
+    if !issues.is_empty() {
+        return Err(TournamentError::InvalidImport(issues));
+    }
+
+    if !seeds.is_empty() {
+        let requested: HashMap<PlayerId, u32> = added
+            .iter()
+            .zip(rows)
+            .filter_map(|(&id, r)| Some((id, r.seed?)))
+            .collect();
+        let mut rest: Vec<(u32, PlayerId)> = next
+            .players
+            .iter()
+            .filter(|p| !requested.contains_key(&p.id))
+            .map(|p| (p.seed, p.id))
+            .collect();
+        rest.sort();
+        let mut rest = rest.into_iter().map(|(_, id)| id);
+        let mut order: Vec<Option<PlayerId>> = vec![None; total];
+        for (&id, &seed) in &requested {
+            order[seed as usize - 1] = Some(id);
+        }
+        let order: Vec<PlayerId> = order
+            .into_iter()
+            .filter_map(|slot| slot.or_else(|| rest.next()))
+            .collect();
+        next.set_seeds(&order)?;
+    }
+    *tournament = next;
+    Ok(added)
+}
+
+fn issue(line: usize, message: impl Into<String>) -> ImportIssue {
+    ImportIssue {
+        line,
+        message: message.into(),
+    }
+}
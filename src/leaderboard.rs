@@ -0,0 +1,181 @@
+//! Player rankings across one or many tournaments, with selectable sort and paging.
+
+use crate::models::{Player, Tournament};
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+
+/// What the leaderboard is ranked by (highest first).
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum LeaderboardSort {
+    #[default]
+    Wins,
+    WinPct,
+    Average,
+    Checkouts,
+    #[serde(rename = "180s")]
+    Count180s,
+}
+
+/// One ranked player. Across tournaments, players with the same name (case-insensitive) are
+/// counted as one. Wins and losses are singles results; pairs results are counted apart.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct LeaderboardEntry {
+    /// 1-based position in the full ranking (not the page).
+    pub rank: usize,
+    pub name: String,
+    pub wins: u32,
+    pub losses: u32,
+    pub games: u32,
+    /// Wins as a percentage of games (0 with no games).
+    pub win_percentage: f64,
+    pub three_dart_average: f64,
+    pub checkouts: u32,
+    pub count_180s: u32,
+    /// Results of the pairs teams this player was a member of.
+    pub team_wins: u32,
+    pub team_losses: u32,
+    /// Deleted players stay on the leaderboard, marked inactive.
+    pub inactive: bool,
+}
+
+/// A page of the leaderboard and how many players it has in total.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct Leaderboard {
+    pub total: usize,
+    pub entries: Vec<LeaderboardEntry>,
+}
+
+/// One player's stats summed over every tournament they appear in.
+#[derive(Default)]
+pub(crate) struct Totals {
+    pub(crate) name: String,
+    pub(crate) wins: u32,
+    pub(crate) losses: u32,
+    pub(crate) times_sat_out: u32,
+    pub(crate) points: u32,
+    pub(crate) darts: u32,
+    pub(crate) checkouts: u32,
+    pub(crate) highest_checkout: u32,
+    pub(crate) count_180s: u32,
+    pub(crate) team_wins: u32,
+    pub(crate) team_losses: u32,
+    /// The player has been deleted ([`crate::roster::delete_player`]).
+    pub(crate) deleted: bool,
+}
+
+impl Totals {
+    fn add(&mut self, p: &Player) {
+        self.wins += p.wins;
+        self.losses += p.losses;
+        self.times_sat_out += p.times_sat_out;
+        self.points += p.points_scored;
+        self.darts += p.darts_thrown;
+        self.checkouts += p.checkouts;
+        self.highest_checkout = self.highest_checkout.max(p.highest_checkout);
+        self.count_180s += p.count_180s;
+        self.deleted |= p.deleted_at.is_some();
+    }
+
+    pub(crate) fn games(&self) -> u32 {
+        self.wins + self.losses
+    }
+
+    pub(crate) fn win_percentage(&self) -> f64 {
+        match self.games() {
+            0 => 0.0,
+            games => f64::from(self.wins) * 100.0 / f64::from(games),
+        }
+    }
+
+    pub(crate) fn average(&self) -> f64 {
+        match self.darts {
+            0 => 0.0,
+            darts => f64::from(self.points) * 3.0 / f64::from(darts),
+        }
+    }
+
+    fn key(&self, sort: LeaderboardSort) -> f64 {
+        match sort {
+            LeaderboardSort::Wins => f64::from(self.wins),
+            LeaderboardSort::WinPct => self.win_percentage(),
+            LeaderboardSort::Average => self.average(),
+            LeaderboardSort::Checkouts => f64::from(self.checkouts),
+            LeaderboardSort::Count180s => f64::from(self.count_180s),
+        }
+    }
+}
+
+/// Rank every player in `tournaments` by `sort` and return `limit` entries from `offset`.
+///
+/// Players who haven't played a game rank below everyone who has. Ties go to fewer losses,
+/// then name (case-insensitive), so the order is the same on every request.
+pub fn leaderboard<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    sort: LeaderboardSort,
+    offset: usize,
+    limit: usize,
+) -> Leaderboard {
+    let mut ranked = totals_by_name(tournaments);
+    ranked.sort_by(|a, b| {
+        (b.games() > 0)
+            .cmp(&(a.games() > 0))
+            .then_with(|| b.key(sort).total_cmp(&a.key(sort)))
+            .then(a.losses.cmp(&b.losses))
+            .then_with(|| a.name.to_lowercase().cmp(&b.name.to_lowercase()))
+    });
+
+    let total = ranked.len();
+    let entries = ranked
+        .into_iter()
+        .enumerate()
+        .skip(offset)
+        .take(limit)
+        .map(|(i, t)| LeaderboardEntry {
+            rank: i + 1,
+            wins: t.wins,
+            losses: t.losses,
+            games: t.games(),
+            win_percentage: t.win_percentage(),
+            three_dart_average: t.average(),
+            checkouts: t.checkouts,
+            count_180s: t.count_180s,
+            team_wins: t.team_wins,
+            team_losses: t.team_losses,
+            inactive: t.deleted,
+            name: t.name,
+        })
+        .collect();
+    Leaderboard { total, entries }
+}
+
+/// Stats per player across `tournaments`, with same-named players (case-insensitive) merged.
+/// The name kept is the first spelling seen. Order is unspecified. Pairs teams aren't players:
+/// their results go to each member's team record instead.
+pub(crate) fn totals_by_name<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+) -> Vec<Totals> {
+    let mut by_name: HashMap<String, Totals> = HashMap::new();
+    for t in tournaments {
+        for p in t.all_players() {
+            if !p.is_pair() {
+                totals_for(&mut by_name, &p.name).add(p);
+                continue;
+            }
+            for member in &p.members {
+                let totals = totals_for(&mut by_name, member);
+                totals.team_wins += p.wins;
+                totals.team_losses += p.losses;
+            }
+        }
+    }
+    by_name.into_values().collect()
+}
+
+fn totals_for<'a>(by_name: &'a mut HashMap<String, Totals>, name: &str) -> &'a mut Totals {
+    let totals = by_name.entry(name.to_lowercase()).or_default();
+    if totals.name.is_empty() {
+        totals.name = name.to_string();
+    }
+    totals
+}
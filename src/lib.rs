@@ -1,14 +1,68 @@
 //! Dart tournament web app: library with models and business logic.
 
+pub mod api_error;
+pub mod archive;
+pub mod audit;
+pub mod auth;
+pub mod avatars;
+pub mod backup;
+pub mod bracket_view;
+pub mod deadline;
+pub mod display;
+pub mod export;
+pub mod full;
+pub mod handicap;
+pub mod health;
+pub mod history;
+pub mod idempotency;
+pub mod import;
+pub mod leaderboard;
 pub mod logic;
+pub mod metrics;
+pub mod migrations;
 pub mod models;
+pub mod rate_limit;
+pub mod rating;
+pub mod registry;
+pub mod roster;
+pub mod scoring;
+pub mod seasons;
+pub mod sessions;
+pub mod simulate;
+pub mod store;
+pub mod templates;
+pub mod validation;
+pub mod versions;
+pub mod visits;
+pub mod webhooks;
 
+pub use leaderboard::{leaderboard, Leaderboard, LeaderboardEntry, LeaderboardSort};
 pub use logic::{
-    add_players_back_from_last_eliminated, generate_group_play_matches,
-    generate_semi_final_matches, process_finals_results, process_group_play_results,
-    process_semi_final_results, set_finals_match_winner, start_semi_finals, start_tournament,
+    add_players_back_from_last_eliminated, advance_to_knockout, balanced_pair_draw, carry_form,
+    compute_standings, draw_order, estimated_finish, final_placements, finish_tournament,
+    generate_double_elim_bracket, generate_group_play_matches, generate_round_robin,
+    generate_semi_final_matches, generate_single_elim_bracket, group_standings, match_format,
+    next_matches, numbered_boards, pair_swiss_round, process_finals_results,
+    process_group_play_results, process_semi_final_results, record_bracket_result,
+    record_cricket_visit, record_match_visit, record_walkover, reseed_by_stats,
+    round_robin_standings, seed_positions, set_boards, set_finals_match_winner, set_match_formats,
+    start_groups_knockout, start_match, start_next_swiss_round, start_semi_finals,
+    start_tournament, start_with_draw, swiss_opponents, swiss_standings, timing_report,
+    undo_last_action, withdraw_player, DrawSettings, GroupSettings, GroupStanding, MatchTiming,
+    PlayerStanding, RoundRobinRound, RoundTiming, SwissRound, TimingReport, ASSUMED_MATCH_MINUTES,
+    DEFAULT_BEST_OF, ROLLING_MATCHES,
 };
 pub use models::{
-    GameMatch, MatchId, Player, PlayerId, PlayerStats, RoundType, Team, Tournament,
-    TournamentError, TournamentId, TournamentMode, TournamentState,
+    Board, Bracket, BracketMatch, BracketSection, BracketSlot, Draw, DrawMode, EntryType,
+    GameMatch, Group, GroupStage, Handicap, KnockoutStage, LegScore, MatchAction, MatchFormats,
+    MatchId, PairMetric, Placement, Player, PlayerId, PlayerStats, RatingChange, RecordedResult,
+    ResultType, RoundType, Team, Tournament, TournamentError, TournamentFormat, TournamentId,
+    TournamentMode, TournamentState, DEFAULT_RATING, MAX_BOARDS, MAX_BOARD_NAME_LEN,
+    MAX_HANDICAP_LEGS, MAX_HANDICAP_POINTS, MAX_PLAYER_NAME_LEN, MAX_TOURNAMENT_NAME_LEN,
+};
+pub use registry::{ChangeListener, RegistryError, TournamentRegistry};
+#[cfg(feature = "sqlite")]
+pub use store::SqliteStore;
+pub use store::{
+    read_snapshot, write_snapshot, FileStore, StorageDriver, TournamentStore, UnknownDriver,
 };
@@ -0,0 +1,126 @@
+//! Board scheduling: ready bracket matches go to free boards, never putting a player on two
+//! boards at once.
+
+use crate::models::{
+    Board, BracketMatch, MatchId, PlayerId, Tournament, TournamentError, MAX_BOARDS,
+    MAX_BOARD_NAME_LEN,
+};
+use chrono::Utc;
+use std::collections::HashSet;
+
+/// Names for `count` boards: "Board 1", "Board 2", ...
+pub fn numbered_boards(count: usize) -> Vec<String> {
+    (1..=count).map(|i| format!("Board {}", i)).collect()
+}
+
+/// Replace the tournament's boards (trimmed, unique case-insensitive names; an empty list
+/// turns scheduling off). A board whose name is kept keeps its match; then free boards are
+/// filled. Allowed in any state.
+pub fn set_boards(tournament: &mut Tournament, names: &[String]) -> Result<(), TournamentError> {
+    if names.len() > MAX_BOARDS {
+        return Err(TournamentError::TooManyBoards { max: MAX_BOARDS });
+    }
+    let mut boards: Vec<Board> = Vec::with_capacity(names.len());
+    for name in names.iter().map(|n| n.trim()) {
+        if name.is_empty() {
+            return Err(TournamentError::EmptyBoardName);
+        }
+        if name.chars().count() > MAX_BOARD_NAME_LEN {
+            return Err(TournamentError::BoardNameTooLong {
+                max: MAX_BOARD_NAME_LEN,
+            });
+        }
+        if boards.iter().any(|b| b.name.eq_ignore_ascii_case(name)) {
+            return Err(TournamentError::DuplicateBoardName);
+        }
+        let match_id = tournament
+            .boards
+            .iter()
+            .find(|b| b.name == name)
+            .and_then(|b| b.match_id);
+        boards.push(Board {
+            name: name.to_string(),
+            match_id,
+        });
+    }
+    tournament.boards = boards;
+    schedule_boards(tournament);
+    Ok(())
+}
+
+/// Bring board assignments up to date: free every board whose match is no longer ready (it
+/// has a result, or its players changed back to unknown after an undo), then give each free
+/// board, in order, the first ready match in bracket order whose players are both off the
+/// boards. Byes are never assigned. A match's clock starts when it first gets a board, and
+/// the match remembers the board it was put on.
+///
+/// Called after every change that can finish or open up a match, so assignments are always
+/// current when read.
+pub(crate) fn schedule_boards(tournament: &mut Tournament) {
+    let Some(bracket) = &tournament.bracket else {
+        for board in &mut tournament.boards {
+            board.match_id = None;
+        }
+        return;
+    };
+    let playable = |id: MatchId| bracket.get(id).filter(|m| is_playable(m));
+    for board in &mut tournament.boards {
+        if board.match_id.is_some_and(|id| playable(id).is_none()) {
+            board.match_id = None;
+        }
+    }
+    let assigned: HashSet<MatchId> = tournament
+        .boards
+        .iter()
+        .filter_map(|b| b.match_id)
+        .collect();
+    let mut busy: HashSet<PlayerId> = assigned
+        .iter()
+        .filter_map(|id| playable(*id))
+        .flat_map(players)
+        .collect();
+    let mut assigned_now: Vec<(MatchId, String)> = Vec::new();
+    let mut waiting = bracket
+        .matches
+        .iter()
+        .filter(|m| is_playable(m) && !assigned.contains(&m.id));
+    for board in tournament
+        .boards
+        .iter_mut()
+        .filter(|b| b.match_id.is_none())
+    {
+        let Some(next) = waiting.find(|m| players(m).all(|p| !busy.contains(&p))) else {
+            break;
+        };
+        busy.extend(players(next));
+        board.match_id = Some(next.id);
+        assigned_now.push((next.id, board.name.clone()));
+    }
+    let now = Utc::now();
+    for (id, board) in assigned_now {
+        if let Some(m) = tournament.bracket.as_mut().and_then(|b| b.get_mut(id)) {
+            m.started_at.get_or_insert(now);
+            m.board = Some(board);
+        }
+    }
+}
+
+/// Matches currently on a board, in board order: `(board, match)`.
+pub fn next_matches(tournament: &Tournament) -> Vec<(&Board, &BracketMatch)> {
+    let Some(bracket) = &tournament.bracket else {
+        return Vec::new();
+    };
+    tournament
+        .boards
+        .iter()
+        .filter_map(|b| Some((b, bracket.get(b.match_id?)?)))
+        .collect()
+}
+
+fn is_playable(m: &BracketMatch) -> bool {
+    m.is_ready() && !m.bye
+}
+
+fn players(m: &BracketMatch) -> impl Iterator<Item = PlayerId> {
+    m.team_1.into_iter().chain(m.team_2)
+}
@@ -0,0 +1,666 @@
+//! Knockout brackets: generation from seeded players and advancing winners.
+
+use crate::logic::boards::schedule_boards;
+use crate::logic::draw::draw_order;
+use crate::logic::groups::{draw_groups, group_losses, is_locked_group_match, GroupSettings};
+use crate::logic::match_format::{check_result_score, configured_format};
+use crate::logic::plate::{draw_plate, drop_plate, feeds_plate, plate_started};
+use crate::logic::round_robin::{generate_round_robin, sit_out_match};
+use crate::logic::swiss::start_swiss;
+use crate::logic::walkover::{resolve_withdrawals, withdrawn_in};
+use crate::models::{
+    Bracket, BracketMatch, BracketSection, BracketSlot, LegScore, MatchAction, MatchId, Player,
+    PlayerId, RecordedResult, ResultType, Team, Tournament, TournamentError, TournamentFormat,
+    TournamentMode, TournamentState,
+};
+use crate::rating::{rate_result, revert_result};
+use chrono::Utc;
+use std::collections::HashSet;
+
+/// Build a single-elimination bracket, ordering players by `seed` (1 = top seed).
+///
+/// The bracket size is the next power of two; seeds are placed in standard positions
+/// (1 vs lowest, 2 vs second-lowest, ...) so seeds 1 and 2 can only meet in the final.
+/// Missing opponents are byes, which always go to the top seeds and are advanced immediately.
+pub fn generate_single_elim_bracket(players: &[Player]) -> Result<Bracket, TournamentError> {
+    single_elim_bracket(&seed_order(players))
+}
+
+/// Single-elimination bracket with `order[i]` in seed position `i + 1`.
+pub(crate) fn single_elim_bracket(order: &[PlayerId]) -> Result<Bracket, TournamentError> {
+    let mut bracket = winners_bracket(order)?;
+    advance_byes(&mut bracket);
+    Ok(bracket)
+}
+
+/// Build a double-elimination bracket: the single-elimination tree as the winners bracket, a
+/// losers bracket, and a grand final with a bracket reset.
+///
+/// Odd losers rounds pair up the players already in the losers bracket (round 1: first-round
+/// losers); even rounds bring in the losers of the next winners round, in reversed order every
+/// other round so players don't meet again straight away. The winners champion plays the
+/// losers champion in the grand final; if the losers champion wins, the reset decides it.
+/// Losers-bracket slots that only byes feed are byes themselves.
+pub fn generate_double_elim_bracket(players: &[Player]) -> Result<Bracket, TournamentError> {
+    double_elim_bracket(&seed_order(players))
+}
+
+/// Double-elimination bracket with `order[i]` in seed position `i + 1`.
+fn double_elim_bracket(order: &[PlayerId]) -> Result<Bracket, TournamentError> {
+    let mut bracket = winners_bracket(order)?;
+    let rounds = bracket.round_count();
+    let size = 1u32 << rounds;
+    let losers_rounds = 2 * (rounds - 1);
+    for round in 1..=losers_rounds {
+        let count = size >> (round.div_ceil(2) + 1);
+        for number in 1..=count {
+            bracket.matches.push(BracketMatch::in_section(
+                BracketSection::Losers,
+                round,
+                number,
+            ));
+        }
+    }
+    let grand_final = BracketMatch::in_section(BracketSection::GrandFinal, 1, 1);
+    let reset = BracketMatch::in_section(BracketSection::GrandFinal, 2, 1);
+    let (grand_final_id, reset_id) = (grand_final.id, reset.id);
+    bracket.matches.extend([grand_final, reset]);
+
+    let losers_final = match losers_rounds {
+        0 => grand_final_id,
+        r => match_at(&bracket, BracketSection::Losers, r, 1),
+    };
+    for i in 0..bracket.matches.len() {
+        let m = &bracket.matches[i];
+        let (round, number) = (m.round, m.number);
+        let (winner_to, loser_to) = match m.section {
+            BracketSection::Winners if round == rounds => (
+                Some(slot(grand_final_id, Team::One)),
+                Some(slot(losers_final, Team::Two)),
+            ),
+            BracketSection::Winners if round == 1 => {
+                let to = match_at(&bracket, BracketSection::Losers, 1, number.div_ceil(2));
+                (m.winner_to, Some(pair_slot(to, number)))
+            }
+            BracketSection::Winners => {
+                // Losers of winners round w drop into losers round 2(w - 1).
+                let drop_round = 2 * (round - 1);
+                let count = size >> round;
+                let target = match (round - 1) % 2 {
+                    1 => count + 1 - number,
+                    _ => number,
+                };
+                let to = match_at(&bracket, BracketSection::Losers, drop_round, target);
+                (m.winner_to, Some(slot(to, Team::Two)))
+            }
+            BracketSection::Losers if round == losers_rounds => {
+                (Some(slot(grand_final_id, Team::Two)), None)
+            }
+            BracketSection::Losers => {
+                let winner_to = match round % 2 {
+                    1 => slot(
+                        match_at(&bracket, BracketSection::Losers, round + 1, number),
+                        Team::One,
+                    ),
+                    _ => pair_slot(
+                        match_at(
+                            &bracket,
+                            BracketSection::Losers,
+                            round + 1,
+                            number.div_ceil(2),
+                        ),
+                        number,
+                    ),
+                };
+                (Some(winner_to), None)
+            }
+            BracketSection::GrandFinal if round == 1 => (
+                Some(slot(reset_id, Team::One)),
+                Some(slot(reset_id, Team::Two)),
+            ),
+            BracketSection::GrandFinal | BracketSection::Plate => (None, None),
+        };
+        let m = &mut bracket.matches[i];
+        m.winner_to = winner_to;
+        m.loser_to = loser_to;
+    }
+
+    mark_losers_byes(&mut bracket);
+    advance_byes(&mut bracket);
+    Ok(bracket)
+}
+
+/// Standard bracket order of seeds for a power-of-two `size`: adjacent pairs are first-round
+/// matches, e.g. 8 → [1, 8, 4, 5, 2, 7, 3, 6].
+pub fn seed_positions(size: usize) -> Vec<usize> {
+    let mut positions = vec![1];
+    while positions.len() < size {
+        let n = positions.len() * 2;
+        positions = positions.iter().flat_map(|&s| [s, n + 1 - s]).collect();
+    }
+    positions
+}
+
+/// Player ids by seed, best first.
+pub(crate) fn seed_order(players: &[Player]) -> Vec<PlayerId> {
+    let mut seeded: Vec<&Player> = players.iter().collect();
+    seeded.sort_by_key(|p| p.seed);
+    seeded.iter().map(|p| p.id).collect()
+}
+
+/// Knockout tree with `ids[i]` in seed position `i + 1` and first-round byes decided but not
+/// yet advanced.
+fn winners_bracket(ids: &[PlayerId]) -> Result<Bracket, TournamentError> {
+    if ids.len() < 2 {
+        return Err(TournamentError::NotEnoughPlayersToStart { required: 2 });
+    }
+
+    let size = ids.len().next_power_of_two();
+    let rounds = size.trailing_zeros();
+    let mut bracket = Bracket::default();
+    for round in 1..=rounds {
+        let count = (size >> round) as u32;
+        for number in 1..=count {
+            bracket.matches.push(BracketMatch::new(round, number));
+        }
+    }
+    link_winners(&mut bracket);
+
+    let positions = seed_positions(size);
+    for (i, m) in bracket
+        .matches
+        .iter_mut()
+        .filter(|m| m.round == 1)
+        .enumerate()
+    {
+        m.team_1 = ids.get(positions[2 * i] - 1).copied();
+        m.team_2 = ids.get(positions[2 * i + 1] - 1).copied();
+        if m.team_1.is_none() || m.team_2.is_none() {
+            m.bye = true;
+            m.winner = Some(if m.team_1.is_some() {
+                Team::One
+            } else {
+                Team::Two
+            });
+        }
+    }
+    Ok(bracket)
+}
+
+/// Send every first-round bye winner on to their next match.
+fn advance_byes(bracket: &mut Bracket) {
+    let byes: Vec<MatchId> = bracket
+        .round(1)
+        .filter(|m| m.bye && m.winner.is_some())
+        .map(|m| m.id)
+        .collect();
+    for id in byes {
+        advance_winner(bracket, id);
+    }
+}
+
+/// Mark losers-bracket matches that can't get two players as byes. A slot is empty when it
+/// is fed by a first-round bye (no loser) or by a losers match nobody reaches.
+fn mark_losers_byes(bracket: &mut Bracket) {
+    let mut empty: HashSet<MatchId> = HashSet::new();
+    for i in 0..bracket.matches.len() {
+        if bracket.matches[i].section != BracketSection::Losers {
+            continue;
+        }
+        let id = bracket.matches[i].id;
+        let filled = |team| {
+            let to = Some(slot(id, team));
+            bracket.matches.iter().any(|f| {
+                (f.loser_to == to && !f.bye) || (f.winner_to == to && !empty.contains(&f.id))
+            })
+        };
+        let live = [filled(Team::One), filled(Team::Two)];
+        if live == [false, false] {
+            empty.insert(id);
+        }
+        if live != [true, true] {
+            bracket.matches[i].bye = true;
+        }
+    }
+}
+
+fn slot(match_id: MatchId, team: Team) -> BracketSlot {
+    BracketSlot { match_id, team }
+}
+
+/// Slot in the next round for match `number` when two matches feed one: odd numbers take
+/// side one, even numbers side two.
+fn pair_slot(match_id: MatchId, number: u32) -> BracketSlot {
+    let team = match number % 2 {
+        1 => Team::One,
+        _ => Team::Two,
+    };
+    slot(match_id, team)
+}
+
+fn match_at(bracket: &Bracket, section: BracketSection, round: u32, number: u32) -> MatchId {
+    bracket
+        .section_round(section, round)
+        .find(|m| m.number == number)
+        .map(|m| m.id)
+        .expect("bracket match exists")
+}
+
+/// Point each match's `winner_to` at the next round: matches 1 and 2 feed match 1, etc.
+fn link_winners(bracket: &mut Bracket) {
+    let rounds = bracket.round_count();
+    for round in 1..rounds {
+        let next: Vec<MatchId> = bracket.round(round + 1).map(|m| m.id).collect();
+        for m in bracket.matches.iter_mut().filter(|m| m.round == round) {
+            let idx = (m.number - 1) as usize;
+            m.winner_to = Some(pair_slot(next[idx / 2], m.number));
+        }
+    }
+}
+
+/// Copy a decided match's winner into the slot it feeds.
+pub(crate) fn advance_winner(bracket: &mut Bracket, match_id: MatchId) {
+    let Some(m) = bracket.get(match_id) else {
+        return;
+    };
+    if let (Some(to), Some(winner)) = (m.winner_to, m.winner_id()) {
+        place_player(bracket, to, winner);
+    }
+}
+
+/// Copy a decided match's loser into the slot it feeds (double elimination).
+fn advance_loser(bracket: &mut Bracket, match_id: MatchId) {
+    let Some(m) = bracket.get(match_id) else {
+        return;
+    };
+    if let (Some(to), Some(loser)) = (m.loser_to, m.loser_id()) {
+        place_player(bracket, to, loser);
+    }
+}
+
+/// Put a player into a slot; if that match is a bye they go straight through it.
+fn place_player(bracket: &mut Bracket, to: BracketSlot, player: PlayerId) {
+    let Some(next) = bracket.get_mut(to.match_id) else {
+        return;
+    };
+    next.set_player(to.team, Some(player));
+    if next.bye && next.winner.is_none() {
+        next.winner = Some(to.team);
+        let id = next.id;
+        advance_winner(bracket, id);
+    }
+}
+
+/// Take a player back out of a slot, and out of any byes they went through from there.
+fn clear_slot(bracket: &mut Bracket, from: BracketSlot) {
+    let Some(next) = bracket.get_mut(from.match_id) else {
+        return;
+    };
+    next.set_player(from.team, None);
+    if next.bye && next.winner == Some(from.team) {
+        next.winner = None;
+        if let Some(on) = next.winner_to {
+            clear_slot(bracket, on);
+        }
+    }
+}
+
+/// Whether the player sent into `to` has played since (following them through byes).
+fn slot_played(bracket: &Bracket, to: BracketSlot) -> bool {
+    let Some(next) = bracket.get(to.match_id) else {
+        return false;
+    };
+    match (next.bye, next.winner_to) {
+        (true, Some(on)) => next.winner.is_some() && slot_played(bracket, on),
+        (true, None) => false,
+        (false, _) => next.winner.is_some(),
+    }
+}
+
+/// Losses that knock a player out of a bracket format (None: nobody is eliminated).
+fn losses_to_eliminate(format: TournamentFormat) -> Option<u32> {
+    match format {
+        TournamentFormat::SingleElimination => Some(1),
+        TournamentFormat::DoubleElimination => Some(2),
+        TournamentFormat::Elimination
+        | TournamentFormat::RoundRobin
+        | TournamentFormat::Swiss
+        | TournamentFormat::GroupsKnockout => None,
+    }
+}
+
+/// Losses that knock `player` out: the format's limit, or in groups-then-knockout none
+/// during the groups and one more than their group-stage losses in the knockout.
+fn loss_limit(tournament: &Tournament, player: PlayerId) -> Option<u32> {
+    match &tournament.group_stage {
+        Some(stage) if stage.knockout_started => Some(group_losses(tournament, player) + 1),
+        Some(_) => None,
+        None => losses_to_eliminate(tournament.format),
+    }
+}
+
+/// Grand final round 1 of a double-elimination bracket.
+fn is_grand_final(m: &BracketMatch) -> bool {
+    m.section == BracketSection::GrandFinal && m.round == 1
+}
+
+/// Start a bracket format: close any gaps in the seeds and generate the bracket
+/// (knockout tree from the seeds or the tournament's draw, the full round-robin schedule with sit-outs as byes, Swiss round 1, or
+/// the group matches with the default group settings).
+pub(crate) fn start_bracket(tournament: &mut Tournament) -> Result<(), TournamentError> {
+    if tournament.mode != TournamentMode::OneVOne {
+        return Err(TournamentError::UnsupportedMode);
+    }
+    tournament.compact_seeds();
+    let order = match &tournament.draw {
+        Some(draw) => draw_order(&tournament.players, draw),
+        None => seed_order(&tournament.players),
+    };
+    let bracket = match tournament.format {
+        TournamentFormat::SingleElimination => single_elim_bracket(&order)?,
+        TournamentFormat::DoubleElimination => double_elim_bracket(&order)?,
+        TournamentFormat::RoundRobin => {
+            let mut bracket = Bracket::default();
+            for r in generate_round_robin(&mut tournament.players)? {
+                let next = r.matches.len() as u32 + 1;
+                bracket.matches.extend(r.matches);
+                if let Some(id) = r.sat_out {
+                    bracket.matches.push(sit_out_match(r.round, next, id));
+                }
+            }
+            bracket
+        }
+        TournamentFormat::Swiss => {
+            start_swiss(tournament)?;
+            tournament.state = TournamentState::BracketPlay;
+            schedule_boards(tournament);
+            return Ok(());
+        }
+        TournamentFormat::GroupsKnockout => {
+            let settings = GroupSettings::default_for(tournament.players.len());
+            draw_groups(tournament, settings)?
+        }
+        TournamentFormat::Elimination => return Err(TournamentError::InvalidState),
+    };
+    tournament.bracket = Some(bracket);
+    tournament.state = TournamentState::BracketPlay;
+    schedule_boards(tournament);
+    Ok(())
+}
+
+/// Record the result of a bracket match: the winner gets a win, the loser a loss (and is
+/// eliminated once they reach the format's loss limit), and both move on to their next match.
+/// When the winners champion takes the grand final, the bracket reset is skipped.
+///
+/// A match that already has a result is rejected unless `overwrite` is set; overwriting first
+/// rolls back the previous win/loss and advancement, which is only possible while the next
+/// matches have not started (no result and no scored visits). The tournament completes once every
+/// match has a result (in Swiss, every match of the last round). The result is added to the
+/// match's action log. Matches of a withdrawn player can't take a result, only a walkover
+/// (see [`record_walkover`](crate::record_walkover)).
+pub fn record_bracket_result(
+    tournament: &mut Tournament,
+    match_id: MatchId,
+    winner: PlayerId,
+    score: Option<LegScore>,
+    overwrite: bool,
+) -> Result<(), TournamentError> {
+    use TournamentState::*;
+    if !matches!(tournament.state, BracketPlay | Completed) {
+        return Err(TournamentError::InvalidState);
+    }
+    if is_locked_group_match(tournament, match_id) {
+        return Err(TournamentError::NextMatchAlreadyPlayed);
+    }
+    let bracket = tournament
+        .bracket
+        .as_ref()
+        .ok_or(TournamentError::InvalidState)?;
+    let m = bracket
+        .get(match_id)
+        .ok_or(TournamentError::MatchNotFound(match_id))?;
+    if m.bye || m.team_1.is_none() || m.team_2.is_none() {
+        return Err(TournamentError::MatchNotReady);
+    }
+    if let Some(id) = withdrawn_in(tournament, m) {
+        return Err(TournamentError::PlayerWithdrawn(id));
+    }
+    let side = m
+        .side_of(winner)
+        .ok_or(TournamentError::NotInMatch(winner))?;
+    if let Some(s) = score {
+        let (won, lost) = match side {
+            Team::One => (s.team_1, s.team_2),
+            Team::Two => (s.team_2, s.team_1),
+        };
+        if won <= lost {
+            return Err(TournamentError::InvalidScore);
+        }
+        if let Some(format) = configured_format(tournament, match_id) {
+            check_result_score(format, s, side)?;
+        }
+    }
+    let replaced = m.winner_id().map(|winner| RecordedResult {
+        winner,
+        score: m.score,
+        result_type: m.result_type,
+    });
+    if replaced.is_some() {
+        if !overwrite {
+            return Err(TournamentError::ResultAlreadyRecorded);
+        }
+        if next_started(tournament, bracket, m) {
+            return Err(TournamentError::NextMatchAlreadyPlayed);
+        }
+        rollback_result(tournament, match_id)?;
+    }
+
+    apply_result(tournament, match_id, side, score, ResultType::Played)?;
+    if replaced.is_none() {
+        tournament.activity.match_completed();
+    }
+    tournament
+        .match_log
+        .entry(match_id)
+        .or_default()
+        .push(MatchAction::Result {
+            result: RecordedResult {
+                winner,
+                score,
+                result_type: ResultType::Played,
+            },
+            replaced,
+        });
+    resolve_withdrawals(tournament)?;
+    schedule_boards(tournament);
+    Ok(())
+}
+
+/// Take back a bracket result (the last logged action on the match): the win/loss and rating
+/// change are reverted and both players are pulled out of their next matches. If the result
+/// had overwritten an earlier one, that earlier result is put back.
+///
+/// Fails with [`TournamentError::NextMatchAlreadyPlayed`] once a match the result fed into has
+/// started (has a result or scored visits) or, in Swiss, once the next round is paired. A
+/// result voided by a withdrawal stays void.
+pub(crate) fn undo_bracket_result(
+    tournament: &mut Tournament,
+    match_id: MatchId,
+    replaced: Option<RecordedResult>,
+) -> Result<(), TournamentError> {
+    use TournamentState::*;
+    if !matches!(tournament.state, BracketPlay | Completed) {
+        return Err(TournamentError::InvalidState);
+    }
+    if is_locked_group_match(tournament, match_id) {
+        return Err(TournamentError::NextMatchAlreadyPlayed);
+    }
+    let bracket = tournament
+        .bracket
+        .as_ref()
+        .ok_or(TournamentError::InvalidState)?;
+    let m = bracket
+        .get(match_id)
+        .ok_or(TournamentError::MatchNotFound(match_id))?;
+    if m.winner.is_none() || m.bye {
+        return Err(TournamentError::NothingToUndo);
+    }
+    if let Some(id) = withdrawn_in(tournament, m).filter(|_| m.result_type == ResultType::Void) {
+        return Err(TournamentError::PlayerWithdrawn(id));
+    }
+    if next_started(tournament, bracket, m) {
+        return Err(TournamentError::NextMatchAlreadyPlayed);
+    }
+    let previous = replaced.and_then(|r| Some((m.side_of(r.winner)?, r)));
+    rollback_result(tournament, match_id)?;
+    match previous {
+        Some((side, r)) => apply_result(tournament, match_id, side, r.score, r.result_type)?,
+        None => tournament.state = BracketPlay,
+    }
+    schedule_boards(tournament);
+    Ok(())
+}
+
+/// Whether a match `m` feeds into has started: it has a result or visits have been scored in
+/// it. In Swiss, where matches don't feed each other, whether a later round has been paired.
+/// A first-round match with a plate feeds the whole plate once it is drawn.
+fn next_started(tournament: &Tournament, bracket: &Bracket, m: &BracketMatch) -> bool {
+    if tournament.format == TournamentFormat::Swiss {
+        return bracket.round_count() > m.round;
+    }
+    if feeds_plate(tournament, m) && plate_started(tournament, bracket) {
+        return true;
+    }
+    [m.winner_to, m.loser_to]
+        .into_iter()
+        .flatten()
+        .any(|to| slot_played(bracket, to) || tournament.has_visits(to.match_id))
+}
+
+/// Set a validated result and apply its effects: advancement, rating, win/loss, elimination,
+/// the plate draw and completion. A walkover moves no ratings, and gives the winner a win only
+/// if the tournament counts walkovers; a withdrawn loser is out whatever their losses.
+pub(crate) fn apply_result(
+    tournament: &mut Tournament,
+    match_id: MatchId,
+    side: Team,
+    score: Option<LegScore>,
+    result_type: ResultType,
+) -> Result<(), TournamentError> {
+    use TournamentState::*;
+    let counts_win = result_type == ResultType::Played || tournament.walkover_counts_as_win;
+    let bracket = tournament
+        .bracket
+        .as_mut()
+        .ok_or(TournamentError::InvalidState)?;
+    let m = bracket
+        .get_mut(match_id)
+        .ok_or(TournamentError::MatchNotFound(match_id))?;
+    m.winner = Some(side);
+    m.score = score;
+    m.result_type = result_type;
+    m.completed_at = Some(Utc::now());
+    let winner = m.winner_id().expect("both players known");
+    let loser = m.loser_id().expect("both players known");
+    let plate = m.section == BracketSection::Plate;
+    let skip_reset = match (is_grand_final(m), m.winner_to) {
+        (true, Some(reset)) if side == Team::One => Some(reset.match_id),
+        _ => None,
+    };
+    advance_winner(bracket, match_id);
+    advance_loser(bracket, match_id);
+    if let Some(reset) = skip_reset.and_then(|id| bracket.get_mut(id)) {
+        reset.set_player(Team::Two, None);
+        reset.bye = true;
+        reset.winner = Some(Team::One);
+    }
+    if result_type == ResultType::Played {
+        rate_result(tournament, match_id, &[winner], &[loser]);
+    }
+    if counts_win {
+        let p = tournament.add_win(winner)?;
+        if plate {
+            p.plate_wins += 1;
+        }
+    }
+    let max_losses = loss_limit(tournament, loser);
+    let p = tournament.add_loss(loser)?;
+    if p.withdrawn || max_losses.is_some_and(|max| p.losses >= max) {
+        p.eliminate();
+    }
+    draw_plate(tournament)?;
+
+    let complete = tournament.bracket.as_ref().is_some_and(|b| {
+        b.is_complete()
+            && (tournament.format != TournamentFormat::Swiss
+                || b.round_count() >= tournament.swiss_rounds)
+            && tournament
+                .group_stage
+                .as_ref()
+                .is_none_or(|s| s.knockout_started)
+    });
+    tournament.state = if complete { Completed } else { BracketPlay };
+    Ok(())
+}
+
+/// Undo a recorded result: take back the win/loss, un-eliminate the loser, and clear both
+/// players from their next matches (for a first-round match, take down the plate). Caller
+/// checks those matches have not been played.
+fn rollback_result(tournament: &mut Tournament, match_id: MatchId) -> Result<(), TournamentError> {
+    let counts_walkover = tournament.walkover_counts_as_win;
+    let takes_down_plate = tournament
+        .bracket
+        .as_ref()
+        .and_then(|b| b.get(match_id))
+        .is_some_and(|m| feeds_plate(tournament, m));
+    let bracket = tournament
+        .bracket
+        .as_mut()
+        .ok_or(TournamentError::InvalidState)?;
+    let m = bracket
+        .get_mut(match_id)
+        .ok_or(TournamentError::MatchNotFound(match_id))?;
+    let (Some(winner), Some(loser)) = (m.winner_id(), m.loser_id()) else {
+        return Ok(());
+    };
+    let (winner_to, loser_to) = (m.winner_to, m.loser_to);
+    let grand_final = is_grand_final(m);
+    let plate = m.section == BracketSection::Plate;
+    let counted_win = m.result_type == ResultType::Played || counts_walkover;
+    m.winner = None;
+    m.score = None;
+    m.result_type = ResultType::Played;
+    m.completed_at = None;
+    for to in [winner_to, loser_to].into_iter().flatten() {
+        clear_slot(bracket, to);
+    }
+    if let Some(reset) = winner_to.filter(|_| grand_final) {
+        if let Some(reset) = bracket.get_mut(reset.match_id) {
+            reset.bye = false;
+            reset.winner = None;
+        }
+    }
+    let p = tournament
+        .get_player_mut(winner)
+        .ok_or(TournamentError::PlayerNotFound(winner))?;
+    if counted_win {
+        p.remove_win();
+        if plate {
+            p.plate_wins = p.plate_wins.saturating_sub(1);
+        }
+    }
+    revert_result(p, match_id);
+    let max_losses = loss_limit(tournament, loser);
+    let p = tournament
+        .get_player_mut(loser)
+        .ok_or(TournamentError::PlayerNotFound(loser))?;
+    p.remove_loss();
+    revert_result(p, match_id);
+    if !p.withdrawn && max_losses.is_some_and(|max| p.losses < max) {
+        p.eliminated = false;
+    }
+    if takes_down_plate {
+        drop_plate(tournament);
+    }
+    Ok(())
+}
@@ -0,0 +1,188 @@
+//! Knockout draws: seeded, blind (random), or random with the top seeds protected; and the
+//! balanced draw that makes the teams of a pairs night.
+
+use crate::logic::bracket::seed_order;
+use crate::logic::setup::start_tournament;
+use crate::models::{
+    Draw, DrawMode, PairMetric, Player, PlayerId, Tournament, TournamentError, TournamentFormat,
+    TournamentState,
+};
+use rand::rngs::StdRng;
+use rand::seq::SliceRandom;
+use rand::SeedableRng;
+
+/// How to draw a knockout bracket when the tournament starts.
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq)]
+pub struct DrawSettings {
+    pub mode: DrawMode,
+    /// Protected draws: how many top seeds keep their seeded positions.
+    pub protected_seeds: usize,
+    /// Seed for the shuffle, to repeat an earlier draw; a fresh one is picked when None.
+    pub seed: Option<u64>,
+    /// Balanced draws: what players are ranked by.
+    pub balance_by: PairMetric,
+}
+
+/// Start a single- or double-elimination tournament with the given draw. A random or
+/// protected draw is recorded on the tournament (with the seed it used); seeded is the same
+/// as [`start_tournament`]. A balanced draw first pairs the people entered into teams (see
+/// [`balanced_pair_draw`]), in any format; teams already drawn (a restarted tournament keeps
+/// them) are started as they are.
+pub fn start_with_draw(
+    tournament: &mut Tournament,
+    settings: DrawSettings,
+) -> Result<(), TournamentError> {
+    match settings.mode {
+        DrawMode::Seeded => return start_tournament(tournament),
+        DrawMode::Balanced => return start_balanced(tournament, settings),
+        DrawMode::Random | DrawMode::Protected => {}
+    }
+    let knockout = matches!(
+        tournament.format,
+        TournamentFormat::SingleElimination | TournamentFormat::DoubleElimination
+    );
+    if tournament.state != TournamentState::Setup || !knockout {
+        return Err(TournamentError::InvalidState);
+    }
+    let protected_seeds = match settings.mode {
+        DrawMode::Protected => settings.protected_seeds,
+        _ => 0,
+    };
+    let max = tournament.players.len();
+    if settings.mode == DrawMode::Protected && !(1..=max).contains(&protected_seeds) {
+        return Err(TournamentError::InvalidProtectedSeeds { max });
+    }
+    tournament.draw = Some(Draw {
+        mode: settings.mode,
+        protected_seeds,
+        balance_by: None,
+        seed: settings.seed.unwrap_or_else(rand::random),
+    });
+    let started = start_tournament(tournament);
+    if started.is_err() {
+        tournament.draw = None;
+    }
+    started
+}
+
+/// Bracket order of a draw: `order[i]` takes seed position `i + 1`. The protected top seeds
+/// keep their own positions and everyone else is shuffled by a generator seeded with
+/// `draw.seed`, so repeating a draw gives the same order.
+pub fn draw_order(players: &[Player], draw: &Draw) -> Vec<PlayerId> {
+    let mut order = seed_order(players);
+    let kept = match draw.mode {
+        DrawMode::Seeded | DrawMode::Balanced => return order,
+        DrawMode::Random => 0,
+        DrawMode::Protected => draw.protected_seeds.min(order.len()),
+    };
+    let mut rng = StdRng::seed_from_u64(draw.seed);
+    order[kept..].shuffle(&mut rng);
+    order
+}
+
+fn start_balanced(
+    tournament: &mut Tournament,
+    settings: DrawSettings,
+) -> Result<(), TournamentError> {
+    if tournament.state != TournamentState::Setup || !tournament.draws_pairs() {
+        return Err(TournamentError::InvalidState);
+    }
+    if tournament.players.iter().all(|p| !p.members.is_empty()) {
+        return start_tournament(tournament);
+    }
+    let seed = settings.seed.unwrap_or_else(rand::random);
+    let pairs = balanced_pair_draw(&tournament.players, settings.balance_by, seed)?;
+    let people = std::mem::take(&mut tournament.players);
+    let person = |id: PlayerId| people.iter().find(|p| p.id == id);
+    for (i, [a, b]) in pairs.into_iter().enumerate() {
+        let (Some(a), Some(b)) = (person(a), person(b)) else {
+            continue;
+        };
+        let mut team = Player::new(format!("{} & {}", a.name, b.name));
+        team.members = vec![a.name.clone(), b.name.clone()];
+        team.seed = i as u32 + 1;
+        team.rating = (a.rating + b.rating) / 2.0;
+        tournament.players.push(team);
+    }
+    tournament.draw = Some(Draw {
+        mode: DrawMode::Balanced,
+        protected_seeds: 0,
+        balance_by: Some(settings.balance_by),
+        seed,
+    });
+    let started = start_tournament(tournament);
+    if started.is_err() {
+        tournament.players = people;
+        tournament.draw = None;
+    }
+    started
+}
+
+/// A player's recorded strength by `metric`: None before their first scored visit (average)
+/// or rated result (rating).
+fn strength(player: &Player, metric: PairMetric) -> Option<f64> {
+    match metric {
+        PairMetric::Average => (player.darts_thrown > 0).then(|| player.three_dart_average()),
+        PairMetric::Rating => (!player.rating_history.is_empty()).then_some(player.rating),
+    }
+}
+
+/// Split the draw for a pairs night: `players` ranked by `metric` (those with nothing
+/// recorded after everyone else, in seed order), the top half each drawn a partner from the
+/// bottom half at random, so no team has two of the strongest or two of the weakest. Teams
+/// come strongest member first, in ranking order. The same players and `seed` always give
+/// the same teams.
+pub fn balanced_pair_draw(
+    players: &[Player],
+    metric: PairMetric,
+    seed: u64,
+) -> Result<Vec<[PlayerId; 2]>, TournamentError> {
+    if players.len() % 2 == 1 {
+        return Err(TournamentError::OddPlayerCount);
+    }
+    let mut ranked: Vec<&Player> = players.iter().collect();
+    ranked.sort_by(|a, b| {
+        let by_strength = match (strength(a, metric), strength(b, metric)) {
+            (Some(x), Some(y)) => y.total_cmp(&x),
+            (a, b) => b.is_some().cmp(&a.is_some()),
+        };
+        by_strength.then(a.seed.cmp(&b.seed))
+    });
+    let (top, bottom) = ranked.split_at(ranked.len() / 2);
+    let mut bottom = bottom.to_vec();
+    bottom.shuffle(&mut StdRng::seed_from_u64(seed));
+    Ok(top.iter().zip(bottom).map(|(a, b)| [a.id, b.id]).collect())
+}
+
+/// Before a balanced draw: give each person entered their scored visits and latest rating
+/// from `history` (other tournaments, matched by name), so the draw can rank them by what
+/// they have done before. Their own entries are replaced by teams once the draw is made, so
+/// nothing carried over is counted twice.
+pub fn carry_form(tournament: &mut Tournament, history: &[Tournament]) {
+    if tournament.state != TournamentState::Setup || !tournament.draws_pairs() {
+        return;
+    }
+    let id = tournament.id;
+    for person in tournament.players.iter_mut() {
+        let mut earlier: Vec<(&Tournament, &Player)> = history
+            .iter()
+            .filter(|t| t.id != id)
+            .filter_map(|t| {
+                let p = t
+                    .all_players()
+                    .into_iter()
+                    .find(|p| p.name.eq_ignore_ascii_case(&person.name))?;
+                Some((t, p))
+            })
+            .collect();
+        earlier.sort_by_key(|(t, _)| t.created_at);
+        for (_, p) in &earlier {
+            person.points_scored += p.points_scored;
+            person.darts_thrown += p.darts_thrown;
+        }
+        if let Some((_, latest)) = earlier.last() {
+            person.rating = latest.rating;
+            person.rating_history = latest.rating_history.clone();
+        }
+    }
+}
@@ -4,6 +4,7 @@ use crate::models::{
     GameMatch, MatchId, PlayerId, RoundType, Team, Tournament, TournamentError, TournamentMode,
     TournamentState,
 };
+use crate::rating::rate_result;
 use rand::seq::SliceRandom;
 
 /// Generate semi-final matches: 4 players (1v1) → 2 matches of 1v1; 8 players (2v2) → 2 matches of 2v2. Seeds randomly.
@@ -56,10 +57,11 @@ pub fn set_finals_match_winner(
     Ok(())
 }
 
-/// Apply win/loss for a single playoff match to player stats.
+/// Apply win/loss and rating for a single playoff match to player stats.
 /// Takes team ids and winner so we don't hold a reference into tournament while mutating it.
 fn apply_playoff_match_result(
     tournament: &mut Tournament,
+    match_id: MatchId,
     team_1: &[PlayerId],
     team_2: &[PlayerId],
     winner: Team,
@@ -68,17 +70,13 @@ fn apply_playoff_match_result(
         Team::One => (team_1, team_2),
         Team::Two => (team_2, team_1),
     };
+    rate_result(tournament, match_id, winner_ids, loser_ids);
+    tournament.activity.match_completed();
     for &pid in loser_ids {
-        tournament
-            .get_player_mut_any(pid)
-            .ok_or(TournamentError::PlayerNotFound(pid))?
-            .add_loss();
+        tournament.add_loss(pid)?;
     }
     for &pid in winner_ids {
-        tournament
-            .get_player_mut_any(pid)
-            .ok_or(TournamentError::PlayerNotFound(pid))?
-            .add_win();
+        tournament.add_win(pid)?;
     }
     Ok(())
 }
@@ -103,14 +101,15 @@ pub fn process_semi_final_results(tournament: &mut Tournament) -> Result<(), Tou
         .iter()
         .map(|m| {
             (
+                m.id,
                 m.team_1.clone(),
                 m.team_2.clone(),
                 tournament.final_match_results[&m.id],
             )
         })
         .collect();
-    for (team_1, team_2, w) in match_data {
-        apply_playoff_match_result(tournament, &team_1, &team_2, w)?;
+    for (match_id, team_1, team_2, w) in match_data {
+        apply_playoff_match_result(tournament, match_id, &team_1, &team_2, w)?;
     }
 
     tournament.bracket_semi_final_players = Some(tournament.players.clone());
@@ -160,6 +159,7 @@ pub fn process_finals_results(tournament: &mut Tournament) -> Result<(), Tournam
     if tournament.matches.len() != 1 {
         return Err(TournamentError::InvalidState);
     }
+    let match_id = tournament.matches[0].id;
     let team_1 = tournament.matches[0].team_1.clone();
     let team_2 = tournament.matches[0].team_2.clone();
     let w = tournament
@@ -168,7 +168,7 @@ pub fn process_finals_results(tournament: &mut Tournament) -> Result<(), Tournam
         .copied()
         .ok_or(TournamentError::IncompleteResults)?;
 
-    apply_playoff_match_result(tournament, &team_1, &team_2, w)?;
+    apply_playoff_match_result(tournament, match_id, &team_1, &team_2, w)?;
 
     tournament.bracket_finals_match = Some(tournament.matches[0].clone());
     tournament.bracket_finals_result = Some(w);
@@ -1,9 +1,10 @@
 //! Group stage: match generation and result processing.
 
 use crate::models::{
-    GameMatch, Player, PlayerId, RoundType, Tournament, TournamentError, TournamentMode,
+    GameMatch, MatchId, Player, PlayerId, RoundType, Tournament, TournamentError, TournamentMode,
     TournamentState,
 };
+use crate::rating::rate_result;
 use crate::Team;
 use rand::seq::SliceRandom;
 use rand::Rng;
@@ -44,10 +45,16 @@ pub fn generate_group_play_matches(tournament: &mut Tournament) -> Result<(), To
     let n = available.len();
     let excess = n % excess_mod;
 
-    let mut unused: Vec<Player> = available.drain(0..excess).collect();
-    for p in &mut unused {
-        p.record_sat_out();
+    // Record sit-outs on the tournament's players, then snapshot them, so the counters have a
+    // single source and never need copying back.
+    let sitting_out: Vec<PlayerId> = available.drain(0..excess).map(|p| p.id).collect();
+    for &id in &sitting_out {
+        tournament.record_sat_out(id)?;
     }
+    let unused: Vec<Player> = sitting_out
+        .iter()
+        .filter_map(|&id| tournament.players.iter().find(|p| p.id == id).cloned())
+        .collect();
 
     available.shuffle(&mut rng);
 
@@ -65,13 +72,6 @@ pub fn generate_group_play_matches(tournament: &mut Tournament) -> Result<(), To
         })
         .collect();
 
-    for p in &unused {
-        if let Some(t) = tournament.players.iter_mut().find(|t| t.id == p.id) {
-            t.times_sat_out = p.times_sat_out;
-            t.internal_times_sat_out = p.internal_times_sat_out;
-        }
-    }
-
     tournament.matches = matches;
     tournament.unused_players = unused;
     tournament.match_results.clear();
@@ -98,17 +98,18 @@ pub fn process_group_play_results(tournament: &mut Tournament) -> Result<(), Tou
     tournament.last_eliminated_players.clear();
 
     let max_losses = tournament.max_losses;
-    let match_data: Vec<(Vec<PlayerId>, Vec<PlayerId>, Team)> = tournament
+    let match_data: Vec<(MatchId, Vec<PlayerId>, Vec<PlayerId>, Team)> = tournament
         .matches
         .iter()
         .map(|m| {
             let w = tournament.match_results[&m.id];
-            (m.team_1.clone(), m.team_2.clone(), w)
+            (m.id, m.team_1.clone(), m.team_2.clone(), w)
         })
         .collect();
 
-    for (team_1, team_2, winner) in match_data {
-        let eliminated = apply_match_result(tournament, &team_1, &team_2, winner, max_losses)?;
+    for (match_id, team_1, team_2, winner) in match_data {
+        let eliminated =
+            apply_match_result(tournament, match_id, &team_1, &team_2, winner, max_losses)?;
         tournament.last_eliminated_players.extend(eliminated);
     }
 
@@ -131,55 +132,33 @@ pub fn process_group_play_results(tournament: &mut Tournament) -> Result<(), Tou
     Ok(())
 }
 
-/// Apply a single match result: add wins/losses, mark eliminated if at max losses.
+/// Apply a single match result: update ratings, add wins/losses, mark eliminated if at max losses.
 /// Returns clones of players that were eliminated this match.
 fn apply_match_result(
     tournament: &mut Tournament,
+    match_id: MatchId,
     team_1: &[PlayerId],
     team_2: &[PlayerId],
     winner: Team,
     max_losses: u32,
 ) -> Result<Vec<Player>, TournamentError> {
     let mut eliminated = Vec::new();
-
-    match winner {
-        Team::One => {
-            for &pid in team_2 {
-                let p = tournament
-                    .get_player_mut(pid)
-                    .ok_or(TournamentError::PlayerNotFound(pid))?;
-                p.add_loss();
-                if p.losses >= max_losses {
-                    p.eliminate();
-                    eliminated.push(p.clone());
-                }
-            }
-            for &pid in team_1 {
-                tournament
-                    .get_player_mut(pid)
-                    .ok_or(TournamentError::PlayerNotFound(pid))?
-                    .add_win();
-            }
-        }
-        Team::Two => {
-            for &pid in team_1 {
-                let p = tournament
-                    .get_player_mut(pid)
-                    .ok_or(TournamentError::PlayerNotFound(pid))?;
-                p.add_loss();
-                if p.losses >= max_losses {
-                    p.eliminate();
-                    eliminated.push(p.clone());
-                }
-            }
-            for &pid in team_2 {
-                tournament
-                    .get_player_mut(pid)
-                    .ok_or(TournamentError::PlayerNotFound(pid))?
-                    .add_win();
-            }
+    let (winners, losers) = match winner {
+        Team::One => (team_1, team_2),
+        Team::Two => (team_2, team_1),
+    };
+    rate_result(tournament, match_id, winners, losers);
+    tournament.activity.match_completed();
+    for &pid in losers {
+        let p = tournament.add_loss(pid)?;
+        if p.losses >= max_losses {
+            p.eliminate();
+            eliminated.push(p.clone());
         }
     }
+    for &pid in winners {
+        tournament.add_win(pid)?;
+    }
 
     Ok(eliminated)
 }
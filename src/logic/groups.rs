@@ -0,0 +1,282 @@
+//! Groups then knockout: round-robin groups drawn by seed, then the top players of each group
+//! in a single-elimination bracket.
+//!
+//! The group matches are the tournament's bracket while the groups are played, so they are
+//! recorded, scored, undone and put on boards like any round-robin match. Drawing the knockout
+//! moves them to the group stage, after which they can no longer change.
+
+use crate::logic::boards::schedule_boards;
+use crate::logic::bracket::{generate_single_elim_bracket, seed_positions};
+use crate::logic::round_robin::{generate_round_robin, sit_out_match};
+use crate::logic::standings::{compute_standings, GroupStanding};
+use crate::models::{
+    Bracket, BracketMatch, Group, GroupStage, MatchId, Player, PlayerId, Tournament,
+    TournamentError, TournamentFormat, TournamentMode, TournamentState,
+};
+
+/// How a groups-then-knockout tournament is drawn.
+#[derive(Clone, Copy, Debug, Eq, PartialEq)]
+pub struct GroupSettings {
+    pub group_count: usize,
+    /// Players from each group that go through to the knockout.
+    pub advance_per_group: usize,
+}
+
+impl GroupSettings {
+    /// Groups of about four, the top two of each going through.
+    pub fn default_for(players: usize) -> Self {
+        GroupSettings {
+            group_count: (players / 4).max(2),
+            advance_per_group: 2,
+        }
+    }
+}
+
+/// Start a groups-then-knockout tournament with the given settings (see
+/// [`crate::start_tournament`], which uses [`GroupSettings::default_for`]).
+///
+/// Players are drawn into groups in snake order by seed (A, B, C, then C, B, A, ...), so
+/// group sizes differ by at most one and every group gets a spread of seeds.
+pub fn start_groups_knockout(
+    tournament: &mut Tournament,
+    settings: GroupSettings,
+) -> Result<(), TournamentError> {
+    if tournament.state != TournamentState::Setup
+        || tournament.format != TournamentFormat::GroupsKnockout
+    {
+        return Err(TournamentError::InvalidState);
+    }
+    if tournament.mode != TournamentMode::OneVOne {
+        return Err(TournamentError::UnsupportedMode);
+    }
+    let required = tournament.players_required_to_start();
+    if tournament.players.len() < required {
+        return Err(TournamentError::NotEnoughPlayersToStart { required });
+    }
+    tournament.compact_seeds();
+    let bracket = draw_groups(tournament, settings)?;
+    tournament.bracket = Some(bracket);
+    tournament.state = TournamentState::BracketPlay;
+    schedule_boards(tournament);
+    Ok(())
+}
+
+/// Draw the groups and return their matches, round by round across groups, as one bracket.
+/// Sit-outs in odd-sized groups are byes and are recorded on the player.
+pub(crate) fn draw_groups(
+    tournament: &mut Tournament,
+    settings: GroupSettings,
+) -> Result<Bracket, TournamentError> {
+    let n = tournament.players.len();
+    let GroupSettings {
+        group_count,
+        advance_per_group,
+    } = settings;
+    if group_count < 2 || group_count > n / 2 {
+        return Err(TournamentError::InvalidGroupCount { max: n / 2 });
+    }
+    let smallest = n / group_count;
+    if advance_per_group < 1 || advance_per_group > smallest {
+        return Err(TournamentError::InvalidAdvanceCount { max: smallest });
+    }
+
+    let mut by_seed: Vec<&Player> = tournament.players.iter().collect();
+    by_seed.sort_by_key(|p| p.seed);
+    let mut groups: Vec<Group> = (0..group_count)
+        .map(|i| Group {
+            name: group_name(i),
+            players: Vec::new(),
+        })
+        .collect();
+    for (i, p) in by_seed.into_iter().enumerate() {
+        let (row, column) = (i / group_count, i % group_count);
+        let g = if row % 2 == 0 {
+            column
+        } else {
+            group_count - 1 - column
+        };
+        groups[g].players.push(p.id);
+    }
+
+    let mut rounds: Vec<Vec<BracketMatch>> = Vec::new();
+    let mut sat_out: Vec<PlayerId> = Vec::new();
+    for group in &groups {
+        let mut members = players_in(tournament, &group.players);
+        for (r, round) in generate_round_robin(&mut members)?.into_iter().enumerate() {
+            if rounds.len() <= r {
+                rounds.push(Vec::new());
+            }
+            rounds[r].extend(round.matches);
+            if let Some(id) = round.sat_out {
+                // Numbered with the rest of the round below.
+                rounds[r].push(sit_out_match(round.round, 0, id));
+                sat_out.push(id);
+            }
+        }
+    }
+    for id in sat_out {
+        tournament.record_sat_out(id)?;
+    }
+    let mut bracket = Bracket::default();
+    for round in rounds {
+        for (i, mut m) in round.into_iter().enumerate() {
+            m.number = i as u32 + 1;
+            bracket.matches.push(m);
+        }
+    }
+    tournament.group_stage = Some(GroupStage {
+        groups,
+        advance_per_group,
+        matches: Vec::new(),
+        knockout_started: false,
+    });
+    Ok(bracket)
+}
+
+/// Standings of every group, in group order. Available once the groups are drawn; after the
+/// knockout starts they are final.
+pub fn group_standings(
+    tournament: &Tournament,
+) -> Result<Vec<(&Group, Vec<GroupStanding>)>, TournamentError> {
+    let stage = tournament
+        .group_stage
+        .as_ref()
+        .ok_or(TournamentError::InvalidState)?;
+    let matches = match (&tournament.bracket, stage.knockout_started) {
+        (_, true) => &stage.matches,
+        (Some(bracket), false) => &bracket.matches,
+        (None, false) => return Err(TournamentError::InvalidState),
+    };
+    Ok(stage
+        .groups
+        .iter()
+        .map(|g| {
+            let members: Vec<Player> = players_in(tournament, &g.players);
+            (g, compute_standings(&members, matches))
+        })
+        .collect())
+}
+
+/// Draw the knockout once every group match has a result: the top `advance_per_group` of each
+/// group go through, everyone else is eliminated.
+///
+/// Knockout seeds go by group rank first (all group winners, then all runners-up, ...). Within
+/// a rank the groups run forwards or backwards, whichever keeps more first-round matches
+/// between different groups, so a group winner meets another group's runner-up.
+pub fn advance_to_knockout(tournament: &mut Tournament) -> Result<(), TournamentError> {
+    let stage = tournament
+        .group_stage
+        .as_ref()
+        .filter(|s| !s.knockout_started)
+        .ok_or(TournamentError::InvalidState)?;
+    if tournament.format != TournamentFormat::GroupsKnockout
+        || tournament.state != TournamentState::BracketPlay
+    {
+        return Err(TournamentError::InvalidState);
+    }
+    if !tournament.bracket.as_ref().is_some_and(|b| b.is_complete()) {
+        return Err(TournamentError::IncompleteResults);
+    }
+    let advance = stage.advance_per_group;
+    let size = (advance * stage.groups.len()).next_power_of_two();
+    let ranked: Vec<(usize, Vec<PlayerId>)> = group_standings(tournament)?
+        .into_iter()
+        .enumerate()
+        .map(|(g, (_, standings))| {
+            let top = standings.iter().take(advance).map(|s| s.player).collect();
+            (g, top)
+        })
+        .collect();
+
+    let mut seeded: Vec<(PlayerId, usize)> = ranked.iter().map(|(g, top)| (top[0], *g)).collect();
+    for rank in 1..advance {
+        let forward: Vec<(PlayerId, usize)> =
+            ranked.iter().map(|(g, top)| (top[rank], *g)).collect();
+        let backward: Vec<(PlayerId, usize)> = forward.iter().rev().copied().collect();
+        let fewer = [forward, backward]
+            .into_iter()
+            .min_by_key(|next| {
+                let mut candidate = seeded.clone();
+                candidate.extend(next);
+                same_group_pairings(&candidate, size)
+            })
+            .expect("two candidates");
+        seeded.extend(fewer);
+    }
+
+    let mut knockout: Vec<Player> = players_in(
+        tournament,
+        &seeded.iter().map(|(id, _)| *id).collect::<Vec<_>>(),
+    );
+    for (i, p) in knockout.iter_mut().enumerate() {
+        p.seed = i as u32 + 1;
+    }
+    let bracket = generate_single_elim_bracket(&knockout)?;
+    for p in &mut tournament.players {
+        if !seeded.iter().any(|(id, _)| *id == p.id) {
+            p.eliminate();
+        }
+    }
+    let group_matches = tournament
+        .bracket
+        .replace(bracket)
+        .map(|b| b.matches)
+        .unwrap_or_default();
+    if let Some(stage) = &mut tournament.group_stage {
+        stage.matches = group_matches;
+        stage.knockout_started = true;
+    }
+    schedule_boards(tournament);
+    Ok(())
+}
+
+/// Whether `match_id` is a group match that can no longer change because the knockout has
+/// been drawn.
+pub(crate) fn is_locked_group_match(tournament: &Tournament, match_id: MatchId) -> bool {
+    tournament
+        .group_stage
+        .as_ref()
+        .is_some_and(|s| s.knockout_started && s.matches.iter().any(|m| m.id == match_id))
+}
+
+/// Losses a player had in the group stage (0 before the knockout is drawn).
+pub(crate) fn group_losses(tournament: &Tournament, player: PlayerId) -> u32 {
+    tournament.group_stage.as_ref().map_or(0, |s| {
+        s.matches
+            .iter()
+            .filter(|m| m.loser_id() == Some(player))
+            .count() as u32
+    })
+}
+
+/// First-round matches between players of the same group in a knockout of `size`, for
+/// `seeded` (player, group) in seed order; seeds not placed yet count as byes.
+fn same_group_pairings(seeded: &[(PlayerId, usize)], size: usize) -> usize {
+    let positions = seed_positions(size);
+    positions
+        .chunks(2)
+        .filter(
+            |pair| match (seeded.get(pair[0] - 1), seeded.get(pair[1] - 1)) {
+                (Some(a), Some(b)) => a.1 == b.1,
+                _ => false,
+            },
+        )
+        .count()
+}
+
+/// Copies of the given players, in the given order.
+fn players_in(tournament: &Tournament, ids: &[PlayerId]) -> Vec<Player> {
+    ids.iter()
+        .filter_map(|id| tournament.players.iter().find(|p| p.id == *id))
+        .cloned()
+        .collect()
+}
+
+/// "A", "B", ..., "Z", "AA", "AB", ...
+fn group_name(index: usize) -> String {
+    let letter = |i: usize| char::from(b'A' + (i % 26) as u8);
+    match index / 26 {
+        0 => letter(index).to_string(),
+        n => format!("{}{}", letter(n - 1), letter(index)),
+    }
+}
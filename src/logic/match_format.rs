@@ -0,0 +1,130 @@
+//! Per-round match formats: which format applies to a match, and changing the formats.
+
+use crate::logic::scoring::DEFAULT_BEST_OF;
+use crate::models::{
+    Bracket, BracketMatch, BracketSection, KnockoutStage, LegScore, MatchFormats, MatchId, Team,
+    Tournament, TournamentError, TournamentFormat, TournamentState,
+};
+use crate::scoring::MatchFormat;
+
+/// Where a match sits: its round number (bracket formats) and knockout stage, if any.
+type Position = (Option<u32>, Option<KnockoutStage>);
+
+/// Replace the tournament's match formats. Every format must be valid, and a round that
+/// already has completed matches can't change the format it was played over. Matches being
+/// scored keep the format they started with.
+pub fn set_match_formats(
+    tournament: &mut Tournament,
+    formats: MatchFormats,
+) -> Result<(), TournamentError> {
+    if formats.rounds.contains_key(&0) || formats.iter().any(|f| f.validate().is_err()) {
+        return Err(TournamentError::InvalidMatchFormat);
+    }
+    let old = &tournament.match_formats;
+    let changed = |&(round, stage): &Position| old.get(round, stage) != formats.get(round, stage);
+    if completed_positions(tournament).iter().any(changed) {
+        return Err(TournamentError::MatchFormatLocked);
+    }
+    tournament.match_formats = formats;
+    Ok(())
+}
+
+/// Format a match is played over: the one set for its round, or best-of-3 legs.
+pub fn match_format(tournament: &Tournament, match_id: MatchId) -> MatchFormat {
+    configured_format(tournament, match_id).unwrap_or(MatchFormat::best_of_legs(DEFAULT_BEST_OF))
+}
+
+/// Format set for a match's round, if any.
+pub(crate) fn configured_format(tournament: &Tournament, match_id: MatchId) -> Option<MatchFormat> {
+    let (round, stage) = position(tournament, match_id)?;
+    tournament.match_formats.get(round, stage)
+}
+
+/// A reported score must be a finished match in `format`: the winner reached the legs (or
+/// sets) needed and the loser didn't.
+pub(crate) fn check_result_score(
+    format: MatchFormat,
+    score: LegScore,
+    winner: Team,
+) -> Result<(), TournamentError> {
+    let to_win = format.sets.unwrap_or(format.legs) / 2 + 1;
+    if score.get(winner) != to_win || score.get(winner.other()) >= to_win {
+        return Err(TournamentError::InvalidScore);
+    }
+    Ok(())
+}
+
+fn position(tournament: &Tournament, match_id: MatchId) -> Option<Position> {
+    if let Some(bracket) = &tournament.bracket {
+        if let Some(m) = bracket.get(match_id) {
+            return Some(bracket_position(tournament, bracket, m));
+        }
+    }
+    // Group-play format: only the semi-finals and the final have a format of their own.
+    tournament.matches.iter().find(|m| m.id == match_id)?;
+    Some((None, elimination_stage(tournament.state)))
+}
+
+fn bracket_position(tournament: &Tournament, bracket: &Bracket, m: &BracketMatch) -> Position {
+    let knockout = match tournament.format {
+        TournamentFormat::SingleElimination | TournamentFormat::DoubleElimination => true,
+        TournamentFormat::GroupsKnockout => tournament
+            .group_stage
+            .as_ref()
+            .is_some_and(|s| s.knockout_started),
+        _ => false,
+    };
+    let rounds = bracket.round_count();
+    let stage = match m.section {
+        _ if !knockout => None,
+        BracketSection::GrandFinal => Some(KnockoutStage::Final),
+        // The double-elimination winners bracket leads into the grand final, not a final.
+        _ if tournament.format == TournamentFormat::DoubleElimination => None,
+        BracketSection::Winners if m.round == rounds => Some(KnockoutStage::Final),
+        BracketSection::Winners if m.round + 1 == rounds => Some(KnockoutStage::SemiFinal),
+        _ => None,
+    };
+    (Some(m.round), stage)
+}
+
+fn elimination_stage(state: TournamentState) -> Option<KnockoutStage> {
+    match state {
+        TournamentState::SemiFinals => Some(KnockoutStage::SemiFinal),
+        TournamentState::Finals => Some(KnockoutStage::Final),
+        _ => None,
+    }
+}
+
+/// Where every completed match sits, including group matches of a drawn knockout and the
+/// group-play format's decided semi-finals and final.
+fn completed_positions(tournament: &Tournament) -> Vec<Position> {
+    let mut positions: Vec<Position> = Vec::new();
+    if let Some(bracket) = &tournament.bracket {
+        positions.extend(
+            bracket
+                .matches
+                .iter()
+                .filter(|m| !m.bye && m.winner.is_some())
+                .map(|m| bracket_position(tournament, bracket, m)),
+        );
+    }
+    if let Some(stage) = &tournament.group_stage {
+        positions.extend(
+            stage
+                .matches
+                .iter()
+                .filter(|m| !m.bye && m.winner.is_some())
+                .map(|m| (Some(m.round), None)),
+        );
+    }
+    if tournament.bracket_semi_final_results.is_some() {
+        positions.push((None, Some(KnockoutStage::SemiFinal)));
+    }
+    if tournament.bracket_finals_result.is_some() {
+        positions.push((None, Some(KnockoutStage::Final)));
+    }
+    if !tournament.final_match_results.is_empty() {
+        positions.extend(elimination_stage(tournament.state).map(|stage| (None, Some(stage))));
+    }
+    positions
+}
@@ -1,14 +1,52 @@
 //! Tournament business logic: setup, group play, finals, etc.
 
+mod boards;
+mod bracket;
+mod draw;
 mod final_selection;
 mod finals;
 mod group_play;
+mod groups;
+mod match_format;
+mod placements;
+mod plate;
+mod round_robin;
+mod scoring;
+mod seeding;
 mod setup;
+mod standings;
+mod swiss;
+mod timing;
+mod undo;
+mod walkover;
 
+pub use boards::{next_matches, numbered_boards, set_boards};
+pub use bracket::{
+    generate_double_elim_bracket, generate_single_elim_bracket, record_bracket_result,
+    seed_positions,
+};
+pub use draw::{balanced_pair_draw, carry_form, draw_order, start_with_draw, DrawSettings};
 pub use final_selection::{add_players_back_from_last_eliminated, start_semi_finals};
 pub use finals::{
     generate_semi_final_matches, process_finals_results, process_semi_final_results,
     set_finals_match_winner,
 };
 pub use group_play::{generate_group_play_matches, process_group_play_results};
+pub use groups::{advance_to_knockout, group_standings, start_groups_knockout, GroupSettings};
+pub use match_format::{match_format, set_match_formats};
+pub use placements::{final_placements, finish_tournament};
+pub use round_robin::{generate_round_robin, RoundRobinRound};
+pub use scoring::{record_cricket_visit, record_match_visit, DEFAULT_BEST_OF};
+pub use seeding::reseed_by_stats;
 pub use setup::start_tournament;
+pub use standings::{compute_standings, round_robin_standings, GroupStanding};
+pub use swiss::{
+    pair_swiss_round, start_next_swiss_round, swiss_opponents, swiss_standings, PlayerStanding,
+    SwissRound,
+};
+pub use timing::{
+    estimated_finish, start_match, timing_report, MatchTiming, RoundTiming, TimingReport,
+    ASSUMED_MATCH_MINUTES, ROLLING_MATCHES,
+};
+pub use undo::undo_last_action;
+pub use walkover::{record_walkover, withdraw_player};
@@ -0,0 +1,170 @@
+//! Final placements of a completed tournament, and finishing (archiving) it.
+//!
+//! Knockouts place players by the round they went out in: everyone knocked out in the same
+//! round shares a place. In double elimination that is the round of the second loss, so the
+//! losers-final loser is third, the loser of the round before it fourth, and so on. A plate
+//! doesn't change anyone's place: its players all went out in the first round. Round robin
+//! and Swiss use their standings; the group-play format places the finalists and semi-final
+//! losers, then everyone else together.
+
+use crate::logic::groups::group_standings;
+use crate::logic::standings::round_robin_standings;
+use crate::logic::swiss::swiss_standings;
+use crate::models::{
+    Bracket, BracketSection, GameMatch, Placement, PlayerId, Team, Tournament, TournamentError,
+    TournamentFormat, TournamentState,
+};
+use chrono::Utc;
+use std::collections::HashMap;
+
+/// Placements of a completed tournament, best first.
+pub fn final_placements(tournament: &Tournament) -> Result<Vec<Placement>, TournamentError> {
+    if tournament.state != TournamentState::Completed {
+        return Err(TournamentError::InvalidState);
+    }
+    let tiers = match tournament.format {
+        TournamentFormat::SingleElimination | TournamentFormat::DoubleElimination => {
+            knockout_tiers(bracket(tournament)?)
+        }
+        TournamentFormat::GroupsKnockout => {
+            let mut tiers = knockout_tiers(bracket(tournament)?);
+            tiers.extend(group_tiers(tournament)?);
+            tiers
+        }
+        TournamentFormat::RoundRobin => round_robin_standings(tournament)?
+            .into_iter()
+            .map(|s| vec![s.player])
+            .collect(),
+        TournamentFormat::Swiss => swiss_standings(tournament)
+            .into_iter()
+            .map(|s| vec![s.player])
+            .collect(),
+        TournamentFormat::Elimination => playoff_tiers(tournament),
+    };
+    let mut placements = Vec::new();
+    for tier in tiers {
+        let place = placements.len() as u32 + 1;
+        placements.extend(tier.into_iter().map(|player| Placement { player, place }));
+    }
+    Ok(placements)
+}
+
+/// Finish a completed tournament: record its placements and freeze it. After this the
+/// registry rejects every change with [`TournamentError::TournamentFinished`].
+pub fn finish_tournament(tournament: &mut Tournament) -> Result<(), TournamentError> {
+    if tournament.finished_at.is_some() {
+        return Err(TournamentError::TournamentFinished);
+    }
+    tournament.placements = final_placements(tournament)?;
+    tournament.finished_at = Some(Utc::now());
+    Ok(())
+}
+
+fn bracket(tournament: &Tournament) -> Result<&Bracket, TournamentError> {
+    tournament
+        .bracket
+        .as_ref()
+        .ok_or(TournamentError::InvalidState)
+}
+
+/// The champion, then everyone else grouped by the round they went out in, latest first.
+/// A player goes out in the furthest match they lost (grand final, then losers rounds, then
+/// winners rounds).
+fn knockout_tiers(bracket: &Bracket) -> Vec<Vec<PlayerId>> {
+    let Some(champion) = bracket.champion() else {
+        return Vec::new();
+    };
+    let mut out_in: HashMap<PlayerId, (u8, u32)> = HashMap::new();
+    for m in bracket
+        .matches
+        .iter()
+        .filter(|m| !m.bye && m.section != BracketSection::Plate)
+    {
+        let Some(loser) = m.loser_id().filter(|p| *p != champion) else {
+            continue;
+        };
+        let depth = (section_depth(m.section), m.round);
+        let furthest = out_in.entry(loser).or_insert(depth);
+        *furthest = (*furthest).max(depth);
+    }
+    let mut by_round: Vec<((u8, u32), PlayerId)> =
+        out_in.into_iter().map(|(p, depth)| (depth, p)).collect();
+    by_round.sort_by(|a, b| b.0.cmp(&a.0));
+
+    let mut tiers = vec![vec![champion]];
+    let mut last = None;
+    for (depth, player) in by_round {
+        match tiers.last_mut() {
+            Some(tier) if last == Some(depth) => tier.push(player),
+            _ => tiers.push(vec![player]),
+        }
+        last = Some(depth);
+    }
+    tiers
+}
+
+fn section_depth(section: BracketSection) -> u8 {
+    match section {
+        BracketSection::Winners => 0,
+        BracketSection::Losers => 1,
+        BracketSection::GrandFinal => 2,
+        BracketSection::Plate => unreachable!("plate matches don't place anyone"),
+    }
+}
+
+/// Groups then knockout: players who didn't advance, by group rank (every group's first
+/// non-qualifier together, then the next, ...).
+fn group_tiers(tournament: &Tournament) -> Result<Vec<Vec<PlayerId>>, TournamentError> {
+    let advance = tournament
+        .group_stage
+        .as_ref()
+        .map_or(0, |s| s.advance_per_group);
+    let mut tiers: Vec<Vec<PlayerId>> = Vec::new();
+    for (_, standings) in group_standings(tournament)? {
+        for (i, s) in standings.iter().skip(advance).enumerate() {
+            if tiers.len() <= i {
+                tiers.push(Vec::new());
+            }
+            tiers[i].push(s.player);
+        }
+    }
+    Ok(tiers)
+}
+
+/// Group-play format: final winners, final losers, semi-final losers, then everyone else.
+fn playoff_tiers(tournament: &Tournament) -> Vec<Vec<PlayerId>> {
+    let side = |m: &GameMatch, team: Team| match team {
+        Team::One => m.team_1.clone(),
+        Team::Two => m.team_2.clone(),
+    };
+    let mut tiers: Vec<Vec<PlayerId>> = Vec::new();
+    if let (Some(m), Some(winner)) = (
+        &tournament.bracket_finals_match,
+        tournament.bracket_finals_result,
+    ) {
+        tiers.push(side(m, winner));
+        tiers.push(side(m, winner.other()));
+    }
+    let semi_losers: Vec<PlayerId> = tournament
+        .bracket_semi_final_matches
+        .iter()
+        .flatten()
+        .filter_map(|m| {
+            let winner = tournament.bracket_semi_final_results.as_ref()?.get(&m.id)?;
+            Some(side(m, winner.other()))
+        })
+        .flatten()
+        .collect();
+    tiers.push(semi_losers);
+    let placed: Vec<PlayerId> = tiers.iter().flatten().copied().collect();
+    tiers.push(
+        tournament
+            .all_players()
+            .into_iter()
+            .map(|p| p.id)
+            .filter(|id| !placed.contains(id))
+            .collect(),
+    );
+    tiers.retain(|tier| !tier.is_empty());
+    tiers
+}
@@ -0,0 +1,92 @@
+//! The plate: a knockout of its own for the first-round losers of a single-elimination
+//! tournament, so nobody makes the trip to play one match.
+//!
+//! The plate goes into the same bracket, its matches in [`BracketSection::Plate`]. It is drawn
+//! when the last first-round match of the main draw is decided (walkovers included) and not
+//! again after that: later results leave it alone. The losers are placed by their seeds, byes
+//! going to the top plate seeds when they don't fill a power of two; a loser who has withdrawn
+//! isn't entered. With fewer than two losers to enter there is no plate.
+//!
+//! Taking back a first-round result takes the plate down with it while no plate match has been
+//! decided or scored, and it is drawn afresh once the round is complete again. After that the
+//! first round is locked, as a match is once the one it feeds has started.
+//!
+//! Plate results count in the tournament like any other (wins, losses, rating, scoring
+//! stats), and winners have them in [`Player::plate_wins`](crate::models::Player) as well, so
+//! records can tell them apart. The plate plays no part in placements.
+
+use crate::logic::bracket::single_elim_bracket;
+use crate::models::{
+    Bracket, BracketMatch, BracketSection, Player, PlayerId, Tournament, TournamentError,
+    TournamentFormat,
+};
+use std::collections::HashSet;
+
+/// Whether results of `m` decide who is in the plate.
+pub(crate) fn feeds_plate(tournament: &Tournament, m: &BracketMatch) -> bool {
+    tournament.plate
+        && tournament.format == TournamentFormat::SingleElimination
+        && m.section == BracketSection::Winners
+        && m.round == 1
+}
+
+/// Draw the plate if it is due: the tournament has one, it isn't drawn yet, and every
+/// first-round match of the main draw has a result.
+pub(crate) fn draw_plate(tournament: &mut Tournament) -> Result<(), TournamentError> {
+    if !tournament.plate || tournament.format != TournamentFormat::SingleElimination {
+        return Ok(());
+    }
+    let Some(bracket) = &tournament.bracket else {
+        return Ok(());
+    };
+    if bracket.has_plate() || bracket.round(1).any(|m| m.winner.is_none()) {
+        return Ok(());
+    }
+    let mut losers: Vec<&Player> = bracket
+        .round(1)
+        .filter(|m| !m.bye)
+        .filter_map(|m| m.loser_id())
+        .filter_map(|id| tournament.find_player(id))
+        .filter(|p| !p.withdrawn)
+        .collect();
+    if losers.len() < 2 {
+        return Ok(());
+    }
+    losers.sort_by_key(|p| p.seed);
+    let order: Vec<PlayerId> = losers.iter().map(|p| p.id).collect();
+    let mut plate = single_elim_bracket(&order)?;
+    for m in &mut plate.matches {
+        m.section = BracketSection::Plate;
+    }
+    if let Some(bracket) = tournament.bracket.as_mut() {
+        bracket.matches.extend(plate.matches);
+    }
+    Ok(())
+}
+
+/// Whether a plate match has been decided or had visits scored.
+pub(crate) fn plate_started(tournament: &Tournament, bracket: &Bracket) -> bool {
+    bracket
+        .matches
+        .iter()
+        .filter(|m| m.section == BracketSection::Plate && !m.bye)
+        .any(|m| m.winner.is_some() || tournament.has_visits(m.id))
+}
+
+/// Take the plate down (a first-round result is being taken back; the caller has checked no
+/// plate match has started).
+pub(crate) fn drop_plate(tournament: &mut Tournament) {
+    let Some(bracket) = tournament.bracket.as_mut() else {
+        return;
+    };
+    let dropped: HashSet<_> = bracket
+        .matches
+        .iter()
+        .filter(|m| m.section == BracketSection::Plate)
+        .map(|m| m.id)
+        .collect();
+    bracket.matches.retain(|m| !dropped.contains(&m.id));
+    tournament.scores.retain(|id, _| !dropped.contains(id));
+    tournament.cricket.retain(|id, _| !dropped.contains(id));
+    tournament.match_log.retain(|id, _| !dropped.contains(id));
+}
@@ -0,0 +1,77 @@
+//! Round-robin schedules (circle method) with at most one sit-out per round.
+
+use crate::models::{BracketMatch, Player, PlayerId, Team, TournamentError};
+
+/// One round of a round-robin schedule.
+#[derive(Clone, Debug, Eq, PartialEq)]
+pub struct RoundRobinRound {
+    /// 1-based round number.
+    pub round: u32,
+    pub matches: Vec<BracketMatch>,
+    /// Player without an opponent this round (odd player counts only).
+    pub sat_out: Option<PlayerId>,
+}
+
+/// Schedule every player against every other exactly once, ordering players by `seed`.
+///
+/// Uses the circle method: one player stays fixed and the rest rotate one place per round.
+/// With an odd count a placeholder is added and whoever meets it sits out; each player
+/// meets the placeholder exactly once, so nobody sits out twice before everyone has sat out once.
+/// Each sit-out is recorded on the player. The same input always yields the same fixtures.
+pub fn generate_round_robin(
+    players: &mut [Player],
+) -> Result<Vec<RoundRobinRound>, TournamentError> {
+    if players.len() < 2 {
+        return Err(TournamentError::NotEnoughPlayersToStart { required: 2 });
+    }
+    let mut order: Vec<usize> = (0..players.len()).collect();
+    order.sort_by_key(|&i| players[i].seed);
+    let mut circle: Vec<Option<PlayerId>> = order.iter().map(|&i| Some(players[i].id)).collect();
+    if circle.len() % 2 == 1 {
+        circle.push(None);
+    }
+
+    let n = circle.len();
+    let mut rounds = Vec::with_capacity(n - 1);
+    for r in 0..n - 1 {
+        let round = r as u32 + 1;
+        let mut matches = Vec::with_capacity(n / 2);
+        let mut sat_out = None;
+        for i in 0..n / 2 {
+            match (circle[i], circle[n - 1 - i]) {
+                (Some(a), Some(b)) => {
+                    let mut m = BracketMatch::new(round, matches.len() as u32 + 1);
+                    m.team_1 = Some(a);
+                    m.team_2 = Some(b);
+                    matches.push(m);
+                }
+                (Some(p), None) | (None, Some(p)) => sat_out = Some(p),
+                (None, None) => {}
+            }
+        }
+        rounds.push(RoundRobinRound {
+            round,
+            matches,
+            sat_out,
+        });
+        circle[1..].rotate_right(1);
+    }
+
+    for r in &rounds {
+        if let Some(id) = r.sat_out {
+            if let Some(p) = players.iter_mut().find(|p| p.id == id) {
+                p.record_sat_out();
+            }
+        }
+    }
+    Ok(rounds)
+}
+
+/// Bracket entry for a sit-out: a bye match with the player on side one.
+pub(crate) fn sit_out_match(round: u32, number: u32, player: PlayerId) -> BracketMatch {
+    let mut m = BracketMatch::new(round, number);
+    m.team_1 = Some(player);
+    m.bye = true;
+    m.winner = Some(Team::One);
+    m
+}
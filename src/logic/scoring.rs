@@ -0,0 +1,286 @@
+//! Visit-by-visit scoring of tournament matches, as x01 or cricket. Winning the scored match
+//! records its result.
+
+use crate::handicap::match_handicaps;
+use crate::logic::bracket::record_bracket_result;
+use crate::logic::match_format::match_format;
+use crate::models::{
+    LegScore, MatchAction, MatchId, PlayerId, Team, Tournament, TournamentError, TournamentState,
+};
+use crate::scoring::{
+    CricketDart, CricketMatch, GameType, ScoringError, VisitOutcome, X01Match, START_SCORE,
+};
+use std::collections::hash_map::Entry;
+
+/// Legs per match when scoring starts without a configured format.
+pub const DEFAULT_BEST_OF: u32 = 3;
+
+/// Record a visit for `team` in a match of the current round or bracket, starting a 501 match
+/// in the format set for its round (best-of-3 legs by default) on the first visit.
+///
+/// `darts_at_double` is how many of the darts were aimed at a finishing double; it feeds the
+/// checkout percentage. Visit stats go to the thrower when the side is a single player (2v2
+/// visits can't be split between partners, so they are not credited). The match takes the
+/// players' handicaps when it starts; a handicapped match credits no visit stats at all.
+///
+/// When the visit wins the match, its result is recorded like a manual one: bracket matches go
+/// through [`record_bracket_result`] with the leg (or set) score; group play and final-round matches get
+/// their winner selected, ready for submit. A match with cricket visits can't take x01 ones.
+pub fn record_match_visit(
+    tournament: &mut Tournament,
+    match_id: MatchId,
+    team: Team,
+    score: u32,
+    darts: u32,
+    double_out: bool,
+    darts_at_double: u32,
+) -> Result<(), TournamentError> {
+    let (in_bracket, thrower) = scoring_target(tournament, match_id, team)?;
+    claim_game(tournament, match_id, GameType::X01)?;
+
+    let format = match_format(tournament, match_id);
+    let handicaps = match_handicaps(tournament, match_id);
+    let scored = match tournament.scores.entry(match_id) {
+        Entry::Occupied(e) => e.into_mut(),
+        Entry::Vacant(e) => e.insert(X01Match::with_handicaps(format, START_SCORE, handicaps)?),
+    };
+    let outcome = scored.record_visit(team, score, darts, double_out)?;
+    if let Some(visit) = scored.last_visit_mut() {
+        visit.player = thrower;
+    }
+    let winner = scored.winner;
+    let legs = scored.score();
+    let handicapped = scored.is_handicapped();
+
+    let highest_checkout_before = thrower
+        .and_then(|id| tournament.find_player(id))
+        .map_or(0, |p| p.highest_checkout);
+    tournament
+        .match_log
+        .entry(match_id)
+        .or_default()
+        .push(MatchAction::Visit {
+            team,
+            thrower,
+            darts_at_double,
+            highest_checkout_before,
+        });
+    tournament.activity.visit(match outcome {
+        VisitOutcome::Bust => 0,
+        _ => score,
+    });
+    let credited = thrower.filter(|_| !handicapped);
+    if let Some(player) = credited.and_then(|id| tournament.get_player_mut_any(id)) {
+        match outcome {
+            VisitOutcome::Checkout => {
+                player.record_visit_stats(score, darts);
+                player.record_checkout(score, darts_at_double);
+            }
+            VisitOutcome::Scored => {
+                player.record_visit_stats(score, darts);
+                player.record_missed_doubles(darts_at_double);
+            }
+            VisitOutcome::Bust => {
+                player.record_visit_stats(0, darts);
+                player.record_missed_doubles(darts_at_double);
+            }
+        }
+    }
+
+    match winner {
+        Some(winner) => decide(tournament, match_id, in_bracket, winner, legs),
+        None => Ok(()),
+    }
+}
+
+/// Record a cricket visit for `team`, dart by dart, in a match of the current round or
+/// bracket. The first visit starts a cricket match over the legs set for its round (best-of-3
+/// by default; sets and handicaps are x01 only), cut-throat if `cut_throat` is set; later
+/// visits keep the variant the match started with. A match with x01 visits can't take cricket
+/// ones, nor the other way round.
+///
+/// Cricket visits credit no player stats, which are all x01 figures. Winning the match records
+/// its result as [`record_match_visit`] does.
+pub fn record_cricket_visit(
+    tournament: &mut Tournament,
+    match_id: MatchId,
+    team: Team,
+    darts: &[CricketDart],
+    cut_throat: bool,
+) -> Result<(), TournamentError> {
+    let (in_bracket, thrower) = scoring_target(tournament, match_id, team)?;
+    claim_game(tournament, match_id, GameType::Cricket)?;
+
+    let format = match_format(tournament, match_id);
+    let scored = match tournament.cricket.entry(match_id) {
+        Entry::Occupied(e) => e.into_mut(),
+        Entry::Vacant(e) => e.insert(CricketMatch::new(format.legs, cut_throat)?),
+    };
+    scored.record_visit(team, darts)?;
+    if let Some(visit) = scored.last_visit_mut() {
+        visit.player = thrower;
+    }
+    let winner = scored.winner;
+    let legs = scored.legs_won;
+
+    tournament
+        .match_log
+        .entry(match_id)
+        .or_default()
+        .push(MatchAction::CricketVisit { team, thrower });
+    tournament.activity.visit(0);
+    match winner {
+        Some(winner) => decide(tournament, match_id, in_bracket, winner, legs),
+        None => Ok(()),
+    }
+}
+
+/// Whether `match_id` is a bracket match (ready to be played) rather than one of the current
+/// round, and the player throwing for `team` when that side is one player.
+fn scoring_target(
+    tournament: &Tournament,
+    match_id: MatchId,
+    team: Team,
+) -> Result<(bool, Option<PlayerId>), TournamentError> {
+    match tournament.bracket.as_ref().and_then(|b| b.get(match_id)) {
+        Some(m) if !m.is_ready() => Err(TournamentError::MatchNotReady),
+        Some(m) => Ok((true, m.player(team))),
+        None => match tournament.matches.iter().find(|m| m.id == match_id) {
+            Some(m) => Ok((false, single_player(m.team(team)))),
+            None => Err(TournamentError::MatchNotFound(match_id)),
+        },
+    }
+}
+
+/// Score `match_id` as `game`: refused once the other game has visits in it; a score of the
+/// other game with none left (all undone) is dropped.
+fn claim_game(
+    tournament: &mut Tournament,
+    match_id: MatchId,
+    game: GameType,
+) -> Result<(), TournamentError> {
+    let other_started = match game {
+        GameType::X01 => tournament.cricket.get(&match_id).map(|c| c.has_visits()),
+        GameType::Cricket => tournament
+            .scores
+            .get(&match_id)
+            .map(|s| s.legs.iter().any(|l| !l.visits.is_empty())),
+    };
+    match other_started {
+        Some(true) => Err(ScoringError::WrongGameType.into()),
+        Some(false) => {
+            tournament.scores.remove(&match_id);
+            tournament.cricket.remove(&match_id);
+            Ok(())
+        }
+        None => Ok(()),
+    }
+}
+
+/// Record the winner of a scored match like a manual result: bracket matches go through
+/// [`record_bracket_result`] with the leg (or set) score; group play and final-round matches
+/// get their winner selected, ready for submit.
+fn decide(
+    tournament: &mut Tournament,
+    match_id: MatchId,
+    in_bracket: bool,
+    winner: Team,
+    legs: LegScore,
+) -> Result<(), TournamentError> {
+    if in_bracket {
+        let player = tournament
+            .bracket
+            .as_ref()
+            .and_then(|b| b.get(match_id))
+            .and_then(|m| m.player(winner))
+            .ok_or(TournamentError::MatchNotReady)?;
+        return record_bracket_result(tournament, match_id, player, Some(legs), false);
+    }
+    match tournament.state {
+        TournamentState::GroupPlay => tournament.match_results.insert(match_id, winner),
+        TournamentState::SemiFinals | TournamentState::Finals => {
+            tournament.final_match_results.insert(match_id, winner)
+        }
+        _ => return Err(TournamentError::InvalidState),
+    };
+    Ok(())
+}
+
+/// Take back the last visit of a match (the last logged action on it), including the stats it
+/// credited to `thrower`. A visit that decided a group play or final-round match also clears
+/// that match's selected winner; a decided bracket match must have its result undone first.
+pub(crate) fn undo_match_visit(
+    tournament: &mut Tournament,
+    match_id: MatchId,
+    thrower: Option<PlayerId>,
+    darts_at_double: u32,
+    highest_checkout_before: u32,
+) -> Result<(), TournamentError> {
+    check_undo(tournament, match_id)?;
+    let scored = tournament
+        .scores
+        .get_mut(&match_id)
+        .ok_or(TournamentError::NothingToUndo)?;
+    let decided = scored.winner.is_some();
+    let handicapped = scored.is_handicapped();
+    let visit = scored.undo_visit().ok_or(TournamentError::NothingToUndo)?;
+
+    let credited = thrower.filter(|_| !handicapped);
+    if let Some(player) = credited.and_then(|id| tournament.get_player_mut_any(id)) {
+        player.remove_visit_stats(visit.score, visit.darts);
+        match visit.outcome {
+            VisitOutcome::Checkout => {
+                player.remove_checkout(darts_at_double, highest_checkout_before)
+            }
+            VisitOutcome::Scored | VisitOutcome::Bust => {
+                player.remove_missed_doubles(darts_at_double)
+            }
+        }
+    }
+    if decided {
+        tournament.match_results.remove(&match_id);
+        tournament.final_match_results.remove(&match_id);
+    }
+    Ok(())
+}
+
+/// Take back the last cricket visit of a match (the last logged action on it). As with x01, a
+/// visit that decided a group play or final-round match also clears its selected winner.
+pub(crate) fn undo_cricket_visit(
+    tournament: &mut Tournament,
+    match_id: MatchId,
+) -> Result<(), TournamentError> {
+    check_undo(tournament, match_id)?;
+    let scored = tournament
+        .cricket
+        .get_mut(&match_id)
+        .ok_or(TournamentError::NothingToUndo)?;
+    let decided = scored.winner.is_some();
+    scored.undo_visit().ok_or(TournamentError::NothingToUndo)?;
+    if decided {
+        tournament.match_results.remove(&match_id);
+        tournament.final_match_results.remove(&match_id);
+    }
+    Ok(())
+}
+
+/// Whether a visit of `match_id` can still be taken back: not once a bracket result is on it.
+fn check_undo(tournament: &Tournament, match_id: MatchId) -> Result<(), TournamentError> {
+    match tournament.bracket.as_ref().and_then(|b| b.get(match_id)) {
+        Some(m) if m.winner.is_some() => Err(TournamentError::ResultAlreadyRecorded),
+        Some(_) => Ok(()),
+        // Group play and final-round visits can only be taken back until the round is submitted.
+        None if !tournament.matches.iter().any(|m| m.id == match_id) => {
+            Err(TournamentError::MatchNotFound(match_id))
+        }
+        None => Ok(()),
+    }
+}
+
+/// The only player on a side, if the side is one player.
+fn single_player(team: &[PlayerId]) -> Option<PlayerId> {
+    match team {
+        [id] => Some(*id),
+        _ => None,
+    }
+}
@@ -0,0 +1,29 @@
+//! Performance-based seeding from player stats.
+
+use crate::models::Player;
+
+/// Reassign seeds 1..N by win percentage, then three-dart average, then current seed.
+///
+/// Players without a game rank below everyone who has played. Useful for seeding an event
+/// from the results of the previous one; the slice order is left as it is.
+pub fn reseed_by_stats(players: &mut [Player]) {
+    let mut order: Vec<usize> = (0..players.len()).collect();
+    order.sort_by(|&a, &b| {
+        let (a, b) = (&players[a], &players[b]);
+        win_percentage(b)
+            .total_cmp(&win_percentage(a))
+            .then(b.three_dart_average().total_cmp(&a.three_dart_average()))
+            .then(a.seed.cmp(&b.seed))
+    });
+    for (seed, i) in (1..).zip(order) {
+        players[i].seed = seed;
+    }
+}
+
+/// Wins as a fraction of games played; -1 for players with no games so they sort last.
+fn win_percentage(p: &Player) -> f64 {
+    match p.wins + p.losses {
+        0 => -1.0,
+        games => f64::from(p.wins) / f64::from(games),
+    }
+}
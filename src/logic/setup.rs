@@ -1,8 +1,11 @@
-//! Setup phase: start tournament (transition from Setup to GroupPlay or FinalSelection).
+//! Setup phase: start tournament (transition from Setup to GroupPlay, FinalSelection, or BracketPlay).
 
-use crate::models::{Tournament, TournamentError, TournamentState};
+use crate::logic::bracket::start_bracket;
+use crate::models::{Tournament, TournamentError, TournamentFormat, TournamentState};
 
 /// Start the tournament: require 4 players (1v1) or 8 (2v2); set state to GroupPlay if above threshold else FinalSelection.
+/// Bracket formats need 2 players (groups then knockout: 4, drawn with the default group
+/// settings) and go straight to BracketPlay.
 pub fn start_tournament(tournament: &mut Tournament) -> Result<(), TournamentError> {
     if tournament.state != TournamentState::Setup {
         return Err(TournamentError::InvalidState);
@@ -11,6 +14,9 @@ pub fn start_tournament(tournament: &mut Tournament) -> Result<(), TournamentErr
     if tournament.players.len() < required {
         return Err(TournamentError::NotEnoughPlayersToStart { required });
     }
+    if tournament.format != TournamentFormat::Elimination {
+        return start_bracket(tournament);
+    }
     tournament.state = if tournament.players.len() > required {
         TournamentState::GroupPlay
     } else {
@@ -0,0 +1,154 @@
+//! Round-robin standings, worked out from the recorded results every time so they can't drift
+//! from them.
+//!
+//! Order: most wins. Players level on wins are separated by their results against each other:
+//! two players by the match between them; three or more by a mini-table of only the matches
+//! among themselves, applied again to anyone still level. When that can't separate them (three
+//! or more who beat each other in a circle, or two who haven't met yet) the order falls back to
+//! leg difference over all matches, then seed.
+//!
+//! A walkover counts as a win and a loss here, with no legs, even when the tournament leaves
+//! walkovers out of players' win totals: everyone due to meet a withdrawn player gets the same
+//! from it. Results voided by a
+//! [`withdraw_player`](crate::withdraw_player) count for nothing.
+
+use crate::models::{
+    BracketMatch, Player, PlayerId, ResultType, Team, Tournament, TournamentError, TournamentFormat,
+};
+use std::collections::HashMap;
+
+/// One row of a standings table.
+#[derive(Clone, Debug, Eq, PartialEq)]
+pub struct GroupStanding {
+    pub player: PlayerId,
+    pub seed: u32,
+    pub played: u32,
+    pub wins: u32,
+    pub losses: u32,
+    /// Legs won and lost, from matches recorded with a leg score.
+    pub legs_for: u32,
+    pub legs_against: u32,
+}
+
+impl GroupStanding {
+    /// Legs won minus legs lost.
+    pub fn leg_difference(&self) -> i64 {
+        i64::from(self.legs_for) - i64::from(self.legs_against)
+    }
+}
+
+/// Standings of `players` from the decided matches in `matches` (byes, undecided and void
+/// matches are skipped), best first.
+pub fn compute_standings(players: &[Player], matches: &[BracketMatch]) -> Vec<GroupStanding> {
+    let decided: Vec<&BracketMatch> = matches
+        .iter()
+        .filter(|m| !m.bye && m.result_type != ResultType::Void)
+        .filter(|m| m.winner_id().is_some() && m.loser_id().is_some())
+        .collect();
+    let mut rows: HashMap<PlayerId, GroupStanding> = players
+        .iter()
+        .map(|p| {
+            let row = GroupStanding {
+                player: p.id,
+                seed: p.seed,
+                played: 0,
+                wins: 0,
+                losses: 0,
+                legs_for: 0,
+                legs_against: 0,
+            };
+            (p.id, row)
+        })
+        .collect();
+    for m in &decided {
+        for (id, won) in [(m.winner_id(), true), (m.loser_id(), false)] {
+            let Some(row) = id.and_then(|id| rows.get_mut(&id)) else {
+                continue;
+            };
+            row.played += 1;
+            if won {
+                row.wins += 1;
+            } else {
+                row.losses += 1;
+            }
+            if let (Some(score), Some(side)) = (m.score, m.side_of(row.player)) {
+                let (own, other) = match side {
+                    Team::One => (score.team_1, score.team_2),
+                    Team::Two => (score.team_2, score.team_1),
+                };
+                row.legs_for += own;
+                row.legs_against += other;
+            }
+        }
+    }
+
+    let mut by_wins: Vec<GroupStanding> = rows.into_values().collect();
+    by_wins.sort_by(|a, b| b.wins.cmp(&a.wins).then(a.seed.cmp(&b.seed)));
+    let mut ordered = Vec::with_capacity(by_wins.len());
+    for level in chunk_by(by_wins, |s| s.wins) {
+        ordered.extend(break_tie(level, &decided));
+    }
+    ordered
+}
+
+/// Standings of a round-robin tournament (any state once it has started).
+pub fn round_robin_standings(
+    tournament: &Tournament,
+) -> Result<Vec<GroupStanding>, TournamentError> {
+    if tournament.format != TournamentFormat::RoundRobin {
+        return Err(TournamentError::InvalidState);
+    }
+    let bracket = tournament
+        .bracket
+        .as_ref()
+        .ok_or(TournamentError::InvalidState)?;
+    let players: Vec<Player> = tournament.all_players().into_iter().cloned().collect();
+    Ok(compute_standings(&players, &bracket.matches))
+}
+
+/// Order players level on wins by their results against each other (see the module docs).
+fn break_tie(tied: Vec<GroupStanding>, decided: &[&BracketMatch]) -> Vec<GroupStanding> {
+    if tied.len() < 2 {
+        return tied;
+    }
+    let wins_among = |id: PlayerId| {
+        decided
+            .iter()
+            .filter(|m| m.winner_id() == Some(id))
+            .filter(|m| {
+                m.loser_id()
+                    .is_some_and(|l| tied.iter().any(|s| s.player == l))
+            })
+            .count()
+    };
+    let mut mini: Vec<(usize, GroupStanding)> = tied
+        .iter()
+        .map(|s| (wins_among(s.player), s.clone()))
+        .collect();
+    if mini.iter().all(|(w, _)| *w == mini[0].0) {
+        let mut level: Vec<GroupStanding> = mini.into_iter().map(|(_, s)| s).collect();
+        level.sort_by(|a, b| {
+            b.leg_difference()
+                .cmp(&a.leg_difference())
+                .then(a.seed.cmp(&b.seed))
+        });
+        return level;
+    }
+    mini.sort_by(|a, b| b.0.cmp(&a.0).then(a.1.seed.cmp(&b.1.seed)));
+    chunk_by(mini, |(w, _)| *w)
+        .into_iter()
+        .flat_map(|level| break_tie(level.into_iter().map(|(_, s)| s).collect(), decided))
+        .collect()
+}
+
+/// Split a sorted list into runs with the same `key`.
+fn chunk_by<T, K: PartialEq>(items: Vec<T>, key: impl Fn(&T) -> K) -> Vec<Vec<T>> {
+    let mut runs: Vec<Vec<T>> = Vec::new();
+    for item in items {
+        match runs.last_mut() {
+            Some(run) if key(&run[0]) == key(&item) => run.push(item),
+            _ => runs.push(vec![item]),
+        }
+    }
+    runs
+}
@@ -0,0 +1,218 @@
+//! Swiss rounds: players on the same record meet, nobody meets twice, at most one bye each.
+
+use crate::logic::boards::schedule_boards;
+use crate::logic::round_robin::sit_out_match;
+use crate::logic::walkover::uncounted_walkover_wins;
+use crate::models::{
+    Bracket, BracketMatch, PlayerId, Tournament, TournamentError, TournamentFormat, TournamentState,
+};
+use std::collections::HashMap;
+
+/// A player's place in the Swiss standings.
+#[derive(Clone, Debug, Eq, PartialEq)]
+pub struct PlayerStanding {
+    pub player: PlayerId,
+    pub seed: u32,
+    /// Match wins plus byes and walkovers (both count as a win).
+    pub wins: u32,
+    /// Sum of the wins of everyone this player has played (tiebreaker).
+    pub buchholz: u32,
+    pub had_bye: bool,
+}
+
+/// One Swiss round: matches and the player with the bye, if any.
+#[derive(Clone, Debug, Eq, PartialEq)]
+pub struct SwissRound {
+    /// 1-based round number.
+    pub round: u32,
+    pub matches: Vec<BracketMatch>,
+    pub bye: Option<PlayerId>,
+}
+
+/// Standings from the tournament's players and bracket, ordered by wins, then Buchholz,
+/// then seed. Byes and walkovers count as wins.
+pub fn swiss_standings(tournament: &Tournament) -> Vec<PlayerStanding> {
+    let opponents = swiss_opponents(tournament.bracket.as_ref());
+    let walkovers = uncounted_walkover_wins(tournament);
+    let wins: HashMap<PlayerId, u32> = tournament
+        .players
+        .iter()
+        .map(|p| {
+            let walkovers = walkovers.get(&p.id).copied().unwrap_or(0);
+            (p.id, p.wins + p.times_sat_out + walkovers)
+        })
+        .collect();
+    let mut standings: Vec<PlayerStanding> = tournament
+        .players
+        .iter()
+        .map(|p| PlayerStanding {
+            player: p.id,
+            seed: p.seed,
+            wins: wins[&p.id],
+            buchholz: opponents
+                .get(&p.id)
+                .into_iter()
+                .flatten()
+                .map(|o| wins.get(o).copied().unwrap_or(0))
+                .sum(),
+            had_bye: p.times_sat_out > 0,
+        })
+        .collect();
+    sort_standings(&mut standings);
+    standings
+}
+
+/// Everyone each player has already played, from the bracket's decided and pending matches.
+pub fn swiss_opponents(bracket: Option<&Bracket>) -> HashMap<PlayerId, Vec<PlayerId>> {
+    let mut opponents: HashMap<PlayerId, Vec<PlayerId>> = HashMap::new();
+    for m in bracket.into_iter().flat_map(|b| &b.matches) {
+        if let (Some(a), Some(b)) = (m.team_1, m.team_2) {
+            opponents.entry(a).or_default().push(b);
+            opponents.entry(b).or_default().push(a);
+        }
+    }
+    opponents
+}
+
+/// Pair one Swiss round from `standings` (best first).
+///
+/// With an odd count the bye goes to the lowest-ranked player who hasn't had one. Players are
+/// then paired top down, each with the closest-ranked player they haven't met; when that leaves
+/// someone without a legal opponent, earlier pairings (and then the bye) are revisited, so a
+/// pairing is found whenever one exists, even if it has to cross score groups.
+pub fn pair_swiss_round(
+    standings: &[PlayerStanding],
+    previous: &HashMap<PlayerId, Vec<PlayerId>>,
+    round: u32,
+) -> Result<SwissRound, TournamentError> {
+    if standings.len() < 2 {
+        return Err(TournamentError::NotEnoughPlayersToStart { required: 2 });
+    }
+    let mut ordered = standings.to_vec();
+    sort_standings(&mut ordered);
+    let ids: Vec<PlayerId> = ordered.iter().map(|s| s.player).collect();
+    let met = |a: PlayerId, b: PlayerId| previous.get(&a).is_some_and(|o| o.contains(&b));
+
+    let bye_options: Vec<Option<PlayerId>> = match ids.len() % 2 {
+        0 => vec![None],
+        _ => ordered
+            .iter()
+            .rev()
+            .filter(|s| !s.had_bye)
+            .map(|s| Some(s.player))
+            .collect(),
+    };
+    for bye in bye_options {
+        let rest: Vec<PlayerId> = ids.iter().copied().filter(|&id| Some(id) != bye).collect();
+        if let Some(pairs) = pair_up(&rest, &met) {
+            let mut matches: Vec<BracketMatch> = pairs
+                .into_iter()
+                .zip(1..)
+                .map(|((a, b), number)| {
+                    let mut m = BracketMatch::new(round, number);
+                    m.team_1 = Some(a);
+                    m.team_2 = Some(b);
+                    m
+                })
+                .collect();
+            if let Some(id) = bye {
+                matches.push(sit_out_match(round, matches.len() as u32 + 1, id));
+            }
+            return Ok(SwissRound {
+                round,
+                matches,
+                bye,
+            });
+        }
+    }
+    Err(TournamentError::NoValidPairing)
+}
+
+/// Pair the next Swiss round once every match of the current one has a result. The bye is
+/// recorded as a sit-out on the player; withdrawn players aren't paired.
+pub fn start_next_swiss_round(tournament: &mut Tournament) -> Result<(), TournamentError> {
+    if tournament.format != TournamentFormat::Swiss
+        || tournament.state != TournamentState::BracketPlay
+    {
+        return Err(TournamentError::InvalidState);
+    }
+    let bracket = tournament
+        .bracket
+        .as_ref()
+        .ok_or(TournamentError::InvalidState)?;
+    if !bracket.is_complete() {
+        return Err(TournamentError::IncompleteResults);
+    }
+    let round = bracket.round_count() + 1;
+    if round > tournament.swiss_rounds {
+        return Err(TournamentError::InvalidState);
+    }
+    let standings: Vec<PlayerStanding> = swiss_standings(tournament)
+        .into_iter()
+        .filter(|s| {
+            tournament
+                .find_player(s.player)
+                .is_some_and(|p| !p.withdrawn)
+        })
+        .collect();
+    let next = pair_swiss_round(&standings, &swiss_opponents(Some(bracket)), round)?;
+    add_round(tournament, next)?;
+    schedule_boards(tournament);
+    Ok(())
+}
+
+/// Start a Swiss tournament: ceil(log2(n)) rounds, round 1 paired by seed.
+pub(crate) fn start_swiss(tournament: &mut Tournament) -> Result<(), TournamentError> {
+    let n = tournament.players.len() as u32;
+    tournament.swiss_rounds = n.next_power_of_two().trailing_zeros();
+    tournament.bracket = Some(Bracket::default());
+    let first = pair_swiss_round(&swiss_standings(tournament), &HashMap::new(), 1)?;
+    add_round(tournament, first)
+}
+
+fn add_round(tournament: &mut Tournament, round: SwissRound) -> Result<(), TournamentError> {
+    if let Some(id) = round.bye {
+        tournament.record_sat_out(id)?;
+    }
+    tournament
+        .bracket
+        .get_or_insert_with(Bracket::default)
+        .matches
+        .extend(round.matches);
+    Ok(())
+}
+
+fn sort_standings(standings: &mut [PlayerStanding]) {
+    standings.sort_by(|a, b| {
+        b.wins
+            .cmp(&a.wins)
+            .then(b.buchholz.cmp(&a.buchholz))
+            .then(a.seed.cmp(&b.seed))
+    });
+}
+
+/// Pair `players` in order, each with the first later player they haven't met; backtracks.
+fn pair_up(
+    players: &[PlayerId],
+    met: &impl Fn(PlayerId, PlayerId) -> bool,
+) -> Option<Vec<(PlayerId, PlayerId)>> {
+    let Some((&first, rest)) = players.split_first() else {
+        return Some(Vec::new());
+    };
+    for (i, &opponent) in rest.iter().enumerate() {
+        if met(first, opponent) {
+            continue;
+        }
+        let remaining: Vec<PlayerId> = rest
+            .iter()
+            .enumerate()
+            .filter(|&(j, _)| j != i)
+            .map(|(_, &id)| id)
+            .collect();
+        if let Some(mut pairs) = pair_up(&remaining, met) {
+            pairs.insert(0, (first, opponent));
+            return Some(pairs);
+        }
+    }
+    None
+}
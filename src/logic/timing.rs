@@ -0,0 +1,187 @@
+//! Match timing: how long matches take, which ones are running long, and when the bracket
+//! should be finished.
+//!
+//! A match's clock starts when it first gets a board (or is started by hand) and stops when
+//! its result is recorded. Matches recorded without ever being started have no duration, and
+//! neither do walkovers and void results, which would skew the averages.
+
+use crate::models::{BracketMatch, BracketSection, MatchId, Tournament, TournamentError};
+use chrono::{DateTime, Duration, Utc};
+use serde::Serialize;
+
+/// Completed matches the rolling average is taken over (the most recent ones).
+pub const ROLLING_MATCHES: usize = 8;
+
+/// Match length assumed until a timed match has finished.
+pub const ASSUMED_MATCH_MINUTES: i64 = 20;
+
+/// One match's clock.
+#[derive(Clone, Debug, Eq, PartialEq, Serialize)]
+pub struct MatchTiming {
+    pub match_id: MatchId,
+    pub section: BracketSection,
+    pub round: u32,
+    pub number: u32,
+    /// Board the match is on right now.
+    pub board: Option<String>,
+    pub started_at: Option<DateTime<Utc>>,
+    pub completed_at: Option<DateTime<Utc>>,
+    /// Start to result, or start to now while the match is being played.
+    pub duration_secs: Option<i64>,
+}
+
+/// Average length of one round's completed, timed matches.
+#[derive(Clone, Debug, Eq, PartialEq, Serialize)]
+pub struct RoundTiming {
+    pub section: BracketSection,
+    pub round: u32,
+    /// Timed matches completed in the round.
+    pub completed: usize,
+    /// None until one has completed.
+    pub average_secs: Option<i64>,
+}
+
+/// Timing of every bracket (and group) match, bracket order.
+#[derive(Clone, Debug, Eq, PartialEq, Serialize)]
+pub struct TimingReport {
+    pub matches: Vec<MatchTiming>,
+    pub rounds: Vec<RoundTiming>,
+    /// Matches being played for longer than the threshold, longest first.
+    pub slow: Vec<MatchTiming>,
+    /// Matches still to be played (byes excluded).
+    pub remaining: usize,
+    /// None once nothing is left to play.
+    pub estimated_finish: Option<DateTime<Utc>>,
+}
+
+/// Start a match's clock by hand (for venues without boards set up). The match must be ready
+/// and not yet decided; starting it again keeps the first start time.
+pub fn start_match(tournament: &mut Tournament, match_id: MatchId) -> Result<(), TournamentError> {
+    let m = tournament
+        .bracket
+        .as_mut()
+        .ok_or(TournamentError::InvalidState)?
+        .get_mut(match_id)
+        .ok_or(TournamentError::MatchNotFound(match_id))?;
+    if m.winner.is_some() {
+        return Err(TournamentError::ResultAlreadyRecorded);
+    }
+    if m.bye || !m.is_ready() {
+        return Err(TournamentError::MatchNotReady);
+    }
+    m.started_at.get_or_insert_with(Utc::now);
+    Ok(())
+}
+
+/// Timing of the tournament's matches as of `now`. A match being played for longer than
+/// `slow_after` is listed as slow.
+pub fn timing_report(
+    tournament: &Tournament,
+    now: DateTime<Utc>,
+    slow_after: Duration,
+) -> TimingReport {
+    let groups = tournament.group_stage.iter().flat_map(|s| &s.matches);
+    let bracket = tournament.bracket.iter().flat_map(|b| &b.matches);
+    let played: Vec<&BracketMatch> = groups.chain(bracket).filter(|m| !m.bye).collect();
+
+    let board = |id: MatchId| {
+        tournament
+            .boards
+            .iter()
+            .find(|b| b.match_id == Some(id))
+            .map(|b| b.name.clone())
+    };
+    let matches: Vec<MatchTiming> = played
+        .iter()
+        .map(|m| MatchTiming {
+            match_id: m.id,
+            section: m.section,
+            round: m.round,
+            number: m.number,
+            board: board(m.id),
+            started_at: m.started_at,
+            completed_at: m.completed_at,
+            duration_secs: m
+                .started_at
+                .map(|start| (m.completed_at.unwrap_or(now) - start).num_seconds()),
+        })
+        .collect();
+
+    let mut rounds: Vec<RoundTiming> = Vec::new();
+    for m in &played {
+        if !rounds
+            .iter()
+            .any(|r| r.section == m.section && r.round == m.round)
+        {
+            let durations: Vec<Duration> = played
+                .iter()
+                .filter(|o| o.section == m.section && o.round == m.round)
+                .filter_map(|o| o.duration())
+                .collect();
+            rounds.push(RoundTiming {
+                section: m.section,
+                round: m.round,
+                completed: durations.len(),
+                average_secs: average(&durations).map(|d| d.num_seconds()),
+            });
+        }
+    }
+
+    let mut slow: Vec<MatchTiming> = matches
+        .iter()
+        .filter(|m| m.completed_at.is_none())
+        .filter(|m| {
+            m.duration_secs
+                .is_some_and(|secs| secs > slow_after.num_seconds())
+        })
+        .cloned()
+        .collect();
+    slow.sort_by(|a, b| b.duration_secs.cmp(&a.duration_secs));
+
+    let mut timed: Vec<&BracketMatch> = played
+        .iter()
+        .copied()
+        .filter(|m| m.duration().is_some())
+        .collect();
+    timed.sort_by_key(|m| m.completed_at);
+    let recent: Vec<Duration> = timed
+        .iter()
+        .rev()
+        .take(ROLLING_MATCHES)
+        .filter_map(|m| m.duration())
+        .collect();
+    let remaining = played.iter().filter(|m| m.winner.is_none()).count();
+    TimingReport {
+        matches,
+        rounds,
+        slow,
+        remaining,
+        estimated_finish: estimated_finish(now, remaining, &recent, tournament.boards.len()),
+    }
+}
+
+/// When `remaining` matches will be done, played `boards` at a time (at least one) at the
+/// average length of `recent` matches: `now + remaining × average ÷ boards`. Before any
+/// match has finished, [`ASSUMED_MATCH_MINUTES`] stands in for the average. None when
+/// nothing is left to play.
+pub fn estimated_finish(
+    now: DateTime<Utc>,
+    remaining: usize,
+    recent: &[Duration],
+    boards: usize,
+) -> Option<DateTime<Utc>> {
+    if remaining == 0 {
+        return None;
+    }
+    let average = average(recent).unwrap_or(Duration::minutes(ASSUMED_MATCH_MINUTES));
+    let secs = average.num_seconds() * remaining as i64 / boards.max(1) as i64;
+    Some(now + Duration::seconds(secs))
+}
+
+fn average(durations: &[Duration]) -> Option<Duration> {
+    if durations.is_empty() {
+        return None;
+    }
+    let total: i64 = durations.iter().map(|d| d.num_seconds()).sum();
+    Some(Duration::seconds(total / durations.len() as i64))
+}
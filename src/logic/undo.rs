@@ -0,0 +1,44 @@
+//! Undo: take back the most recent logged change on a match, one step at a time.
+
+use crate::logic::bracket::undo_bracket_result;
+use crate::logic::scoring::{undo_cricket_visit, undo_match_visit};
+use crate::models::{MatchAction, MatchId, Tournament, TournamentError};
+
+/// Revert the last logged action on `match_id` and drop it from the log, returning it.
+///
+/// Actions come off newest first, so repeated undos walk back through the match: a result
+/// reached by scoring is undone first, then the deciding visit, then earlier visits.
+/// Nothing changes when the undo fails (e.g. the winner's next match has already started).
+pub fn undo_last_action(
+    tournament: &mut Tournament,
+    match_id: MatchId,
+) -> Result<MatchAction, TournamentError> {
+    let action = tournament
+        .match_log
+        .get(&match_id)
+        .and_then(|log| log.last())
+        .cloned()
+        .ok_or(TournamentError::NothingToUndo)?;
+    match action {
+        MatchAction::Result { replaced, .. } => {
+            undo_bracket_result(tournament, match_id, replaced)?
+        }
+        MatchAction::Visit {
+            thrower,
+            darts_at_double,
+            highest_checkout_before,
+            ..
+        } => undo_match_visit(
+            tournament,
+            match_id,
+            thrower,
+            darts_at_double,
+            highest_checkout_before,
+        )?,
+        MatchAction::CricketVisit { .. } => undo_cricket_visit(tournament, match_id)?,
+    }
+    if let Some(log) = tournament.match_log.get_mut(&match_id) {
+        log.pop();
+    }
+    Ok(action)
+}
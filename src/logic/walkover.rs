@@ -0,0 +1,209 @@
+//! Walkovers and withdrawals, for players who don't turn up or leave early.
+//!
+//! A walkover gives a match to the player who is there: they go through as if they had won,
+//! and the absent player takes the loss (so a knockout still puts them out). Nothing was
+//! played, so a walkover has no leg score, moves no ratings and doesn't count towards match
+//! length averages. The winner's win goes on their total only when the tournament's
+//! `walkover_counts_as_win` is set; standings tables count it as a win either way. Visits
+//! already scored in the match before the walkover stay in both players' scoring totals.
+//!
+//! A withdrawn player is out, and each of their remaining matches becomes a walkover as soon
+//! as their opponent is known. In round robin the withdrawal can void their results instead:
+//! every match of theirs, played or not, is marked void and the wins, losses and rating changes
+//! it gave either side are taken back, so the standings read as if they had never entered. The
+//! darts thrown in a voided match are not taken back: averages, 180s and checkouts are what was
+//! actually thrown, and shouldn't change because somebody else left.
+
+use crate::logic::boards::schedule_boards;
+use crate::logic::bracket::apply_result;
+use crate::logic::groups::is_locked_group_match;
+use crate::models::{
+    BracketMatch, MatchAction, MatchId, PlayerId, RecordedResult, ResultType, Team, Tournament,
+    TournamentError, TournamentFormat, TournamentState,
+};
+use crate::rating::revert_result;
+use std::collections::HashMap;
+
+/// Give a bracket match to the opponent of `absent`, who didn't turn up. The match must be
+/// ready and not yet decided. The walkover goes in the match's action log, so it can be undone
+/// like a result.
+pub fn record_walkover(
+    tournament: &mut Tournament,
+    match_id: MatchId,
+    absent: PlayerId,
+) -> Result<(), TournamentError> {
+    if tournament.state != TournamentState::BracketPlay {
+        return Err(TournamentError::InvalidState);
+    }
+    if is_locked_group_match(tournament, match_id) {
+        return Err(TournamentError::NextMatchAlreadyPlayed);
+    }
+    let m = tournament
+        .bracket
+        .as_ref()
+        .ok_or(TournamentError::InvalidState)?
+        .get(match_id)
+        .ok_or(TournamentError::MatchNotFound(match_id))?;
+    if m.winner.is_some() && !m.bye {
+        return Err(TournamentError::ResultAlreadyRecorded);
+    }
+    if m.bye || !m.is_ready() {
+        return Err(TournamentError::MatchNotReady);
+    }
+    let side = m
+        .side_of(absent)
+        .ok_or(TournamentError::NotInMatch(absent))?;
+    walkover(tournament, match_id, side.other())?;
+    resolve_withdrawals(tournament)?;
+    schedule_boards(tournament);
+    Ok(())
+}
+
+/// Withdraw `player` from a bracket tournament being played (see the module docs). With
+/// `void_results`, which only round robin allows, all their matches are voided rather than
+/// their remaining ones walked over.
+pub fn withdraw_player(
+    tournament: &mut Tournament,
+    player: PlayerId,
+    void_results: bool,
+) -> Result<(), TournamentError> {
+    if tournament.state != TournamentState::BracketPlay
+        || (void_results && tournament.format != TournamentFormat::RoundRobin)
+    {
+        return Err(TournamentError::InvalidState);
+    }
+    let p = tournament
+        .get_player_mut(player)
+        .ok_or(TournamentError::PlayerNotFound(player))?;
+    if p.withdrawn {
+        return Err(TournamentError::PlayerWithdrawn(player));
+    }
+    p.withdrawn = true;
+    p.eliminate();
+    resolve_withdrawals(tournament)?;
+    if void_results {
+        let theirs: Vec<MatchId> = tournament
+            .bracket
+            .iter()
+            .flat_map(|b| &b.matches)
+            .filter(|m| !m.bye && m.winner.is_some() && m.side_of(player).is_some())
+            .filter(|m| m.result_type != ResultType::Void)
+            .map(|m| m.id)
+            .collect();
+        for id in theirs {
+            void_result(tournament, id)?;
+        }
+    }
+    schedule_boards(tournament);
+    Ok(())
+}
+
+/// The withdrawn player in `m`, if either side has withdrawn.
+pub(crate) fn withdrawn_in(tournament: &Tournament, m: &BracketMatch) -> Option<PlayerId> {
+    [m.team_1, m.team_2]
+        .into_iter()
+        .flatten()
+        .find(|&id| tournament.find_player(id).is_some_and(|p| p.withdrawn))
+}
+
+/// Walk over every ready match with a withdrawn player, until none is left (a walkover can
+/// send a player into another one).
+pub(crate) fn resolve_withdrawals(tournament: &mut Tournament) -> Result<(), TournamentError> {
+    // Every result comes through here, so skip the scan of the bracket while nobody has left.
+    if !tournament.all_players().iter().any(|p| p.withdrawn) {
+        return Ok(());
+    }
+    loop {
+        let next = tournament
+            .bracket
+            .iter()
+            .flat_map(|b| &b.matches)
+            .find_map(|m| {
+                if m.bye || !m.is_ready() {
+                    return None;
+                }
+                let absent = withdrawn_in(tournament, m)?;
+                Some((m.id, m.side_of(absent)?.other()))
+            });
+        let Some((match_id, side)) = next else {
+            return Ok(());
+        };
+        walkover(tournament, match_id, side)?;
+    }
+}
+
+/// Wins from walkovers that aren't on the winners' totals (none when the tournament counts
+/// them), for tables that count every walkover.
+pub(crate) fn uncounted_walkover_wins(tournament: &Tournament) -> HashMap<PlayerId, u32> {
+    let mut wins = HashMap::new();
+    if tournament.walkover_counts_as_win {
+        return wins;
+    }
+    let walkovers = tournament
+        .bracket
+        .iter()
+        .flat_map(|b| &b.matches)
+        .filter(|m| m.result_type == ResultType::Walkover);
+    for winner in walkovers.filter_map(|m| m.winner_id()) {
+        *wins.entry(winner).or_insert(0) += 1;
+    }
+    wins
+}
+
+/// Decide a match as a walkover for `side` and log it.
+fn walkover(
+    tournament: &mut Tournament,
+    match_id: MatchId,
+    side: Team,
+) -> Result<(), TournamentError> {
+    apply_result(tournament, match_id, side, None, ResultType::Walkover)?;
+    tournament.activity.match_completed();
+    let winner = tournament
+        .bracket
+        .as_ref()
+        .and_then(|b| b.get(match_id))
+        .and_then(|m| m.winner_id())
+        .ok_or(TournamentError::MatchNotFound(match_id))?;
+    tournament
+        .match_log
+        .entry(match_id)
+        .or_default()
+        .push(MatchAction::Result {
+            result: RecordedResult {
+                winner,
+                score: None,
+                result_type: ResultType::Walkover,
+            },
+            replaced: None,
+        });
+    Ok(())
+}
+
+/// Mark a decided round-robin match void: the winner's win (if it counted), the loser's loss
+/// and both rating changes are taken back. The winner and score stay for the record.
+fn void_result(tournament: &mut Tournament, match_id: MatchId) -> Result<(), TournamentError> {
+    let counts_walkover = tournament.walkover_counts_as_win;
+    let m = tournament
+        .bracket
+        .as_mut()
+        .and_then(|b| b.get_mut(match_id))
+        .ok_or(TournamentError::MatchNotFound(match_id))?;
+    let (Some(winner), Some(loser)) = (m.winner_id(), m.loser_id()) else {
+        return Ok(());
+    };
+    let counted_win = m.result_type == ResultType::Played || counts_walkover;
+    m.result_type = ResultType::Void;
+    let p = tournament
+        .get_player_mut_any(winner)
+        .ok_or(TournamentError::PlayerNotFound(winner))?;
+    if counted_win {
+        p.remove_win();
+    }
+    revert_result(p, match_id);
+    let p = tournament
+        .get_player_mut_any(loser)
+        .ok_or(TournamentError::PlayerNotFound(loser))?;
+    p.remove_loss();
+    revert_result(p, match_id);
+    Ok(())
+}
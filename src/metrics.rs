@@ -0,0 +1,184 @@
+//! Prometheus metrics for the venue dashboard: request counts and latencies by route and
+//! status, and tournament activity, rendered in the text exposition format.
+//!
+//! Activity (matches completed, visits, 180s) is counted where the players' stats are updated,
+//! but on the tournament being changed rather than straight into the totals: the registry adds
+//! a tournament's counts to the totals only once its change is stored, so an operation that
+//! fails and is thrown away counts nothing. The totals are what was recorded: an undone visit
+//! or result stays counted, as Prometheus counters never go down.
+
+use std::collections::BTreeMap;
+use std::fmt::Write;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::Mutex;
+use std::time::Duration;
+
+/// Upper bounds (seconds) of the request latency buckets.
+pub const LATENCY_BUCKETS: [f64; 11] = [
+    0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0,
+];
+
+/// Route label for requests that matched no route, so unknown paths can't add series.
+pub const UNMATCHED_ROUTE: &str = "unmatched";
+
+/// Tournament activity: counted on a tournament by one operation, or the totals since start.
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq)]
+pub struct ActivityCounts {
+    pub matches_completed: u64,
+    pub visits_recorded: u64,
+    pub count_180s: u64,
+}
+
+impl ActivityCounts {
+    /// A match got its first result.
+    pub(crate) fn match_completed(&mut self) {
+        self.matches_completed += 1;
+    }
+
+    /// A visit of `score` was recorded (0 for a bust).
+    pub(crate) fn visit(&mut self, score: u32) {
+        self.visits_recorded += 1;
+        if score == 180 {
+            self.count_180s += 1;
+        }
+    }
+}
+
+static MATCHES_COMPLETED: AtomicU64 = AtomicU64::new(0);
+static VISITS_RECORDED: AtomicU64 = AtomicU64::new(0);
+static COUNT_180S: AtomicU64 = AtomicU64::new(0);
+
+/// Add a stored change's activity to the totals.
+pub(crate) fn add_activity(counts: ActivityCounts) {
+    MATCHES_COMPLETED.fetch_add(counts.matches_completed, Ordering::Relaxed);
+    VISITS_RECORDED.fetch_add(counts.visits_recorded, Ordering::Relaxed);
+    COUNT_180S.fetch_add(counts.count_180s, Ordering::Relaxed);
+}
+
+/// Activity totals since the process started.
+pub fn activity_totals() -> ActivityCounts {
+    ActivityCounts {
+        matches_completed: MATCHES_COMPLETED.load(Ordering::Relaxed),
+        visits_recorded: VISITS_RECORDED.load(Ordering::Relaxed),
+        count_180s: COUNT_180S.load(Ordering::Relaxed),
+    }
+}
+
+/// Latency histogram of one route and status.
+#[derive(Clone, Debug, Default)]
+struct Histogram {
+    /// Requests at or under each of [`LATENCY_BUCKETS`] (not cumulative).
+    buckets: [u64; LATENCY_BUCKETS.len()],
+    count: u64,
+    sum_secs: f64,
+}
+
+/// Request counts and latencies, by route pattern and status.
+#[derive(Debug, Default)]
+pub struct HttpMetrics {
+    requests: Mutex<BTreeMap<(String, u16), Histogram>>,
+}
+
+impl HttpMetrics {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Record one request to `route` (its pattern, e.g. `/api/tournaments/{id}`) answered with
+    /// `status` after `elapsed`.
+    pub fn observe(&self, route: &str, status: u16, elapsed: Duration) {
+        let secs = elapsed.as_secs_f64();
+        let mut requests = self.requests.lock().unwrap_or_else(|e| e.into_inner());
+        let h = requests.entry((route.to_string(), status)).or_default();
+        if let Some(i) = LATENCY_BUCKETS.iter().position(|&le| secs <= le) {
+            h.buckets[i] += 1;
+        }
+        h.count += 1;
+        h.sum_secs += secs;
+    }
+}
+
+/// Gauges read at scrape time.
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq)]
+pub struct Gauges {
+    /// Tournaments not yet finished.
+    pub active_tournaments: usize,
+}
+
+/// Every metric in the Prometheus text format.
+pub fn render(http: &HttpMetrics, gauges: Gauges) -> String {
+    let mut out = String::new();
+    let requests = http.requests.lock().unwrap_or_else(|e| e.into_inner());
+
+    header(
+        &mut out,
+        "dart_http_requests_total",
+        "counter",
+        "HTTP requests handled.",
+    );
+    for ((route, status), h) in requests.iter() {
+        let labels = format!("route=\"{}\",status=\"{}\"", escape(route), status);
+        let _ = writeln!(out, "dart_http_requests_total{{{}}} {}", labels, h.count);
+    }
+
+    let name = "dart_http_request_duration_seconds";
+    header(&mut out, name, "histogram", "HTTP request latency.");
+    for ((route, status), h) in requests.iter() {
+        let labels = format!("route=\"{}\",status=\"{}\"", escape(route), status);
+        let mut cumulative = 0;
+        for (le, n) in LATENCY_BUCKETS.iter().zip(h.buckets) {
+            cumulative += n;
+            let _ = writeln!(out, "{name}_bucket{{{labels},le=\"{le}\"}} {cumulative}");
+        }
+        let _ = writeln!(out, "{name}_bucket{{{labels},le=\"+Inf\"}} {}", h.count);
+        let _ = writeln!(out, "{name}_sum{{{labels}}} {}", h.sum_secs);
+        let _ = writeln!(out, "{name}_count{{{labels}}} {}", h.count);
+    }
+    drop(requests);
+
+    let totals = activity_totals();
+    let rows: [(&str, &str, &str, u64); 4] = [
+        (
+            "dart_active_tournaments",
+            "gauge",
+            "Tournaments not yet finished.",
+            gauges.active_tournaments as u64,
+        ),
+        (
+            "dart_matches_completed_total",
+            "counter",
+            "Matches given a result.",
+            totals.matches_completed,
+        ),
+        (
+            "dart_visits_recorded_total",
+            "counter",
+            "Scored visits recorded.",
+            totals.visits_recorded,
+        ),
+        (
+            "dart_180s_total",
+            "counter",
+            "Visits of 180.",
+            totals.count_180s,
+        ),
+    ];
+    for (name, kind, help, value) in rows {
+        header(&mut out, name, kind, help);
+        let _ = writeln!(out, "{name} {value}");
+    }
+    out
+}
+
+fn header(out: &mut String, name: &str, kind: &str, help: &str) {
+    let _ = writeln!(out, "# HELP {name} {help}");
+    let _ = writeln!(out, "# TYPE {name} {kind}");
+}
+
+/// Escape a label value: backslash, double quote and line feed.
+fn escape(value: &str) -> String {
+    value
+        .replace('\\', "\\\\")
+        .replace('"', "\\\"")
+        .replace('\n', "\\n")
+}
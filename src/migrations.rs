@@ -0,0 +1,360 @@
+//! Versioned schema for stored tournaments, and the migrations between versions.
+//!
+//! Tournaments are stored as JSON documents (one file each in the data directory, or all of
+//! them in a snapshot). Serde defaults cover fields that are simply new, but a change that
+//! needs the old data to fill in the new (or a rollback to an older binary) goes here as a
+//! numbered [`Migration`] with an up and a down step over each document.
+//!
+//! A data directory records the version it is at in its `schema_version` file, with the
+//! migrations applied; a directory without one is at version 0 (stored before versioning).
+//! [`migrate`] runs on startup and brings the directory up to [`SCHEMA_VERSION`]. A directory
+//! already ahead of it was written by a newer binary and is refused rather than read, as this
+//! one would throw away what it doesn't know about when it next saves.
+//!
+//! Files can't be changed together in one transaction, so a run gets as close as it can: every
+//! document is migrated in memory first, and nothing is written unless all of them succeed.
+//! The new documents are then written beside the old and renamed over them, and the version is
+//! recorded last. A crash part way through the renames leaves some documents migrated under
+//! the old version, and the next start migrates them again, so each step must be harmless to
+//! apply twice.
+
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use serde_json::{json, Value};
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+
+/// One schema change, applied to each stored tournament document. `written` is when the
+/// document was last saved.
+pub struct Migration {
+    pub version: u32,
+    pub name: &'static str,
+    up: fn(&mut Value, DateTime<Utc>),
+    down: fn(&mut Value, DateTime<Utc>),
+}
+
+/// Every migration, oldest first; version `n` is `MIGRATIONS[n - 1]`.
+pub const MIGRATIONS: &[Migration] = &[
+    Migration {
+        version: 1,
+        name: "initial",
+        up: unchanged,
+        down: unchanged,
+    },
+    Migration {
+        version: 2,
+        name: "created_at",
+        up: fill_created_at,
+        down: unchanged,
+    },
+    Migration {
+        version: 3,
+        name: "draw_mode",
+        up: draw_mode_from_draw,
+        down: remove_draw_mode,
+    },
+    Migration {
+        version: 4,
+        name: "visit_players",
+        up: visit_players_from_log,
+        down: remove_visit_players,
+    },
+];
+
+/// Schema version this binary reads and writes.
+pub const SCHEMA_VERSION: u32 = MIGRATIONS.len() as u32;
+
+/// File in the data directory that records its schema version.
+pub const VERSION_FILE: &str = "schema_version";
+
+/// Version 1: tournaments as they were stored before versioning (players, bracket and
+/// group-play matches, and visit scoring, all in the one document).
+fn unchanged(_: &mut Value, _: DateTime<Utc>) {}
+
+/// Version 2: a tournament stored without a creation time was given a new one every time it
+/// was loaded; record when it was last saved instead. Earlier versions read `created_at`
+/// too, so going down leaves it.
+fn fill_created_at(doc: &mut Value, written: DateTime<Utc>) {
+    if let Some(doc) = doc.as_object_mut() {
+        doc.entry("created_at").or_insert(json!(written));
+    }
+}
+
+/// Version 3: tournaments have a `draw_mode` to start with; one already drawn keeps the mode
+/// of its draw, so a restart draws the same way.
+fn draw_mode_from_draw(doc: &mut Value, _: DateTime<Utc>) {
+    let mode = doc.pointer("/draw/mode").cloned();
+    if let (Some(doc), Some(mode)) = (doc.as_object_mut(), mode) {
+        doc.entry("draw_mode").or_insert(mode);
+    }
+}
+
+fn remove_draw_mode(doc: &mut Value, _: DateTime<Utc>) {
+    if let Some(doc) = doc.as_object_mut() {
+        doc.remove("draw_mode");
+    }
+}
+
+/// Version 4: each scored visit records who threw it. Visits scored before then get it from
+/// the match log, which has one visit entry, with its thrower, for each visit in the order
+/// they were thrown.
+fn visit_players_from_log(doc: &mut Value, _: DateTime<Utc>) {
+    let Some(doc) = doc.as_object_mut() else {
+        return;
+    };
+    let log = doc.get("match_log").cloned().unwrap_or_default();
+    let Some(scores) = doc.get_mut("scores").and_then(Value::as_object_mut) else {
+        return;
+    };
+    for (match_id, score) in scores {
+        let throwers = log
+            .get(match_id)
+            .and_then(Value::as_array)
+            .into_iter()
+            .flatten()
+            .filter(|action| action["action"] == "visit")
+            .map(|action| action["thrower"].clone());
+        for (visit, thrower) in visits_mut(score).zip(throwers) {
+            if let (Some(visit), false) = (visit.as_object_mut(), thrower.is_null()) {
+                visit.entry("player").or_insert(thrower);
+            }
+        }
+    }
+}
+
+fn remove_visit_players(doc: &mut Value, _: DateTime<Utc>) {
+    let Some(scores) = doc.get_mut("scores").and_then(Value::as_object_mut) else {
+        return;
+    };
+    for score in scores.values_mut() {
+        for visit in visits_mut(score).filter_map(Value::as_object_mut) {
+            visit.remove("player");
+        }
+    }
+}
+
+/// A scored match's visits, leg by leg in the order thrown.
+fn visits_mut(score: &mut Value) -> impl Iterator<Item = &mut Value> {
+    score
+        .get_mut("legs")
+        .and_then(Value::as_array_mut)
+        .into_iter()
+        .flatten()
+        .filter_map(|leg| leg.get_mut("visits").and_then(Value::as_array_mut))
+        .flatten()
+}
+
+/// Why a migration run failed.
+#[derive(Debug)]
+pub enum MigrateError {
+    /// The data is at a version newer than this binary knows.
+    Ahead {
+        found: u32,
+        known: u32,
+    },
+    /// Asked to migrate to a version that doesn't exist.
+    UnknownVersion(u32),
+    Io(io::Error),
+}
+
+impl std::fmt::Display for MigrateError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            MigrateError::Ahead { found, known } => write!(
+                f,
+                "Data is at schema version {}, but this version only knows up to {}",
+                found, known
+            ),
+            MigrateError::UnknownVersion(v) => write!(f, "No schema version {}", v),
+            MigrateError::Io(e) => write!(f, "{}", e),
+        }
+    }
+}
+
+impl std::error::Error for MigrateError {}
+
+impl From<io::Error> for MigrateError {
+    fn from(e: io::Error) -> Self {
+        MigrateError::Io(e)
+    }
+}
+
+/// A migration recorded as applied.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct AppliedMigration {
+    pub version: u32,
+    pub name: String,
+    pub applied_at: DateTime<Utc>,
+}
+
+/// Contents of the version file.
+#[derive(Debug, Default, Serialize, Deserialize)]
+struct SchemaState {
+    version: u32,
+    #[serde(default)]
+    applied: Vec<AppliedMigration>,
+}
+
+/// Schema version of the data directory `dir` (0 if it has none yet).
+pub fn schema_version(dir: &Path) -> io::Result<u32> {
+    Ok(read_state(dir)?.version)
+}
+
+/// Migrations recorded as applied to `dir`, oldest first.
+pub fn applied_migrations(dir: &Path) -> io::Result<Vec<AppliedMigration>> {
+    Ok(read_state(dir)?.applied)
+}
+
+/// Bring the data directory `dir` (created if needed) up to [`SCHEMA_VERSION`]. Returns the
+/// versions applied, none when it is already there.
+pub fn migrate(dir: &Path) -> Result<Vec<u32>, MigrateError> {
+    migrate_to(dir, SCHEMA_VERSION)
+}
+
+/// Migrate `dir` up or down to `target`: up applies each newer migration in order, down
+/// reverts each one above `target`, newest first. Returns the versions applied or reverted,
+/// in the order they ran.
+pub fn migrate_to(dir: &Path, target: u32) -> Result<Vec<u32>, MigrateError> {
+    if target > SCHEMA_VERSION {
+        return Err(MigrateError::UnknownVersion(target));
+    }
+    fs::create_dir_all(dir)?;
+    let mut state = read_state(dir)?;
+    if state.version > SCHEMA_VERSION {
+        return Err(MigrateError::Ahead {
+            found: state.version,
+            known: SCHEMA_VERSION,
+        });
+    }
+    let steps: Vec<u32> = if target >= state.version {
+        (state.version + 1..=target).collect()
+    } else {
+        (target + 1..=state.version).rev().collect()
+    };
+    if steps.is_empty() {
+        return Ok(steps);
+    }
+    let up = target > state.version;
+
+    let mut docs = read_documents(dir)?;
+    for doc in &mut docs {
+        for &version in &steps {
+            let m = &MIGRATIONS[version as usize - 1];
+            let step = if up { m.up } else { m.down };
+            step(&mut doc.value, doc.written);
+        }
+    }
+    write_documents(&docs)?;
+
+    let now = Utc::now();
+    for &version in &steps {
+        if up {
+            state.applied.push(AppliedMigration {
+                version,
+                name: MIGRATIONS[version as usize - 1].name.to_string(),
+                applied_at: now,
+            });
+        } else {
+            state.applied.retain(|a| a.version != version);
+        }
+    }
+    state.version = target;
+    write_state(dir, &state)?;
+    Ok(steps)
+}
+
+/// Migrate one tournament document stored at version `from` (e.g. in a snapshot) up to
+/// [`SCHEMA_VERSION`].
+pub(crate) fn upgrade(
+    doc: &mut Value,
+    from: u32,
+    written: DateTime<Utc>,
+) -> Result<(), MigrateError> {
+    if from > SCHEMA_VERSION {
+        return Err(MigrateError::Ahead {
+            found: from,
+            known: SCHEMA_VERSION,
+        });
+    }
+    for m in &MIGRATIONS[from as usize..] {
+        (m.up)(doc, written);
+    }
+    Ok(())
+}
+
+struct Document {
+    path: PathBuf,
+    value: Value,
+    written: DateTime<Utc>,
+}
+
+/// Every tournament document in `dir` (the `.json` files, as the file store reads them).
+fn read_documents(dir: &Path) -> io::Result<Vec<Document>> {
+    let mut docs = Vec::new();
+    for entry in fs::read_dir(dir)? {
+        let entry = entry?;
+        let path = entry.path();
+        if path.extension().and_then(|e| e.to_str()) != Some("json") {
+            continue;
+        }
+        let value = serde_json::from_slice(&fs::read(&path)?).map_err(|e| {
+            io::Error::new(
+                io::ErrorKind::InvalidData,
+                format!("{}: {}", path.display(), e),
+            )
+        })?;
+        let written = entry
+            .metadata()?
+            .modified()
+            .map_or_else(|_| Utc::now(), DateTime::from);
+        docs.push(Document {
+            path,
+            value,
+            written,
+        });
+    }
+    Ok(docs)
+}
+
+/// Write every document beside its file, then rename them all over the originals. If any
+/// write fails, the ones already written are removed and no original is touched.
+fn write_documents(docs: &[Document]) -> io::Result<()> {
+    let tmp = |doc: &Document| doc.path.with_extension("json.tmp");
+    for (i, doc) in docs.iter().enumerate() {
+        let written = serde_json::to_vec(&doc.value)
+            .map_err(io::Error::from)
+            .and_then(|json| fs::write(tmp(doc), json));
+        if let Err(e) = written {
+            for doc in &docs[..=i] {
+                let _ = fs::remove_file(tmp(doc));
+            }
+            return Err(e);
+        }
+    }
+    for doc in docs {
+        fs::rename(tmp(doc), &doc.path)?;
+    }
+    Ok(())
+}
+
+fn read_state(dir: &Path) -> io::Result<SchemaState> {
+    let path = dir.join(VERSION_FILE);
+    match fs::read(&path) {
+        Ok(bytes) => serde_json::from_slice(&bytes).map_err(|e| {
+            io::Error::new(
+                io::ErrorKind::InvalidData,
+                format!("{}: {}", path.display(), e),
+            )
+        }),
+        Err(e) if e.kind() == io::ErrorKind::NotFound => Ok(SchemaState::default()),
+        Err(e) => Err(e),
+    }
+}
+
+fn write_state(dir: &Path, state: &SchemaState) -> io::Result<()> {
+    let path = dir.join(VERSION_FILE);
+    let tmp = path.with_extension("tmp");
+    fs::write(&tmp, serde_json::to_vec_pretty(state)?)?;
+    fs::rename(&tmp, &path)
+}
@@ -0,0 +1,28 @@
+//! Dartboards at the venue and the match each one is playing.
+
+use crate::models::game::MatchId;
+use serde::{Deserialize, Serialize};
+
+/// Most boards a tournament can have.
+pub const MAX_BOARDS: usize = 64;
+
+/// Longest allowed board name (in characters, after trimming).
+pub const MAX_BOARD_NAME_LEN: usize = 32;
+
+/// One board: its name and the bracket match assigned to it, if any.
+#[derive(Clone, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct Board {
+    pub name: String,
+    #[serde(default)]
+    pub match_id: Option<MatchId>,
+}
+
+impl Board {
+    /// A free board.
+    pub fn new(name: impl Into<String>) -> Self {
+        Self {
+            name: name.into(),
+            match_id: None,
+        }
+    }
+}
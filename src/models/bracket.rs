@@ -0,0 +1,315 @@
+//! Knockout bracket: matches with known or pending players, and where each winner (and, in
+//! double elimination, each loser) goes next.
+
+use crate::models::game::{MatchId, Team};
+use crate::models::player::PlayerId;
+use chrono::{DateTime, Duration, Utc};
+use serde::{Deserialize, Serialize};
+use uuid::Uuid;
+
+/// Where a result sends a player: the next match and which side of it.
+#[derive(Clone, Copy, Debug, Eq, Hash, PartialEq, Serialize, Deserialize)]
+pub struct BracketSlot {
+    pub match_id: MatchId,
+    pub team: Team,
+}
+
+/// Part of the bracket a match belongs to. Single elimination and round robin only use Winners.
+#[derive(Clone, Copy, Debug, Default, Eq, Hash, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum BracketSection {
+    #[default]
+    Winners,
+    /// Double elimination: players with one loss.
+    Losers,
+    /// Double elimination: round 1 is the grand final, round 2 the bracket reset (only played
+    /// if the losers-bracket champion wins round 1).
+    GrandFinal,
+    /// Single elimination with a plate: a knockout of its own for the first-round losers,
+    /// drawn once the first round is over.
+    Plate,
+}
+
+/// How players are placed in a knockout bracket.
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum DrawMode {
+    /// Standard seeded positions (1 vs lowest, 2 vs second-lowest, ...).
+    #[default]
+    Seeded,
+    /// Blind draw: every player in a random position.
+    Random,
+    /// The top seeds in their seeded positions, everyone else drawn at random.
+    Protected,
+    /// Pairs ("split the draw"): people are entered one by one and drawn into teams at the
+    /// start, each of the stronger half with one of the weaker half (see
+    /// [`crate::logic::balanced_pair_draw`]). The teams are then seeded as drawn.
+    Balanced,
+}
+
+/// What a balanced pairs draw ranks players by.
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum PairMetric {
+    /// Three-dart average over every scored visit.
+    #[default]
+    Average,
+    /// Elo rating.
+    Rating,
+}
+
+/// A random draw as it was made. The same players (with the same seeds), mode and seed
+/// always give the same bracket, so a disputed draw can be re-run and checked.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct Draw {
+    pub mode: DrawMode,
+    /// Protected draws: how many top seeds kept their seeded positions.
+    #[serde(default)]
+    pub protected_seeds: usize,
+    /// Balanced draws: what the players were ranked by.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub balance_by: Option<PairMetric>,
+    /// Seed of the random number generator that shuffled the draw.
+    pub seed: u64,
+}
+
+/// Legs won by each side in a finished match (sets, when the match is played in sets).
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+pub struct LegScore {
+    pub team_1: u32,
+    pub team_2: u32,
+}
+
+impl LegScore {
+    /// Won by one side.
+    pub fn get(&self, team: Team) -> u32 {
+        match team {
+            Team::One => self.team_1,
+            Team::Two => self.team_2,
+        }
+    }
+
+    /// Nothing for either side.
+    pub fn is_zero(&self) -> bool {
+        self.team_1 == 0 && self.team_2 == 0
+    }
+
+    /// Count one more for `team`; returns its new total.
+    pub fn add(&mut self, team: Team) -> u32 {
+        let won = match team {
+            Team::One => &mut self.team_1,
+            Team::Two => &mut self.team_2,
+        };
+        *won += 1;
+        *won
+    }
+}
+
+/// How a match was decided.
+#[derive(Clone, Copy, Debug, Default, Eq, Hash, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum ResultType {
+    /// Played out (or reported as played).
+    #[default]
+    Played,
+    /// Awarded to the player who turned up: no score and no rating change, and the winner's
+    /// win only counts towards their total if the tournament says so.
+    Walkover,
+    /// Round robin: a result against a player who withdrew, taken back. The winner and score
+    /// stay for the record but count for nothing.
+    Void,
+}
+
+/// One bracket match (1v1). Sides stay None until the feeding match is decided.
+#[derive(Clone, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct BracketMatch {
+    pub id: MatchId,
+    #[serde(default)]
+    pub section: BracketSection,
+    /// 1-based round within the section (1 = first round).
+    pub round: u32,
+    /// 1-based position within the round, top to bottom.
+    pub number: u32,
+    pub team_1: Option<PlayerId>,
+    pub team_2: Option<PlayerId>,
+    /// None until played (set immediately for byes).
+    pub winner: Option<Team>,
+    /// Leg score, if reported with the result.
+    #[serde(default)]
+    pub score: Option<LegScore>,
+    /// Never played: a single player (knockout bye or round-robin sit-out), or in a losers
+    /// bracket a slot that only byes feed, so whoever arrives goes straight through.
+    pub bye: bool,
+    /// Next match for the winner; None for the final.
+    pub winner_to: Option<BracketSlot>,
+    /// Next match for the loser (double elimination); None when the loser is out.
+    #[serde(default)]
+    pub loser_to: Option<BracketSlot>,
+    /// When play began: first put on a board, or started by hand.
+    #[serde(default)]
+    pub started_at: Option<DateTime<Utc>>,
+    /// When the result was recorded (cleared if it is undone).
+    #[serde(default)]
+    pub completed_at: Option<DateTime<Utc>>,
+    #[serde(default)]
+    pub result_type: ResultType,
+    /// Board the match was last put on; kept after it is played, for the match history.
+    #[serde(default)]
+    pub board: Option<String>,
+}
+
+impl BracketMatch {
+    pub fn new(round: u32, number: u32) -> Self {
+        Self::in_section(BracketSection::Winners, round, number)
+    }
+
+    pub fn in_section(section: BracketSection, round: u32, number: u32) -> Self {
+        Self {
+            id: Uuid::new_v4(),
+            section,
+            round,
+            number,
+            team_1: None,
+            team_2: None,
+            winner: None,
+            score: None,
+            bye: false,
+            winner_to: None,
+            loser_to: None,
+            started_at: None,
+            completed_at: None,
+            result_type: ResultType::Played,
+            board: None,
+        }
+    }
+
+    /// Start to result, for a completed match that was started and played (walkovers and void
+    /// results have none).
+    pub fn duration(&self) -> Option<Duration> {
+        if self.result_type != ResultType::Played {
+            return None;
+        }
+        Some(self.completed_at? - self.started_at?)
+    }
+
+    /// Player on the given side, if known.
+    pub fn player(&self, team: Team) -> Option<PlayerId> {
+        match team {
+            Team::One => self.team_1,
+            Team::Two => self.team_2,
+        }
+    }
+
+    /// Put a player on the given side (None to clear it).
+    pub fn set_player(&mut self, team: Team, player: Option<PlayerId>) {
+        match team {
+            Team::One => self.team_1 = player,
+            Team::Two => self.team_2 = player,
+        }
+    }
+
+    /// Which side a player is on, if they are in this match.
+    pub fn side_of(&self, player: PlayerId) -> Option<Team> {
+        if self.team_1 == Some(player) {
+            Some(Team::One)
+        } else if self.team_2 == Some(player) {
+            Some(Team::Two)
+        } else {
+            None
+        }
+    }
+
+    /// Winning player once decided.
+    pub fn winner_id(&self) -> Option<PlayerId> {
+        self.winner.and_then(|w| self.player(w))
+    }
+
+    /// Losing player once decided (None for byes).
+    pub fn loser_id(&self) -> Option<PlayerId> {
+        self.winner.and_then(|w| self.player(w.other()))
+    }
+
+    /// Both players known and no result yet.
+    pub fn is_ready(&self) -> bool {
+        self.team_1.is_some() && self.team_2.is_some() && self.winner.is_none()
+    }
+}
+
+/// All matches of a bracket, ordered by section, then round, then number.
+#[derive(Clone, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+pub struct Bracket {
+    pub matches: Vec<BracketMatch>,
+}
+
+impl Bracket {
+    pub fn get(&self, id: MatchId) -> Option<&BracketMatch> {
+        self.matches.iter().find(|m| m.id == id)
+    }
+
+    pub fn get_mut(&mut self, id: MatchId) -> Option<&mut BracketMatch> {
+        self.matches.iter_mut().find(|m| m.id == id)
+    }
+
+    /// Number of winners-bracket rounds (the final's round number in single elimination).
+    pub fn round_count(&self) -> u32 {
+        self.section_round_count(BracketSection::Winners)
+    }
+
+    /// Matches of one winners-bracket round, top to bottom.
+    pub fn round(&self, round: u32) -> impl Iterator<Item = &BracketMatch> {
+        self.section_round(BracketSection::Winners, round)
+    }
+
+    /// Number of rounds in a section (0 if the bracket has none).
+    pub fn section_round_count(&self, section: BracketSection) -> u32 {
+        self.matches
+            .iter()
+            .filter(|m| m.section == section)
+            .map(|m| m.round)
+            .max()
+            .unwrap_or(0)
+    }
+
+    /// Matches of one round in a section, top to bottom.
+    pub fn section_round(
+        &self,
+        section: BracketSection,
+        round: u32,
+    ) -> impl Iterator<Item = &BracketMatch> {
+        self.matches
+            .iter()
+            .filter(move |m| m.section == section && m.round == round)
+    }
+
+    /// The match whose winner wins the bracket.
+    pub fn final_match(&self) -> Option<&BracketMatch> {
+        self.matches
+            .iter()
+            .find(|m| m.winner_to.is_none() && m.section != BracketSection::Plate)
+    }
+
+    /// Winner of the final, once played.
+    pub fn champion(&self) -> Option<PlayerId> {
+        self.final_match().and_then(|m| m.winner_id())
+    }
+
+    /// Whether the plate has been drawn.
+    pub fn has_plate(&self) -> bool {
+        self.matches
+            .iter()
+            .any(|m| m.section == BracketSection::Plate)
+    }
+
+    /// Winner of the plate final, once played.
+    pub fn plate_champion(&self) -> Option<PlayerId> {
+        self.matches
+            .iter()
+            .find(|m| m.section == BracketSection::Plate && m.winner_to.is_none())
+            .and_then(|m| m.winner_id())
+    }
+
+    /// True once every match that gets played has a winner.
+    pub fn is_complete(&self) -> bool {
+        self.matches.iter().all(|m| m.winner.is_some() || m.bye)
+    }
+}
@@ -1,5 +1,6 @@
 //! Match (game), Team, and RoundType for 2v2 / 1v1 games.
 
+use crate::models::bracket::{LegScore, ResultType};
 use crate::models::player::PlayerId;
 use serde::{Deserialize, Serialize};
 use uuid::Uuid;
@@ -16,6 +17,16 @@ pub enum Team {
     Two,
 }
 
+impl Team {
+    /// The opposing side.
+    pub fn other(self) -> Self {
+        match self {
+            Team::One => Team::Two,
+            Team::Two => Team::One,
+        }
+    }
+}
+
 /// Phase of the tournament this match belongs to.
 #[derive(Clone, Copy, Debug, Eq, PartialEq, Serialize, Deserialize)]
 #[serde(rename_all = "snake_case")]
@@ -48,4 +59,46 @@ impl GameMatch {
             round,
         }
     }
+
+    /// Player ids on the given side.
+    pub fn team(&self, team: Team) -> &[PlayerId] {
+        match team {
+            Team::One => &self.team_1,
+            Team::Two => &self.team_2,
+        }
+    }
+}
+
+/// A bracket result as it was recorded.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct RecordedResult {
+    pub winner: PlayerId,
+    pub score: Option<LegScore>,
+    #[serde(default)]
+    pub result_type: ResultType,
+}
+
+/// One change made to a match, logged (newest last) so it can be undone step by step.
+#[derive(Clone, Debug, Eq, PartialEq, Serialize, Deserialize)]
+#[serde(tag = "action", rename_all = "snake_case")]
+pub enum MatchAction {
+    /// A scored visit. `thrower` is the player its stats were credited to (None for a 2v2
+    /// side); `highest_checkout_before` is their best checkout before the visit.
+    Visit {
+        team: Team,
+        thrower: Option<PlayerId>,
+        darts_at_double: u32,
+        highest_checkout_before: u32,
+    },
+    /// A scored cricket visit, by `thrower` when the side is one player. Cricket visits
+    /// credit no player stats, so there is nothing else to take back.
+    CricketVisit {
+        team: Team,
+        thrower: Option<PlayerId>,
+    },
+    /// A bracket result, and the result it overwrote, if any.
+    Result {
+        result: RecordedResult,
+        replaced: Option<RecordedResult>,
+    },
 }
@@ -0,0 +1,35 @@
+//! Groups of a groups-then-knockout tournament.
+
+use crate::models::bracket::BracketMatch;
+use crate::models::player::PlayerId;
+use serde::{Deserialize, Serialize};
+
+/// One round-robin group.
+#[derive(Clone, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct Group {
+    /// "A", "B", ...
+    pub name: String,
+    pub players: Vec<PlayerId>,
+}
+
+/// The group stage: who is in which group and how many go through to the knockout.
+///
+/// While the groups are played their matches are the tournament's bracket, so results,
+/// scoring, undo and boards work as in round robin. Drawing the knockout moves them here.
+#[derive(Clone, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+pub struct GroupStage {
+    pub groups: Vec<Group>,
+    pub advance_per_group: usize,
+    /// Group matches, once the knockout has been drawn.
+    #[serde(default)]
+    pub matches: Vec<BracketMatch>,
+    #[serde(default)]
+    pub knockout_started: bool,
+}
+
+impl GroupStage {
+    /// The group a player is in.
+    pub fn group_of(&self, player: PlayerId) -> Option<&Group> {
+        self.groups.iter().find(|g| g.players.contains(&player))
+    }
+}
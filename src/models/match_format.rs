@@ -0,0 +1,47 @@
+//! Match formats per round: how many legs (or sets) each round of a tournament is played over.
+
+use crate::scoring::MatchFormat;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+
+/// Knockout stage a match belongs to (single-elimination style brackets and the group-play
+/// format's final rounds; a double-elimination grand final counts as the final).
+#[derive(Clone, Copy, Debug, Eq, PartialEq)]
+pub enum KnockoutStage {
+    SemiFinal,
+    Final,
+}
+
+/// Formats set for a tournament. A match uses its stage's format when one is set, otherwise
+/// its round's, otherwise the default best-of-3 legs. Round numbers count within a bracket
+/// section, so round 2 covers both winners and losers round 2.
+#[derive(Clone, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+pub struct MatchFormats {
+    /// By round number (1 = first round).
+    #[serde(default)]
+    pub rounds: BTreeMap<u32, MatchFormat>,
+    #[serde(default)]
+    pub semi_final: Option<MatchFormat>,
+    #[serde(default, rename = "final")]
+    pub final_match: Option<MatchFormat>,
+}
+
+impl MatchFormats {
+    /// Format set for a match in `round` (if it has a round number) and `stage`, if any.
+    pub fn get(&self, round: Option<u32>, stage: Option<KnockoutStage>) -> Option<MatchFormat> {
+        let by_stage = match stage {
+            Some(KnockoutStage::SemiFinal) => self.semi_final,
+            Some(KnockoutStage::Final) => self.final_match,
+            None => None,
+        };
+        by_stage.or_else(|| round.and_then(|r| self.rounds.get(&r).copied()))
+    }
+
+    /// Every format set, for validation.
+    pub fn iter(&self) -> impl Iterator<Item = &MatchFormat> {
+        self.rounds
+            .values()
+            .chain(self.semi_final.as_ref())
+            .chain(self.final_match.as_ref())
+    }
+}
@@ -1,9 +1,26 @@
 //! Data structures for the dart tournament: players, matches, tournament state.
 
+mod board;
+mod bracket;
 mod game;
+mod group;
+mod match_format;
 mod player;
 mod tournament;
 
-pub use game::{GameMatch, MatchId, RoundType, Team};
-pub use player::{Player, PlayerId, PlayerStats};
-pub use tournament::{Tournament, TournamentError, TournamentId, TournamentMode, TournamentState};
+pub use board::{Board, MAX_BOARDS, MAX_BOARD_NAME_LEN};
+pub use bracket::{
+    Bracket, BracketMatch, BracketSection, BracketSlot, Draw, DrawMode, LegScore, PairMetric,
+    ResultType,
+};
+pub use game::{GameMatch, MatchAction, MatchId, RecordedResult, RoundType, Team};
+pub use group::{Group, GroupStage};
+pub use match_format::{KnockoutStage, MatchFormats};
+pub use player::{
+    Handicap, Player, PlayerId, PlayerStats, RatingChange, DEFAULT_RATING, MAX_HANDICAP_LEGS,
+    MAX_HANDICAP_POINTS,
+};
+pub use tournament::{
+    EntryType, Placement, Tournament, TournamentError, TournamentFormat, TournamentId,
+    TournamentMode, TournamentState, MAX_PLAYER_NAME_LEN, MAX_TOURNAMENT_NAME_LEN,
+};
@@ -1,5 +1,7 @@
 //! Player and PlayerStats data structures.
 
+use crate::models::game::MatchId;
+use chrono::{DateTime, Utc};
 use serde::{Deserialize, Serialize};
 use uuid::Uuid;
 
@@ -7,12 +9,18 @@ use uuid::Uuid;
 pub type PlayerId = Uuid;
 
 /// Statistics view of a player (for API / display).
-#[derive(Clone, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+#[derive(Clone, Debug, Default, PartialEq, Serialize, Deserialize)]
 pub struct PlayerStats {
     pub losses: u32,
     pub wins: u32,
     pub times_sat_out: u32,
     pub eliminated_status: bool,
+    /// Points per three darts over every scored visit (0 before the first visit).
+    pub three_dart_average: f64,
+    pub highest_checkout: u32,
+    pub count_180s: u32,
+    /// Successful darts at a double, as a percentage of all darts at a double.
+    pub checkout_percentage: f64,
 }
 
 impl PlayerStats {
@@ -22,23 +30,111 @@ impl PlayerStats {
             wins: p.wins,
             times_sat_out: p.times_sat_out,
             eliminated_status: p.eliminated,
+            three_dart_average: p.three_dart_average(),
+            highest_checkout: p.highest_checkout,
+            count_180s: p.count_180s,
+            checkout_percentage: p.checkout_percentage(),
         }
     }
 }
 
+/// Rating every player starts from.
+pub const DEFAULT_RATING: f64 = 1200.0;
+
+fn default_rating() -> f64 {
+    DEFAULT_RATING
+}
+
+fn is_zero(n: &u32) -> bool {
+    *n == 0
+}
+
+/// One rating update, recorded for each rated result.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct RatingChange {
+    pub match_id: MatchId,
+    /// Opponent name(s) at the time, joined with " & " for teams.
+    pub opponent: String,
+    pub rating_before: f64,
+    pub rating_after: f64,
+    pub at: DateTime<Utc>,
+}
+
+/// Most points a handicap may take off the start (a 501 leg starts at 101 at the least).
+pub const MAX_HANDICAP_POINTS: u32 = 400;
+/// Most legs a handicap may give a head start of.
+pub const MAX_HANDICAP_LEGS: u32 = 5;
+
+/// A head start for a weaker player on a mixed-ability night: points off the start of every
+/// leg (100 starts a 501 leg at 401), and legs counted as won before a match begins (fewer
+/// when the match is too short for that many: the side always needs one leg more).
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+pub struct Handicap {
+    #[serde(default)]
+    pub points: u32,
+    #[serde(default)]
+    pub legs: u32,
+}
+
+impl Handicap {
+    /// No head start at all.
+    pub fn is_none(&self) -> bool {
+        self.points == 0 && self.legs == 0
+    }
+}
+
 /// A player in the tournament.
-#[derive(Clone, Debug, Eq, PartialEq, Serialize, Deserialize)]
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
 pub struct Player {
     pub id: PlayerId,
     pub name: String,
     pub losses: u32,
+    /// Every win, plate wins included.
     pub wins: u32,
+    /// Wins in the plate (see [`crate::models::BracketSection::Plate`]), also counted in
+    /// `wins`, so a record can tell them apart from wins in the main draw.
+    #[serde(default, skip_serializing_if = "is_zero")]
+    pub plate_wins: u32,
     pub times_sat_out: u32,
     /// Internal counter for sit-out fairness (can go negative when we "owe" a sit-out).
     pub internal_times_sat_out: i32,
-    /// Random seed for matchmaking (shuffle).
+    /// Seed (1 = top seed): registration order unless re-seeded, used by bracket formats.
     pub seed: u32,
     pub eliminated: bool,
+    /// Left a bracket tournament early: their remaining matches are walkovers.
+    #[serde(default)]
+    pub withdrawn: bool,
+    /// Totals from scored visits (busts count their darts with 0 points).
+    #[serde(default)]
+    pub points_scored: u32,
+    #[serde(default)]
+    pub darts_thrown: u32,
+    #[serde(default)]
+    pub count_180s: u32,
+    #[serde(default)]
+    pub highest_checkout: u32,
+    #[serde(default)]
+    pub checkouts: u32,
+    /// Darts thrown at a double to finish a leg, hit or missed.
+    #[serde(default)]
+    pub double_attempts: u32,
+    /// Elo-style skill rating, carried over between tournaments by name.
+    #[serde(default = "default_rating")]
+    pub rating: f64,
+    /// Every rating update in the order it happened.
+    #[serde(default)]
+    pub rating_history: Vec<RatingChange>,
+    /// Pairs tournaments: the two people in this team. Empty for a single player.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub members: Vec<String>,
+    /// Head start in scored matches; their visits and results don't count towards stats or
+    /// rating (see [`crate::handicap`]).
+    #[serde(default, skip_serializing_if = "Handicap::is_none")]
+    pub handicap: Handicap,
+    /// When the player was deleted ([`crate::roster::delete_player`]). A deleted player keeps
+    /// their place in history but can't be entered again until restored.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub deleted_at: Option<DateTime<Utc>>,
 }
 
 impl Player {
@@ -50,13 +146,31 @@ impl Player {
             name,
             losses: 0,
             wins: 0,
+            plate_wins: 0,
             times_sat_out: 0,
             internal_times_sat_out: 0,
             seed: 0,
             eliminated: false,
+            withdrawn: false,
+            points_scored: 0,
+            darts_thrown: 0,
+            count_180s: 0,
+            highest_checkout: 0,
+            checkouts: 0,
+            double_attempts: 0,
+            rating: DEFAULT_RATING,
+            rating_history: Vec::new(),
+            members: Vec::new(),
+            handicap: Handicap::default(),
+            deleted_at: None,
         }
     }
 
+    /// A pairs team entered as one entrant.
+    pub fn is_pair(&self) -> bool {
+        !self.members.is_empty()
+    }
+
     /// Current stats as a separate struct (for API responses).
     pub fn stats(&self) -> PlayerStats {
         PlayerStats::from_player(self)
@@ -72,6 +186,97 @@ impl Player {
         self.losses += 1;
     }
 
+    /// Take back a recorded win (when a result is corrected).
+    pub fn remove_win(&mut self) {
+        self.wins = self.wins.saturating_sub(1);
+    }
+
+    /// Take back a recorded loss (when a result is corrected).
+    pub fn remove_loss(&mut self) {
+        self.losses = self.losses.saturating_sub(1);
+    }
+
+    /// Add one visit to the scoring totals. `darts` is what was actually thrown, so a leg
+    /// finished with one or two darts does not dilute the average.
+    pub fn record_visit_stats(&mut self, score: u32, darts: u32) {
+        self.points_scored += score;
+        self.darts_thrown += darts;
+        if score == 180 {
+            self.count_180s += 1;
+        }
+    }
+
+    /// Record a finished leg: the checkout score and the darts it took at a double (at least 1).
+    pub fn record_checkout(&mut self, checkout: u32, attempts: u32) {
+        self.checkouts += 1;
+        self.double_attempts += attempts.max(1);
+        self.highest_checkout = self.highest_checkout.max(checkout);
+    }
+
+    /// Record darts at a double that missed (visit did not finish the leg).
+    pub fn record_missed_doubles(&mut self, attempts: u32) {
+        self.double_attempts += attempts;
+    }
+
+    /// Take back a visit added with [`Self::record_visit_stats`].
+    pub fn remove_visit_stats(&mut self, score: u32, darts: u32) {
+        self.points_scored = self.points_scored.saturating_sub(score);
+        self.darts_thrown = self.darts_thrown.saturating_sub(darts);
+        if score == 180 {
+            self.count_180s = self.count_180s.saturating_sub(1);
+        }
+    }
+
+    /// Take back a checkout added with [`Self::record_checkout`], restoring the highest
+    /// checkout from before it.
+    pub fn remove_checkout(&mut self, attempts: u32, highest_before: u32) {
+        self.checkouts = self.checkouts.saturating_sub(1);
+        self.double_attempts = self.double_attempts.saturating_sub(attempts.max(1));
+        self.highest_checkout = highest_before;
+    }
+
+    /// Take back darts added with [`Self::record_missed_doubles`].
+    pub fn remove_missed_doubles(&mut self, attempts: u32) {
+        self.double_attempts = self.double_attempts.saturating_sub(attempts);
+    }
+
+    /// Total points divided by darts thrown, times three (not the mean of visit scores).
+    pub fn three_dart_average(&self) -> f64 {
+        if self.darts_thrown == 0 {
+            return 0.0;
+        }
+        f64::from(self.points_scored) * 3.0 / f64::from(self.darts_thrown)
+    }
+
+    /// Checkouts as a percentage of darts at a double (0 before the first attempt).
+    pub fn checkout_percentage(&self) -> f64 {
+        if self.double_attempts == 0 {
+            return 0.0;
+        }
+        f64::from(self.checkouts) * 100.0 / f64::from(self.double_attempts)
+    }
+
+    /// Add `other`'s results, sit-outs and scoring totals to this player (merging a duplicate
+    /// registration). The better seed is kept; rating histories are combined oldest first,
+    /// and the rating stays this player's.
+    pub fn absorb(&mut self, other: Player) {
+        self.wins += other.wins;
+        self.losses += other.losses;
+        self.times_sat_out += other.times_sat_out;
+        self.internal_times_sat_out += other.internal_times_sat_out;
+        self.points_scored += other.points_scored;
+        self.darts_thrown += other.darts_thrown;
+        self.count_180s += other.count_180s;
+        self.checkouts += other.checkouts;
+        self.double_attempts += other.double_attempts;
+        self.highest_checkout = self.highest_checkout.max(other.highest_checkout);
+        if other.seed != 0 && (self.seed == 0 || other.seed < self.seed) {
+            self.seed = other.seed;
+        }
+        self.rating_history.extend(other.rating_history);
+        self.rating_history.sort_by_key(|c| c.at);
+    }
+
     /// Mark the player as eliminated.
     pub fn eliminate(&mut self) {
         self.eliminated = true;
@@ -1,7 +1,15 @@
 //! Tournament and TournamentState.
 
-use crate::models::game::{GameMatch, MatchId, Team};
-use crate::models::player::{Player, PlayerId};
+use crate::import::ImportIssue;
+use crate::metrics::ActivityCounts;
+use crate::models::board::Board;
+use crate::models::bracket::{Bracket, Draw, DrawMode};
+use crate::models::game::{GameMatch, MatchAction, MatchId, Team};
+use crate::models::group::GroupStage;
+use crate::models::match_format::MatchFormats;
+use crate::models::player::{Handicap, Player, PlayerId};
+use crate::scoring::{CricketMatch, ScoringError, X01Match};
+use chrono::{DateTime, Utc};
 use serde::{Deserialize, Serialize};
 use std::collections::HashMap;
 use uuid::Uuid;
@@ -21,12 +29,85 @@ pub enum TournamentError {
     PlayerNotFound(PlayerId),
     /// Player name is empty or only whitespace.
     EmptyPlayerName,
+    /// Player name is longer than [`MAX_PLAYER_NAME_LEN`] characters.
+    PlayerNameTooLong { max: usize },
+    /// Tournament name is longer than [`MAX_TOURNAMENT_NAME_LEN`] characters.
+    TournamentNameTooLong { max: usize },
     /// A player with this name already exists (names are unique, case-insensitive).
     DuplicatePlayerName,
     /// Wrong number of players selected for final selection (must select exactly N to reach semi size).
     WrongNumberOfPlayers { needed: usize, selected: usize },
     /// A selected player is not in the last eliminated list.
     PlayerNotInLastEliminated(PlayerId),
+    /// No match with this id in the current round.
+    MatchNotFound(MatchId),
+    /// This format cannot be played in the tournament's mode (bracket formats are 1v1).
+    UnsupportedMode,
+    /// The player is not one of the two players in this match.
+    NotInMatch(PlayerId),
+    /// The match is a bye or its players are not known yet.
+    MatchNotReady,
+    /// The match already has a result (pass overwrite to replace it).
+    ResultAlreadyRecorded,
+    /// The match's winner has already played their next match, so the result is locked.
+    NextMatchAlreadyPlayed,
+    /// Leg score does not agree with the winner.
+    InvalidScore,
+    /// A visit was rejected by the scoring rules.
+    Scoring(ScoringError),
+    /// Swiss: the round can't be paired without a rematch or a second bye.
+    NoValidPairing,
+    /// Seeds are fixed once the tournament has started.
+    SeedingLocked,
+    /// A seed order must list every player exactly once.
+    InvalidSeedOrder,
+    /// A player import was rejected; lists every offending line.
+    InvalidImport(Vec<ImportIssue>),
+    /// A player import must have at least one and at most `max` rows.
+    ImportRowCount { max: usize },
+    /// The match has no logged change left to undo.
+    NothingToUndo,
+    /// Board name is empty or only whitespace.
+    EmptyBoardName,
+    /// Board name is longer than [`crate::models::MAX_BOARD_NAME_LEN`] characters.
+    BoardNameTooLong { max: usize },
+    /// Two boards share a name (case-insensitive).
+    DuplicateBoardName,
+    /// More than `max` boards.
+    TooManyBoards { max: usize },
+    /// Groups-then-knockout needs between 2 and `max` groups of at least two players.
+    InvalidGroupCount { max: usize },
+    /// Between 1 and `max` players (the smallest group's size) can advance from each group.
+    InvalidAdvanceCount { max: usize },
+    /// Both players are in this tournament's draw, so they can't be merged any more.
+    MergeAfterStart,
+    /// The tournament has been finished and archived; it can no longer change.
+    TournamentFinished,
+    /// Match formats must be odd numbers of legs and sets, for rounds numbered from 1.
+    InvalidMatchFormat,
+    /// A round with completed matches keeps the format they were played over.
+    MatchFormatLocked,
+    /// Pairs tournaments take team entries (people, with a balanced draw); singles
+    /// tournaments take players.
+    WrongEntryType,
+    /// A protected draw keeps between 1 and `max` (the player count) seeds in place.
+    InvalidProtectedSeeds { max: usize },
+    /// A team needs two different, non-empty member names.
+    InvalidPair,
+    /// This person is already a member of another team in the tournament.
+    PlayerInAnotherPair(String),
+    /// The player has withdrawn; their matches can only be walkovers.
+    PlayerWithdrawn(PlayerId),
+    /// A balanced pairs draw pairs everyone off, so needs an even number of people.
+    OddPlayerCount,
+    /// A player of this name was deleted: restore them, or enter someone under another name.
+    PlayerDeleted(String),
+    /// A player can't be deleted while entered in a tournament that hasn't finished.
+    PlayerStillEntered(String),
+    /// Only a player with no recorded matches can be deleted for good.
+    PlayerHasMatches { matches: usize },
+    /// Rounds of the elimination format are drawn by hand, so it can't be simulated.
+    SimulationUnsupported,
 }
 
 impl std::fmt::Display for TournamentError {
@@ -42,6 +123,16 @@ impl std::fmt::Display for TournamentError {
             TournamentError::InvalidState => write!(f, "Invalid state for this action"),
             TournamentError::PlayerNotFound(_) => write!(f, "Player not found"),
             TournamentError::EmptyPlayerName => write!(f, "Player name cannot be empty"),
+            TournamentError::PlayerNameTooLong { max } => {
+                write!(f, "Player name cannot be longer than {} characters", max)
+            }
+            TournamentError::TournamentNameTooLong { max } => {
+                write!(
+                    f,
+                    "Tournament name cannot be longer than {} characters",
+                    max
+                )
+            }
             TournamentError::DuplicatePlayerName => {
                 write!(f, "A player with this name already exists")
             }
@@ -55,10 +146,143 @@ impl std::fmt::Display for TournamentError {
             TournamentError::PlayerNotInLastEliminated(_) => {
                 write!(f, "Selected player is not in the last eliminated list")
             }
+            TournamentError::MatchNotFound(_) => write!(f, "Match not found"),
+            TournamentError::UnsupportedMode => {
+                write!(f, "This format is not available in this mode")
+            }
+            TournamentError::NotInMatch(_) => write!(f, "Player is not in this match"),
+            TournamentError::MatchNotReady => write!(f, "Match is not ready to be played"),
+            TournamentError::ResultAlreadyRecorded => {
+                write!(f, "Match already has a result")
+            }
+            TournamentError::NextMatchAlreadyPlayed => {
+                write!(f, "Winner has already played their next match")
+            }
+            TournamentError::InvalidScore => {
+                write!(f, "Winner must have won more legs than the loser")
+            }
+            TournamentError::Scoring(e) => write!(f, "{}", e),
+            TournamentError::NoValidPairing => {
+                write!(f, "No pairing possible without a rematch")
+            }
+            TournamentError::SeedingLocked => {
+                write!(
+                    f,
+                    "Seeds cannot be changed after the tournament has started"
+                )
+            }
+            TournamentError::InvalidSeedOrder => {
+                write!(f, "Seed order must list every player exactly once")
+            }
+            TournamentError::InvalidImport(issues) => {
+                write!(f, "Import rejected: {} invalid line(s)", issues.len())
+            }
+            TournamentError::ImportRowCount { max } => {
+                write!(f, "An import must list between 1 and {} players", max)
+            }
+            TournamentError::NothingToUndo => write!(f, "Nothing to undo for this match"),
+            TournamentError::EmptyBoardName => write!(f, "Board name cannot be empty"),
+            TournamentError::BoardNameTooLong { max } => {
+                write!(f, "Board name cannot be longer than {} characters", max)
+            }
+            TournamentError::DuplicateBoardName => {
+                write!(f, "A board with this name already exists")
+            }
+            TournamentError::TooManyBoards { max } => {
+                write!(f, "A tournament can have at most {} boards", max)
+            }
+            TournamentError::InvalidGroupCount { max } => {
+                write!(f, "Group count must be between 2 and {}", max)
+            }
+            TournamentError::InvalidAdvanceCount { max } => {
+                write!(
+                    f,
+                    "Between 1 and {} players can advance from each group",
+                    max
+                )
+            }
+            TournamentError::InvalidMatchFormat => {
+                write!(
+                    f,
+                    "Formats must be odd numbers of legs and sets, for rounds from 1"
+                )
+            }
+            TournamentError::MatchFormatLocked => {
+                write!(
+                    f,
+                    "Format cannot be changed for a round with completed matches"
+                )
+            }
+            TournamentError::TournamentFinished => {
+                write!(f, "Tournament is finished and can no longer be changed")
+            }
+            TournamentError::WrongEntryType => {
+                write!(
+                    f,
+                    "Pairs tournaments take team entries, singles tournaments players"
+                )
+            }
+            TournamentError::InvalidProtectedSeeds { max } => {
+                write!(f, "Protected seeds must be between 1 and {}", max)
+            }
+            TournamentError::InvalidPair => {
+                write!(f, "A team needs two different member names")
+            }
+            TournamentError::PlayerInAnotherPair(name) => {
+                write!(f, "{} is already in another team", name)
+            }
+            TournamentError::PlayerWithdrawn(_) => {
+                write!(f, "Player has withdrawn from the tournament")
+            }
+            TournamentError::OddPlayerCount => {
+                write!(f, "A balanced draw needs an even number of players")
+            }
+            TournamentError::PlayerDeleted(name) => {
+                write!(
+                    f,
+                    "{} was deleted: restore them, or choose another name",
+                    name
+                )
+            }
+            TournamentError::PlayerStillEntered(name) => {
+                write!(
+                    f,
+                    "{} is entered in a tournament that hasn't finished",
+                    name
+                )
+            }
+            TournamentError::PlayerHasMatches { matches } => {
+                write!(
+                    f,
+                    "Player has {} recorded matches and can only be soft-deleted",
+                    matches
+                )
+            }
+            TournamentError::SimulationUnsupported => {
+                write!(f, "Only bracket formats can be simulated")
+            }
+            TournamentError::MergeAfterStart => {
+                write!(
+                    f,
+                    "Players who both entered a started tournament cannot be merged"
+                )
+            }
         }
     }
 }
 
+/// Longest allowed player name (in characters, after trimming).
+pub const MAX_PLAYER_NAME_LEN: usize = 64;
+
+impl From<ScoringError> for TournamentError {
+    fn from(e: ScoringError) -> Self {
+        TournamentError::Scoring(e)
+    }
+}
+
+/// Longest allowed tournament name (in characters, after trimming).
+pub const MAX_TOURNAMENT_NAME_LEN: usize = 100;
+
 /// Unique identifier for a tournament.
 pub type TournamentId = Uuid;
 
@@ -73,6 +297,34 @@ pub enum TournamentMode {
     TwoVTwo,
 }
 
+/// How the tournament is played from start to winner.
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum TournamentFormat {
+    /// Group play rounds until players reach max losses, then semi-finals and finals.
+    #[default]
+    Elimination,
+    /// Seeded knockout bracket (1v1); byes go to the top seeds.
+    SingleElimination,
+    /// Winners and losers brackets (1v1): a player is out after their second loss.
+    DoubleElimination,
+    /// Everyone plays everyone once (1v1); with an odd count one player sits out each round.
+    RoundRobin,
+    /// Fixed number of rounds (1v1), each pairing players on the same record; no rematches.
+    Swiss,
+    /// Round-robin groups (1v1), then the top players of each group in a knockout bracket.
+    GroupsKnockout,
+}
+
+/// Who enters: individual players, or fixed two-person teams that play as one entrant.
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum EntryType {
+    #[default]
+    Singles,
+    Pairs,
+}
+
 /// Current phase of the tournament.
 #[derive(Clone, Copy, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
 #[serde(rename_all = "snake_case")]
@@ -88,14 +340,31 @@ pub enum TournamentState {
     SemiFinals,
     /// 4 players; finals (1 match, 2v2). Submitting completes the tournament (two winners).
     Finals,
+    /// Bracket formats: matches in `bracket` are played until it has a champion.
+    BracketPlay,
     /// Tournament finished; show winners and stats.
     Completed,
 }
 
+/// A player's finishing position. Players knocked out in the same round share a place, and
+/// the next place skips past them (1, 2, 3, 3, 5, ...).
+#[derive(Clone, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct Placement {
+    pub player: PlayerId,
+    pub place: u32,
+}
+
 /// Full tournament state: players, matches, results, and phase.
 #[derive(Clone, Debug, Serialize, Deserialize)]
 pub struct Tournament {
     pub id: TournamentId,
+    /// Display name (may be empty).
+    #[serde(default)]
+    pub name: String,
+    #[serde(default = "Utc::now")]
+    pub created_at: DateTime<Utc>,
+    #[serde(default)]
+    pub format: TournamentFormat,
     /// Active (non-eliminated) players.
     pub players: Vec<Player>,
     /// Players eliminated so far.
@@ -125,6 +394,70 @@ pub struct Tournament {
     pub bracket_finals_result: Option<Team>,
     /// Bracket display: 8 players at semi-finals (for name lookup).
     pub bracket_semi_final_players: Option<Vec<Player>>,
+    /// Bracket formats: every match from the first round to the final.
+    #[serde(default)]
+    pub bracket: Option<Bracket>,
+    /// Visit-by-visit x01 scoring for matches that are being scored live.
+    #[serde(default)]
+    pub scores: HashMap<MatchId, X01Match>,
+    /// Visit-by-visit scoring for matches played as cricket rather than x01.
+    #[serde(default, skip_serializing_if = "HashMap::is_empty")]
+    pub cricket: HashMap<MatchId, CricketMatch>,
+    /// Swiss: rounds to play, set when the tournament starts.
+    #[serde(default)]
+    pub swiss_rounds: u32,
+    /// Elo K-factor: the most rating points one result can move.
+    #[serde(default = "default_k_factor")]
+    pub rating_k: f64,
+    /// Changes made to each match (visits and bracket results), oldest first, for undo.
+    #[serde(default)]
+    pub match_log: HashMap<MatchId, Vec<MatchAction>>,
+    /// Boards at the venue; bracket matches are assigned to free ones as they become ready.
+    #[serde(default)]
+    pub boards: Vec<Board>,
+    /// Groups-then-knockout: the groups, set when the tournament starts.
+    #[serde(default)]
+    pub group_stage: Option<GroupStage>,
+    /// Set when a completed tournament is finished: it is archived and can no longer change.
+    #[serde(default)]
+    pub finished_at: Option<DateTime<Utc>>,
+    /// Final placements, best first; recorded when the tournament is finished.
+    #[serde(default)]
+    pub placements: Vec<Placement>,
+    /// Legs (or sets) each round is played over; see [`MatchFormats`].
+    #[serde(default)]
+    pub match_formats: MatchFormats,
+    /// Pairs: every entrant in `players` is a team (see [`Player::members`]).
+    #[serde(default)]
+    pub entry_type: EntryType,
+    /// Knockout formats: the random draw the bracket was made from (None for a seeded draw).
+    #[serde(default)]
+    pub draw: Option<Draw>,
+    /// Walkovers count towards the winner's win total (some leagues do). Either way the
+    /// winner goes through and the loser takes the loss.
+    #[serde(default)]
+    pub walkover_counts_as_win: bool,
+    /// Single elimination: the first-round losers play a plate of their own (see
+    /// [`crate::models::BracketSection::Plate`]).
+    #[serde(default)]
+    pub plate: bool,
+    /// Knockout formats: the draw to make when the tournament is started without one given.
+    #[serde(default)]
+    pub draw_mode: DrawMode,
+    /// Bumped by every change the registry makes (see [`crate::versions`]).
+    #[serde(default)]
+    pub version: u64,
+    /// Version of each match changed since it was drawn; a match not here is at 0.
+    #[serde(default)]
+    pub match_versions: HashMap<MatchId, u64>,
+    /// Activity from changes to this copy not yet added to the metrics totals (see
+    /// [`crate::metrics`]); never saved.
+    #[serde(skip)]
+    pub(crate) activity: ActivityCounts,
+}
+
+fn default_k_factor() -> f64 {
+    crate::rating::DEFAULT_K_FACTOR
 }
 
 impl Tournament {
@@ -132,6 +465,9 @@ impl Tournament {
     pub fn new(max_losses: u32, mode: TournamentMode) -> Self {
         Self {
             id: Uuid::new_v4(),
+            name: String::new(),
+            created_at: Utc::now(),
+            format: TournamentFormat::default(),
             players: Vec::new(),
             eliminated_players: Vec::new(),
             last_eliminated_players: Vec::new(),
@@ -147,11 +483,36 @@ impl Tournament {
             bracket_finals_match: None,
             bracket_finals_result: None,
             bracket_semi_final_players: None,
+            bracket: None,
+            scores: HashMap::new(),
+            cricket: HashMap::new(),
+            swiss_rounds: 0,
+            rating_k: crate::rating::DEFAULT_K_FACTOR,
+            match_log: HashMap::new(),
+            boards: Vec::new(),
+            group_stage: None,
+            finished_at: None,
+            placements: Vec::new(),
+            match_formats: MatchFormats::default(),
+            entry_type: EntryType::Singles,
+            draw: None,
+            walkover_counts_as_win: false,
+            plate: false,
+            draw_mode: DrawMode::Seeded,
+            version: 0,
+            match_versions: HashMap::new(),
+            activity: ActivityCounts::default(),
         }
     }
 
-    /// Players required to start (4 for 1v1, 8 for 2v2).
+    /// Players required to start (4 for 1v1, 8 for 2v2; 2 for bracket formats, 4 for groups then
+    /// knockout).
     pub fn players_required_to_start(&self) -> usize {
+        match self.format {
+            TournamentFormat::Elimination => {}
+            TournamentFormat::GroupsKnockout => return 4,
+            _ => return 2,
+        }
         match self.mode {
             TournamentMode::OneVOne => 4,
             TournamentMode::TwoVTwo => 8,
@@ -187,17 +548,117 @@ impl Tournament {
             .or_else(|| self.unused_players.iter_mut().find(|p| p.id == id))
     }
 
+    /// Record a win for an active or sitting-out player. Unknown ids are an error rather than
+    /// a silent no-op, so a bad id from a request never goes unnoticed.
+    pub fn add_win(&mut self, id: PlayerId) -> Result<&mut Player, TournamentError> {
+        let p = self
+            .get_player_mut_any(id)
+            .ok_or(TournamentError::PlayerNotFound(id))?;
+        p.add_win();
+        Ok(p)
+    }
+
+    /// Record a loss for an active or sitting-out player; returns them so the caller can
+    /// apply its elimination rule.
+    pub fn add_loss(&mut self, id: PlayerId) -> Result<&mut Player, TournamentError> {
+        let p = self
+            .get_player_mut_any(id)
+            .ok_or(TournamentError::PlayerNotFound(id))?;
+        p.add_loss();
+        Ok(p)
+    }
+
+    /// Record that an active player sat out a round.
+    pub fn record_sat_out(&mut self, id: PlayerId) -> Result<(), TournamentError> {
+        self.get_player_mut(id)
+            .ok_or(TournamentError::PlayerNotFound(id))?
+            .record_sat_out();
+        Ok(())
+    }
+
+    /// Whether any visit has been scored in a match, x01 or cricket.
+    pub fn has_visits(&self, match_id: MatchId) -> bool {
+        self.scores
+            .get(&match_id)
+            .is_some_and(|s| s.legs.iter().any(|l| !l.visits.is_empty()))
+            || self.cricket.get(&match_id).is_some_and(|c| c.has_visits())
+    }
+
+    /// Look up any player by id: active, eliminated, or knocked out in the semi-finals.
+    pub fn find_player(&self, id: PlayerId) -> Option<&Player> {
+        self.all_players().into_iter().find(|p| p.id == id)
+    }
+
+    /// Every player in this tournament once, with their latest stats: active players first, then
+    /// eliminated players, then semi-final losers (who only remain in the bracket snapshot).
+    pub fn all_players(&self) -> Vec<&Player> {
+        let mut seen = std::collections::HashSet::new();
+        self.players
+            .iter()
+            .chain(self.unused_players.iter())
+            .chain(self.eliminated_players.iter())
+            .chain(self.bracket_semi_final_players.iter().flatten())
+            .filter(|p| seen.insert(p.id))
+            .collect()
+    }
+
     /// Add a player (valid in Setup, GroupPlay, or FinalSelection). Names must be unique (case-insensitive).
+    /// Pairs tournaments take players only when they are drawn into teams at the start.
     pub fn add_player(&mut self, name: impl Into<String>) -> Result<(), TournamentError> {
+        if self.entry_type != EntryType::Singles && !self.draws_pairs() {
+            return Err(TournamentError::WrongEntryType);
+        }
+        self.add_entrant(name.into(), Vec::new())
+    }
+
+    /// Enter a two-person team in a pairs tournament (same states and name rules as
+    /// [`Self::add_player`]). A person can only be in one team per tournament.
+    pub fn add_pair(&mut self, name: &str, members: &[String]) -> Result<(), TournamentError> {
+        if self.entry_type != EntryType::Pairs || self.draws_pairs() {
+            return Err(TournamentError::WrongEntryType);
+        }
+        let members: Vec<String> = members.iter().map(|m| m.trim().to_string()).collect();
+        let valid = match members.as_slice() {
+            [a, b] => !a.is_empty() && !b.is_empty() && !a.eq_ignore_ascii_case(b),
+            _ => false,
+        };
+        if !valid {
+            return Err(TournamentError::InvalidPair);
+        }
+        if members
+            .iter()
+            .any(|m| m.chars().count() > MAX_PLAYER_NAME_LEN)
+        {
+            return Err(TournamentError::PlayerNameTooLong {
+                max: MAX_PLAYER_NAME_LEN,
+            });
+        }
+        let taken = members.iter().find(|m| {
+            self.players
+                .iter()
+                .flat_map(|p| &p.members)
+                .any(|other| other.eq_ignore_ascii_case(m))
+        });
+        if let Some(m) = taken {
+            return Err(TournamentError::PlayerInAnotherPair(m.clone()));
+        }
+        self.add_entrant(name.to_string(), members)
+    }
+
+    fn add_entrant(&mut self, name: String, members: Vec<String>) -> Result<(), TournamentError> {
         use TournamentState::*;
         if !matches!(self.state, Setup | GroupPlay | FinalSelection) {
             return Err(TournamentError::InvalidState);
         }
-        let name = name.into();
         let name_trimmed = name.trim();
         if name_trimmed.is_empty() {
             return Err(TournamentError::EmptyPlayerName);
         }
+        if name_trimmed.chars().count() > MAX_PLAYER_NAME_LEN {
+            return Err(TournamentError::PlayerNameTooLong {
+                max: MAX_PLAYER_NAME_LEN,
+            });
+        }
         let is_duplicate = self
             .players
             .iter()
@@ -205,11 +666,14 @@ impl Tournament {
         if is_duplicate {
             return Err(TournamentError::DuplicatePlayerName);
         }
-        self.players.push(Player::new(name_trimmed));
+        let mut player = Player::new(name_trimmed);
+        player.seed = self.players.iter().map(|p| p.seed).max().unwrap_or(0) + 1;
+        player.members = members;
+        self.players.push(player);
         Ok(())
     }
 
-    /// Remove a player by id (only valid in Setup).
+    /// Remove a player by id (only valid in Setup). Seeds below theirs move up to close the gap.
     pub fn remove_player(&mut self, player_id: PlayerId) -> Result<(), TournamentError> {
         if self.state != TournamentState::Setup {
             return Err(TournamentError::InvalidState);
@@ -220,9 +684,116 @@ impl Tournament {
             .position(|p| p.id == player_id)
             .ok_or(TournamentError::PlayerNotFound(player_id))?;
         self.players.remove(idx);
+        self.compact_seeds();
         Ok(())
     }
 
+    /// Rename a player (trimmed, same rules as [`Self::add_player`]); allowed in any state.
+    /// Every copy of the player is renamed (active, eliminated and semi-final lists); matches
+    /// refer to players by id so they are unaffected. A change of case only is not a duplicate.
+    pub fn rename_player(
+        &mut self,
+        player_id: PlayerId,
+        name: &str,
+    ) -> Result<(), TournamentError> {
+        let name = name.trim();
+        if name.is_empty() {
+            return Err(TournamentError::EmptyPlayerName);
+        }
+        if name.chars().count() > MAX_PLAYER_NAME_LEN {
+            return Err(TournamentError::PlayerNameTooLong {
+                max: MAX_PLAYER_NAME_LEN,
+            });
+        }
+        if self.find_player(player_id).is_none() {
+            return Err(TournamentError::PlayerNotFound(player_id));
+        }
+        let is_duplicate = self
+            .all_players()
+            .iter()
+            .any(|p| p.id != player_id && p.name.eq_ignore_ascii_case(name));
+        if is_duplicate {
+            return Err(TournamentError::DuplicatePlayerName);
+        }
+        for p in self.player_copies_mut().filter(|p| p.id == player_id) {
+            p.name = name.to_string();
+        }
+        Ok(())
+    }
+
+    /// Merge player `from` into player `into` (both registered in Setup): `into` takes on
+    /// `from`'s results and totals (see [`Player::absorb`]) and `from` is removed. Once the
+    /// tournament has started both are in the draw, which can't be rewritten, so this fails
+    /// with [`TournamentError::MergeAfterStart`].
+    pub fn merge_players(&mut self, from: PlayerId, into: PlayerId) -> Result<(), TournamentError> {
+        for id in [from, into] {
+            if self.find_player(id).is_none() {
+                return Err(TournamentError::PlayerNotFound(id));
+            }
+        }
+        if from == into {
+            return Ok(());
+        }
+        if self.state != TournamentState::Setup {
+            return Err(TournamentError::MergeAfterStart);
+        }
+        let idx = self
+            .players
+            .iter()
+            .position(|p| p.id == from)
+            .ok_or(TournamentError::PlayerNotFound(from))?;
+        let source = self.players.remove(idx);
+        self.get_player_mut(into)
+            .ok_or(TournamentError::PlayerNotFound(into))?
+            .absorb(source);
+        self.compact_seeds();
+        Ok(())
+    }
+
+    /// Every stored copy of every player, including the semi-final display list.
+    pub(crate) fn player_copies_mut(&mut self) -> impl Iterator<Item = &mut Player> {
+        self.players
+            .iter_mut()
+            .chain(self.unused_players.iter_mut())
+            .chain(self.eliminated_players.iter_mut())
+            .chain(self.last_eliminated_players.iter_mut())
+            .chain(self.bracket_semi_final_players.iter_mut().flatten())
+    }
+
+    /// Reassign seeds 1..N in the given order (only valid in Setup). `order` must contain every
+    /// player id exactly once.
+    pub fn set_seeds(&mut self, order: &[PlayerId]) -> Result<(), TournamentError> {
+        if self.state != TournamentState::Setup {
+            return Err(TournamentError::SeedingLocked);
+        }
+        if let Some(&unknown) = order
+            .iter()
+            .find(|id| !self.players.iter().any(|p| p.id == **id))
+        {
+            return Err(TournamentError::PlayerNotFound(unknown));
+        }
+        let unique: std::collections::HashSet<_> = order.iter().collect();
+        if order.len() != self.players.len() || unique.len() != order.len() {
+            return Err(TournamentError::InvalidSeedOrder);
+        }
+        for (seed, id) in (1..).zip(order) {
+            if let Some(p) = self.get_player_mut(*id) {
+                p.seed = seed;
+            }
+        }
+        Ok(())
+    }
+
+    /// Renumber active players' seeds 1..N keeping their current order; unseeded players (0)
+    /// go last in registration order.
+    pub fn compact_seeds(&mut self) {
+        let mut order: Vec<usize> = (0..self.players.len()).collect();
+        order.sort_by_key(|&i| (self.players[i].seed == 0, self.players[i].seed));
+        for (seed, i) in (1..).zip(order) {
+            self.players[i].seed = seed;
+        }
+    }
+
     /// Set max losses before elimination (only valid in Setup).
     pub fn set_max_losses(&mut self, max_losses: u32) -> Result<(), TournamentError> {
         if self.state != TournamentState::Setup {
@@ -232,15 +803,102 @@ impl Tournament {
         Ok(())
     }
 
-    /// Set mode 1v1 or 2v2 (only valid in Setup).
+    /// Choose whether walkovers count towards the winner's wins (only valid in Setup, so every
+    /// walkover in a tournament is treated the same).
+    pub fn set_walkover_counts_as_win(&mut self, counts: bool) -> Result<(), TournamentError> {
+        if self.state != TournamentState::Setup {
+            return Err(TournamentError::InvalidState);
+        }
+        self.walkover_counts_as_win = counts;
+        Ok(())
+    }
+
+    /// Choose whether first-round losers go into a plate (only valid in Setup, and only for
+    /// single elimination).
+    pub fn set_plate(&mut self, plate: bool) -> Result<(), TournamentError> {
+        if self.state != TournamentState::Setup
+            || (plate && self.format != TournamentFormat::SingleElimination)
+        {
+            return Err(TournamentError::InvalidState);
+        }
+        self.plate = plate;
+        Ok(())
+    }
+
+    /// Choose the draw made when the tournament starts (only valid in Setup). Random and
+    /// protected draws are for single and double elimination. A balanced draw is for pairs
+    /// tournaments in any format but groups then knockout, and changes what is entered (people
+    /// rather than teams), so it can only be chosen or left before anyone has entered.
+    pub fn set_draw_mode(&mut self, mode: DrawMode) -> Result<(), TournamentError> {
+        let knockout = matches!(
+            self.format,
+            TournamentFormat::SingleElimination | TournamentFormat::DoubleElimination
+        );
+        let allowed = match mode {
+            DrawMode::Seeded => true,
+            DrawMode::Random | DrawMode::Protected => knockout,
+            DrawMode::Balanced => {
+                self.entry_type == EntryType::Pairs
+                    && self.format != TournamentFormat::GroupsKnockout
+            }
+        };
+        let entries_change = (mode == DrawMode::Balanced) != self.draws_pairs();
+        if self.state != TournamentState::Setup
+            || !allowed
+            || (entries_change && !self.players.is_empty())
+        {
+            return Err(TournamentError::InvalidState);
+        }
+        self.draw_mode = mode;
+        Ok(())
+    }
+
+    /// A pairs tournament whose people are entered one by one and drawn into teams at the
+    /// start ([`DrawMode::Balanced`]).
+    pub fn draws_pairs(&self) -> bool {
+        self.entry_type == EntryType::Pairs && self.draw_mode == DrawMode::Balanced
+    }
+
+    /// Set the display name (trimmed; empty clears it). Allowed in any state.
+    pub fn set_name(&mut self, name: &str) -> Result<(), TournamentError> {
+        let name = name.trim();
+        if name.chars().count() > MAX_TOURNAMENT_NAME_LEN {
+            return Err(TournamentError::TournamentNameTooLong {
+                max: MAX_TOURNAMENT_NAME_LEN,
+            });
+        }
+        self.name = name.to_string();
+        Ok(())
+    }
+
+    /// Set mode 1v1 or 2v2 (only valid in Setup). Pairs tournaments are 1v1: each side of a
+    /// match is one team.
     pub fn set_mode(&mut self, mode: TournamentMode) -> Result<(), TournamentError> {
         if self.state != TournamentState::Setup {
             return Err(TournamentError::InvalidState);
         }
+        if self.entry_type == EntryType::Pairs && mode != TournamentMode::OneVOne {
+            return Err(TournamentError::UnsupportedMode);
+        }
         self.mode = mode;
         Ok(())
     }
 
+    /// Choose singles or pairs entries, before anyone has entered. Pairs needs 1v1 mode.
+    pub fn set_entry_type(&mut self, entry_type: EntryType) -> Result<(), TournamentError> {
+        if self.state != TournamentState::Setup || !self.players.is_empty() {
+            return Err(TournamentError::InvalidState);
+        }
+        if entry_type == EntryType::Pairs && self.mode != TournamentMode::OneVOne {
+            return Err(TournamentError::UnsupportedMode);
+        }
+        if entry_type == EntryType::Singles && self.draw_mode == DrawMode::Balanced {
+            self.draw_mode = DrawMode::Seeded;
+        }
+        self.entry_type = entry_type;
+        Ok(())
+    }
+
     /// Set a player's loss count manually (GroupPlay or FinalSelection). Player must be active (in players or unused_players).
     /// When no matches have been generated yet, we do not set eliminated=true so that "Generate matches" still has enough players.
     pub fn set_player_losses(
@@ -293,23 +951,58 @@ impl Tournament {
     }
 
     /// Restart tournament: go back to Setup with same player names (active + eliminated). Clears matches and state.
+    /// Keeps the id, name, creation time, format, match formats, entry type (and teams), draw mode,
+    /// plate and boards (now free) so clients holding the id keep working.
     pub fn restart_tournament(&mut self) -> Result<(), TournamentError> {
-        if self.state != TournamentState::GroupPlay && self.state != TournamentState::FinalSelection
-        {
+        use TournamentState::*;
+        if !matches!(self.state, GroupPlay | FinalSelection | BracketPlay) {
             return Err(TournamentError::InvalidState);
         }
-        let names: Vec<String> = self
+        let mut seeded: Vec<&Player> = self
             .players
             .iter()
             .chain(self.unused_players.iter())
             .chain(self.eliminated_players.iter())
-            .map(|p| p.name.clone())
             .collect();
-        let max_losses = self.max_losses;
-        let mode = self.mode;
-        *self = Self::new(max_losses, mode);
-        for name in names {
-            let _ = self.add_player(name);
+        // Re-add in seed order so the restarted tournament keeps the same seeding, and with the
+        // rating each player brought in (results from this run are discarded) and their handicap.
+        seeded.sort_by_key(|p| p.seed);
+        let entrants: Vec<(String, Vec<String>, f64, Handicap)> = seeded
+            .into_iter()
+            .map(|p| {
+                let rating = p
+                    .rating_history
+                    .first()
+                    .map_or(p.rating, |c| c.rating_before);
+                (p.name.clone(), p.members.clone(), rating, p.handicap)
+            })
+            .collect();
+        *self = Self {
+            id: self.id,
+            name: std::mem::take(&mut self.name),
+            created_at: self.created_at,
+            format: self.format,
+            rating_k: self.rating_k,
+            boards: self
+                .boards
+                .iter()
+                .map(|b| Board::new(b.name.clone()))
+                .collect(),
+            entry_type: self.entry_type,
+            walkover_counts_as_win: self.walkover_counts_as_win,
+            plate: self.plate,
+            draw_mode: self.draw_mode,
+            match_formats: std::mem::take(&mut self.match_formats),
+            version: self.version,
+            ..Self::new(self.max_losses, self.mode)
+        };
+        for (name, members, rating, handicap) in entrants {
+            if self.add_entrant(name, members).is_ok() {
+                if let Some(p) = self.players.last_mut() {
+                    p.rating = rating;
+                    p.handicap = handicap;
+                }
+            }
         }
         Ok(())
     }
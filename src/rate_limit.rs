@@ -0,0 +1,133 @@
+//! Per-client request limits for the API: a token bucket per IP address, and a cap on request
+//! body size.
+//!
+//! Each client may make a burst of requests at once, then `per_second` more as its bucket
+//! refills. Buckets live in memory; ones left idle are evicted so a long event doesn't
+//! collect every address that ever connected.
+
+use crate::avatars::MAX_AVATAR_BYTES;
+use std::collections::HashMap;
+use std::net::IpAddr;
+use std::sync::Mutex;
+use std::time::{Duration, Instant};
+
+/// Requests per second a client may keep up, unless configured otherwise.
+pub const DEFAULT_REQUESTS_PER_SECOND: f64 = 20.0;
+
+/// Requests a client may make at once, unless configured otherwise.
+pub const DEFAULT_BURST: u32 = 40;
+
+/// Largest request body accepted, except on the routes [`body_limit`] allows more.
+pub const MAX_BODY_BYTES: usize = 1024 * 1024;
+
+/// Largest player import body (a CSV upload or JSON list of names).
+pub const MAX_IMPORT_BODY_BYTES: usize = 4 * 1024 * 1024;
+
+/// Largest player photo upload: the photo itself plus room for the multipart framing.
+pub const MAX_AVATAR_BODY_BYTES: usize = MAX_AVATAR_BYTES + 64 * 1024;
+
+/// Largest backup accepted for a restore.
+pub const MAX_RESTORE_BODY_BYTES: usize = 64 * 1024 * 1024;
+
+/// One client's bucket: tokens left and when it was last topped up.
+#[derive(Clone, Copy, Debug)]
+struct Bucket {
+    tokens: f64,
+    updated: Instant,
+}
+
+/// Token buckets by client address.
+#[derive(Debug)]
+pub struct RateLimiter {
+    per_second: f64,
+    burst: u32,
+    buckets: Mutex<HashMap<IpAddr, Bucket>>,
+}
+
+impl RateLimiter {
+    /// A limiter refilling `per_second` tokens a second up to `burst`. Both are at least one
+    /// (a smaller rate is raised to one request a second).
+    pub fn new(per_second: f64, burst: u32) -> Self {
+        let per_second = if per_second.is_finite() {
+            per_second.max(1.0)
+        } else {
+            DEFAULT_REQUESTS_PER_SECOND
+        };
+        Self {
+            per_second,
+            burst: burst.max(1),
+            buckets: Mutex::new(HashMap::new()),
+        }
+    }
+
+    pub fn per_second(&self) -> f64 {
+        self.per_second
+    }
+
+    pub fn burst(&self) -> u32 {
+        self.burst
+    }
+
+    /// Take one token for a request from `ip` at `now`. Err with how long until a token is
+    /// free when the bucket is empty.
+    pub fn check(&self, ip: IpAddr, now: Instant) -> Result<(), Duration> {
+        let mut buckets = self.buckets.lock().unwrap_or_else(|e| e.into_inner());
+        let burst = f64::from(self.burst);
+        let bucket = buckets.entry(ip).or_insert(Bucket {
+            tokens: burst,
+            updated: now,
+        });
+        let elapsed = now.saturating_duration_since(bucket.updated).as_secs_f64();
+        bucket.tokens = (bucket.tokens + elapsed * self.per_second).min(burst);
+        bucket.updated = now;
+        if bucket.tokens >= 1.0 {
+            bucket.tokens -= 1.0;
+            return Ok(());
+        }
+        Err(Duration::from_secs_f64(
+            (1.0 - bucket.tokens) / self.per_second,
+        ))
+    }
+
+    /// Drop the buckets of clients with no request for `idle` or longer. A dropped client
+    /// starts again with a full bucket, which it would have refilled to anyway. Returns how
+    /// many were dropped.
+    pub fn evict_idle(&self, now: Instant, idle: Duration) -> usize {
+        let mut buckets = self.buckets.lock().unwrap_or_else(|e| e.into_inner());
+        let before = buckets.len();
+        buckets.retain(|_, b| now.saturating_duration_since(b.updated) < idle);
+        before - buckets.len()
+    }
+
+    /// Clients currently tracked.
+    pub fn len(&self) -> usize {
+        self.buckets.lock().unwrap_or_else(|e| e.into_inner()).len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.len() == 0
+    }
+}
+
+/// Whether a request counts against its client's limit: every `/api` route except the health
+/// check, and never `/ping` or a WebSocket upgrade. `upgrade` is the raw `Upgrade` header.
+pub fn is_rate_limited(path: &str, upgrade: Option<&str>) -> bool {
+    if upgrade.is_some_and(|u| u.eq_ignore_ascii_case("websocket")) {
+        return false;
+    }
+    if matches!(path, "/ping" | "/api/health") {
+        return false;
+    }
+    path == "/api" || path.starts_with("/api/")
+}
+
+/// Largest body accepted for a request to `path`.
+pub fn body_limit(path: &str) -> usize {
+    let segments: Vec<&str> = path.trim_matches('/').split('/').collect();
+    match segments.as_slice() {
+        ["api", "tournaments", _, "players", "import"] => MAX_IMPORT_BODY_BYTES,
+        ["api", "players", _, "avatar"] => MAX_AVATAR_BODY_BYTES,
+        ["api", "admin", "restore"] => MAX_RESTORE_BODY_BYTES,
+        _ => MAX_BODY_BYTES,
+    }
+}
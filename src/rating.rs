@@ -0,0 +1,124 @@
+//! Elo-style ratings: updated after every result and kept with a full history.
+
+use crate::handicap::played_with_handicap;
+use crate::models::{MatchId, Player, PlayerId, RatingChange, Tournament, TournamentId};
+use chrono::Utc;
+
+/// K-factor used unless the server is configured otherwise.
+pub const DEFAULT_K_FACTOR: f64 = 32.0;
+
+/// Expected score (0..1) of a player rated `rating` against `opponent`.
+pub fn expected_score(rating: f64, opponent: f64) -> f64 {
+    1.0 / (1.0 + 10f64.powf((opponent - rating) / 400.0))
+}
+
+/// Points the winner gains and the loser drops: `k * (1 - expected score of the winner)`.
+pub fn elo_delta(winner: f64, loser: f64, k: f64) -> f64 {
+    k * (1.0 - expected_score(winner, loser))
+}
+
+/// Update two players' ratings for one result and record it in both histories.
+pub fn update_elo(winner: &mut Player, loser: &mut Player, k: f64, match_id: MatchId) {
+    let delta = elo_delta(winner.rating, loser.rating, k);
+    let loser_name = loser.name.clone();
+    apply(loser, match_id, winner.name.clone(), -delta);
+    apply(winner, match_id, loser_name, delta);
+}
+
+/// Rate a result between two sides (one or two players each) in `tournament`. Each side is
+/// rated at its average; every winner gains and every loser drops the same amount. A match
+/// played with a handicap isn't rated.
+pub(crate) fn rate_result(
+    tournament: &mut Tournament,
+    match_id: MatchId,
+    winners: &[PlayerId],
+    losers: &[PlayerId],
+) {
+    if played_with_handicap(tournament, match_id) {
+        return;
+    }
+    let side = |ids: &[PlayerId]| -> Option<(f64, String)> {
+        let players: Vec<&Player> = ids
+            .iter()
+            .map(|&id| tournament.find_player(id))
+            .collect::<Option<_>>()?;
+        if players.is_empty() {
+            return None;
+        }
+        let rating = players.iter().map(|p| p.rating).sum::<f64>() / players.len() as f64;
+        let names: Vec<&str> = players.iter().map(|p| p.name.as_str()).collect();
+        Some((rating, names.join(" & ")))
+    };
+    let (Some((winning, winner_names)), Some((losing, loser_names))) =
+        (side(winners), side(losers))
+    else {
+        return;
+    };
+    let delta = elo_delta(winning, losing, tournament.rating_k);
+    for &id in winners {
+        if let Some(p) = tournament.get_player_mut_any(id) {
+            apply(p, match_id, loser_names.clone(), delta);
+        }
+    }
+    for &id in losers {
+        if let Some(p) = tournament.get_player_mut_any(id) {
+            apply(p, match_id, winner_names.clone(), -delta);
+        }
+    }
+}
+
+/// Take back the rating change a player got for `match_id` (when a result is corrected).
+pub(crate) fn revert_result(player: &mut Player, match_id: MatchId) {
+    if let Some(i) = player
+        .rating_history
+        .iter()
+        .rposition(|c| c.match_id == match_id)
+    {
+        let change = player.rating_history.remove(i);
+        player.rating -= change.rating_after - change.rating_before;
+    }
+}
+
+/// Rating changes for everyone named `name` (case-insensitive) across `tournaments`, oldest
+/// first, with the tournament each came from.
+pub fn rating_history<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    name: &str,
+) -> Vec<(TournamentId, RatingChange)> {
+    let mut history: Vec<(TournamentId, RatingChange)> = tournaments
+        .into_iter()
+        .flat_map(|t| {
+            t.all_players()
+                .into_iter()
+                .filter(|p| p.name.eq_ignore_ascii_case(name))
+                .flat_map(|p| p.rating_history.iter().cloned())
+                .map(|c| (t.id, c))
+                .collect::<Vec<_>>()
+        })
+        .collect();
+    history.sort_by_key(|(_, c)| c.at);
+    history
+}
+
+/// Current rating of the player named `name`: the rating after their latest update in any
+/// tournament, or None if they have never been rated.
+pub fn latest_rating<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    name: &str,
+) -> Option<f64> {
+    rating_history(tournaments, name)
+        .last()
+        .map(|(_, c)| c.rating_after)
+}
+
+fn apply(player: &mut Player, match_id: MatchId, opponent: String, delta: f64) {
+    let before = player.rating;
+    player.rating += delta;
+    player.rating_history.push(RatingChange {
+        match_id,
+        opponent,
+        rating_before: before,
+        rating_after: player.rating,
+        at: Utc::now(),
+    });
+}
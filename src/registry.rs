@@ -0,0 +1,423 @@
+//! Thread-safe in-memory store of tournaments by id, with last-activity tracking for cleanup.
+
+use crate::metrics::add_activity;
+use crate::models::{Tournament, TournamentError, TournamentId};
+use crate::store::{read_snapshot, write_snapshot, TournamentStore};
+use crate::versions::{bump_versions, Precondition, Stale};
+use std::collections::HashMap;
+use std::path::Path;
+use std::sync::{Mutex, RwLock};
+use std::time::{Duration, Instant};
+
+/// Errors from registry operations.
+#[derive(Clone, Debug, Eq, PartialEq)]
+pub enum RegistryError {
+    /// No tournament with this id (never created, or removed after inactivity).
+    TournamentNotFound(TournamentId),
+    /// A writer panicked while holding the lock.
+    LockPoisoned,
+    /// The tournament operation itself failed.
+    Tournament(TournamentError),
+    /// The store could not be read or written; nothing was changed (by
+    /// [`TournamentRegistry::update_all`], nothing past the write that failed).
+    Storage(String),
+    /// The change was made against a version that is no longer current (see
+    /// [`crate::versions`]); nothing was changed.
+    Stale(Stale),
+}
+
+impl std::fmt::Display for RegistryError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            RegistryError::TournamentNotFound(_) => write!(f, "No tournament"),
+            RegistryError::LockPoisoned => write!(f, "lock error"),
+            RegistryError::Tournament(e) => write!(f, "{}", e),
+            RegistryError::Storage(e) => write!(f, "Could not save tournament: {}", e),
+            RegistryError::Stale(_) => write!(f, "Changed since it was loaded"),
+        }
+    }
+}
+
+impl From<TournamentError> for RegistryError {
+    fn from(e: TournamentError) -> Self {
+        RegistryError::Tournament(e)
+    }
+}
+
+/// Told of every change the registry makes to a tournament, once it is saved, with the
+/// tournament before and after. Called under the registry's lock, so it should only note the
+/// change (see [`crate::webhooks::Dispatcher`]) and leave slow work to another thread.
+pub trait ChangeListener: Send + Sync {
+    fn changed(&self, before: &Tournament, after: &Tournament);
+}
+
+/// Tournament data + last activity time (for auto-cleanup). The time has a lock of its own so
+/// a read can refresh it under the registry's read lock.
+struct TournamentEntry {
+    tournament: Tournament,
+    last_activity: Mutex<Instant>,
+}
+
+impl TournamentEntry {
+    fn new(tournament: Tournament, now: Instant) -> Self {
+        Self {
+            tournament,
+            last_activity: Mutex::new(now),
+        }
+    }
+
+    fn touch(&self) {
+        *self.last_activity.lock().unwrap_or_else(|e| e.into_inner()) = Instant::now();
+    }
+
+    fn idle_for(&self) -> Duration {
+        self.last_activity
+            .lock()
+            .unwrap_or_else(|e| e.into_inner())
+            .elapsed()
+    }
+}
+
+/// All tournaments by id behind one `RwLock`: reads share it, changes hold it alone. Every
+/// access that finds a tournament refreshes its activity time.
+/// With a store, every insert/update is written through and cleanup deletes the stored copy.
+#[derive(Default)]
+pub struct TournamentRegistry {
+    entries: RwLock<HashMap<TournamentId, TournamentEntry>>,
+    store: Option<Box<dyn TournamentStore>>,
+    listener: Option<Box<dyn ChangeListener>>,
+}
+
+impl TournamentRegistry {
+    /// Create an empty, memory-only registry.
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Create a registry backed by `store`, loading every tournament already in it.
+    pub fn with_store(store: Box<dyn TournamentStore>) -> std::io::Result<Self> {
+        let entries = store
+            .load_all()?
+            .into_iter()
+            .map(|tournament| {
+                (
+                    tournament.id,
+                    TournamentEntry::new(tournament, Instant::now()),
+                )
+            })
+            .collect();
+        Ok(Self {
+            entries: RwLock::new(entries),
+            store: Some(store),
+            listener: None,
+        })
+    }
+
+    /// This registry, telling `listener` of every change [`Self::update`] and
+    /// [`Self::update_all`] make.
+    pub fn with_listener(mut self, listener: impl ChangeListener + 'static) -> Self {
+        self.listener = Some(Box::new(listener));
+        self
+    }
+
+    fn notify(&self, before: &Tournament, after: &Tournament) {
+        if let Some(listener) = &self.listener {
+            listener.changed(before, after);
+        }
+    }
+
+    /// Check the store can take writes; None for a memory-only registry.
+    pub fn check_store(&self) -> Option<std::io::Result<()>> {
+        self.store.as_ref().map(|store| store.check())
+    }
+
+    fn persist(&self, tournament: &Tournament) -> Result<(), RegistryError> {
+        match &self.store {
+            Some(store) => store
+                .save(tournament)
+                .map_err(|e| RegistryError::Storage(e.to_string())),
+            None => Ok(()),
+        }
+    }
+
+    /// Store a tournament (replacing any with the same id) and return a copy of it.
+    pub fn insert(&self, tournament: Tournament) -> Result<Tournament, RegistryError> {
+        let mut g = self
+            .entries
+            .write()
+            .map_err(|_| RegistryError::LockPoisoned)?;
+        self.persist(&tournament)?;
+        let copy = tournament.clone();
+        g.insert(
+            tournament.id,
+            TournamentEntry::new(tournament, Instant::now()),
+        );
+        Ok(copy)
+    }
+
+    /// Copy of a tournament by id, taken under the read lock (so it doesn't hold up other
+    /// reads, and waits only for a change in progress).
+    pub fn get(&self, id: TournamentId) -> Result<Tournament, RegistryError> {
+        let g = self
+            .entries
+            .read()
+            .map_err(|_| RegistryError::LockPoisoned)?;
+        let entry = g.get(&id).ok_or(RegistryError::TournamentNotFound(id))?;
+        entry.touch();
+        Ok(entry.tournament.clone())
+    }
+
+    /// Run `f` on the tournament while holding the write lock and return a copy of the result.
+    /// `f` works on a copy that only replaces the stored tournament once `f` and the store write
+    /// both succeed, so a failed operation never leaves a half-applied change behind (nor counts
+    /// towards the [`crate::metrics`] activity totals). A finished
+    /// tournament is frozen: `f` isn't run and the result is
+    /// [`TournamentError::TournamentFinished`]. A change made bumps the tournament's version
+    /// and those of the matches it touched (see [`crate::versions`]).
+    pub fn update<F>(&self, id: TournamentId, f: F) -> Result<Tournament, RegistryError>
+    where
+        F: FnOnce(&mut Tournament) -> Result<(), TournamentError>,
+    {
+        self.update_if(id, None, f)
+    }
+
+    /// [`Self::update`], only made if `precondition` (when given) still holds when the lock is
+    /// taken; otherwise [`RegistryError::Stale`] with the tournament as it is, and `f` isn't
+    /// run. Checked before the finished check, so a client behind on a finished tournament
+    /// catches up first.
+    pub fn update_if<F>(
+        &self,
+        id: TournamentId,
+        precondition: Option<&Precondition>,
+        f: F,
+    ) -> Result<Tournament, RegistryError>
+    where
+        F: FnOnce(&mut Tournament) -> Result<(), TournamentError>,
+    {
+        self.update_if_seeing_all(id, precondition, |_, t| f(t))
+    }
+
+    /// [`Self::update_if`] where `f` also sees every tournament (this one as it was before
+    /// the change), under the same lock: a check across tournaments, such as that a player
+    /// being entered hasn't been deleted, can't be overtaken by a change to another one.
+    pub fn update_if_seeing_all<F>(
+        &self,
+        id: TournamentId,
+        precondition: Option<&Precondition>,
+        f: F,
+    ) -> Result<Tournament, RegistryError>
+    where
+        F: FnOnce(&[&Tournament], &mut Tournament) -> Result<(), TournamentError>,
+    {
+        let mut g = self
+            .entries
+            .write()
+            .map_err(|_| RegistryError::LockPoisoned)?;
+        let entry = g
+            .get_mut(&id)
+            .ok_or(RegistryError::TournamentNotFound(id))?;
+        entry.touch();
+        if let Some(p) = precondition.filter(|p| !p.holds(&entry.tournament)) {
+            return Err(RegistryError::Stale(Stale {
+                etag: p.current_etag(&entry.tournament),
+                tournament: Box::new(entry.tournament.clone()),
+            }));
+        }
+        if entry.tournament.finished_at.is_some() {
+            return Err(TournamentError::TournamentFinished.into());
+        }
+        let mut next = entry.tournament.clone();
+        let all: Vec<&Tournament> = g.values().map(|e| &e.tournament).collect();
+        f(&all, &mut next)?;
+        let entry = g
+            .get_mut(&id)
+            .ok_or(RegistryError::TournamentNotFound(id))?;
+        bump_versions(&entry.tournament, &mut next);
+        self.persist(&next)?;
+        add_activity(std::mem::take(&mut next.activity));
+        self.notify(&entry.tournament, &next);
+        entry.tournament = next.clone();
+        Ok(next)
+    }
+
+    /// Remove a tournament (and its stored copy). Returns the removed tournament.
+    pub fn remove(&self, id: TournamentId) -> Result<Tournament, RegistryError> {
+        let mut g = self
+            .entries
+            .write()
+            .map_err(|_| RegistryError::LockPoisoned)?;
+        if !g.contains_key(&id) {
+            return Err(RegistryError::TournamentNotFound(id));
+        }
+        if let Some(store) = &self.store {
+            store
+                .delete(id)
+                .map_err(|e| RegistryError::Storage(e.to_string()))?;
+        }
+        let entry = g.remove(&id).ok_or(RegistryError::TournamentNotFound(id))?;
+        Ok(entry.tournament)
+    }
+
+    /// Run `f` on every tournament as one change: each gets a copy, and nothing is replaced
+    /// unless `f` succeeds on all of them. Tournaments for which `f` returns true are written
+    /// to the store, replaced and refreshed (a store failure stops there; tournaments already
+    /// written keep the change). Returns how many changed. Unlike [`Self::update`] this reaches
+    /// finished tournaments too, so renames keep a player's history under one name.
+    pub fn update_all<F>(&self, f: F) -> Result<usize, RegistryError>
+    where
+        F: FnMut(&mut Tournament) -> Result<bool, TournamentError>,
+    {
+        self.update_all_checked(|_| Ok(()), f)
+    }
+
+    /// [`Self::update_all`], first running `check` on every tournament under the same lock;
+    /// nothing is changed if it fails.
+    pub fn update_all_checked<C, F>(&self, check: C, mut f: F) -> Result<usize, RegistryError>
+    where
+        C: FnOnce(&[&Tournament]) -> Result<(), TournamentError>,
+        F: FnMut(&mut Tournament) -> Result<bool, TournamentError>,
+    {
+        let mut g = self
+            .entries
+            .write()
+            .map_err(|_| RegistryError::LockPoisoned)?;
+        check(&g.values().map(|e| &e.tournament).collect::<Vec<_>>())?;
+        let mut changed = Vec::new();
+        for entry in g.values() {
+            let mut next = entry.tournament.clone();
+            if f(&mut next)? {
+                bump_versions(&entry.tournament, &mut next);
+                changed.push(next);
+            }
+        }
+        let count = changed.len();
+        for next in changed {
+            self.persist(&next)?;
+            if let Some(entry) = g.get_mut(&next.id) {
+                self.notify(&entry.tournament, &next);
+                entry.tournament = next;
+                entry.touch();
+            }
+        }
+        Ok(count)
+    }
+
+    /// Replace every tournament with `tournaments` as one change (a backup being restored).
+    /// The new set is built first and written to the store, old tournaments not in it
+    /// deleted; if any store write fails, every old tournament is written back and the new
+    /// ones deleted, and memory is left as it was. Only then is the new set swapped in.
+    pub fn replace_all(&self, tournaments: Vec<Tournament>) -> Result<(), RegistryError> {
+        let mut g = self
+            .entries
+            .write()
+            .map_err(|_| RegistryError::LockPoisoned)?;
+        let now = Instant::now();
+        let next: HashMap<TournamentId, TournamentEntry> = tournaments
+            .into_iter()
+            .map(|tournament| (tournament.id, TournamentEntry::new(tournament, now)))
+            .collect();
+        if let Some(store) = &self.store {
+            let written = next
+                .values()
+                .try_for_each(|e| store.save(&e.tournament))
+                .and_then(|()| {
+                    g.keys()
+                        .filter(|id| !next.contains_key(id))
+                        .try_for_each(|id| store.delete(*id))
+                });
+            if let Err(e) = written {
+                // Best effort: the store is put back as far as it will go.
+                for entry in g.values() {
+                    let _ = store.save(&entry.tournament);
+                }
+                for id in next.keys().filter(|id| !g.contains_key(id)) {
+                    let _ = store.delete(*id);
+                }
+                return Err(RegistryError::Storage(e.to_string()));
+            }
+        }
+        *g = next;
+        Ok(())
+    }
+
+    /// Copies of all tournaments (any order). Does not refresh activity.
+    pub fn list(&self) -> Result<Vec<Tournament>, RegistryError> {
+        let g = self
+            .entries
+            .read()
+            .map_err(|_| RegistryError::LockPoisoned)?;
+        Ok(g.values().map(|e| e.tournament.clone()).collect())
+    }
+
+    /// Number of stored tournaments.
+    pub fn len(&self) -> usize {
+        self.entries.read().map(|g| g.len()).unwrap_or(0)
+    }
+
+    /// Number of stored tournaments not yet finished.
+    pub fn active_count(&self) -> usize {
+        self.entries
+            .read()
+            .map(|g| {
+                g.values()
+                    .filter(|e| e.tournament.finished_at.is_none())
+                    .count()
+            })
+            .unwrap_or(0)
+    }
+
+    /// True if no tournaments are stored.
+    pub fn is_empty(&self) -> bool {
+        self.len() == 0
+    }
+
+    /// Write every tournament to the snapshot file at `path`. Returns how many were written.
+    pub fn write_snapshot(&self, path: &Path) -> Result<usize, RegistryError> {
+        let tournaments = self.list()?;
+        let count = tournaments.len();
+        write_snapshot(path, tournaments).map_err(|e| RegistryError::Storage(e.to_string()))?;
+        Ok(count)
+    }
+
+    /// Insert every tournament from the snapshot file at `path` (a missing file is empty),
+    /// replacing any with the same id. Returns how many were loaded.
+    pub fn load_snapshot(&self, path: &Path) -> std::io::Result<usize> {
+        let tournaments = read_snapshot(path)?;
+        let count = tournaments.len();
+        for tournament in tournaments {
+            self.insert(tournament)
+                .map_err(|e| std::io::Error::other(e.to_string()))?;
+        }
+        Ok(count)
+    }
+
+    /// Remove tournaments not accessed for `timeout` or longer; finished tournaments are kept.
+    /// Each is deleted from the store before it leaves memory: one the store can't delete is
+    /// logged and kept (to be tried again next time), and the rest are still removed.
+    /// Returns the ids of those removed, so what is kept alongside them can go too.
+    pub fn remove_inactive(&self, timeout: Duration) -> Result<Vec<TournamentId>, RegistryError> {
+        let mut g = self
+            .entries
+            .write()
+            .map_err(|_| RegistryError::LockPoisoned)?;
+        let expired: Vec<TournamentId> = g
+            .iter()
+            .filter(|(_, entry)| {
+                entry.tournament.finished_at.is_none() && entry.idle_for() >= timeout
+            })
+            .map(|(id, _)| *id)
+            .collect();
+        let mut removed = Vec::new();
+        for id in expired {
+            if let Some(store) = &self.store {
+                if let Err(e) = store.delete(id) {
+                    log::error!("Could not delete inactive tournament {}: {}", id, e);
+                    continue;
+                }
+            }
+            g.remove(&id);
+            removed.push(id);
+        }
+        Ok(removed)
+    }
+}
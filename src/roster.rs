@@ -0,0 +1,209 @@
+//! Renaming, merging and deleting players across tournaments. A player's history is tied
+//! together by name (case-insensitive), so a rename has to reach every tournament they played
+//! in, and every rating change that names them as the opponent.
+//!
+//! Deleting a player who has played only marks them deleted ([`Player::deleted_at`]): the
+//! matches they're in still show who played them, and the leaderboard keeps them as inactive,
+//! but they can't be entered again, under that name, until restored. A player with no
+//! recorded matches can be deleted for good ([`hard_delete_player`]).
+
+use crate::models::{Player, Tournament, TournamentError, TournamentState, MAX_PLAYER_NAME_LEN};
+use chrono::{DateTime, Utc};
+
+/// Rename the player called `from` to `to` in one tournament, and rewrite `from` to `to` in
+/// the opponent names of rating histories. Returns whether anything changed.
+///
+/// If a different player is already called `to`: with `merge` set and both registered in
+/// Setup, `from` is merged into them ([`Tournament::merge_players`]); without `merge` the
+/// rename fails with [`TournamentError::DuplicatePlayerName`]. A change of case only is a
+/// plain rename.
+pub fn rename_player(
+    tournament: &mut Tournament,
+    from: &str,
+    to: &str,
+    merge: bool,
+) -> Result<bool, TournamentError> {
+    let (from, to) = (from.trim(), to.trim());
+    if to.is_empty() {
+        return Err(TournamentError::EmptyPlayerName);
+    }
+    if to.chars().count() > MAX_PLAYER_NAME_LEN {
+        return Err(TournamentError::PlayerNameTooLong {
+            max: MAX_PLAYER_NAME_LEN,
+        });
+    }
+    let named = |t: &Tournament, name: &str| {
+        t.all_players()
+            .into_iter()
+            .find(|p| p.name.eq_ignore_ascii_case(name))
+            .map(|p| p.id)
+    };
+    let source = named(tournament, from);
+    let target = named(tournament, to).filter(|id| Some(*id) != source);
+    if target.is_some() && !merge {
+        return Err(TournamentError::DuplicatePlayerName);
+    }
+    let mut changed = match (source, target) {
+        (Some(source), Some(target)) => {
+            tournament.merge_players(source, target)?;
+            true
+        }
+        (Some(source), None) => {
+            tournament.rename_player(source, to)?;
+            true
+        }
+        (None, _) => false,
+    };
+    for change in tournament
+        .player_copies_mut()
+        .flat_map(|p| p.rating_history.iter_mut())
+    {
+        if let Some(renamed) = rename_in_opponent(&change.opponent, from, to) {
+            change.opponent = renamed;
+            changed = true;
+        }
+    }
+    Ok(changed)
+}
+
+/// Whether any tournament has a player called `name` (case-insensitive).
+pub fn player_exists<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    name: &str,
+) -> bool {
+    let name = name.trim();
+    tournaments.into_iter().any(|t| {
+        t.all_players()
+            .iter()
+            .any(|p| p.name.eq_ignore_ascii_case(name))
+    })
+}
+
+/// Whether the player called `name` has been deleted (and not restored).
+pub fn player_deleted<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    name: &str,
+) -> bool {
+    let name = name.trim();
+    tournaments.into_iter().any(|t| {
+        t.all_players()
+            .iter()
+            .any(|p| p.name.eq_ignore_ascii_case(name) && p.deleted_at.is_some())
+    })
+}
+
+/// Results recorded for the player called `name` over `tournaments`: their own, and those of
+/// the pairs teams they were in.
+pub fn recorded_matches<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    name: &str,
+) -> usize {
+    let name = name.trim();
+    let involves = |p: &Player| {
+        p.name.eq_ignore_ascii_case(name) || p.members.iter().any(|m| m.eq_ignore_ascii_case(name))
+    };
+    tournaments
+        .into_iter()
+        .flat_map(|t| t.all_players())
+        .filter(|p| involves(p))
+        .map(|p| (p.wins + p.losses) as usize)
+        .sum()
+}
+
+/// Mark the player called `name` deleted in one tournament, as of `at`. Returns whether
+/// anything changed: a player already deleted keeps the time they were deleted.
+///
+/// Fails with [`TournamentError::PlayerStillEntered`] if they're entered in a tournament that
+/// hasn't finished; remove or withdraw them there first.
+pub fn delete_player(
+    tournament: &mut Tournament,
+    name: &str,
+    at: DateTime<Utc>,
+) -> Result<bool, TournamentError> {
+    let name = name.trim();
+    let finished = tournament.state == TournamentState::Completed;
+    let mut changed = false;
+    for p in tournament.player_copies_mut() {
+        if !p.name.eq_ignore_ascii_case(name) {
+            continue;
+        }
+        if !finished {
+            return Err(TournamentError::PlayerStillEntered(p.name.clone()));
+        }
+        if p.deleted_at.is_none() {
+            p.deleted_at = Some(at);
+            changed = true;
+        }
+    }
+    Ok(changed)
+}
+
+/// Undo [`delete_player`] in one tournament. Returns whether anything changed.
+pub fn restore_player(tournament: &mut Tournament, name: &str) -> bool {
+    let name = name.trim();
+    let mut changed = false;
+    for p in tournament.player_copies_mut() {
+        if p.name.eq_ignore_ascii_case(name) && p.deleted_at.take().is_some() {
+            changed = true;
+        }
+    }
+    changed
+}
+
+/// Whether the player called `name` can be deleted for good: they have no recorded matches
+/// ([`TournamentError::PlayerHasMatches`] otherwise), and every tournament they're in is still
+/// in Setup, so removing them leaves no draw behind
+/// ([`TournamentError::PlayerStillEntered`] otherwise).
+pub fn check_hard_delete<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament> + Clone,
+    name: &str,
+) -> Result<(), TournamentError> {
+    let matches = recorded_matches(tournaments.clone(), name);
+    if matches > 0 {
+        return Err(TournamentError::PlayerHasMatches { matches });
+    }
+    let name = name.trim();
+    let drawn = tournaments.into_iter().find_map(|t| {
+        let p = t
+            .all_players()
+            .into_iter()
+            .find(|p| p.name.eq_ignore_ascii_case(name))?;
+        (t.state != TournamentState::Setup).then(|| p.name.clone())
+    });
+    match drawn {
+        Some(name) => Err(TournamentError::PlayerStillEntered(name)),
+        None => Ok(()),
+    }
+}
+
+/// Remove the player called `name` from one tournament, once [`check_hard_delete`] allows it.
+/// Returns whether they were in it.
+pub fn hard_delete_player(
+    tournament: &mut Tournament,
+    name: &str,
+) -> Result<bool, TournamentError> {
+    let name = name.trim();
+    let found = tournament
+        .players
+        .iter()
+        .find(|p| p.name.eq_ignore_ascii_case(name))
+        .map(|p| p.id);
+    match found {
+        Some(id) => tournament.remove_player(id).map(|()| true),
+        None => Ok(false),
+    }
+}
+
+/// `opponent` with `from` replaced by `to`, if it names `from` (alone or as one of a team
+/// joined with " & ").
+fn rename_in_opponent(opponent: &str, from: &str, to: &str) -> Option<String> {
+    let names: Vec<&str> = opponent.split(" & ").collect();
+    if !names.iter().any(|n| n.eq_ignore_ascii_case(from)) {
+        return None;
+    }
+    let renamed: Vec<&str> = names
+        .into_iter()
+        .map(|n| if n.eq_ignore_ascii_case(from) { to } else { n })
+        .collect();
+    Some(renamed.join(" & "))
+}
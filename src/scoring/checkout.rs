@@ -0,0 +1,232 @@
+//! Checkout suggestions: the preferred way to finish a score, as shown on the scoreboard.
+//!
+//! Routes come from the standard checkout chart rather than a search, so the suggestion is
+//! the one players expect (120 is T20 20 D20, not T20 T20... or some other valid split). Every
+//! chart route uses as few darts as the score allows, so with fewer darts left a score either
+//! has its usual route or no finish at all.
+
+use crate::scoring::x01::MAX_CHECKOUT;
+use serde::{Serialize, Serializer};
+use std::fmt;
+
+/// One dart of a route.
+#[derive(Clone, Copy, Debug, Eq, PartialEq)]
+pub enum Dart {
+    Single(u32),
+    Double(u32),
+    Treble(u32),
+    /// Outer bull (25).
+    OuterBull,
+    /// Bullseye (50), which counts as a double.
+    Bull,
+}
+
+impl Dart {
+    /// Points scored.
+    pub fn value(self) -> u32 {
+        match self {
+            Dart::Single(n) => n,
+            Dart::Double(n) => 2 * n,
+            Dart::Treble(n) => 3 * n,
+            Dart::OuterBull => 25,
+            Dart::Bull => 50,
+        }
+    }
+
+    /// Whether the dart can finish a leg.
+    pub fn is_double(self) -> bool {
+        matches!(self, Dart::Double(_) | Dart::Bull)
+    }
+
+    fn parse(s: &str) -> Option<Self> {
+        let number = |n: &str| n.parse().ok().filter(|n| (1..=20).contains(n));
+        match s {
+            "Bull" => Some(Dart::Bull),
+            "25" => Some(Dart::OuterBull),
+            _ => match s.split_at(1) {
+                ("D", n) => number(n).map(Dart::Double),
+                ("T", n) => number(n).map(Dart::Treble),
+                _ => number(s).map(Dart::Single),
+            },
+        }
+    }
+}
+
+/// "T20", "D16", "20", "25", "Bull".
+impl fmt::Display for Dart {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Dart::Single(n) => write!(f, "{}", n),
+            Dart::Double(n) => write!(f, "D{}", n),
+            Dart::Treble(n) => write!(f, "T{}", n),
+            Dart::OuterBull => write!(f, "25"),
+            Dart::Bull => write!(f, "Bull"),
+        }
+    }
+}
+
+impl Serialize for Dart {
+    fn serialize<S: Serializer>(&self, serializer: S) -> Result<S::Ok, S::Error> {
+        serializer.collect_str(self)
+    }
+}
+
+/// Scores from 2 to 170 that can't be finished in three darts.
+pub const BOGEY_NUMBERS: [u32; 7] = [159, 162, 163, 165, 166, 168, 169];
+
+/// Preferred route to finish `remaining` with `darts` darts left (1–3), or None when it can't
+/// be done: above 170, a bogey number, 1, or more than the darts left can reach (e.g. 120
+/// with two darts).
+pub fn checkout_route(remaining: u32, darts: u32) -> Option<Vec<Dart>> {
+    if !(1..=3).contains(&darts) || !(2..=MAX_CHECKOUT).contains(&remaining) {
+        return None;
+    }
+    let route = route_from_chart(remaining)?;
+    (route.len() <= darts as usize).then_some(route)
+}
+
+fn route_from_chart(remaining: u32) -> Option<Vec<Dart>> {
+    if remaining <= 40 {
+        // A double when even; otherwise a single leaving the best double (D16, D8, D4, ...).
+        if remaining.is_multiple_of(2) {
+            return Some(vec![Dart::Double(remaining / 2)]);
+        }
+        let double = [32, 16, 8, 4, 2]
+            .into_iter()
+            .find(|d| *d < remaining)
+            .expect("2 is below any odd score over 1");
+        return Some(vec![
+            Dart::Single(remaining - double),
+            Dart::Double(double / 2),
+        ]);
+    }
+    let (_, route) = CHART.iter().find(|(score, _)| *score == remaining)?;
+    route.split(' ').map(Dart::parse).collect()
+}
+
+/// Standard chart for 41–170 (bogey numbers left out).
+const CHART: &[(u32, &str)] = &[
+    (170, "T20 T20 Bull"),
+    (167, "T20 T19 Bull"),
+    (164, "T20 T18 Bull"),
+    (161, "T20 T17 Bull"),
+    (160, "T20 T20 D20"),
+    (158, "T20 T20 D19"),
+    (157, "T20 T19 D20"),
+    (156, "T20 T20 D18"),
+    (155, "T20 T19 D19"),
+    (154, "T20 T18 D20"),
+    (153, "T20 T19 D18"),
+    (152, "T20 T20 D16"),
+    (151, "T20 T17 D20"),
+    (150, "T20 T18 D18"),
+    (149, "T20 T19 D16"),
+    (148, "T20 T16 D20"),
+    (147, "T20 T17 D18"),
+    (146, "T20 T18 D16"),
+    (145, "T20 T15 D20"),
+    (144, "T20 T20 D12"),
+    (143, "T20 T17 D16"),
+    (142, "T20 T14 D20"),
+    (141, "T20 T19 D12"),
+    (140, "T20 T20 D10"),
+    (139, "T20 T13 D20"),
+    (138, "T20 T18 D12"),
+    (137, "T20 T19 D10"),
+    (136, "T20 T20 D8"),
+    (135, "T20 T17 D12"),
+    (134, "T20 T14 D16"),
+    (133, "T20 T19 D8"),
+    (132, "T20 T16 D12"),
+    (131, "T20 T13 D16"),
+    (130, "T20 T18 D8"),
+    (129, "T19 T16 D12"),
+    (128, "T18 T14 D16"),
+    (127, "T20 T17 D8"),
+    (126, "T19 T19 D6"),
+    (125, "25 T20 D20"),
+    (124, "T20 T16 D8"),
+    (123, "T19 T16 D9"),
+    (122, "T18 T20 D4"),
+    (121, "T20 T11 D14"),
+    (120, "T20 20 D20"),
+    (119, "T19 T12 D13"),
+    (118, "T20 18 D20"),
+    (117, "T20 17 D20"),
+    (116, "T20 16 D20"),
+    (115, "T20 15 D20"),
+    (114, "T20 14 D20"),
+    (113, "T20 13 D20"),
+    (112, "T20 12 D20"),
+    (111, "T20 11 D20"),
+    (110, "T20 Bull"),
+    (109, "T20 9 D20"),
+    (108, "T20 16 D16"),
+    (107, "T19 Bull"),
+    (106, "T20 10 D18"),
+    (105, "T20 13 D16"),
+    (104, "T18 Bull"),
+    (103, "T19 10 D18"),
+    (102, "T20 10 D16"),
+    (101, "T17 Bull"),
+    (100, "T20 D20"),
+    (99, "T19 10 D16"),
+    (98, "T20 D19"),
+    (97, "T19 D20"),
+    (96, "T20 D18"),
+    (95, "T19 D19"),
+    (94, "T18 D20"),
+    (93, "T19 D18"),
+    (92, "T20 D16"),
+    (91, "T17 D20"),
+    (90, "T20 D15"),
+    (89, "T19 D16"),
+    (88, "T16 D20"),
+    (87, "T17 D18"),
+    (86, "T18 D16"),
+    (85, "T15 D20"),
+    (84, "T20 D12"),
+    (83, "T17 D16"),
+    (82, "Bull D16"),
+    (81, "T19 D12"),
+    (80, "T20 D10"),
+    (79, "T19 D11"),
+    (78, "T18 D12"),
+    (77, "T19 D10"),
+    (76, "T20 D8"),
+    (75, "T17 D12"),
+    (74, "T14 D16"),
+    (73, "T19 D8"),
+    (72, "T16 D12"),
+    (71, "T13 D16"),
+    (70, "T18 D8"),
+    (69, "T19 D6"),
+    (68, "T20 D4"),
+    (67, "T17 D8"),
+    (66, "T10 D18"),
+    (65, "T19 D4"),
+    (64, "T16 D8"),
+    (63, "T13 D12"),
+    (62, "T10 D16"),
+    (61, "T15 D8"),
+    (60, "20 D20"),
+    (59, "19 D20"),
+    (58, "18 D20"),
+    (57, "17 D20"),
+    (56, "16 D20"),
+    (55, "15 D20"),
+    (54, "14 D20"),
+    (53, "13 D20"),
+    (52, "12 D20"),
+    (51, "11 D20"),
+    (50, "Bull"),
+    (49, "9 D20"),
+    (48, "16 D16"),
+    (47, "15 D16"),
+    (46, "6 D20"),
+    (45, "13 D16"),
+    (44, "12 D16"),
+    (43, "3 D20"),
+    (42, "10 D16"),
+    (41, "9 D16"),
+];
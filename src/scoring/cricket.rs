@@ -0,0 +1,334 @@
+//! Cricket: each side closes 15–20 and the bull with three marks apiece, scoring on numbers
+//! it has closed while the other side hasn't.
+//!
+//! A single is one mark, a double two and a treble three; darts anywhere else count for
+//! nothing. Marks past the third on a number score its value (25 for the bull) unless the
+//! other side has closed it too. A side wins the leg as soon as it has closed everything with
+//! at least as many points as the other side. Cut-throat turns the points round: they go on
+//! the side that hasn't closed the number, and the winner is the one that has closed
+//! everything with no more points than the other.
+
+use crate::models::{LegScore, PlayerId, Team};
+use crate::scoring::{MatchFormat, ScoringError};
+use serde::{Deserialize, Serialize};
+
+/// The bull's number in a [`CricketDart`] (it scores 25 a mark).
+pub const BULL: u32 = 25;
+/// Numbers in play, in the order the board is chalked: 20 down to 15, then the bull.
+pub const CRICKET_NUMBERS: [u32; 7] = [20, 19, 18, 17, 16, 15, BULL];
+/// Marks that close a number.
+pub const MARKS_TO_CLOSE: u32 = 3;
+
+/// One dart as thrown: where it landed and in which ring.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct CricketDart {
+    /// 1–20, [`BULL`] for the bull, 0 for a miss.
+    pub number: u32,
+    /// 1 single, 2 double, 3 treble. The bull has no treble; its double is the bullseye.
+    #[serde(default = "single")]
+    pub multiplier: u32,
+}
+
+fn single() -> u32 {
+    1
+}
+
+impl CricketDart {
+    /// Whether this is somewhere a dart can land.
+    pub fn is_valid(&self) -> bool {
+        match self.number {
+            0..=20 => (1..=3).contains(&self.multiplier),
+            BULL => (1..=2).contains(&self.multiplier),
+            _ => false,
+        }
+    }
+
+    /// Index of the number in [`CRICKET_NUMBERS`], if it is in play.
+    fn slot(&self) -> Option<usize> {
+        CRICKET_NUMBERS.iter().position(|&n| n == self.number)
+    }
+}
+
+/// One visit by one side, dart by dart.
+#[derive(Clone, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct CricketVisit {
+    pub team: Team,
+    pub darts: Vec<CricketDart>,
+    /// Marks the darts put on numbers in play, counting those past closing.
+    pub marks: u32,
+    /// Points the visit scored (in cut-throat, put on the other side).
+    pub points: u32,
+    /// Player who threw it, when the side is one player (None for a 2v2 side).
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub player: Option<PlayerId>,
+}
+
+/// Marks both sides have on one number, as the scoreboard chalks them.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, Serialize)]
+pub struct CricketMarks {
+    pub number: u32,
+    /// 0–3 marks, 3 being closed.
+    pub team_1: u32,
+    pub team_2: u32,
+    /// Closed by both sides, so it scores for nobody.
+    pub dead: bool,
+}
+
+/// One leg of cricket.
+#[derive(Clone, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct CricketLeg {
+    /// Side one's marks on each of [`CRICKET_NUMBERS`] (at most [`MARKS_TO_CLOSE`]).
+    pub marks_1: [u32; 7],
+    pub marks_2: [u32; 7],
+    pub points: LegScore,
+    #[serde(default)]
+    pub cut_throat: bool,
+    /// Side to throw next.
+    pub thrower: Team,
+    pub visits: Vec<CricketVisit>,
+    pub winner: Option<Team>,
+}
+
+impl CricketLeg {
+    pub fn new(first: Team, cut_throat: bool) -> Self {
+        Self {
+            marks_1: [0; 7],
+            marks_2: [0; 7],
+            points: LegScore::default(),
+            cut_throat,
+            thrower: first,
+            visits: Vec::new(),
+            winner: None,
+        }
+    }
+
+    /// A side's marks on each number in play.
+    pub fn marks(&self, team: Team) -> &[u32; 7] {
+        match team {
+            Team::One => &self.marks_1,
+            Team::Two => &self.marks_2,
+        }
+    }
+
+    fn marks_mut(&mut self, team: Team) -> &mut [u32; 7] {
+        match team {
+            Team::One => &mut self.marks_1,
+            Team::Two => &mut self.marks_2,
+        }
+    }
+
+    /// Whether a side has closed every number.
+    pub fn all_closed(&self, team: Team) -> bool {
+        self.marks(team).iter().all(|&m| m >= MARKS_TO_CLOSE)
+    }
+
+    /// The marks grid, one row per number in [`CRICKET_NUMBERS`] order.
+    pub fn grid(&self) -> Vec<CricketMarks> {
+        CRICKET_NUMBERS
+            .iter()
+            .enumerate()
+            .map(|(i, &number)| CricketMarks {
+                number,
+                team_1: self.marks_1[i],
+                team_2: self.marks_2[i],
+                dead: self.marks_1[i] >= MARKS_TO_CLOSE && self.marks_2[i] >= MARKS_TO_CLOSE,
+            })
+            .collect()
+    }
+
+    /// Record a visit of up to three darts. A visit is three darts unless the last one wins
+    /// the leg; send misses as number 0. Either way the turn passes over.
+    pub fn record_visit(&mut self, team: Team, darts: &[CricketDart]) -> Result<(), ScoringError> {
+        if self.winner.is_some() {
+            return Err(ScoringError::MatchFinished);
+        }
+        if team != self.thrower {
+            return Err(ScoringError::NotYourTurn);
+        }
+        if !(1..=3).contains(&darts.len()) {
+            return Err(ScoringError::InvalidDarts);
+        }
+        if !darts.iter().all(CricketDart::is_valid) {
+            return Err(ScoringError::InvalidDart);
+        }
+
+        let before = self.clone();
+        let mut visit = CricketVisit {
+            team,
+            darts: darts.to_vec(),
+            marks: 0,
+            points: 0,
+            player: None,
+        };
+        for (i, dart) in darts.iter().enumerate() {
+            if self.winner.is_some() {
+                // Nothing can be thrown after the dart that won the leg.
+                *self = before;
+                return Err(ScoringError::InvalidDarts);
+            }
+            let (marks, points) = self.score_dart(team, dart);
+            visit.marks += marks;
+            visit.points += points;
+            if self.has_won(team) {
+                self.winner = Some(team);
+            } else if i + 1 == darts.len() && darts.len() < 3 {
+                *self = before;
+                return Err(ScoringError::InvalidDarts);
+            }
+        }
+        self.visits.push(visit);
+        if self.winner.is_none() {
+            self.thrower = team.other();
+        }
+        Ok(())
+    }
+
+    /// Put one dart's marks on `team`, and any points they score. Returns the marks on numbers
+    /// in play and the points scored.
+    fn score_dart(&mut self, team: Team, dart: &CricketDart) -> (u32, u32) {
+        let Some(slot) = dart.slot() else {
+            return (0, 0);
+        };
+        let own = &mut self.marks_mut(team)[slot];
+        let closing = dart.multiplier.min(MARKS_TO_CLOSE - *own);
+        *own += closing;
+        let extra = dart.multiplier - closing;
+        if extra == 0 || self.marks(team.other())[slot] >= MARKS_TO_CLOSE {
+            return (dart.multiplier, 0);
+        }
+        let points = extra * dart.number;
+        let scorer = match self.cut_throat {
+            true => team.other(),
+            false => team,
+        };
+        match scorer {
+            Team::One => self.points.team_1 += points,
+            Team::Two => self.points.team_2 += points,
+        }
+        (dart.multiplier, points)
+    }
+
+    fn has_won(&self, team: Team) -> bool {
+        let (own, other) = (self.points.get(team), self.points.get(team.other()));
+        self.all_closed(team)
+            && match self.cut_throat {
+                true => own <= other,
+                false => own >= other,
+            }
+    }
+
+    /// Take back the last visit: the marks and points are counted again from the visits
+    /// before it, and the side throws again. None if the leg has no visits.
+    pub fn undo_visit(&mut self) -> Option<CricketVisit> {
+        let visit = self.visits.pop()?;
+        self.marks_1 = [0; 7];
+        self.marks_2 = [0; 7];
+        self.points = LegScore::default();
+        for v in std::mem::take(&mut self.visits) {
+            for dart in &v.darts {
+                self.score_dart(v.team, dart);
+            }
+            self.visits.push(v);
+        }
+        self.thrower = visit.team;
+        self.winner = None;
+        Some(visit)
+    }
+}
+
+/// A best-of-N legs cricket match. Sides alternate throwing first, starting with side one.
+#[derive(Clone, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct CricketMatch {
+    pub best_of: u32,
+    #[serde(default)]
+    pub cut_throat: bool,
+    /// Finished legs followed by the leg in progress.
+    pub legs: Vec<CricketLeg>,
+    pub legs_won: LegScore,
+    pub winner: Option<Team>,
+}
+
+impl CricketMatch {
+    /// New best-of-`best_of` legs match; `best_of` must be odd.
+    pub fn new(best_of: u32, cut_throat: bool) -> Result<Self, ScoringError> {
+        MatchFormat::best_of_legs(best_of).validate()?;
+        Ok(Self {
+            best_of,
+            cut_throat,
+            legs: vec![CricketLeg::new(Team::One, cut_throat)],
+            legs_won: LegScore::default(),
+            winner: None,
+        })
+    }
+
+    /// Legs needed to win the match.
+    pub fn legs_to_win(&self) -> u32 {
+        self.best_of / 2 + 1
+    }
+
+    /// Leg being played (the last leg once the match is finished).
+    pub fn current_leg(&self) -> &CricketLeg {
+        self.legs.last().expect("match always has a leg")
+    }
+
+    /// Whether any visit has been recorded.
+    pub fn has_visits(&self) -> bool {
+        self.legs.iter().any(|l| !l.visits.is_empty())
+    }
+
+    /// Record a visit in the current leg; winning the leg starts the next one (with the
+    /// other side throwing first) until a side wins the match.
+    pub fn record_visit(&mut self, team: Team, darts: &[CricketDart]) -> Result<(), ScoringError> {
+        if self.winner.is_some() {
+            return Err(ScoringError::MatchFinished);
+        }
+        let leg = self.legs.last_mut().expect("match always has a leg");
+        leg.record_visit(team, darts)?;
+        if leg.winner.is_some() {
+            self.tally();
+            if self.winner.is_none() {
+                let first = match self.legs.len() % 2 {
+                    0 => Team::One,
+                    _ => Team::Two,
+                };
+                self.legs.push(CricketLeg::new(first, self.cut_throat));
+            }
+        }
+        Ok(())
+    }
+
+    /// The visit recorded last, if any.
+    pub(crate) fn last_visit_mut(&mut self) -> Option<&mut CricketVisit> {
+        let n = self.legs.len();
+        let leg = match self.legs.last()?.visits.is_empty() {
+            true if n > 1 => &mut self.legs[n - 2],
+            _ => self.legs.last_mut()?,
+        };
+        leg.visits.last_mut()
+    }
+
+    /// Take back the last visit of the match, reopening the leg (and the match) it won, if
+    /// any. None before any visit.
+    pub fn undo_visit(&mut self) -> Option<CricketVisit> {
+        if self.current_leg().visits.is_empty() && self.legs.len() > 1 {
+            self.legs.pop();
+        }
+        let visit = self.legs.last_mut()?.undo_visit()?;
+        self.tally();
+        Some(visit)
+    }
+
+    /// Recount legs and the winner from the finished legs.
+    fn tally(&mut self) {
+        let mut legs = LegScore::default();
+        let mut winner = None;
+        for team in self.legs.iter().filter_map(|leg| leg.winner) {
+            if legs.add(team) >= self.legs_to_win() {
+                winner = Some(team);
+                break;
+            }
+        }
+        self.legs_won = legs;
+        self.winner = winner;
+    }
+}
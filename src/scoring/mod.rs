@@ -0,0 +1,70 @@
+//! Dart scoring: x01 and cricket legs and matches (visit by visit), and checkout suggestions.
+
+mod checkout;
+mod cricket;
+mod x01;
+
+pub use checkout::{checkout_route, Dart, BOGEY_NUMBERS};
+pub use cricket::{
+    CricketDart, CricketLeg, CricketMarks, CricketMatch, CricketVisit, BULL, CRICKET_NUMBERS,
+    MARKS_TO_CLOSE,
+};
+use serde::{Deserialize, Serialize};
+pub use x01::{
+    is_possible_score, Leg, MatchFormat, Visit, VisitOutcome, X01Match, IMPOSSIBLE_SCORES,
+    MAX_CHECKOUT, MAX_VISIT, START_SCORE,
+};
+
+/// The game a match is scored as, set by its first visit.
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum GameType {
+    /// 501, double out (see [`X01Match`]).
+    #[default]
+    X01,
+    /// See [`CricketMatch`].
+    Cricket,
+}
+
+/// Errors from recording a visit.
+#[derive(Clone, Debug, Eq, PartialEq)]
+pub enum ScoringError {
+    /// It is the other side's turn to throw.
+    NotYourTurn,
+    /// The match already has a winner.
+    MatchFinished,
+    /// Score is not possible with the darts thrown (0–60 per dart, checkouts up to 170, and
+    /// none of the [`IMPOSSIBLE_SCORES`]).
+    InvalidScore,
+    /// Darts must be 1–3, and fewer than 3 only when the visit busts or checks out.
+    InvalidDarts,
+    /// Best-of must be an odd number of legs or sets (at least 1).
+    InvalidBestOf,
+    /// A handicap takes a side's start score below 2.
+    InvalidHandicap,
+    /// A cricket dart that isn't on the board (see [`CricketDart::is_valid`]).
+    InvalidDart,
+    /// The match is already being scored as the other game.
+    WrongGameType,
+}
+
+impl std::fmt::Display for ScoringError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            ScoringError::NotYourTurn => write!(f, "It is the other side's turn to throw"),
+            ScoringError::MatchFinished => write!(f, "Match is already finished"),
+            ScoringError::InvalidScore => write!(f, "Score is not possible with those darts"),
+            ScoringError::InvalidDarts => write!(f, "Invalid number of darts for this visit"),
+            ScoringError::InvalidBestOf => {
+                write!(f, "Best-of must be an odd number of legs or sets")
+            }
+            ScoringError::InvalidHandicap => {
+                write!(f, "Handicap leaves too low a start score")
+            }
+            ScoringError::InvalidDart => write!(f, "That dart isn't on the board"),
+            ScoringError::WrongGameType => {
+                write!(f, "Match is being scored as another game")
+            }
+        }
+    }
+}
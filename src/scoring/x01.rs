@@ -0,0 +1,403 @@
+//! 501 (x01) scoring: double-out legs and best-of-N matches.
+
+use crate::models::{Handicap, LegScore, PlayerId, Team};
+use crate::scoring::{checkout_route, ScoringError};
+use serde::{Deserialize, Serialize};
+
+/// Starting score of a standard leg.
+pub const START_SCORE: u32 = 501;
+/// Highest possible three-dart visit (T20 × 3).
+pub const MAX_VISIT: u32 = 180;
+/// Visits up to [`MAX_VISIT`] that no three darts add up to.
+pub const IMPOSSIBLE_SCORES: [u32; 9] = [163, 166, 169, 172, 173, 175, 176, 178, 179];
+/// Highest possible checkout (T20, T20, bull).
+pub const MAX_CHECKOUT: u32 = 170;
+/// Highest single dart (T20).
+const MAX_DART: u32 = 60;
+
+/// Whether some visit of up to three darts scores `score`.
+pub fn is_possible_score(score: u32) -> bool {
+    score <= MAX_VISIT && !IMPOSSIBLE_SCORES.contains(&score)
+}
+
+/// Result of one visit.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum VisitOutcome {
+    /// Score taken off the remaining total.
+    Scored,
+    /// Went below zero, left 1, or reached zero without a double; remaining is unchanged.
+    Bust,
+    /// Reached exactly zero on a double: leg won.
+    Checkout,
+}
+
+/// One visit (up to three darts) by one side.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct Visit {
+    pub team: Team,
+    /// Points thrown (counted as zero when the visit busts).
+    pub score: u32,
+    pub darts: u32,
+    pub outcome: VisitOutcome,
+    /// Remaining score after the visit.
+    pub remaining: u32,
+    /// Player who threw it, when the side is one player (None for a 2v2 side).
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub player: Option<PlayerId>,
+}
+
+/// One leg: each side counts down from the start score and must finish on a double.
+#[derive(Clone, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct Leg {
+    /// The match's start score; a handicapped side starts below it.
+    pub start_score: u32,
+    pub remaining_1: u32,
+    pub remaining_2: u32,
+    /// Side to throw next.
+    pub thrower: Team,
+    pub visits: Vec<Visit>,
+    pub winner: Option<Team>,
+}
+
+impl Leg {
+    pub fn new(start_score: u32, first: Team) -> Self {
+        Self {
+            start_score,
+            remaining_1: start_score,
+            remaining_2: start_score,
+            thrower: first,
+            visits: Vec::new(),
+            winner: None,
+        }
+    }
+
+    /// A leg where the sides start on different scores (handicaps).
+    pub fn with_starts(start_score: u32, starts: LegScore, first: Team) -> Self {
+        Self {
+            remaining_1: starts.team_1,
+            remaining_2: starts.team_2,
+            ..Self::new(start_score, first)
+        }
+    }
+
+    /// Score a side still needs.
+    pub fn remaining(&self, team: Team) -> u32 {
+        match team {
+            Team::One => self.remaining_1,
+            Team::Two => self.remaining_2,
+        }
+    }
+
+    fn set_remaining(&mut self, team: Team, remaining: u32) {
+        match team {
+            Team::One => self.remaining_1 = remaining,
+            Team::Two => self.remaining_2 = remaining,
+        }
+    }
+
+    /// Record a visit of `score` with `darts` darts; `double_out` says whether the last dart was
+    /// a double (only matters when the visit reaches zero).
+    ///
+    /// Busts (leaving below zero, leaving exactly 1, or reaching zero without a double) score
+    /// nothing and leave the remaining total as it was. Either way the turn passes over.
+    pub fn record_visit(
+        &mut self,
+        team: Team,
+        score: u32,
+        darts: u32,
+        double_out: bool,
+    ) -> Result<VisitOutcome, ScoringError> {
+        if self.winner.is_some() {
+            return Err(ScoringError::MatchFinished);
+        }
+        if team != self.thrower {
+            return Err(ScoringError::NotYourTurn);
+        }
+        if !(1..=3).contains(&darts) {
+            return Err(ScoringError::InvalidDarts);
+        }
+        if score > MAX_DART * darts || !is_possible_score(score) {
+            return Err(ScoringError::InvalidScore);
+        }
+
+        let remaining = self.remaining(team);
+        let outcome = if score > remaining || remaining - score == 1 {
+            VisitOutcome::Bust
+        } else if score == remaining {
+            if !double_out {
+                VisitOutcome::Bust
+            } else if checkout_route(score, darts).is_none() {
+                // Bogey numbers, odd one-dart finishes, 99 with two darts, and the like.
+                return Err(ScoringError::InvalidScore);
+            } else {
+                VisitOutcome::Checkout
+            }
+        } else {
+            VisitOutcome::Scored
+        };
+        if outcome == VisitOutcome::Scored && darts < 3 {
+            return Err(ScoringError::InvalidDarts);
+        }
+
+        let (score, after) = match outcome {
+            VisitOutcome::Bust => (0, remaining),
+            _ => (score, remaining - score),
+        };
+        self.set_remaining(team, after);
+        self.visits.push(Visit {
+            team,
+            score,
+            darts,
+            outcome,
+            remaining: after,
+            player: None,
+        });
+        if outcome == VisitOutcome::Checkout {
+            self.winner = Some(team);
+        } else {
+            self.thrower = team.other();
+        }
+        Ok(outcome)
+    }
+
+    /// Take back the last visit: the side gets its score back and throws again, and a checkout
+    /// reopens the leg. None if the leg has no visits.
+    pub fn undo_visit(&mut self) -> Option<Visit> {
+        let visit = self.visits.pop()?;
+        self.set_remaining(visit.team, visit.remaining + visit.score);
+        self.thrower = visit.team;
+        self.winner = None;
+        Some(visit)
+    }
+}
+
+/// How many legs (and sets) a match is played over.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct MatchFormat {
+    /// Best of this many legs; per set when playing sets.
+    pub legs: u32,
+    /// Best of this many sets; None plays straight legs.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub sets: Option<u32>,
+}
+
+impl MatchFormat {
+    pub fn best_of_legs(legs: u32) -> Self {
+        Self { legs, sets: None }
+    }
+
+    /// Sets play: best of `sets` sets, each best of `legs` legs.
+    pub fn best_of_sets(sets: u32, legs: u32) -> Self {
+        Self {
+            legs,
+            sets: Some(sets),
+        }
+    }
+
+    /// Both counts must be odd (so a match can't end level).
+    pub fn validate(&self) -> Result<(), ScoringError> {
+        let odd = |n: u32| n % 2 == 1;
+        if odd(self.legs) && self.sets.is_none_or(odd) {
+            Ok(())
+        } else {
+            Err(ScoringError::InvalidBestOf)
+        }
+    }
+}
+
+/// A best-of-N legs match, or best of N sets of legs. Sides alternate throwing first, starting
+/// with side one in leg 1 (and carrying on across sets).
+#[derive(Clone, Debug, Eq, PartialEq, Serialize, Deserialize)]
+pub struct X01Match {
+    /// Legs, per set when playing sets.
+    pub best_of: u32,
+    /// Sets play: best of this many sets.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub best_of_sets: Option<u32>,
+    pub start_score: u32,
+    /// Finished legs followed by the leg in progress.
+    pub legs: Vec<Leg>,
+    /// Legs won; in sets play, legs won in the current set.
+    pub legs_won: LegScore,
+    #[serde(default)]
+    pub sets_won: LegScore,
+    pub winner: Option<Team>,
+    /// Handicaps: points off `start_score` each side starts every leg with.
+    #[serde(default, skip_serializing_if = "LegScore::is_zero")]
+    pub start_handicap: LegScore,
+    /// Handicaps: legs each side starts the match (in sets play, every set) with.
+    #[serde(default, skip_serializing_if = "LegScore::is_zero")]
+    pub legs_handicap: LegScore,
+}
+
+impl X01Match {
+    /// New best-of-`best_of` legs match; `best_of` must be odd.
+    pub fn new(best_of: u32, start_score: u32) -> Result<Self, ScoringError> {
+        Self::with_format(MatchFormat::best_of_legs(best_of), start_score)
+    }
+
+    pub fn with_format(format: MatchFormat, start_score: u32) -> Result<Self, ScoringError> {
+        format.validate()?;
+        Ok(Self {
+            best_of: format.legs,
+            best_of_sets: format.sets,
+            start_score,
+            legs: vec![Leg::new(start_score, Team::One)],
+            legs_won: LegScore::default(),
+            sets_won: LegScore::default(),
+            winner: None,
+            start_handicap: LegScore::default(),
+            legs_handicap: LegScore::default(),
+        })
+    }
+
+    /// A match where the sides get the head start of their [`Handicap`]s. Legs of head start
+    /// are cut to one fewer than a side needs to win; points must leave a start of at least 2.
+    pub fn with_handicaps(
+        format: MatchFormat,
+        start_score: u32,
+        handicaps: [Handicap; 2],
+    ) -> Result<Self, ScoringError> {
+        let mut m = Self::with_format(format, start_score)?;
+        if handicaps
+            .iter()
+            .any(|h| start_score.saturating_sub(h.points) < 2)
+        {
+            return Err(ScoringError::InvalidHandicap);
+        }
+        let [one, two] = handicaps;
+        let most = m.legs_to_win() - 1;
+        m.start_handicap = LegScore {
+            team_1: one.points,
+            team_2: two.points,
+        };
+        m.legs_handicap = LegScore {
+            team_1: one.legs.min(most),
+            team_2: two.legs.min(most),
+        };
+        m.legs_won = m.legs_handicap;
+        m.legs = vec![m.new_leg(Team::One)];
+        Ok(m)
+    }
+
+    /// Whether either side has a head start.
+    pub fn is_handicapped(&self) -> bool {
+        !self.start_handicap.is_zero() || !self.legs_handicap.is_zero()
+    }
+
+    /// Score `team` starts each leg on.
+    pub fn start_for(&self, team: Team) -> u32 {
+        self.start_score - self.start_handicap.get(team)
+    }
+
+    fn new_leg(&self, first: Team) -> Leg {
+        let starts = LegScore {
+            team_1: self.start_for(Team::One),
+            team_2: self.start_for(Team::Two),
+        };
+        Leg::with_starts(self.start_score, starts, first)
+    }
+
+    /// Legs needed to win the match (or, in sets play, a set).
+    pub fn legs_to_win(&self) -> u32 {
+        self.best_of / 2 + 1
+    }
+
+    /// Sets play: sets needed to win the match.
+    pub fn sets_to_win(&self) -> Option<u32> {
+        self.best_of_sets.map(|sets| sets / 2 + 1)
+    }
+
+    /// The score that decides the match: sets won in sets play, otherwise legs won.
+    pub fn score(&self) -> LegScore {
+        match self.best_of_sets {
+            Some(_) => self.sets_won,
+            None => self.legs_won,
+        }
+    }
+
+    /// Leg being played (the last leg once the match is finished).
+    pub fn current_leg(&self) -> &Leg {
+        self.legs.last().expect("match always has a leg")
+    }
+
+    /// Record a visit in the current leg; a checkout wins the leg and starts the next one
+    /// (with the other side throwing first) until a side wins the match.
+    pub fn record_visit(
+        &mut self,
+        team: Team,
+        score: u32,
+        darts: u32,
+        double_out: bool,
+    ) -> Result<VisitOutcome, ScoringError> {
+        if self.winner.is_some() {
+            return Err(ScoringError::MatchFinished);
+        }
+        let leg = self.legs.last_mut().expect("match always has a leg");
+        let outcome = leg.record_visit(team, score, darts, double_out)?;
+        if outcome == VisitOutcome::Checkout {
+            self.tally();
+            if self.winner.is_none() {
+                let first = match self.legs.len() % 2 {
+                    0 => Team::One,
+                    _ => Team::Two,
+                };
+                let leg = self.new_leg(first);
+                self.legs.push(leg);
+            }
+        }
+        Ok(outcome)
+    }
+
+    /// The visit recorded last, if any.
+    pub(crate) fn last_visit_mut(&mut self) -> Option<&mut Visit> {
+        let n = self.legs.len();
+        let leg = match self.legs.last()?.visits.is_empty() {
+            true if n > 1 => &mut self.legs[n - 2],
+            _ => self.legs.last_mut()?,
+        };
+        leg.visits.last_mut()
+    }
+
+    /// Take back the last visit of the match. Undoing a checkout takes the leg back off the
+    /// winner (and the set or match, if it decided one) and reopens that leg. None before any
+    /// visit.
+    pub fn undo_visit(&mut self) -> Option<Visit> {
+        if self.current_leg().visits.is_empty() && self.legs.len() > 1 {
+            self.legs.pop();
+        }
+        let visit = self.legs.last_mut()?.undo_visit()?;
+        if visit.outcome == VisitOutcome::Checkout {
+            self.tally();
+        }
+        Some(visit)
+    }
+
+    /// Recount legs, sets and the winner from the finished legs (and any legs of head start).
+    fn tally(&mut self) {
+        let mut legs = self.legs_handicap;
+        let mut sets = LegScore::default();
+        let mut winner = None;
+        for team in self.legs.iter().filter_map(|leg| leg.winner) {
+            if winner.is_some() {
+                break;
+            }
+            let legs_won = legs.add(team);
+            match self.sets_to_win() {
+                None if legs_won >= self.legs_to_win() => winner = Some(team),
+                Some(sets_to_win) if legs_won >= self.legs_to_win() => {
+                    if sets.add(team) >= sets_to_win {
+                        winner = Some(team);
+                    } else {
+                        legs = self.legs_handicap;
+                    }
+                }
+                _ => {}
+            }
+        }
+        self.legs_won = legs;
+        self.sets_won = sets;
+        self.winner = winner;
+    }
+}
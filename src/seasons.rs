@@ -0,0 +1,519 @@
+//! League seasons: weekly tournaments adding up to one table.
+//!
+//! A season has a points table: points for each finishing place, and points for everyone else
+//! who took part. Each finished tournament attached to it is one week, its placements turned
+//! into points there and then. The week keeps what the standings need (who placed where, their
+//! wins, and who beat whom), so the table stands even if a tournament is later deleted.
+//!
+//! Standings can count only each player's best weeks, a missed week counting as none. Players
+//! level on points are split by wins over the season, then by their head-to-head results in
+//! the final week (wins over the others level with them). Players are matched by name
+//! (case-insensitive) from week to week.
+
+use crate::history::bracket_matches;
+use crate::models::{
+    ResultType, Tournament, TournamentError, TournamentId, MAX_TOURNAMENT_NAME_LEN,
+};
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, HashMap};
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+use uuid::Uuid;
+
+pub type SeasonId = Uuid;
+
+/// Most finishing places a points table can give points for.
+pub const MAX_POINTS_PLACES: usize = 64;
+
+/// Points for a finishing place in a week.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct PointsTable {
+    /// Points for first place, second, and so on; never more for a lower place. Players
+    /// sharing a place each get its points.
+    pub places: Vec<u32>,
+    /// Points for taking part when placed below the table.
+    #[serde(default)]
+    pub participation: u32,
+}
+
+impl Default for PointsTable {
+    /// 12 for the winner, 9 for the runner-up, down to 2 for seventh, and 1 for showing up.
+    fn default() -> Self {
+        Self {
+            places: vec![12, 9, 7, 5, 4, 3, 2],
+            participation: 1,
+        }
+    }
+}
+
+impl PointsTable {
+    /// Points for finishing in `place` (from 1).
+    pub fn points(&self, place: u32) -> u32 {
+        (place as usize)
+            .checked_sub(1)
+            .and_then(|i| self.places.get(i))
+            .copied()
+            .unwrap_or(self.participation)
+    }
+
+    fn is_valid(&self) -> bool {
+        (1..=MAX_POINTS_PLACES).contains(&self.places.len())
+            && self.places.windows(2).all(|w| w[0] >= w[1])
+            && self.places.last().is_some_and(|&p| p >= self.participation)
+    }
+}
+
+/// One player's week.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct WeekResult {
+    pub player: String,
+    pub place: u32,
+    pub points: u32,
+    /// Matches won that week.
+    pub wins: u32,
+}
+
+/// A match played over the board in a week, by player name.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct Meeting {
+    pub winner: String,
+    pub loser: String,
+}
+
+/// A tournament attached to a season.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct SeasonWeek {
+    pub tournament_id: TournamentId,
+    pub tournament_name: String,
+    pub finished_at: DateTime<Utc>,
+    /// Best place first, players sharing a place by name.
+    pub results: Vec<WeekResult>,
+    pub meetings: Vec<Meeting>,
+}
+
+/// A league season and its weeks so far.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct Season {
+    pub id: SeasonId,
+    pub name: String,
+    pub created_at: DateTime<Utc>,
+    pub points: PointsTable,
+    /// Weeks counted for each player (their best), unless the standings ask otherwise; None
+    /// counts them all.
+    pub best_of: Option<usize>,
+    /// In the order they finished.
+    pub weeks: Vec<SeasonWeek>,
+}
+
+/// Why a season request failed.
+#[derive(Clone, Debug, PartialEq)]
+pub enum SeasonError {
+    NotFound(SeasonId),
+    /// The table is empty, longer than [`MAX_POINTS_PLACES`], gives a lower place more, or
+    /// gives taking part more than its last place.
+    InvalidPointsTable,
+    /// Weeks counted must be at least 1.
+    InvalidBestOf,
+    /// Only a finished tournament (placements recorded) can be attached.
+    TournamentNotFinished(TournamentId),
+    AlreadyAttached(TournamentId),
+    /// The season name was rejected.
+    Tournament(TournamentError),
+    /// The season could not be written to its file.
+    Storage(String),
+}
+
+impl std::fmt::Display for SeasonError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            SeasonError::NotFound(_) => write!(f, "No season"),
+            SeasonError::InvalidPointsTable => write!(
+                f,
+                "Points must be given for 1 to {} places, never more for a lower place or for \
+                 taking part",
+                MAX_POINTS_PLACES
+            ),
+            SeasonError::InvalidBestOf => write!(f, "Weeks counted must be at least 1"),
+            SeasonError::TournamentNotFinished(_) => {
+                write!(f, "Only a finished tournament can be added to a season")
+            }
+            SeasonError::AlreadyAttached(_) => {
+                write!(f, "Tournament is already part of this season")
+            }
+            SeasonError::Tournament(e) => write!(f, "{}", e),
+            SeasonError::Storage(e) => write!(f, "Could not save season: {}", e),
+        }
+    }
+}
+
+impl From<TournamentError> for SeasonError {
+    fn from(e: TournamentError) -> Self {
+        SeasonError::Tournament(e)
+    }
+}
+
+impl Season {
+    /// An empty season scoring weeks by `points`, counting each player's `best_of` best weeks
+    /// (all of them when None).
+    pub fn new(
+        name: &str,
+        points: PointsTable,
+        best_of: Option<usize>,
+    ) -> Result<Self, SeasonError> {
+        let name = name.trim();
+        if name.chars().count() > MAX_TOURNAMENT_NAME_LEN {
+            return Err(TournamentError::TournamentNameTooLong {
+                max: MAX_TOURNAMENT_NAME_LEN,
+            }
+            .into());
+        }
+        if !points.is_valid() {
+            return Err(SeasonError::InvalidPointsTable);
+        }
+        if best_of == Some(0) {
+            return Err(SeasonError::InvalidBestOf);
+        }
+        Ok(Self {
+            id: Uuid::new_v4(),
+            name: name.to_string(),
+            created_at: Utc::now(),
+            points,
+            best_of,
+            weeks: Vec::new(),
+        })
+    }
+
+    /// Add a finished tournament as a week, its placements turned into points.
+    pub fn attach(&mut self, tournament: &Tournament) -> Result<(), SeasonError> {
+        let Some(finished_at) = tournament.finished_at else {
+            return Err(SeasonError::TournamentNotFinished(tournament.id));
+        };
+        if self.weeks.iter().any(|w| w.tournament_id == tournament.id) {
+            return Err(SeasonError::AlreadyAttached(tournament.id));
+        }
+        let mut results: Vec<WeekResult> = tournament
+            .placements
+            .iter()
+            .filter_map(|p| {
+                let player = tournament.find_player(p.player)?;
+                Some(WeekResult {
+                    player: player.name.clone(),
+                    place: p.place,
+                    points: self.points.points(p.place),
+                    wins: player.wins,
+                })
+            })
+            .collect();
+        results.sort_by(|a, b| (a.place, &a.player).cmp(&(b.place, &b.player)));
+        let name = |id| tournament.find_player(id).map(|p| p.name.clone());
+        let meetings = bracket_matches(tournament)
+            .filter(|m| !m.bye && m.result_type == ResultType::Played)
+            .filter_map(|m| {
+                Some(Meeting {
+                    winner: name(m.winner_id()?)?,
+                    loser: name(m.loser_id()?)?,
+                })
+            })
+            .collect();
+        self.weeks.push(SeasonWeek {
+            tournament_id: tournament.id,
+            tournament_name: tournament.name.clone(),
+            finished_at,
+            results,
+            meetings,
+        });
+        self.weeks.sort_by_key(|w| w.finished_at);
+        Ok(())
+    }
+}
+
+/// One player's points in one week of the standings.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct WeekPoints {
+    pub tournament_id: TournamentId,
+    /// None for a week they missed.
+    pub place: Option<u32>,
+    pub points: u32,
+    /// Whether the week is among their best, and so in their total.
+    pub counted: bool,
+}
+
+/// One row of the season table.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct SeasonStanding {
+    /// Shared by players level on points, wins and final-week head-to-head.
+    pub rank: u32,
+    /// As spelled in their latest week.
+    pub player: String,
+    /// Points from the weeks counted.
+    pub points: u32,
+    /// Points from every week.
+    pub total_points: u32,
+    pub weeks_played: u32,
+    /// Matches won over the season.
+    pub wins: u32,
+    /// Every week of the season, in order.
+    pub weeks: Vec<WeekPoints>,
+}
+
+/// The season table.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct SeasonStandings {
+    pub season_id: SeasonId,
+    pub name: String,
+    pub weeks: usize,
+    /// Weeks counted for each player: their best this many, or every week.
+    pub counted_weeks: usize,
+    pub standings: Vec<SeasonStanding>,
+}
+
+/// The table for `season`, counting each player's `best_of` best weeks (the season's own
+/// setting when None).
+pub fn season_standings(
+    season: &Season,
+    best_of: Option<usize>,
+) -> Result<SeasonStandings, SeasonError> {
+    let best_of = best_of.or(season.best_of);
+    if best_of == Some(0) {
+        return Err(SeasonError::InvalidBestOf);
+    }
+    let weeks = season.weeks.len();
+    let counted_weeks = best_of.map_or(weeks, |n| n.min(weeks));
+
+    // Each player's result in each week, by lower-cased name, in order of first appearance.
+    let mut players: Vec<(String, Vec<Option<&WeekResult>>)> = Vec::new();
+    let mut index: HashMap<String, usize> = HashMap::new();
+    for (w, week) in season.weeks.iter().enumerate() {
+        for result in &week.results {
+            let key = result.player.to_lowercase();
+            let i = *index.entry(key).or_insert_with(|| {
+                players.push((String::new(), vec![None; weeks]));
+                players.len() - 1
+            });
+            players[i].0 = result.player.clone();
+            players[i].1[w] = Some(result);
+        }
+    }
+
+    let mut standings: Vec<SeasonStanding> = players
+        .into_iter()
+        .map(|(player, results)| {
+            let points: Vec<u32> = results.iter().map(|r| r.map_or(0, |r| r.points)).collect();
+            // Best weeks first; among equal weeks, the earlier is kept.
+            let mut order: Vec<usize> = (0..weeks).collect();
+            order.sort_by(|&a, &b| points[b].cmp(&points[a]).then(a.cmp(&b)));
+            let mut counted = vec![false; weeks];
+            for &w in order.iter().take(counted_weeks) {
+                counted[w] = true;
+            }
+            SeasonStanding {
+                rank: 0,
+                player,
+                points: (0..weeks).filter(|&w| counted[w]).map(|w| points[w]).sum(),
+                total_points: points.iter().sum(),
+                weeks_played: results.iter().flatten().count() as u32,
+                wins: results.iter().flatten().map(|r| r.wins).sum(),
+                weeks: season
+                    .weeks
+                    .iter()
+                    .zip(&results)
+                    .enumerate()
+                    .map(|(w, (week, r))| WeekPoints {
+                        tournament_id: week.tournament_id,
+                        place: r.map(|r| r.place),
+                        points: points[w],
+                        counted: counted[w],
+                    })
+                    .collect(),
+            }
+        })
+        .collect();
+    standings.sort_by(|a, b| {
+        b.points
+            .cmp(&a.points)
+            .then(b.wins.cmp(&a.wins))
+            .then_with(|| a.player.to_lowercase().cmp(&b.player.to_lowercase()))
+    });
+    break_ties_by_final_week(&mut standings, season.weeks.last());
+    Ok(SeasonStandings {
+        season_id: season.id,
+        name: season.name.clone(),
+        weeks,
+        counted_weeks,
+        standings,
+    })
+}
+
+/// Order each run of players level on points and wins by their wins over one another in
+/// `final_week`, and rank everyone.
+fn break_ties_by_final_week(standings: &mut [SeasonStanding], final_week: Option<&SeasonWeek>) {
+    let level = |a: &SeasonStanding, b: &SeasonStanding| (a.points, a.wins) == (b.points, b.wins);
+    let mut h2h = vec![0; standings.len()];
+    let mut start = 0;
+    while start < standings.len() {
+        let mut end = start + 1;
+        while end < standings.len() && level(&standings[start], &standings[end]) {
+            end += 1;
+        }
+        if end - start > 1 {
+            let group = &mut standings[start..end];
+            let names: Vec<String> = group.iter().map(|s| s.player.to_lowercase()).collect();
+            let mut wins: BTreeMap<String, u32> = BTreeMap::new();
+            for m in final_week.into_iter().flat_map(|w| &w.meetings) {
+                let (winner, loser) = (m.winner.to_lowercase(), m.loser.to_lowercase());
+                if names.contains(&winner) && names.contains(&loser) {
+                    *wins.entry(winner).or_insert(0) += 1;
+                }
+            }
+            let wins_of = |s: &SeasonStanding| wins.get(&s.player.to_lowercase()).copied();
+            // Stable: players with equal head-to-head keep their name order.
+            group.sort_by_key(|s| std::cmp::Reverse(wins_of(s).unwrap_or(0)));
+            for (i, s) in group.iter().enumerate() {
+                h2h[start + i] = wins_of(s).unwrap_or(0);
+            }
+        }
+        start = end;
+    }
+    for i in 0..standings.len() {
+        let shared = i > 0 && level(&standings[i - 1], &standings[i]) && h2h[i - 1] == h2h[i];
+        standings[i].rank = if shared {
+            standings[i - 1].rank
+        } else {
+            i as u32 + 1
+        };
+    }
+}
+
+/// Seasons by id, each also written to `<dir>/<id>.json` when a directory is set.
+pub struct SeasonStore {
+    dir: Option<PathBuf>,
+    seasons: Mutex<BTreeMap<SeasonId, Season>>,
+}
+
+impl SeasonStore {
+    /// Seasons kept in memory only (lost on restart).
+    pub fn in_memory() -> Self {
+        Self {
+            dir: None,
+            seasons: Mutex::new(BTreeMap::new()),
+        }
+    }
+
+    /// Seasons kept as JSON files in `dir` (created if needed), with the ones there loaded.
+    pub fn open(dir: impl Into<PathBuf>) -> io::Result<Self> {
+        let dir = dir.into();
+        fs::create_dir_all(&dir)?;
+        let mut seasons = BTreeMap::new();
+        for entry in fs::read_dir(&dir)? {
+            let path = entry?.path();
+            if path.extension().and_then(|e| e.to_str()) != Some("json") {
+                continue;
+            }
+            let season = read_season(&path)?;
+            seasons.insert(season.id, season);
+        }
+        Ok(Self {
+            dir: Some(dir),
+            seasons: Mutex::new(seasons),
+        })
+    }
+
+    pub fn insert(&self, season: Season) -> Result<Season, SeasonError> {
+        let mut seasons = self.seasons.lock().unwrap_or_else(|e| e.into_inner());
+        self.write(&season)?;
+        seasons.insert(season.id, season.clone());
+        Ok(season)
+    }
+
+    pub fn get(&self, id: SeasonId) -> Result<Season, SeasonError> {
+        let seasons = self.seasons.lock().unwrap_or_else(|e| e.into_inner());
+        seasons.get(&id).cloned().ok_or(SeasonError::NotFound(id))
+    }
+
+    /// Every season, oldest first.
+    pub fn list(&self) -> Vec<Season> {
+        let seasons = self.seasons.lock().unwrap_or_else(|e| e.into_inner());
+        let mut list: Vec<Season> = seasons.values().cloned().collect();
+        list.sort_by_key(|s| (s.created_at, s.id));
+        list
+    }
+
+    /// Apply `f` to the season, keeping the change only if it succeeds and is saved. Returns
+    /// the season as it is afterwards.
+    pub fn update<F>(&self, id: SeasonId, f: F) -> Result<Season, SeasonError>
+    where
+        F: FnOnce(&mut Season) -> Result<(), SeasonError>,
+    {
+        let mut seasons = self.seasons.lock().unwrap_or_else(|e| e.into_inner());
+        let season = seasons.get_mut(&id).ok_or(SeasonError::NotFound(id))?;
+        let mut changed = season.clone();
+        f(&mut changed)?;
+        self.write(&changed)?;
+        *season = changed.clone();
+        Ok(changed)
+    }
+
+    /// Replace every season with `seasons` as one change (a backup being restored). If a
+    /// file can't be written or removed, the old seasons are written back and nothing changes.
+    pub fn replace_all(&self, seasons: Vec<Season>) -> Result<(), SeasonError> {
+        let mut current = self.seasons.lock().unwrap_or_else(|e| e.into_inner());
+        let next: BTreeMap<SeasonId, Season> = seasons.into_iter().map(|s| (s.id, s)).collect();
+        if let Some(dir) = &self.dir {
+            let written = next
+                .values()
+                .try_for_each(|s| write_season(dir, s))
+                .and_then(|()| {
+                    current
+                        .keys()
+                        .filter(|id| !next.contains_key(id))
+                        .try_for_each(|id| remove_season(dir, *id))
+                });
+            if let Err(e) = written {
+                for season in current.values() {
+                    let _ = write_season(dir, season);
+                }
+                for id in next.keys().filter(|id| !current.contains_key(id)) {
+                    let _ = remove_season(dir, *id);
+                }
+                return Err(SeasonError::Storage(e.to_string()));
+            }
+        }
+        *current = next;
+        Ok(())
+    }
+
+    fn write(&self, season: &Season) -> Result<(), SeasonError> {
+        match &self.dir {
+            Some(dir) => write_season(dir, season).map_err(|e| SeasonError::Storage(e.to_string())),
+            None => Ok(()),
+        }
+    }
+}
+
+fn read_season(path: &Path) -> io::Result<Season> {
+    let json = fs::read(path)?;
+    serde_json::from_slice(&json).map_err(|e| {
+        io::Error::new(
+            io::ErrorKind::InvalidData,
+            format!("{}: {}", path.display(), e),
+        )
+    })
+}
+
+fn write_season(dir: &Path, season: &Season) -> io::Result<()> {
+    let json = serde_json::to_vec(season)?;
+    let path = dir.join(format!("{}.json", season.id));
+    let tmp = path.with_extension("json.tmp");
+    fs::write(&tmp, json)?;
+    fs::rename(&tmp, &path)
+}
+
+fn remove_season(dir: &Path, id: SeasonId) -> io::Result<()> {
+    match fs::remove_file(dir.join(format!("{}.json", id))) {
+        Err(e) if e.kind() == io::ErrorKind::NotFound => Ok(()),
+        other => other,
+    }
+}
@@ -0,0 +1,263 @@
+//! Casual sessions: rotation nights outside a tournament, where the app picks who sits out.
+//!
+//! A session has a player list and a number of games played at once (one per board). Each
+//! game the players who have sat out least sit out, ties going to whoever sat out longest
+//! ago, so over a night everyone's sit-outs stay within one of each other. Players can come
+//! and go between games: a new arrival counts as having sat out as often as the most rested
+//! player there, and after everyone else, so they play straight away and then take their turn
+//! like everyone else rather than sitting out until they have caught up.
+//!
+//! Sessions are kept in memory only; a night's rotation isn't worth keeping past a restart.
+
+use crate::models::{
+    Player, PlayerId, TournamentError, TournamentMode, MAX_BOARDS, MAX_PLAYER_NAME_LEN,
+};
+use chrono::{DateTime, Utc};
+use rand::seq::SliceRandom;
+use rand::Rng;
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, HashMap};
+use std::sync::Mutex;
+use uuid::Uuid;
+
+pub type SessionId = Uuid;
+
+/// A game handed out: who plays whom, and who sits out.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct SessionGame {
+    /// 1 for the session's first game.
+    pub number: u32,
+    pub matches: Vec<SessionMatch>,
+    pub sitting_out: Vec<String>,
+}
+
+/// One matchup of a game, by player name.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct SessionMatch {
+    pub team_1: Vec<String>,
+    pub team_2: Vec<String>,
+}
+
+/// A casual session and its rotation so far.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct Session {
+    pub id: SessionId,
+    pub name: String,
+    pub created_at: DateTime<Utc>,
+    /// 1v1 or 2v2 games.
+    pub mode: TournamentMode,
+    /// Games played at once; everyone who doesn't fit sits out.
+    pub games_per_round: usize,
+    /// Players here now. `times_sat_out` is what they actually sat out; the fairness counter
+    /// `internal_times_sat_out` is what the rotation goes by.
+    pub players: Vec<Player>,
+    /// Games handed out so far.
+    pub games: u32,
+    /// Number of the last game each player sat out; for an arrival who hasn't yet, the first
+    /// game they are here for.
+    pub last_sat_out_game: BTreeMap<PlayerId, u32>,
+    /// The game handed out last.
+    pub current_game: Option<SessionGame>,
+}
+
+/// Why a session request failed.
+#[derive(Clone, Debug, PartialEq)]
+pub enum SessionError {
+    NotFound(SessionId),
+    /// Games per round must be 1 to [`MAX_BOARDS`].
+    InvalidGamesPerRound,
+    /// A player name was rejected, a player wasn't found, or too few are here to play.
+    Tournament(TournamentError),
+}
+
+impl std::fmt::Display for SessionError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            SessionError::NotFound(_) => write!(f, "No session"),
+            SessionError::InvalidGamesPerRound => {
+                write!(f, "Games per round must be 1 to {}", MAX_BOARDS)
+            }
+            SessionError::Tournament(e) => write!(f, "{}", e),
+        }
+    }
+}
+
+impl From<TournamentError> for SessionError {
+    fn from(e: TournamentError) -> Self {
+        SessionError::Tournament(e)
+    }
+}
+
+impl Session {
+    /// A session with `players` (names, unique case-insensitive), playing `games_per_round`
+    /// games at once.
+    pub fn new(
+        name: &str,
+        mode: TournamentMode,
+        games_per_round: usize,
+        players: &[String],
+    ) -> Result<Self, SessionError> {
+        if !(1..=MAX_BOARDS).contains(&games_per_round) {
+            return Err(SessionError::InvalidGamesPerRound);
+        }
+        let mut session = Self {
+            id: Uuid::new_v4(),
+            name: name.trim().to_string(),
+            created_at: Utc::now(),
+            mode,
+            games_per_round,
+            players: Vec::new(),
+            games: 0,
+            last_sat_out_game: BTreeMap::new(),
+            current_game: None,
+        };
+        for name in players {
+            session.join(name)?;
+        }
+        Ok(session)
+    }
+
+    /// Players a game needs for each matchup.
+    pub fn players_per_match(&self) -> usize {
+        match self.mode {
+            TournamentMode::OneVOne => 2,
+            TournamentMode::TwoVTwo => 4,
+        }
+    }
+
+    /// Add a player between games. They count as having sat out as often as the most rested
+    /// player here, and more recently than anyone, so they play the next game.
+    pub fn join(&mut self, name: &str) -> Result<&Player, SessionError> {
+        let name = name.trim();
+        if name.is_empty() {
+            return Err(TournamentError::EmptyPlayerName.into());
+        }
+        if name.chars().count() > MAX_PLAYER_NAME_LEN {
+            return Err(TournamentError::PlayerNameTooLong {
+                max: MAX_PLAYER_NAME_LEN,
+            }
+            .into());
+        }
+        if self
+            .players
+            .iter()
+            .any(|p| p.name.eq_ignore_ascii_case(name))
+        {
+            return Err(TournamentError::DuplicatePlayerName.into());
+        }
+        let mut player = Player::new(name);
+        player.internal_times_sat_out = self
+            .players
+            .iter()
+            .map(|p| p.internal_times_sat_out)
+            .max()
+            .unwrap_or(0);
+        self.last_sat_out_game.insert(player.id, self.games + 1);
+        self.players.push(player);
+        Ok(self.players.last().expect("just pushed"))
+    }
+
+    /// Remove a player between games.
+    pub fn leave(&mut self, id: PlayerId) -> Result<(), SessionError> {
+        let idx = self
+            .players
+            .iter()
+            .position(|p| p.id == id)
+            .ok_or(TournamentError::PlayerNotFound(id))?;
+        self.players.remove(idx);
+        self.last_sat_out_game.remove(&id);
+        Ok(())
+    }
+
+    /// Hand out the next game: as many matchups as fit (up to `games_per_round`), drawn at
+    /// random from the players not sitting out. Those sitting out are the ones who have sat
+    /// out least, then longest ago; ties beyond that are broken at random.
+    pub fn next_game(&mut self, rng: &mut impl Rng) -> Result<&SessionGame, SessionError> {
+        let per_match = self.players_per_match();
+        let fit = (self.players.len() / per_match).min(self.games_per_round);
+        if fit == 0 {
+            return Err(TournamentError::NotEnoughPlayers.into());
+        }
+        let sitting = self.players.len() - fit * per_match;
+
+        let mut order: Vec<(i32, u32, u32, PlayerId)> = self
+            .players
+            .iter()
+            .map(|p| {
+                let last = self.last_sat_out_game.get(&p.id).copied().unwrap_or(0);
+                (p.internal_times_sat_out, last, rng.gen::<u32>(), p.id)
+            })
+            .collect();
+        order.sort();
+        let mut playing: Vec<PlayerId> = order.iter().skip(sitting).map(|o| o.3).collect();
+        let sitting_out: Vec<PlayerId> = order.iter().take(sitting).map(|o| o.3).collect();
+
+        self.games += 1;
+        for p in &mut self.players {
+            if sitting_out.contains(&p.id) {
+                p.record_sat_out();
+                self.last_sat_out_game.insert(p.id, self.games);
+            }
+        }
+
+        playing.shuffle(rng);
+        let names: HashMap<PlayerId, &str> = self
+            .players
+            .iter()
+            .map(|p| (p.id, p.name.as_str()))
+            .collect();
+        let named = |ids: &[PlayerId]| -> Vec<String> {
+            ids.iter().map(|id| names[id].to_string()).collect()
+        };
+        let half = per_match / 2;
+        let game = SessionGame {
+            number: self.games,
+            matches: playing
+                .chunks_exact(per_match)
+                .map(|chunk| SessionMatch {
+                    team_1: named(&chunk[..half]),
+                    team_2: named(&chunk[half..]),
+                })
+                .collect(),
+            sitting_out: named(&sitting_out),
+        };
+        Ok(self.current_game.insert(game))
+    }
+}
+
+/// Sessions by id, in memory.
+#[derive(Default)]
+pub struct SessionStore {
+    sessions: Mutex<HashMap<SessionId, Session>>,
+}
+
+impl SessionStore {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    pub fn insert(&self, session: Session) -> Session {
+        let mut sessions = self.sessions.lock().unwrap_or_else(|e| e.into_inner());
+        sessions.insert(session.id, session.clone());
+        session
+    }
+
+    pub fn get(&self, id: SessionId) -> Result<Session, SessionError> {
+        let sessions = self.sessions.lock().unwrap_or_else(|e| e.into_inner());
+        sessions.get(&id).cloned().ok_or(SessionError::NotFound(id))
+    }
+
+    /// Apply `f` to the session, keeping the change only if it succeeds. Returns the session
+    /// as it is afterwards.
+    pub fn update<F>(&self, id: SessionId, f: F) -> Result<Session, SessionError>
+    where
+        F: FnOnce(&mut Session) -> Result<(), SessionError>,
+    {
+        let mut sessions = self.sessions.lock().unwrap_or_else(|e| e.into_inner());
+        let session = sessions.get_mut(&id).ok_or(SessionError::NotFound(id))?;
+        let mut changed = session.clone();
+        f(&mut changed)?;
+        *session = changed.clone();
+        Ok(changed)
+    }
+}
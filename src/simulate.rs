@@ -0,0 +1,383 @@
+//! Simulated tournaments: play a tournament that hasn't started out on a copy, to see how many
+//! matches and rounds its format makes of the entrants and how long the night will take on
+//! the boards there are.
+//!
+//! The copy is started with the draw the real start would use and every match decided leg by
+//! leg, each leg a coin toss or, with [`Outcomes::Seeded`], weighted towards the better seed.
+//! A match takes its legs times the minutes per leg; matches go on the first free board in
+//! bracket order, a player never on two at once, and the estimate is when the last one ends.
+//! Only the copy's stats move; the tournament itself is never changed.
+
+use crate::logic::{
+    advance_to_knockout, final_placements, match_format, record_bracket_result,
+    start_groups_knockout, start_next_swiss_round, start_with_draw, DrawSettings, GroupSettings,
+};
+use crate::models::{
+    BracketSection, EntryType, LegScore, MatchId, Player, PlayerId, Team, Tournament,
+    TournamentError, TournamentFormat, TournamentState,
+};
+use crate::scoring::MatchFormat;
+use rand::rngs::StdRng;
+use rand::{Rng, SeedableRng};
+use serde::{Deserialize, Serialize};
+use std::collections::{HashMap, HashSet};
+
+/// Minutes a leg takes unless told otherwise.
+pub const DEFAULT_MINUTES_PER_LEG: f64 = 5.0;
+
+/// Most entrants a simulation plays out.
+pub const MAX_SIMULATED_ENTRANTS: usize = 64;
+
+/// How simulated legs are won.
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum Outcomes {
+    /// Evens every leg.
+    #[default]
+    Random,
+    /// Each leg between seeds `a` and `b` goes to seed `a` with odds `b : a`, so the top seed
+    /// wins most legs against the bottom one.
+    Seeded,
+}
+
+/// What to simulate.
+#[derive(Clone, Copy, Debug, PartialEq)]
+pub struct SimulationSettings {
+    pub outcomes: Outcomes,
+    pub minutes_per_leg: f64,
+    /// Boards to play on; at least one.
+    pub boards: usize,
+    /// Entrants to simulate with: stand-ins ("Entrant 1", ...) fill up to this many. Fewer
+    /// than are entered plays those entered.
+    pub entrants: usize,
+    /// Seed for every random choice, the draw's included; a fresh one is picked when None.
+    /// The same tournament, settings and seed always give the same simulation.
+    pub seed: Option<u64>,
+    /// The knockout draw (its seed falls back to the simulation's).
+    pub draw: DrawSettings,
+    /// Groups then knockout: the groups, [`GroupSettings::default_for`] the entrants if None.
+    pub groups: Option<GroupSettings>,
+}
+
+impl Default for SimulationSettings {
+    fn default() -> Self {
+        Self {
+            outcomes: Outcomes::default(),
+            minutes_per_leg: DEFAULT_MINUTES_PER_LEG,
+            boards: 1,
+            entrants: 0,
+            seed: None,
+            draw: DrawSettings::default(),
+            groups: None,
+        }
+    }
+}
+
+/// One entrant of a simulation.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct SimulatedEntrant {
+    pub name: String,
+    pub seed: u32,
+    /// Matches played in this simulation (byes excluded).
+    pub games: u32,
+    /// Matches they play however results go: as many as when losing every one.
+    pub minimum_games: u32,
+    /// Where they finished.
+    pub place: Option<u32>,
+}
+
+/// A tournament played out.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct Simulation {
+    /// The seed used, to repeat it.
+    pub seed: u64,
+    pub boards: usize,
+    /// Matches played (byes excluded).
+    pub matches: usize,
+    /// Rounds played, each section's (and the groups') counted on their own.
+    pub rounds: usize,
+    pub legs: u32,
+    /// From the first match starting to the last one ending.
+    pub estimated_minutes: u32,
+    pub champion: Option<String>,
+    /// In seed order.
+    pub entrants: Vec<SimulatedEntrant>,
+}
+
+/// Play out a copy of `tournament`, which must still be in Setup, format other than
+/// [`TournamentFormat::Elimination`] ([`TournamentError::SimulationUnsupported`]: its rounds
+/// are drawn by hand).
+pub fn simulate(
+    tournament: &Tournament,
+    settings: &SimulationSettings,
+) -> Result<Simulation, TournamentError> {
+    if tournament.state != TournamentState::Setup {
+        return Err(TournamentError::InvalidState);
+    }
+    if tournament.format == TournamentFormat::Elimination {
+        return Err(TournamentError::SimulationUnsupported);
+    }
+    let seed = settings.seed.unwrap_or_else(rand::random);
+    let mut started = tournament.clone();
+    fill_entrants(&mut started, settings.entrants.min(MAX_SIMULATED_ENTRANTS))?;
+    start(&mut started, settings, seed)?;
+
+    let boards = settings.boards.max(1);
+    let secs_per_leg = (settings.minutes_per_leg.max(0.0) * 60.0).round() as u64;
+    let run = |loser: Option<PlayerId>| {
+        let mut rng = StdRng::seed_from_u64(seed);
+        play_out(started.clone(), settings.outcomes, boards, loser, &mut rng)
+    };
+    let (finished, played) = run(None)?;
+
+    let mut games: HashMap<PlayerId, u32> = HashMap::new();
+    for m in &played {
+        for id in m.players {
+            *games.entry(id).or_default() += 1;
+        }
+    }
+    // Round robin plays every match whatever the results, and Swiss every round bar one bye
+    // with an odd number; in the other formats the draw follows the results, so each entrant
+    // is played out again losing everything.
+    let odd = started.players.len() % 2 == 1;
+    let mut minimum_games = HashMap::new();
+    for p in &started.players {
+        let minimum = match started.format {
+            TournamentFormat::RoundRobin => games.get(&p.id).copied().unwrap_or(0),
+            TournamentFormat::Swiss => started.swiss_rounds - u32::from(odd),
+            _ => {
+                let (_, lost) = run(Some(p.id))?;
+                lost.iter().filter(|m| m.players.contains(&p.id)).count() as u32
+            }
+        };
+        minimum_games.insert(p.id, minimum);
+    }
+
+    let places: HashMap<PlayerId, u32> = final_placements(&finished)
+        .map(|ps| ps.into_iter().map(|p| (p.player, p.place)).collect())
+        .unwrap_or_default();
+    let champion = places
+        .iter()
+        .find(|(_, &place)| place == 1)
+        .and_then(|(id, _)| finished.find_player(*id))
+        .map(|p| p.name.clone());
+    let mut entrants: Vec<SimulatedEntrant> = started
+        .players
+        .iter()
+        .map(|p| SimulatedEntrant {
+            name: p.name.clone(),
+            seed: p.seed,
+            games: games.get(&p.id).copied().unwrap_or(0),
+            minimum_games: minimum_games[&p.id],
+            place: places.get(&p.id).copied(),
+        })
+        .collect();
+    entrants.sort_by_key(|e| e.seed);
+    let rounds: HashSet<RoundKey> = played.iter().map(|m| m.round).collect();
+    let end = played.iter().map(|m| m.ends).max().unwrap_or(0);
+    Ok(Simulation {
+        seed,
+        boards,
+        matches: played.len(),
+        rounds: rounds.len(),
+        legs: played.iter().map(|m| m.legs).sum(),
+        estimated_minutes: (end * secs_per_leg).div_ceil(60) as u32,
+        champion,
+        entrants,
+    })
+}
+
+/// Enter stand-ins until the tournament has `entrants` (people, for a pairs night whose
+/// teams are drawn; otherwise teams of two stand-ins).
+fn fill_entrants(tournament: &mut Tournament, entrants: usize) -> Result<(), TournamentError> {
+    let taken = |t: &Tournament, name: &str| {
+        let people = t.players.iter().flat_map(|p| &p.members);
+        t.players
+            .iter()
+            .map(|p| &p.name)
+            .chain(people)
+            .any(|n| n.eq_ignore_ascii_case(name))
+    };
+    let mut n = 0;
+    while tournament.players.len() < entrants {
+        n += 1;
+        let name = format!("Entrant {n}");
+        if taken(tournament, &name) {
+            continue;
+        }
+        if tournament.entry_type == EntryType::Pairs && !tournament.draws_pairs() {
+            let members = [format!("{name}a"), format!("{name}b")];
+            tournament.add_pair(&name, &members)?;
+        } else {
+            tournament.add_player(name.as_str())?;
+        }
+    }
+    Ok(())
+}
+
+fn start(
+    tournament: &mut Tournament,
+    settings: &SimulationSettings,
+    seed: u64,
+) -> Result<(), TournamentError> {
+    if tournament.format == TournamentFormat::GroupsKnockout {
+        let groups = settings
+            .groups
+            .unwrap_or_else(|| GroupSettings::default_for(tournament.players.len()));
+        return start_groups_knockout(tournament, groups);
+    }
+    let draw = DrawSettings {
+        seed: settings.draw.seed.or(Some(seed)),
+        ..settings.draw
+    };
+    start_with_draw(tournament, draw)
+}
+
+/// Groups are told apart from the knockout, then section and round.
+type RoundKey = (bool, BracketSection, u32);
+
+/// A match played in a simulation.
+struct Played {
+    round: RoundKey,
+    players: [PlayerId; 2],
+    legs: u32,
+    /// When it ended, in legs from the start.
+    ends: u64,
+}
+
+/// A match on a board.
+struct OnBoard {
+    match_id: MatchId,
+    winner: PlayerId,
+    score: LegScore,
+    played: Played,
+}
+
+/// Play `tournament` to the end on `boards` boards, `loser` (if any) losing every match.
+/// Time runs in legs.
+fn play_out(
+    mut tournament: Tournament,
+    outcomes: Outcomes,
+    boards: usize,
+    loser: Option<PlayerId>,
+    rng: &mut StdRng,
+) -> Result<(Tournament, Vec<Played>), TournamentError> {
+    let mut played = Vec::new();
+    let mut on_boards: Vec<OnBoard> = Vec::new();
+    let mut now = 0;
+    loop {
+        let busy: HashSet<PlayerId> = on_boards.iter().flat_map(|m| m.played.players).collect();
+        let in_groups = tournament
+            .group_stage
+            .as_ref()
+            .is_some_and(|s| !s.knockout_started);
+        let waiting: Vec<_> = tournament
+            .bracket
+            .iter()
+            .flat_map(|b| &b.matches)
+            .filter(|m| m.is_ready() && !m.bye)
+            .filter(|m| on_boards.iter().all(|on| on.match_id != m.id))
+            .filter_map(|m| Some((m, m.team_1?, m.team_2?)))
+            .filter(|(_, a, b)| !busy.contains(a) && !busy.contains(b))
+            .map(|(m, a, b)| (m.id, (in_groups, m.section, m.round), a, b))
+            .collect();
+        let mut taken = busy;
+        for (match_id, round, a, b) in waiting {
+            if on_boards.len() >= boards {
+                break;
+            }
+            if taken.contains(&a) || taken.contains(&b) {
+                continue;
+            }
+            taken.extend([a, b]);
+            let one_wins_leg = match (loser, outcomes) {
+                (Some(l), _) if l == a => 0.0,
+                (Some(l), _) if l == b => 1.0,
+                (_, Outcomes::Random) => 0.5,
+                (_, Outcomes::Seeded) => {
+                    let seed = |id| tournament.find_player(id).map_or(1, |p: &Player| p.seed);
+                    let (sa, sb) = (seed(a).max(1) as f64, seed(b).max(1) as f64);
+                    sb / (sa + sb)
+                }
+            };
+            let format = match_format(&tournament, match_id);
+            let (score, legs) = play_match(format, one_wins_leg, rng);
+            let winner = if score.team_1 > score.team_2 { a } else { b };
+            on_boards.push(OnBoard {
+                match_id,
+                winner,
+                score,
+                played: Played {
+                    round,
+                    players: [a, b],
+                    legs,
+                    ends: now + legs as u64,
+                },
+            });
+        }
+        // The next match to end; the earliest on the boards wins ties.
+        let next = on_boards
+            .iter()
+            .enumerate()
+            .min_by_key(|(_, m)| m.played.ends)
+            .map(|(i, _)| i);
+        let Some(next) = next else {
+            match (tournament.state, tournament.format) {
+                (TournamentState::Completed, _) => break,
+                (_, TournamentFormat::Swiss) => start_next_swiss_round(&mut tournament)?,
+                (_, TournamentFormat::GroupsKnockout) if in_groups => {
+                    advance_to_knockout(&mut tournament)?
+                }
+                _ => return Err(TournamentError::InvalidState),
+            }
+            continue;
+        };
+        let done = on_boards.remove(next);
+        now = done.played.ends;
+        record_bracket_result(
+            &mut tournament,
+            done.match_id,
+            done.winner,
+            Some(done.score),
+            false,
+        )?;
+        played.push(done.played);
+    }
+    Ok((tournament, played))
+}
+
+/// Legs (or sets) to each side and the legs played, each leg won by side one with
+/// probability `one_wins_leg`.
+fn play_match(format: MatchFormat, one_wins_leg: f64, rng: &mut StdRng) -> (LegScore, u32) {
+    let mut legs = 0;
+    let mut leg = || {
+        legs += 1;
+        if rng.gen_bool(one_wins_leg) {
+            Team::One
+        } else {
+            Team::Two
+        }
+    };
+    let legs_to_win = format.legs / 2 + 1;
+    let score = match format.sets {
+        None => race(legs_to_win, &mut leg),
+        Some(sets) => race(sets / 2 + 1, &mut || {
+            let set = race(legs_to_win, &mut leg);
+            if set.team_1 > set.team_2 {
+                Team::One
+            } else {
+                Team::Two
+            }
+        }),
+    };
+    (score, legs)
+}
+
+/// First to `to_win`, each point going to whoever `point` says.
+fn race(to_win: u32, point: &mut impl FnMut() -> Team) -> LegScore {
+    let mut score = LegScore::default();
+    while score.team_1 < to_win && score.team_2 < to_win {
+        score.add(point());
+    }
+    score
+}
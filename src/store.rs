@@ -0,0 +1,308 @@
+//! Persistence for tournaments so state survives a server restart.
+//!
+//! The server picks a driver with `STORAGE_DRIVER` (see [`StorageDriver`]): nothing, a
+//! directory of JSON files, or (built with the `sqlite` feature) one SQLite database file for
+//! venues without a database server. Each tournament is one document either way, so a result
+//! and the stats it moves are written together or not at all.
+
+use crate::migrations::{upgrade, MigrateError, SCHEMA_VERSION};
+use crate::models::{Tournament, TournamentId};
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+use std::str::FromStr;
+
+/// Where the registry writes tournaments after every change.
+pub trait TournamentStore: Send + Sync {
+    /// Write the current state of a tournament (create or overwrite).
+    fn save(&self, tournament: &Tournament) -> io::Result<()>;
+    /// Remove a stored tournament. Removing one that was never saved is not an error.
+    fn delete(&self, id: TournamentId) -> io::Result<()>;
+    /// Every stored tournament (any order).
+    fn load_all(&self) -> io::Result<Vec<Tournament>>;
+    /// Whether the store can take writes right now (for the readiness check).
+    fn check(&self) -> io::Result<()>;
+}
+
+/// Which store the server keeps tournaments in.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum StorageDriver {
+    /// Nothing is stored; a restart starts empty (unless a snapshot is loaded).
+    Memory,
+    /// [`FileStore`] in the data directory.
+    File,
+    /// `SqliteStore`, in one database file. Needs the `sqlite` feature.
+    Sqlite,
+}
+
+/// A `STORAGE_DRIVER` value that isn't a driver.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct UnknownDriver(pub String);
+
+impl std::fmt::Display for UnknownDriver {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(
+            f,
+            "Unknown storage driver {:?} (expected memory, file or sqlite)",
+            self.0
+        )
+    }
+}
+
+impl std::error::Error for UnknownDriver {}
+
+impl FromStr for StorageDriver {
+    type Err = UnknownDriver;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.trim().to_ascii_lowercase().as_str() {
+            "memory" => Ok(StorageDriver::Memory),
+            "file" => Ok(StorageDriver::File),
+            "sqlite" => Ok(StorageDriver::Sqlite),
+            _ => Err(UnknownDriver(s.to_string())),
+        }
+    }
+}
+
+/// One JSON file per tournament (`<dir>/<id>.json`).
+pub struct FileStore {
+    dir: PathBuf,
+}
+
+impl FileStore {
+    /// Use `dir` for tournament files, creating it if needed.
+    pub fn open(dir: impl Into<PathBuf>) -> io::Result<Self> {
+        let dir = dir.into();
+        fs::create_dir_all(&dir)?;
+        Ok(Self { dir })
+    }
+
+    fn path_for(&self, id: TournamentId) -> PathBuf {
+        self.dir.join(format!("{}.json", id))
+    }
+}
+
+impl TournamentStore for FileStore {
+    fn save(&self, tournament: &Tournament) -> io::Result<()> {
+        let json = serde_json::to_vec(tournament)?;
+        // Write to a temp file and rename so a crash mid-write never leaves a truncated file.
+        let path = self.path_for(tournament.id);
+        let tmp = path.with_extension("json.tmp");
+        fs::write(&tmp, json)?;
+        fs::rename(&tmp, &path)
+    }
+
+    fn delete(&self, id: TournamentId) -> io::Result<()> {
+        match fs::remove_file(self.path_for(id)) {
+            Err(e) if e.kind() == io::ErrorKind::NotFound => Ok(()),
+            other => other,
+        }
+    }
+
+    fn load_all(&self) -> io::Result<Vec<Tournament>> {
+        let mut tournaments = Vec::new();
+        for entry in fs::read_dir(&self.dir)? {
+            let path = entry?.path();
+            if path.extension().and_then(|e| e.to_str()) != Some("json") {
+                continue;
+            }
+            tournaments.push(read_tournament(&path)?);
+        }
+        Ok(tournaments)
+    }
+
+    fn check(&self) -> io::Result<()> {
+        // Reading the directory isn't enough: a disk remounted read-only still lists fine.
+        let probe = self.dir.join(".ready.tmp");
+        fs::write(&probe, b"ok")?;
+        fs::remove_file(&probe)
+    }
+}
+
+/// Tournaments as rows of one SQLite database file, each the tournament's JSON with the schema
+/// version it was written at, so rows written by an older binary are migrated as they load.
+#[cfg(feature = "sqlite")]
+pub struct SqliteStore {
+    conn: std::sync::Mutex<rusqlite::Connection>,
+}
+
+#[cfg(feature = "sqlite")]
+impl SqliteStore {
+    /// Use the database at `path`, creating it (and its directory) if needed.
+    pub fn open(path: impl AsRef<Path>) -> io::Result<Self> {
+        let path = path.as_ref();
+        if let Some(dir) = path.parent().filter(|d| !d.as_os_str().is_empty()) {
+            fs::create_dir_all(dir)?;
+        }
+        let conn = rusqlite::Connection::open(path).map_err(sqlite_error)?;
+        conn.execute_batch(
+            "CREATE TABLE IF NOT EXISTS tournaments (
+                id TEXT PRIMARY KEY,
+                schema_version INTEGER NOT NULL,
+                saved_at TEXT NOT NULL,
+                body TEXT NOT NULL
+            )",
+        )
+        .map_err(sqlite_error)?;
+        Ok(Self {
+            conn: std::sync::Mutex::new(conn),
+        })
+    }
+
+    fn conn(&self) -> io::Result<std::sync::MutexGuard<'_, rusqlite::Connection>> {
+        self.conn.lock().map_err(|_| io::Error::other("lock error"))
+    }
+}
+
+#[cfg(feature = "sqlite")]
+impl TournamentStore for SqliteStore {
+    fn save(&self, tournament: &Tournament) -> io::Result<()> {
+        let body = serde_json::to_string(tournament)?;
+        self.conn()?
+            .execute(
+                "INSERT INTO tournaments (id, schema_version, saved_at, body)
+                VALUES (?1, ?2, ?3, ?4)
+                ON CONFLICT(id) DO UPDATE SET
+                    schema_version = excluded.schema_version,
+                    saved_at = excluded.saved_at,
+                    body = excluded.body",
+                rusqlite::params![
+                    tournament.id.to_string(),
+                    SCHEMA_VERSION,
+                    Utc::now().to_rfc3339(),
+                    body
+                ],
+            )
+            .map_err(sqlite_error)?;
+        Ok(())
+    }
+
+    fn delete(&self, id: TournamentId) -> io::Result<()> {
+        self.conn()?
+            .execute("DELETE FROM tournaments WHERE id = ?1", [id.to_string()])
+            .map_err(sqlite_error)?;
+        Ok(())
+    }
+
+    fn load_all(&self) -> io::Result<Vec<Tournament>> {
+        let conn = self.conn()?;
+        let mut stmt = conn
+            .prepare("SELECT id, schema_version, saved_at, body FROM tournaments")
+            .map_err(sqlite_error)?;
+        let rows = stmt
+            .query_map([], |row| {
+                Ok((
+                    row.get::<_, String>(0)?,
+                    row.get::<_, u32>(1)?,
+                    row.get::<_, String>(2)?,
+                    row.get::<_, String>(3)?,
+                ))
+            })
+            .map_err(sqlite_error)?;
+        let mut tournaments = Vec::new();
+        for row in rows {
+            let (id, version, saved_at, body) = row.map_err(sqlite_error)?;
+            let invalid = |e: &dyn std::fmt::Display| {
+                io::Error::new(io::ErrorKind::InvalidData, format!("{}: {}", id, e))
+            };
+            let saved_at = DateTime::parse_from_rfc3339(&saved_at)
+                .map_err(|e| invalid(&e))?
+                .with_timezone(&Utc);
+            let mut doc: Value = serde_json::from_str(&body).map_err(|e| invalid(&e))?;
+            upgrade(&mut doc, version, saved_at).map_err(|e| invalid(&e))?;
+            tournaments.push(serde_json::from_value(doc).map_err(|e| invalid(&e))?);
+        }
+        Ok(tournaments)
+    }
+
+    fn check(&self) -> io::Result<()> {
+        // A write that is rolled back: a read-only file or a full disk fails it.
+        let conn = self.conn()?;
+        let tx = conn.unchecked_transaction().map_err(sqlite_error)?;
+        tx.execute(
+            "INSERT OR REPLACE INTO tournaments (id, schema_version, saved_at, body)
+            VALUES ('.ready', 0, '', '')",
+            [],
+        )
+        .map_err(sqlite_error)?;
+        tx.rollback().map_err(sqlite_error)
+    }
+}
+
+#[cfg(feature = "sqlite")]
+fn sqlite_error(e: rusqlite::Error) -> io::Error {
+    io::Error::other(e.to_string())
+}
+
+/// Every tournament in one JSON file: written when the server shuts down and read back when it
+/// starts, so a restart without a data directory keeps its state.
+#[derive(Serialize)]
+struct Snapshot {
+    saved_at: DateTime<Utc>,
+    schema_version: u32,
+    tournaments: Vec<Tournament>,
+}
+
+/// A snapshot as read, before its tournaments are migrated (see [`crate::migrations`]).
+#[derive(Deserialize)]
+struct StoredSnapshot {
+    saved_at: DateTime<Utc>,
+    /// 0 for snapshots written before versioning.
+    #[serde(default)]
+    schema_version: u32,
+    tournaments: Vec<Value>,
+}
+
+/// Write `tournaments` to the snapshot file at `path` (replacing it atomically).
+pub fn write_snapshot(path: &Path, tournaments: Vec<Tournament>) -> io::Result<()> {
+    let json = serde_json::to_vec(&Snapshot {
+        saved_at: Utc::now(),
+        schema_version: SCHEMA_VERSION,
+        tournaments,
+    })?;
+    let tmp = path.with_extension("tmp");
+    fs::write(&tmp, json)?;
+    fs::rename(&tmp, path)
+}
+
+/// Tournaments from the snapshot file at `path`, migrated to the current schema; none if the
+/// file doesn't exist. A snapshot from a newer schema version is rejected.
+pub fn read_snapshot(path: &Path) -> io::Result<Vec<Tournament>> {
+    let bytes = match fs::read(path) {
+        Ok(bytes) => bytes,
+        Err(e) if e.kind() == io::ErrorKind::NotFound => return Ok(Vec::new()),
+        Err(e) => return Err(e),
+    };
+    let invalid = |e: &dyn std::fmt::Display| {
+        io::Error::new(
+            io::ErrorKind::InvalidData,
+            format!("{}: {}", path.display(), e),
+        )
+    };
+    let snapshot: StoredSnapshot = serde_json::from_slice(&bytes).map_err(|e| invalid(&e))?;
+    if snapshot.schema_version > SCHEMA_VERSION {
+        return Err(invalid(&MigrateError::Ahead {
+            found: snapshot.schema_version,
+            known: SCHEMA_VERSION,
+        }));
+    }
+    let mut tournaments = Vec::with_capacity(snapshot.tournaments.len());
+    for mut doc in snapshot.tournaments {
+        upgrade(&mut doc, snapshot.schema_version, snapshot.saved_at).map_err(|e| invalid(&e))?;
+        tournaments.push(serde_json::from_value(doc).map_err(|e| invalid(&e))?);
+    }
+    Ok(tournaments)
+}
+
+fn read_tournament(path: &Path) -> io::Result<Tournament> {
+    let bytes = fs::read(path)?;
+    serde_json::from_slice(&bytes).map_err(|e| {
+        io::Error::new(
+            io::ErrorKind::InvalidData,
+            format!("{}: {}", path.display(), e),
+        )
+    })
+}
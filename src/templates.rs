@@ -0,0 +1,327 @@
+//! Tournament templates and cloning, for events that are set up the same way every week.
+//!
+//! A template is a named set of [`TournamentSettings`]: the same settings a tournament can be
+//! created with directly, checked the same way (by building a tournament from them) before it
+//! is saved, so a template can't hold anything direct creation would reject. Cloning copies a
+//! tournament's configuration, and optionally its players, into a new tournament in Setup; no
+//! results come across.
+
+use crate::logic::{numbered_boards, reseed_by_stats, set_boards, set_match_formats};
+use crate::models::{
+    Board, DrawMode, EntryType, MatchFormats, Player, Tournament, TournamentError,
+    TournamentFormat, TournamentMode, MAX_BOARDS,
+};
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+
+/// Longest allowed template name.
+pub const MAX_TEMPLATE_NAME_LEN: usize = 64;
+
+/// How a new tournament is set up: given when creating one, or saved in a template.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct TournamentSettings {
+    /// Display name (may be empty).
+    #[serde(default)]
+    pub name: String,
+    #[serde(default = "default_max_losses")]
+    pub max_losses: u32,
+    /// Group play is 2v2 by default; the bracket formats and pairs tournaments (team against
+    /// team) are always 1v1.
+    #[serde(default)]
+    pub mode: Option<TournamentMode>,
+    #[serde(default)]
+    pub format: TournamentFormat,
+    #[serde(default)]
+    pub entry_type: EntryType,
+    /// Legs (or sets) per round; counts must be odd.
+    #[serde(default)]
+    pub match_formats: MatchFormats,
+    /// Boards at the venue, named "Board 1", "Board 2", ...
+    #[serde(default)]
+    pub boards: usize,
+    #[serde(default)]
+    pub draw_mode: DrawMode,
+    /// Single elimination: first-round losers play a plate.
+    #[serde(default)]
+    pub plate: bool,
+}
+
+fn default_max_losses() -> u32 {
+    3
+}
+
+impl Default for TournamentSettings {
+    fn default() -> Self {
+        Self {
+            name: String::new(),
+            max_losses: default_max_losses(),
+            mode: None,
+            format: TournamentFormat::default(),
+            entry_type: EntryType::default(),
+            match_formats: MatchFormats::default(),
+            boards: 0,
+            draw_mode: DrawMode::default(),
+            plate: false,
+        }
+    }
+}
+
+impl TournamentSettings {
+    /// A new tournament in Setup with these settings, or the first one that is invalid.
+    pub fn build(&self) -> Result<Tournament, TournamentError> {
+        let one_v_one =
+            self.format != TournamentFormat::Elimination || self.entry_type == EntryType::Pairs;
+        let mode = self.mode.unwrap_or(if one_v_one {
+            TournamentMode::OneVOne
+        } else {
+            TournamentMode::TwoVTwo
+        });
+        if one_v_one && mode != TournamentMode::OneVOne {
+            return Err(TournamentError::UnsupportedMode);
+        }
+        let mut tournament = Tournament::new(self.max_losses, mode);
+        tournament.set_name(&self.name)?;
+        tournament.set_entry_type(self.entry_type)?;
+        tournament.format = self.format;
+        set_match_formats(&mut tournament, self.match_formats.clone())?;
+        set_boards(
+            &mut tournament,
+            &numbered_boards(self.boards.min(MAX_BOARDS + 1)),
+        )?;
+        tournament.set_draw_mode(self.draw_mode)?;
+        tournament.set_plate(self.plate)?;
+        Ok(tournament)
+    }
+}
+
+/// Settings saved under a name, to create tournaments from.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct TournamentTemplate {
+    /// Lower-case letters, digits and hyphens, e.g. `thursday-league`.
+    pub name: String,
+    pub settings: TournamentSettings,
+}
+
+/// Why a template could not be saved or found.
+#[derive(Clone, Debug, PartialEq)]
+pub enum TemplateError {
+    /// The name is empty, too long, or not lower-case letters, digits and hyphens.
+    InvalidName,
+    NotFound(String),
+    /// The settings are invalid.
+    Tournament(TournamentError),
+    /// The template could not be written to its file.
+    Storage(String),
+}
+
+impl std::fmt::Display for TemplateError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            TemplateError::InvalidName => write!(
+                f,
+                "Template name must be 1 to {} lower-case letters, digits and hyphens",
+                MAX_TEMPLATE_NAME_LEN
+            ),
+            TemplateError::NotFound(name) => write!(f, "No template called {}", name),
+            TemplateError::Tournament(e) => write!(f, "{}", e),
+            TemplateError::Storage(e) => write!(f, "Could not save template: {}", e),
+        }
+    }
+}
+
+impl From<TournamentError> for TemplateError {
+    fn from(e: TournamentError) -> Self {
+        TemplateError::Tournament(e)
+    }
+}
+
+fn valid_name(name: &str) -> bool {
+    (1..=MAX_TEMPLATE_NAME_LEN).contains(&name.len())
+        && name
+            .bytes()
+            .all(|b| b.is_ascii_lowercase() || b.is_ascii_digit() || b == b'-')
+}
+
+/// Templates by name, each also written to `<dir>/<name>.json` when a directory is set.
+pub struct TemplateStore {
+    dir: Option<PathBuf>,
+    templates: Mutex<BTreeMap<String, TournamentTemplate>>,
+}
+
+impl TemplateStore {
+    /// Templates kept in memory only (lost on restart).
+    pub fn in_memory() -> Self {
+        Self {
+            dir: None,
+            templates: Mutex::new(BTreeMap::new()),
+        }
+    }
+
+    /// Templates kept as JSON files in `dir` (created if needed), with the ones there loaded.
+    pub fn open(dir: impl Into<PathBuf>) -> io::Result<Self> {
+        let dir = dir.into();
+        fs::create_dir_all(&dir)?;
+        let mut templates = BTreeMap::new();
+        for entry in fs::read_dir(&dir)? {
+            let path = entry?.path();
+            if path.extension().and_then(|e| e.to_str()) != Some("json") {
+                continue;
+            }
+            let template = read_template(&path)?;
+            templates.insert(template.name.clone(), template);
+        }
+        Ok(Self {
+            dir: Some(dir),
+            templates: Mutex::new(templates),
+        })
+    }
+
+    /// Save `template`, replacing any with the same name, once its settings are checked. The
+    /// template is stored (and returned) with the name and mode its tournaments get.
+    pub fn save(
+        &self,
+        mut template: TournamentTemplate,
+    ) -> Result<TournamentTemplate, TemplateError> {
+        if !valid_name(&template.name) {
+            return Err(TemplateError::InvalidName);
+        }
+        let built = template.settings.build()?;
+        template.settings.name = built.name;
+        template.settings.mode = Some(built.mode);
+        let mut templates = self.templates.lock().unwrap_or_else(|e| e.into_inner());
+        if let Some(dir) = &self.dir {
+            write_template(dir, &template).map_err(|e| TemplateError::Storage(e.to_string()))?;
+        }
+        templates.insert(template.name.clone(), template.clone());
+        Ok(template)
+    }
+
+    pub fn get(&self, name: &str) -> Result<TournamentTemplate, TemplateError> {
+        let templates = self.templates.lock().unwrap_or_else(|e| e.into_inner());
+        templates
+            .get(name)
+            .cloned()
+            .ok_or_else(|| TemplateError::NotFound(name.to_string()))
+    }
+
+    /// Every template, by name.
+    pub fn list(&self) -> Vec<TournamentTemplate> {
+        let templates = self.templates.lock().unwrap_or_else(|e| e.into_inner());
+        templates.values().cloned().collect()
+    }
+
+    /// Replace every template with `templates` as one change (a backup being restored). Each
+    /// is checked as [`Self::save`] checks it before anything is written; if a file can't be
+    /// written or removed, the old templates are written back and nothing changes.
+    pub fn replace_all(&self, mut templates: Vec<TournamentTemplate>) -> Result<(), TemplateError> {
+        for template in &mut templates {
+            if !valid_name(&template.name) {
+                return Err(TemplateError::InvalidName);
+            }
+            let built = template.settings.build()?;
+            template.settings.name = built.name;
+            template.settings.mode = Some(built.mode);
+        }
+        let mut current = self.templates.lock().unwrap_or_else(|e| e.into_inner());
+        let next: BTreeMap<String, TournamentTemplate> =
+            templates.into_iter().map(|t| (t.name.clone(), t)).collect();
+        if let Some(dir) = &self.dir {
+            let written = next
+                .values()
+                .try_for_each(|t| write_template(dir, t))
+                .and_then(|()| {
+                    current
+                        .keys()
+                        .filter(|name| !next.contains_key(*name))
+                        .try_for_each(|name| remove_template(dir, name))
+                });
+            if let Err(e) = written {
+                for template in current.values() {
+                    let _ = write_template(dir, template);
+                }
+                for name in next.keys().filter(|name| !current.contains_key(*name)) {
+                    let _ = remove_template(dir, name);
+                }
+                return Err(TemplateError::Storage(e.to_string()));
+            }
+        }
+        *current = next;
+        Ok(())
+    }
+}
+
+fn read_template(path: &Path) -> io::Result<TournamentTemplate> {
+    let json = fs::read(path)?;
+    serde_json::from_slice(&json).map_err(|e| {
+        io::Error::new(
+            io::ErrorKind::InvalidData,
+            format!("{}: {}", path.display(), e),
+        )
+    })
+}
+
+fn write_template(dir: &Path, template: &TournamentTemplate) -> io::Result<()> {
+    let json = serde_json::to_vec(template)?;
+    // Template names are restricted to a safe file name (see `valid_name`).
+    let path = dir.join(format!("{}.json", template.name));
+    let tmp = path.with_extension("json.tmp");
+    fs::write(&tmp, json)?;
+    fs::rename(&tmp, &path)
+}
+
+fn remove_template(dir: &Path, name: &str) -> io::Result<()> {
+    match fs::remove_file(dir.join(format!("{}.json", name))) {
+        Err(e) if e.kind() == io::ErrorKind::NotFound => Ok(()),
+        other => other,
+    }
+}
+
+/// A new tournament in Setup set up like `source`: name, format, mode, entry type, max losses,
+/// rating K-factor, match formats, draw mode, walkover rule and boards. With `with_players`
+/// every entrant (and team) is entered again with the rating they finished on, seeded afresh
+/// from their results in `source` (see [`reseed_by_stats`]); their results stay behind, and so
+/// do players deleted since.
+pub fn clone_tournament(
+    source: &Tournament,
+    with_players: bool,
+) -> Result<Tournament, TournamentError> {
+    let mut clone = Tournament::new(source.max_losses, source.mode);
+    clone.name = source.name.clone();
+    clone.format = source.format;
+    clone.rating_k = source.rating_k;
+    clone.entry_type = source.entry_type;
+    clone.match_formats = source.match_formats.clone();
+    clone.draw_mode = source.draw_mode;
+    clone.walkover_counts_as_win = source.walkover_counts_as_win;
+    clone.plate = source.plate;
+    clone.boards = source
+        .boards
+        .iter()
+        .map(|b| Board::new(b.name.clone()))
+        .collect();
+    if !with_players {
+        return Ok(clone);
+    }
+    let mut players: Vec<Player> = source
+        .all_players()
+        .into_iter()
+        .filter(|p| p.deleted_at.is_none())
+        .cloned()
+        .collect();
+    reseed_by_stats(&mut players);
+    players.sort_by_key(|p| p.seed);
+    for p in players {
+        match clone.entry_type {
+            EntryType::Singles => clone.add_player(p.name.as_str())?,
+            EntryType::Pairs => clone.add_pair(&p.name, &p.members)?,
+        }
+        if let Some(entered) = clone.players.last_mut() {
+            entered.rating = p.rating;
+        }
+    }
+    Ok(clone)
+}
@@ -0,0 +1,411 @@
+//! Checks on request bodies before they reach a tournament, reported field by field.
+//!
+//! A tournament still enforces its own rules (a name already taken, a score that doesn't fit
+//! the match's format); these catch what is wrong with a request on its own, and report every
+//! field at fault at once, so a form can show each problem next to its field. The checks are
+//! plain functions over one value, for request types to combine in their [`Validate`] impl.
+
+use crate::models::{
+    Handicap, LegScore, MatchFormats, PlayerId, Team, MAX_BOARDS, MAX_HANDICAP_LEGS,
+    MAX_HANDICAP_POINTS, MAX_PLAYER_NAME_LEN, MAX_TOURNAMENT_NAME_LEN,
+};
+use crate::scoring::{is_possible_score, CricketDart, GameType, MatchFormat, BULL, MAX_VISIT};
+use crate::simulate::{Outcomes, MAX_SIMULATED_ENTRANTS};
+use crate::templates::TournamentSettings;
+use serde::Deserialize;
+
+/// One field of a request that breaks a rule.
+#[derive(Clone, Debug, PartialEq)]
+pub struct FieldError {
+    /// Path to the field, e.g. `name` or `match_formats.final.legs`.
+    pub field: String,
+    /// What is wrong, naming the field: "score must be between 0 and 180".
+    pub message: String,
+}
+
+impl FieldError {
+    pub fn new(field: &str, message: impl Into<String>) -> Self {
+        Self {
+            field: field.to_string(),
+            message: message.into(),
+        }
+    }
+}
+
+/// Every field of a request that breaks a rule, in the order they were checked.
+#[derive(Clone, Debug, PartialEq)]
+pub struct ValidationErrors(pub Vec<FieldError>);
+
+impl std::fmt::Display for ValidationErrors {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        let messages: Vec<&str> = self.0.iter().map(|e| e.message.as_str()).collect();
+        write!(f, "{}", messages.join("; "))
+    }
+}
+
+/// A request that can be checked before it is acted on.
+pub trait Validate {
+    fn validate(&self) -> Result<(), ValidationErrors>;
+}
+
+/// Ok when every check passed, else all the ones that failed.
+pub fn collect(
+    checks: impl IntoIterator<Item = Result<(), FieldError>>,
+) -> Result<(), ValidationErrors> {
+    let errors: Vec<FieldError> = checks.into_iter().filter_map(Result::err).collect();
+    if errors.is_empty() {
+        Ok(())
+    } else {
+        Err(ValidationErrors(errors))
+    }
+}
+
+/// A three-dart visit: 0 to 180, and a total some three darts add up to (not 179, say).
+pub fn dart_score(field: &str, score: u32) -> Result<(), FieldError> {
+    if score > MAX_VISIT {
+        Err(FieldError::new(
+            field,
+            format!("{} must be between 0 and {}", field, MAX_VISIT),
+        ))
+    } else if !is_possible_score(score) {
+        Err(FieldError::new(
+            field,
+            format!("{} of {} can't be thrown with three darts", field, score),
+        ))
+    } else {
+        Ok(())
+    }
+}
+
+/// Darts thrown in one visit: 1, 2 or 3.
+pub fn darts(field: &str, darts: u32) -> Result<(), FieldError> {
+    if (1..=3).contains(&darts) {
+        Ok(())
+    } else {
+        Err(FieldError::new(
+            field,
+            format!("{} must be 1, 2 or 3", field),
+        ))
+    }
+}
+
+/// A best-of count: odd, so a match can't end level.
+pub fn odd_best_of(field: &str, best_of: u32) -> Result<(), FieldError> {
+    if best_of % 2 == 1 {
+        Ok(())
+    } else {
+        Err(FieldError::new(
+            field,
+            format!("{} must be an odd number (best of 1, 3, 5, ...)", field),
+        ))
+    }
+}
+
+/// A player's (or team's) name: not blank once trimmed, at most [`MAX_PLAYER_NAME_LEN`]
+/// characters, and no control characters.
+pub fn player_name(field: &str, name: &str) -> Result<(), FieldError> {
+    if name.trim().is_empty() {
+        return Err(FieldError::new(field, format!("{} is required", field)));
+    }
+    text(field, name, MAX_PLAYER_NAME_LEN)
+}
+
+/// Free text of at most `max` characters once trimmed, without control characters.
+fn text(field: &str, value: &str, max: usize) -> Result<(), FieldError> {
+    let value = value.trim();
+    if value.chars().count() > max {
+        return Err(FieldError::new(
+            field,
+            format!("{} must be at most {} characters", field, max),
+        ));
+    }
+    if value.chars().any(char::is_control) {
+        return Err(FieldError::new(
+            field,
+            format!("{} must not contain control characters", field),
+        ));
+    }
+    Ok(())
+}
+
+/// Enter a player: `{ "name": "Anna" }`.
+#[derive(Clone, Debug, Deserialize)]
+pub struct CreatePlayerRequest {
+    pub name: String,
+}
+
+impl Validate for CreatePlayerRequest {
+    fn validate(&self) -> Result<(), ValidationErrors> {
+        collect([player_name("name", &self.name)])
+    }
+}
+
+/// A player's handicap: `{ "points": 100, "legs": 1 }` (both optional).
+impl Validate for Handicap {
+    fn validate(&self) -> Result<(), ValidationErrors> {
+        let at_most = |field: &str, value: u32, max: u32| {
+            if value <= max {
+                Ok(())
+            } else {
+                Err(FieldError::new(
+                    field,
+                    format!("{} must be at most {}", field, max),
+                ))
+            }
+        };
+        collect([
+            at_most("points", self.points, MAX_HANDICAP_POINTS),
+            at_most("legs", self.legs, MAX_HANDICAP_LEGS),
+        ])
+    }
+}
+
+/// A bracket match's winner, and optionally the legs (or sets) won by each side.
+#[derive(Clone, Debug, Deserialize)]
+pub struct RecordResultRequest {
+    pub winner: PlayerId,
+    #[serde(default)]
+    pub score: Option<LegScore>,
+}
+
+impl Validate for RecordResultRequest {
+    fn validate(&self) -> Result<(), ValidationErrors> {
+        let level = self.score.filter(|s| s.team_1 == s.team_2);
+        collect([match level {
+            Some(_) => Err(FieldError::new("score", "score can't be level")),
+            None => Ok(()),
+        }])
+    }
+}
+
+/// One visit at the board. For x01 (the default `game_type`), points scored with `darts`
+/// darts (3 by default), of which `darts_at_double` were aimed at a finishing double. For
+/// cricket, `throws`: each dart's `number` (1–20, 25 for the bull, 0 for a miss) and
+/// `multiplier` (1–3); `cut_throat` when the match's first visit should start it cut-throat.
+#[derive(Clone, Debug, Deserialize)]
+pub struct RecordVisitRequest {
+    pub team: Team,
+    #[serde(default)]
+    pub game_type: GameType,
+    #[serde(default)]
+    pub score: Option<u32>,
+    #[serde(default = "three_darts")]
+    pub darts: u32,
+    #[serde(default)]
+    pub double_out: bool,
+    #[serde(default)]
+    pub darts_at_double: u32,
+    #[serde(default)]
+    pub throws: Vec<CricketDart>,
+    #[serde(default)]
+    pub cut_throat: bool,
+}
+
+fn three_darts() -> u32 {
+    3
+}
+
+impl Validate for RecordVisitRequest {
+    fn validate(&self) -> Result<(), ValidationErrors> {
+        match self.game_type {
+            GameType::X01 => {
+                let score = match self.score {
+                    Some(score) => dart_score("score", score),
+                    None => Err(FieldError::new("score", "score is required")),
+                };
+                let at_double = if self.darts_at_double <= self.darts {
+                    Ok(())
+                } else {
+                    Err(FieldError::new(
+                        "darts_at_double",
+                        "darts_at_double can't be more than darts",
+                    ))
+                };
+                let throws = match self.throws.is_empty() {
+                    true => Ok(()),
+                    false => Err(FieldError::new("throws", "throws are for cricket visits")),
+                };
+                collect([score, darts("darts", self.darts), at_double, throws])
+            }
+            GameType::Cricket => {
+                let score = match self.score {
+                    None => Ok(()),
+                    Some(_) => Err(FieldError::new(
+                        "score",
+                        "cricket visits are scored dart by dart, in throws",
+                    )),
+                };
+                let count = if (1..=3).contains(&self.throws.len()) {
+                    Ok(())
+                } else {
+                    Err(FieldError::new(
+                        "throws",
+                        "throws must have 1, 2 or 3 darts",
+                    ))
+                };
+                let mut checks = vec![score, count];
+                checks.extend(
+                    self.throws
+                        .iter()
+                        .enumerate()
+                        .map(|(i, dart)| cricket_dart(&format!("throws.{}", i), dart)),
+                );
+                collect(checks)
+            }
+        }
+    }
+}
+
+/// A cricket dart somewhere on the board: 0–20 or 25, single to treble (no treble bull).
+pub fn cricket_dart(field: &str, dart: &CricketDart) -> Result<(), FieldError> {
+    if dart.is_valid() {
+        Ok(())
+    } else if dart.number == BULL && dart.multiplier == 3 {
+        Err(FieldError::new(
+            field,
+            format!("{} is a bull, which has no treble", field),
+        ))
+    } else if dart.number > 20 {
+        Err(FieldError::new(
+            field,
+            format!("{} number must be 0 to 20, or 25 for the bull", field),
+        ))
+    } else {
+        Err(FieldError::new(
+            field,
+            format!("{} multiplier must be 1, 2 or 3", field),
+        ))
+    }
+}
+
+/// A part of `GET /api/tournaments/{id}/full` that can be left out with `?include=`.
+#[derive(Clone, Copy, Debug, Eq, PartialEq)]
+pub enum Section {
+    /// Every player with their stats for the event.
+    Players,
+    /// Bracket, groups and the current round's matches, with their results.
+    Matches,
+    /// Round-robin or group tables, for formats that have them.
+    Standings,
+    /// Boards and the matches on them.
+    Boards,
+    /// Every scored visit (x01 and cricket) and the match logs; the largest part by far.
+    Visits,
+}
+
+/// Each section by the name `?include=` uses for it.
+pub const SECTIONS: [(&str, Section); 5] = [
+    ("players", Section::Players),
+    ("matches", Section::Matches),
+    ("standings", Section::Standings),
+    ("boards", Section::Boards),
+    ("visits", Section::Visits),
+];
+
+/// The sections a comma-separated `?include=` list asks for; every section when there is no
+/// list. An empty list leaves only the tournament itself.
+pub fn include_sections(include: Option<&str>) -> Result<Vec<Section>, ValidationErrors> {
+    let Some(include) = include else {
+        return Ok(SECTIONS.iter().map(|&(_, s)| s).collect());
+    };
+    let mut sections = Vec::new();
+    for name in include.split(',').map(str::trim).filter(|n| !n.is_empty()) {
+        match SECTIONS.iter().find(|(n, _)| n.eq_ignore_ascii_case(name)) {
+            Some(&(_, section)) if !sections.contains(&section) => sections.push(section),
+            Some(_) => {}
+            None => {
+                return Err(ValidationErrors(vec![FieldError::new(
+                    "include",
+                    format!(
+                        "include has no section {:?} (expected players, matches, standings, \
+                         boards or visits)",
+                        name
+                    ),
+                )]))
+            }
+        }
+    }
+    Ok(sections)
+}
+
+/// Settings to create a tournament (or save a template) with.
+impl Validate for TournamentSettings {
+    fn validate(&self) -> Result<(), ValidationErrors> {
+        let boards = if self.boards <= MAX_BOARDS {
+            Ok(())
+        } else {
+            Err(FieldError::new(
+                "boards",
+                format!("boards must be at most {}", MAX_BOARDS),
+            ))
+        };
+        let mut checks = vec![text("name", &self.name, MAX_TOURNAMENT_NAME_LEN), boards];
+        checks.extend(match_formats(&self.match_formats));
+        collect(checks)
+    }
+}
+
+/// What to simulate: `{ "outcomes": "seeded", "minutes_per_leg": 4, "boards": 3,
+/// "entrants": 27, "seed": 42 }`, every field optional.
+#[derive(Clone, Debug, Default, Deserialize)]
+pub struct SimulateRequest {
+    #[serde(default)]
+    pub outcomes: Outcomes,
+    pub minutes_per_leg: Option<f64>,
+    pub boards: Option<usize>,
+    pub entrants: Option<usize>,
+    pub seed: Option<u64>,
+}
+
+impl Validate for SimulateRequest {
+    fn validate(&self) -> Result<(), ValidationErrors> {
+        let minutes = match self.minutes_per_leg {
+            Some(m) if !(m > 0.0 && m <= 60.0) => Err(FieldError::new(
+                "minutes_per_leg",
+                "minutes_per_leg must be more than 0 and at most 60",
+            )),
+            _ => Ok(()),
+        };
+        let within = |field: &str, value: Option<usize>, min: usize, max: usize| match value {
+            Some(v) if !(min..=max).contains(&v) => Err(FieldError::new(
+                field,
+                format!("{} must be between {} and {}", field, min, max),
+            )),
+            _ => Ok(()),
+        };
+        collect([
+            minutes,
+            within("boards", self.boards, 1, MAX_BOARDS),
+            within("entrants", self.entrants, 2, MAX_SIMULATED_ENTRANTS),
+        ])
+    }
+}
+
+/// Each format set, checked for odd best-of counts.
+fn match_formats(formats: &MatchFormats) -> Vec<Result<(), FieldError>> {
+    let named = formats
+        .rounds
+        .iter()
+        .map(|(round, f)| (format!("match_formats.rounds.{}", round), f))
+        .chain(
+            formats
+                .semi_final
+                .iter()
+                .map(|f| ("match_formats.semi_final".to_string(), f)),
+        )
+        .chain(
+            formats
+                .final_match
+                .iter()
+                .map(|f| ("match_formats.final".to_string(), f)),
+        );
+    named
+        .flat_map(|(field, f): (String, &MatchFormat)| {
+            let legs = odd_best_of(&format!("{}.legs", field), f.legs);
+            let sets = f
+                .sets
+                .map_or(Ok(()), |sets| odd_best_of(&format!("{}.sets", field), sets));
+            [legs, sets]
+        })
+        .collect()
+}
@@ -0,0 +1,170 @@
+//! Optimistic concurrency: versions of tournaments and their matches, so two scorers working
+//! from the same state can't overwrite each other unseen.
+//!
+//! Every change the registry makes to a tournament bumps [`Tournament::version`], and the
+//! version of each match the change touched: its players or result, its scoring, or its
+//! undo history. A change to one match leaves the others' versions alone, so tablets scoring
+//! different boards don't get in each other's way.
+//!
+//! Versions go out as ETags: `"t<n>"` for a tournament and `"m<n>"` for a match. A change
+//! sent with `If-Match` is only made if the tag is still current, checked under the same
+//! lock the change is made under; otherwise the registry refuses it with
+//! [`RegistryError::Stale`](crate::RegistryError) carrying the tournament as it is now.
+
+use crate::models::{BracketMatch, GameMatch, MatchAction, MatchId, Team, Tournament};
+use crate::scoring::{CricketMatch, X01Match};
+use std::collections::{HashMap, HashSet};
+
+/// The ETag of `tournament` as it is.
+pub fn tournament_etag(tournament: &Tournament) -> String {
+    format!("\"t{}\"", tournament.version)
+}
+
+/// Version of one match of `tournament` (0 for one never changed since it was drawn).
+pub fn match_version(tournament: &Tournament, id: MatchId) -> u64 {
+    tournament.match_versions.get(&id).copied().unwrap_or(0)
+}
+
+/// The ETag of one match of `tournament`.
+pub fn match_etag(tournament: &Tournament, id: MatchId) -> String {
+    format!("\"m{}\"", match_version(tournament, id))
+}
+
+/// What an `If-Match` header asks for: that the tournament, or on a match's routes that match,
+/// is still at one of the tags given.
+#[derive(Clone, Debug, Eq, PartialEq)]
+pub struct Precondition {
+    tags: Vec<String>,
+    match_id: Option<MatchId>,
+}
+
+impl Precondition {
+    /// Read an `If-Match` value for a tournament's routes, or a match's when `match_id` is
+    /// given. None for `*`, which any existing tournament meets. Weak tags never match.
+    pub fn parse(value: &str, match_id: Option<MatchId>) -> Option<Self> {
+        if value.trim() == "*" {
+            return None;
+        }
+        let tags = value
+            .split(',')
+            .map(str::trim)
+            .filter(|t| !t.is_empty() && !t.starts_with("W/"))
+            .map(str::to_string)
+            .collect();
+        Some(Self { tags, match_id })
+    }
+
+    /// The current ETag this precondition is compared with.
+    pub fn current_etag(&self, tournament: &Tournament) -> String {
+        match self.match_id {
+            Some(id) => match_etag(tournament, id),
+            None => tournament_etag(tournament),
+        }
+    }
+
+    /// Whether `tournament` is still at one of the tags.
+    pub fn holds(&self, tournament: &Tournament) -> bool {
+        let current = self.current_etag(tournament);
+        self.tags.contains(&current)
+    }
+}
+
+/// A change refused by a [`Precondition`]: the tournament as it is now, and the tag the client
+/// should have sent. Equal when they name the same tournament at the same version.
+#[derive(Clone, Debug)]
+pub struct Stale {
+    pub tournament: Box<Tournament>,
+    pub etag: String,
+}
+
+impl PartialEq for Stale {
+    fn eq(&self, other: &Self) -> bool {
+        self.tournament.id == other.tournament.id
+            && self.tournament.version == other.tournament.version
+            && self.etag == other.etag
+    }
+}
+
+impl Eq for Stale {}
+
+/// Everything about one match that a change can touch.
+#[derive(PartialEq)]
+struct MatchState<'a> {
+    bracket: Option<&'a BracketMatch>,
+    game: Option<&'a GameMatch>,
+    result: Option<Team>,
+    scores: Option<&'a X01Match>,
+    cricket: Option<&'a CricketMatch>,
+    log: Option<&'a Vec<MatchAction>>,
+}
+
+fn match_states(t: &Tournament) -> HashMap<MatchId, MatchState<'_>> {
+    let mut states = HashMap::new();
+    let bracket = t.bracket.iter().flat_map(|b| &b.matches);
+    let group = t.group_stage.iter().flat_map(|s| &s.matches);
+    for m in bracket.chain(group) {
+        states.insert(
+            m.id,
+            MatchState {
+                bracket: Some(m),
+                game: None,
+                result: None,
+                scores: t.scores.get(&m.id),
+                cricket: t.cricket.get(&m.id),
+                log: t.match_log.get(&m.id),
+            },
+        );
+    }
+    let semi_final_results = t.bracket_semi_final_results.as_ref();
+    let games = t
+        .matches
+        .iter()
+        .chain(t.bracket_semi_final_matches.iter().flatten())
+        .chain(&t.bracket_finals_match);
+    for m in games {
+        let result = t
+            .match_results
+            .get(&m.id)
+            .or_else(|| t.final_match_results.get(&m.id))
+            .or_else(|| semi_final_results.and_then(|r| r.get(&m.id)))
+            .copied()
+            .or_else(|| {
+                t.bracket_finals_match
+                    .as_ref()
+                    .filter(|f| f.id == m.id)
+                    .and(t.bracket_finals_result)
+            });
+        states.insert(
+            m.id,
+            MatchState {
+                bracket: None,
+                game: Some(m),
+                result,
+                scores: t.scores.get(&m.id),
+                cricket: t.cricket.get(&m.id),
+                log: t.match_log.get(&m.id),
+            },
+        );
+    }
+    states
+}
+
+/// Bump the version of `after`, a changed copy of `before`, and of each match that differs
+/// between them. Versions of matches no longer in the tournament are dropped.
+pub(crate) fn bump_versions(before: &Tournament, after: &mut Tournament) {
+    let (changed, present): (Vec<MatchId>, HashSet<MatchId>) = {
+        let old = match_states(before);
+        let new = match_states(after);
+        let changed = new
+            .iter()
+            .filter(|(id, state)| old.get(id) != Some(state))
+            .map(|(&id, _)| id)
+            .collect();
+        (changed, new.into_keys().collect())
+    };
+    after.match_versions.retain(|id, _| present.contains(id));
+    for id in changed {
+        *after.match_versions.entry(id).or_insert(0) += 1;
+    }
+    after.version = before.version + 1;
+}
@@ -0,0 +1,254 @@
+//! A player's scored visits across tournaments, and how their scoring is spread.
+//!
+//! Every visit scored live records the player who threw it (2v2 sides aren't split between
+//! partners, so their visits belong to no one). Like the rest of a player's record, visits are
+//! read from the stored tournaments each time and players are matched by name
+//! (case-insensitive).
+
+use crate::models::{MatchId, PlayerId, Tournament, TournamentId};
+use crate::scoring::{Visit, VisitOutcome};
+use serde::{Deserialize, Serialize};
+use std::cmp::Reverse;
+use std::collections::HashSet;
+
+/// Visits one page returns unless the query says otherwise.
+pub const DEFAULT_VISIT_LIMIT: usize = 100;
+
+/// Most visits one page returns.
+pub const MAX_VISIT_LIMIT: usize = 500;
+
+/// Score bands of the distribution, inclusive: 0–39 up to a maximum of 180.
+pub const SCORE_BANDS: [(u32, u32); 6] = [
+    (0, 39),
+    (40, 59),
+    (60, 99),
+    (100, 139),
+    (140, 179),
+    (180, 180),
+];
+
+/// Visits in a leg that make up its first nine darts.
+const FIRST_NINE_VISITS: usize = 3;
+
+/// Which of a player's visits to list; fields left out match everything.
+#[derive(Clone, Debug, Default, Deserialize)]
+pub struct VisitQuery {
+    pub tournament_id: Option<TournamentId>,
+    /// Page size, [`DEFAULT_VISIT_LIMIT`] by default and at most [`MAX_VISIT_LIMIT`].
+    pub limit: Option<usize>,
+    pub offset: Option<usize>,
+}
+
+/// One visit a player threw.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct PlayerVisit {
+    pub tournament_id: TournamentId,
+    pub match_id: MatchId,
+    /// Leg of the match, from 1.
+    pub leg: u32,
+    /// The player's visit in that leg, from 1.
+    pub visit: u32,
+    /// Points scored (0 for a bust).
+    pub score: u32,
+    pub darts: u32,
+    pub outcome: VisitOutcome,
+    /// The player's score left after the visit.
+    pub remaining: u32,
+}
+
+/// One page of a player's visits.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct VisitPage {
+    /// Visits matching the query, on every page.
+    pub total: usize,
+    pub offset: usize,
+    pub limit: usize,
+    pub visits: Vec<PlayerVisit>,
+}
+
+/// Visits scored within one band.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct ScoreBand {
+    pub from: u32,
+    pub to: u32,
+    pub count: u32,
+}
+
+/// Points per three darts over the first three visits of one leg (fewer if it was won
+/// sooner).
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct LegFirstNine {
+    pub tournament_id: TournamentId,
+    pub match_id: MatchId,
+    pub leg: u32,
+    pub darts: u32,
+    pub average: f64,
+}
+
+/// How a player's visits are spread over the [`SCORE_BANDS`], and their first-nine average.
+#[derive(Clone, Debug, PartialEq, Serialize)]
+pub struct VisitDistribution {
+    pub player: String,
+    pub visits: u32,
+    pub bands: Vec<ScoreBand>,
+    /// Over every leg's first nine darts together (None before any visit).
+    pub first_nine_average: Option<f64>,
+    /// Each leg, newest first.
+    pub legs: Vec<LegFirstNine>,
+}
+
+/// The page of visits by the player named `name` that `query` asks for, newest first: the
+/// newest tournament's latest match first, its last leg first, and the last visit of a leg
+/// first.
+pub fn player_visits<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    name: &str,
+    query: &VisitQuery,
+) -> VisitPage {
+    let all: Vec<PlayerVisit> = player_legs(tournaments, name, query.tournament_id)
+        .into_iter()
+        .flat_map(|leg| {
+            leg.visits
+                .iter()
+                .enumerate()
+                .rev()
+                .map(|(i, v)| PlayerVisit {
+                    tournament_id: leg.tournament_id,
+                    match_id: leg.match_id,
+                    leg: leg.number,
+                    visit: i as u32 + 1,
+                    score: v.score,
+                    darts: v.darts,
+                    outcome: v.outcome,
+                    remaining: v.remaining,
+                })
+                .collect::<Vec<_>>()
+        })
+        .collect();
+    let limit = query
+        .limit
+        .unwrap_or(DEFAULT_VISIT_LIMIT)
+        .min(MAX_VISIT_LIMIT);
+    let offset = query.offset.unwrap_or(0);
+    VisitPage {
+        total: all.len(),
+        offset,
+        limit,
+        visits: all.into_iter().skip(offset).take(limit).collect(),
+    }
+}
+
+/// Score bands and first-nine averages of the player named `name`, over every tournament or
+/// just `tournament_id`.
+pub fn visit_distribution<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    name: &str,
+    tournament_id: Option<TournamentId>,
+) -> VisitDistribution {
+    let mut bands: Vec<ScoreBand> = SCORE_BANDS
+        .iter()
+        .map(|&(from, to)| ScoreBand { from, to, count: 0 })
+        .collect();
+    let mut visits = 0;
+    let (mut points, mut darts) = (0, 0);
+    let mut legs = Vec::new();
+    for leg in player_legs(tournaments, name, tournament_id) {
+        for v in &leg.visits {
+            visits += 1;
+            if let Some(band) = bands
+                .iter_mut()
+                .find(|b| (b.from..=b.to).contains(&v.score))
+            {
+                band.count += 1;
+            }
+        }
+        let first_nine = &leg.visits[..leg.visits.len().min(FIRST_NINE_VISITS)];
+        let leg_points: u32 = first_nine.iter().map(|v| v.score).sum();
+        let leg_darts: u32 = first_nine.iter().map(|v| v.darts).sum();
+        points += leg_points;
+        darts += leg_darts;
+        legs.push(LegFirstNine {
+            tournament_id: leg.tournament_id,
+            match_id: leg.match_id,
+            leg: leg.number,
+            darts: leg_darts,
+            average: per_three_darts(leg_points, leg_darts),
+        });
+    }
+    VisitDistribution {
+        player: name.trim().to_string(),
+        visits,
+        bands,
+        first_nine_average: (darts > 0).then(|| per_three_darts(points, darts)),
+        legs,
+    }
+}
+
+fn per_three_darts(points: u32, darts: u32) -> f64 {
+    if darts == 0 {
+        return 0.0;
+    }
+    f64::from(points) * 3.0 / f64::from(darts)
+}
+
+/// One leg a player threw in, with their visits in the order thrown.
+struct PlayerLeg<'a> {
+    tournament_id: TournamentId,
+    match_id: MatchId,
+    number: u32,
+    visits: Vec<&'a Visit>,
+}
+
+/// Every leg the player named `name` threw in, newest first: tournaments by creation, matches
+/// by when they started (matches never started last, in id order), and legs last first.
+fn player_legs<'a>(
+    tournaments: impl IntoIterator<Item = &'a Tournament>,
+    name: &str,
+    tournament_id: Option<TournamentId>,
+) -> Vec<PlayerLeg<'a>> {
+    let name = name.trim();
+    let mut tournaments: Vec<&Tournament> = tournaments
+        .into_iter()
+        .filter(|t| tournament_id.is_none_or(|id| id == t.id))
+        .collect();
+    tournaments.sort_by_key(|t| (Reverse(t.created_at), t.id));
+
+    let mut legs = Vec::new();
+    for t in tournaments {
+        let ids: HashSet<PlayerId> = t
+            .all_players()
+            .into_iter()
+            .filter(|p| p.name.eq_ignore_ascii_case(name))
+            .map(|p| p.id)
+            .collect();
+        if ids.is_empty() {
+            continue;
+        }
+        let started = |id: &MatchId| {
+            t.bracket
+                .as_ref()
+                .and_then(|b| b.get(*id))
+                .and_then(|m| m.started_at)
+        };
+        let mut matches: Vec<_> = t.scores.iter().collect();
+        matches.sort_by_key(|(id, _)| (started(id).is_none(), Reverse(started(id)), **id));
+        for (&match_id, scored) in matches {
+            for (i, leg) in scored.legs.iter().enumerate().rev() {
+                let visits: Vec<&Visit> = leg
+                    .visits
+                    .iter()
+                    .filter(|v| v.player.is_some_and(|p| ids.contains(&p)))
+                    .collect();
+                if !visits.is_empty() {
+                    legs.push(PlayerLeg {
+                        tournament_id: t.id,
+                        match_id,
+                        number: i as u32 + 1,
+                        visits,
+                    });
+                }
+            }
+        }
+    }
+    legs
+}
@@ -0,0 +1,841 @@
+//! Webhooks: a tournament's events POSTed to URLs registered for them, so a club's chat bot
+//! can announce pairings and winners as they happen.
+//!
+//! [`events`] compares a tournament before and after a change and says what happened:
+//! a round whose pairings are all known (`round_started`), a match decided
+//! (`match_completed`), the tournament won (`tournament_finished`). The [`Dispatcher`] is told
+//! of every change the registry makes (see [`ChangeListener`]) and queues a delivery for each
+//! webhook subscribed to each event; a worker thread of its own sends them, so recording a
+//! result never waits on somebody else's server.
+//!
+//! Each delivery is the [`Event`] as JSON, signed with the webhook's secret: the
+//! `X-Dart-Signature` header is `sha256=` and the hex HMAC-SHA256 of the body. A failed send is
+//! tried again after 1 s and then 2 s; once [`DISABLE_AFTER_FAILURES`] deliveries in a row
+//! have failed every attempt the webhook is disabled until it is enabled again by hand.
+
+use crate::bracket_view::PlayerView;
+use crate::export::bracket_round_label;
+use crate::logic::final_placements;
+use crate::models::{
+    BracketMatch, GameMatch, LegScore, MatchId, PlayerId, RoundType, Team, Tournament,
+    TournamentId, TournamentState,
+};
+use crate::registry::ChangeListener;
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use serde_json::{json, Value};
+use sha2::{Digest, Sha256};
+use std::collections::{BTreeMap, HashMap, HashSet};
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::mpsc::{self, Receiver, RecvTimeoutError, Sender};
+use std::sync::{Arc, Condvar, Mutex};
+use std::thread;
+use std::time::{Duration, Instant};
+use uuid::Uuid;
+
+/// Most webhooks one tournament can have.
+pub const MAX_WEBHOOKS: usize = 10;
+/// Tries at each delivery before it counts as failed.
+pub const DELIVERY_ATTEMPTS: u32 = 3;
+/// Wait before the first retry; each later one waits twice as long as the last.
+pub const DEFAULT_BACKOFF: Duration = Duration::from_secs(1);
+/// Failed deliveries in a row after which a webhook is disabled.
+pub const DISABLE_AFTER_FAILURES: u32 = 5;
+/// How long one attempt may take before it counts as failed.
+pub const DELIVERY_TIMEOUT: Duration = Duration::from_secs(5);
+
+/// What a webhook can be told about.
+#[derive(Clone, Copy, Debug, Eq, Hash, Ord, PartialEq, PartialOrd, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum EventKind {
+    /// Every match of a round is paired: its pairings can be announced.
+    RoundStarted,
+    /// A match was decided (byes aren't).
+    MatchCompleted,
+    /// The tournament is complete, with its placements.
+    TournamentFinished,
+}
+
+impl EventKind {
+    pub const ALL: [EventKind; 3] = [
+        EventKind::RoundStarted,
+        EventKind::MatchCompleted,
+        EventKind::TournamentFinished,
+    ];
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            EventKind::RoundStarted => "round_started",
+            EventKind::MatchCompleted => "match_completed",
+            EventKind::TournamentFinished => "tournament_finished",
+        }
+    }
+}
+
+/// Something that happened in a tournament: the body of every delivery of it.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct Event {
+    /// The same for every webhook and every attempt, so a receiver can drop repeats.
+    pub id: Uuid,
+    pub event: EventKind,
+    pub tournament_id: TournamentId,
+    pub tournament_name: String,
+    pub occurred_at: DateTime<Utc>,
+    /// `round_started`: `round` and its `pairings`. `match_completed`: `match_id`, `round`,
+    /// both teams, `winner` and `score`. `tournament_finished`: `placements`, best first.
+    pub data: Value,
+}
+
+impl Event {
+    fn new(t: &Tournament, event: EventKind, data: Value) -> Self {
+        Self {
+            id: Uuid::new_v4(),
+            event,
+            tournament_id: t.id,
+            tournament_name: t.name.clone(),
+            occurred_at: Utc::now(),
+            data,
+        }
+    }
+}
+
+fn players(t: &Tournament, ids: &[PlayerId]) -> Vec<PlayerView> {
+    ids.iter()
+        .map(|&id| PlayerView {
+            player_id: id,
+            name: t
+                .find_player(id)
+                .map_or_else(|| id.to_string(), |p| p.name.clone()),
+        })
+        .collect()
+}
+
+fn pairing(t: &Tournament, match_id: MatchId, team_1: &[PlayerId], team_2: &[PlayerId]) -> Value {
+    json!({
+        "match_id": match_id,
+        "team_1": players(t, team_1),
+        "team_2": players(t, team_2),
+    })
+}
+
+fn completed(
+    t: &Tournament,
+    match_id: MatchId,
+    round: String,
+    (team_1, team_2): (&[PlayerId], &[PlayerId]),
+    winner: Team,
+    score: Option<LegScore>,
+) -> Event {
+    let mut data = pairing(t, match_id, team_1, team_2);
+    data["round"] = json!(round);
+    data["winner"] = json!(winner);
+    data["score"] = json!(score);
+    Event::new(t, EventKind::MatchCompleted, data)
+}
+
+/// A round of bracket or group matches: its group (group stage only), section and number.
+type RoundKey = (Option<String>, u8, u32);
+
+fn bracket_rounds(t: &Tournament) -> BTreeMap<RoundKey, Vec<&BracketMatch>> {
+    let mut rounds: BTreeMap<RoundKey, Vec<&BracketMatch>> = BTreeMap::new();
+    if let Some(stage) = &t.group_stage {
+        for m in &stage.matches {
+            let group = m
+                .team_1
+                .and_then(|p| stage.group_of(p))
+                .map(|g| g.name.clone());
+            rounds.entry((group, 0, m.round)).or_default().push(m);
+        }
+    }
+    for m in t.bracket.iter().flat_map(|b| &b.matches) {
+        rounds
+            .entry((None, m.section as u8, m.round))
+            .or_default()
+            .push(m);
+    }
+    rounds
+}
+
+/// Rounds whose matches are all paired, after every earlier round of the same block was
+/// decided. A round of byes only is never started.
+fn started_rounds(t: &Tournament) -> HashSet<RoundKey> {
+    let rounds = bracket_rounds(t);
+    let mut started = HashSet::new();
+    for ((group, section, round), matches) in &rounds {
+        let mut played = matches.iter().filter(|m| !m.bye).peekable();
+        let paired =
+            played.peek().is_some() && played.all(|m| m.team_1.is_some() && m.team_2.is_some());
+        let earlier_decided = rounds
+            .range((group.clone(), *section, 0)..(group.clone(), *section, *round))
+            .all(|(_, earlier)| earlier.iter().all(|m| m.winner.is_some()));
+        if paired && earlier_decided {
+            started.insert((group.clone(), *section, *round));
+        }
+    }
+    started
+}
+
+/// Matches of the rounds played as lists of games (group play, semi-finals and finals), with
+/// their results.
+fn games(t: &Tournament) -> Vec<(&GameMatch, Option<Team>)> {
+    let semi_final_results = t.bracket_semi_final_results.as_ref();
+    let mut seen = HashSet::new();
+    t.matches
+        .iter()
+        .chain(t.bracket_semi_final_matches.iter().flatten())
+        .chain(&t.bracket_finals_match)
+        .filter(|m| seen.insert(m.id))
+        .map(|m| {
+            let result = t
+                .match_results
+                .get(&m.id)
+                .or_else(|| t.final_match_results.get(&m.id))
+                .or_else(|| semi_final_results.and_then(|r| r.get(&m.id)))
+                .copied()
+                .or(m.winner)
+                .or_else(|| {
+                    t.bracket_finals_match
+                        .as_ref()
+                        .filter(|f| f.id == m.id)
+                        .and(t.bracket_finals_result)
+                });
+            (m, result)
+        })
+        .collect()
+}
+
+fn game_round_label(round: RoundType) -> &'static str {
+    match round {
+        RoundType::GroupPlay => "Group play",
+        RoundType::SemiFinals => "Semi-finals",
+        RoundType::Finals => "Final",
+    }
+}
+
+/// What happened between `before` and `after`, a changed copy of it: rounds started first,
+/// then matches completed, then the tournament finished.
+pub fn events(before: &Tournament, after: &Tournament) -> Vec<Event> {
+    let mut events = Vec::new();
+
+    let was_started = started_rounds(before);
+    let rounds = bracket_rounds(after);
+    let mut now_started: Vec<_> = started_rounds(after)
+        .into_iter()
+        .filter(|key| !was_started.contains(key))
+        .collect();
+    now_started.sort();
+    for key in now_started {
+        let matches = &rounds[&key];
+        let pairings: Vec<Value> = matches
+            .iter()
+            .filter(|m| !m.bye)
+            .map(|m| {
+                let mut p = pairing(after, m.id, &[m.team_1.unwrap()], &[m.team_2.unwrap()]);
+                p["board"] = json!(m.board);
+                p
+            })
+            .collect();
+        let round = bracket_round_label(after, matches[0]);
+        let data = json!({ "round": round, "pairings": pairings });
+        events.push(Event::new(after, EventKind::RoundStarted, data));
+    }
+
+    let old_games: HashMap<MatchId, Option<Team>> =
+        games(before).into_iter().map(|(m, r)| (m.id, r)).collect();
+    let new_games = games(after);
+    let mut new_rounds: BTreeMap<&'static str, Vec<Value>> = BTreeMap::new();
+    for (m, _) in new_games
+        .iter()
+        .filter(|(m, _)| !old_games.contains_key(&m.id))
+    {
+        new_rounds
+            .entry(game_round_label(m.round))
+            .or_default()
+            .push(pairing(after, m.id, &m.team_1, &m.team_2));
+    }
+    for (round, pairings) in new_rounds {
+        let data = json!({ "round": round, "pairings": pairings });
+        events.push(Event::new(after, EventKind::RoundStarted, data));
+    }
+
+    let old_bracket: HashMap<MatchId, &BracketMatch> = bracket_rounds(before)
+        .into_values()
+        .flatten()
+        .map(|m| (m.id, m))
+        .collect();
+    for m in rounds.values().flatten() {
+        let (Some(winner), Some(team_1), Some(team_2)) = (m.winner, m.team_1, m.team_2) else {
+            continue;
+        };
+        if m.bye || old_bracket.get(&m.id).is_some_and(|o| o.winner.is_some()) {
+            continue;
+        }
+        let round = bracket_round_label(after, m);
+        let teams = (&[team_1][..], &[team_2][..]);
+        events.push(completed(after, m.id, round, teams, winner, m.score));
+    }
+    for (m, result) in &new_games {
+        let Some(winner) = *result else { continue };
+        if old_games.get(&m.id).is_some_and(|r| r.is_some()) {
+            continue;
+        }
+        let round = game_round_label(m.round).to_string();
+        let teams = (&m.team_1[..], &m.team_2[..]);
+        events.push(completed(after, m.id, round, teams, winner, None));
+    }
+
+    if after.state == TournamentState::Completed && before.state != TournamentState::Completed {
+        let placements: Vec<Value> = final_placements(after)
+            .unwrap_or_default()
+            .into_iter()
+            .map(|p| {
+                let player = players(after, &[p.player]).remove(0);
+                json!({ "place": p.place, "player_id": player.player_id, "name": player.name })
+            })
+            .collect();
+        let data = json!({ "placements": placements });
+        events.push(Event::new(after, EventKind::TournamentFinished, data));
+    }
+    events
+}
+
+/// The `X-Dart-Signature` of `body` under `secret`: `sha256=` and the hex HMAC-SHA256.
+pub fn sign(secret: &str, body: &[u8]) -> String {
+    const BLOCK: usize = 64;
+    let mut key = [0u8; BLOCK];
+    if secret.len() > BLOCK {
+        key[..32].copy_from_slice(&Sha256::digest(secret.as_bytes()));
+    } else {
+        key[..secret.len()].copy_from_slice(secret.as_bytes());
+    }
+    let pad = |byte: u8| key.map(|k| k ^ byte);
+    let inner = Sha256::new()
+        .chain_update(pad(0x36))
+        .chain_update(body)
+        .finalize();
+    let outer = Sha256::new()
+        .chain_update(pad(0x5c))
+        .chain_update(inner)
+        .finalize();
+    format!("sha256={}", hex::encode(outer))
+}
+
+/// Whether a webhook is sent its events.
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum WebhookStatus {
+    #[default]
+    Active,
+    /// Stopped after [`DISABLE_AFTER_FAILURES`] failed deliveries in a row.
+    Disabled,
+}
+
+/// How the last delivery to a webhook went, after all its attempts.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct DeliveryRecord {
+    pub event_id: Uuid,
+    pub event: EventKind,
+    pub at: DateTime<Utc>,
+    pub attempts: u32,
+    pub delivered: bool,
+    /// Status of the last response, if there was one.
+    pub status: Option<u16>,
+    /// Why the last attempt failed.
+    pub error: Option<String>,
+}
+
+/// A URL a tournament's events are sent to.
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct Webhook {
+    pub id: Uuid,
+    pub tournament_id: TournamentId,
+    pub url: String,
+    /// The events it is sent, in order.
+    pub events: Vec<EventKind>,
+    /// Key of the deliveries' signatures. Only shown when the webhook is registered.
+    #[serde(default, skip_serializing_if = "String::is_empty")]
+    pub secret: String,
+    pub created_at: DateTime<Utc>,
+    #[serde(default)]
+    pub status: WebhookStatus,
+    /// Deliveries in a row that failed every attempt.
+    #[serde(default)]
+    pub consecutive_failures: u32,
+    #[serde(default)]
+    pub last_delivery: Option<DeliveryRecord>,
+}
+
+impl Webhook {
+    /// The webhook as listed: everything but its secret.
+    pub fn without_secret(self) -> Self {
+        Self {
+            secret: String::new(),
+            ..self
+        }
+    }
+}
+
+/// Why a webhook could not be registered or found.
+#[derive(Clone, Debug, PartialEq)]
+pub enum WebhookError {
+    /// Not an absolute http or https URL.
+    InvalidUrl,
+    /// An empty event filter.
+    NoEvents,
+    /// The tournament already has [`MAX_WEBHOOKS`].
+    TooMany,
+    NotFound(Uuid),
+    /// The webhooks could not be written to their file.
+    Storage(String),
+}
+
+impl std::fmt::Display for WebhookError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            WebhookError::InvalidUrl => write!(f, "Webhook URL must be an http or https URL"),
+            WebhookError::NoEvents => write!(f, "Choose at least one event"),
+            WebhookError::TooMany => {
+                write!(f, "A tournament can have at most {} webhooks", MAX_WEBHOOKS)
+            }
+            WebhookError::NotFound(_) => write!(f, "No webhook"),
+            WebhookError::Storage(e) => write!(f, "Could not save webhooks: {}", e),
+        }
+    }
+}
+
+fn valid_url(url: &str) -> bool {
+    reqwest::Url::parse(url)
+        .is_ok_and(|u| matches!(u.scheme(), "http" | "https") && u.host_str().is_some())
+}
+
+/// A new webhook secret: 32 random bytes as hex.
+fn new_secret() -> String {
+    hex::encode(rand::random::<[u8; 32]>())
+}
+
+/// Webhooks by tournament, each tournament's also written to `<dir>/<tournament id>.json` when
+/// a directory is set. Not part of backups: they hold secrets.
+pub struct WebhookStore {
+    dir: Option<PathBuf>,
+    webhooks: Mutex<BTreeMap<TournamentId, Vec<Webhook>>>,
+}
+
+impl WebhookStore {
+    /// Webhooks kept in memory only (lost on restart).
+    pub fn in_memory() -> Self {
+        Self {
+            dir: None,
+            webhooks: Mutex::new(BTreeMap::new()),
+        }
+    }
+
+    /// Webhooks kept as JSON files in `dir` (created if needed), with the ones there loaded.
+    pub fn open(dir: impl Into<PathBuf>) -> io::Result<Self> {
+        let dir = dir.into();
+        fs::create_dir_all(&dir)?;
+        let mut webhooks = BTreeMap::new();
+        for entry in fs::read_dir(&dir)? {
+            let path = entry?.path();
+            if path.extension().and_then(|e| e.to_str()) != Some("json") {
+                continue;
+            }
+            let list: Vec<Webhook> = read_webhooks(&path)?;
+            if let Some(first) = list.first() {
+                webhooks.insert(first.tournament_id, list);
+            }
+        }
+        Ok(Self {
+            dir: Some(dir),
+            webhooks: Mutex::new(webhooks),
+        })
+    }
+
+    /// Run `f` on one tournament's webhooks and write them out; nothing changes if `f` fails
+    /// or the file can't be written.
+    fn change<T>(
+        &self,
+        tournament_id: TournamentId,
+        f: impl FnOnce(&mut Vec<Webhook>) -> Result<T, WebhookError>,
+    ) -> Result<T, WebhookError> {
+        let mut webhooks = self.webhooks.lock().unwrap_or_else(|e| e.into_inner());
+        let mut next = webhooks.get(&tournament_id).cloned().unwrap_or_default();
+        let out = f(&mut next)?;
+        self.save(tournament_id, &next)?;
+        if next.is_empty() {
+            webhooks.remove(&tournament_id);
+        } else {
+            webhooks.insert(tournament_id, next);
+        }
+        Ok(out)
+    }
+
+    fn save(&self, tournament_id: TournamentId, list: &[Webhook]) -> Result<(), WebhookError> {
+        match &self.dir {
+            Some(dir) => write_webhooks(dir, tournament_id, list)
+                .map_err(|e| WebhookError::Storage(e.to_string())),
+            None => Ok(()),
+        }
+    }
+
+    /// Register `url` for `events` of a tournament (every event when None), with a new secret.
+    /// Returns the webhook, secret included.
+    pub fn register(
+        &self,
+        tournament_id: TournamentId,
+        url: &str,
+        events: Option<&[EventKind]>,
+    ) -> Result<Webhook, WebhookError> {
+        let url = url.trim();
+        if !valid_url(url) {
+            return Err(WebhookError::InvalidUrl);
+        }
+        let mut events: Vec<EventKind> = events.unwrap_or(&EventKind::ALL).to_vec();
+        events.sort();
+        events.dedup();
+        if events.is_empty() {
+            return Err(WebhookError::NoEvents);
+        }
+        let webhook = Webhook {
+            id: Uuid::new_v4(),
+            tournament_id,
+            url: url.to_string(),
+            events,
+            secret: new_secret(),
+            created_at: Utc::now(),
+            status: WebhookStatus::Active,
+            consecutive_failures: 0,
+            last_delivery: None,
+        };
+        self.change(tournament_id, |list| {
+            if list.len() >= MAX_WEBHOOKS {
+                return Err(WebhookError::TooMany);
+            }
+            list.push(webhook.clone());
+            Ok(())
+        })?;
+        Ok(webhook)
+    }
+
+    /// A tournament's webhooks, oldest first, secrets included.
+    pub fn list(&self, tournament_id: TournamentId) -> Vec<Webhook> {
+        let webhooks = self.webhooks.lock().unwrap_or_else(|e| e.into_inner());
+        webhooks.get(&tournament_id).cloned().unwrap_or_default()
+    }
+
+    pub fn get(&self, tournament_id: TournamentId, id: Uuid) -> Result<Webhook, WebhookError> {
+        self.list(tournament_id)
+            .into_iter()
+            .find(|w| w.id == id)
+            .ok_or(WebhookError::NotFound(id))
+    }
+
+    pub fn remove(&self, tournament_id: TournamentId, id: Uuid) -> Result<(), WebhookError> {
+        self.change(tournament_id, |list| {
+            let before = list.len();
+            list.retain(|w| w.id != id);
+            if list.len() == before {
+                return Err(WebhookError::NotFound(id));
+            }
+            Ok(())
+        })
+    }
+
+    /// Make a webhook active again, its failure count cleared.
+    pub fn enable(&self, tournament_id: TournamentId, id: Uuid) -> Result<Webhook, WebhookError> {
+        self.change(tournament_id, |list| {
+            let webhook = list
+                .iter_mut()
+                .find(|w| w.id == id)
+                .ok_or(WebhookError::NotFound(id))?;
+            webhook.status = WebhookStatus::Active;
+            webhook.consecutive_failures = 0;
+            Ok(webhook.clone())
+        })
+    }
+
+    /// Drop every webhook of a tournament that was removed.
+    pub fn remove_tournament(&self, tournament_id: TournamentId) -> Result<(), WebhookError> {
+        self.change(tournament_id, |list| {
+            list.clear();
+            Ok(())
+        })
+    }
+
+    /// The active webhooks of a tournament subscribed to `event`.
+    pub fn subscribed(&self, tournament_id: TournamentId, event: EventKind) -> Vec<Webhook> {
+        let mut list = self.list(tournament_id);
+        list.retain(|w| w.status == WebhookStatus::Active && w.events.contains(&event));
+        list
+    }
+
+    /// Note how a delivery went, disabling the webhook once [`DISABLE_AFTER_FAILURES`] in a
+    /// row have failed. A webhook removed meanwhile is left removed.
+    ///
+    /// Unlike other changes this one is kept in memory even when the file can't be written
+    /// (the error says so), so a dead endpoint is still disabled on a full or read-only disk.
+    pub fn record(
+        &self,
+        tournament_id: TournamentId,
+        id: Uuid,
+        delivery: DeliveryRecord,
+    ) -> Result<(), WebhookError> {
+        let mut webhooks = self.webhooks.lock().unwrap_or_else(|e| e.into_inner());
+        let Some(list) = webhooks.get_mut(&tournament_id) else {
+            return Ok(());
+        };
+        let Some(webhook) = list.iter_mut().find(|w| w.id == id) else {
+            return Ok(());
+        };
+        if delivery.delivered {
+            webhook.consecutive_failures = 0;
+        } else {
+            webhook.consecutive_failures += 1;
+            if webhook.consecutive_failures >= DISABLE_AFTER_FAILURES {
+                webhook.status = WebhookStatus::Disabled;
+            }
+        }
+        webhook.last_delivery = Some(delivery);
+        self.save(tournament_id, list)
+    }
+}
+
+fn read_webhooks(path: &Path) -> io::Result<Vec<Webhook>> {
+    let json = fs::read(path)?;
+    serde_json::from_slice(&json).map_err(|e| {
+        io::Error::new(
+            io::ErrorKind::InvalidData,
+            format!("{}: {}", path.display(), e),
+        )
+    })
+}
+
+fn write_webhooks(dir: &Path, tournament_id: TournamentId, webhooks: &[Webhook]) -> io::Result<()> {
+    let path = dir.join(format!("{}.json", tournament_id));
+    if webhooks.is_empty() {
+        return match fs::remove_file(&path) {
+            Err(e) if e.kind() == io::ErrorKind::NotFound => Ok(()),
+            other => other,
+        };
+    }
+    // Written with their secrets: only the API's listing leaves them out.
+    let json = serde_json::to_vec(webhooks)?;
+    let tmp = path.with_extension("json.tmp");
+    fs::write(&tmp, json)?;
+    fs::rename(&tmp, &path)
+}
+
+/// One event on its way to one webhook.
+struct Delivery {
+    tournament_id: TournamentId,
+    webhook_id: Uuid,
+    event_id: Uuid,
+    event: EventKind,
+    body: Arc<Vec<u8>>,
+    attempt: u32,
+}
+
+struct Shared {
+    webhooks: Arc<WebhookStore>,
+    queue: Mutex<Sender<Delivery>>,
+    /// Deliveries queued or waiting to be tried again.
+    pending: Mutex<usize>,
+    idle: Condvar,
+}
+
+impl Shared {
+    fn finish(&self) {
+        let mut pending = self.pending.lock().unwrap_or_else(|e| e.into_inner());
+        *pending = pending.saturating_sub(1);
+        if *pending == 0 {
+            self.idle.notify_all();
+        }
+    }
+}
+
+/// Sends webhook deliveries from a worker thread of its own, trying each up to
+/// [`DELIVERY_ATTEMPTS`] times. Cheap to clone; every clone feeds the same worker.
+#[derive(Clone)]
+pub struct Dispatcher {
+    shared: Arc<Shared>,
+}
+
+impl Dispatcher {
+    /// Start the worker, with retries [`DEFAULT_BACKOFF`] apart and doubling.
+    pub fn start(webhooks: Arc<WebhookStore>) -> Self {
+        Self::with_backoff(webhooks, DEFAULT_BACKOFF)
+    }
+
+    /// Start the worker with the first retry `backoff` after a failed attempt.
+    pub fn with_backoff(webhooks: Arc<WebhookStore>, backoff: Duration) -> Self {
+        let (tx, rx) = mpsc::channel();
+        let shared = Arc::new(Shared {
+            webhooks,
+            queue: Mutex::new(tx),
+            pending: Mutex::new(0),
+            idle: Condvar::new(),
+        });
+        let worker = Arc::clone(&shared);
+        thread::Builder::new()
+            .name("webhooks".to_string())
+            .spawn(move || deliver_all(&worker, rx, backoff))
+            .expect("could not start the webhook worker");
+        Self { shared }
+    }
+
+    /// The store deliveries are looked up in and recorded to.
+    pub fn webhooks(&self) -> &WebhookStore {
+        &self.shared.webhooks
+    }
+
+    /// Queue `event` for every active webhook subscribed to it.
+    pub fn dispatch(&self, event: &Event) {
+        let subscribed = self
+            .shared
+            .webhooks
+            .subscribed(event.tournament_id, event.event);
+        if subscribed.is_empty() {
+            return;
+        }
+        let Ok(body) = serde_json::to_vec(event) else {
+            return;
+        };
+        let body = Arc::new(body);
+        let queue = self.shared.queue.lock().unwrap_or_else(|e| e.into_inner());
+        for webhook in subscribed {
+            *self
+                .shared
+                .pending
+                .lock()
+                .unwrap_or_else(|e| e.into_inner()) += 1;
+            let delivery = Delivery {
+                tournament_id: event.tournament_id,
+                webhook_id: webhook.id,
+                event_id: event.id,
+                event: event.event,
+                body: Arc::clone(&body),
+                attempt: 0,
+            };
+            if queue.send(delivery).is_err() {
+                self.shared.finish();
+            }
+        }
+    }
+
+    /// Wait until nothing is queued or waiting to be tried again, for at most `timeout`.
+    /// Returns whether it got there.
+    pub fn wait_idle(&self, timeout: Duration) -> bool {
+        let pending = self
+            .shared
+            .pending
+            .lock()
+            .unwrap_or_else(|e| e.into_inner());
+        let (pending, _) = self
+            .shared
+            .idle
+            .wait_timeout_while(pending, timeout, |p| *p > 0)
+            .unwrap_or_else(|e| e.into_inner());
+        *pending == 0
+    }
+}
+
+impl ChangeListener for Dispatcher {
+    fn changed(&self, before: &Tournament, after: &Tournament) {
+        for event in events(before, after) {
+            self.dispatch(&event);
+        }
+    }
+}
+
+/// The worker: sends each delivery as it comes and each retry when it is due, until every
+/// [`Dispatcher`] is dropped.
+fn deliver_all(shared: &Shared, rx: Receiver<Delivery>, backoff: Duration) {
+    let client = reqwest::blocking::Client::builder()
+        .timeout(DELIVERY_TIMEOUT)
+        .build()
+        .expect("could not build the webhook client");
+    let mut retries: Vec<(Instant, Delivery)> = Vec::new();
+    loop {
+        let next_due = retries.iter().map(|(at, _)| *at).min();
+        let received = match next_due {
+            Some(at) => rx.recv_timeout(at.saturating_duration_since(Instant::now())),
+            None => rx.recv().map_err(|_| RecvTimeoutError::Disconnected),
+        };
+        let delivery = match received {
+            Ok(delivery) => delivery,
+            Err(RecvTimeoutError::Timeout) => {
+                let now = Instant::now();
+                let Some(i) = retries.iter().position(|(at, _)| *at <= now) else {
+                    continue;
+                };
+                retries.swap_remove(i).1
+            }
+            Err(RecvTimeoutError::Disconnected) => return,
+        };
+        if let Some(retry) = attempt(shared, &client, delivery) {
+            let wait = backoff * 2u32.pow(retry.attempt - 1);
+            retries.push((Instant::now() + wait, retry));
+        }
+    }
+}
+
+/// Try one delivery, returning it if it should be tried again. A webhook removed or disabled
+/// since the delivery was queued isn't sent it.
+fn attempt(
+    shared: &Shared,
+    client: &reqwest::blocking::Client,
+    mut d: Delivery,
+) -> Option<Delivery> {
+    let webhook = shared
+        .webhooks
+        .get(d.tournament_id, d.webhook_id)
+        .ok()
+        .filter(|w| w.status == WebhookStatus::Active);
+    let Some(webhook) = webhook else {
+        shared.finish();
+        return None;
+    };
+    d.attempt += 1;
+    let sent = client
+        .post(&webhook.url)
+        .header("Content-Type", "application/json")
+        .header("X-Dart-Event", d.event.as_str())
+        .header("X-Dart-Delivery", d.event_id.to_string())
+        .header("X-Dart-Signature", sign(&webhook.secret, &d.body))
+        .body(d.body.to_vec())
+        .send();
+    let (status, error) = match sent {
+        Ok(response) if response.status().is_success() => (Some(response.status().as_u16()), None),
+        Ok(response) => (
+            Some(response.status().as_u16()),
+            Some(format!("responded {}", response.status())),
+        ),
+        Err(e) => (None, Some(e.to_string())),
+    };
+    if error.is_some() && d.attempt < DELIVERY_ATTEMPTS {
+        return Some(d);
+    }
+    let record = DeliveryRecord {
+        event_id: d.event_id,
+        event: d.event,
+        at: Utc::now(),
+        attempts: d.attempt,
+        delivered: error.is_none(),
+        status,
+        error,
+    };
+    // A record that can't be saved is still kept in memory until restart.
+    if let Err(e) = shared
+        .webhooks
+        .record(d.tournament_id, d.webhook_id, record)
+    {
+        log::error!(
+            "Webhook {} delivery kept in memory only: {}",
+            d.webhook_id,
+            e
+        );
+    }
+    shared.finish();
+    None
+}
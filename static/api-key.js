@@ -0,0 +1,39 @@
+/**
+ * API key for write requests. When the server has keys configured (ADMIN_API_KEYS /
+ * API_KEYS_FILE), every POST/PUT/DELETE needs `Authorization: Bearer <key>`. The key is kept in
+ * localStorage; on a 401 for a write the user is asked for it once and the request is retried.
+ */
+(function () {
+  var STORAGE_KEY = 'dart_api_key';
+  var WRITES = ['POST', 'PUT', 'PATCH', 'DELETE'];
+
+  var origFetch = window.fetch;
+
+  function withKey(init, key) {
+    var headers =
+      init.headers != null ? new Headers(init.headers) : new Headers();
+    if (key) headers.set('Authorization', 'Bearer ' + key);
+    return Object.assign({}, init, { headers: headers });
+  }
+
+  window.fetch = async function (input, init) {
+    init = init || {};
+    var method = (init.method || 'GET').toUpperCase();
+    if (WRITES.indexOf(method) === -1) return origFetch(input, init);
+
+    var res = await origFetch(input, withKey(init, localStorage.getItem(STORAGE_KEY)));
+    if (res.status !== 401) return res;
+    var err = await res.clone().json().catch(function () {
+      return {};
+    });
+    if (!err.error || err.error.code !== 'unauthorized' || /password/i.test(err.error.message)) {
+      return res;
+    }
+    var key = window.prompt('API key required for changes:');
+    if (!key) return res;
+    localStorage.setItem(STORAGE_KEY, key.trim());
+    res = await origFetch(input, withKey(init, key.trim()));
+    if (res.status === 401) localStorage.removeItem(STORAGE_KEY);
+    return res;
+  };
+})();
@@ -75,7 +75,7 @@
     var err = await r.json().catch(function () {
       return {};
     });
-    showErr(err.error || 'Wrong password');
+    showErr((err.error && err.error.message) || 'Wrong password');
   }
 
   function init() {
@@ -0,0 +1,107 @@
+//! Integration tests for the API error envelope: status, code, message and details per class.
+
+use dart_tournament_web::api_error::ApiError;
+use dart_tournament_web::import::ImportIssue;
+use dart_tournament_web::{RegistryError, TournamentError};
+use serde_json::json;
+use uuid::Uuid;
+
+fn from_tournament(e: TournamentError) -> ApiError {
+    RegistryError::Tournament(e).into()
+}
+
+#[test]
+fn not_found_names_the_missing_id() {
+    let id = Uuid::new_v4();
+    let e: ApiError = RegistryError::TournamentNotFound(id).into();
+    assert_eq!(e.status, 404);
+    assert_eq!(
+        e.envelope(),
+        json!({ "error": {
+            "code": "tournament_not_found",
+            "message": "No tournament",
+            "details": { "tournament_id": id.to_string() },
+        }})
+    );
+    let e = from_tournament(TournamentError::PlayerNotFound(id));
+    assert_eq!((e.status, e.code), (404, "player_not_found"));
+    assert_eq!(e.details["player_id"], json!(id.to_string()));
+}
+
+#[test]
+fn duplicate_player_is_a_conflict_on_the_name() {
+    let e = from_tournament(TournamentError::DuplicatePlayerName);
+    assert_eq!(e.status, 409);
+    assert_eq!(
+        e.envelope(),
+        json!({ "error": {
+            "code": "duplicate_player",
+            "message": "A player with this name already exists",
+            "details": { "field": "name" },
+        }})
+    );
+}
+
+#[test]
+fn validation_errors_are_400_with_the_field() {
+    let e = from_tournament(TournamentError::PlayerNameTooLong { max: 64 });
+    assert_eq!(e.status, 400);
+    assert_eq!(
+        e.envelope(),
+        json!({ "error": {
+            "code": "validation_failed",
+            "message": "Player name cannot be longer than 64 characters",
+            "details": { "field": "name", "max": 64 },
+        }})
+    );
+    let e = ApiError::invalid_request("missing field `name`", Some("name"));
+    assert_eq!((e.status, e.code), (400, "invalid_request"));
+    assert_eq!(e.details["field"], json!("name"));
+}
+
+#[test]
+fn state_errors_without_details_have_an_empty_object() {
+    let e = from_tournament(TournamentError::InvalidState);
+    assert_eq!(e.status, 400);
+    assert_eq!(
+        e.envelope(),
+        json!({ "error": {
+            "code": "invalid_state",
+            "message": "Invalid state for this action",
+            "details": {},
+        }})
+    );
+}
+
+#[test]
+fn unprocessable_requests_carry_their_report() {
+    let e = from_tournament(TournamentError::InvalidImport(vec![ImportIssue {
+        line: 3,
+        message: "Player name cannot be empty".into(),
+    }]));
+    assert_eq!(e.status, 422);
+    assert_eq!(
+        e.envelope(),
+        json!({ "error": {
+            "code": "invalid_import",
+            "message": "Import rejected: 1 invalid line(s)",
+            "details": { "issues": [{ "line": 3, "message": "Player name cannot be empty" }] },
+        }})
+    );
+    let e = from_tournament(TournamentError::NotEnoughPlayersToStart { required: 4 });
+    assert_eq!((e.status, e.code), (422, "not_enough_players"));
+}
+
+#[test]
+fn server_faults_do_not_leak_their_cause() {
+    let e: ApiError = RegistryError::Storage("disk full at /var/data".into()).into();
+    assert_eq!(
+        e.envelope(),
+        json!({ "error": {
+            "code": "internal_error",
+            "message": "Internal server error",
+            "details": {},
+        }})
+    );
+    assert_eq!(e.status, 500);
+}
@@ -0,0 +1,256 @@
+//! Integration tests for finishing tournaments: placements, freezing, and history queries.
+
+use dart_tournament_web::archive::{
+    list_tournaments, player_history, player_record, EventStats, TournamentFilter, TournamentStatus,
+};
+use dart_tournament_web::{
+    advance_to_knockout, final_placements, finish_tournament, record_bracket_result,
+    start_tournament, BracketMatch, BracketSection, LegScore, PlayerId, Team, Tournament,
+    TournamentError, TournamentFormat, TournamentMode, TournamentRegistry, TournamentState,
+};
+use std::collections::HashMap;
+use std::time::Duration;
+
+fn started(format: TournamentFormat, players: usize) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = format;
+    for i in 0..players {
+        t.add_player(format!("P{}", i + 1)).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    t
+}
+
+/// Play every match as it becomes ready, `pick` choosing the winner.
+fn play(t: &mut Tournament, pick: impl Fn(&Tournament, &BracketMatch) -> PlayerId) {
+    loop {
+        let next = t
+            .bracket
+            .as_ref()
+            .unwrap()
+            .matches
+            .iter()
+            .find(|m| m.is_ready() && !m.bye && m.winner.is_none())
+            .cloned();
+        let Some(m) = next else {
+            return;
+        };
+        let winner = pick(t, &m);
+        record_bracket_result(t, m.id, winner, None, false).unwrap();
+    }
+}
+
+fn better_seed(t: &Tournament, m: &BracketMatch) -> PlayerId {
+    let seed = |p: PlayerId| t.find_player(p).unwrap().seed;
+    let (a, b) = (m.team_1.unwrap(), m.team_2.unwrap());
+    if seed(a) < seed(b) {
+        a
+    } else {
+        b
+    }
+}
+
+/// Place of each player, by name.
+fn places(t: &Tournament) -> HashMap<String, u32> {
+    final_placements(t)
+        .unwrap()
+        .into_iter()
+        .map(|p| (t.find_player(p.player).unwrap().name.clone(), p.place))
+        .collect()
+}
+
+fn sorted_places(t: &Tournament) -> Vec<u32> {
+    let mut places: Vec<u32> = places(t).into_values().collect();
+    places.sort();
+    places
+}
+
+#[test]
+fn single_elimination_losers_in_the_same_round_share_a_place() {
+    let mut t = started(TournamentFormat::SingleElimination, 6);
+    assert_eq!(final_placements(&t), Err(TournamentError::InvalidState));
+    play(&mut t, better_seed);
+    let places = places(&t);
+    assert_eq!((places["P1"], places["P2"]), (1, 2));
+    assert_eq!((places["P3"], places["P4"]), (3, 3));
+    assert_eq!((places["P5"], places["P6"]), (5, 5));
+}
+
+#[test]
+fn double_elimination_third_is_the_losers_final_loser() {
+    let mut t = started(TournamentFormat::DoubleElimination, 4);
+    play(&mut t, better_seed);
+    let places = places(&t);
+    // P3 beats P4 in losers round 1, then loses the losers final to P2.
+    assert_eq!(places["P1"], 1);
+    assert_eq!(places["P2"], 2);
+    assert_eq!(places["P3"], 3);
+    assert_eq!(places["P4"], 4);
+
+    let mut t = started(TournamentFormat::DoubleElimination, 8);
+    play(&mut t, better_seed);
+    assert_eq!(sorted_places(&t), vec![1, 2, 3, 4, 5, 5, 7, 7]);
+}
+
+#[test]
+fn double_elimination_runner_up_after_a_bracket_reset() {
+    let mut t = started(TournamentFormat::DoubleElimination, 4);
+    // The losers champion takes the grand final; the winners champion wins the reset.
+    play(&mut t, |t, m| {
+        if m.section == BracketSection::GrandFinal && m.round == 1 {
+            m.team_2.unwrap()
+        } else {
+            better_seed(t, m)
+        }
+    });
+    let reset = t.bracket.as_ref().unwrap().final_match().unwrap();
+    assert!(reset.round == 2 && !reset.bye);
+    let places = places(&t);
+    assert_eq!((places["P1"], places["P2"], places["P3"]), (1, 2, 3));
+}
+
+#[test]
+fn groups_knockout_places_non_qualifiers_by_group_rank() {
+    let mut t = started(TournamentFormat::GroupsKnockout, 8);
+    play(&mut t, better_seed);
+    advance_to_knockout(&mut t).unwrap();
+    play(&mut t, better_seed);
+    assert_eq!(t.state, TournamentState::Completed);
+    assert_eq!(sorted_places(&t), vec![1, 2, 3, 3, 5, 5, 7, 7]);
+    assert_eq!(places(&t)["P1"], 1);
+}
+
+#[test]
+fn finished_tournaments_are_frozen_kept_and_queryable() {
+    let registry = TournamentRegistry::new();
+    let mut done = started(TournamentFormat::SingleElimination, 4);
+    done.name = "Spring Open".into();
+    play(&mut done, better_seed);
+    let done = registry.insert(done).unwrap();
+    let active = registry
+        .insert(started(TournamentFormat::RoundRobin, 4))
+        .unwrap();
+
+    assert_eq!(
+        registry.update(active.id, finish_tournament).unwrap_err(),
+        TournamentError::InvalidState.into()
+    );
+    let finished = registry.update(done.id, finish_tournament).unwrap();
+    assert!(finished.finished_at.is_some());
+    assert_eq!(finished.placements.len(), 4);
+    assert_eq!(
+        registry
+            .update(done.id, |t| t.set_name("Renamed"))
+            .unwrap_err(),
+        TournamentError::TournamentFinished.into()
+    );
+
+    assert_eq!(registry.remove_inactive(Duration::ZERO).unwrap().len(), 1);
+    let tournaments = registry.list().unwrap();
+    assert_eq!(tournaments.len(), 1);
+
+    let filter = TournamentFilter {
+        status: Some(TournamentStatus::Finished),
+        player: Some("p2".into()),
+        ..TournamentFilter::default()
+    };
+    let listed = list_tournaments(&tournaments, &filter);
+    assert_eq!(listed.len(), 1);
+    assert_eq!(listed[0].winners, vec!["P1"]);
+    let other_format = TournamentFilter {
+        format: Some(TournamentFormat::Swiss),
+        ..TournamentFilter::default()
+    };
+    assert!(list_tournaments(&tournaments, &other_format).is_empty());
+
+    let history = player_history(&tournaments, "P3");
+    assert_eq!(history.len(), 1);
+    assert_eq!(history[0].tournament_name, "Spring Open");
+    assert_eq!(history[0].place, Some(3));
+}
+
+/// Play up to `limit` matches 2-1 in legs to the better seed.
+fn play_scored(t: &mut Tournament, limit: usize) {
+    for _ in 0..limit {
+        let next = t
+            .bracket
+            .as_ref()
+            .unwrap()
+            .matches
+            .iter()
+            .find(|m| m.is_ready() && !m.bye && m.winner.is_none())
+            .cloned();
+        let Some(m) = next else {
+            return;
+        };
+        let winner = better_seed(t, &m);
+        let score = match m.side_of(winner).unwrap() {
+            Team::One => LegScore {
+                team_1: 2,
+                team_2: 1,
+            },
+            Team::Two => LegScore {
+                team_1: 1,
+                team_2: 2,
+            },
+        };
+        record_bracket_result(t, m.id, winner, Some(score), false).unwrap();
+    }
+}
+
+#[test]
+fn lifetime_records_add_up_from_the_stored_tournaments() {
+    let registry = TournamentRegistry::new();
+    let mut first = started(TournamentFormat::SingleElimination, 4);
+    first.name = "Monday".into();
+    play_scored(&mut first, usize::MAX);
+    let first = registry.insert(first).unwrap();
+    let mut second = started(TournamentFormat::SingleElimination, 4);
+    second.name = "Tuesday".into();
+    second.players[0].name = "p1".into();
+    // Only the semi-finals so far.
+    play_scored(&mut second, 2);
+    let second = registry.insert(second).unwrap();
+
+    let record = player_record(&registry.list().unwrap(), "P1").unwrap();
+    assert_eq!(record.name, "p1");
+    let names: Vec<&str> = record
+        .tournaments
+        .iter()
+        .map(|e| e.tournament_name.as_str())
+        .collect();
+    assert_eq!(names, vec!["Tuesday", "Monday"]);
+    let monday = record.tournaments[1].stats;
+    assert_eq!(
+        monday,
+        EventStats {
+            wins: 2,
+            legs_won: 4,
+            legs_lost: 2,
+            ..EventStats::default()
+        }
+    );
+    assert_eq!(record.lifetime.wins, 3);
+    assert_eq!(
+        (record.lifetime.legs_won, record.lifetime.legs_lost),
+        (6, 3)
+    );
+    let p4 = player_record(&registry.list().unwrap(), "P4").unwrap();
+    assert_eq!((p4.lifetime.losses, p4.lifetime.legs_won), (2, 2));
+
+    // Restarting a tournament wipes its results, so they leave the lifetime totals too.
+    registry
+        .update(second.id, |t| t.restart_tournament())
+        .unwrap();
+    let record = player_record(&registry.list().unwrap(), "P1").unwrap();
+    assert_eq!(record.tournaments[0].stats, EventStats::default());
+    assert_eq!(record.lifetime, monday);
+
+    // So does deleting one.
+    registry.remove(first.id).unwrap();
+    let record = player_record(&registry.list().unwrap(), "P1").unwrap();
+    assert_eq!(record.tournaments.len(), 1);
+    assert_eq!(record.lifetime, EventStats::default());
+    registry.remove(second.id).unwrap();
+    assert!(player_record(&registry.list().unwrap(), "P1").is_none());
+}
@@ -0,0 +1,175 @@
+//! Integration tests for the audit log: what each change logs, overwrites, and the JSONL store.
+
+mod common;
+
+use chrono::{Duration, Utc};
+use common::Knockout;
+use dart_tournament_web::audit::{changes, AuditLog, AuditQuery, EntityType, Operation};
+use dart_tournament_web::scoring::MatchFormat;
+use dart_tournament_web::{
+    record_bracket_result, record_match_visit, set_match_formats, start_tournament,
+    undo_last_action, LegScore, MatchFormats, MatchId, Team, Tournament,
+};
+use serde_json::json;
+use std::fs;
+
+fn first_match(t: &Tournament) -> MatchId {
+    t.bracket.as_ref().unwrap().matches[0].id
+}
+
+#[test]
+fn an_overwritten_result_logs_the_old_and_new_winner() {
+    let mut t = Knockout::numbered(4).entered();
+    start_tournament(&mut t).unwrap();
+    let id = first_match(&t);
+    let m = t.bracket.as_ref().unwrap().get(id).unwrap().clone();
+    let (p1, p4) = (m.team_1.unwrap(), m.team_2.unwrap());
+
+    let before = t.clone();
+    let score = LegScore {
+        team_1: 2,
+        team_2: 0,
+    };
+    record_bracket_result(&mut t, id, p1, Some(score), false).unwrap();
+    let logged = changes(&before, &t);
+    assert_eq!(logged.len(), 1);
+    assert_eq!(logged[0].operation, Operation::ResultRecorded);
+    assert_eq!(logged[0].entity_type, EntityType::Match);
+    assert_eq!(logged[0].before, json!(null));
+    assert_eq!(
+        logged[0].after,
+        json!({ "winner_id": p1, "winner": "P1", "score": { "team_1": 2, "team_2": 0 } })
+    );
+
+    let before = t.clone();
+    record_bracket_result(&mut t, id, p4, None, true).unwrap();
+    let logged = changes(&before, &t);
+    assert_eq!(logged.len(), 1);
+    assert_eq!(logged[0].operation, Operation::ResultChanged);
+    assert_eq!(logged[0].before["winner"], "P1");
+    assert_eq!(logged[0].after["winner"], "P4");
+    assert_eq!(logged[0].after["score"], json!(null));
+
+    // Undoing the overwrite puts the first result back; undoing again takes it away.
+    let before = t.clone();
+    undo_last_action(&mut t, id).unwrap();
+    let logged = changes(&before, &t);
+    assert_eq!(logged[0].operation, Operation::ResultChanged);
+    assert_eq!(logged[0].after["winner"], "P1");
+    let before = t.clone();
+    undo_last_action(&mut t, id).unwrap();
+    let logged = changes(&before, &t);
+    assert_eq!(logged[0].operation, Operation::ResultUndone);
+    assert_eq!(logged[0].after, json!(null));
+}
+
+#[test]
+fn only_the_winning_visit_logs_a_result() {
+    let mut t = Knockout::numbered(2).entered();
+    set_match_formats(
+        &mut t,
+        MatchFormats {
+            final_match: Some(MatchFormat::best_of_legs(1)),
+            ..MatchFormats::default()
+        },
+    )
+    .unwrap();
+    start_tournament(&mut t).unwrap();
+    let id = first_match(&t);
+    let mut logged = Vec::new();
+    for score in [180, 180, 141] {
+        let before = t.clone();
+        record_match_visit(&mut t, id, Team::One, score, 3, score == 141, 0).unwrap();
+        logged.push(changes(&before, &t));
+        if score != 141 {
+            let before = t.clone();
+            record_match_visit(&mut t, id, Team::Two, 0, 3, false, 0).unwrap();
+            assert!(changes(&before, &t).is_empty());
+        }
+    }
+    assert!(logged[0].is_empty() && logged[1].is_empty());
+    assert_eq!(logged[2].len(), 1);
+    assert_eq!(logged[2][0].operation, Operation::ResultRecorded);
+    assert_eq!(
+        logged[2][0].after["score"],
+        json!({ "team_1": 1, "team_2": 0 })
+    );
+}
+
+#[test]
+fn players_seeds_and_formats_are_logged_apart() {
+    let mut t = Knockout::numbered(3).entered();
+    let before = t.clone();
+    t.add_player("P4").unwrap();
+    let logged = changes(&before, &t);
+    // The newcomer's seed is part of adding them, not a re-seed.
+    assert_eq!(logged.len(), 1);
+    assert_eq!(logged[0].operation, Operation::PlayerAdded);
+    assert_eq!(logged[0].after["name"], "P4");
+
+    let before = t.clone();
+    let mut order: Vec<_> = t.players.iter().map(|p| p.id).collect();
+    order.reverse();
+    t.set_seeds(&order).unwrap();
+    let logged = changes(&before, &t);
+    assert_eq!(logged.len(), 1);
+    assert_eq!(logged[0].operation, Operation::Reseeded);
+    assert_eq!(logged[0].before, json!(["P1", "P2", "P3", "P4"]));
+    assert_eq!(logged[0].after, json!(["P4", "P3", "P2", "P1"]));
+
+    let before = t.clone();
+    let formats = MatchFormats {
+        semi_final: Some(MatchFormat::best_of_legs(5)),
+        ..MatchFormats::default()
+    };
+    set_match_formats(&mut t, formats).unwrap();
+    let logged = changes(&before, &t);
+    assert_eq!(logged.len(), 1);
+    assert_eq!(logged[0].operation, Operation::FormatChanged);
+    assert_eq!(logged[0].entity_id, t.id);
+    assert_eq!(logged[0].after["semi_final"]["legs"], 5);
+}
+
+#[test]
+fn the_log_is_appended_to_its_file_and_read_back() {
+    let dir = std::env::temp_dir().join(format!("dart-audit-{}", uuid::Uuid::new_v4()));
+    let path = dir.join("audit.jsonl");
+    let mut a = Knockout::numbered(3).entered();
+    let b = Knockout::numbered(3).entered();
+    let log = AuditLog::open(&path).unwrap();
+    let before = a.clone();
+    a.add_player("P4").unwrap();
+    log.record("admin:0123456789ab", a.id, changes(&before, &a))
+        .unwrap();
+    let before = a.clone();
+    a.add_player("P5").unwrap();
+    log.record("scorer:ba9876543210", a.id, changes(&before, &a))
+        .unwrap();
+    log.record("admin:0123456789ab", b.id, Vec::new()).unwrap();
+    assert_eq!(fs::read_to_string(&path).unwrap().lines().count(), 2);
+
+    let reopened = AuditLog::open(&path).unwrap();
+    let all = reopened.query(&AuditQuery::default());
+    assert_eq!(all.len(), 2);
+    // Newest first.
+    assert_eq!(all[0].actor, "scorer:ba9876543210");
+    assert_eq!(all[0].change.after["name"], "P5");
+
+    let limited = AuditQuery {
+        tournament_id: Some(a.id),
+        limit: Some(1),
+        ..AuditQuery::default()
+    };
+    assert_eq!(reopened.query(&limited)[0].change.after["name"], "P5");
+    let other = AuditQuery {
+        tournament_id: Some(b.id),
+        ..AuditQuery::default()
+    };
+    assert!(reopened.query(&other).is_empty());
+    let future = AuditQuery {
+        since: Some(Utc::now() + Duration::minutes(1)),
+        ..AuditQuery::default()
+    };
+    assert!(reopened.query(&future).is_empty());
+    fs::remove_dir_all(&dir).unwrap();
+}
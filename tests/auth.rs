@@ -0,0 +1,164 @@
+//! Integration tests for API keys: which routes need which role, and the 401/403 responses.
+
+use dart_tournament_web::auth::{required_role, ApiKeys, Role};
+use dart_tournament_web::{Tournament, TournamentMode, TournamentRegistry};
+use serde_json::json;
+use std::fs;
+
+fn keys() -> ApiKeys {
+    let mut keys = ApiKeys::from_admin_list(" admin-key , ,second-admin");
+    keys.add("scorer-key", Role::Scorer);
+    keys
+}
+
+fn bearer(key: &str) -> String {
+    format!("Bearer {key}")
+}
+
+#[test]
+fn reads_and_health_need_no_key() {
+    let keys = keys();
+    for (method, path) in [
+        ("GET", "/api/tournaments/abc"),
+        ("GET", "/api/leaderboard"),
+        ("HEAD", "/"),
+        ("POST", "/api/health"),
+        ("POST", "/ping"),
+        ("POST", "/api/site-gate"),
+    ] {
+        assert_eq!(required_role(method, path), None, "{method} {path}");
+        assert_eq!(keys.authorize(method, path, None), Ok(None));
+    }
+}
+
+#[test]
+fn scoring_routes_take_a_scorer_key_and_the_rest_need_admin() {
+    for path in [
+        "/api/tournaments/t/matches/m/visits",
+        "/api/tournaments/t/matches/m/undo",
+        "/api/tournaments/t/bracket/matches/m/result",
+        "/api/tournaments/t/bracket/matches/m/walkover",
+        "/api/tournaments/t/matches/winner",
+        "/api/tournaments/t/finals/submit",
+    ] {
+        assert_eq!(required_role("POST", path), Some(Role::Scorer), "{path}");
+    }
+    for (method, path) in [
+        ("POST", "/api/tournaments"),
+        ("DELETE", "/api/tournaments/t"),
+        ("POST", "/api/tournaments/t/players"),
+        ("PUT", "/api/tournaments/t/seeds"),
+        ("POST", "/api/tournaments/t/start"),
+        ("POST", "/api/tournaments/t/restart"),
+        ("POST", "/api/tournaments/t/players/p/withdraw"),
+    ] {
+        assert_eq!(required_role(method, path), Some(Role::Admin), "{path}");
+    }
+}
+
+#[test]
+fn missing_or_unknown_keys_are_401() {
+    let keys = keys();
+    let path = "/api/tournaments/t/matches/m/visits";
+    for header in [
+        None,
+        Some("admin-key"),
+        Some("Bearer "),
+        Some("Bearer nope"),
+    ] {
+        let e = keys.authorize("POST", path, header).unwrap_err();
+        assert_eq!((e.status, e.code), (401, "unauthorized"), "{header:?}");
+    }
+    let auth = bearer("second-admin");
+    assert_eq!(
+        keys.authorize("POST", path, Some(&auth)),
+        Ok(Some(Role::Admin))
+    );
+}
+
+#[test]
+fn scorer_key_is_rejected_from_deleting_a_tournament() {
+    let registry = TournamentRegistry::new();
+    let id = registry
+        .insert(Tournament::new(3, TournamentMode::OneVOne))
+        .unwrap()
+        .id;
+    let keys = keys();
+    let path = format!("/api/tournaments/{id}");
+    let scorer = bearer("scorer-key");
+
+    let e = keys.authorize("DELETE", &path, Some(&scorer)).unwrap_err();
+    assert_eq!(e.status, 403);
+    assert_eq!(
+        e.envelope(),
+        json!({ "error": {
+            "code": "forbidden",
+            "message": "This API key may not do that",
+            "details": { "role": "scorer", "required_role": "admin" },
+        }})
+    );
+    assert!(registry.get(id).is_ok());
+
+    // The same key may score, and an admin key may delete.
+    let visits = format!("/api/tournaments/{id}/matches/{id}/visits");
+    assert_eq!(
+        keys.authorize("POST", &visits, Some(&scorer)),
+        Ok(Some(Role::Scorer))
+    );
+    let admin = bearer("admin-key");
+    assert_eq!(
+        keys.authorize("DELETE", &path, Some(&admin)),
+        Ok(Some(Role::Admin))
+    );
+    registry.remove(id).unwrap();
+    assert!(registry.get(id).is_err());
+}
+
+#[test]
+fn no_configured_keys_leaves_writes_open() {
+    let keys = ApiKeys::from_admin_list("");
+    assert!(keys.is_empty());
+    assert_eq!(
+        keys.authorize("DELETE", "/api/tournaments/t", None),
+        Ok(None)
+    );
+}
+
+#[test]
+fn keys_file_adds_roles_and_keeps_the_higher_one() {
+    let path = std::env::temp_dir().join(format!("dart-keys-{}.json", uuid::Uuid::new_v4()));
+    fs::write(
+        &path,
+        r#"[{ "key": "desk", "role": "scorer" }, { "key": "admin-key", "role": "scorer" }]"#,
+    )
+    .unwrap();
+    let mut keys = keys();
+    assert_eq!(keys.load_file(&path).unwrap(), 2);
+    assert_eq!(keys.role_for("desk"), Some(Role::Scorer));
+    assert_eq!(keys.role_for("admin-key"), Some(Role::Admin));
+
+    fs::write(&path, r#"[{ "key": "x", "role": "owner" }]"#).unwrap();
+    assert!(keys.load_file(&path).is_err());
+    fs::remove_file(&path).unwrap();
+}
+
+#[test]
+fn the_audit_log_is_admin_only_and_names_keys_without_the_secret() {
+    let keys = keys();
+    assert_eq!(required_role("GET", "/api/audit"), Some(Role::Admin));
+    assert_eq!(required_role("GET", "/api/admin/backup"), Some(Role::Admin));
+    let webhooks = "/api/tournaments/0b8e4530-0000-4000-8000-000000000000/webhooks";
+    assert_eq!(required_role("GET", webhooks), Some(Role::Admin));
+    let scorer = bearer("scorer-key");
+    let e = keys
+        .authorize("GET", "/api/audit", Some(&scorer))
+        .unwrap_err();
+    assert_eq!(e.status, 403);
+
+    let actor = keys.actor(Some(&scorer));
+    assert!(actor.starts_with("scorer:") && actor.len() == "scorer:".len() + 12);
+    assert!(!actor.contains("scorer-key"));
+    assert_ne!(actor, keys.actor(Some(&bearer("desk-two"))));
+    assert_eq!(keys.actor(None), "anonymous");
+    assert_eq!(keys.actor(Some(&bearer("nope"))), "unknown");
+}
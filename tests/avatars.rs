@@ -0,0 +1,122 @@
+//! Integration tests for player photos: checking uploads by their bytes, the initials
+//! placeholder, and photos kept on disk.
+
+use dart_tournament_web::avatars::{
+    initials_svg, Avatar, AvatarError, AvatarStore, ImageKind, MAX_AVATAR_BYTES, MAX_AVATAR_SIDE,
+};
+use std::path::PathBuf;
+use uuid::Uuid;
+
+/// The start of a PNG: signature and IHDR chunk for a `width`×`height` image. Enough to be
+/// taken for one; nothing reads past the header.
+fn png(width: u32, height: u32) -> Vec<u8> {
+    let mut bytes = b"\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR".to_vec();
+    bytes.extend(width.to_be_bytes());
+    bytes.extend(height.to_be_bytes());
+    bytes.extend([8, 6, 0, 0, 0]);
+    bytes
+}
+
+/// The start of a JPEG: an APP0 segment, then a baseline frame header for the size.
+fn jpeg(width: u16, height: u16) -> Vec<u8> {
+    let mut bytes = vec![0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10];
+    bytes.extend(b"JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00");
+    bytes.extend([0xFF, 0xC0, 0x00, 0x11, 0x08]);
+    bytes.extend(height.to_be_bytes());
+    bytes.extend(width.to_be_bytes());
+    bytes.extend([0x03; 9]);
+    bytes
+}
+
+#[test]
+fn uploads_are_taken_for_what_their_bytes_are() {
+    let photo = Avatar::from_upload(png(300, 200)).unwrap();
+    assert_eq!(
+        (photo.kind, photo.width, photo.height),
+        (ImageKind::Png, 300, 200)
+    );
+    let photo = Avatar::from_upload(jpeg(640, 480)).unwrap();
+    assert_eq!(
+        (photo.kind, photo.width, photo.height),
+        (ImageKind::Jpeg, 640, 480)
+    );
+    assert_eq!(photo.kind.content_type(), "image/jpeg");
+
+    // A GIF, or an HTML page, whatever the upload claimed to be.
+    assert_eq!(
+        Avatar::from_upload(b"GIF89a\x01\x00\x01\x00".to_vec()),
+        Err(AvatarError::UnsupportedType)
+    );
+    assert_eq!(
+        Avatar::from_upload(b"<html><script></script></html>".to_vec()),
+        Err(AvatarError::UnsupportedType)
+    );
+    // The right magic bytes with no readable size behind them.
+    assert_eq!(
+        Avatar::from_upload(png(300, 200)[..14].to_vec()),
+        Err(AvatarError::Damaged)
+    );
+    assert_eq!(
+        Avatar::from_upload(jpeg(640, 480)[..22].to_vec()),
+        Err(AvatarError::Damaged)
+    );
+    assert_eq!(Avatar::from_upload(png(0, 200)), Err(AvatarError::Damaged));
+
+    assert_eq!(
+        Avatar::from_upload(png(MAX_AVATAR_SIDE + 1, 10)),
+        Err(AvatarError::TooManyPixels {
+            width: MAX_AVATAR_SIDE + 1,
+            height: 10
+        })
+    );
+    let mut large = png(100, 100);
+    large.resize(MAX_AVATAR_BYTES + 1, 0);
+    assert_eq!(Avatar::from_upload(large), Err(AvatarError::TooLarge));
+}
+
+#[test]
+fn players_without_a_photo_get_their_initials() {
+    let svg = initials_svg("anna van der berg");
+    assert!(svg.starts_with("<svg "));
+    assert!(svg.contains(">AV</text>"));
+    // The colour comes from the name, so it is the same every time and for any case.
+    assert_eq!(svg, initials_svg("  Anna Van der Berg "));
+    assert_ne!(svg, initials_svg("Andy Vale"));
+    assert!(initials_svg("<b>").contains(">&lt;</text>"));
+    assert!(initials_svg("  ").contains(">?</text>"));
+}
+
+#[test]
+fn photos_are_kept_on_disk_and_follow_renames() {
+    let dir: PathBuf = std::env::temp_dir().join(format!("dart-avatar-test-{}", Uuid::new_v4()));
+    let store = AvatarStore::open(&dir).unwrap();
+    store
+        .put("Ann", Avatar::from_upload(png(64, 64)).unwrap())
+        .unwrap();
+    let files = || std::fs::read_dir(&dir).unwrap().count();
+    assert_eq!(files(), 1);
+    // A JPEG replaces the PNG rather than sitting beside it.
+    store
+        .put("ann", Avatar::from_upload(jpeg(64, 48)).unwrap())
+        .unwrap();
+    assert_eq!(files(), 1);
+    assert_eq!(store.get("ANN").unwrap().kind, ImageKind::Jpeg);
+
+    let reopened = AvatarStore::open(&dir).unwrap();
+    assert_eq!(reopened.get("Ann"), store.get("Ann"));
+
+    store
+        .put("Bob", Avatar::from_upload(png(10, 10)).unwrap())
+        .unwrap();
+    // Merging Ann into Bob keeps the photo Bob already had.
+    store.rename("Ann", "Bob").unwrap();
+    assert!(store.get("Ann").is_none());
+    assert_eq!(store.get("Bob").unwrap().kind, ImageKind::Png);
+    store.rename("Bob", "Robert").unwrap();
+    assert_eq!(store.get("robert").unwrap().width, 10);
+
+    assert!(store.remove("Robert").unwrap());
+    assert!(!store.remove("Robert").unwrap());
+    assert_eq!(files(), 0);
+    std::fs::remove_dir_all(&dir).unwrap();
+}
@@ -0,0 +1,187 @@
+//! Integration tests for backups: a restore round trip, and damaged backups left unrestored.
+
+use dart_tournament_web::backup::{Backup, BackupError};
+use dart_tournament_web::migrations::SCHEMA_VERSION;
+use dart_tournament_web::seasons::{PointsTable, Season, SeasonStore};
+use dart_tournament_web::templates::{
+    TemplateError, TemplateStore, TournamentSettings, TournamentTemplate,
+};
+use dart_tournament_web::{
+    finish_tournament, record_bracket_result, start_tournament, FileStore, Tournament,
+    TournamentFormat, TournamentMode, TournamentRegistry,
+};
+use serde_json::Value;
+use std::path::{Path, PathBuf};
+use uuid::Uuid;
+
+fn temp_dir() -> PathBuf {
+    std::env::temp_dir().join(format!("dart-backup-test-{}", Uuid::new_v4()))
+}
+
+struct State {
+    registry: TournamentRegistry,
+    seasons: SeasonStore,
+    templates: TemplateStore,
+}
+
+/// Stores kept in `dir`, with whatever is already there loaded.
+fn open(dir: &Path) -> State {
+    State {
+        registry: TournamentRegistry::with_store(Box::new(
+            FileStore::open(dir.join("tournaments")).unwrap(),
+        ))
+        .unwrap(),
+        seasons: SeasonStore::open(dir.join("seasons")).unwrap(),
+        templates: TemplateStore::open(dir.join("templates")).unwrap(),
+    }
+}
+
+impl State {
+    fn backup(&self) -> Vec<u8> {
+        Backup::take(&self.registry, &self.seasons, &self.templates)
+            .unwrap()
+            .to_json()
+    }
+
+    fn restore(&self, bytes: &[u8]) -> Result<(), BackupError> {
+        Backup::parse(bytes)?.restore(&self.registry, &self.seasons, &self.templates)
+    }
+}
+
+/// `winner` beats `loser` in their bracket match.
+fn beat(t: &mut Tournament, winner: &str, loser: &str) {
+    let id_of = |name: &str| {
+        t.all_players()
+            .into_iter()
+            .find(|p| p.name == name)
+            .unwrap()
+            .id
+    };
+    let (w, l) = (id_of(winner), id_of(loser));
+    let id = t
+        .bracket
+        .as_ref()
+        .unwrap()
+        .matches
+        .iter()
+        .find(|m| m.side_of(w).is_some() && m.side_of(l).is_some())
+        .unwrap()
+        .id;
+    record_bracket_result(t, id, w, None, false).unwrap();
+}
+
+/// A finished four-player knockout where the seeds hold.
+fn finished_knockout(name: &str) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.name = name.to_string();
+    t.format = TournamentFormat::SingleElimination;
+    for player in ["Ann", "Bob", "Cy", "Di"] {
+        t.add_player(player).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    beat(&mut t, "Ann", "Di");
+    beat(&mut t, "Bob", "Cy");
+    beat(&mut t, "Ann", "Bob");
+    finish_tournament(&mut t).unwrap();
+    t
+}
+
+fn template(name: &str) -> TournamentTemplate {
+    TournamentTemplate {
+        name: name.to_string(),
+        settings: TournamentSettings::default(),
+    }
+}
+
+#[test]
+fn a_restored_backup_backs_up_to_the_same_document() {
+    let (from_dir, to_dir) = (temp_dir(), temp_dir());
+    let from = open(&from_dir);
+    let week = from.registry.insert(finished_knockout("Week 1")).unwrap();
+    let mut open_night = Tournament::new(3, TournamentMode::OneVOne);
+    open_night.add_player("Ann").unwrap();
+    from.registry.insert(open_night).unwrap();
+    let mut season = Season::new("Winter", PointsTable::default(), None).unwrap();
+    season.attach(&week).unwrap();
+    from.seasons.insert(season).unwrap();
+    from.templates.save(template("thursday-league")).unwrap();
+    let first = from.backup();
+    let doc: Value = serde_json::from_slice(&first).unwrap();
+    assert_eq!(doc["schema_version"], SCHEMA_VERSION);
+    assert_eq!(doc["tournaments"].as_array().unwrap().len(), 2);
+
+    // What was there before is gone after the restore, from memory and from disk.
+    let to = open(&to_dir);
+    let stale = to.registry.insert(finished_knockout("Old")).unwrap();
+    to.templates.save(template("old-format")).unwrap();
+    to.seasons
+        .insert(Season::new("Old", PointsTable::default(), None).unwrap())
+        .unwrap();
+    to.restore(&first).unwrap();
+    assert_eq!(to.backup(), first);
+    assert!(to.registry.get(stale.id).is_err());
+
+    let reopened = open(&to_dir);
+    assert_eq!(reopened.backup(), first);
+    assert_eq!(reopened.seasons.list()[0].name, "Winter");
+    assert_eq!(reopened.templates.list()[0].name, "thursday-league");
+
+    std::fs::remove_dir_all(&from_dir).unwrap();
+    std::fs::remove_dir_all(&to_dir).unwrap();
+}
+
+#[test]
+fn a_damaged_or_newer_backup_changes_nothing() {
+    let dir = temp_dir();
+    let state = open(&dir);
+    state.registry.insert(finished_knockout("Keep")).unwrap();
+    state.templates.save(template("keep")).unwrap();
+    let before = state.backup();
+    let doc: Value = serde_json::from_slice(&before).unwrap();
+    let edited = |f: &dyn Fn(&mut Value)| {
+        let mut doc = doc.clone();
+        f(&mut doc);
+        serde_json::to_vec(&doc).unwrap()
+    };
+
+    assert!(matches!(
+        state.restore(&before[..before.len() / 2]),
+        Err(BackupError::Invalid(_))
+    ));
+    assert!(matches!(state.restore(b"[]"), Err(BackupError::Invalid(_))));
+    let not_a_backup = edited(&|d| d["format"] = "something-else".into());
+    assert!(matches!(
+        state.restore(&not_a_backup),
+        Err(BackupError::Invalid(_))
+    ));
+    let newer = edited(&|d| d["schema_version"] = (SCHEMA_VERSION + 1).into());
+    assert_eq!(
+        state.restore(&newer).unwrap_err(),
+        BackupError::Ahead {
+            found: SCHEMA_VERSION + 1,
+            known: SCHEMA_VERSION
+        }
+    );
+    let broken_tournament = edited(&|d| d["tournaments"][0]["players"] = "nobody".into());
+    assert!(matches!(
+        state.restore(&broken_tournament),
+        Err(BackupError::Invalid(_))
+    ));
+    let twice = edited(&|d| {
+        let t = d["tournaments"][0].clone();
+        d["tournaments"].as_array_mut().unwrap().push(t);
+    });
+    assert!(matches!(
+        state.restore(&twice),
+        Err(BackupError::Invalid(_))
+    ));
+    let bad_template = edited(&|d| d["templates"][0]["name"] = "Not Valid".into());
+    assert_eq!(
+        state.restore(&bad_template).unwrap_err(),
+        BackupError::Template(TemplateError::InvalidName)
+    );
+
+    assert_eq!(state.backup(), before);
+    assert_eq!(open(&dir).backup(), before);
+    std::fs::remove_dir_all(&dir).unwrap();
+}
@@ -0,0 +1,132 @@
+//! Integration tests for board scheduling: assignment order, freeing boards, no double booking.
+
+use dart_tournament_web::{
+    next_matches, numbered_boards, record_bracket_result, set_boards, start_tournament,
+    undo_last_action, MatchId, PlayerId, Tournament, TournamentError, TournamentFormat,
+    TournamentMode,
+};
+use std::collections::HashSet;
+
+fn started(format: TournamentFormat, players: usize, boards: usize) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = format;
+    for i in 0..players {
+        t.add_player(format!("P{}", i + 1)).unwrap();
+    }
+    set_boards(&mut t, &numbered_boards(boards)).unwrap();
+    start_tournament(&mut t).unwrap();
+    t
+}
+
+fn on_boards(t: &Tournament) -> Vec<Option<MatchId>> {
+    t.boards.iter().map(|b| b.match_id).collect()
+}
+
+fn win(t: &mut Tournament, id: MatchId) {
+    let winner = t.bracket.as_ref().unwrap().get(id).unwrap().team_1.unwrap();
+    record_bracket_result(t, id, winner, None, false).unwrap();
+}
+
+fn assert_no_double_booking(t: &Tournament) {
+    let mut seen: HashSet<PlayerId> = HashSet::new();
+    for (_, m) in next_matches(t) {
+        for p in [m.team_1.unwrap(), m.team_2.unwrap()] {
+            assert!(seen.insert(p), "player on two boards");
+        }
+    }
+}
+
+#[test]
+fn more_ready_matches_than_boards_queue_in_bracket_order() {
+    let mut t = started(TournamentFormat::SingleElimination, 8, 2);
+    let first: Vec<MatchId> = t.bracket.as_ref().unwrap().round(1).map(|m| m.id).collect();
+    assert_eq!(on_boards(&t), vec![Some(first[0]), Some(first[1])]);
+
+    // The freed board takes the next waiting first-round match, not a semi-final.
+    win(&mut t, first[0]);
+    assert_eq!(on_boards(&t), vec![Some(first[2]), Some(first[1])]);
+    let paired: Vec<_> = next_matches(&t)
+        .into_iter()
+        .map(|(b, m)| (b.name.as_str(), m.id))
+        .collect();
+    assert_eq!(paired, vec![("Board 1", first[2]), ("Board 2", first[1])]);
+
+    // Board 2 takes the last first-round match; once matches 1 and 2 are in, their
+    // semi-final is ready and goes to the next board to free up.
+    win(&mut t, first[1]);
+    assert_eq!(on_boards(&t), vec![Some(first[2]), Some(first[3])]);
+    win(&mut t, first[2]);
+    let semi = t.bracket.as_ref().unwrap().round(2).next().unwrap().id;
+    assert_eq!(on_boards(&t), vec![Some(semi), Some(first[3])]);
+}
+
+#[test]
+fn a_player_in_two_ready_matches_is_only_put_on_one_board() {
+    // Round robin: every match of every round is ready from the start.
+    let mut t = started(TournamentFormat::RoundRobin, 4, 4);
+    let bracket = t.bracket.as_ref().unwrap();
+    let round_1: Vec<MatchId> = bracket.round(1).map(|m| m.id).collect();
+    assert_eq!(
+        on_boards(&t),
+        vec![Some(round_1[0]), Some(round_1[1]), None, None]
+    );
+    assert_no_double_booking(&t);
+
+    // Both freed players have already met and the other two are still playing: the board
+    // stays free rather than booking a busy player.
+    win(&mut t, round_1[0]);
+    assert_eq!(on_boards(&t), vec![None, Some(round_1[1]), None, None]);
+
+    win(&mut t, round_1[1]);
+    let round_2: HashSet<MatchId> = t.bracket.as_ref().unwrap().round(2).map(|m| m.id).collect();
+    let assigned: HashSet<MatchId> = on_boards(&t).into_iter().flatten().collect();
+    assert_eq!(assigned, round_2);
+    assert_no_double_booking(&t);
+}
+
+#[test]
+fn undoing_a_result_frees_the_match_it_fed() {
+    let mut t = started(TournamentFormat::SingleElimination, 4, 2);
+    let first: Vec<MatchId> = t.bracket.as_ref().unwrap().round(1).map(|m| m.id).collect();
+    win(&mut t, first[0]);
+    win(&mut t, first[1]);
+    let final_id = t.bracket.as_ref().unwrap().final_match().unwrap().id;
+    assert_eq!(on_boards(&t), vec![Some(final_id), None]);
+
+    undo_last_action(&mut t, first[1]).unwrap();
+    assert_eq!(on_boards(&t), vec![Some(first[1]), None]);
+}
+
+#[test]
+fn renaming_boards_keeps_assignments_and_rejects_bad_names() {
+    let mut t = started(TournamentFormat::SingleElimination, 8, 2);
+    let kept = t.boards[1].match_id;
+    set_boards(&mut t, &["Stage".into(), " Board 2 ".into(), "Bar".into()]).unwrap();
+    assert_eq!(t.boards[1].match_id, kept);
+    assert_eq!(t.boards.len(), 3);
+    assert_eq!(next_matches(&t).len(), 3);
+    assert_no_double_booking(&t);
+
+    assert_eq!(
+        set_boards(&mut t, &["A".into(), "a".into()]),
+        Err(TournamentError::DuplicateBoardName)
+    );
+    assert_eq!(
+        set_boards(&mut t, &[" ".into()]),
+        Err(TournamentError::EmptyBoardName)
+    );
+    assert_eq!(t.boards.len(), 3);
+
+    set_boards(&mut t, &[]).unwrap();
+    assert!(next_matches(&t).is_empty());
+}
+
+#[test]
+fn restart_keeps_the_boards_but_frees_them() {
+    let mut t = started(TournamentFormat::SingleElimination, 4, 2);
+    t.restart_tournament().unwrap();
+    assert_eq!(t.boards.len(), 2);
+    assert!(t.boards.iter().all(|b| b.match_id.is_none()));
+    start_tournament(&mut t).unwrap();
+    assert_eq!(next_matches(&t).len(), 2);
+}
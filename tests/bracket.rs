@@ -0,0 +1,246 @@
+//! Integration tests for single-elimination brackets: generation and recording results.
+
+use dart_tournament_web::{
+    generate_single_elim_bracket, record_bracket_result, seed_positions, start_tournament,
+    LegScore, Player, PlayerId, Tournament, TournamentError, TournamentFormat, TournamentMode,
+    TournamentState,
+};
+use std::collections::HashSet;
+
+fn seeded_players(n: usize) -> Vec<Player> {
+    (0..n)
+        .map(|i| {
+            let mut p = Player::new(format!("P{}", i + 1));
+            p.seed = i as u32 + 1;
+            p
+        })
+        .collect()
+}
+
+#[test]
+fn seed_positions_pair_top_with_bottom() {
+    assert_eq!(seed_positions(2), vec![1, 2]);
+    assert_eq!(seed_positions(4), vec![1, 4, 2, 3]);
+    assert_eq!(seed_positions(8), vec![1, 8, 4, 5, 2, 7, 3, 6]);
+}
+
+#[test]
+fn one_player_is_an_error() {
+    assert_eq!(
+        generate_single_elim_bracket(&seeded_players(1)),
+        Err(TournamentError::NotEnoughPlayersToStart { required: 2 })
+    );
+}
+
+#[test]
+fn two_players_is_a_single_final() {
+    let players = seeded_players(2);
+    let b = generate_single_elim_bracket(&players).unwrap();
+    assert_eq!(b.matches.len(), 1);
+    let m = &b.matches[0];
+    assert_eq!(
+        (m.team_1, m.team_2),
+        (Some(players[0].id), Some(players[1].id))
+    );
+    assert!(m.winner_to.is_none() && !m.bye);
+}
+
+#[test]
+fn brackets_from_2_to_32_players() {
+    for n in 2..=32 {
+        let players = seeded_players(n);
+        let b = generate_single_elim_bracket(&players).unwrap();
+        let size = n.next_power_of_two();
+        let byes = size - n;
+
+        assert_eq!(b.round_count(), size.trailing_zeros(), "n={n}");
+        assert_eq!(b.matches.len(), size - 1, "n={n}");
+
+        let first: Vec<_> = b.round(1).collect();
+        assert_eq!(first.len(), size / 2, "n={n}");
+        assert_eq!(first.iter().filter(|m| m.bye).count(), byes, "n={n}");
+
+        // Every player appears exactly once in round 1.
+        let ids: Vec<PlayerId> = first
+            .iter()
+            .flat_map(|m| [m.team_1, m.team_2])
+            .flatten()
+            .collect();
+        assert_eq!(ids.len(), n, "n={n}");
+        assert_eq!(ids.iter().collect::<HashSet<_>>().len(), n, "n={n}");
+
+        // Byes go to the top seeds, who are already placed in round 2.
+        let bye_receivers: HashSet<PlayerId> = first
+            .iter()
+            .filter(|m| m.bye)
+            .filter_map(|m| m.winner_id())
+            .collect();
+        let top: HashSet<PlayerId> = players[..byes].iter().map(|p| p.id).collect();
+        assert_eq!(bye_receivers, top, "n={n}");
+        if size > 2 {
+            let second: HashSet<PlayerId> = b
+                .round(2)
+                .flat_map(|m| [m.team_1, m.team_2])
+                .flatten()
+                .collect();
+            assert_eq!(second, top, "n={n}");
+        }
+
+        // Seeds 1 and 2 are in opposite halves.
+        if n > 2 {
+            let half = size / 4;
+            let pos = |id: PlayerId| {
+                first
+                    .iter()
+                    .position(|m| m.team_1 == Some(id) || m.team_2 == Some(id))
+                    .unwrap()
+            };
+            assert!(
+                pos(players[0].id) < half && pos(players[1].id) >= half,
+                "n={n}"
+            );
+        }
+    }
+}
+
+#[test]
+fn start_single_elimination_builds_bracket() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    for name in ["A", "B", "C"] {
+        t.add_player(name).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    assert_eq!(t.state, TournamentState::BracketPlay);
+    assert_eq!(t.players[0].seed, 1);
+    let b = t.bracket.as_ref().unwrap();
+    assert_eq!(b.matches.len(), 3);
+
+    let mut pairs = Tournament::new(3, TournamentMode::TwoVTwo);
+    pairs.format = TournamentFormat::SingleElimination;
+    pairs.add_player("A").unwrap();
+    pairs.add_player("B").unwrap();
+    assert_eq!(
+        start_tournament(&mut pairs),
+        Err(TournamentError::UnsupportedMode)
+    );
+}
+
+fn started_knockout(names: &[&str]) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    for name in names {
+        t.add_player(*name).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    t
+}
+
+fn player(t: &Tournament, id: PlayerId) -> &Player {
+    t.players.iter().find(|p| p.id == id).unwrap()
+}
+
+#[test]
+fn result_updates_stats_and_advances_winner() {
+    let mut t = started_knockout(&["A", "B", "C", "D"]);
+    let m = t.bracket.as_ref().unwrap().round(1).next().unwrap().clone();
+    let (a, b) = (m.team_1.unwrap(), m.team_2.unwrap());
+
+    record_bracket_result(
+        &mut t,
+        m.id,
+        a,
+        Some(LegScore {
+            team_1: 3,
+            team_2: 1,
+        }),
+        false,
+    )
+    .unwrap();
+    assert_eq!((player(&t, a).wins, player(&t, a).losses), (1, 0));
+    assert_eq!((player(&t, b).wins, player(&t, b).losses), (0, 1));
+    assert!(player(&t, b).eliminated);
+    let slot = m.winner_to.unwrap();
+    let next = t.bracket.as_ref().unwrap().get(slot.match_id).unwrap();
+    assert_eq!(next.player(slot.team), Some(a));
+    assert_eq!(t.state, TournamentState::BracketPlay);
+}
+
+#[test]
+fn result_validation() {
+    let mut t = started_knockout(&["A", "B", "C"]);
+    let b = t.bracket.clone().unwrap();
+    let bye = b.round(1).find(|m| m.bye).unwrap();
+    let real = b.round(1).find(|m| !m.bye).unwrap();
+    let outsider = bye.team_1.unwrap();
+
+    assert_eq!(
+        record_bracket_result(&mut t, bye.id, outsider, None, false),
+        Err(TournamentError::MatchNotReady)
+    );
+    assert_eq!(
+        record_bracket_result(&mut t, real.id, outsider, None, false),
+        Err(TournamentError::NotInMatch(outsider))
+    );
+    let winner = real.team_1.unwrap();
+    assert_eq!(
+        record_bracket_result(
+            &mut t,
+            real.id,
+            winner,
+            Some(LegScore {
+                team_1: 1,
+                team_2: 2
+            }),
+            false
+        ),
+        Err(TournamentError::InvalidScore)
+    );
+    // The final is not ready until its second player is known.
+    let final_id = b.final_match().unwrap().id;
+    assert_eq!(
+        record_bracket_result(&mut t, final_id, outsider, None, false),
+        Err(TournamentError::MatchNotReady)
+    );
+}
+
+#[test]
+fn overwrite_rolls_back_previous_result() {
+    let mut t = started_knockout(&["A", "B", "C", "D"]);
+    let m = t.bracket.as_ref().unwrap().round(1).next().unwrap().clone();
+    let (a, b) = (m.team_1.unwrap(), m.team_2.unwrap());
+    record_bracket_result(&mut t, m.id, a, None, false).unwrap();
+
+    assert_eq!(
+        record_bracket_result(&mut t, m.id, b, None, false),
+        Err(TournamentError::ResultAlreadyRecorded)
+    );
+    record_bracket_result(&mut t, m.id, b, None, true).unwrap();
+    assert_eq!((player(&t, a).wins, player(&t, a).losses), (0, 1));
+    assert_eq!((player(&t, b).wins, player(&t, b).losses), (1, 0));
+    assert!(player(&t, a).eliminated && !player(&t, b).eliminated);
+    let slot = m.winner_to.unwrap();
+    let next = t.bracket.as_ref().unwrap().get(slot.match_id).unwrap();
+    assert_eq!(next.player(slot.team), Some(b));
+}
+
+#[test]
+fn overwrite_is_locked_once_next_match_is_played() {
+    let mut t = started_knockout(&["A", "B", "C", "D"]);
+    let b = t.bracket.clone().unwrap();
+    let first: Vec<_> = b.round(1).cloned().collect();
+    for m in &first {
+        record_bracket_result(&mut t, m.id, m.team_1.unwrap(), None, false).unwrap();
+    }
+    let final_id = b.final_match().unwrap().id;
+    let champ = first[0].team_1.unwrap();
+    record_bracket_result(&mut t, final_id, champ, None, false).unwrap();
+    assert_eq!(t.state, TournamentState::Completed);
+    assert_eq!(t.bracket.as_ref().unwrap().champion(), Some(champ));
+
+    assert_eq!(
+        record_bracket_result(&mut t, first[0].id, first[0].team_2.unwrap(), None, true),
+        Err(TournamentError::NextMatchAlreadyPlayed)
+    );
+    assert_eq!(player(&t, champ).wins, 2);
+}
@@ -0,0 +1,213 @@
+//! Integration tests for the bracket layout: coordinates and feeds of an 8-player double
+//! elimination, positions kept as results come in, and the plate in a block of its own.
+
+use dart_tournament_web::bracket_view::{bracket_view, BracketView, MatchView};
+use dart_tournament_web::{
+    record_bracket_result, start_tournament, BracketMatch, BracketSection, MatchId, Team,
+    Tournament, TournamentError, TournamentFormat, TournamentMode,
+};
+use std::collections::HashMap;
+
+fn started(format: TournamentFormat, players: usize, plate: bool) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = format;
+    for i in 0..players {
+        t.add_player(format!("P{}", i + 1)).unwrap();
+    }
+    if plate {
+        t.set_plate(true).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    t
+}
+
+type Position = (BracketSection, u32, u32);
+
+/// Every match by (section, round, number).
+fn by_position(view: &BracketView) -> HashMap<Position, &MatchView> {
+    view.sections
+        .iter()
+        .flat_map(|s| {
+            s.matches
+                .iter()
+                .map(move |m| ((s.section, m.round_index + 1, m.number), m))
+        })
+        .collect()
+}
+
+/// Where each match sits, by (section, round, number): (column, slot).
+fn coordinates(view: &BracketView) -> Vec<(Position, (u32, u32))> {
+    let mut all: Vec<_> = by_position(view)
+        .into_iter()
+        .map(|(at, m)| (at, (m.column, m.slot)))
+        .collect();
+    all.sort_by_key(|(at, _)| (at.0 as u8, at.1, at.2));
+    all
+}
+
+#[test]
+fn an_eight_player_double_elimination_is_laid_out_with_its_feeds() {
+    use BracketSection::{GrandFinal, Losers, Winners};
+    let t = started(TournamentFormat::DoubleElimination, 8, false);
+    let view = bracket_view(&t).unwrap();
+    let shape: Vec<_> = view
+        .sections
+        .iter()
+        .map(|s| (s.section, s.first_column, s.rounds, s.slots))
+        .collect();
+    assert_eq!(
+        shape,
+        [(Winners, 0, 3, 8), (Losers, 0, 4, 8), (GrandFinal, 4, 2, 8)]
+    );
+    assert_eq!(
+        coordinates(&view),
+        [
+            ((Winners, 1, 1), (0, 1)),
+            ((Winners, 1, 2), (0, 3)),
+            ((Winners, 1, 3), (0, 5)),
+            ((Winners, 1, 4), (0, 7)),
+            ((Winners, 2, 1), (1, 2)),
+            ((Winners, 2, 2), (1, 6)),
+            ((Winners, 3, 1), (2, 4)),
+            ((Losers, 1, 1), (0, 2)),
+            ((Losers, 1, 2), (0, 6)),
+            ((Losers, 2, 1), (1, 2)),
+            ((Losers, 2, 2), (1, 6)),
+            ((Losers, 3, 1), (2, 4)),
+            ((Losers, 4, 1), (3, 4)),
+            ((GrandFinal, 1, 1), (4, 4)),
+            ((GrandFinal, 2, 1), (5, 4)),
+        ]
+    );
+
+    let at = by_position(&view);
+    let id = |section, round, number| at[&(section, round, number)].match_id;
+    let feeds = |section, round, number| -> Vec<(MatchId, Team, bool)> {
+        at[&(section, round, number)]
+            .sources
+            .iter()
+            .map(|s| (s.match_id, s.team, s.loser))
+            .collect()
+    };
+    assert!(feeds(Winners, 1, 1).is_empty());
+    assert_eq!(
+        feeds(Winners, 2, 2),
+        [
+            (id(Winners, 1, 3), Team::One, false),
+            (id(Winners, 1, 4), Team::Two, false)
+        ]
+    );
+    assert_eq!(
+        feeds(Losers, 1, 2),
+        [
+            (id(Winners, 1, 3), Team::One, true),
+            (id(Winners, 1, 4), Team::Two, true)
+        ]
+    );
+    // Winners round 2 drops in crossed over, so the top half meets the bottom half.
+    assert_eq!(
+        feeds(Losers, 2, 1),
+        [
+            (id(Losers, 1, 1), Team::One, false),
+            (id(Winners, 2, 2), Team::Two, true)
+        ]
+    );
+    assert_eq!(
+        feeds(Losers, 4, 1),
+        [
+            (id(Losers, 3, 1), Team::One, false),
+            (id(Winners, 3, 1), Team::Two, true)
+        ]
+    );
+    assert_eq!(
+        feeds(GrandFinal, 1, 1),
+        [
+            (id(Winners, 3, 1), Team::One, false),
+            (id(Losers, 4, 1), Team::Two, false)
+        ]
+    );
+    assert_eq!(
+        feeds(GrandFinal, 2, 1),
+        [
+            (id(GrandFinal, 1, 1), Team::One, false),
+            (id(GrandFinal, 1, 1), Team::Two, true)
+        ]
+    );
+    let top = at[&(Winners, 1, 1)];
+    assert_eq!(top.label, "Winners round 1");
+    assert_eq!(top.player_1.as_ref().unwrap().name, "P1");
+    assert_eq!(top.player_2.as_ref().unwrap().name, "P8");
+}
+
+fn first_ready(t: &Tournament) -> Option<BracketMatch> {
+    let b = t.bracket.as_ref().unwrap();
+    b.matches.iter().find(|m| m.is_ready() && !m.bye).cloned()
+}
+
+#[test]
+fn results_fill_the_boxes_without_moving_them() {
+    let mut t = started(TournamentFormat::DoubleElimination, 6, false);
+    let layout = |t: &Tournament| {
+        let view = bracket_view(t).unwrap();
+        let mut all: Vec<_> = by_position(&view)
+            .into_iter()
+            .map(|(at, m)| (at.0 as u8, at.1, at.2, m.column, m.slot, m.match_id))
+            .collect();
+        all.sort();
+        all
+    };
+    let before = layout(&t);
+    // Six players: the top two seeds have byes, already through.
+    let view = bracket_view(&t).unwrap();
+    let at = by_position(&view);
+    assert!(at[&(BracketSection::Winners, 1, 1)].bye);
+    assert_eq!(
+        at[&(BracketSection::Winners, 2, 1)]
+            .player_1
+            .as_ref()
+            .unwrap()
+            .name,
+        "P1"
+    );
+
+    for _ in 0..5 {
+        let m = first_ready(&t).unwrap();
+        record_bracket_result(&mut t, m.id, m.team_2.unwrap(), None, false).unwrap();
+        assert_eq!(layout(&t), before);
+    }
+    let view = bracket_view(&t).unwrap();
+    let decided = view
+        .sections
+        .iter()
+        .flat_map(|s| &s.matches)
+        .filter(|m| !m.bye && m.winner.is_some())
+        .count();
+    assert_eq!(decided, 5);
+}
+
+#[test]
+fn the_plate_is_a_block_of_its_own_and_round_robins_have_no_bracket_to_draw() {
+    use BracketSection::{Plate, Winners};
+    let mut t = started(TournamentFormat::SingleElimination, 8, true);
+    assert_eq!(bracket_view(&t).unwrap().sections.len(), 1);
+    for _ in 0..4 {
+        let m = first_ready(&t).unwrap();
+        record_bracket_result(&mut t, m.id, m.team_1.unwrap(), None, false).unwrap();
+    }
+    let view = bracket_view(&t).unwrap();
+    let plate = view.sections.iter().find(|s| s.section == Plate).unwrap();
+    assert_eq!((plate.first_column, plate.rounds, plate.slots), (0, 2, 4));
+    let slots: Vec<(u32, u32)> = plate.matches.iter().map(|m| (m.column, m.slot)).collect();
+    assert_eq!(slots, [(0, 1), (0, 3), (1, 2)]);
+    assert!(plate.matches[0].sources.is_empty());
+    assert_eq!(plate.matches[2].sources.len(), 2);
+    assert_eq!(plate.matches[2].label, "Plate final");
+    let winners = view.sections.iter().find(|s| s.section == Winners).unwrap();
+    assert_eq!(winners.slots, 8);
+
+    let round_robin = started(TournamentFormat::RoundRobin, 4, false);
+    assert_eq!(
+        bracket_view(&round_robin).unwrap_err(),
+        TournamentError::InvalidState
+    );
+}
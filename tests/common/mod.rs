@@ -0,0 +1,82 @@
+//! Fixtures shared by the integration tests; a test file takes them with `mod common;`.
+
+// Each test file is its own crate and uses only some of these.
+#![allow(dead_code)]
+
+use dart_tournament_web::{
+    numbered_boards, set_boards, start_tournament, Tournament, TournamentFormat, TournamentMode,
+};
+
+/// A one-against-one tournament to test with: single elimination, three losses and no boards
+/// unless told otherwise. [`Self::entered`] leaves it in setup; [`Self::started`] draws it.
+pub struct Knockout {
+    players: Vec<String>,
+    format: TournamentFormat,
+    max_losses: u32,
+    name: Option<String>,
+    boards: usize,
+}
+
+impl Knockout {
+    /// With `names` entered, in that order.
+    pub fn of(names: &[&str]) -> Self {
+        Self {
+            players: names.iter().map(|n| n.to_string()).collect(),
+            format: TournamentFormat::SingleElimination,
+            max_losses: 3,
+            name: None,
+            boards: 0,
+        }
+    }
+
+    /// With `P1`..`Pn` entered.
+    pub fn numbered(players: usize) -> Self {
+        let names: Vec<String> = (1..=players).map(|i| format!("P{}", i)).collect();
+        let names: Vec<&str> = names.iter().map(String::as_str).collect();
+        Self::of(&names)
+    }
+
+    pub fn format(mut self, format: TournamentFormat) -> Self {
+        self.format = format;
+        self
+    }
+
+    pub fn max_losses(mut self, max_losses: u32) -> Self {
+        self.max_losses = max_losses;
+        self
+    }
+
+    pub fn named(mut self, name: &str) -> Self {
+        self.name = Some(name.to_string());
+        self
+    }
+
+    /// Boards named "Board 1".."Board n".
+    pub fn boards(mut self, boards: usize) -> Self {
+        self.boards = boards;
+        self
+    }
+
+    /// The tournament with everyone entered, not yet started.
+    pub fn entered(self) -> Tournament {
+        let mut t = Tournament::new(self.max_losses, TournamentMode::OneVOne);
+        t.format = self.format;
+        if let Some(name) = &self.name {
+            t.set_name(name).unwrap();
+        }
+        for name in self.players {
+            t.add_player(name).unwrap();
+        }
+        if self.boards > 0 {
+            set_boards(&mut t, &numbered_boards(self.boards)).unwrap();
+        }
+        t
+    }
+
+    /// The tournament started with the default draw.
+    pub fn started(self) -> Tournament {
+        let mut t = self.entered();
+        start_tournament(&mut t).unwrap();
+        t
+    }
+}
@@ -0,0 +1,201 @@
+//! Integration tests for cricket scoring: marks and points, closing a number mid-visit, winning
+//! a leg and a match, cut-throat, undo, and a match kept to the game it started as.
+
+use dart_tournament_web::api_error::ApiError;
+use dart_tournament_web::scoring::{CricketDart, CricketLeg, CricketMatch, ScoringError, BULL};
+use dart_tournament_web::{
+    record_cricket_visit, record_match_visit, start_tournament, undo_last_action, Team, Tournament,
+    TournamentError, TournamentFormat, TournamentMode, TournamentState,
+};
+
+fn dart(number: u32, multiplier: u32) -> CricketDart {
+    CricketDart { number, multiplier }
+}
+
+const MISS: CricketDart = CricketDart {
+    number: 0,
+    multiplier: 1,
+};
+
+/// The visits that close every number for a side in three visits, the third of two darts.
+fn close_everything() -> [Vec<CricketDart>; 3] {
+    [
+        vec![dart(20, 3), dart(19, 3), dart(18, 3)],
+        vec![dart(17, 3), dart(16, 3), dart(15, 3)],
+        vec![dart(BULL, 2), dart(BULL, 1)],
+    ]
+}
+
+#[test]
+fn marks_past_closing_score_until_the_other_side_closes_mid_visit() {
+    let mut leg = CricketLeg::new(Team::One, false);
+    // Two singles and a double: the double's second mark is past closing, so scores 19.
+    leg.record_visit(Team::One, &[dart(19, 1), dart(19, 1), dart(19, 2)])
+        .unwrap();
+    assert_eq!(leg.points.team_1, 19);
+    leg.record_visit(Team::Two, &[MISS, MISS, MISS]).unwrap();
+    leg.record_visit(Team::One, &[dart(20, 3), dart(20, 3), dart(20, 1)])
+        .unwrap();
+    assert_eq!(leg.points.team_1, 19 + 80);
+    assert_eq!(leg.visits[2].marks, 7);
+
+    // Side two closes 20 with its first two darts; the treble after them scores nothing.
+    leg.record_visit(Team::Two, &[dart(20, 1), dart(20, 2), dart(20, 3)])
+        .unwrap();
+    let visit = leg.visits.last().unwrap();
+    assert_eq!((visit.marks, visit.points), (6, 0));
+    assert_eq!(leg.points.team_2, 0);
+    leg.record_visit(Team::One, &[dart(20, 3), MISS, MISS])
+        .unwrap();
+    assert_eq!(leg.points.team_1, 99);
+
+    let grid = leg.grid();
+    assert_eq!(grid.len(), 7);
+    let twenty = grid[0];
+    assert_eq!((twenty.number, twenty.team_1, twenty.team_2), (20, 3, 3));
+    assert!(twenty.dead);
+    let nineteen = grid[1];
+    assert_eq!((nineteen.team_1, nineteen.team_2), (3, 0));
+    assert!(!nineteen.dead);
+    assert_eq!(grid[6].number, BULL);
+}
+
+#[test]
+fn a_leg_is_won_by_closing_everything_without_trailing() {
+    let mut leg = CricketLeg::new(Team::One, false);
+    // Side two goes ahead on points, so side one closing everything isn't enough at first.
+    leg.record_visit(Team::One, &[MISS, MISS, MISS]).unwrap();
+    leg.record_visit(Team::Two, &[dart(15, 3), dart(15, 3), MISS])
+        .unwrap();
+    assert_eq!(leg.points.team_2, 45);
+    for visits in close_everything().iter().take(2) {
+        leg.record_visit(Team::One, visits).unwrap();
+        leg.record_visit(Team::Two, &[MISS, MISS, MISS]).unwrap();
+    }
+    // Two darts only end a visit that wins the leg.
+    assert_eq!(
+        leg.record_visit(Team::One, &[dart(BULL, 2), dart(BULL, 1)]),
+        Err(ScoringError::InvalidDarts)
+    );
+    leg.record_visit(Team::One, &[dart(BULL, 2), dart(BULL, 1), dart(20, 1)])
+        .unwrap();
+    assert!(leg.all_closed(Team::One));
+    assert_eq!(leg.winner, None);
+    assert_eq!(leg.points.team_1, 20);
+    leg.record_visit(Team::Two, &[MISS, MISS, MISS]).unwrap();
+
+    // A treble 20 puts side one ahead and wins on that dart, so nothing can follow it.
+    assert_eq!(
+        leg.record_visit(Team::One, &[dart(20, 3), MISS]),
+        Err(ScoringError::InvalidDarts)
+    );
+    assert_eq!((leg.visits.len(), leg.points.team_1), (8, 20));
+    leg.record_visit(Team::One, &[dart(20, 3)]).unwrap();
+    assert_eq!(leg.winner, Some(Team::One));
+    assert_eq!(
+        leg.record_visit(Team::Two, &[MISS, MISS, MISS]),
+        Err(ScoringError::MatchFinished)
+    );
+
+    // Bull trebles and numbers off the board aren't darts.
+    let mut leg = CricketLeg::new(Team::One, false);
+    assert_eq!(
+        leg.record_visit(Team::One, &[dart(BULL, 3), MISS, MISS]),
+        Err(ScoringError::InvalidDart)
+    );
+    assert_eq!(
+        leg.record_visit(Team::One, &[dart(21, 1), MISS, MISS]),
+        Err(ScoringError::InvalidDart)
+    );
+}
+
+#[test]
+fn cut_throat_gives_points_to_the_side_still_open_and_the_lowest_wins() {
+    let mut leg = CricketLeg::new(Team::One, true);
+    leg.record_visit(Team::One, &[dart(20, 3), dart(20, 3), dart(19, 1)])
+        .unwrap();
+    assert_eq!((leg.points.team_1, leg.points.team_2), (0, 60));
+    leg.record_visit(Team::Two, &[MISS, MISS, MISS]).unwrap();
+    let [_, second, bull] = close_everything();
+    leg.record_visit(Team::One, &[dart(19, 2), dart(18, 3), MISS])
+        .unwrap();
+    leg.record_visit(Team::Two, &[MISS, MISS, MISS]).unwrap();
+    leg.record_visit(Team::One, &second).unwrap();
+    leg.record_visit(Team::Two, &[MISS, MISS, MISS]).unwrap();
+    // Fewer points than side two once everything is closed: side one wins.
+    leg.record_visit(Team::One, &bull).unwrap();
+    assert_eq!(leg.winner, Some(Team::One));
+
+    // Undo takes the winning visit back and counts the marks again.
+    let visit = leg.undo_visit().unwrap();
+    assert_eq!(visit.team, Team::One);
+    assert_eq!((leg.winner, leg.thrower), (None, Team::One));
+    assert_eq!(leg.marks(Team::One)[6], 0);
+    assert_eq!(leg.points.team_2, 60);
+}
+
+#[test]
+fn winning_a_cricket_bracket_match_records_the_result() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    t.add_player("A").unwrap();
+    t.add_player("B").unwrap();
+    start_tournament(&mut t).unwrap();
+    let final_id = t.bracket.as_ref().unwrap().matches[0].id;
+
+    // Best of three: side one closes everything in each leg; side two misses.
+    let misses = [MISS, MISS, MISS];
+    for leg in 0..2 {
+        if leg == 1 {
+            record_cricket_visit(&mut t, final_id, Team::Two, &misses, false).unwrap();
+        }
+        let visits = close_everything();
+        for (i, visit) in visits.iter().enumerate() {
+            record_cricket_visit(&mut t, final_id, Team::One, visit, false).unwrap();
+            if i < 2 {
+                record_cricket_visit(&mut t, final_id, Team::Two, &misses, false).unwrap();
+            }
+        }
+    }
+    let scored = &t.cricket[&final_id];
+    assert_eq!(scored.legs.len(), 2);
+    assert_eq!(scored.winner, Some(Team::One));
+    assert_eq!(t.state, TournamentState::Completed);
+    let m = &t.bracket.as_ref().unwrap().matches[0];
+    assert_eq!(m.winner, Some(Team::One));
+    assert_eq!(m.score.map(|s| (s.team_1, s.team_2)), Some((2, 0)));
+
+    // The result comes off first, then the deciding visit, reopening the second leg.
+    undo_last_action(&mut t, final_id).unwrap();
+    undo_last_action(&mut t, final_id).unwrap();
+    let scored = &t.cricket[&final_id];
+    assert_eq!(scored.winner, None);
+    assert_eq!(scored.legs_won.team_1, 1);
+    assert_eq!(scored.current_leg().thrower, Team::One);
+}
+
+#[test]
+fn a_match_keeps_the_game_it_was_first_scored_as() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    t.add_player("A").unwrap();
+    t.add_player("B").unwrap();
+    start_tournament(&mut t).unwrap();
+    let final_id = t.bracket.as_ref().unwrap().matches[0].id;
+
+    record_cricket_visit(&mut t, final_id, Team::One, &[MISS, MISS, MISS], true).unwrap();
+    assert!(t.cricket[&final_id].cut_throat);
+    let err = record_match_visit(&mut t, final_id, Team::Two, 60, 3, false, 0).unwrap_err();
+    assert_eq!(err, TournamentError::Scoring(ScoringError::WrongGameType));
+    let e = ApiError::from(err);
+    assert_eq!((e.status, e.code), (409, "game_type_mismatch"));
+
+    // With its only visit undone, the match can start again as x01.
+    undo_last_action(&mut t, final_id).unwrap();
+    record_match_visit(&mut t, final_id, Team::One, 60, 3, false, 0).unwrap();
+    assert!(!t.cricket.contains_key(&final_id));
+    assert_eq!(
+        CricketMatch::new(2, false),
+        Err(ScoringError::InvalidBestOf)
+    );
+}
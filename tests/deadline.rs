@@ -0,0 +1,102 @@
+//! Integration tests for request deadlines: work cut off when time is up, and exports and
+//! backups stopping between chunks.
+
+use dart_tournament_web::backup::Backup;
+use dart_tournament_web::deadline::{has_timeout, Deadline, Expired};
+use dart_tournament_web::export::{csv_lines, player_rows};
+use dart_tournament_web::seasons::SeasonStore;
+use dart_tournament_web::templates::TemplateStore;
+use dart_tournament_web::{Tournament, TournamentMode, TournamentRegistry};
+use std::io;
+use std::time::Duration;
+
+fn tournament(players: &[&str]) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    for name in players {
+        t.add_player(*name).unwrap();
+    }
+    t
+}
+
+#[test]
+fn a_deadline_passes_on_time_or_as_soon_as_any_clone_is_cancelled() {
+    assert_eq!(Deadline::after(Duration::ZERO).check(), Err(Expired));
+    let open = Deadline::after(Duration::from_secs(60));
+    assert!(open.check().is_ok());
+    assert!(open.remaining().unwrap() > Duration::from_secs(59));
+
+    let never = Deadline::never();
+    assert_eq!(never.remaining(), None);
+    never.clone().cancel();
+    assert_eq!(never.check(), Err(Expired));
+    assert_eq!(never.remaining(), Some(Duration::ZERO));
+}
+
+#[test]
+fn work_blocked_until_cancelled_stops_once_the_deadline_passes() {
+    // A store call stuck until it is cancelled, as a hung disk would leave it.
+    let stuck = |deadline: Deadline| {
+        std::thread::spawn(move || {
+            while deadline.check().is_ok() {
+                std::thread::sleep(Duration::from_millis(1));
+            }
+        })
+    };
+    let timed = Deadline::after(Duration::from_millis(20));
+    stuck(timed.clone()).join().unwrap();
+    assert_eq!(timed.check(), Err(Expired));
+
+    // The server giving up on a request cancels it, however long it had left.
+    let request = Deadline::after(Duration::from_secs(60));
+    let work = stuck(request.clone());
+    request.cancel();
+    work.join().unwrap();
+}
+
+#[test]
+fn a_csv_export_ends_with_a_timeout_once_its_deadline_passes() {
+    let t = tournament(&["Ann", "Bob", "Cy"]);
+    let deadline = Deadline::never();
+    let mut lines = csv_lines(player_rows([&t]), deadline.clone());
+    assert!(lines.next().unwrap().is_ok()); // the header
+    assert!(lines.next().unwrap().is_ok());
+    deadline.cancel();
+    let e = lines.next().unwrap().unwrap_err();
+    assert_eq!(e.kind(), io::ErrorKind::TimedOut);
+    assert!(lines.next().is_none());
+
+    let all: Vec<Vec<u8>> = csv_lines(player_rows([&t]), Deadline::never())
+        .collect::<io::Result<_>>()
+        .unwrap();
+    assert_eq!(all.len(), 4);
+}
+
+#[test]
+fn a_backup_is_written_as_before_unless_its_deadline_has_passed() {
+    let registry = TournamentRegistry::new();
+    registry.insert(tournament(&["Ann", "Bob"])).unwrap();
+    registry.insert(tournament(&["Cy"])).unwrap();
+    let backup = Backup::take(
+        &registry,
+        &SeasonStore::in_memory(),
+        &TemplateStore::in_memory(),
+    )
+    .unwrap();
+
+    let whole = serde_json::to_value(&backup).unwrap();
+    assert_eq!(backup.to_json(), serde_json::to_vec_pretty(&whole).unwrap());
+    let expired = Deadline::after(Duration::ZERO);
+    assert_eq!(backup.to_json_within(&expired), Err(Expired));
+}
+
+#[test]
+fn the_long_poll_and_the_restore_have_no_timeout() {
+    let id = "0b8e4530-0000-4000-8000-000000000000";
+    assert!(has_timeout(&format!("/api/tournaments/{id}")));
+    assert!(has_timeout("/api/players/export.csv"));
+    assert!(has_timeout("/api/admin/backup"));
+    assert!(!has_timeout(&format!("/api/tournaments/{id}/display")));
+    assert!(!has_timeout("/api/admin/restore"));
+    assert!(!has_timeout("/healthz"));
+    assert!(!has_timeout("/static/app.js"));
+}
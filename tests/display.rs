@@ -0,0 +1,92 @@
+//! Integration tests for the venue scoreboard projection.
+
+mod common;
+
+use common::Knockout;
+use dart_tournament_web::display::{etag, scoreboard, UPCOMING_MATCHES};
+use dart_tournament_web::scoring::{Dart, MatchFormat};
+use dart_tournament_web::{
+    record_match_visit, set_match_formats, MatchFormats, MatchId, Team, Tournament,
+};
+
+fn round_1(t: &Tournament) -> Vec<MatchId> {
+    t.bracket.as_ref().unwrap().round(1).map(|m| m.id).collect()
+}
+
+#[test]
+fn boards_show_their_match_and_the_next_ones_wait() {
+    let t = Knockout::numbered(8)
+        .named("Friday open")
+        .boards(2)
+        .started();
+    let board = scoreboard(&t);
+    assert_eq!(board.tournament_name, "Friday open");
+    assert_eq!(board.boards.len(), 2);
+    let on_boards: Vec<_> = board
+        .boards
+        .iter()
+        .map(|b| b.current.as_ref().unwrap().match_id)
+        .collect();
+    let first = board.boards[0].current.as_ref().unwrap();
+    assert_eq!(first.round_label, "Round 1");
+    assert_eq!(
+        (first.player_1.remaining, first.player_2.remaining),
+        (501, 501)
+    );
+    assert_eq!((first.player_1.legs, first.player_1.sets), (0, None));
+    assert_eq!(first.throwing, Team::One);
+    assert_eq!(first.checkout, None);
+
+    assert_eq!(board.upcoming.len(), UPCOMING_MATCHES);
+    assert!(board
+        .upcoming
+        .iter()
+        .all(|m| !on_boards.contains(&m.match_id)));
+    // The boards take the upcoming matches in the order shown.
+    let upcoming: Vec<_> = board.upcoming.iter().map(|m| m.match_id).collect();
+    assert_eq!(upcoming, round_1(&t)[2..]);
+
+    // No boards: nothing on them, and the first ready matches are up next.
+    let t = Knockout::numbered(8).named("Friday open").started();
+    let board = scoreboard(&t);
+    assert!(board.boards.is_empty());
+    let upcoming: Vec<_> = board.upcoming.iter().map(|m| m.match_id).collect();
+    assert_eq!(upcoming, round_1(&t)[..2]);
+}
+
+#[test]
+fn scores_follow_the_visits_and_the_etag_changes_with_them() {
+    let mut t = Knockout::numbered(4)
+        .named("Friday open")
+        .boards(1)
+        .started();
+    let mut formats = MatchFormats::default();
+    formats.rounds.insert(1, MatchFormat::best_of_sets(3, 3));
+    set_match_formats(&mut t, formats).unwrap();
+    let before = scoreboard(&t);
+    assert_eq!(etag(&before), etag(&scoreboard(&t)));
+
+    let id = before.boards[0].current.as_ref().unwrap().match_id;
+    for (team, score) in [(Team::One, 180), (Team::Two, 60), (Team::One, 180)] {
+        record_match_visit(&mut t, id, team, score, 3, false, 0).unwrap();
+    }
+    let after = scoreboard(&t);
+    assert_ne!(etag(&after), etag(&before));
+    let current = after.boards[0].current.as_ref().unwrap();
+    assert_eq!(
+        (current.player_1.remaining, current.player_2.remaining),
+        (141, 441)
+    );
+    assert_eq!(current.player_1.sets, Some(0));
+    // Side two throws next, above a checkout.
+    assert_eq!(current.throwing, Team::Two);
+    assert_eq!(current.checkout, None);
+
+    record_match_visit(&mut t, id, Team::Two, 60, 3, false, 0).unwrap();
+    let current = scoreboard(&t).boards[0].current.clone().unwrap();
+    assert_eq!(current.throwing, Team::One);
+    assert_eq!(
+        current.checkout,
+        Some(vec![Dart::Treble(20), Dart::Treble(19), Dart::Double(12)])
+    );
+}
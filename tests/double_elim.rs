@@ -0,0 +1,164 @@
+//! Integration tests for double-elimination brackets: routing losers, byes, and the reset.
+
+use dart_tournament_web::{
+    generate_double_elim_bracket, record_bracket_result, start_tournament, BracketMatch,
+    BracketSection, BracketSlot, Player, PlayerId, Team, Tournament, TournamentFormat,
+    TournamentMode, TournamentState,
+};
+use std::collections::HashMap;
+
+fn seeded_players(n: usize) -> Vec<Player> {
+    (0..n)
+        .map(|i| {
+            let mut p = Player::new(format!("P{}", i + 1));
+            p.seed = i as u32 + 1;
+            p
+        })
+        .collect()
+}
+
+fn started(n: usize) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::DoubleElimination;
+    for i in 0..n {
+        t.add_player(format!("P{}", i + 1)).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    t
+}
+
+fn seed(t: &Tournament, id: PlayerId) -> u32 {
+    t.find_player(id).unwrap().seed
+}
+
+fn next_match(t: &Tournament) -> Option<BracketMatch> {
+    let b = t.bracket.as_ref().unwrap();
+    b.matches.iter().find(|m| m.is_ready() && !m.bye).cloned()
+}
+
+/// Play every match, picking the winner with `pick(seed_1, seed_2) -> winning side`, and check
+/// after each result that only players with two losses are out.
+fn play_out(t: &mut Tournament, pick: impl Fn(u32, u32) -> Team) {
+    while let Some(m) = next_match(t) {
+        let side = pick(seed(t, m.team_1.unwrap()), seed(t, m.team_2.unwrap()));
+        record_bracket_result(t, m.id, m.player(side).unwrap(), None, false).unwrap();
+        for p in &t.players {
+            assert_eq!(p.eliminated, p.losses >= 2, "{} after {:?}", p.name, m.id);
+            assert!(p.losses <= 2);
+        }
+    }
+}
+
+#[test]
+fn bracket_shape_for_4_6_8_and_16_players() {
+    for n in [4, 6, 8, 16] {
+        let b = generate_double_elim_bracket(&seeded_players(n)).unwrap();
+        let size = n.next_power_of_two();
+        let count = |s| b.matches.iter().filter(|m| m.section == s).count();
+        assert_eq!(count(BracketSection::Winners), size - 1, "n={n}");
+        assert_eq!(count(BracketSection::Losers), size - 2, "n={n}");
+        assert_eq!(count(BracketSection::GrandFinal), 2, "n={n}");
+
+        // Every slot is fed by at most one match; every winners match sends its loser on.
+        let mut fed: HashMap<BracketSlot, u32> = HashMap::new();
+        for m in &b.matches {
+            for to in [m.winner_to, m.loser_to].into_iter().flatten() {
+                *fed.entry(to).or_default() += 1;
+            }
+            if m.section == BracketSection::Winners {
+                assert!(m.loser_to.is_some(), "n={n}");
+            }
+        }
+        assert!(fed.values().all(|&c| c == 1), "n={n}");
+        assert_eq!(b.final_match().unwrap().section, BracketSection::GrandFinal);
+    }
+}
+
+#[test]
+fn losers_drop_in_reversed_to_avoid_rematches() {
+    let b = generate_double_elim_bracket(&seeded_players(8)).unwrap();
+    let losers_r2: Vec<_> = b
+        .section_round(BracketSection::Losers, 2)
+        .map(|m| m.id)
+        .collect();
+    let winners_r2: Vec<_> = b.round(2).collect();
+    // Top half's second-round loser goes to the bottom losers match and vice versa.
+    assert_eq!(winners_r2[0].loser_to.unwrap().match_id, losers_r2[1]);
+    assert_eq!(winners_r2[1].loser_to.unwrap().match_id, losers_r2[0]);
+}
+
+#[test]
+fn byes_in_the_losers_bracket_pass_players_through() {
+    // 5 players in an 8 bracket: seeds 1-3 have byes, so one first-round losers match is fed
+    // only by byes and the other gets a single player.
+    let mut t = started(5);
+    play_out(&mut t, |a, b| if a < b { Team::One } else { Team::Two });
+    assert_eq!(t.state, TournamentState::Completed);
+    let b = t.bracket.as_ref().unwrap();
+    let first: Vec<_> = b.section_round(BracketSection::Losers, 1).collect();
+    assert!(first.iter().all(|m| m.bye));
+    assert!(first
+        .iter()
+        .any(|m| m.team_1.is_none() && m.team_2.is_none() && m.winner.is_none()));
+    assert!(first
+        .iter()
+        .any(|m| m.winner_id().is_some() && m.loser_id().is_none()));
+}
+
+#[test]
+fn players_are_out_only_after_two_losses() {
+    let favourites = |a: u32, b: u32| if a < b { Team::One } else { Team::Two };
+    let upsets = |a: u32, b: u32| if a > b { Team::One } else { Team::Two };
+    for n in [4, 6, 8, 16] {
+        for (name, pick) in [
+            ("favourites", &favourites as &dyn Fn(u32, u32) -> Team),
+            ("upsets", &upsets),
+        ] {
+            let mut t = started(n);
+            play_out(&mut t, pick);
+            assert_eq!(t.state, TournamentState::Completed, "n={n} {name}");
+            let champion = t.bracket.as_ref().unwrap().champion().unwrap();
+            for p in &t.players {
+                if p.id == champion {
+                    assert!(!p.eliminated && p.losses <= 1, "n={n} {name}");
+                } else {
+                    assert!(p.eliminated && p.losses == 2, "n={n} {name} {}", p.name);
+                }
+            }
+        }
+    }
+}
+
+#[test]
+fn grand_final_reset_only_when_losers_champion_wins() {
+    let mut t = started(2);
+    let wb_final = next_match(&t).unwrap();
+    let (a, b) = (wb_final.team_1.unwrap(), wb_final.team_2.unwrap());
+    record_bracket_result(&mut t, wb_final.id, a, None, false).unwrap();
+
+    let gf = next_match(&t).unwrap();
+    assert_eq!(gf.section, BracketSection::GrandFinal);
+    assert_eq!((gf.team_1, gf.team_2), (Some(a), Some(b)));
+
+    // Winners champion takes it: no reset.
+    record_bracket_result(&mut t, gf.id, a, None, false).unwrap();
+    assert_eq!(t.state, TournamentState::Completed);
+    assert_eq!(t.bracket.as_ref().unwrap().champion(), Some(a));
+
+    // Correct it to the losers champion: the reset is played between the same two.
+    record_bracket_result(&mut t, gf.id, b, None, true).unwrap();
+    assert_eq!(t.state, TournamentState::BracketPlay);
+    let reset = next_match(&t).unwrap();
+    assert_eq!(
+        (reset.section, reset.round),
+        (BracketSection::GrandFinal, 2)
+    );
+    assert_eq!((reset.team_1, reset.team_2), (Some(b), Some(a)));
+    assert!(!t.find_player(a).unwrap().eliminated);
+
+    record_bracket_result(&mut t, reset.id, b, None, false).unwrap();
+    assert_eq!(t.state, TournamentState::Completed);
+    assert_eq!(t.bracket.as_ref().unwrap().champion(), Some(b));
+    assert_eq!(t.find_player(a).unwrap().losses, 2);
+    assert!(t.find_player(a).unwrap().eliminated);
+}
@@ -0,0 +1,264 @@
+//! Integration tests for knockout draws: random, protected, reproducing a draw, and the
+//! balanced draw of a pairs night.
+
+mod common;
+
+use common::Knockout;
+use dart_tournament_web::{
+    balanced_pair_draw, carry_form, draw_order, start_tournament, start_with_draw, DrawMode,
+    DrawSettings, EntryType, PairMetric, Player, PlayerId, Tournament, TournamentError,
+    TournamentFormat, TournamentMode,
+};
+use std::collections::HashSet;
+
+fn drawn(players: usize, mode: DrawMode, protected_seeds: usize, seed: u64) -> Tournament {
+    let mut t = Knockout::numbered(players)
+        .format(TournamentFormat::SingleElimination)
+        .entered();
+    let settings = DrawSettings {
+        mode,
+        protected_seeds,
+        seed: Some(seed),
+        ..Default::default()
+    };
+    start_with_draw(&mut t, settings).unwrap();
+    t
+}
+
+fn id(t: &Tournament, name: &str) -> PlayerId {
+    t.players.iter().find(|p| p.name == name).unwrap().id
+}
+
+/// First-round players, top to bottom (None for a bye).
+fn first_round(t: &Tournament) -> Vec<Option<PlayerId>> {
+    t.bracket
+        .as_ref()
+        .unwrap()
+        .round(1)
+        .flat_map(|m| [m.team_1, m.team_2])
+        .collect()
+}
+
+#[test]
+fn protected_top_seeds_are_in_opposite_halves_for_every_shuffle() {
+    for seed in 0..200 {
+        let t = drawn(12, DrawMode::Protected, 4, seed);
+        let slots = first_round(&t);
+        let half = |name: &str| slots.iter().position(|p| *p == Some(id(&t, name))).unwrap() / 8;
+        let quarter = |name: &str| slots.iter().position(|p| *p == Some(id(&t, name))).unwrap() / 4;
+        assert_ne!(half("P1"), half("P2"), "seed {}", seed);
+        let mut quarters = vec![quarter("P1"), quarter("P2"), quarter("P3"), quarter("P4")];
+        quarters.sort();
+        assert_eq!(quarters, vec![0, 1, 2, 3], "seed {}", seed);
+        // The protected seeds still get the byes.
+        let byes: Vec<&str> = t
+            .bracket
+            .as_ref()
+            .unwrap()
+            .round(1)
+            .filter(|m| m.bye)
+            .map(|m| {
+                let p = m.team_1.or(m.team_2).unwrap();
+                t.find_player(p).unwrap().name.as_str()
+            })
+            .collect();
+        assert_eq!(byes.len(), 4);
+        assert!(byes.iter().all(|n| ["P1", "P2", "P3", "P4"].contains(n)));
+    }
+}
+
+#[test]
+fn a_random_draw_is_recorded_and_reproducible() {
+    let t = drawn(8, DrawMode::Random, 0, 7);
+    let draw = t.draw.unwrap();
+    assert_eq!((draw.mode, draw.seed), (DrawMode::Random, 7));
+
+    let again = drawn(8, DrawMode::Random, 0, 7);
+    let names = |t: &Tournament| -> Vec<String> {
+        first_round(t)
+            .into_iter()
+            .map(|p| t.find_player(p.unwrap()).unwrap().name.clone())
+            .collect()
+    };
+    assert_eq!(names(&t), names(&again));
+    // Re-running the draw from the recorded seed gives the bracket order.
+    let order = draw_order(&t.players, &draw);
+    assert_eq!(first_round(&t)[0], Some(order[0]));
+
+    let shuffled = (0..20).any(|seed| names(&drawn(8, DrawMode::Random, 0, seed)) != names(&t));
+    assert!(shuffled);
+}
+
+#[test]
+fn a_seeded_start_records_no_draw() {
+    let mut t = Knockout::numbered(6)
+        .format(TournamentFormat::DoubleElimination)
+        .entered();
+    start_with_draw(&mut t, DrawSettings::default()).unwrap();
+    assert!(t.draw.is_none());
+    let mut plain = Knockout::numbered(6)
+        .format(TournamentFormat::DoubleElimination)
+        .entered();
+    start_tournament(&mut plain).unwrap();
+    let names = |t: &Tournament| -> Vec<Option<String>> {
+        first_round(t)
+            .into_iter()
+            .map(|p| p.map(|p| t.find_player(p).unwrap().name.clone()))
+            .collect()
+    };
+    assert_eq!(names(&t), names(&plain));
+}
+
+#[test]
+fn bad_draw_settings_are_rejected() {
+    let mut t = Knockout::numbered(6)
+        .format(TournamentFormat::SingleElimination)
+        .entered();
+    let protected = |protected_seeds| DrawSettings {
+        mode: DrawMode::Protected,
+        protected_seeds,
+        seed: None,
+        ..Default::default()
+    };
+    assert_eq!(
+        start_with_draw(&mut t, protected(0)),
+        Err(TournamentError::InvalidProtectedSeeds { max: 6 })
+    );
+    assert_eq!(
+        start_with_draw(&mut t, protected(7)),
+        Err(TournamentError::InvalidProtectedSeeds { max: 6 })
+    );
+    let mut round_robin = Knockout::numbered(6)
+        .format(TournamentFormat::RoundRobin)
+        .entered();
+    assert_eq!(
+        start_with_draw(&mut round_robin, protected(2)),
+        Err(TournamentError::InvalidState)
+    );
+    assert!(t.draw.is_none() && t.bracket.is_none());
+}
+
+/// Eight people seeded in entry order, with averages 80, 75, ... 45 when `scored`.
+fn people(scored: bool) -> Vec<Player> {
+    (0..8)
+        .map(|i| {
+            let mut p = Player::new(format!("P{}", i + 1));
+            p.seed = i + 1;
+            if scored {
+                p.points_scored = 80 - 5 * i;
+                p.darts_thrown = 3;
+            }
+            p
+        })
+        .collect()
+}
+
+fn ids(players: &[Player], range: std::ops::Range<usize>) -> HashSet<PlayerId> {
+    players[range].iter().map(|p| p.id).collect()
+}
+
+#[test]
+fn a_balanced_draw_pairs_every_strong_player_with_a_weak_one() {
+    // Entered weakest first, so the ranking has to come from the averages.
+    let mut players = people(true);
+    players.reverse();
+    let (strong, weak) = (ids(&players, 4..8), ids(&players, 0..4));
+    let pairs = balanced_pair_draw(&players, PairMetric::Average, 42).unwrap();
+    assert_eq!(pairs.len(), 4);
+    for [a, b] in &pairs {
+        assert!(strong.contains(a) && weak.contains(b));
+    }
+    // Strongest first, in ranking order.
+    let leads: Vec<PlayerId> = pairs.iter().map(|[a, _]| *a).collect();
+    let ranked: Vec<PlayerId> = players.iter().rev().take(4).map(|p| p.id).collect();
+    assert_eq!(leads, ranked);
+
+    // The same seed always gives the same teams; another seed can give others.
+    assert_eq!(
+        balanced_pair_draw(&players, PairMetric::Average, 42),
+        Ok(pairs.clone())
+    );
+    assert!((0..20)
+        .any(|seed| balanced_pair_draw(&players, PairMetric::Average, seed) != Ok(pairs.clone())));
+
+    // Nothing recorded: seed order decides the halves.
+    let unknown = people(false);
+    let pairs = balanced_pair_draw(&unknown, PairMetric::Rating, 7).unwrap();
+    let top = ids(&unknown, 0..4);
+    assert!(pairs
+        .iter()
+        .all(|[a, b]| top.contains(a) && !top.contains(b)));
+    assert_eq!(
+        balanced_pair_draw(&unknown[..7], PairMetric::Average, 7),
+        Err(TournamentError::OddPlayerCount)
+    );
+}
+
+/// A pairs knockout with a balanced draw and P1 to P`people` entered.
+fn pairs_night(people: usize) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    t.set_entry_type(EntryType::Pairs).unwrap();
+    t.set_draw_mode(DrawMode::Balanced).unwrap();
+    for i in 0..people {
+        t.add_player(format!("P{}", i + 1)).unwrap();
+    }
+    t
+}
+
+#[test]
+fn a_pairs_night_is_drawn_into_teams_from_earlier_form() {
+    let mut last_week = Tournament::new(3, TournamentMode::OneVOne);
+    last_week.players = people(true);
+    // This week they're entered in the opposite order to their form.
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    t.set_entry_type(EntryType::Pairs).unwrap();
+    t.set_draw_mode(DrawMode::Balanced).unwrap();
+    for i in (0..8).rev() {
+        t.add_player(format!("P{}", i + 1)).unwrap();
+    }
+    assert_eq!(
+        t.add_pair("Team", &["A".to_string(), "B".to_string()]),
+        Err(TournamentError::WrongEntryType)
+    );
+    carry_form(&mut t, &[last_week]);
+    let settings = DrawSettings {
+        mode: DrawMode::Balanced,
+        seed: Some(3),
+        ..Default::default()
+    };
+    let mut again = t.clone();
+    start_with_draw(&mut t, settings).unwrap();
+
+    assert_eq!(t.players.len(), 4);
+    let strong = ["P1", "P2", "P3", "P4"];
+    for team in &t.players {
+        assert_eq!(team.name, team.members.join(" & "));
+        let first = strong.contains(&team.members[0].as_str());
+        let second = strong.contains(&team.members[1].as_str());
+        assert!(first && !second, "{}", team.name);
+    }
+    let draw = t.draw.unwrap();
+    assert_eq!(
+        (draw.mode, draw.balance_by, draw.seed),
+        (DrawMode::Balanced, Some(PairMetric::Average), 3)
+    );
+    start_with_draw(&mut again, settings).unwrap();
+    let names =
+        |t: &Tournament| -> Vec<String> { t.players.iter().map(|p| p.name.clone()).collect() };
+    assert_eq!(names(&again), names(&t));
+
+    // Someone left over: nothing is drawn.
+    let mut odd = pairs_night(7);
+    assert_eq!(
+        start_with_draw(&mut odd, settings),
+        Err(TournamentError::OddPlayerCount)
+    );
+    assert_eq!((odd.players.len(), odd.draw), (7, None));
+    // The draw decides what is entered, so it is chosen before anyone is.
+    assert_eq!(
+        odd.set_draw_mode(DrawMode::Seeded),
+        Err(TournamentError::InvalidState)
+    );
+}
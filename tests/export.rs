@@ -0,0 +1,76 @@
+//! Integration tests for CSV/JSON exports: escaping, match rows, and player totals.
+
+mod common;
+
+use common::Knockout;
+use dart_tournament_web::export::{csv_record, match_rows, player_rows, CsvRow, MatchRow};
+use dart_tournament_web::{record_bracket_result, LegScore, Tournament, TournamentMode};
+
+fn record(fields: &[&str]) -> String {
+    String::from_utf8(csv_record(fields).unwrap()).unwrap()
+}
+
+#[test]
+fn csv_quotes_commas_quotes_and_line_breaks() {
+    assert_eq!(record(&["plain", "a,b"]), "plain,\"a,b\"\n");
+    assert_eq!(record(&["The \"Power\"", "x"]), "\"The \"\"Power\"\"\",x\n");
+    assert_eq!(record(&["two\nlines", ""]), "\"two\nlines\",\n");
+}
+
+#[test]
+fn match_rows_list_decided_matches_with_names_and_legs() {
+    let mut t = Knockout::of(&["Smith, John", "Ann"]).started();
+    let m = t.bracket.as_ref().unwrap().matches[0].clone();
+    assert!(match_rows(&t).is_empty());
+
+    let winner = m.team_2.unwrap();
+    let score = LegScore {
+        team_1: 1,
+        team_2: 3,
+    };
+    record_bracket_result(&mut t, m.id, winner, Some(score), false).unwrap();
+    let rows = match_rows(&t);
+    assert_eq!(rows.len(), 1);
+    let row = &rows[0];
+    assert_eq!(row.round, "Round 1");
+    assert_eq!(row.winner, row.player_b);
+    assert_eq!(row.legs.as_deref(), Some("1-3"));
+    let line = String::from_utf8(csv_record(row.fields()).unwrap()).unwrap();
+    assert!(line.contains("\"Smith, John\""), "{line}");
+}
+
+#[test]
+fn match_rows_skip_byes() {
+    let t = Knockout::of(&["A", "B", "C"]).started();
+    // The top seed's bye is decided but was never played.
+    assert!(t.bracket.as_ref().unwrap().matches.iter().any(|m| m.bye));
+    assert!(match_rows(&t).is_empty());
+    assert_eq!(MatchRow::HEADER.len(), 5);
+}
+
+#[test]
+fn player_rows_total_same_names_across_tournaments() {
+    let mut a = Tournament::new(3, TournamentMode::OneVOne);
+    a.add_player("Ann").unwrap();
+    a.add_player("bob").unwrap();
+    (a.players[0].wins, a.players[0].times_sat_out) = (2, 1);
+    a.players[0].record_visit_stats(180, 3);
+    let mut b = Tournament::new(3, TournamentMode::OneVOne);
+    b.add_player("ann").unwrap();
+    (b.players[0].wins, b.players[0].losses) = (1, 1);
+
+    let rows = player_rows([&a, &b]);
+    assert_eq!(rows.len(), 2);
+    assert_eq!(rows[0].name, "Ann");
+    assert_eq!(
+        (
+            rows[0].total_wins,
+            rows[0].total_losses,
+            rows[0].total_sat_out
+        ),
+        (3, 1, 1)
+    );
+    assert_eq!(rows[0].count_180s, 1);
+    assert_eq!(rows[0].fields()[4], "75.00");
+    assert_eq!(rows[1].name, "bob");
+}
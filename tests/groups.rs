@@ -0,0 +1,164 @@
+//! Integration tests for groups then knockout: the draw, advancing, and the knockout.
+
+use dart_tournament_web::export::match_rows;
+use dart_tournament_web::{
+    advance_to_knockout, group_standings, record_bracket_result, start_groups_knockout,
+    start_tournament, undo_last_action, GroupSettings, MatchId, PlayerId, Tournament,
+    TournamentError, TournamentFormat, TournamentMode, TournamentState,
+};
+
+fn tournament(players: usize) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::GroupsKnockout;
+    for i in 0..players {
+        t.add_player(format!("P{}", i + 1)).unwrap();
+    }
+    t
+}
+
+fn id(t: &Tournament, name: &str) -> PlayerId {
+    t.players.iter().find(|p| p.name == name).unwrap().id
+}
+
+/// Play every open match, the better seed winning.
+fn play_all(t: &mut Tournament) {
+    let open: Vec<MatchId> = t
+        .bracket
+        .as_ref()
+        .unwrap()
+        .matches
+        .iter()
+        .filter(|m| m.is_ready() && !m.bye && m.winner.is_none())
+        .map(|m| m.id)
+        .collect();
+    for m in open {
+        let m = t.bracket.as_ref().unwrap().get(m).unwrap().clone();
+        let seed = |p: PlayerId| t.find_player(p).unwrap().seed;
+        let (a, b) = (m.team_1.unwrap(), m.team_2.unwrap());
+        let winner = if seed(a) < seed(b) { a } else { b };
+        record_bracket_result(t, m.id, winner, None, false).unwrap();
+    }
+}
+
+#[test]
+fn uneven_groups_are_drawn_in_snake_order_by_seed() {
+    let mut t = tournament(7);
+    let settings = GroupSettings {
+        group_count: 2,
+        advance_per_group: 2,
+    };
+    start_groups_knockout(&mut t, settings).unwrap();
+    let stage = t.group_stage.as_ref().unwrap();
+    let names = |i: usize| -> Vec<&str> {
+        stage.groups[i]
+            .players
+            .iter()
+            .map(|p| t.find_player(*p).unwrap().name.as_str())
+            .collect()
+    };
+    assert_eq!(stage.groups[0].name, "A");
+    assert_eq!(names(0), vec!["P1", "P4", "P5"]);
+    assert_eq!(names(1), vec!["P2", "P3", "P6", "P7"]);
+
+    // 3 + 6 group matches; the odd group's sit-outs are byes in the bracket.
+    let matches = &t.bracket.as_ref().unwrap().matches;
+    assert_eq!(matches.iter().filter(|m| !m.bye).count(), 9);
+    assert_eq!(matches.iter().filter(|m| m.bye).count(), 3);
+    assert_eq!(t.state, TournamentState::BracketPlay);
+}
+
+#[test]
+fn bad_group_settings_are_rejected() {
+    let mut t = tournament(6);
+    let settings = |group_count, advance_per_group| GroupSettings {
+        group_count,
+        advance_per_group,
+    };
+    assert_eq!(
+        start_groups_knockout(&mut t, settings(4, 1)),
+        Err(TournamentError::InvalidGroupCount { max: 3 })
+    );
+    assert_eq!(
+        start_groups_knockout(&mut t, settings(2, 4)),
+        Err(TournamentError::InvalidAdvanceCount { max: 3 })
+    );
+    assert_eq!(
+        start_tournament(&mut tournament(3)),
+        Err(TournamentError::NotEnoughPlayersToStart { required: 4 })
+    );
+    assert!(t.group_stage.is_none());
+}
+
+#[test]
+fn the_knockout_waits_for_every_group_match() {
+    let mut t = tournament(8);
+    start_tournament(&mut t).unwrap();
+    let first = t.bracket.as_ref().unwrap().matches[0].clone();
+    record_bracket_result(&mut t, first.id, first.team_1.unwrap(), None, false).unwrap();
+    assert_eq!(
+        advance_to_knockout(&mut t),
+        Err(TournamentError::IncompleteResults)
+    );
+
+    play_all(&mut t);
+    // Every group match has a result, but the tournament isn't over.
+    assert_eq!(t.state, TournamentState::BracketPlay);
+    assert!(t.players.iter().all(|p| !p.eliminated));
+    advance_to_knockout(&mut t).unwrap();
+    assert_eq!(
+        advance_to_knockout(&mut t),
+        Err(TournamentError::InvalidState)
+    );
+}
+
+#[test]
+fn group_winners_meet_runners_up_from_other_groups() {
+    let mut t = tournament(8);
+    start_tournament(&mut t).unwrap();
+    play_all(&mut t);
+    let groups = group_standings(&t).unwrap();
+    let top = |g: usize, rank: usize| groups[g].1[rank].player;
+    let (a1, a2, b1, b2) = (top(0, 0), top(0, 1), top(1, 0), top(1, 1));
+    assert_eq!((a1, b1), (id(&t, "P1"), id(&t, "P2")));
+
+    advance_to_knockout(&mut t).unwrap();
+    let bracket = t.bracket.as_ref().unwrap();
+    let first: Vec<(PlayerId, PlayerId)> = bracket
+        .round(1)
+        .map(|m| (m.team_1.unwrap(), m.team_2.unwrap()))
+        .collect();
+    assert_eq!(first, vec![(a1, b2), (b1, a2)]);
+    let eliminated = t.players.iter().filter(|p| p.eliminated).count();
+    assert_eq!(eliminated, 4);
+
+    // Group matches are locked once the knockout is drawn, and still exported.
+    let group_match = t.group_stage.as_ref().unwrap().matches[0].id;
+    assert_eq!(
+        undo_last_action(&mut t, group_match),
+        Err(TournamentError::NextMatchAlreadyPlayed)
+    );
+    assert!(match_rows(&t)[0].round.starts_with("Group A round 1"));
+}
+
+#[test]
+fn one_knockout_loss_eliminates_and_undo_brings_the_player_back() {
+    let mut t = tournament(8);
+    start_tournament(&mut t).unwrap();
+    play_all(&mut t);
+    advance_to_knockout(&mut t).unwrap();
+
+    let semi = t.bracket.as_ref().unwrap().matches[0].clone();
+    let (winner, loser) = (semi.team_1.unwrap(), semi.team_2.unwrap());
+    // The runner-up already lost in the group stage; that doesn't count towards elimination.
+    assert!(t.find_player(loser).unwrap().losses > 0);
+    record_bracket_result(&mut t, semi.id, winner, None, false).unwrap();
+    assert!(t.find_player(loser).unwrap().eliminated);
+
+    undo_last_action(&mut t, semi.id).unwrap();
+    assert!(!t.find_player(loser).unwrap().eliminated);
+
+    play_all(&mut t);
+    play_all(&mut t);
+    assert_eq!(t.state, TournamentState::Completed);
+    assert_eq!(t.bracket.as_ref().unwrap().champion(), Some(id(&t, "P1")));
+}
@@ -0,0 +1,207 @@
+//! Integration tests for handicaps: uneven start scores, legs of head start, and handicapped
+//! matches kept out of averages and ratings.
+
+mod common;
+
+use common::Knockout;
+use dart_tournament_web::handicap::{auto_handicap, played_with_handicap, set_handicap};
+use dart_tournament_web::history::{match_history, MatchQuery};
+use dart_tournament_web::scoring::{MatchFormat, ScoringError, VisitOutcome, X01Match};
+use dart_tournament_web::validation::Validate;
+use dart_tournament_web::{
+    record_bracket_result, record_match_visit, start_tournament, Handicap, MatchId, Player,
+    PlayerId, Team, Tournament, DEFAULT_RATING, MAX_HANDICAP_POINTS,
+};
+
+fn points(points: u32) -> Handicap {
+    Handicap { points, legs: 0 }
+}
+
+#[test]
+fn a_handicapped_side_counts_down_from_its_own_start_under_the_usual_bust_rules() {
+    let format = MatchFormat::best_of_legs(3);
+    let mut m = X01Match::with_handicaps(format, 501, [Handicap::default(), points(64)]).unwrap();
+    assert!(m.is_handicapped());
+    assert_eq!((m.start_for(Team::One), m.start_for(Team::Two)), (501, 437));
+    let leg = m.current_leg();
+    assert_eq!(
+        (leg.remaining(Team::One), leg.remaining(Team::Two)),
+        (501, 437)
+    );
+
+    let visit = |m: &mut X01Match, team, score, double_out| {
+        m.record_visit(team, score, 3, double_out).unwrap()
+    };
+    assert_eq!(visit(&mut m, Team::One, 60, false), VisitOutcome::Scored);
+    assert_eq!(visit(&mut m, Team::Two, 180, false), VisitOutcome::Scored);
+    assert_eq!(visit(&mut m, Team::One, 60, false), VisitOutcome::Scored);
+    assert_eq!(visit(&mut m, Team::Two, 180, false), VisitOutcome::Scored);
+    // 77 left: over it, onto 1, or onto zero without a double all bust.
+    assert_eq!(visit(&mut m, Team::One, 60, false), VisitOutcome::Scored);
+    assert_eq!(visit(&mut m, Team::Two, 78, false), VisitOutcome::Bust);
+    assert_eq!(visit(&mut m, Team::One, 60, false), VisitOutcome::Scored);
+    assert_eq!(visit(&mut m, Team::Two, 76, false), VisitOutcome::Bust);
+    assert_eq!(visit(&mut m, Team::One, 60, false), VisitOutcome::Scored);
+    assert_eq!(visit(&mut m, Team::Two, 77, false), VisitOutcome::Bust);
+    assert_eq!(m.current_leg().remaining(Team::Two), 77);
+    assert_eq!(visit(&mut m, Team::One, 60, false), VisitOutcome::Scored);
+    assert_eq!(visit(&mut m, Team::Two, 77, true), VisitOutcome::Checkout);
+
+    // The next leg starts both sides on their own scores again.
+    assert_eq!(m.legs_won.team_2, 1);
+    let leg = m.current_leg();
+    assert_eq!(
+        (leg.remaining(Team::One), leg.remaining(Team::Two)),
+        (501, 437)
+    );
+    // Undoing the checkout reopens the leg where it was.
+    m.undo_visit().unwrap();
+    assert_eq!(m.current_leg().remaining(Team::Two), 77);
+    assert_eq!(m.legs_won.team_2, 0);
+
+    assert_eq!(
+        X01Match::with_handicaps(format, 101, [points(100), Handicap::default()]),
+        Err(ScoringError::InvalidHandicap)
+    );
+}
+
+#[test]
+fn legs_of_head_start_stop_one_short_of_winning() {
+    let head_start = Handicap { points: 0, legs: 5 };
+    let mut m = X01Match::with_handicaps(
+        MatchFormat::best_of_legs(5),
+        101,
+        [head_start, Handicap::default()],
+    )
+    .unwrap();
+    assert_eq!((m.legs_won.team_1, m.legs_won.team_2), (2, 0));
+    assert_eq!(m.winner, None);
+    m.record_visit(Team::One, 101, 3, true).unwrap();
+    assert_eq!(m.winner, Some(Team::One));
+    m.undo_visit().unwrap();
+    assert_eq!((m.legs_won.team_1, m.winner), (2, None));
+
+    // In sets play a set starts with the head start each time.
+    let mut sets = X01Match::with_handicaps(
+        MatchFormat::best_of_sets(3, 3),
+        101,
+        [Handicap { points: 0, legs: 1 }, Handicap::default()],
+    )
+    .unwrap();
+    sets.record_visit(Team::One, 101, 3, true).unwrap();
+    assert_eq!((sets.sets_won.team_1, sets.legs_won.team_1), (1, 1));
+}
+
+fn player<'a>(t: &'a Tournament, name: &str) -> &'a Player {
+    t.all_players()
+        .into_iter()
+        .find(|p| p.name == name)
+        .unwrap()
+}
+
+fn match_of(t: &Tournament, a: PlayerId, b: PlayerId) -> MatchId {
+    t.bracket
+        .as_ref()
+        .unwrap()
+        .matches
+        .iter()
+        .find(|m| m.side_of(a).is_some() && m.side_of(b).is_some())
+        .unwrap()
+        .id
+}
+
+#[test]
+fn handicapped_matches_count_for_neither_averages_nor_ratings() {
+    let mut t = Knockout::of(&["Ace", "Novice", "Cy", "Di"]).entered();
+    assert!(set_handicap(&mut t, "novice", points(200)));
+    assert!(!set_handicap(&mut t, "novice", points(200)));
+    start_tournament(&mut t).unwrap();
+    let (ace, novice) = (player(&t, "Ace").id, player(&t, "Novice").id);
+    let (cy, di) = (player(&t, "Cy").id, player(&t, "Di").id);
+
+    // Scored, Novice starts every leg on 301 and Cy on 501; neither is credited the visits.
+    let handicapped = match_of(&t, novice, cy);
+    let side = t
+        .bracket
+        .as_ref()
+        .unwrap()
+        .get(handicapped)
+        .unwrap()
+        .side_of(novice)
+        .unwrap();
+    let visit = |t: &mut Tournament, team: Team, score, double_out| {
+        record_match_visit(t, handicapped, team, score, 3, double_out, 0).unwrap()
+    };
+    for _ in 0..2 {
+        visit(&mut t, Team::One, 100, false);
+        visit(&mut t, Team::Two, 100, false);
+    }
+    let leg = t.scores[&handicapped].current_leg();
+    assert_eq!(
+        (leg.remaining(side), leg.remaining(side.other())),
+        (101, 301)
+    );
+    assert!(played_with_handicap(&t, handicapped));
+    let p = player(&t, "Novice");
+    assert_eq!((p.points_scored, p.darts_thrown), (0, 0));
+
+    // Decided by hand, it still isn't rated; a level match between the other two is.
+    record_bracket_result(&mut t, handicapped, novice, None, false).unwrap();
+    let level = match_of(&t, ace, di);
+    assert!(!played_with_handicap(&t, level));
+    record_bracket_result(&mut t, level, ace, None, false).unwrap();
+    assert_eq!(player(&t, "Novice").rating, DEFAULT_RATING);
+    assert_eq!(player(&t, "Cy").rating, DEFAULT_RATING);
+    assert!(player(&t, "Ace").rating > DEFAULT_RATING);
+
+    let page = match_history([&t], &MatchQuery::default());
+    let flagged = |id| {
+        page.matches
+            .iter()
+            .find(|m| m.match_id == id)
+            .unwrap()
+            .handicapped
+    };
+    assert!(flagged(handicapped));
+    assert!(!flagged(level));
+}
+
+#[test]
+fn suggestions_level_averages_against_the_best_player() {
+    let with_average = |name: &str, points_scored, darts_thrown| {
+        let mut p = Player::new(name);
+        p.points_scored = points_scored;
+        p.darts_thrown = darts_thrown;
+        p
+    };
+    let players = [
+        with_average("County", 900, 30),   // 90 average
+        with_average("Club", 600, 30),     // 60 average: 501 × (1 − 60/90) = 167 → 160
+        with_average("Beginner", 150, 30), // 15 average: 417.5, capped
+        Player::new("New"),
+    ];
+    let suggestions = auto_handicap(&players);
+    let suggested: Vec<(&str, u32, Option<f64>)> = suggestions
+        .iter()
+        .map(|s| (s.player.as_str(), s.handicap.points, s.three_dart_average))
+        .collect();
+    assert_eq!(
+        suggested,
+        [
+            ("County", 0, Some(90.0)),
+            ("Club", 160, Some(60.0)),
+            ("Beginner", MAX_HANDICAP_POINTS, Some(15.0)),
+            ("New", 0, None),
+        ]
+    );
+
+    assert!(points(MAX_HANDICAP_POINTS).validate().is_ok());
+    let e = Handicap {
+        points: MAX_HANDICAP_POINTS + 1,
+        legs: 6,
+    }
+    .validate()
+    .unwrap_err();
+    let fields: Vec<&str> = e.0.iter().map(|f| f.field.as_str()).collect();
+    assert_eq!(fields, ["points", "legs"]);
+}
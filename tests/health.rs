@@ -0,0 +1,114 @@
+//! Integration tests for the readiness report, with stores that fail.
+
+use dart_tournament_web::health::{readiness, CheckStatus, HealthReport, Startup};
+use dart_tournament_web::{
+    FileStore, Tournament, TournamentId, TournamentRegistry, TournamentStore,
+};
+use std::io;
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::Arc;
+
+/// Store that loads nothing and whose check fails while `down` is set.
+struct StubStore {
+    down: Arc<AtomicBool>,
+    load_fails: bool,
+}
+
+impl TournamentStore for StubStore {
+    fn save(&self, _: &Tournament) -> io::Result<()> {
+        Ok(())
+    }
+
+    fn delete(&self, _: TournamentId) -> io::Result<()> {
+        Ok(())
+    }
+
+    fn load_all(&self) -> io::Result<Vec<Tournament>> {
+        if self.load_fails {
+            return Err(io::Error::other("connection refused"));
+        }
+        Ok(Vec::new())
+    }
+
+    fn check(&self) -> io::Result<()> {
+        if self.down.load(Ordering::SeqCst) {
+            return Err(io::Error::other("disk gone"));
+        }
+        Ok(())
+    }
+}
+
+fn stub(load_fails: bool) -> (Box<StubStore>, Arc<AtomicBool>) {
+    let down = Arc::new(AtomicBool::new(false));
+    let store = StubStore {
+        down: down.clone(),
+        load_fails,
+    };
+    (Box::new(store), down)
+}
+
+fn report(registry: &TournamentRegistry, startup: &Startup) -> HealthReport {
+    readiness(registry.check_store().as_ref(), startup)
+}
+
+#[test]
+fn memory_only_server_is_ready_with_checks_disabled() {
+    let r = report(&TournamentRegistry::new(), &Startup::default());
+    assert!(r.is_ok());
+    assert_eq!(
+        serde_json::to_value(&r).unwrap(),
+        serde_json::json!({
+            "status": "ok",
+            "checks": { "snapshot": "disabled", "store": "disabled" }
+        })
+    );
+    assert!(HealthReport::live().is_ok());
+}
+
+#[test]
+fn store_that_stops_taking_writes_makes_the_server_not_ready() {
+    let (store, down) = stub(false);
+    let registry = TournamentRegistry::with_store(store).unwrap();
+    let startup = Startup {
+        snapshot_loaded: Some(true),
+        ..Startup::default()
+    };
+    assert!(report(&registry, &startup).is_ok());
+
+    down.store(true, Ordering::SeqCst);
+    let r = report(&registry, &startup);
+    assert_eq!(r.status, CheckStatus::Error);
+    assert_eq!(r.checks["store"], CheckStatus::Error);
+    assert_eq!(r.checks["snapshot"], CheckStatus::Ok);
+
+    down.store(false, Ordering::SeqCst);
+    assert!(report(&registry, &startup).is_ok());
+}
+
+#[test]
+fn failed_loads_at_startup_are_reported_not_fatal() {
+    let (store, _) = stub(true);
+    assert!(TournamentRegistry::with_store(store).is_err());
+
+    // The server falls back to memory; readiness keeps reporting the failed load.
+    let startup = Startup {
+        store_failed: true,
+        snapshot_loaded: Some(false),
+    };
+    let r = report(&TournamentRegistry::new(), &startup);
+    assert!(!r.is_ok());
+    assert_eq!(r.checks["store"], CheckStatus::Error);
+    assert_eq!(r.checks["snapshot"], CheckStatus::Error);
+}
+
+#[test]
+fn file_store_check_fails_once_its_directory_is_gone() {
+    let dir = std::env::temp_dir().join(format!("dart-health-{}", uuid::Uuid::new_v4()));
+    let registry =
+        TournamentRegistry::with_store(Box::new(FileStore::open(&dir).unwrap())).unwrap();
+    assert!(matches!(registry.check_store(), Some(Ok(()))));
+    assert!(registry.list().unwrap().is_empty());
+
+    std::fs::remove_dir_all(&dir).unwrap();
+    assert!(matches!(registry.check_store(), Some(Err(_))));
+}
@@ -0,0 +1,200 @@
+//! Integration tests for the match history and head-to-head queries.
+
+mod common;
+
+use chrono::{DateTime, Duration, NaiveDate, TimeZone, Utc};
+use common::Knockout;
+use dart_tournament_web::history::{head_to_head, match_history, MatchQuery};
+use dart_tournament_web::{
+    record_bracket_result, record_walkover, start_match, LegScore, MatchId, PlayerId, ResultType,
+    Tournament,
+};
+
+fn player(t: &Tournament, name: &str) -> PlayerId {
+    t.players.iter().find(|p| p.name == name).unwrap().id
+}
+
+fn match_of(t: &Tournament, a: &str, b: &str) -> MatchId {
+    let (a, b) = (player(t, a), player(t, b));
+    t.bracket
+        .as_ref()
+        .unwrap()
+        .matches
+        .iter()
+        .find(|m| m.side_of(a).is_some() && m.side_of(b).is_some())
+        .unwrap()
+        .id
+}
+
+/// `winner` beats `loser` by `legs` (winner's first), with the result timed at `at`.
+fn play(t: &mut Tournament, winner: &str, loser: &str, legs: (u32, u32), at: DateTime<Utc>) {
+    let id = match_of(t, winner, loser);
+    let w = player(t, winner);
+    let m = t.bracket.as_ref().unwrap().get(id).unwrap();
+    let score = if m.team_1 == Some(w) {
+        LegScore {
+            team_1: legs.0,
+            team_2: legs.1,
+        }
+    } else {
+        LegScore {
+            team_1: legs.1,
+            team_2: legs.0,
+        }
+    };
+    record_bracket_result(t, id, w, Some(score), false).unwrap();
+    t.bracket
+        .as_mut()
+        .unwrap()
+        .get_mut(id)
+        .unwrap()
+        .completed_at = Some(at);
+}
+
+fn day(d: u32) -> DateTime<Utc> {
+    Utc.with_ymd_and_hms(2024, 5, d, 20, 0, 0).unwrap()
+}
+
+#[test]
+fn head_to_head_adds_up_meetings_across_tournaments() {
+    let mut week_1 = Knockout::of(&["Anna", "Ben"]).named("Week 1").started();
+    play(&mut week_1, "Anna", "Ben", (2, 1), day(1));
+    let mut week_2 = Knockout::of(&["Ben", "Anna"]).named("Week 2").started();
+    play(&mut week_2, "Ben", "Anna", (2, 0), day(8));
+    let mut week_3 = Knockout::of(&["anna", "Ben", "Cara", "Dan"])
+        .named("Week 3")
+        .started();
+    play(&mut week_3, "anna", "Dan", (2, 0), day(15));
+    play(&mut week_3, "Ben", "Cara", (2, 1), day(15));
+    play(
+        &mut week_3,
+        "anna",
+        "Ben",
+        (2, 1),
+        day(15) + Duration::hours(1),
+    );
+    // A walkover is a meeting on record, but not a result over the board.
+    let mut week_4 = Knockout::of(&["Anna", "Ben"]).named("Week 4").started();
+    let id = match_of(&week_4, "Anna", "Ben");
+    let ben = player(&week_4, "Ben");
+    record_walkover(&mut week_4, id, ben).unwrap();
+    let strangers = Knockout::of(&["Anna", "Eve"]).named("Other club").started();
+
+    let all = [&week_1, &week_2, &week_3, &week_4, &strangers];
+    let record = head_to_head(all, "ANNA", "ben");
+    let events: Vec<&str> = record
+        .meetings
+        .iter()
+        .map(|m| m.tournament_name.as_str())
+        .collect();
+    assert_eq!(events, ["Week 4", "Week 3", "Week 2", "Week 1"]);
+    assert_eq!(record.meetings[0].result_type, ResultType::Walkover);
+    // Named as in the newest meeting.
+    assert_eq!(
+        (record.player.as_str(), record.opponent.as_str()),
+        ("Anna", "Ben")
+    );
+    assert_eq!(record.played, 3);
+    assert_eq!((record.player_wins, record.opponent_wins), (2, 1));
+    assert_eq!((record.player_legs, record.opponent_legs), (4, 4));
+
+    // The other way round, the same record from Ben's side.
+    let reversed = head_to_head(all, "Ben", "Anna");
+    assert_eq!((reversed.player_wins, reversed.opponent_wins), (1, 2));
+    assert_eq!(reversed.meetings, record.meetings);
+
+    let never_met = head_to_head(all, "Cara", "Eve");
+    assert_eq!((never_met.played, never_met.meetings.len()), (0, 0));
+    assert_eq!(never_met.player, "Cara");
+}
+
+#[test]
+fn history_filters_and_pages_in_a_stable_order() {
+    let mut t = Knockout::of(&["Anna", "Ben", "Cara", "Dan"])
+        .named("Week 1")
+        .boards(2)
+        .started();
+    let other = Knockout::of(&["Anna", "Eve"]).named("Week 2").started();
+    let first = match_of(&t, "Anna", "Dan");
+    start_match(&mut t, first).unwrap();
+    let started = t.bracket.as_ref().unwrap().get(first).unwrap().started_at;
+    play(&mut t, "Anna", "Dan", (2, 1), day(1));
+    play(&mut t, "Cara", "Ben", (2, 0), day(2));
+    let all = [&t, &other];
+
+    let page = match_history(all, &MatchQuery::default());
+    assert_eq!(page.total, 4);
+    let order: Vec<(&str, &str)> = page
+        .matches
+        .iter()
+        .map(|m| (m.player_1.as_str(), m.player_2.as_str()))
+        .collect();
+    // Undecided first (by match id), then newest result first.
+    assert_eq!(order[2..], [("Ben", "Cara"), ("Anna", "Dan")]);
+    assert!(page.matches[..2].iter().all(|m| m.winner.is_none()));
+    assert!(page.matches[0].match_id < page.matches[1].match_id);
+
+    let played = &page.matches[3];
+    assert_eq!(played.round_label, "Round 1");
+    assert_eq!(played.winner.as_deref(), Some("Anna"));
+    assert_eq!(played.score.map(|s| s.team_1 + s.team_2), Some(3));
+    assert_eq!(played.board.as_deref(), Some("Board 1"));
+    assert_eq!(played.started_at, started);
+    assert_eq!(
+        played.duration_secs,
+        started.map(|s| (day(1) - s).num_seconds())
+    );
+
+    let query = |q: MatchQuery| match_history(all, &q);
+    let names = |q: MatchQuery| -> Vec<String> {
+        query(q)
+            .matches
+            .into_iter()
+            .map(|m| format!("{} v {}", m.player_1, m.player_2))
+            .collect()
+    };
+    assert_eq!(
+        names(MatchQuery {
+            player: Some(" anna ".to_string()),
+            completed: Some(true),
+            ..MatchQuery::default()
+        }),
+        ["Anna v Dan"]
+    );
+    assert_eq!(
+        query(MatchQuery {
+            tournament_id: Some(t.id),
+            round: Some(2),
+            ..MatchQuery::default()
+        })
+        .total,
+        1
+    );
+    assert_eq!(
+        names(MatchQuery {
+            from: NaiveDate::from_ymd_opt(2024, 5, 2),
+            to: NaiveDate::from_ymd_opt(2024, 5, 2),
+            completed: Some(true),
+            ..MatchQuery::default()
+        }),
+        ["Ben v Cara"]
+    );
+
+    // Walking the pages one at a time gives the same matches as one page.
+    let mut walked = Vec::new();
+    for offset in 0..5 {
+        let page = query(MatchQuery {
+            limit: Some(1),
+            offset: Some(offset),
+            ..MatchQuery::default()
+        });
+        assert_eq!((page.total, page.limit, page.offset), (4, 1, offset));
+        walked.extend(page.matches);
+    }
+    assert_eq!(walked, page.matches);
+    let capped = query(MatchQuery {
+        limit: Some(10_000),
+        ..MatchQuery::default()
+    });
+    assert_eq!(capped.limit, 200);
+}
@@ -0,0 +1,168 @@
+//! Integration tests for idempotency keys: replays, reused keys, and racing retries.
+
+use chrono::{Duration, Utc};
+use dart_tournament_web::idempotency::{
+    fingerprint, Claim, FileIdempotencyStore, Idempotency, IdempotencyError, StoredResponse,
+    MAX_IDEMPOTENCY_KEY_LEN,
+};
+use std::sync::atomic::{AtomicU32, Ordering};
+use std::sync::{Arc, Barrier};
+use std::thread;
+use uuid::Uuid;
+
+fn response(body: &str) -> StoredResponse {
+    StoredResponse {
+        status: 200,
+        content_type: Some("application/json".to_string()),
+        body: body.as_bytes().to_vec(),
+    }
+}
+
+/// What the middleware does with a request: wait out a racing request with the same key, then
+/// replay its response or carry this one out with `apply`.
+fn submit(
+    idempotency: &Idempotency,
+    key: &str,
+    fingerprint: &str,
+    apply: impl FnOnce() -> StoredResponse,
+) -> Result<StoredResponse, IdempotencyError> {
+    loop {
+        match idempotency.begin(key, fingerprint, Utc::now()) {
+            Ok(Claim::Replay(stored)) => return Ok(stored),
+            Ok(Claim::Proceed) => {
+                let res = apply();
+                idempotency.complete(key, fingerprint, res.clone(), Utc::now())?;
+                return Ok(res);
+            }
+            Err(IdempotencyError::InProgress) => thread::sleep(std::time::Duration::from_millis(1)),
+            Err(e) => return Err(e),
+        }
+    }
+}
+
+#[test]
+fn a_retry_gets_the_first_response_and_a_different_body_is_refused() {
+    let idempotency = Idempotency::in_memory();
+    let visit = fingerprint(
+        "POST",
+        "/api/tournaments/t/matches/m/visits",
+        br#"{"score":60}"#,
+    );
+    let now = Utc::now();
+    assert_eq!(idempotency.begin("k1", &visit, now), Ok(Claim::Proceed));
+    // Until the first finishes, a retry has to wait.
+    assert_eq!(
+        idempotency.begin("k1", &visit, now),
+        Err(IdempotencyError::InProgress)
+    );
+    idempotency
+        .complete("k1", &visit, response("first"), now)
+        .unwrap();
+    assert_eq!(
+        idempotency.begin("k1", &visit, now),
+        Ok(Claim::Replay(response("first")))
+    );
+
+    let other = fingerprint(
+        "POST",
+        "/api/tournaments/t/matches/m/visits",
+        br#"{"score":61}"#,
+    );
+    assert_eq!(
+        idempotency.begin("k1", &other, now),
+        Err(IdempotencyError::KeyReused)
+    );
+    assert_ne!(visit, fingerprint("POST", "/api/other", br#"{"score":60}"#));
+
+    // Once expired, the key starts afresh.
+    let later = now + Duration::hours(25);
+    assert_eq!(idempotency.begin("k1", &other, later), Ok(Claim::Proceed));
+    idempotency.release("k1");
+    assert_eq!(idempotency.remove_expired(later).unwrap(), 1);
+
+    // Overwriting a result is a different request from recording it, though the body is the same.
+    let result = fingerprint(
+        "POST",
+        "/api/tournaments/t/matches/m/result",
+        br#"{"winner":1}"#,
+    );
+    let overwrite = fingerprint(
+        "POST",
+        "/api/tournaments/t/matches/m/result?overwrite=true",
+        br#"{"winner":1}"#,
+    );
+    assert_ne!(result, overwrite);
+    assert_eq!(idempotency.begin("k2", &result, now), Ok(Claim::Proceed));
+    idempotency
+        .complete("k2", &result, response("conflict"), now)
+        .unwrap();
+    assert_eq!(
+        idempotency.begin("k2", &overwrite, now),
+        Err(IdempotencyError::KeyReused)
+    );
+
+    for key in ["", "has space", &"k".repeat(MAX_IDEMPOTENCY_KEY_LEN + 1)] {
+        assert_eq!(
+            idempotency.begin(key, &visit, now),
+            Err(IdempotencyError::InvalidKey)
+        );
+    }
+}
+
+#[test]
+fn racing_identical_requests_apply_once() {
+    for _ in 0..20 {
+        let idempotency = Arc::new(Idempotency::in_memory());
+        let applied = Arc::new(AtomicU32::new(0));
+        let barrier = Arc::new(Barrier::new(8));
+        let request = fingerprint("POST", "/api/result", br#"{"winner":"a"}"#);
+        let handles: Vec<_> = (0..8)
+            .map(|_| {
+                let (idempotency, applied, barrier) =
+                    (idempotency.clone(), applied.clone(), barrier.clone());
+                let request = request.clone();
+                thread::spawn(move || {
+                    barrier.wait();
+                    submit(&idempotency, "retry", &request, || {
+                        let n = applied.fetch_add(1, Ordering::SeqCst) + 1;
+                        thread::sleep(std::time::Duration::from_millis(5));
+                        response(&format!("win {}", n))
+                    })
+                    .unwrap()
+                })
+            })
+            .collect();
+        let responses: Vec<StoredResponse> =
+            handles.into_iter().map(|h| h.join().unwrap()).collect();
+        assert_eq!(applied.load(Ordering::SeqCst), 1);
+        assert!(responses.iter().all(|r| *r == response("win 1")));
+    }
+}
+
+#[test]
+fn a_failed_request_can_be_retried_and_file_records_survive_a_restart() {
+    let dir = std::env::temp_dir().join(format!("dart-idempotency-test-{}", Uuid::new_v4()));
+    let ttl = Duration::hours(1);
+    let request = fingerprint("POST", "/api/result", b"{}");
+    let now = Utc::now();
+    {
+        let idempotency = Idempotency::new(FileIdempotencyStore::open(&dir).unwrap(), ttl);
+        assert_eq!(idempotency.begin("k", &request, now), Ok(Claim::Proceed));
+        // A server error stores nothing: the retry is carried out.
+        idempotency.release("k");
+        assert_eq!(idempotency.begin("k", &request, now), Ok(Claim::Proceed));
+        idempotency
+            .complete("k", &request, response("done"), now)
+            .unwrap();
+    }
+
+    let idempotency = Idempotency::new(FileIdempotencyStore::open(&dir).unwrap(), ttl);
+    assert_eq!(
+        idempotency.begin("k", &request, now),
+        Ok(Claim::Replay(response("done")))
+    );
+    assert_eq!(idempotency.remove_expired(now).unwrap(), 0);
+    assert_eq!(idempotency.remove_expired(now + ttl).unwrap(), 1);
+    assert_eq!(idempotency.begin("k", &request, now), Ok(Claim::Proceed));
+    std::fs::remove_dir_all(&dir).unwrap();
+}
@@ -0,0 +1,100 @@
+//! Integration tests for bulk player import: CSV parsing, seeds, and the all-or-nothing report.
+
+use dart_tournament_web::import::{
+    import_players, parse_players_csv, rows_from_names, ImportIssue, MAX_IMPORT_ROWS,
+};
+use dart_tournament_web::{Tournament, TournamentError, TournamentMode};
+
+fn tournament_with(names: &[&str]) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    for name in names {
+        t.add_player(*name).unwrap();
+    }
+    t
+}
+
+fn rejected_lines(result: Result<impl std::fmt::Debug, TournamentError>) -> Vec<usize> {
+    match result {
+        Err(TournamentError::InvalidImport(issues)) => issues.iter().map(|i| i.line).collect(),
+        other => panic!("expected an import report, got {:?}", other),
+    }
+}
+
+#[test]
+fn csv_import_places_requested_seeds() {
+    let mut t = tournament_with(&["Existing"]);
+    let csv = "name,seed\n\"Smith, John\",1\n\nAnn\nBob,2\n";
+    let rows = parse_players_csv(csv.as_bytes()).unwrap();
+    assert_eq!(rows.len(), 3);
+    assert_eq!(rows[0].name, "Smith, John");
+    assert_eq!(rows[2].line, 5);
+
+    let ids = import_players(&mut t, &rows).unwrap();
+    assert_eq!(ids.len(), 3);
+    let seed_of = |name: &str| t.players.iter().find(|p| p.name == name).unwrap().seed;
+    assert_eq!(seed_of("Smith, John"), 1);
+    assert_eq!(seed_of("Bob"), 2);
+    // Unrequested seeds fill the gaps, existing players first.
+    assert_eq!(seed_of("Existing"), 3);
+    assert_eq!(seed_of("Ann"), 4);
+}
+
+#[test]
+fn name_list_import_appends_in_order() {
+    let mut t = tournament_with(&["A"]);
+    let rows = rows_from_names(vec!["B".into(), " C ".into()]);
+    let ids = import_players(&mut t, &rows).unwrap();
+    assert_eq!(t.players.len(), 3);
+    assert_eq!(t.find_player(ids[1]).unwrap().name, "C");
+    assert_eq!(t.find_player(ids[1]).unwrap().seed, 3);
+}
+
+#[test]
+fn every_bad_line_is_reported_and_nothing_is_added() {
+    let mut t = tournament_with(&["Ann"]);
+    let csv = "Bob\n  \nbob\nANN\nCat,9\nDan,1\nEve,1\n";
+    let rows = parse_players_csv(csv.as_bytes()).unwrap();
+    assert_eq!(
+        rejected_lines(import_players(&mut t, &rows)),
+        vec![2, 3, 4, 5, 7]
+    );
+    assert_eq!(t.players.len(), 1);
+}
+
+#[test]
+fn duplicate_in_file_points_at_the_first_line() {
+    let mut t = tournament_with(&[]);
+    let rows = rows_from_names(vec!["Ann".into(), "ann".into()]);
+    let Err(TournamentError::InvalidImport(issues)) = import_players(&mut t, &rows) else {
+        panic!("expected an import report");
+    };
+    assert_eq!(
+        issues,
+        vec![ImportIssue {
+            line: 2,
+            message: "Same name as line 1".into()
+        }]
+    );
+}
+
+#[test]
+fn unparseable_seeds_and_extra_columns_are_reported() {
+    let csv = "Ann,first\nBob,0\nCat,1,extra\nDan,2\n";
+    assert_eq!(
+        rejected_lines(parse_players_csv(csv.as_bytes())),
+        vec![1, 2, 3]
+    );
+}
+
+#[test]
+fn row_count_is_capped() {
+    let mut t = tournament_with(&[]);
+    let names = (0..=MAX_IMPORT_ROWS).map(|i| format!("P{i}")).collect();
+    assert_eq!(
+        import_players(&mut t, &rows_from_names(names)),
+        Err(TournamentError::ImportRowCount {
+            max: MAX_IMPORT_ROWS
+        })
+    );
+    assert!(import_players(&mut t, &[]).is_err());
+}
@@ -0,0 +1,83 @@
+//! Integration tests for the leaderboard: sort keys, tiebreaks, paging, and all-time totals.
+
+use dart_tournament_web::{leaderboard, LeaderboardSort, Tournament, TournamentMode};
+
+fn names(board: &dart_tournament_web::Leaderboard) -> Vec<&str> {
+    board.entries.iter().map(|e| e.name.as_str()).collect()
+}
+
+/// A tournament whose players have the given (name, wins, losses).
+fn with_records(records: &[(&str, u32, u32)]) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    for &(name, wins, losses) in records {
+        t.add_player(name).unwrap();
+        let p = t.players.last_mut().unwrap();
+        (p.wins, p.losses) = (wins, losses);
+    }
+    t
+}
+
+#[test]
+fn sorts_by_key_then_fewer_losses_then_name() {
+    let t = with_records(&[("Cee", 2, 3), ("bee", 2, 1), ("Ay", 2, 1), ("Dee", 3, 0)]);
+    let board = leaderboard([&t], LeaderboardSort::Wins, 0, 10);
+    assert_eq!(names(&board), vec!["Dee", "Ay", "bee", "Cee"]);
+    assert_eq!(board.entries[1].rank, 2);
+}
+
+#[test]
+fn win_pct_handles_players_without_games() {
+    let t = with_records(&[("Zero", 0, 0), ("Loser", 0, 2), ("Half", 1, 1)]);
+    let board = leaderboard([&t], LeaderboardSort::WinPct, 0, 10);
+    // 0 games ranks below 0% from two games, and doesn't divide by zero.
+    assert_eq!(names(&board), vec!["Half", "Loser", "Zero"]);
+    assert_eq!(board.entries[0].win_percentage, 50.0);
+    assert_eq!(board.entries[2].win_percentage, 0.0);
+    assert_eq!(board.entries[2].games, 0);
+}
+
+#[test]
+fn average_and_180s_sorts_use_scoring_totals() {
+    let mut t = with_records(&[("A", 1, 0), ("B", 1, 0)]);
+    t.players[0].record_visit_stats(60, 3);
+    t.players[1].record_visit_stats(180, 3);
+    let board = leaderboard([&t], LeaderboardSort::Average, 0, 10);
+    assert_eq!(names(&board), vec!["B", "A"]);
+    assert_eq!(board.entries[0].three_dart_average, 180.0);
+    let board = leaderboard([&t], LeaderboardSort::Count180s, 0, 10);
+    assert_eq!(board.entries[0].count_180s, 1);
+}
+
+#[test]
+fn pages_report_the_full_total() {
+    let t = with_records(&[
+        ("A", 5, 0),
+        ("B", 4, 0),
+        ("C", 3, 0),
+        ("D", 2, 0),
+        ("E", 1, 0),
+    ]);
+    let page = leaderboard([&t], LeaderboardSort::Wins, 2, 2);
+    assert_eq!(page.total, 5);
+    assert_eq!(names(&page), vec!["C", "D"]);
+    assert_eq!(page.entries[0].rank, 3);
+    assert!(leaderboard([&t], LeaderboardSort::Wins, 10, 2)
+        .entries
+        .is_empty());
+}
+
+#[test]
+fn all_time_adds_up_players_with_the_same_name() {
+    let first = with_records(&[("Dave", 2, 1), ("Ann", 1, 0)]);
+    let second = with_records(&[("dave", 1, 1), ("Ann", 1, 2)]);
+    let board = leaderboard([&first, &second], LeaderboardSort::Wins, 0, 10);
+    assert_eq!(board.total, 2);
+    assert_eq!(
+        (
+            board.entries[0].name.as_str(),
+            board.entries[0].wins,
+            board.entries[0].losses
+        ),
+        ("Dave", 3, 2)
+    );
+}
@@ -0,0 +1,75 @@
+//! Integration tests for tournament lifecycle: naming, starting, and restarting.
+
+use dart_tournament_web::handicap::set_handicap;
+use dart_tournament_web::{
+    start_tournament, Handicap, Tournament, TournamentError, TournamentMode, TournamentState,
+    MAX_TOURNAMENT_NAME_LEN,
+};
+
+#[test]
+fn set_name_trims_and_limits_length() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.set_name("  Thursday League  ").unwrap();
+    assert_eq!(t.name, "Thursday League");
+    assert_eq!(
+        t.set_name(&"x".repeat(MAX_TOURNAMENT_NAME_LEN + 1)),
+        Err(TournamentError::TournamentNameTooLong {
+            max: MAX_TOURNAMENT_NAME_LEN
+        })
+    );
+    assert_eq!(t.name, "Thursday League");
+}
+
+#[test]
+fn start_requires_enough_players() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    for name in ["A", "B", "C"] {
+        t.add_player(name).unwrap();
+    }
+    assert_eq!(
+        start_tournament(&mut t),
+        Err(TournamentError::NotEnoughPlayersToStart { required: 4 })
+    );
+    assert_eq!(t.state, TournamentState::Setup);
+    t.add_player("D").unwrap();
+    start_tournament(&mut t).unwrap();
+    assert_eq!(t.state, TournamentState::FinalSelection);
+}
+
+#[test]
+fn restart_keeps_identity_and_players() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.set_name("Club night").unwrap();
+    for name in ["A", "B", "C", "D", "E"] {
+        t.add_player(name).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    let (id, created_at) = (t.id, t.created_at);
+
+    t.restart_tournament().unwrap();
+    assert_eq!(t.id, id);
+    assert_eq!(t.created_at, created_at);
+    assert_eq!(t.name, "Club night");
+    assert_eq!(t.state, TournamentState::Setup);
+    assert_eq!(t.players.len(), 5);
+}
+
+#[test]
+fn restart_keeps_the_handicaps() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    for name in ["A", "B", "C", "D"] {
+        t.add_player(name).unwrap();
+    }
+    let handicap = Handicap {
+        points: 100,
+        legs: 1,
+    };
+    assert!(set_handicap(&mut t, "B", handicap));
+    start_tournament(&mut t).unwrap();
+
+    t.restart_tournament().unwrap();
+    let b = t.players.iter().find(|p| p.name == "B").unwrap();
+    assert_eq!(b.handicap, handicap);
+    let a = t.players.iter().find(|p| p.name == "A").unwrap();
+    assert_eq!(a.handicap, Handicap::default());
+}
@@ -0,0 +1,272 @@
+//! Integration tests for per-round match formats: legs, sets, and locking played rounds.
+
+mod common;
+
+use common::Knockout;
+use dart_tournament_web::scoring::{MatchFormat, X01Match};
+use dart_tournament_web::{
+    match_format, record_bracket_result, record_match_visit, set_match_formats, LegScore,
+    MatchFormats, MatchId, Team, Tournament, TournamentError,
+};
+
+/// Win the current leg of a 101 match for `team`; the other side scores nothing.
+fn win_leg(m: &mut X01Match, team: Team) {
+    if m.current_leg().thrower != team {
+        m.record_visit(team.other(), 0, 3, false).unwrap();
+    }
+    m.record_visit(team, 101, 3, true).unwrap();
+}
+
+/// Win the current leg of a tournament match (501: 180, 180, 141) for `team`.
+fn win_scored_leg(t: &mut Tournament, match_id: MatchId, team: Team) {
+    for score in [180, 180, 141] {
+        let thrower = t.scores.get(&match_id).map(|m| m.current_leg().thrower);
+        if thrower == Some(team.other()) {
+            record_match_visit(t, match_id, team.other(), 0, 3, false, 0).unwrap();
+        }
+        record_match_visit(t, match_id, team, score, 3, score == 141, 0).unwrap();
+    }
+}
+
+fn final_id(t: &Tournament) -> MatchId {
+    t.bracket.as_ref().unwrap().final_match().unwrap().id
+}
+
+#[test]
+fn best_of_five_is_not_won_at_two_legs() {
+    let mut m = X01Match::with_format(MatchFormat::best_of_legs(5), 101).unwrap();
+    win_leg(&mut m, Team::One);
+    win_leg(&mut m, Team::One);
+    assert_eq!(m.winner, None);
+    win_leg(&mut m, Team::Two);
+    win_leg(&mut m, Team::One);
+    assert_eq!(m.winner, Some(Team::One));
+    assert_eq!(
+        m.score(),
+        LegScore {
+            team_1: 3,
+            team_2: 1
+        }
+    );
+}
+
+#[test]
+fn sets_play_tallies_legs_per_set() {
+    // First to 3 sets, each set first to 3 legs.
+    let mut m = X01Match::with_format(MatchFormat::best_of_sets(5, 5), 101).unwrap();
+    for _ in 0..3 {
+        win_leg(&mut m, Team::One);
+    }
+    assert_eq!(
+        m.sets_won,
+        LegScore {
+            team_1: 1,
+            team_2: 0
+        }
+    );
+    assert_eq!(m.legs_won, LegScore::default());
+
+    win_leg(&mut m, Team::Two);
+    win_leg(&mut m, Team::Two);
+    assert_eq!(
+        m.legs_won,
+        LegScore {
+            team_1: 0,
+            team_2: 2
+        }
+    );
+    // Undoing a set-winning checkout reopens the set.
+    win_leg(&mut m, Team::Two);
+    assert_eq!(
+        m.sets_won,
+        LegScore {
+            team_1: 1,
+            team_2: 1
+        }
+    );
+    m.undo_visit().unwrap();
+    assert_eq!(
+        m.sets_won,
+        LegScore {
+            team_1: 1,
+            team_2: 0
+        }
+    );
+    assert_eq!(
+        m.legs_won,
+        LegScore {
+            team_1: 0,
+            team_2: 2
+        }
+    );
+    m.record_visit(Team::Two, 101, 3, true).unwrap();
+
+    for _ in 0..6 {
+        win_leg(&mut m, Team::One);
+    }
+    assert_eq!(m.winner, Some(Team::One));
+    assert_eq!(
+        m.score(),
+        LegScore {
+            team_1: 3,
+            team_2: 1
+        }
+    );
+    assert_eq!(
+        m.legs_won,
+        LegScore {
+            team_1: 3,
+            team_2: 0
+        }
+    );
+}
+
+#[test]
+fn formats_must_be_odd() {
+    let mut t = Knockout::numbered(4).started();
+    for format in [
+        MatchFormat::best_of_legs(4),
+        MatchFormat::best_of_legs(0),
+        MatchFormat::best_of_sets(2, 3),
+    ] {
+        let formats = MatchFormats {
+            final_match: Some(format),
+            ..MatchFormats::default()
+        };
+        assert_eq!(
+            set_match_formats(&mut t, formats),
+            Err(TournamentError::InvalidMatchFormat)
+        );
+    }
+    let round_zero = MatchFormats {
+        rounds: [(0, MatchFormat::best_of_legs(3))].into(),
+        ..MatchFormats::default()
+    };
+    assert_eq!(
+        set_match_formats(&mut t, round_zero),
+        Err(TournamentError::InvalidMatchFormat)
+    );
+}
+
+#[test]
+fn the_final_is_played_over_its_own_format() {
+    let mut t = Knockout::numbered(4).started();
+    set_match_formats(
+        &mut t,
+        MatchFormats {
+            rounds: [(1, MatchFormat::best_of_legs(1))].into(),
+            final_match: Some(MatchFormat::best_of_legs(5)),
+            ..MatchFormats::default()
+        },
+    )
+    .unwrap();
+    let semis: Vec<MatchId> = t.bracket.as_ref().unwrap().round(1).map(|m| m.id).collect();
+    // Best of one: a single leg decides each semi-final.
+    for semi in semis {
+        win_scored_leg(&mut t, semi, Team::One);
+        assert!(t
+            .bracket
+            .as_ref()
+            .unwrap()
+            .get(semi)
+            .unwrap()
+            .winner
+            .is_some());
+    }
+
+    let final_id = final_id(&t);
+    assert_eq!(match_format(&t, final_id), MatchFormat::best_of_legs(5));
+    win_scored_leg(&mut t, final_id, Team::One);
+    win_scored_leg(&mut t, final_id, Team::One);
+    assert_eq!(t.bracket.as_ref().unwrap().champion(), None);
+    win_scored_leg(&mut t, final_id, Team::One);
+    let final_match = t.bracket.as_ref().unwrap().final_match().unwrap();
+    assert_eq!(final_match.winner, Some(Team::One));
+    assert_eq!(
+        final_match.score,
+        Some(LegScore {
+            team_1: 3,
+            team_2: 0
+        })
+    );
+}
+
+#[test]
+fn played_rounds_keep_their_format() {
+    let mut t = Knockout::numbered(4).started();
+    let final_format = MatchFormats {
+        final_match: Some(MatchFormat::best_of_legs(5)),
+        ..MatchFormats::default()
+    };
+    set_match_formats(&mut t, final_format.clone()).unwrap();
+    let semi = t.bracket.as_ref().unwrap().matches[0].clone();
+    record_bracket_result(&mut t, semi.id, semi.team_1.unwrap(), None, false).unwrap();
+
+    let longer_semis = MatchFormats {
+        rounds: [(1, MatchFormat::best_of_legs(5))].into(),
+        ..final_format.clone()
+    };
+    assert_eq!(
+        set_match_formats(&mut t, longer_semis),
+        Err(TournamentError::MatchFormatLocked)
+    );
+    // The final hasn't been played, so it can still change.
+    let sets_final = MatchFormats {
+        final_match: Some(MatchFormat::best_of_sets(3, 3)),
+        ..MatchFormats::default()
+    };
+    set_match_formats(&mut t, sets_final).unwrap();
+
+    // A reported score has to be a finished match in the round's format.
+    let other_semi = t.bracket.as_ref().unwrap().matches[1].clone();
+    record_bracket_result(
+        &mut t,
+        other_semi.id,
+        other_semi.team_1.unwrap(),
+        None,
+        false,
+    )
+    .unwrap();
+    let final_match = t.bracket.as_ref().unwrap().final_match().unwrap().clone();
+    let winner = final_match.team_1.unwrap();
+    assert_eq!(
+        record_bracket_result(
+            &mut t,
+            final_match.id,
+            winner,
+            Some(LegScore {
+                team_1: 1,
+                team_2: 0
+            }),
+            false
+        ),
+        Err(TournamentError::InvalidScore)
+    );
+    let sets = LegScore {
+        team_1: 2,
+        team_2: 1,
+    };
+    record_bracket_result(&mut t, final_match.id, winner, Some(sets), false).unwrap();
+    assert_eq!(
+        set_match_formats(&mut t, MatchFormats::default()),
+        Err(TournamentError::MatchFormatLocked)
+    );
+}
+
+#[test]
+fn a_restart_keeps_the_formats() {
+    let mut t = Knockout::numbered(4).started();
+    let formats = MatchFormats {
+        rounds: [(1, MatchFormat::best_of_legs(5))].into(),
+        final_match: Some(MatchFormat::best_of_sets(3, 3)),
+        ..MatchFormats::default()
+    };
+    set_match_formats(&mut t, formats.clone()).unwrap();
+    let semi = t.bracket.as_ref().unwrap().matches[0].clone();
+    record_bracket_result(&mut t, semi.id, semi.team_1.unwrap(), None, false).unwrap();
+
+    t.restart_tournament().unwrap();
+    assert_eq!(t.match_formats, formats);
+    // Nothing has been played since, so the semi-finals' format can change again.
+    set_match_formats(&mut t, MatchFormats::default()).unwrap();
+}
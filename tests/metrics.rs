@@ -0,0 +1,107 @@
+//! Integration tests for the Prometheus metrics: request histograms and tournament activity.
+
+use dart_tournament_web::metrics::{render, Gauges, HttpMetrics};
+use dart_tournament_web::{
+    record_bracket_result, record_match_visit, start_tournament, Team, Tournament, TournamentError,
+    TournamentFormat, TournamentMode, TournamentRegistry,
+};
+use std::time::Duration;
+
+/// Value of the sample `series` (name and labels exactly as rendered).
+fn sample(scrape: &str, series: &str) -> f64 {
+    scrape
+        .lines()
+        .find_map(|line| line.strip_prefix(series)?.strip_prefix(' '))
+        .unwrap_or_else(|| panic!("{series} missing from:\n{scrape}"))
+        .parse()
+        .unwrap()
+}
+
+fn scrape() -> String {
+    render(&HttpMetrics::new(), Gauges::default())
+}
+
+#[test]
+fn a_simulated_match_moves_the_activity_counters() {
+    let registry = TournamentRegistry::new();
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    t.add_player("Anna").unwrap();
+    t.add_player("Ben").unwrap();
+    start_tournament(&mut t).unwrap();
+    let t = registry.insert(t).unwrap();
+    let m = t.bracket.as_ref().unwrap().matches[0].clone();
+
+    let before = scrape();
+    for (team, score) in [(Team::One, 180), (Team::Two, 60), (Team::One, 180)] {
+        registry
+            .update(t.id, |t| {
+                record_match_visit(t, m.id, team, score, 3, true, 0)
+            })
+            .unwrap();
+    }
+    registry
+        .update(t.id, |t| {
+            record_bracket_result(t, m.id, m.team_1.unwrap(), None, false)
+        })
+        .unwrap();
+    // A change that fails is thrown away, and counts nothing.
+    registry
+        .update(t.id, |t| {
+            record_match_visit(t, m.id, Team::One, 180, 3, true, 0)?;
+            Err(TournamentError::InvalidState)
+        })
+        .unwrap_err();
+
+    let after = scrape();
+    let moved = |series: &str| sample(&after, series) - sample(&before, series);
+    assert_eq!(moved("dart_visits_recorded_total"), 3.0);
+    assert_eq!(moved("dart_180s_total"), 2.0);
+    assert_eq!(moved("dart_matches_completed_total"), 1.0);
+    assert_eq!(registry.active_count(), 1);
+}
+
+#[test]
+fn requests_are_counted_and_bucketed_by_route_and_status() {
+    let http = HttpMetrics::new();
+    let route = "/api/tournaments/{id}";
+    http.observe(route, 200, Duration::from_millis(3));
+    http.observe(route, 200, Duration::from_millis(80));
+    http.observe(route, 404, Duration::from_millis(1));
+    let scrape = render(
+        &http,
+        Gauges {
+            active_tournaments: 2,
+        },
+    );
+
+    let labels = r#"route="/api/tournaments/{id}",status="200""#;
+    assert_eq!(
+        sample(&scrape, &format!("dart_http_requests_total{{{labels}}}")),
+        2.0
+    );
+    let bucket = |le: &str| {
+        sample(
+            &scrape,
+            &format!("dart_http_request_duration_seconds_bucket{{{labels},le=\"{le}\"}}"),
+        )
+    };
+    assert_eq!(bucket("0.005"), 1.0);
+    assert_eq!(bucket("0.05"), 1.0);
+    assert_eq!(bucket("0.1"), 2.0);
+    assert_eq!(bucket("+Inf"), 2.0);
+    let sum = sample(
+        &scrape,
+        &format!("dart_http_request_duration_seconds_sum{{{labels}}}"),
+    );
+    assert!((sum - 0.083).abs() < 1e-9);
+    assert_eq!(
+        sample(
+            &scrape,
+            r#"dart_http_requests_total{route="/api/tournaments/{id}",status="404"}"#
+        ),
+        1.0
+    );
+    assert_eq!(sample(&scrape, "dart_active_tournaments"), 2.0);
+    assert!(scrape.contains("# TYPE dart_http_request_duration_seconds histogram"));
+}
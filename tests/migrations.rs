@@ -0,0 +1,161 @@
+//! Integration tests for the schema migrations of stored tournaments.
+
+use dart_tournament_web::migrations::{
+    applied_migrations, migrate, migrate_to, schema_version, MigrateError, MIGRATIONS,
+    SCHEMA_VERSION, VERSION_FILE,
+};
+use dart_tournament_web::{
+    read_snapshot, record_match_visit, start_with_draw, DrawMode, DrawSettings, FileStore, Team,
+    Tournament, TournamentFormat, TournamentMode, TournamentStore,
+};
+use serde_json::{json, Value};
+use std::fs;
+use std::path::{Path, PathBuf};
+use uuid::Uuid;
+
+fn temp_dir() -> PathBuf {
+    std::env::temp_dir().join(format!("dart-migrations-test-{}", Uuid::new_v4()))
+}
+
+/// A randomly drawn knockout as stored before versioning, with a match being scored: no
+/// creation time or draw mode, and visits without their thrower.
+fn legacy_document() -> (Tournament, Value) {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    for name in ["A", "B", "C", "D"] {
+        t.add_player(name).unwrap();
+    }
+    let settings = DrawSettings {
+        mode: DrawMode::Random,
+        protected_seeds: 0,
+        seed: Some(7),
+        ..Default::default()
+    };
+    start_with_draw(&mut t, settings).unwrap();
+    let m = t.bracket.as_ref().unwrap().round(1).next().unwrap().id;
+    for team in [Team::One, Team::Two] {
+        record_match_visit(&mut t, m, team, 60, 3, false, 0).unwrap();
+    }
+    let mut doc = serde_json::to_value(&t).unwrap();
+    let fields = doc.as_object_mut().unwrap();
+    fields.remove("created_at");
+    fields.remove("draw_mode");
+    for visit in visits(&mut doc, &t) {
+        visit.as_object_mut().unwrap().remove("player").unwrap();
+    }
+    (t, doc)
+}
+
+/// The scored visits of the tournament's first match, in `doc`.
+fn visits<'a>(doc: &'a mut Value, t: &Tournament) -> &'a mut Vec<Value> {
+    let m = t.bracket.as_ref().unwrap().round(1).next().unwrap().id;
+    doc["scores"][m.to_string()]["legs"][0]["visits"]
+        .as_array_mut()
+        .unwrap()
+}
+
+fn read(dir: &Path, t: &Tournament) -> Value {
+    let bytes = fs::read(dir.join(format!("{}.json", t.id))).unwrap();
+    serde_json::from_slice(&bytes).unwrap()
+}
+
+#[test]
+fn migrations_apply_to_a_fresh_directory_and_the_last_rolls_back() {
+    let dir = temp_dir();
+    fs::create_dir_all(&dir).unwrap();
+    let (t, doc) = legacy_document();
+    fs::write(dir.join(format!("{}.json", t.id)), doc.to_string()).unwrap();
+    assert_eq!(schema_version(&dir).unwrap(), 0);
+
+    let all: Vec<u32> = MIGRATIONS.iter().map(|m| m.version).collect();
+    assert_eq!(migrate(&dir).unwrap(), all);
+    assert_eq!(schema_version(&dir).unwrap(), SCHEMA_VERSION);
+    let names: Vec<String> = applied_migrations(&dir)
+        .unwrap()
+        .into_iter()
+        .map(|a| a.name)
+        .collect();
+    assert_eq!(
+        names,
+        ["initial", "created_at", "draw_mode", "visit_players"]
+    );
+    let migrated = read(&dir, &t);
+    assert_eq!(migrated["draw_mode"], "random");
+    assert!(migrated["created_at"].is_string());
+    let first = t.bracket.as_ref().unwrap().round(1).next().unwrap();
+    let throwers: Vec<Value> = visits(&mut migrated.clone(), &t)
+        .iter()
+        .map(|v| v["player"].clone())
+        .collect();
+    assert_eq!(throwers, [json!(first.team_1), json!(first.team_2)]);
+    // Applying again changes nothing, and the store reads the migrated tournament.
+    assert!(migrate(&dir).unwrap().is_empty());
+    let loaded = FileStore::open(&dir).unwrap().load_all().unwrap();
+    assert_eq!(loaded.len(), 1);
+    assert_eq!(loaded[0].draw_mode, DrawMode::Random);
+    // The creation time is now the file's, not whenever it was loaded.
+    assert_eq!(json!(loaded[0].created_at), migrated["created_at"]);
+
+    // Rolling back to version 2 reverts the later migrations, newest first.
+    let last = SCHEMA_VERSION;
+    assert_eq!(
+        migrate_to(&dir, 2).unwrap(),
+        (3..=last).rev().collect::<Vec<_>>()
+    );
+    assert_eq!(schema_version(&dir).unwrap(), 2);
+    assert_eq!(applied_migrations(&dir).unwrap().len(), 2);
+    let rolled_back = read(&dir, &t);
+    assert!(rolled_back.get("draw_mode").is_none());
+    assert!(visits(&mut rolled_back.clone(), &t)
+        .iter()
+        .all(|v| v.get("player").is_none()));
+    assert_eq!(rolled_back["created_at"], migrated["created_at"]);
+    assert!(matches!(
+        migrate_to(&dir, last + 1),
+        Err(MigrateError::UnknownVersion(v)) if v == last + 1
+    ));
+    fs::remove_dir_all(&dir).unwrap();
+}
+
+#[test]
+fn data_from_a_newer_version_is_refused() {
+    let dir = temp_dir();
+    fs::create_dir_all(&dir).unwrap();
+    let ahead = SCHEMA_VERSION + 1;
+    fs::write(
+        dir.join(VERSION_FILE),
+        json!({ "version": ahead }).to_string(),
+    )
+    .unwrap();
+    assert!(matches!(
+        migrate(&dir),
+        Err(MigrateError::Ahead { found, known }) if found == ahead && known == SCHEMA_VERSION
+    ));
+    assert_eq!(schema_version(&dir).unwrap(), ahead);
+
+    // A snapshot records its version too: one from before versioning is migrated on reading,
+    // one from a newer version is rejected.
+    let (t, doc) = legacy_document();
+    let path = dir.join("snapshot.json");
+    let saved_at = "2026-01-02T03:04:05Z";
+    fs::write(
+        &path,
+        json!({ "saved_at": saved_at, "tournaments": [doc] }).to_string(),
+    )
+    .unwrap();
+    let restored = read_snapshot(&path).unwrap();
+    assert_eq!(restored[0].id, t.id);
+    assert_eq!(restored[0].draw_mode, DrawMode::Random);
+    assert_eq!(
+        restored[0].created_at.to_rfc3339(),
+        "2026-01-02T03:04:05+00:00"
+    );
+
+    fs::write(
+        &path,
+        json!({ "saved_at": saved_at, "schema_version": ahead, "tournaments": [] }).to_string(),
+    )
+    .unwrap();
+    assert!(read_snapshot(&path).is_err());
+    fs::remove_dir_all(&dir).unwrap();
+}
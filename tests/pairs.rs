@@ -0,0 +1,120 @@
+//! Integration tests for pairs tournaments: team entries, team brackets, and member records.
+
+use dart_tournament_web::{
+    leaderboard, record_bracket_result, start_tournament, EntryType, LeaderboardSort, Tournament,
+    TournamentError, TournamentFormat, TournamentMode, TournamentState,
+};
+
+fn members(a: &str, b: &str) -> Vec<String> {
+    vec![a.to_string(), b.to_string()]
+}
+
+fn pairs_tournament() -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    t.set_entry_type(EntryType::Pairs).unwrap();
+    t
+}
+
+#[test]
+fn team_entries_need_two_people_not_in_another_team() {
+    let mut t = pairs_tournament();
+    assert_eq!(t.add_player("Ann"), Err(TournamentError::WrongEntryType));
+    assert_eq!(
+        t.add_pair("Solo", &["Ann".to_string()]),
+        Err(TournamentError::InvalidPair)
+    );
+    assert_eq!(
+        t.add_pair("Twins", &members("Ann", " ann ")),
+        Err(TournamentError::InvalidPair)
+    );
+    t.add_pair("Arrows", &members("Ann", "Bob")).unwrap();
+    assert_eq!(
+        t.add_pair("Flights", &members("Cat", "BOB")),
+        Err(TournamentError::PlayerInAnotherPair("BOB".into()))
+    );
+    assert_eq!(
+        t.add_pair("arrows", &members("Cat", "Dan")),
+        Err(TournamentError::DuplicatePlayerName)
+    );
+    assert_eq!(t.players[0].members, members("Ann", "Bob"));
+
+    let mut singles = Tournament::new(3, TournamentMode::OneVOne);
+    assert_eq!(
+        singles.add_pair("Arrows", &members("Ann", "Bob")),
+        Err(TournamentError::WrongEntryType)
+    );
+}
+
+#[test]
+fn pairs_tournaments_play_one_team_per_side() {
+    let mut t = Tournament::new(3, TournamentMode::TwoVTwo);
+    assert_eq!(
+        t.set_entry_type(EntryType::Pairs),
+        Err(TournamentError::UnsupportedMode)
+    );
+    let mut t = pairs_tournament();
+    assert_eq!(
+        t.set_mode(TournamentMode::TwoVTwo),
+        Err(TournamentError::UnsupportedMode)
+    );
+    t.add_pair("Arrows", &members("Ann", "Bob")).unwrap();
+    assert_eq!(
+        t.set_entry_type(EntryType::Singles),
+        Err(TournamentError::InvalidState)
+    );
+}
+
+#[test]
+fn team_results_count_for_members_apart_from_singles() {
+    let mut t = pairs_tournament();
+    t.add_pair("Arrows", &members("Ann", "Bob")).unwrap();
+    t.add_pair("Flights", &members("Cat", "Dan")).unwrap();
+    t.add_pair("Oche", &members("Eve", "Fay")).unwrap();
+    t.add_pair("Treble", &members("Gus", "Hal")).unwrap();
+    start_tournament(&mut t).unwrap();
+    let arrows = t.players[0].id;
+    loop {
+        let next = t
+            .bracket
+            .as_ref()
+            .unwrap()
+            .matches
+            .iter()
+            .find(|m| m.is_ready() && !m.bye)
+            .cloned();
+        let Some(m) = next else {
+            break;
+        };
+        let winner = m.team_1.unwrap();
+        record_bracket_result(&mut t, m.id, winner, None, false).unwrap();
+    }
+    assert_eq!(t.state, TournamentState::Completed);
+    assert_eq!(t.bracket.as_ref().unwrap().champion(), Some(arrows));
+    assert_eq!(t.find_player(arrows).unwrap().wins, 2);
+
+    let mut singles = Tournament::new(3, TournamentMode::OneVOne);
+    singles.add_player("Ann").unwrap();
+    singles.players[0].wins = 1;
+
+    let board = leaderboard([&t, &singles], LeaderboardSort::Wins, 0, 20);
+    // Eight people; the teams themselves aren't ranked.
+    assert_eq!(board.total, 8);
+    let ann = board.entries.iter().find(|e| e.name == "Ann").unwrap();
+    assert_eq!((ann.wins, ann.losses), (1, 0));
+    assert_eq!((ann.team_wins, ann.team_losses), (2, 0));
+    let hal = board.entries.iter().find(|e| e.name == "Hal").unwrap();
+    assert_eq!((hal.wins, hal.team_wins, hal.team_losses), (0, 0, 1));
+}
+
+#[test]
+fn restarting_keeps_the_teams() {
+    let mut t = pairs_tournament();
+    t.add_pair("Arrows", &members("Ann", "Bob")).unwrap();
+    t.add_pair("Flights", &members("Cat", "Dan")).unwrap();
+    start_tournament(&mut t).unwrap();
+    t.restart_tournament().unwrap();
+    assert_eq!(t.entry_type, EntryType::Pairs);
+    assert_eq!(t.players.len(), 2);
+    assert_eq!(t.players[1].members, members("Cat", "Dan"));
+}
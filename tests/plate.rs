@@ -0,0 +1,206 @@
+//! Integration tests for the plate: drawn once from the first-round losers, taken down with
+//! a first-round result until it starts, and kept apart in stats and placements.
+
+use dart_tournament_web::archive::EventStats;
+use dart_tournament_web::history::{match_history, MatchQuery};
+use dart_tournament_web::{
+    final_placements, record_bracket_result, record_match_visit, record_walkover, start_tournament,
+    undo_last_action, withdraw_player, BracketMatch, BracketSection, MatchId, PlayerId, Team,
+    Tournament, TournamentError, TournamentFormat, TournamentMode, TournamentState,
+};
+
+/// A single-elimination tournament of P1..Pn, seeded in that order, with a plate.
+fn knockout_with_plate(players: usize) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    for i in 0..players {
+        t.add_player(format!("P{}", i + 1)).unwrap();
+    }
+    t.set_plate(true).unwrap();
+    start_tournament(&mut t).unwrap();
+    t
+}
+
+fn id(t: &Tournament, name: &str) -> PlayerId {
+    t.all_players()
+        .into_iter()
+        .find(|p| p.name == name)
+        .unwrap()
+        .id
+}
+
+fn name(t: &Tournament, id: Option<PlayerId>) -> Option<&str> {
+    id.map(|id| t.find_player(id).unwrap().name.as_str())
+}
+
+fn plate_matches(t: &Tournament) -> Vec<&BracketMatch> {
+    t.bracket
+        .as_ref()
+        .unwrap()
+        .matches
+        .iter()
+        .filter(|m| m.section == BracketSection::Plate)
+        .collect()
+}
+
+/// The players of each plate match, top to bottom and round by round.
+fn plate_draw(t: &Tournament) -> Vec<(Option<&str>, Option<&str>)> {
+    plate_matches(t)
+        .into_iter()
+        .map(|m| (name(t, m.team_1), name(t, m.team_2)))
+        .collect()
+}
+
+/// The match between `a` and `b` in `section`.
+fn between(t: &Tournament, section: BracketSection, a: &str, b: &str) -> MatchId {
+    let (a, b) = (id(t, a), id(t, b));
+    t.bracket
+        .as_ref()
+        .unwrap()
+        .matches
+        .iter()
+        .find(|m| m.section == section && m.side_of(a).is_some() && m.side_of(b).is_some())
+        .unwrap()
+        .id
+}
+
+fn beat(t: &mut Tournament, section: BracketSection, winner: &str, loser: &str) {
+    let m = between(t, section, winner, loser);
+    let w = id(t, winner);
+    record_bracket_result(t, m, w, None, false).unwrap();
+}
+
+#[test]
+fn the_plate_is_drawn_once_when_the_last_first_round_match_is_decided() {
+    use BracketSection::{Plate, Winners};
+    let mut t = knockout_with_plate(8);
+    beat(&mut t, Winners, "P1", "P8");
+    beat(&mut t, Winners, "P2", "P7");
+    beat(&mut t, Winners, "P3", "P6");
+    assert!(plate_matches(&t).is_empty());
+
+    // A walkover decides the round as well as a result does; the losers go in by seed.
+    let last = between(&t, Winners, "P4", "P5");
+    let absent = id(&t, "P4");
+    record_walkover(&mut t, last, absent).unwrap();
+    let drawn = [
+        (Some("P4"), Some("P8")),
+        (Some("P6"), Some("P7")),
+        (None, None),
+    ];
+    assert_eq!(plate_draw(&t), drawn);
+
+    beat(&mut t, Winners, "P1", "P5");
+    beat(&mut t, Plate, "P8", "P4");
+    beat(&mut t, Winners, "P2", "P3");
+    beat(&mut t, Plate, "P6", "P7");
+    assert_eq!(plate_matches(&t).len(), 3);
+    beat(&mut t, Winners, "P1", "P2");
+    // The main final is in, but the plate final isn't.
+    assert_eq!(t.state, TournamentState::BracketPlay);
+    beat(&mut t, Plate, "P8", "P6");
+    assert_eq!(t.state, TournamentState::Completed);
+
+    let bracket = t.bracket.as_ref().unwrap();
+    assert_eq!(name(&t, bracket.champion()), Some("P1"));
+    assert_eq!(name(&t, bracket.plate_champion()), Some("P8"));
+    // Plate wins count in the tournament and are told apart in the record.
+    let p8 = t.find_player(id(&t, "P8")).unwrap();
+    assert_eq!((p8.wins, p8.plate_wins, p8.losses), (2, 2, 1));
+    let stats = EventStats::of(&t, p8);
+    assert_eq!((stats.wins, stats.plate_wins), (2, 2));
+
+    // Every first-round loser still shares fifth, however far they went in the plate.
+    let placements = final_placements(&t).unwrap();
+    let place = |n: &str| {
+        let player = id(&t, n);
+        placements
+            .iter()
+            .find(|p| p.player == player)
+            .unwrap()
+            .place
+    };
+    assert_eq!(
+        ["P1", "P2", "P3", "P5", "P8", "P4"].map(place),
+        [1, 2, 3, 3, 5, 5]
+    );
+
+    // Newest first.
+    let page = match_history([&t], &MatchQuery::default());
+    let plate: Vec<&str> = page
+        .matches
+        .iter()
+        .filter(|m| m.bracket == Plate)
+        .map(|m| m.round_label.as_str())
+        .collect();
+    assert_eq!(plate, ["Plate final", "Plate round 1", "Plate round 1"]);
+}
+
+#[test]
+fn a_first_round_result_taken_back_takes_the_plate_down_until_it_has_started() {
+    use BracketSection::{Plate, Winners};
+    let mut t = knockout_with_plate(4);
+    beat(&mut t, Winners, "P1", "P4");
+    beat(&mut t, Winners, "P2", "P3");
+    assert_eq!(plate_draw(&t), [(Some("P3"), Some("P4"))]);
+
+    let second = between(&t, Winners, "P2", "P3");
+    undo_last_action(&mut t, second).unwrap();
+    assert!(plate_matches(&t).is_empty());
+    let p3 = id(&t, "P3");
+    record_bracket_result(&mut t, second, p3, None, false).unwrap();
+    assert_eq!(plate_draw(&t), [(Some("P2"), Some("P4"))]);
+
+    // Correcting the result draws the plate again too.
+    let p2 = id(&t, "P2");
+    record_bracket_result(&mut t, second, p2, None, true).unwrap();
+    assert_eq!(plate_draw(&t), [(Some("P3"), Some("P4"))]);
+
+    // Once a visit is scored in the plate, the first round stays as it is.
+    let plate = between(&t, Plate, "P3", "P4");
+    record_match_visit(&mut t, plate, Team::One, 60, 3, false, 0).unwrap();
+    assert_eq!(
+        undo_last_action(&mut t, second).unwrap_err(),
+        TournamentError::NextMatchAlreadyPlayed
+    );
+    let first = between(&t, Winners, "P1", "P4");
+    let p1 = id(&t, "P1");
+    assert_eq!(
+        record_bracket_result(&mut t, first, p1, None, true).unwrap_err(),
+        TournamentError::NextMatchAlreadyPlayed
+    );
+    assert_eq!(plate_matches(&t).len(), 1);
+}
+
+#[test]
+fn withdrawn_losers_stay_out_and_small_draws_have_no_plate() {
+    use BracketSection::Winners;
+    // P8 withdraws and isn't entered; the top of the three left has a plate bye.
+    let mut t = knockout_with_plate(8);
+    let p8 = id(&t, "P8");
+    withdraw_player(&mut t, p8, false).unwrap();
+    beat(&mut t, Winners, "P4", "P5");
+    beat(&mut t, Winners, "P2", "P7");
+    beat(&mut t, Winners, "P3", "P6");
+    assert_eq!(
+        plate_draw(&t),
+        [
+            (Some("P5"), None),
+            (Some("P6"), Some("P7")),
+            (Some("P5"), None)
+        ]
+    );
+
+    // Five players: three byes leave one first-round loser, too few for a plate.
+    let mut t = knockout_with_plate(5);
+    beat(&mut t, Winners, "P4", "P5");
+    beat(&mut t, Winners, "P1", "P4");
+    assert!(plate_matches(&t).is_empty());
+
+    let mut round_robin = Tournament::new(3, TournamentMode::OneVOne);
+    round_robin.format = TournamentFormat::RoundRobin;
+    assert_eq!(
+        round_robin.set_plate(true),
+        Err(TournamentError::InvalidState)
+    );
+}
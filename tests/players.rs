@@ -0,0 +1,161 @@
+//! Integration tests for player registration, lookup, and scoring stats.
+
+use dart_tournament_web::{
+    record_match_visit, start_tournament, Player, Tournament, TournamentError, TournamentFormat,
+    TournamentMode, TournamentState, MAX_PLAYER_NAME_LEN,
+};
+use uuid::Uuid;
+
+#[test]
+fn add_player_rejects_blank_and_long_names() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    assert_eq!(t.add_player(""), Err(TournamentError::EmptyPlayerName));
+    assert_eq!(t.add_player("   \t"), Err(TournamentError::EmptyPlayerName));
+    assert_eq!(
+        t.add_player("x".repeat(MAX_PLAYER_NAME_LEN + 1)),
+        Err(TournamentError::PlayerNameTooLong {
+            max: MAX_PLAYER_NAME_LEN
+        })
+    );
+    // Limit counts characters, not bytes, and applies after trimming.
+    t.add_player(format!("  {}  ", "ø".repeat(MAX_PLAYER_NAME_LEN)))
+        .unwrap();
+    assert_eq!(t.players.len(), 1);
+}
+
+#[test]
+fn add_player_rejects_duplicates_case_insensitively() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.add_player("Dave").unwrap();
+    assert_eq!(
+        t.add_player("dave"),
+        Err(TournamentError::DuplicatePlayerName)
+    );
+    assert_eq!(t.players.len(), 1);
+}
+
+#[test]
+fn find_player_covers_eliminated_and_semi_final_losers() {
+    let players: Vec<Player> = (0..6).map(|i| Player::new(format!("P{i}"))).collect();
+    let ids: Vec<Uuid> = players.iter().map(|p| p.id).collect();
+    let mut t = Tournament::with_players(players, 3, TournamentMode::OneVOne);
+    t.state = TournamentState::GroupPlay;
+
+    t.eliminate_player(ids[0]).unwrap();
+    let semi = t.players.remove(1);
+    t.bracket_semi_final_players = Some(vec![semi]);
+
+    assert_eq!(t.all_players().len(), 6);
+    for id in &ids {
+        assert!(t.find_player(*id).is_some());
+    }
+    assert!(t.find_player(Uuid::new_v4()).is_none());
+}
+
+#[test]
+fn three_dart_average_uses_darts_thrown_not_visit_count() {
+    let mut p = Player::new("A");
+    p.record_visit_stats(60, 3);
+    p.record_visit_stats(60, 3);
+    // Leg finished with the first dart of the visit: 160 points from 7 darts.
+    p.record_visit_stats(40, 1);
+    p.record_checkout(40, 1);
+    let avg = p.three_dart_average();
+    assert!((avg - 160.0 * 3.0 / 7.0).abs() < 1e-9, "average was {avg}");
+    // A naive mean of visit scores would give 53.33.
+    assert!(avg > 68.0);
+
+    p.record_visit_stats(100, 2);
+    p.record_checkout(100, 1);
+    assert_eq!((p.points_scored, p.darts_thrown), (260, 9));
+    assert!((p.three_dart_average() - 260.0 / 3.0).abs() < 1e-9);
+}
+
+#[test]
+fn checkout_stats_track_highest_finish_and_percentage() {
+    let mut p = Player::new("A");
+    assert_eq!(p.three_dart_average(), 0.0);
+    assert_eq!(p.checkout_percentage(), 0.0);
+    p.record_visit_stats(180, 3);
+    p.record_missed_doubles(3);
+    p.record_checkout(121, 1);
+    p.record_checkout(32, 0);
+    let stats = p.stats();
+    assert_eq!(stats.count_180s, 1);
+    assert_eq!(stats.highest_checkout, 121);
+    // 2 hits from 5 darts at a double (a checkout always counts at least one).
+    assert!((stats.checkout_percentage - 40.0).abs() < 1e-9);
+}
+
+#[test]
+fn scored_visits_update_the_throwers_stats() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    t.add_player("A").unwrap();
+    t.add_player("B").unwrap();
+    start_tournament(&mut t).unwrap();
+    let m = t.bracket.as_ref().unwrap().matches[0].clone();
+    let (a, b) = (m.team_1.unwrap(), m.team_2.unwrap());
+    let side_a = m.side_of(a).unwrap();
+
+    record_match_visit(&mut t, m.id, side_a, 180, 3, false, 0).unwrap();
+    record_match_visit(&mut t, m.id, side_a.other(), 100, 3, false, 0).unwrap();
+    record_match_visit(&mut t, m.id, side_a, 180, 3, false, 0).unwrap();
+    record_match_visit(&mut t, m.id, side_a.other(), 45, 3, false, 0).unwrap();
+    // 141 left: bust with 160 on two darts at the double, then finish with one.
+    record_match_visit(&mut t, m.id, side_a, 160, 3, false, 2).unwrap();
+    record_match_visit(&mut t, m.id, side_a.other(), 60, 3, false, 0).unwrap();
+    record_match_visit(&mut t, m.id, side_a, 141, 3, true, 1).unwrap();
+
+    let pa = t.find_player(a).unwrap();
+    assert_eq!((pa.points_scored, pa.darts_thrown), (501, 12));
+    assert_eq!(pa.count_180s, 2);
+    assert_eq!(pa.highest_checkout, 141);
+    assert!((pa.checkout_percentage() - 100.0 / 3.0).abs() < 1e-9);
+    let pb = t.find_player(b).unwrap();
+    assert_eq!((pb.points_scored, pb.darts_thrown), (205, 9));
+    assert_eq!(pb.checkouts, 0);
+}
+
+#[test]
+fn duplicate_add_keeps_existing_player_and_stats() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    for name in ["A", "B", "C", "D"] {
+        t.add_player(name).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    let a = t.players[0].id;
+    t.add_win(a).unwrap();
+    t.add_loss(a).unwrap();
+    t.record_sat_out(a).unwrap();
+    let before = t.players[0].clone();
+
+    assert_eq!(t.add_player("a"), Err(TournamentError::DuplicatePlayerName));
+    assert_eq!(t.players.len(), 4);
+    assert_eq!(t.players[0], before);
+    assert_eq!(
+        (before.wins, before.losses, before.times_sat_out),
+        (1, 1, 1)
+    );
+    assert_eq!(before.stats().wins, 1);
+}
+
+#[test]
+fn stat_updates_for_unknown_players_are_errors() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.add_player("A").unwrap();
+    let ghost = Uuid::new_v4();
+    assert_eq!(
+        t.add_win(ghost).err(),
+        Some(TournamentError::PlayerNotFound(ghost))
+    );
+    assert_eq!(
+        t.add_loss(ghost).err(),
+        Some(TournamentError::PlayerNotFound(ghost))
+    );
+    assert_eq!(
+        t.record_sat_out(ghost),
+        Err(TournamentError::PlayerNotFound(ghost))
+    );
+    assert_eq!((t.players[0].wins, t.players[0].losses), (0, 0));
+}
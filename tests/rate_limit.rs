@@ -0,0 +1,91 @@
+//! Integration tests for the per-client rate limiter and request body caps.
+
+use dart_tournament_web::rate_limit::{
+    body_limit, is_rate_limited, RateLimiter, MAX_AVATAR_BODY_BYTES, MAX_BODY_BYTES,
+    MAX_IMPORT_BODY_BYTES, MAX_RESTORE_BODY_BYTES,
+};
+use std::net::IpAddr;
+use std::time::{Duration, Instant};
+
+fn ip(last: u8) -> IpAddr {
+    IpAddr::from([192, 168, 1, last])
+}
+
+#[test]
+fn a_full_bucket_allows_the_burst_then_refuses() {
+    let limiter = RateLimiter::new(2.0, 5);
+    let now = Instant::now();
+    for _ in 0..5 {
+        assert_eq!(limiter.check(ip(1), now), Ok(()));
+    }
+    // Empty: the next token is half a second away at two a second.
+    assert_eq!(limiter.check(ip(1), now), Err(Duration::from_millis(500)));
+    // Other clients have their own bucket.
+    assert_eq!(limiter.check(ip(2), now), Ok(()));
+}
+
+#[test]
+fn the_bucket_refills_at_the_rate_up_to_the_burst() {
+    let limiter = RateLimiter::new(2.0, 5);
+    let start = Instant::now();
+    for _ in 0..5 {
+        limiter.check(ip(1), start).unwrap();
+    }
+    let later = start + Duration::from_secs(1);
+    assert!(limiter.check(ip(1), later).is_ok());
+    assert!(limiter.check(ip(1), later).is_ok());
+    assert!(limiter.check(ip(1), later).is_err());
+
+    // A long pause refills to the burst, no further.
+    let much_later = later + Duration::from_secs(60);
+    for _ in 0..5 {
+        assert!(limiter.check(ip(1), much_later).is_ok());
+    }
+    assert!(limiter.check(ip(1), much_later).is_err());
+}
+
+#[test]
+fn idle_clients_are_evicted() {
+    let limiter = RateLimiter::new(20.0, 40);
+    let start = Instant::now();
+    limiter.check(ip(1), start).unwrap();
+    limiter
+        .check(ip(2), start + Duration::from_secs(300))
+        .unwrap();
+    assert_eq!(limiter.len(), 2);
+    let now = start + Duration::from_secs(600);
+    assert_eq!(limiter.evict_idle(now, Duration::from_secs(600)), 1);
+    assert_eq!(limiter.len(), 1);
+    assert_eq!(limiter.evict_idle(now, Duration::from_secs(600)), 0);
+}
+
+#[test]
+fn ping_health_and_websocket_upgrades_are_exempt() {
+    assert!(is_rate_limited("/api/tournaments", None));
+    assert!(is_rate_limited("/api/site-gate", None));
+    assert!(!is_rate_limited("/ping", None));
+    assert!(!is_rate_limited("/api/health", None));
+    assert!(!is_rate_limited(
+        "/api/tournaments/1/live",
+        Some("websocket")
+    ));
+    assert!(!is_rate_limited(
+        "/api/tournaments/1/live",
+        Some("WebSocket")
+    ));
+    // Pages and static files aren't API calls.
+    assert!(!is_rate_limited("/static/app.js", None));
+    assert!(!is_rate_limited("/apiary", None));
+}
+
+#[test]
+fn imports_photos_and_restores_take_larger_bodies() {
+    assert_eq!(body_limit("/api/tournaments"), MAX_BODY_BYTES);
+    assert_eq!(
+        body_limit("/api/tournaments/3f0c/players/import"),
+        MAX_IMPORT_BODY_BYTES
+    );
+    assert_eq!(body_limit("/api/tournaments/3f0c/players"), MAX_BODY_BYTES);
+    assert_eq!(body_limit("/api/players/Ann/avatar"), MAX_AVATAR_BODY_BYTES);
+    assert_eq!(body_limit("/api/admin/restore"), MAX_RESTORE_BODY_BYTES);
+}
@@ -0,0 +1,85 @@
+//! Integration tests for Elo ratings: the formula, automatic updates, and history.
+
+use dart_tournament_web::rating::{elo_delta, latest_rating, rating_history, update_elo};
+use dart_tournament_web::{
+    record_bracket_result, start_tournament, Player, Tournament, TournamentFormat, TournamentMode,
+    DEFAULT_RATING,
+};
+use uuid::Uuid;
+
+#[test]
+fn equal_ratings_move_half_the_k_factor() {
+    assert!((elo_delta(1200.0, 1200.0, 32.0) - 16.0).abs() < 1e-9);
+}
+
+#[test]
+fn rating_changes_are_symmetric() {
+    let mut a = Player::new("A");
+    let mut b = Player::new("B");
+    b.rating = 1350.0;
+    let total = a.rating + b.rating;
+    update_elo(&mut a, &mut b, 32.0, Uuid::new_v4());
+    assert!((a.rating + b.rating - total).abs() < 1e-9);
+    let gained = a.rating_history[0].rating_after - a.rating_history[0].rating_before;
+    let lost = b.rating_history[0].rating_before - b.rating_history[0].rating_after;
+    assert!((gained - lost).abs() < 1e-9);
+    assert_eq!(a.rating_history[0].opponent, "B");
+}
+
+#[test]
+fn upsets_move_more_points_than_expected_wins() {
+    let favourite_win = elo_delta(1500.0, 1200.0, 32.0);
+    let upset = elo_delta(1200.0, 1500.0, 32.0);
+    assert!(upset > 16.0 && favourite_win < 16.0);
+    assert!((upset + favourite_win - 32.0).abs() < 1e-9);
+}
+
+#[test]
+fn bracket_results_update_ratings_and_overwrites_revert_them() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    t.rating_k = 20.0;
+    t.add_player("A").unwrap();
+    t.add_player("B").unwrap();
+    start_tournament(&mut t).unwrap();
+    let m = t.bracket.as_ref().unwrap().matches[0].clone();
+    let (a, b) = (m.team_1.unwrap(), m.team_2.unwrap());
+
+    record_bracket_result(&mut t, m.id, a, None, false).unwrap();
+    assert_eq!(t.find_player(a).unwrap().rating, DEFAULT_RATING + 10.0);
+    assert_eq!(t.find_player(b).unwrap().rating, DEFAULT_RATING - 10.0);
+
+    record_bracket_result(&mut t, m.id, b, None, true).unwrap();
+    let (pa, pb) = (t.find_player(a).unwrap(), t.find_player(b).unwrap());
+    assert_eq!(
+        (pa.rating, pb.rating),
+        (DEFAULT_RATING - 10.0, DEFAULT_RATING + 10.0)
+    );
+    assert_eq!(pa.rating_history.len(), 1, "overwritten change is dropped");
+    assert_eq!(pb.rating_history[0].match_id, m.id);
+}
+
+#[test]
+fn history_and_latest_rating_span_tournaments() {
+    let mut first = Tournament::new(3, TournamentMode::OneVOne);
+    first.add_player("Dave").unwrap();
+    first.add_player("Ann").unwrap();
+    let mut second = first.clone();
+    second.id = Uuid::new_v4();
+
+    let (dave, ann) = first.players.split_at_mut(1);
+    update_elo(&mut dave[0], &mut ann[0], 32.0, Uuid::new_v4());
+    let (dave, ann) = second.players.split_at_mut(1);
+    dave[0].rating = first.players[0].rating;
+    update_elo(&mut ann[0], &mut dave[0], 32.0, Uuid::new_v4());
+
+    let history = rating_history([&first, &second], "dave");
+    assert_eq!(history.len(), 2);
+    assert_eq!(history[0].0, first.id);
+    assert!(history[0].1.at <= history[1].1.at);
+    assert_eq!(
+        latest_rating([&first, &second], "Dave"),
+        Some(second.players[0].rating)
+    );
+    assert_eq!(latest_rating([&first], "Nobody"), None);
+}
@@ -0,0 +1,194 @@
+//! Integration tests for the tournament registry: lookups, errors, and concurrent access.
+
+use dart_tournament_web::full::FullResponse;
+use dart_tournament_web::validation::{Section, SECTIONS};
+use dart_tournament_web::{
+    record_bracket_result, start_tournament, Bracket, RegistryError, Tournament, TournamentError,
+    TournamentFormat, TournamentMode, TournamentRegistry, TournamentState,
+};
+use serde_json::Value;
+use std::sync::Arc;
+use std::thread;
+use std::time::Duration;
+use uuid::Uuid;
+
+#[test]
+fn unknown_id_is_not_found() {
+    let registry = TournamentRegistry::new();
+    let id = Uuid::new_v4();
+    assert_eq!(
+        registry.get(id).unwrap_err(),
+        RegistryError::TournamentNotFound(id)
+    );
+    assert_eq!(
+        registry.update(id, |t| t.add_player("Alice")).unwrap_err(),
+        RegistryError::TournamentNotFound(id)
+    );
+}
+
+#[test]
+fn update_returns_tournament_error() {
+    let registry = TournamentRegistry::new();
+    let t = registry
+        .insert(Tournament::new(3, TournamentMode::OneVOne))
+        .unwrap();
+    registry.update(t.id, |t| t.add_player("Alice")).unwrap();
+    assert_eq!(
+        registry
+            .update(t.id, |t| t.add_player("alice"))
+            .unwrap_err(),
+        RegistryError::Tournament(TournamentError::DuplicatePlayerName)
+    );
+    assert_eq!(registry.get(t.id).unwrap().players.len(), 1);
+}
+
+#[test]
+fn remove_inactive_drops_idle_tournaments() {
+    let registry = TournamentRegistry::new();
+    let t = registry
+        .insert(Tournament::new(3, TournamentMode::TwoVTwo))
+        .unwrap();
+    assert!(registry
+        .remove_inactive(Duration::from_secs(60))
+        .unwrap()
+        .is_empty());
+    assert_eq!(registry.remove_inactive(Duration::ZERO).unwrap(), [t.id]);
+    assert!(registry.get(t.id).is_err());
+    assert!(registry.is_empty());
+}
+
+#[test]
+fn a_read_counts_as_activity() {
+    let registry = TournamentRegistry::new();
+    let read = registry
+        .insert(Tournament::new(3, TournamentMode::OneVOne))
+        .unwrap();
+    let idle = registry
+        .insert(Tournament::new(3, TournamentMode::OneVOne))
+        .unwrap();
+    thread::sleep(Duration::from_millis(50));
+    registry.get(read.id).unwrap();
+    assert_eq!(
+        registry.remove_inactive(Duration::from_millis(40)).unwrap(),
+        [idle.id]
+    );
+    assert!(registry.get(read.id).is_ok());
+}
+
+#[test]
+fn concurrent_updates_are_not_lost() {
+    let registry = Arc::new(TournamentRegistry::new());
+    let t = registry
+        .insert(Tournament::new(3, TournamentMode::TwoVTwo))
+        .unwrap();
+
+    let handles: Vec<_> = (0..8)
+        .map(|thread_no| {
+            let registry = Arc::clone(&registry);
+            thread::spawn(move || {
+                for i in 0..50 {
+                    registry
+                        .update(t.id, |t| t.add_player(format!("T{thread_no}-P{i}")))
+                        .unwrap();
+                    registry.get(t.id).unwrap();
+                    registry.list().unwrap();
+                }
+            })
+        })
+        .collect();
+    for h in handles {
+        h.join().unwrap();
+    }
+
+    assert_eq!(registry.get(t.id).unwrap().players.len(), 8 * 50);
+}
+
+#[test]
+fn failed_update_leaves_tournament_unchanged() {
+    let registry = TournamentRegistry::new();
+    let t = registry
+        .insert(Tournament::new(3, TournamentMode::OneVOne))
+        .unwrap();
+    let err = registry
+        .update(t.id, |t| {
+            t.add_player("Alice")?;
+            t.add_player("")
+        })
+        .unwrap_err();
+    assert_eq!(
+        err,
+        RegistryError::Tournament(TournamentError::EmptyPlayerName)
+    );
+    assert!(registry.get(t.id).unwrap().players.is_empty());
+}
+
+/// Whether every part of a full read agrees with the rest: each decided match's winner is
+/// already in the match it goes on to, and the players' wins and the state version both count
+/// the decided matches (one version per result, from 0 when the tournament went in).
+fn self_consistent(full: &Value) -> bool {
+    let bracket: Bracket = serde_json::from_value(full["matches"]["bracket"].clone()).unwrap();
+    let matches = &bracket.matches;
+    let advanced = matches.iter().all(|m| {
+        let (Some(winner), Some(to)) = (m.winner_id(), m.winner_to) else {
+            return true;
+        };
+        let next = matches.iter().find(|n| n.id == to.match_id).unwrap();
+        next.player(to.team) == Some(winner)
+    });
+    let decided = matches.iter().filter(|m| m.winner.is_some()).count() as u64;
+    let players = full["players"].as_array().unwrap();
+    let wins: u64 = players
+        .iter()
+        .map(|p| p["event"]["wins"].as_u64().unwrap())
+        .sum();
+    advanced && wins == decided && full["state_version"] == decided
+}
+
+#[test]
+fn reads_taken_while_results_go_in_are_each_self_consistent() {
+    let registry = Arc::new(TournamentRegistry::new());
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    for i in 0..16 {
+        t.add_player(format!("P{i}")).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    let t = registry.insert(t).unwrap();
+
+    let writer = {
+        let registry = Arc::clone(&registry);
+        thread::spawn(move || {
+            for _ in 0..15 {
+                registry
+                    .update(t.id, |t| {
+                        let m = t.bracket.as_ref().unwrap().matches.iter();
+                        let m = m.filter(|m| m.is_ready() && m.winner.is_none());
+                        let (id, winner) = m.map(|m| (m.id, m.team_1.unwrap())).next().unwrap();
+                        record_bracket_result(t, id, winner, None, false).map(|_| ())
+                    })
+                    .unwrap();
+                thread::yield_now();
+            }
+        })
+    };
+    let sections: Vec<Section> = SECTIONS.iter().map(|&(_, section)| section).collect();
+    let mut last_version = 0;
+    let mut reads = 0;
+    loop {
+        let read = registry.get(t.id).unwrap();
+        let full = serde_json::to_value(FullResponse::new(&read, &sections)).unwrap();
+        assert!(
+            self_consistent(&full),
+            "inconsistent read at {}",
+            read.version
+        );
+        assert!(read.version >= last_version);
+        last_version = read.version;
+        reads += 1;
+        if read.state == TournamentState::Completed {
+            break;
+        }
+    }
+    writer.join().unwrap();
+    assert!(reads > 1);
+}
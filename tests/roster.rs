@@ -0,0 +1,284 @@
+//! Integration tests for renaming, merging and deleting players across tournaments.
+
+use dart_tournament_web::api_error::ApiError;
+use dart_tournament_web::archive::player_record;
+use dart_tournament_web::export::player_rows;
+use dart_tournament_web::history::{match_history, MatchQuery};
+use dart_tournament_web::roster::{
+    check_hard_delete, delete_player, hard_delete_player, player_deleted, player_exists,
+    recorded_matches, rename_player, restore_player,
+};
+use dart_tournament_web::templates::clone_tournament;
+use dart_tournament_web::{
+    leaderboard, record_bracket_result, start_tournament, LeaderboardSort, RegistryError,
+    Tournament, TournamentError, TournamentFormat, TournamentMode, TournamentRegistry,
+};
+
+fn tournament_with(names: &[&str]) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    for name in names {
+        t.add_player(*name).unwrap();
+    }
+    t
+}
+
+/// A finished two-player knockout won by `winner`.
+fn played(winner: &str, loser: &str) -> Tournament {
+    let mut t = tournament_with(&[winner, loser]);
+    start_tournament(&mut t).unwrap();
+    let m = t.bracket.as_ref().unwrap().matches[0].clone();
+    let id = t.players.iter().find(|p| p.name == winner).unwrap().id;
+    record_bracket_result(&mut t, m.id, id, None, false).unwrap();
+    t
+}
+
+fn names(t: &Tournament) -> Vec<String> {
+    t.all_players().iter().map(|p| p.name.clone()).collect()
+}
+
+#[test]
+fn rename_reaches_every_tournament_and_opponent_history() {
+    let registry = TournamentRegistry::new();
+    let first = registry.insert(played("dave", "Ann")).unwrap();
+    let second = registry.insert(played("Ann", "dave")).unwrap();
+    registry.insert(tournament_with(&["Bob"])).unwrap();
+    let dave_id = first.players.iter().find(|p| p.name == "dave").unwrap().id;
+
+    let changed = registry
+        .update_all(|t| rename_player(t, "DAVE", "David Smith", false))
+        .unwrap();
+    assert_eq!(changed, 2);
+
+    let first = registry.get(first.id).unwrap();
+    let renamed = first.find_player(dave_id).unwrap();
+    assert_eq!(renamed.name, "David Smith");
+    assert_eq!(first.bracket.as_ref().unwrap().champion(), Some(dave_id));
+    let ann = first
+        .all_players()
+        .into_iter()
+        .find(|p| p.name == "Ann")
+        .unwrap();
+    assert_eq!(ann.rating_history[0].opponent, "David Smith");
+    assert!(names(&registry.get(second.id).unwrap()).contains(&"David Smith".to_string()));
+
+    let tournaments = registry.list().unwrap();
+    assert!(!player_exists(&tournaments, "dave"));
+    let board = leaderboard(&tournaments, LeaderboardSort::Wins, 0, 10);
+    let david = board
+        .entries
+        .iter()
+        .find(|e| e.name == "David Smith")
+        .unwrap();
+    assert_eq!((david.wins, david.losses), (1, 1));
+}
+
+#[test]
+fn renaming_onto_a_taken_name_is_a_conflict_and_changes_nothing() {
+    let registry = TournamentRegistry::new();
+    let only_dave = registry.insert(tournament_with(&["dave"])).unwrap();
+    registry
+        .insert(tournament_with(&["dave", "David Smith"]))
+        .unwrap();
+
+    assert_eq!(
+        registry.update_all(|t| rename_player(t, "dave", "david smith", false)),
+        Err(RegistryError::Tournament(
+            TournamentError::DuplicatePlayerName
+        ))
+    );
+    assert_eq!(names(&registry.get(only_dave.id).unwrap()), vec!["dave"]);
+
+    // A change of case is a rename of the same player, not a clash.
+    let mut t = tournament_with(&["dave"]);
+    assert!(rename_player(&mut t, "dave", "Dave", false).unwrap());
+    assert_eq!(names(&t), vec!["Dave"]);
+}
+
+#[test]
+fn merge_combines_registrations_and_keeps_the_better_seed() {
+    let mut t = tournament_with(&["Ann", "Dave", "Bob", "dave s"]);
+    let dave = t.players[1].id;
+    t.players[3].wins = 2;
+    t.players[3].times_sat_out = 1;
+    t.set_seeds(&[
+        t.players[3].id,
+        t.players[0].id,
+        t.players[2].id,
+        t.players[1].id,
+    ])
+    .unwrap();
+
+    assert!(rename_player(&mut t, "dave s", "Dave", true).unwrap());
+    assert_eq!(names(&t), vec!["Ann", "Dave", "Bob"]);
+    let merged = t.find_player(dave).unwrap();
+    assert_eq!((merged.wins, merged.times_sat_out, merged.seed), (2, 1, 1));
+    let mut seeds: Vec<u32> = t.players.iter().map(|p| p.seed).collect();
+    seeds.sort();
+    assert_eq!(seeds, vec![1, 2, 3]);
+}
+
+#[test]
+fn merge_renames_where_only_the_source_played_and_sums_totals() {
+    let mut merged = vec![
+        played("dave", "Ann"),
+        played("Dave", "Ann"),
+        played("Ann", "dave"),
+    ];
+    for t in &mut merged {
+        rename_player(t, "dave", "Dave", true).unwrap();
+    }
+    let board = leaderboard(&merged, LeaderboardSort::Wins, 0, 10);
+    let dave = board.entries.iter().find(|e| e.name == "Dave").unwrap();
+    assert_eq!((dave.wins, dave.losses), (2, 1));
+    assert_eq!(board.total, 2);
+}
+
+#[test]
+fn players_both_drawn_in_a_started_tournament_cannot_merge() {
+    let mut t = tournament_with(&["Dave", "David Smith"]);
+    start_tournament(&mut t).unwrap();
+    assert_eq!(
+        rename_player(&mut t, "David Smith", "Dave", true),
+        Err(TournamentError::MergeAfterStart)
+    );
+    assert_eq!(
+        rename_player(&mut t, "Dave", "  ", false),
+        Err(TournamentError::EmptyPlayerName)
+    );
+}
+
+#[test]
+fn a_deleted_player_stays_in_history_but_drops_out_of_listings() {
+    let registry = TournamentRegistry::new();
+    let finished = registry.insert(played("dave", "Ann")).unwrap();
+    let setup = registry.insert(tournament_with(&["Dave", "Bob"])).unwrap();
+    let now = chrono::Utc::now();
+
+    // Still entered in a tournament that hasn't started: nothing is marked.
+    assert_eq!(
+        registry.update_all(|t| delete_player(t, "dave", now)),
+        Err(RegistryError::Tournament(
+            TournamentError::PlayerStillEntered("Dave".to_string())
+        ))
+    );
+    assert!(!player_deleted(&registry.list().unwrap(), "dave"));
+
+    registry
+        .update(setup.id, |t| {
+            let id = t.players[0].id;
+            t.remove_player(id)
+        })
+        .unwrap();
+    let changed = registry
+        .update_all(|t| delete_player(t, "DAVE", now))
+        .unwrap();
+    assert_eq!(changed, 1);
+    let tournaments = registry.list().unwrap();
+    assert!(player_deleted(&tournaments, "dave"));
+
+    // History and the leaderboard still name them; the leaderboard marks them inactive.
+    let page = match_history(&tournaments, &MatchQuery::default());
+    assert_eq!(page.matches[0].player_1, "dave");
+    let board = leaderboard(&tournaments, LeaderboardSort::Wins, 0, 10);
+    let dave = board.entries.iter().find(|e| e.name == "dave").unwrap();
+    assert!(dave.inactive && dave.wins == 1);
+    assert!(!board.entries.iter().any(|e| e.name == "Ann" && e.inactive));
+    assert_eq!(
+        player_record(&tournaments, "dave").unwrap().deleted_at,
+        Some(now)
+    );
+    // The player export and a new draw from the finished tournament leave them out.
+    let rows: Vec<String> = player_rows(&tournaments)
+        .into_iter()
+        .map(|r| r.name)
+        .collect();
+    assert_eq!(rows, ["Ann", "Bob"]);
+    let finished = registry.get(finished.id).unwrap();
+    assert_eq!(names(&clone_tournament(&finished, true).unwrap()), ["Ann"]);
+
+    // Registering a new player under that name is a conflict pointing at the restore.
+    let e = ApiError::from(TournamentError::PlayerDeleted("dave".to_string()));
+    assert_eq!((e.status, e.code), (409, "player_deleted"));
+    assert_eq!(e.details["restore"], "/api/players/dave/restore");
+
+    assert_eq!(
+        registry.update_all(|t| Ok(restore_player(t, "Dave"))),
+        Ok(1)
+    );
+    let tournaments = registry.list().unwrap();
+    assert!(!player_deleted(&tournaments, "dave"));
+    assert_eq!(player_rows(&tournaments).len(), 3);
+}
+
+#[test]
+fn a_delete_racing_an_entry_never_leaves_a_deleted_player_entered() {
+    // The entry checks the name under the same lock it adds the player under, so whichever
+    // of the two goes second sees the other: refused, or left undone.
+    for _ in 0..50 {
+        let registry = std::sync::Arc::new(TournamentRegistry::new());
+        registry.insert(played("Eve", "Ann")).unwrap();
+        let setup = registry.insert(tournament_with(&["Bob"])).unwrap();
+        let barrier = std::sync::Arc::new(std::sync::Barrier::new(2));
+        let deleting = {
+            let (registry, barrier) = (registry.clone(), barrier.clone());
+            std::thread::spawn(move || {
+                barrier.wait();
+                let now = chrono::Utc::now();
+                let _ = registry.update_all(|t| delete_player(t, "Eve", now));
+            })
+        };
+        barrier.wait();
+        let entered = registry.update_if_seeing_all(setup.id, None, |all, t| {
+            if player_deleted(all.iter().copied(), "Eve") {
+                return Err(TournamentError::PlayerDeleted("Eve".to_string()));
+            }
+            t.add_player("Eve")
+        });
+        deleting.join().unwrap();
+
+        let tournaments = registry.list().unwrap();
+        let in_setup = names(&registry.get(setup.id).unwrap()).contains(&"Eve".to_string());
+        assert!(!(in_setup && player_deleted(&tournaments, "Eve")));
+        assert_eq!(entered.is_ok(), in_setup);
+    }
+
+    // A rename's check runs under its lock too: a failing one changes nothing.
+    let registry = TournamentRegistry::new();
+    registry.insert(tournament_with(&["Ann"])).unwrap();
+    assert_eq!(
+        registry.update_all_checked(
+            |_| Err(TournamentError::PlayerDeleted("Bea".to_string())),
+            |t| rename_player(t, "Ann", "Bea", false),
+        ),
+        Err(RegistryError::Tournament(TournamentError::PlayerDeleted(
+            "Bea".to_string()
+        )))
+    );
+    assert!(player_exists(&registry.list().unwrap(), "Ann"));
+}
+
+#[test]
+fn only_a_player_with_no_recorded_matches_is_deleted_for_good() {
+    let mut tournaments = vec![played("dave", "Ann"), tournament_with(&["Cy", "Ann"])];
+    assert_eq!(recorded_matches(&tournaments, "ann"), 1);
+    assert_eq!(
+        check_hard_delete(&tournaments, "Ann"),
+        Err(TournamentError::PlayerHasMatches { matches: 1 })
+    );
+
+    // Cy has only registered, so goes without a trace.
+    assert_eq!(check_hard_delete(&tournaments, "cy"), Ok(()));
+    assert!(hard_delete_player(&mut tournaments[1], "cy").unwrap());
+    assert!(!player_exists(&tournaments, "Cy"));
+
+    // Drawn but yet to play is still a draw to leave a hole in.
+    let mut started = tournament_with(&["Ann", "Bob", "Cy", "Di"]);
+    start_tournament(&mut started).unwrap();
+    assert_eq!(
+        check_hard_delete([&started], "di"),
+        Err(TournamentError::PlayerStillEntered("Di".to_string()))
+    );
+    let e = ApiError::from(TournamentError::PlayerHasMatches { matches: 1 });
+    assert_eq!((e.status, e.code), (409, "player_has_matches"));
+}
@@ -0,0 +1,95 @@
+//! Integration tests for round-robin schedule generation.
+
+use dart_tournament_web::{
+    generate_round_robin, start_tournament, Player, PlayerId, Tournament, TournamentFormat,
+    TournamentMode, TournamentState,
+};
+use std::collections::HashSet;
+
+fn seeded_players(n: usize) -> Vec<Player> {
+    (0..n)
+        .map(|i| {
+            let mut p = Player::new(format!("P{}", i + 1));
+            p.seed = i as u32 + 1;
+            p
+        })
+        .collect()
+}
+
+#[test]
+fn everyone_meets_everyone_once_for_3_to_12_players() {
+    for n in 3..=12 {
+        let mut players = seeded_players(n);
+        let rounds = generate_round_robin(&mut players).unwrap();
+        let expected_rounds = if n % 2 == 0 { n - 1 } else { n };
+        assert_eq!(rounds.len(), expected_rounds, "n={n}");
+
+        let mut pairs = HashSet::new();
+        for r in &rounds {
+            let mut seen = HashSet::new();
+            for m in &r.matches {
+                let (a, b) = (m.team_1.unwrap(), m.team_2.unwrap());
+                assert!(
+                    seen.insert(a) && seen.insert(b),
+                    "n={n}: player twice in a round"
+                );
+                assert!(
+                    pairs.insert(if a < b { (a, b) } else { (b, a) }),
+                    "n={n}: repeat"
+                );
+            }
+            if let Some(p) = r.sat_out {
+                assert!(seen.insert(p), "n={n}: sit-out also playing");
+            }
+            assert_eq!(seen.len(), n, "n={n}: someone missing from a round");
+        }
+        assert_eq!(pairs.len(), n * (n - 1) / 2, "n={n}");
+    }
+}
+
+#[test]
+fn odd_counts_sit_everyone_out_exactly_once() {
+    for n in [3, 5, 7, 9, 11] {
+        let mut players = seeded_players(n);
+        let rounds = generate_round_robin(&mut players).unwrap();
+        let sat_out: Vec<PlayerId> = rounds.iter().filter_map(|r| r.sat_out).collect();
+        assert_eq!(sat_out.len(), n, "n={n}");
+        assert_eq!(sat_out.iter().collect::<HashSet<_>>().len(), n, "n={n}");
+        assert!(players.iter().all(|p| p.times_sat_out == 1), "n={n}");
+    }
+    let mut even = seeded_players(6);
+    let rounds = generate_round_robin(&mut even).unwrap();
+    assert!(rounds.iter().all(|r| r.sat_out.is_none()));
+    assert!(even.iter().all(|p| p.times_sat_out == 0));
+}
+
+#[test]
+fn schedule_is_stable_for_the_same_input() {
+    let players = seeded_players(7);
+    let fixtures = |mut players: Vec<Player>| -> Vec<_> {
+        generate_round_robin(&mut players)
+            .unwrap()
+            .into_iter()
+            .map(|r| {
+                let pairs: Vec<_> = r.matches.iter().map(|m| (m.team_1, m.team_2)).collect();
+                (r.round, pairs, r.sat_out)
+            })
+            .collect()
+    };
+    assert_eq!(fixtures(players.clone()), fixtures(players));
+}
+
+#[test]
+fn start_round_robin_stores_schedule_with_sit_outs() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::RoundRobin;
+    for name in ["A", "B", "C", "D", "E"] {
+        t.add_player(name).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    assert_eq!(t.state, TournamentState::BracketPlay);
+    let b = t.bracket.as_ref().unwrap();
+    assert_eq!(b.round_count(), 5);
+    assert_eq!(b.matches.iter().filter(|m| !m.bye).count(), 10);
+    assert_eq!(b.matches.iter().filter(|m| m.bye).count(), 5);
+}
@@ -0,0 +1,298 @@
+//! Integration tests for 501 scoring: busts, double-out, best-of matches, match results, and
+//! checkout suggestions.
+
+use dart_tournament_web::scoring::{
+    checkout_route, Dart, Leg, ScoringError, VisitOutcome, X01Match, BOGEY_NUMBERS,
+};
+use dart_tournament_web::{
+    record_match_visit, start_tournament, Team, Tournament, TournamentFormat, TournamentMode,
+    TournamentState,
+};
+
+/// Leg where side one needs `remaining` and is to throw.
+fn leg_on(remaining: u32) -> Leg {
+    let mut leg = Leg::new(501, Team::One);
+    leg.remaining_1 = remaining;
+    leg
+}
+
+#[test]
+fn scoring_visit_counts_down_and_passes_turn() {
+    let mut leg = Leg::new(501, Team::One);
+    assert_eq!(
+        leg.record_visit(Team::One, 140, 3, false),
+        Ok(VisitOutcome::Scored)
+    );
+    assert_eq!(leg.remaining(Team::One), 361);
+    assert_eq!(leg.thrower, Team::Two);
+    assert_eq!(
+        leg.record_visit(Team::One, 60, 3, false),
+        Err(ScoringError::NotYourTurn)
+    );
+}
+
+#[test]
+fn scores_outside_0_to_180_are_rejected() {
+    let mut leg = Leg::new(501, Team::One);
+    assert_eq!(
+        leg.record_visit(Team::One, 181, 3, false),
+        Err(ScoringError::InvalidScore)
+    );
+    assert_eq!(
+        leg.record_visit(Team::One, 0, 4, false),
+        Err(ScoringError::InvalidDarts)
+    );
+    assert_eq!(
+        leg.record_visit(Team::One, 0, 3, false),
+        Ok(VisitOutcome::Scored)
+    );
+}
+
+#[test]
+fn going_below_zero_is_a_bust() {
+    let mut leg = leg_on(40);
+    assert_eq!(
+        leg.record_visit(Team::One, 60, 3, false),
+        Ok(VisitOutcome::Bust)
+    );
+    assert_eq!(leg.remaining(Team::One), 40);
+    assert_eq!(leg.visits[0].score, 0);
+    assert_eq!(leg.thrower, Team::Two);
+}
+
+#[test]
+fn leaving_one_is_a_bust() {
+    let mut leg = leg_on(41);
+    assert_eq!(
+        leg.record_visit(Team::One, 40, 3, false),
+        Ok(VisitOutcome::Bust)
+    );
+    assert_eq!(leg.remaining(Team::One), 41);
+}
+
+#[test]
+fn reaching_zero_without_a_double_is_a_bust() {
+    let mut leg = leg_on(60);
+    assert_eq!(
+        leg.record_visit(Team::One, 60, 1, false),
+        Ok(VisitOutcome::Bust)
+    );
+    assert_eq!(leg.remaining(Team::One), 60);
+    assert_eq!(leg.winner, None);
+}
+
+#[test]
+fn exact_finish_on_a_double_wins_the_leg() {
+    let mut leg = leg_on(40);
+    assert_eq!(
+        leg.record_visit(Team::One, 40, 1, true),
+        Ok(VisitOutcome::Checkout)
+    );
+    assert_eq!(leg.winner, Some(Team::One));
+    assert_eq!(leg.remaining(Team::One), 0);
+    assert_eq!(
+        leg.record_visit(Team::Two, 60, 3, false),
+        Err(ScoringError::MatchFinished)
+    );
+}
+
+#[test]
+fn impossible_checkouts_are_rejected() {
+    // 60 with one dart cannot end on a double (highest one-dart finish is the bull).
+    assert_eq!(
+        leg_on(60).record_visit(Team::One, 60, 1, true),
+        Err(ScoringError::InvalidScore)
+    );
+    // 180 can only be three treble 20s.
+    assert_eq!(
+        leg_on(180).record_visit(Team::One, 180, 3, true),
+        Err(ScoringError::InvalidScore)
+    );
+    assert_eq!(
+        leg_on(170).record_visit(Team::One, 170, 3, true),
+        Ok(VisitOutcome::Checkout)
+    );
+    // No three darts finish a bogey number, even though each is under 170.
+    for bogey in BOGEY_NUMBERS {
+        assert_eq!(
+            leg_on(bogey).record_visit(Team::One, bogey, 3, true),
+            Err(ScoringError::InvalidScore),
+            "{}",
+            bogey
+        );
+    }
+    // One dart only finishes an even score up to 40, or the bull.
+    for (remaining, darts) in [(45, 1), (41, 1), (3, 1), (42, 1)] {
+        assert_eq!(
+            leg_on(remaining).record_visit(Team::One, remaining, darts, true),
+            Err(ScoringError::InvalidScore),
+            "{}/{}",
+            remaining,
+            darts
+        );
+    }
+    assert_eq!(
+        leg_on(50).record_visit(Team::One, 50, 1, true),
+        Ok(VisitOutcome::Checkout)
+    );
+    // Two darts top out at 110 (T20 Bull) and miss some scores below it.
+    for remaining in [109, 108, 106, 105, 103, 102, 99] {
+        assert_eq!(
+            leg_on(remaining).record_visit(Team::One, remaining, 2, true),
+            Err(ScoringError::InvalidScore),
+            "{}",
+            remaining
+        );
+    }
+    assert_eq!(
+        leg_on(100).record_visit(Team::One, 100, 2, true),
+        Ok(VisitOutcome::Checkout)
+    );
+    // Fewer than three darts only when the visit ends the leg or busts.
+    assert_eq!(
+        leg_on(301).record_visit(Team::One, 100, 2, false),
+        Err(ScoringError::InvalidDarts)
+    );
+}
+
+#[test]
+fn best_of_three_alternates_throw_and_needs_two_legs() {
+    assert_eq!(X01Match::new(2, 501), Err(ScoringError::InvalidBestOf));
+    let mut m = X01Match::new(3, 101).unwrap();
+    m.record_visit(Team::One, 101, 3, true).unwrap();
+    assert_eq!(m.winner, None);
+    assert_eq!(m.legs.len(), 2);
+    assert_eq!(m.current_leg().thrower, Team::Two);
+    m.record_visit(Team::Two, 60, 3, false).unwrap();
+    m.record_visit(Team::One, 101, 3, true).unwrap();
+    assert_eq!(m.winner, Some(Team::One));
+    assert_eq!((m.legs_won.team_1, m.legs_won.team_2), (2, 0));
+    assert_eq!(
+        m.record_visit(Team::Two, 60, 3, false),
+        Err(ScoringError::MatchFinished)
+    );
+}
+
+#[test]
+fn winning_a_scored_bracket_match_records_the_result() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    t.add_player("A").unwrap();
+    t.add_player("B").unwrap();
+    start_tournament(&mut t).unwrap();
+    let final_id = t.bracket.as_ref().unwrap().matches[0].id;
+
+    // Two legs of 501 for side one: 180, 180, 141 checkout; side two throws in between.
+    for leg in 0..2 {
+        let visits: &[(Team, u32, bool)] = if leg == 0 {
+            &[
+                (Team::One, 180, false),
+                (Team::Two, 60, false),
+                (Team::One, 180, false),
+                (Team::Two, 60, false),
+                (Team::One, 141, true),
+            ]
+        } else {
+            &[
+                (Team::Two, 60, false),
+                (Team::One, 180, false),
+                (Team::Two, 60, false),
+                (Team::One, 180, false),
+                (Team::Two, 60, false),
+                (Team::One, 141, true),
+            ]
+        };
+        for &(team, score, double_out) in visits {
+            record_match_visit(&mut t, final_id, team, score, 3, double_out, 0).unwrap();
+        }
+    }
+
+    assert_eq!(t.state, TournamentState::Completed);
+    let m = &t.bracket.as_ref().unwrap().matches[0];
+    assert_eq!(m.winner, Some(Team::One));
+    assert_eq!(m.score.map(|s| (s.team_1, s.team_2)), Some((2, 0)));
+    assert_eq!(t.players[0].wins, 1);
+}
+
+/// Fewest darts that finish `remaining` on a double, found by trying every dart.
+fn fewest_darts(remaining: u32) -> Option<usize> {
+    let mut darts: Vec<u32> = (1..=20).flat_map(|n| [n, 2 * n, 3 * n]).collect();
+    darts.push(25);
+    let doubles: Vec<u32> = (1..=20).map(|n| 2 * n).chain([50]).collect();
+    let finishes = |score: u32| doubles.contains(&score);
+    if finishes(remaining) {
+        return Some(1);
+    }
+    if darts
+        .iter()
+        .any(|a| *a < remaining && finishes(remaining - a))
+    {
+        return Some(2);
+    }
+    let three = darts.iter().any(|a| {
+        darts
+            .iter()
+            .any(|b| a + b < remaining && finishes(remaining - a - b))
+    });
+    three.then_some(3)
+}
+
+#[test]
+fn every_checkout_adds_up_ends_on_a_double_and_uses_the_fewest_darts() {
+    for remaining in 2..=170 {
+        let route = checkout_route(remaining, 3);
+        assert_eq!(
+            route.as_ref().map(Vec::len),
+            fewest_darts(remaining),
+            "{}",
+            remaining
+        );
+        let Some(route) = route else {
+            assert!(BOGEY_NUMBERS.contains(&remaining), "{}", remaining);
+            continue;
+        };
+        assert_eq!(route.iter().map(|d| d.value()).sum::<u32>(), remaining);
+        assert!(route.last().unwrap().is_double(), "{}", remaining);
+    }
+}
+
+#[test]
+fn no_checkout_for_bogey_numbers_or_above_170() {
+    for remaining in BOGEY_NUMBERS.iter().copied().chain([0, 1, 171, 180, 501]) {
+        assert_eq!(checkout_route(remaining, 3), None, "{}", remaining);
+    }
+    assert_eq!(checkout_route(40, 0), None);
+    assert_eq!(checkout_route(40, 4), None);
+}
+
+#[test]
+fn preferred_routes_are_suggested() {
+    let route = |remaining, darts| {
+        checkout_route(remaining, darts).map(|r| r.iter().map(Dart::to_string).collect::<Vec<_>>())
+    };
+    assert_eq!(route(170, 3).unwrap(), vec!["T20", "T20", "Bull"]);
+    assert_eq!(route(120, 3).unwrap(), vec!["T20", "20", "D20"]);
+    assert_eq!(route(32, 3).unwrap(), vec!["D16"]);
+    assert_eq!(route(37, 3).unwrap(), vec!["5", "D16"]);
+    for even in (2..=40).step_by(2) {
+        assert_eq!(checkout_route(even, 3), Some(vec![Dart::Double(even / 2)]));
+    }
+    assert_eq!(
+        serde_json::to_value(checkout_route(125, 3)).unwrap(),
+        serde_json::json!(["25", "T20", "D20"])
+    );
+}
+
+#[test]
+fn fewer_darts_limit_what_can_be_finished() {
+    assert_eq!(checkout_route(50, 1), Some(vec![Dart::Bull]));
+    assert_eq!(checkout_route(40, 1), Some(vec![Dart::Double(20)]));
+    assert_eq!(checkout_route(41, 1), None);
+    assert_eq!(
+        checkout_route(110, 2),
+        Some(vec![Dart::Treble(20), Dart::Bull])
+    );
+    assert_eq!(checkout_route(99, 2), None);
+    assert_eq!(checkout_route(120, 2), None);
+    assert_eq!(checkout_route(120, 3).map(|r| r.len()), Some(3));
+}
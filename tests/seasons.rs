@@ -0,0 +1,181 @@
+//! Integration tests for league seasons: points per week, best weeks, and tie-breaks.
+
+use dart_tournament_web::seasons::{season_standings, PointsTable, Season, SeasonError};
+use dart_tournament_web::{
+    finish_tournament, record_bracket_result, start_tournament, PlayerId, Tournament,
+    TournamentFormat, TournamentMode,
+};
+
+fn player(t: &Tournament, name: &str) -> PlayerId {
+    t.all_players()
+        .into_iter()
+        .find(|p| p.name == name)
+        .unwrap()
+        .id
+}
+
+/// `winner` beats `loser` in their bracket match.
+fn beat(t: &mut Tournament, winner: &str, loser: &str) {
+    let (w, l) = (player(t, winner), player(t, loser));
+    let id = t
+        .bracket
+        .as_ref()
+        .unwrap()
+        .matches
+        .iter()
+        .find(|m| m.side_of(w).is_some() && m.side_of(l).is_some())
+        .unwrap()
+        .id;
+    record_bracket_result(t, id, w, None, false).unwrap();
+}
+
+/// A four-player knockout where the seeds hold: first seed wins, second is runner-up, and the
+/// other two share third. Seeds go in the order given.
+fn week(seeds: [&str; 4], finish: bool) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    for name in seeds {
+        t.add_player(name).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    beat(&mut t, seeds[0], seeds[3]);
+    beat(&mut t, seeds[1], seeds[2]);
+    beat(&mut t, seeds[0], seeds[1]);
+    if finish {
+        finish_tournament(&mut t).unwrap();
+    }
+    t
+}
+
+#[test]
+fn finished_tournaments_become_weeks_of_points() {
+    let mut season = Season::new(" Winter league ", PointsTable::default(), None).unwrap();
+    assert_eq!(season.name, "Winter league");
+
+    let unfinished = week(["A", "B", "C", "D"], false);
+    assert_eq!(
+        season.attach(&unfinished).unwrap_err(),
+        SeasonError::TournamentNotFinished(unfinished.id)
+    );
+    let first = week(["A", "B", "C", "D"], true);
+    season.attach(&first).unwrap();
+    assert_eq!(
+        season.attach(&first).unwrap_err(),
+        SeasonError::AlreadyAttached(first.id)
+    );
+    let points: Vec<(&str, u32, u32, u32)> = season.weeks[0]
+        .results
+        .iter()
+        .map(|r| (r.player.as_str(), r.place, r.points, r.wins))
+        .collect();
+    assert_eq!(
+        points,
+        [
+            ("A", 1, 12, 2),
+            ("B", 2, 9, 1),
+            ("C", 3, 7, 0),
+            ("D", 3, 7, 0)
+        ]
+    );
+    assert_eq!(season.weeks[0].meetings.len(), 3);
+
+    // Beyond the table, taking part is worth the participation points.
+    let table = PointsTable {
+        places: vec![3, 2],
+        participation: 1,
+    };
+    assert_eq!(
+        (table.points(1), table.points(3), table.points(9)),
+        (3, 1, 1)
+    );
+    for bad in [
+        PointsTable {
+            places: vec![],
+            participation: 0,
+        },
+        PointsTable {
+            places: vec![5, 7],
+            participation: 0,
+        },
+        PointsTable {
+            places: vec![5, 1],
+            participation: 2,
+        },
+    ] {
+        assert_eq!(
+            Season::new("", bad, None).unwrap_err(),
+            SeasonError::InvalidPointsTable
+        );
+    }
+    assert_eq!(
+        Season::new("", PointsTable::default(), Some(0)).unwrap_err(),
+        SeasonError::InvalidBestOf
+    );
+}
+
+#[test]
+fn ties_go_to_wins_then_the_final_week_head_to_head() {
+    let mut season = Season::new("", PointsTable::default(), None).unwrap();
+    season.attach(&week(["A", "B", "C", "D"], true)).unwrap();
+    season.attach(&week(["B", "A", "C", "D"], true)).unwrap();
+
+    let table = season_standings(&season, None).unwrap();
+    let rows: Vec<(u32, &str, u32, u32)> = table
+        .standings
+        .iter()
+        .map(|s| (s.rank, s.player.as_str(), s.points, s.wins))
+        .collect();
+    // A and B are level on points and wins; B beat A in the final week's final. C and D
+    // never met, so they share third.
+    assert_eq!(
+        rows,
+        [
+            (1, "B", 21, 3),
+            (2, "A", 21, 3),
+            (3, "C", 14, 0),
+            (3, "D", 14, 0)
+        ]
+    );
+}
+
+#[test]
+fn best_weeks_drop_the_worst_including_missed_ones() {
+    let mut season = Season::new("", PointsTable::default(), Some(2)).unwrap();
+    season.attach(&week(["A", "B", "C", "D"], true)).unwrap();
+    season.attach(&week(["B", "A", "C", "D"], true)).unwrap();
+    season.attach(&week(["C", "D", "E", "F"], true)).unwrap();
+
+    let best = season_standings(&season, None).unwrap();
+    assert_eq!((best.weeks, best.counted_weeks), (3, 2));
+    let rows: Vec<(&str, u32, u32)> = best
+        .standings
+        .iter()
+        .map(|s| (s.player.as_str(), s.points, s.total_points))
+        .collect();
+    assert_eq!(
+        rows,
+        [
+            ("A", 21, 21),
+            ("B", 21, 21),
+            ("C", 19, 26),
+            ("D", 16, 23),
+            ("E", 7, 7),
+            ("F", 7, 7),
+        ]
+    );
+    // A and B didn't meet in the final week, so they stay level.
+    assert_eq!((best.standings[0].rank, best.standings[1].rank), (1, 1));
+    let a = &best.standings[0];
+    assert_eq!(a.weeks_played, 2);
+    let counted: Vec<(Option<u32>, bool)> = a.weeks.iter().map(|w| (w.place, w.counted)).collect();
+    assert_eq!(counted, [(Some(1), true), (Some(2), true), (None, false)]);
+
+    // Every week counted when asked, whatever the season's own setting.
+    let all = season_standings(&season, Some(10)).unwrap();
+    assert_eq!(all.counted_weeks, 3);
+    assert_eq!(all.standings[0].player, "C");
+    assert_eq!(
+        season_standings(&season, Some(0)).unwrap_err(),
+        SeasonError::InvalidBestOf
+    );
+}
@@ -0,0 +1,96 @@
+//! Integration tests for seeds: registration order, compaction, manual and stats-based seeding.
+
+use dart_tournament_web::{
+    reseed_by_stats, start_tournament, Player, PlayerId, Tournament, TournamentError,
+    TournamentFormat, TournamentMode,
+};
+use uuid::Uuid;
+
+fn setup(names: &[&str]) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    for name in names {
+        t.add_player(*name).unwrap();
+    }
+    t
+}
+
+fn seeds(t: &Tournament) -> Vec<(&str, u32)> {
+    t.players
+        .iter()
+        .map(|p| (p.name.as_str(), p.seed))
+        .collect()
+}
+
+fn id(t: &Tournament, name: &str) -> PlayerId {
+    t.players.iter().find(|p| p.name == name).unwrap().id
+}
+
+#[test]
+fn players_are_seeded_in_registration_order() {
+    let t = setup(&["A", "B", "C"]);
+    assert_eq!(seeds(&t), vec![("A", 1), ("B", 2), ("C", 3)]);
+}
+
+#[test]
+fn removing_a_player_closes_the_gap() {
+    let mut t = setup(&["A", "B", "C", "D"]);
+    t.remove_player(id(&t, "B")).unwrap();
+    assert_eq!(seeds(&t), vec![("A", 1), ("C", 2), ("D", 3)]);
+    t.add_player("E").unwrap();
+    assert_eq!(t.players[3].seed, 4);
+}
+
+#[test]
+fn set_seeds_reorders_and_the_bracket_follows() {
+    let mut t = setup(&["A", "B", "C", "D"]);
+    let order = [id(&t, "D"), id(&t, "C"), id(&t, "B"), id(&t, "A")];
+    t.set_seeds(&order).unwrap();
+    assert_eq!(seeds(&t), vec![("A", 4), ("B", 3), ("C", 2), ("D", 1)]);
+
+    start_tournament(&mut t).unwrap();
+    assert_eq!(t.players[3].seed, 1, "start keeps custom seeds");
+    let first = t.bracket.as_ref().unwrap().round(1).next().unwrap().clone();
+    // Seed 1 (D) meets seed 4 (A).
+    assert_eq!(
+        (first.team_1, first.team_2),
+        (Some(order[0]), Some(order[3]))
+    );
+}
+
+#[test]
+fn set_seeds_rejects_bad_orders_and_is_locked_after_start() {
+    let mut t = setup(&["A", "B", "C"]);
+    let (a, b, c) = (id(&t, "A"), id(&t, "B"), id(&t, "C"));
+    assert_eq!(t.set_seeds(&[a, b]), Err(TournamentError::InvalidSeedOrder));
+    assert_eq!(
+        t.set_seeds(&[a, b, b]),
+        Err(TournamentError::InvalidSeedOrder)
+    );
+    let ghost = Uuid::new_v4();
+    assert_eq!(
+        t.set_seeds(&[a, b, ghost]),
+        Err(TournamentError::PlayerNotFound(ghost))
+    );
+    assert_eq!(seeds(&t), vec![("A", 1), ("B", 2), ("C", 3)]);
+
+    start_tournament(&mut t).unwrap();
+    assert_eq!(t.set_seeds(&[c, b, a]), Err(TournamentError::SeedingLocked));
+}
+
+#[test]
+fn reseed_by_stats_uses_win_percentage_then_average() {
+    let mut players: Vec<Player> = ["A", "B", "C", "D"]
+        .iter()
+        .map(|n| Player::new(*n))
+        .collect();
+    // A: 1-1, B: 3-1, C: no games, D: 1-1 with a better average than A.
+    (players[0].wins, players[0].losses) = (1, 1);
+    (players[1].wins, players[1].losses) = (3, 1);
+    (players[3].wins, players[3].losses) = (1, 1);
+    players[0].record_visit_stats(45, 3);
+    players[3].record_visit_stats(60, 3);
+    reseed_by_stats(&mut players);
+    let by_name: Vec<(&str, u32)> = players.iter().map(|p| (p.name.as_str(), p.seed)).collect();
+    assert_eq!(by_name, vec![("A", 3), ("B", 1), ("C", 4), ("D", 2)]);
+}
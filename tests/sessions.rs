@@ -0,0 +1,111 @@
+//! Integration tests for casual sessions and their sit-out rotation.
+
+use dart_tournament_web::sessions::{Session, SessionError};
+use dart_tournament_web::{TournamentError, TournamentMode};
+use rand::rngs::StdRng;
+use rand::{Rng, SeedableRng};
+
+fn names(n: usize) -> Vec<String> {
+    (1..=n).map(|i| format!("P{}", i)).collect()
+}
+
+fn spread(session: &Session, counter: impl Fn(&dart_tournament_web::Player) -> i64) -> i64 {
+    let counts: Vec<i64> = session.players.iter().map(counter).collect();
+    counts.iter().max().unwrap() - counts.iter().min().unwrap()
+}
+
+#[test]
+fn sit_outs_stay_within_one_over_a_hundred_games() {
+    for seed in 0..20 {
+        let mut rng = StdRng::seed_from_u64(seed);
+        let mode = if rng.gen_bool(0.5) {
+            TournamentMode::OneVOne
+        } else {
+            TournamentMode::TwoVTwo
+        };
+        let players = rng.gen_range(5..=13);
+        let games_per_round = rng.gen_range(1..=3);
+        let mut session = Session::new("Casual", mode, games_per_round, &names(players)).unwrap();
+        for _ in 0..100 {
+            let game = session.next_game(&mut rng).unwrap().clone();
+            let per_match = session.players_per_match();
+            let playing: usize = game
+                .matches
+                .iter()
+                .map(|m| m.team_1.len() + m.team_2.len())
+                .sum();
+            assert_eq!(playing + game.sitting_out.len(), players);
+            assert!(game.matches.len() <= games_per_round);
+            assert!(game.matches.iter().all(|m| m.team_1.len() == per_match / 2));
+            assert!(
+                spread(&session, |p| p.times_sat_out.into()) <= 1,
+                "seed {seed}"
+            );
+        }
+        assert_eq!(session.games, 100);
+    }
+}
+
+#[test]
+fn arrivals_play_first_and_then_rotate_fairly() {
+    let mut rng = StdRng::seed_from_u64(7);
+    // Five players, one 1v1 game at a time: three sit out each game.
+    let mut session = Session::new("", TournamentMode::OneVOne, 1, &names(5)).unwrap();
+    for _ in 0..10 {
+        session.next_game(&mut rng).unwrap();
+    }
+    let first = session.players[0].id;
+    session.leave(first).unwrap();
+    session.join("Late").unwrap();
+    assert_eq!(
+        session.join("late").unwrap_err(),
+        SessionError::Tournament(TournamentError::DuplicatePlayerName)
+    );
+
+    let game = session.next_game(&mut rng).unwrap();
+    assert!(!game.sitting_out.contains(&"Late".to_string()));
+    for _ in 0..50 {
+        session.next_game(&mut rng).unwrap();
+        assert!(spread(&session, |p| p.internal_times_sat_out.into()) <= 1);
+    }
+    // The late arrival didn't sit out to catch up: of the 51 games since they came, they sat
+    // out about as many as the others, three in five.
+    let late = session.players.iter().find(|p| p.name == "Late").unwrap();
+    let p2 = session.players.iter().find(|p| p.name == "P2").unwrap();
+    assert!(
+        (29..=32).contains(&late.times_sat_out),
+        "{}",
+        late.times_sat_out
+    );
+    assert!(p2.times_sat_out >= late.times_sat_out + 5);
+
+    // Leaving and joining between games keeps everyone present within one.
+    for i in 0..30 {
+        if i % 3 == 0 {
+            session.join(&format!("Guest {}", i)).unwrap();
+        } else if i % 3 == 1 && session.players.len() > 3 {
+            let id = session.players[rng.gen_range(0..session.players.len())].id;
+            session.leave(id).unwrap();
+        }
+        session.next_game(&mut rng).unwrap();
+        assert!(spread(&session, |p| p.internal_times_sat_out.into()) <= 1);
+    }
+}
+
+#[test]
+fn a_game_needs_enough_players() {
+    let mut rng = StdRng::seed_from_u64(1);
+    let mut session = Session::new("", TournamentMode::TwoVTwo, 2, &names(3)).unwrap();
+    assert_eq!(
+        session.next_game(&mut rng).unwrap_err(),
+        SessionError::Tournament(TournamentError::NotEnoughPlayers)
+    );
+    session.join("P4").unwrap();
+    let game = session.next_game(&mut rng).unwrap();
+    assert_eq!((game.number, game.matches.len()), (1, 1));
+    assert!(game.sitting_out.is_empty());
+    assert_eq!(
+        Session::new("", TournamentMode::OneVOne, 0, &names(4)).unwrap_err(),
+        SessionError::InvalidGamesPerRound
+    );
+}
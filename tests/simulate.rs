@@ -0,0 +1,104 @@
+//! Integration tests for simulated tournaments: what a format makes of the entrants, and that
+//! the tournament itself is never touched.
+
+use dart_tournament_web::simulate::{simulate, Outcomes, SimulationSettings};
+use dart_tournament_web::{
+    start_tournament, Tournament, TournamentError, TournamentFormat, TournamentMode,
+};
+
+fn tournament(format: TournamentFormat, players: usize) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = format;
+    for i in 1..=players {
+        t.add_player(format!("P{i}").as_str()).unwrap();
+    }
+    t
+}
+
+#[test]
+fn a_seeded_eight_player_knockout_plays_out_the_same_every_time() {
+    let t = tournament(TournamentFormat::SingleElimination, 8);
+    let before = serde_json::to_value(&t).unwrap();
+    let settings = SimulationSettings {
+        outcomes: Outcomes::Seeded,
+        boards: 2,
+        seed: Some(7),
+        ..Default::default()
+    };
+    let s = simulate(&t, &settings).unwrap();
+    assert_eq!((s.seed, s.boards, s.matches, s.rounds), (7, 2, 7, 3));
+    // Best of 3 at 5 minutes a leg: 15 legs, 9 of them one after another on two boards.
+    assert_eq!((s.legs, s.estimated_minutes), (15, 45));
+    assert_eq!(s.champion.as_deref(), Some("P1"));
+    let games: Vec<u32> = s.entrants.iter().map(|e| e.games).collect();
+    assert_eq!(games, [3, 3, 2, 2, 1, 1, 1, 1]);
+    let places: Vec<Option<u32>> = s.entrants.iter().map(|e| e.place).collect();
+    assert_eq!(places, [1, 2, 3, 3, 5, 5, 5, 5].map(Some));
+    assert!(s.entrants.iter().all(|e| e.minimum_games == 1));
+
+    assert_eq!(simulate(&t, &settings), Ok(s));
+    // Nothing of it reached the tournament.
+    assert_eq!(serde_json::to_value(&t).unwrap(), before);
+}
+
+#[test]
+fn stand_ins_fill_the_night_and_each_format_guarantees_its_games() {
+    let settings = SimulationSettings {
+        boards: 3,
+        entrants: 27,
+        seed: Some(1),
+        ..Default::default()
+    };
+    let round_robin = simulate(&tournament(TournamentFormat::RoundRobin, 5), &settings).unwrap();
+    assert_eq!(round_robin.entrants.len(), 27);
+    assert_eq!(round_robin.entrants[5].name, "Entrant 1");
+    assert_eq!(round_robin.matches, 27 * 26 / 2);
+    assert!(round_robin.entrants.iter().all(|e| e.minimum_games == 26));
+
+    let double = simulate(
+        &tournament(TournamentFormat::DoubleElimination, 27),
+        &settings,
+    )
+    .unwrap();
+    assert!(double.entrants.iter().all(|e| e.minimum_games == 2));
+    assert!(double.entrants.iter().any(|e| e.games > 2));
+
+    let mut plate = tournament(TournamentFormat::SingleElimination, 16);
+    plate.plate = true;
+    let plate = simulate(
+        &plate,
+        &SimulationSettings {
+            entrants: 0,
+            ..settings
+        },
+    )
+    .unwrap();
+    assert_eq!(plate.matches, 15 + 7);
+    assert!(plate.entrants.iter().all(|e| e.minimum_games == 2));
+
+    // On one board every leg is played one after another.
+    let one_board = SimulationSettings {
+        boards: 1,
+        minutes_per_leg: 4.0,
+        entrants: 0,
+        ..settings
+    };
+    let swiss = simulate(&tournament(TournamentFormat::Swiss, 8), &one_board).unwrap();
+    assert_eq!((swiss.rounds, swiss.matches), (3, 12));
+    assert_eq!(swiss.estimated_minutes, swiss.legs * 4);
+}
+
+#[test]
+fn only_a_bracket_format_that_has_not_started_can_be_simulated() {
+    let settings = SimulationSettings::default();
+    let mut started = tournament(TournamentFormat::SingleElimination, 4);
+    start_tournament(&mut started).unwrap();
+    assert_eq!(
+        simulate(&started, &settings),
+        Err(TournamentError::InvalidState)
+    );
+    assert_eq!(
+        simulate(&tournament(TournamentFormat::Elimination, 8), &settings),
+        Err(TournamentError::SimulationUnsupported)
+    );
+}
@@ -0,0 +1,153 @@
+//! Integration tests for round-robin standings and their tiebreakers.
+
+use dart_tournament_web::{
+    compute_standings, record_bracket_result, round_robin_standings, start_tournament,
+    undo_last_action, BracketMatch, GroupStanding, LegScore, Player, PlayerId, Team, Tournament,
+    TournamentError, TournamentFormat, TournamentMode,
+};
+
+fn seeded_players(n: usize) -> Vec<Player> {
+    (0..n)
+        .map(|i| {
+            let mut p = Player::new(format!("P{}", i + 1));
+            p.seed = i as u32 + 1;
+            p
+        })
+        .collect()
+}
+
+/// A decided match: `winner` beat `loser` by `legs` (winner's legs first).
+fn result(winner: &Player, loser: &Player, legs: (u32, u32)) -> BracketMatch {
+    let mut m = BracketMatch::new(1, 1);
+    m.team_1 = Some(winner.id);
+    m.team_2 = Some(loser.id);
+    m.winner = Some(Team::One);
+    m.score = Some(LegScore {
+        team_1: legs.0,
+        team_2: legs.1,
+    });
+    m
+}
+
+fn order(standings: &[GroupStanding]) -> Vec<PlayerId> {
+    standings.iter().map(|s| s.player).collect()
+}
+
+#[test]
+fn wins_then_legs_are_counted_from_results() {
+    let p = seeded_players(3);
+    let matches = vec![result(&p[2], &p[0], (3, 1)), result(&p[2], &p[1], (3, 2))];
+    let standings = compute_standings(&p, &matches);
+    assert_eq!(standings[0].player, p[2].id);
+    assert_eq!(
+        (
+            standings[0].wins,
+            standings[0].legs_for,
+            standings[0].legs_against
+        ),
+        (2, 6, 3)
+    );
+    assert_eq!(standings[0].leg_difference(), 3);
+    // Level on zero wins and never met: leg difference (-2 against -1), then seed.
+    assert_eq!(order(&standings)[1..], [p[1].id, p[0].id]);
+}
+
+#[test]
+fn head_to_head_beats_leg_difference_for_two_level_players() {
+    let p = seeded_players(4);
+    let matches = vec![
+        // P2 beats P1 narrowly, but P1 thrashes everyone else.
+        result(&p[1], &p[0], (3, 2)),
+        result(&p[0], &p[2], (3, 0)),
+        result(&p[0], &p[3], (3, 0)),
+        result(&p[1], &p[2], (3, 2)),
+        result(&p[3], &p[1], (3, 2)),
+        result(&p[2], &p[3], (3, 2)),
+    ];
+    let standings = compute_standings(&p, &matches);
+    assert_eq!((standings[0].wins, standings[1].wins), (2, 2));
+    assert!(standings[1].leg_difference() > standings[0].leg_difference());
+    assert_eq!(order(&standings)[..2], [p[1].id, p[0].id]);
+}
+
+#[test]
+fn three_way_circle_falls_back_to_leg_difference_then_seed() {
+    let p = seeded_players(3);
+    // P1 beats P2, P2 beats P3, P3 beats P1: one win each, and one head-to-head win each.
+    let matches = vec![
+        result(&p[0], &p[1], (3, 0)),
+        result(&p[1], &p[2], (3, 2)),
+        result(&p[2], &p[0], (3, 0)),
+    ];
+    let standings = compute_standings(&p, &matches);
+    let differences: Vec<i64> = standings.iter().map(|s| s.leg_difference()).collect();
+    assert_eq!(order(&standings), vec![p[2].id, p[0].id, p[1].id]);
+    assert_eq!(differences, vec![2, 0, -2]);
+
+    // Same circle with every match 3-1: nothing separates them, so seed order.
+    let matches = vec![
+        result(&p[0], &p[1], (3, 1)),
+        result(&p[1], &p[2], (3, 1)),
+        result(&p[2], &p[0], (3, 1)),
+    ];
+    let standings = compute_standings(&p, &matches);
+    assert_eq!(order(&standings), vec![p[0].id, p[1].id, p[2].id]);
+}
+
+#[test]
+fn mini_table_separates_three_level_players_before_legs() {
+    let p = seeded_players(4);
+    // P1, P2 and P3 all win twice. Among themselves P3 won both, then P1 beat P2.
+    let matches = vec![
+        result(&p[2], &p[0], (3, 2)),
+        result(&p[2], &p[1], (3, 2)),
+        result(&p[0], &p[1], (3, 2)),
+        result(&p[0], &p[3], (3, 0)),
+        result(&p[1], &p[3], (3, 0)),
+        result(&p[3], &p[2], (3, 0)),
+    ];
+    let standings = compute_standings(&p, &matches);
+    assert_eq!(order(&standings), vec![p[2].id, p[0].id, p[1].id, p[3].id]);
+}
+
+#[test]
+fn tournament_standings_follow_recorded_and_undone_results() {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::RoundRobin;
+    assert_eq!(
+        round_robin_standings(&t),
+        Err(TournamentError::InvalidState)
+    );
+    for i in 0..3 {
+        t.add_player(format!("P{}", i + 1)).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    assert!(round_robin_standings(&t)
+        .unwrap()
+        .iter()
+        .all(|s| s.played == 0));
+
+    let m = t
+        .bracket
+        .as_ref()
+        .unwrap()
+        .matches
+        .iter()
+        .find(|m| m.is_ready() && !m.bye)
+        .unwrap()
+        .clone();
+    let winner = m.team_2.unwrap();
+    let legs = LegScore {
+        team_1: 1,
+        team_2: 3,
+    };
+    record_bracket_result(&mut t, m.id, winner, Some(legs), false).unwrap();
+    let top = &round_robin_standings(&t).unwrap()[0];
+    assert_eq!((top.player, top.wins, top.leg_difference()), (winner, 1, 2));
+
+    undo_last_action(&mut t, m.id).unwrap();
+    assert!(round_robin_standings(&t)
+        .unwrap()
+        .iter()
+        .all(|s| s.wins == 0));
+}
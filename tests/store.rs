@@ -0,0 +1,292 @@
+//! Integration tests for tournament persistence: the contract every store keeps (run against
+//! each driver), snapshots, and picking a driver.
+
+use dart_tournament_web::{
+    generate_group_play_matches, process_group_play_results, record_match_visit, start_tournament,
+    FileStore, RegistryError, StorageDriver, Team, Tournament, TournamentMode, TournamentRegistry,
+    TournamentStore, UnknownDriver,
+};
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::Arc;
+use std::time::Duration;
+use uuid::Uuid;
+
+fn temp_dir() -> PathBuf {
+    std::env::temp_dir().join(format!("dart-store-test-{}", Uuid::new_v4()))
+}
+
+fn open_registry(dir: &PathBuf) -> TournamentRegistry {
+    TournamentRegistry::with_store(Box::new(FileStore::open(dir).unwrap())).unwrap()
+}
+
+#[test]
+fn stats_survive_reopening_the_store() {
+    let dir = temp_dir();
+    let registry = open_registry(&dir);
+    let t = registry
+        .insert(Tournament::new(3, TournamentMode::OneVOne))
+        .unwrap();
+    for name in ["A", "B", "C", "D", "E"] {
+        registry.update(t.id, |t| t.add_player(name)).unwrap();
+    }
+    registry.update(t.id, start_tournament).unwrap();
+    registry.update(t.id, generate_group_play_matches).unwrap();
+    let before = registry
+        .update(t.id, |t| {
+            let ids: Vec<_> = t.matches.iter().map(|m| m.id).collect();
+            for id in ids {
+                t.match_results.insert(id, Team::One);
+            }
+            process_group_play_results(t)
+        })
+        .unwrap();
+    drop(registry);
+
+    let after = open_registry(&dir).get(t.id).unwrap();
+    assert_eq!(after.state, before.state);
+    assert_eq!(after.players, before.players);
+    assert_eq!(after.eliminated_players, before.eliminated_players);
+    assert!(after.players.iter().any(|p| p.wins == 1));
+    assert!(after.players.iter().any(|p| p.times_sat_out == 1));
+
+    std::fs::remove_dir_all(dir).unwrap();
+}
+
+#[test]
+fn cleanup_deletes_stored_file() {
+    let dir = temp_dir();
+    let registry = open_registry(&dir);
+    registry
+        .insert(Tournament::new(3, TournamentMode::TwoVTwo))
+        .unwrap();
+    assert_eq!(registry.remove_inactive(Duration::ZERO).unwrap().len(), 1);
+    assert!(FileStore::open(&dir)
+        .unwrap()
+        .load_all()
+        .unwrap()
+        .is_empty());
+
+    std::fs::remove_dir_all(dir).unwrap();
+}
+
+#[test]
+fn snapshot_restores_every_player_exactly() {
+    let dir = temp_dir();
+    std::fs::create_dir_all(&dir).unwrap();
+    let path = dir.join("snapshot.json");
+    let registry = TournamentRegistry::new();
+    let t = registry
+        .insert(Tournament::new(3, TournamentMode::OneVOne))
+        .unwrap();
+    for name in ["A", "B", "C", "D", "E"] {
+        registry.update(t.id, |t| t.add_player(name)).unwrap();
+    }
+    registry.update(t.id, start_tournament).unwrap();
+    registry.update(t.id, generate_group_play_matches).unwrap();
+    registry
+        .update(t.id, |t| {
+            let first = t.matches[0].id;
+            record_match_visit(t, first, Team::One, 180, 3, false, 0)?;
+            record_match_visit(t, first, Team::Two, 45, 3, false, 1)?;
+            let ids: Vec<_> = t.matches.iter().map(|m| m.id).collect();
+            for id in ids {
+                t.match_results.insert(id, Team::One);
+            }
+            process_group_play_results(t)
+        })
+        .unwrap();
+    registry
+        .insert(Tournament::new(3, TournamentMode::TwoVTwo))
+        .unwrap();
+    assert_eq!(registry.write_snapshot(&path).unwrap(), 2);
+
+    let restored = TournamentRegistry::new();
+    assert_eq!(restored.load_snapshot(&path).unwrap(), 2);
+    let before = registry.get(t.id).unwrap();
+    let after = restored.get(t.id).unwrap();
+    assert_eq!(after.state, before.state);
+    assert_eq!(after.all_players(), before.all_players());
+    assert!(after.players.iter().any(|p| p.points_scored > 0));
+    assert!(after.all_players().iter().any(|p| p.rating != 1200.0));
+
+    std::fs::remove_dir_all(dir).unwrap();
+}
+
+#[test]
+fn missing_snapshot_loads_nothing() {
+    let registry = TournamentRegistry::new();
+    assert_eq!(
+        registry
+            .load_snapshot(&temp_dir().join("none.json"))
+            .unwrap(),
+        0
+    );
+    assert!(registry.is_empty());
+}
+
+/// A store that fails every save while `failing` is set, as a full disk would.
+struct Flaky {
+    inner: Box<dyn TournamentStore>,
+    failing: Arc<AtomicBool>,
+}
+
+impl TournamentStore for Flaky {
+    fn save(&self, tournament: &Tournament) -> io::Result<()> {
+        if self.failing.load(Ordering::SeqCst) {
+            return Err(io::Error::other("disk full"));
+        }
+        self.inner.save(tournament)
+    }
+
+    fn delete(&self, id: uuid::Uuid) -> io::Result<()> {
+        self.inner.delete(id)
+    }
+
+    fn load_all(&self) -> io::Result<Vec<Tournament>> {
+        self.inner.load_all()
+    }
+
+    fn check(&self) -> io::Result<()> {
+        self.inner.check()
+    }
+}
+
+/// A store that can't delete one tournament, as a file held open elsewhere would be.
+struct Undeletable {
+    inner: FileStore,
+    id: uuid::Uuid,
+}
+
+impl TournamentStore for Undeletable {
+    fn save(&self, tournament: &Tournament) -> io::Result<()> {
+        self.inner.save(tournament)
+    }
+
+    fn delete(&self, id: uuid::Uuid) -> io::Result<()> {
+        if id == self.id {
+            return Err(io::Error::other("permission denied"));
+        }
+        self.inner.delete(id)
+    }
+
+    fn load_all(&self) -> io::Result<Vec<Tournament>> {
+        self.inner.load_all()
+    }
+
+    fn check(&self) -> io::Result<()> {
+        self.inner.check()
+    }
+}
+
+#[test]
+fn cleanup_keeps_what_the_store_cannot_delete_and_goes_on() {
+    let dir = temp_dir();
+    let stuck = Tournament::new(3, TournamentMode::OneVOne);
+    let registry = TournamentRegistry::with_store(Box::new(Undeletable {
+        inner: FileStore::open(&dir).unwrap(),
+        id: stuck.id,
+    }))
+    .unwrap();
+    registry.insert(stuck.clone()).unwrap();
+    for _ in 0..2 {
+        registry
+            .insert(Tournament::new(3, TournamentMode::TwoVTwo))
+            .unwrap();
+    }
+    assert_eq!(registry.remove_inactive(Duration::ZERO).unwrap().len(), 2);
+    // Still in memory and on disk, so a restart doesn't bring back one memory had dropped.
+    assert_eq!(registry.get(stuck.id).unwrap().id, stuck.id);
+    let stored = FileStore::open(&dir).unwrap().load_all().unwrap();
+    assert_eq!(stored.iter().map(|t| t.id).collect::<Vec<_>>(), [stuck.id]);
+
+    std::fs::remove_dir_all(dir).unwrap();
+}
+
+/// What every store must do, written once and run against each driver: `open` opens the
+/// store kept under `dir`, and opening it again must see what was written before.
+fn store_contract(open: impl Fn(&Path) -> Box<dyn TournamentStore>) {
+    let dir = temp_dir();
+    let store = open(&dir);
+    store.check().unwrap();
+    assert!(store.load_all().unwrap().is_empty());
+
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    for name in ["A", "B", "C", "D", "E"] {
+        t.add_player(name).unwrap();
+    }
+    store.save(&t).unwrap();
+    t.name = "Renamed".to_string();
+    store.save(&t).unwrap();
+    let other = Tournament::new(3, TournamentMode::TwoVTwo);
+    store.save(&other).unwrap();
+    store.delete(other.id).unwrap();
+    // Deleting what was never saved is fine.
+    store.delete(uuid::Uuid::new_v4()).unwrap();
+    drop(store);
+
+    let loaded = open(&dir).load_all().unwrap();
+    assert_eq!(loaded.len(), 1);
+    assert_eq!(loaded[0].id, t.id);
+    assert_eq!(loaded[0].name, "Renamed");
+    assert_eq!(loaded[0].players, t.players);
+
+    // A result and the stats it moves are one write: when it fails, neither is kept.
+    let failing = Arc::new(AtomicBool::new(false));
+    let registry = TournamentRegistry::with_store(Box::new(Flaky {
+        inner: open(&dir),
+        failing: Arc::clone(&failing),
+    }))
+    .unwrap();
+    registry.update(t.id, start_tournament).unwrap();
+    let before = registry.update(t.id, generate_group_play_matches).unwrap();
+    failing.store(true, Ordering::SeqCst);
+    let err = registry
+        .update(t.id, |t| {
+            let ids: Vec<_> = t.matches.iter().map(|m| m.id).collect();
+            for id in ids {
+                t.match_results.insert(id, Team::One);
+            }
+            process_group_play_results(t)
+        })
+        .unwrap_err();
+    assert!(matches!(err, RegistryError::Storage(_)));
+    let kept = registry.get(t.id).unwrap();
+    assert_eq!(kept.match_results, before.match_results);
+    assert_eq!(kept.players, before.players);
+    drop(registry);
+
+    let stored = open(&dir).load_all().unwrap();
+    assert_eq!(stored[0].state, before.state);
+    assert!(stored[0].match_results.is_empty());
+    assert!(stored[0].players.iter().all(|p| p.wins == 0));
+    assert_eq!(stored[0].players, before.players);
+
+    std::fs::remove_dir_all(dir).unwrap();
+}
+
+#[test]
+fn file_store_keeps_the_store_contract() {
+    store_contract(|dir| Box::new(FileStore::open(dir).unwrap()));
+}
+
+#[cfg(feature = "sqlite")]
+#[test]
+fn sqlite_store_keeps_the_store_contract() {
+    use dart_tournament_web::SqliteStore;
+    store_contract(|dir| Box::new(SqliteStore::open(dir.join("tournaments.db")).unwrap()));
+}
+
+#[test]
+fn storage_driver_is_picked_by_name() {
+    assert_eq!("file".parse(), Ok(StorageDriver::File));
+    assert_eq!(" SQLite ".parse(), Ok(StorageDriver::Sqlite));
+    assert_eq!("memory".parse(), Ok(StorageDriver::Memory));
+    let err = "postgres".parse::<StorageDriver>().unwrap_err();
+    assert_eq!(err, UnknownDriver("postgres".to_string()));
+    assert_eq!(
+        err.to_string(),
+        "Unknown storage driver \"postgres\" (expected memory, file or sqlite)"
+    );
+}
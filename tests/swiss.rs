@@ -0,0 +1,169 @@
+//! Integration tests for Swiss pairing: score groups, no rematches, byes, and backtracking.
+
+use dart_tournament_web::{
+    pair_swiss_round, record_bracket_result, start_next_swiss_round, start_tournament,
+    swiss_opponents, swiss_standings, PlayerId, PlayerStanding, Tournament, TournamentError,
+    TournamentFormat, TournamentMode, TournamentState,
+};
+use std::collections::{HashMap, HashSet};
+use uuid::Uuid;
+
+fn standing(seed: u32, wins: u32) -> PlayerStanding {
+    PlayerStanding {
+        player: Uuid::new_v4(),
+        seed,
+        wins,
+        buchholz: 0,
+        had_bye: false,
+    }
+}
+
+fn pairs(round: &dart_tournament_web::SwissRound) -> HashSet<(PlayerId, PlayerId)> {
+    round
+        .matches
+        .iter()
+        .filter(|m| !m.bye)
+        .map(|m| (m.team_1.unwrap(), m.team_2.unwrap()))
+        .collect()
+}
+
+fn met(list: &[(PlayerId, PlayerId)]) -> HashMap<PlayerId, Vec<PlayerId>> {
+    let mut previous: HashMap<PlayerId, Vec<PlayerId>> = HashMap::new();
+    for &(a, b) in list {
+        previous.entry(a).or_default().push(b);
+        previous.entry(b).or_default().push(a);
+    }
+    previous
+}
+
+fn started(n: usize) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::Swiss;
+    for i in 0..n {
+        t.add_player(format!("P{}", i + 1)).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    t
+}
+
+/// Record every open match of the current round, the top-seeded side winning.
+fn finish_round(t: &mut Tournament) {
+    let open: Vec<_> = t
+        .bracket
+        .as_ref()
+        .unwrap()
+        .matches
+        .iter()
+        .filter(|m| m.is_ready())
+        .cloned()
+        .collect();
+    for m in open {
+        let (a, b) = (m.team_1.unwrap(), m.team_2.unwrap());
+        let seed = |id| t.find_player(id).unwrap().seed;
+        let winner = if seed(a) < seed(b) { a } else { b };
+        record_bracket_result(t, m.id, winner, None, false).unwrap();
+    }
+}
+
+#[test]
+fn players_on_the_same_record_meet() {
+    let s = [
+        standing(1, 2),
+        standing(2, 2),
+        standing(3, 1),
+        standing(4, 1),
+    ];
+    let round = pair_swiss_round(&s, &HashMap::new(), 3).unwrap();
+    assert_eq!(
+        pairs(&round),
+        HashSet::from([(s[0].player, s[1].player), (s[2].player, s[3].player)])
+    );
+    assert!(round.matches.iter().all(|m| m.round == 3));
+    assert_eq!(round.bye, None);
+}
+
+#[test]
+fn backtracks_across_score_groups_when_greedy_pairing_dead_ends() {
+    // A-B already met, so greedy pairs A-C, leaving B-D, who also met. The only legal round
+    // is A-D and B-C.
+    let s = [
+        standing(1, 2),
+        standing(2, 2),
+        standing(3, 1),
+        standing(4, 0),
+    ];
+    let [a, b, c, d] = [s[0].player, s[1].player, s[2].player, s[3].player];
+    let round = pair_swiss_round(&s, &met(&[(a, b), (b, d)]), 3).unwrap();
+    assert_eq!(pairs(&round), HashSet::from([(a, d), (b, c)]));
+
+    // With every opponent of A used up there is nothing left to pair.
+    assert_eq!(
+        pair_swiss_round(&s, &met(&[(a, b), (a, c), (a, d)]), 4),
+        Err(TournamentError::NoValidPairing)
+    );
+}
+
+#[test]
+fn bye_goes_to_lowest_ranked_player_without_one() {
+    let mut s = [standing(1, 1), standing(2, 1), standing(3, 0)];
+    s[2].had_bye = true;
+    let round = pair_swiss_round(&s, &HashMap::new(), 2).unwrap();
+    assert_eq!(round.bye, Some(s[1].player));
+    assert_eq!(pairs(&round), HashSet::from([(s[0].player, s[2].player)]));
+}
+
+#[test]
+fn bye_is_moved_up_when_the_bottom_player_has_no_legal_opponent() {
+    let s = [standing(1, 1), standing(2, 1), standing(3, 0)];
+    let [a, b, c] = [s[0].player, s[1].player, s[2].player];
+    // C is lowest but A-B have met, so C must play one of them and the bye moves up.
+    let round = pair_swiss_round(&s, &met(&[(a, b)]), 2).unwrap();
+    assert_eq!(round.bye, Some(b));
+    assert_eq!(pairs(&round), HashSet::from([(a, c)]));
+}
+
+#[test]
+fn standings_break_ties_on_buchholz() {
+    let mut t = started(4);
+    finish_round(&mut t);
+    start_next_swiss_round(&mut t).unwrap();
+    finish_round(&mut t);
+    let standings = swiss_standings(&t);
+    let wins: Vec<u32> = standings.iter().map(|s| s.wins).collect();
+    assert_eq!(wins, vec![2, 1, 1, 0]);
+    assert!(standings[1].buchholz >= standings[2].buchholz);
+}
+
+#[test]
+fn forty_one_players_play_six_rounds_without_rematches() {
+    let mut t = started(41);
+    assert_eq!(t.swiss_rounds, 6);
+    loop {
+        finish_round(&mut t);
+        if t.state == TournamentState::Completed {
+            break;
+        }
+        start_next_swiss_round(&mut t).unwrap();
+    }
+    let b = t.bracket.as_ref().unwrap();
+    assert_eq!(b.round_count(), 6);
+    for (player, opponents) in swiss_opponents(Some(b)) {
+        let unique: HashSet<_> = opponents.iter().collect();
+        assert_eq!(unique.len(), opponents.len(), "{player} had a rematch");
+    }
+    assert!(t.players.iter().all(|p| p.times_sat_out <= 1));
+    assert_eq!(t.players.iter().filter(|p| p.times_sat_out == 1).count(), 6);
+    assert_eq!(
+        start_next_swiss_round(&mut t),
+        Err(TournamentError::InvalidState)
+    );
+}
+
+#[test]
+fn next_round_needs_every_result() {
+    let mut t = started(4);
+    assert_eq!(
+        start_next_swiss_round(&mut t),
+        Err(TournamentError::IncompleteResults)
+    );
+}
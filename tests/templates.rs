@@ -0,0 +1,199 @@
+//! Integration tests for tournament templates and cloning.
+
+use dart_tournament_web::scoring::MatchFormat;
+use dart_tournament_web::templates::{
+    clone_tournament, TemplateError, TemplateStore, TournamentSettings, TournamentTemplate,
+};
+use dart_tournament_web::{
+    record_bracket_result, start_tournament, DrawMode, EntryType, MatchFormats, Tournament,
+    TournamentError, TournamentFormat, TournamentMode, TournamentState, MAX_BOARDS,
+};
+use serde_json::json;
+use std::path::PathBuf;
+use uuid::Uuid;
+
+fn temp_dir() -> PathBuf {
+    std::env::temp_dir().join(format!("dart-templates-test-{}", Uuid::new_v4()))
+}
+
+fn thursday_league() -> TournamentTemplate {
+    let mut match_formats = MatchFormats::default();
+    match_formats.rounds.insert(1, MatchFormat::best_of_legs(3));
+    match_formats.final_match = Some(MatchFormat::best_of_legs(7));
+    TournamentTemplate {
+        name: "thursday-league".to_string(),
+        settings: TournamentSettings {
+            format: TournamentFormat::SingleElimination,
+            match_formats,
+            boards: 4,
+            draw_mode: DrawMode::Random,
+            ..TournamentSettings::default()
+        },
+    }
+}
+
+#[test]
+fn a_template_is_checked_like_a_new_tournament() {
+    let store = TemplateStore::in_memory();
+    let mut best_of_2 = thursday_league();
+    best_of_2
+        .settings
+        .match_formats
+        .rounds
+        .insert(2, MatchFormat::best_of_legs(2));
+    assert_eq!(
+        best_of_2.settings.build().unwrap_err(),
+        TournamentError::InvalidMatchFormat
+    );
+    assert_eq!(
+        store.save(best_of_2),
+        Err(TemplateError::Tournament(
+            TournamentError::InvalidMatchFormat
+        ))
+    );
+
+    let mut too_many_boards = thursday_league();
+    too_many_boards.settings.boards = MAX_BOARDS + 1;
+    assert_eq!(
+        store.save(too_many_boards),
+        Err(TemplateError::Tournament(TournamentError::TooManyBoards {
+            max: MAX_BOARDS
+        }))
+    );
+    let mut random_round_robin = thursday_league();
+    random_round_robin.settings.format = TournamentFormat::RoundRobin;
+    assert_eq!(
+        store.save(random_round_robin),
+        Err(TemplateError::Tournament(TournamentError::InvalidState))
+    );
+    let mut knockout_2v2 = thursday_league();
+    knockout_2v2.settings.mode = Some(TournamentMode::TwoVTwo);
+    assert_eq!(
+        store.save(knockout_2v2),
+        Err(TemplateError::Tournament(TournamentError::UnsupportedMode))
+    );
+    let mut pairs_2v2 = thursday_league();
+    pairs_2v2.settings.format = TournamentFormat::Elimination;
+    pairs_2v2.settings.draw_mode = DrawMode::Seeded;
+    pairs_2v2.settings.entry_type = EntryType::Pairs;
+    pairs_2v2.settings.mode = Some(TournamentMode::TwoVTwo);
+    assert_eq!(
+        store.save(pairs_2v2),
+        Err(TemplateError::Tournament(TournamentError::UnsupportedMode))
+    );
+    for name in ["", "Thursday League", "../etc", &"x".repeat(65)] {
+        let mut named = thursday_league();
+        named.name = name.to_string();
+        assert_eq!(store.save(named), Err(TemplateError::InvalidName));
+    }
+    assert!(store.list().is_empty());
+    assert_eq!(
+        store.get("thursday-league"),
+        Err(TemplateError::NotFound("thursday-league".to_string()))
+    );
+}
+
+#[test]
+fn a_saved_template_makes_tournaments_and_survives_reopening() {
+    let dir = temp_dir();
+    let saved = TemplateStore::open(&dir)
+        .unwrap()
+        .save(thursday_league())
+        .unwrap();
+    // The mode the template's tournaments get is filled in: knockouts are 1v1.
+    assert_eq!(saved.settings.mode, Some(TournamentMode::OneVOne));
+
+    let store = TemplateStore::open(&dir).unwrap();
+    assert_eq!(store.list(), vec![saved.clone()]);
+    let t = store
+        .get("thursday-league")
+        .unwrap()
+        .settings
+        .build()
+        .unwrap();
+    assert_eq!(t.state, TournamentState::Setup);
+    assert_eq!(t.format, TournamentFormat::SingleElimination);
+    assert_eq!(t.draw_mode, DrawMode::Random);
+    assert_eq!(t.match_formats, thursday_league().settings.match_formats);
+    let boards: Vec<&str> = t.boards.iter().map(|b| b.name.as_str()).collect();
+    assert_eq!(boards, ["Board 1", "Board 2", "Board 3", "Board 4"]);
+
+    // Templates read the same JSON a new tournament is created from.
+    let template: TournamentTemplate = serde_json::from_value(json!({
+        "name": "pairs-night",
+        "settings": {
+            "name": "  Pairs night ",
+            "entry_type": "pairs",
+            "format": "round_robin",
+            "match_formats": { "rounds": { "1": { "legs": 5 } } },
+        },
+    }))
+    .unwrap();
+    let t = store.save(template).unwrap().settings.build().unwrap();
+    assert_eq!(
+        (t.entry_type, t.mode),
+        (EntryType::Pairs, TournamentMode::OneVOne)
+    );
+    assert_eq!(t.max_losses, 3);
+    assert_eq!(t.name, "Pairs night");
+    assert_eq!(
+        store.get("pairs-night").unwrap().settings.name,
+        "Pairs night"
+    );
+    let names: Vec<String> = store.list().into_iter().map(|t| t.name).collect();
+    assert_eq!(names, ["pairs-night", "thursday-league"]);
+    std::fs::remove_dir_all(&dir).unwrap();
+}
+
+#[test]
+fn cloning_copies_the_setup_and_reseeds_the_players_from_their_results() {
+    let mut t = thursday_league().settings.build().unwrap();
+    t.set_name("Thursday week 1").unwrap();
+    t.set_draw_mode(DrawMode::Seeded).unwrap();
+    for name in ["Anna", "Ben", "Cara", "Dan"] {
+        t.add_player(name).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    // Dan (seed 4) beats Anna (seed 1) and goes on to win it.
+    let by_name =
+        |t: &Tournament, name: &str| t.players.iter().find(|p| p.name == name).unwrap().id;
+    for (winner, loser) in [("Dan", "Anna"), ("Ben", "Cara"), ("Dan", "Ben")] {
+        let (w, l) = (by_name(&t, winner), by_name(&t, loser));
+        let m = t
+            .bracket
+            .as_ref()
+            .unwrap()
+            .matches
+            .iter()
+            .find(|m| m.side_of(w).is_some() && m.side_of(l).is_some())
+            .unwrap()
+            .id;
+        record_bracket_result(&mut t, m, w, None, false).unwrap();
+    }
+    assert_eq!(t.state, TournamentState::Completed);
+
+    let empty = clone_tournament(&t, false).unwrap();
+    assert_ne!(empty.id, t.id);
+    assert_eq!(empty.state, TournamentState::Setup);
+    assert_eq!(empty.name, "Thursday week 1");
+    assert_eq!(empty.format, t.format);
+    assert_eq!(empty.match_formats, t.match_formats);
+    assert_eq!(empty.boards.len(), 4);
+    assert!(empty.boards.iter().all(|b| b.match_id.is_none()));
+    assert!(empty.players.is_empty() && empty.bracket.is_none());
+
+    let again = clone_tournament(&t, true).unwrap();
+    let seeded: Vec<&str> = {
+        let mut players: Vec<_> = again.players.iter().collect();
+        players.sort_by_key(|p| p.seed);
+        players.iter().map(|p| p.name.as_str()).collect()
+    };
+    assert_eq!(seeded, ["Dan", "Ben", "Anna", "Cara"]);
+    let dan = again.players.iter().find(|p| p.name == "Dan").unwrap();
+    let dan_before = t.players.iter().find(|p| p.name == "Dan").unwrap();
+    assert_ne!(dan.id, dan_before.id);
+    assert_eq!((dan.wins, dan.losses), (0, 0));
+    assert!(!dan.eliminated && dan.rating_history.is_empty());
+    assert_eq!(dan.rating, dan_before.rating);
+    assert!(again.match_log.is_empty() && again.placements.is_empty());
+}
@@ -0,0 +1,119 @@
+//! Integration tests for match timing: clocks, slow matches, and the estimated finish.
+
+use chrono::{DateTime, Duration, TimeZone, Utc};
+use dart_tournament_web::{
+    estimated_finish, numbered_boards, record_bracket_result, set_boards, start_match,
+    start_tournament, timing_report, undo_last_action, BracketSection, MatchId, Tournament,
+    TournamentError, TournamentFormat, TournamentMode,
+};
+
+fn started(players: usize, boards: usize) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    for i in 0..players {
+        t.add_player(format!("P{}", i + 1)).unwrap();
+    }
+    set_boards(&mut t, &numbered_boards(boards)).unwrap();
+    start_tournament(&mut t).unwrap();
+    t
+}
+
+fn win(t: &mut Tournament, id: MatchId) {
+    let winner = t.bracket.as_ref().unwrap().get(id).unwrap().team_1.unwrap();
+    record_bracket_result(t, id, winner, None, false).unwrap();
+}
+
+fn at(minute: i64) -> DateTime<Utc> {
+    Utc.with_ymd_and_hms(2024, 5, 1, 19, 0, 0).unwrap() + Duration::minutes(minute)
+}
+
+/// Set a match's clock: started at `start`, completed at `end` (minutes past 19:00).
+fn clock(t: &mut Tournament, id: MatchId, start: i64, end: Option<i64>) {
+    let m = t.bracket.as_mut().unwrap().get_mut(id).unwrap();
+    m.started_at = Some(at(start));
+    m.completed_at = end.map(at);
+}
+
+#[test]
+fn estimate_is_remaining_matches_times_the_average_over_the_boards() {
+    let recent = [Duration::minutes(10), Duration::minutes(20)];
+    assert_eq!(estimated_finish(at(0), 4, &recent, 2), Some(at(30)));
+    // No boards set up: one match at a time.
+    assert_eq!(estimated_finish(at(0), 4, &recent, 0), Some(at(60)));
+    assert_eq!(estimated_finish(at(0), 0, &recent, 2), None);
+}
+
+#[test]
+fn cold_start_estimate_assumes_twenty_minute_matches() {
+    assert_eq!(estimated_finish(at(0), 6, &[], 2), Some(at(60)));
+    let t = started(4, 2);
+    let report = timing_report(&t, at(0), Duration::minutes(30));
+    assert_eq!(report.remaining, 3);
+    assert_eq!(report.estimated_finish, Some(at(30)));
+    assert!(report.rounds.iter().all(|r| r.average_secs.is_none()));
+}
+
+#[test]
+fn clocks_start_on_a_board_and_stop_with_the_result() {
+    let mut t = started(8, 2);
+    let first: Vec<MatchId> = t.bracket.as_ref().unwrap().round(1).map(|m| m.id).collect();
+    let match_at =
+        |t: &Tournament, i: usize| t.bracket.as_ref().unwrap().get(first[i]).unwrap().clone();
+    assert!(match_at(&t, 0).started_at.is_some());
+    assert!(match_at(&t, 2).started_at.is_none());
+
+    // Started by hand before a board frees up; the board keeps the earlier start.
+    start_match(&mut t, first[2]).unwrap();
+    let started_at = match_at(&t, 2).started_at;
+    win(&mut t, first[0]);
+    assert!(match_at(&t, 0).completed_at.is_some());
+    assert_eq!(match_at(&t, 2).started_at, started_at);
+
+    undo_last_action(&mut t, first[0]).unwrap();
+    assert!(match_at(&t, 0).completed_at.is_none());
+
+    win(&mut t, first[0]);
+    assert_eq!(
+        start_match(&mut t, first[0]),
+        Err(TournamentError::ResultAlreadyRecorded)
+    );
+    let final_id = t.bracket.as_ref().unwrap().final_match().unwrap().id;
+    assert_eq!(
+        start_match(&mut t, final_id),
+        Err(TournamentError::MatchNotReady)
+    );
+}
+
+#[test]
+fn report_averages_rounds_and_flags_slow_matches() {
+    let mut t = started(8, 4);
+    let first: Vec<MatchId> = t.bracket.as_ref().unwrap().round(1).map(|m| m.id).collect();
+    for &id in &first[..2] {
+        win(&mut t, id);
+    }
+    clock(&mut t, first[0], 0, Some(20));
+    clock(&mut t, first[1], 0, Some(30));
+    clock(&mut t, first[2], 0, None);
+    clock(&mut t, first[3], 5, None);
+
+    let report = timing_report(&t, at(40), Duration::minutes(35));
+    let round_1 = &report.rounds[0];
+    assert_eq!(
+        (round_1.section, round_1.round),
+        (BracketSection::Winners, 1)
+    );
+    assert_eq!(round_1.completed, 2);
+    assert_eq!(round_1.average_secs, Some(25 * 60));
+    let running = &report.matches[2];
+    assert_eq!(running.duration_secs, Some(40 * 60));
+    assert_eq!(running.board.as_deref(), Some("Board 3"));
+
+    let slow: Vec<MatchId> = report.slow.iter().map(|m| m.match_id).collect();
+    assert_eq!(slow, vec![first[2]]);
+    // Five left (two first-round, two semis, the final) on four boards at 25 minutes.
+    assert_eq!(report.remaining, 5);
+    assert_eq!(
+        report.estimated_finish,
+        Some(at(40) + Duration::seconds(25 * 60 * 5 / 4))
+    );
+}
@@ -0,0 +1,192 @@
+//! Integration tests for undo: the per-match action log, bracket rollback, and visit undo.
+
+use dart_tournament_web::{
+    record_bracket_result, record_match_visit, start_tournament, undo_last_action, BracketMatch,
+    LegScore, MatchAction, Player, PlayerId, Team, Tournament, TournamentError, TournamentFormat,
+    TournamentMode, TournamentState,
+};
+
+fn started_knockout(n: usize) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = TournamentFormat::SingleElimination;
+    for i in 0..n {
+        t.add_player(format!("P{}", i + 1)).unwrap();
+    }
+    start_tournament(&mut t).unwrap();
+    t
+}
+
+fn first_round(t: &Tournament) -> Vec<BracketMatch> {
+    t.bracket.as_ref().unwrap().round(1).cloned().collect()
+}
+
+fn player(t: &Tournament, id: PlayerId) -> &Player {
+    t.find_player(id).unwrap()
+}
+
+fn visit(t: &mut Tournament, m: &BracketMatch, team: Team, score: u32, double_out: bool) {
+    record_match_visit(t, m.id, team, score, 3, double_out, 0).unwrap();
+}
+
+/// Side one wins a leg 180, 180, 141 while side two scores nothing; `first` throws first.
+fn side_one_wins_leg(t: &mut Tournament, m: &BracketMatch, first: Team) {
+    if first == Team::Two {
+        visit(t, m, Team::Two, 0, false);
+    }
+    for score in [180, 180] {
+        visit(t, m, Team::One, score, false);
+        visit(t, m, Team::Two, 0, false);
+    }
+    visit(t, m, Team::One, 141, true);
+}
+
+#[test]
+fn undo_result_takes_back_stats_and_advancement() {
+    let mut t = started_knockout(4);
+    let m = first_round(&t)[0].clone();
+    let (a, b) = (m.team_1.unwrap(), m.team_2.unwrap());
+    let rating = player(&t, a).rating;
+    record_bracket_result(&mut t, m.id, a, None, false).unwrap();
+
+    let undone = undo_last_action(&mut t, m.id).unwrap();
+    assert!(matches!(undone, MatchAction::Result { replaced: None, .. }));
+    assert_eq!((player(&t, a).wins, player(&t, b).losses), (0, 0));
+    assert!(!player(&t, b).eliminated);
+    assert_eq!(player(&t, a).rating, rating);
+    let bracket = t.bracket.as_ref().unwrap();
+    assert_eq!(bracket.get(m.id).unwrap().winner, None);
+    let slot = m.winner_to.unwrap();
+    assert_eq!(bracket.get(slot.match_id).unwrap().player(slot.team), None);
+    assert_eq!(
+        undo_last_action(&mut t, m.id),
+        Err(TournamentError::NothingToUndo)
+    );
+}
+
+#[test]
+fn undo_after_the_bracket_advanced_unwinds_from_the_latest_match() {
+    let mut t = started_knockout(4);
+    let first = first_round(&t);
+    for m in &first {
+        record_bracket_result(&mut t, m.id, m.team_1.unwrap(), None, false).unwrap();
+    }
+    let final_id = t.bracket.as_ref().unwrap().final_match().unwrap().id;
+    let champ = first[0].team_1.unwrap();
+    record_bracket_result(&mut t, final_id, champ, None, false).unwrap();
+    assert_eq!(t.state, TournamentState::Completed);
+
+    // The semi-final fed a final that has been played: locked, and nothing changes.
+    assert_eq!(
+        undo_last_action(&mut t, first[0].id),
+        Err(TournamentError::NextMatchAlreadyPlayed)
+    );
+    assert_eq!(player(&t, champ).wins, 2);
+    assert_eq!(t.match_log[&first[0].id].len(), 1);
+
+    // Undo the final first, then the semi-final can be undone.
+    undo_last_action(&mut t, final_id).unwrap();
+    assert_eq!(t.state, TournamentState::BracketPlay);
+    assert_eq!(player(&t, champ).wins, 1);
+    undo_last_action(&mut t, first[0].id).unwrap();
+    assert_eq!(player(&t, champ).wins, 0);
+    let final_match = t.bracket.as_ref().unwrap().get(final_id).unwrap();
+    assert_eq!(final_match.team_1, None);
+    assert_eq!(final_match.team_2, Some(first[1].team_1.unwrap()));
+}
+
+#[test]
+fn undo_of_an_overwrite_restores_the_earlier_result() {
+    let mut t = started_knockout(4);
+    let m = first_round(&t)[0].clone();
+    let (a, b) = (m.team_1.unwrap(), m.team_2.unwrap());
+    let score = LegScore {
+        team_1: 3,
+        team_2: 2,
+    };
+    record_bracket_result(&mut t, m.id, a, Some(score), false).unwrap();
+    record_bracket_result(&mut t, m.id, b, None, true).unwrap();
+
+    undo_last_action(&mut t, m.id).unwrap();
+    assert_eq!((player(&t, a).wins, player(&t, b).losses), (1, 1));
+    assert_eq!(player(&t, b).wins, 0);
+    let restored = t.bracket.as_ref().unwrap().get(m.id).unwrap();
+    assert_eq!(restored.winner_id(), Some(a));
+    assert_eq!(restored.score, Some(score));
+    undo_last_action(&mut t, m.id).unwrap();
+    assert_eq!(player(&t, a).wins, 0);
+}
+
+#[test]
+fn visits_undo_one_at_a_time_with_their_stats() {
+    let mut t = started_knockout(2);
+    let m = first_round(&t)[0].clone();
+    let a = m.team_1.unwrap();
+    visit(&mut t, &m, Team::One, 180, false);
+    visit(&mut t, &m, Team::Two, 60, false);
+    visit(&mut t, &m, Team::One, 100, false);
+
+    undo_last_action(&mut t, m.id).unwrap();
+    let leg = t.scores[&m.id].current_leg();
+    assert_eq!(leg.remaining(Team::One), 321);
+    assert_eq!(leg.thrower, Team::One);
+    assert_eq!(player(&t, a).points_scored, 180);
+    assert_eq!(player(&t, a).count_180s, 1);
+
+    undo_last_action(&mut t, m.id).unwrap();
+    undo_last_action(&mut t, m.id).unwrap();
+    assert_eq!(t.scores[&m.id].current_leg().remaining(Team::One), 501);
+    assert_eq!(
+        (player(&t, a).points_scored, player(&t, a).count_180s),
+        (0, 0)
+    );
+    assert_eq!(
+        undo_last_action(&mut t, m.id),
+        Err(TournamentError::NothingToUndo)
+    );
+}
+
+#[test]
+fn a_scored_win_undoes_result_then_deciding_visit() {
+    let mut t = started_knockout(2);
+    let m = first_round(&t)[0].clone();
+    let a = m.team_1.unwrap();
+    side_one_wins_leg(&mut t, &m, Team::One);
+    side_one_wins_leg(&mut t, &m, Team::Two);
+    assert_eq!(t.state, TournamentState::Completed);
+    assert_eq!(player(&t, a).highest_checkout, 141);
+
+    assert!(matches!(
+        undo_last_action(&mut t, m.id).unwrap(),
+        MatchAction::Result { .. }
+    ));
+    assert_eq!(t.state, TournamentState::BracketPlay);
+    assert_eq!(player(&t, a).wins, 0);
+
+    assert!(matches!(
+        undo_last_action(&mut t, m.id).unwrap(),
+        MatchAction::Visit { .. }
+    ));
+    let scored = &t.scores[&m.id];
+    assert_eq!(scored.winner, None);
+    assert_eq!((scored.legs_won.team_1, scored.legs.len()), (1, 2));
+    assert_eq!(scored.current_leg().remaining(Team::One), 141);
+    assert_eq!(player(&t, a).checkouts, 1);
+    // Scoring picks up again from the reopened leg.
+    visit(&mut t, &m, Team::One, 141, true);
+    assert_eq!(t.state, TournamentState::Completed);
+}
+
+#[test]
+fn next_match_with_visits_locks_the_result() {
+    let mut t = started_knockout(4);
+    let first = first_round(&t);
+    for m in &first {
+        record_bracket_result(&mut t, m.id, m.team_1.unwrap(), None, false).unwrap();
+    }
+    let final_match = t.bracket.as_ref().unwrap().final_match().unwrap().clone();
+    visit(&mut t, &final_match, Team::One, 60, false);
+    assert_eq!(
+        undo_last_action(&mut t, first[0].id),
+        Err(TournamentError::NextMatchAlreadyPlayed)
+    );
+}
@@ -0,0 +1,190 @@
+//! Integration tests for request validation and its per-field error envelope.
+
+use dart_tournament_web::api_error::ApiError;
+use dart_tournament_web::scoring::{MatchFormat, X01Match, IMPOSSIBLE_SCORES, START_SCORE};
+use dart_tournament_web::templates::TournamentSettings;
+use dart_tournament_web::validation::{
+    dart_score, include_sections, odd_best_of, player_name, CreatePlayerRequest,
+    RecordResultRequest, RecordVisitRequest, Section, Validate, SECTIONS,
+};
+use dart_tournament_web::{LegScore, Team, MAX_BOARDS};
+use serde_json::json;
+use uuid::Uuid;
+
+/// Every total three darts can make, worked out dart by dart.
+fn reachable() -> Vec<bool> {
+    let mut dart = vec![0];
+    for n in 1..=20 {
+        dart.extend([n, 2 * n, 3 * n]);
+    }
+    dart.extend([25, 50]);
+    let mut seen = vec![false; 181];
+    for a in &dart {
+        for b in &dart {
+            for c in &dart {
+                seen[a + b + c] = true;
+            }
+        }
+    }
+    seen
+}
+
+#[test]
+fn dart_score_rejects_exactly_the_totals_no_three_darts_make() {
+    let reachable = reachable();
+    let unreachable: Vec<u32> = (0..=180).filter(|&s| !reachable[s as usize]).collect();
+    assert_eq!(unreachable, IMPOSSIBLE_SCORES);
+    for score in 0..=180 {
+        assert_eq!(
+            dart_score("score", score).is_ok(),
+            reachable[score as usize]
+        );
+    }
+    let e = dart_score("score", 181).unwrap_err();
+    assert_eq!(e.message, "score must be between 0 and 180");
+    assert_eq!(
+        dart_score("score", 179).unwrap_err().message,
+        "score of 179 can't be thrown with three darts"
+    );
+
+    // The scorer refuses them too, whichever way the visit comes in.
+    let mut m = X01Match::with_format(MatchFormat::best_of_legs(3), START_SCORE).unwrap();
+    assert!(m.record_visit(Team::One, 179, 3, false).is_err());
+    assert!(m.record_visit(Team::One, 180, 3, false).is_ok());
+}
+
+#[test]
+fn common_checks_name_the_field() {
+    assert!(odd_best_of("legs", 5).is_ok());
+    for even in [0, 2, 4] {
+        assert_eq!(odd_best_of("legs", even).unwrap_err().field, "legs");
+    }
+    assert!(player_name("name", "  Anna ").is_ok());
+    assert_eq!(
+        player_name("name", "   ").unwrap_err().message,
+        "name is required"
+    );
+    assert_eq!(
+        player_name("name", &"x".repeat(65)).unwrap_err().message,
+        "name must be at most 64 characters"
+    );
+    assert_eq!(
+        player_name("name", "Anna\u{7}").unwrap_err().message,
+        "name must not contain control characters"
+    );
+}
+
+#[test]
+fn every_invalid_field_is_reported_at_once() {
+    let visit: RecordVisitRequest =
+        serde_json::from_value(json!({ "team": "one", "score": 200, "darts": 4 })).unwrap();
+    let e: ApiError = visit.validate().unwrap_err().into();
+    assert_eq!((e.status, e.code), (400, "validation_failed"));
+    assert_eq!(
+        e.envelope(),
+        json!({ "error": {
+            "code": "validation_failed",
+            "message": "score must be between 0 and 180; darts must be 1, 2 or 3",
+            "details": {
+                "field": "score",
+                "fields": {
+                    "score": "score must be between 0 and 180",
+                    "darts": "darts must be 1, 2 or 3",
+                },
+            },
+        }})
+    );
+    let ok: RecordVisitRequest =
+        serde_json::from_value(json!({ "team": "two", "score": 60 })).unwrap();
+    assert!(ok.validate().is_ok());
+    let at_double: RecordVisitRequest = serde_json::from_value(
+        json!({ "team": "two", "score": 40, "darts": 1, "darts_at_double": 2 }),
+    )
+    .unwrap();
+    assert_eq!(
+        at_double.validate().unwrap_err().0[0].field,
+        "darts_at_double"
+    );
+
+    let player = CreatePlayerRequest {
+        name: "".to_string(),
+    };
+    assert_eq!(player.validate().unwrap_err().0[0].field, "name");
+    let level = RecordResultRequest {
+        winner: Uuid::new_v4(),
+        score: Some(LegScore {
+            team_1: 2,
+            team_2: 2,
+        }),
+    };
+    assert_eq!(level.validate().unwrap_err().0[0].field, "score");
+
+    let mut settings = TournamentSettings {
+        name: "Thursday\nnight".to_string(),
+        boards: MAX_BOARDS + 1,
+        ..TournamentSettings::default()
+    };
+    settings.match_formats.final_match = Some(MatchFormat::best_of_sets(4, 3));
+    let fields: Vec<String> = settings
+        .validate()
+        .unwrap_err()
+        .0
+        .into_iter()
+        .map(|f| f.field)
+        .collect();
+    assert_eq!(fields, ["name", "boards", "match_formats.final.sets"]);
+    assert!(TournamentSettings::default().validate().is_ok());
+}
+
+#[test]
+fn cricket_visits_are_checked_dart_by_dart() {
+    let visit: RecordVisitRequest = serde_json::from_value(json!({
+        "team": "one",
+        "game_type": "cricket",
+        "throws": [{ "number": 25, "multiplier": 3 }, { "number": 21 }, { "number": 20 }],
+    }))
+    .unwrap();
+    let fields: Vec<String> = visit
+        .validate()
+        .unwrap_err()
+        .0
+        .into_iter()
+        .map(|e| e.field)
+        .collect();
+    assert_eq!(fields, ["throws.0", "throws.1"]);
+
+    let scored: RecordVisitRequest = serde_json::from_value(
+        json!({ "team": "one", "game_type": "cricket", "score": 60, "throws": [] }),
+    )
+    .unwrap();
+    let fields: Vec<String> = scored
+        .validate()
+        .unwrap_err()
+        .0
+        .into_iter()
+        .map(|e| e.field)
+        .collect();
+    assert_eq!(fields, ["score", "throws"]);
+
+    let x01: RecordVisitRequest = serde_json::from_value(json!({ "team": "one" })).unwrap();
+    assert_eq!(
+        x01.validate().unwrap_err().0[0].message,
+        "score is required"
+    );
+}
+
+#[test]
+fn include_picks_sections_of_the_full_read() {
+    assert_eq!(include_sections(None).unwrap().len(), SECTIONS.len());
+    assert_eq!(
+        include_sections(Some("Players, matches,players")).unwrap(),
+        [Section::Players, Section::Matches]
+    );
+    assert!(include_sections(Some("")).unwrap().is_empty());
+    let e = include_sections(Some("players,history")).unwrap_err();
+    assert_eq!(e.0[0].field, "include");
+    assert_eq!(
+        e.0[0].message,
+        "include has no section \"history\" (expected players, matches, standings, boards or visits)"
+    );
+}
@@ -0,0 +1,127 @@
+//! Integration tests for versions: two writers from the same state, versions of single matches,
+//! and the 412 a stale change gets.
+
+mod common;
+
+use common::Knockout;
+use dart_tournament_web::api_error::ApiError;
+use dart_tournament_web::versions::{match_etag, match_version, tournament_etag, Precondition};
+use dart_tournament_web::{
+    record_bracket_result, record_match_visit, MatchId, RegistryError, Team, Tournament,
+    TournamentRegistry,
+};
+use std::sync::Barrier;
+use std::thread;
+
+/// A started four-player knockout in a registry.
+fn knockout() -> (TournamentRegistry, Tournament) {
+    let registry = TournamentRegistry::new();
+    let t = Knockout::of(&["Ann", "Bob", "Cy", "Di"]).started();
+    let t = registry.insert(t).unwrap();
+    (registry, t)
+}
+
+fn first_round(t: &Tournament) -> [MatchId; 2] {
+    let ids: Vec<MatchId> = t.bracket.as_ref().unwrap().round(1).map(|m| m.id).collect();
+    [ids[0], ids[1]]
+}
+
+#[test]
+fn of_two_writers_from_the_same_state_exactly_one_gets_through() {
+    let (registry, t) = knockout();
+    let [m, _] = first_round(&t);
+    // Both tablets loaded the match at the same version, and send their visits at once.
+    let loaded = match_etag(&t, m);
+    let barrier = Barrier::new(2);
+    let results: Vec<_> = thread::scope(|s| {
+        let writers: Vec<_> = [60, 100]
+            .map(|score| {
+                let (registry, barrier, loaded) = (&registry, &barrier, &loaded);
+                s.spawn(move || {
+                    let precondition = Precondition::parse(loaded, Some(m)).unwrap();
+                    barrier.wait();
+                    registry.update_if(t.id, Some(&precondition), |t| {
+                        record_match_visit(t, m, Team::One, score, 3, false, 0).map(|_| ())
+                    })
+                })
+            })
+            .into_iter()
+            .collect();
+        writers.into_iter().map(|w| w.join().unwrap()).collect()
+    });
+
+    let (ok, stale): (Vec<_>, Vec<_>) = results.into_iter().partition(|r| r.is_ok());
+    assert_eq!((ok.len(), stale.len()), (1, 1));
+    let after = registry.get(t.id).unwrap();
+    assert_eq!(after.scores[&m].current_leg().visits.len(), 1);
+    assert_eq!(
+        (after.version, match_version(&after, m)),
+        (t.version + 1, 1)
+    );
+    let Err(RegistryError::Stale(stale)) = &stale[0] else {
+        panic!("expected a stale error, got {:?}", stale[0]);
+    };
+    // The loser is sent the state it missed, to catch up from.
+    assert_eq!(stale.etag, "\"m1\"");
+    assert_eq!(stale.tournament.version, after.version);
+
+    let e = ApiError::from(RegistryError::Stale(stale.clone()));
+    assert_eq!((e.status, e.code), (412, "precondition_failed"));
+    assert_eq!(e.details["etag"], "\"m1\"");
+    assert_eq!(e.details["tournament"]["version"], after.version);
+}
+
+#[test]
+fn a_change_to_one_match_leaves_the_others_current() {
+    let (registry, t) = knockout();
+    let [a, b] = first_round(&t);
+    let on_b = Precondition::parse(&match_etag(&t, b), Some(b)).unwrap();
+    let on_tournament = Precondition::parse(&tournament_etag(&t), None).unwrap();
+
+    let visit = |m: MatchId| {
+        move |t: &mut Tournament| record_match_visit(t, m, Team::One, 60, 3, false, 0).map(|_| ())
+    };
+    registry.update(t.id, visit(a)).unwrap();
+    // Board b's tablet is still current; a change to the whole tournament isn't.
+    let after = registry.update_if(t.id, Some(&on_b), visit(b)).unwrap();
+    assert_eq!((match_version(&after, a), match_version(&after, b)), (1, 1));
+    assert_eq!(after.version, t.version + 2);
+    assert!(matches!(
+        registry.update_if(t.id, Some(&on_tournament), |t| t.set_name("Renamed")),
+        Err(RegistryError::Stale(_))
+    ));
+    assert_eq!(registry.get(t.id).unwrap().name, "");
+
+    // `*` and a list with the current tag both hold; weak tags never do.
+    assert_eq!(Precondition::parse(" * ", None), None);
+    let current = tournament_etag(&after);
+    let listed = Precondition::parse(&format!("\"t0\", {current}"), None).unwrap();
+    assert!(listed.holds(&after));
+    let weak = Precondition::parse(&format!("W/{current}"), None).unwrap();
+    assert!(!weak.holds(&after));
+    // A tournament's tag on a match's route names the wrong thing.
+    let mixed = Precondition::parse(&current, Some(a)).unwrap();
+    assert!(!mixed.holds(&after));
+}
+
+#[test]
+fn a_result_bumps_the_match_it_decides_and_the_one_it_feeds() {
+    let (registry, t) = knockout();
+    let [a, b] = first_round(&t);
+    let bracket = t.bracket.as_ref().unwrap();
+    let decided = bracket.get(a).unwrap();
+    let final_id = decided.winner_to.unwrap().match_id;
+    let winner = decided.team_1.unwrap();
+    let after = registry
+        .update(t.id, |t| {
+            record_bracket_result(t, a, winner, None, false).map(|_| ())
+        })
+        .unwrap();
+    let versions = [a, b, final_id].map(|m| match_version(&after, m));
+    assert_eq!(versions, [1, 0, 1]);
+
+    // Restarting draws new matches but never takes the tournament's version back.
+    let restarted = registry.update(t.id, |t| t.restart_tournament()).unwrap();
+    assert_eq!(restarted.version, after.version + 1);
+    assert!(restarted.match_versions.is_empty());
+}
@@ -0,0 +1,103 @@
+//! Integration tests for per-player visit history and the visit distribution.
+
+mod common;
+
+use common::Knockout;
+use dart_tournament_web::visits::{player_visits, visit_distribution, VisitQuery};
+use dart_tournament_web::{
+    record_match_visit, start_with_draw, DrawMode, DrawSettings, MatchId, Team, Tournament,
+};
+
+/// A seeded four-player knockout and its first match, with the name of the player on each side.
+fn knockout() -> (Tournament, MatchId, String, String) {
+    let mut t = Knockout::of(&["Anna", "Ben", "Cara", "Dan"])
+        .max_losses(1)
+        .entered();
+    let settings = DrawSettings {
+        mode: DrawMode::Seeded,
+        protected_seeds: 0,
+        seed: None,
+        ..Default::default()
+    };
+    start_with_draw(&mut t, settings).unwrap();
+    let m = t.bracket.as_ref().unwrap().round(1).next().unwrap().clone();
+    let name = |id| t.find_player(id).unwrap().name.clone();
+    let (one, two) = (name(m.team_1.unwrap()), name(m.team_2.unwrap()));
+    (t, m.id, one, two)
+}
+
+/// Side one takes the first leg in nine darts against two 60s, then side two opens the second
+/// leg with 100.
+fn score_legs(t: &mut Tournament, m: MatchId) {
+    let visits = [
+        (Team::One, 180, false),
+        (Team::Two, 60, false),
+        (Team::One, 180, false),
+        (Team::Two, 60, false),
+        (Team::One, 141, true),
+        (Team::Two, 100, false),
+    ];
+    for (team, score, double_out) in visits {
+        let at_double = u32::from(double_out);
+        record_match_visit(t, m, team, score, 3, double_out, at_double).unwrap();
+    }
+}
+
+#[test]
+fn visits_are_listed_newest_first_a_page_at_a_time() {
+    let (mut t, m, one, two) = knockout();
+    score_legs(&mut t, m);
+    let tournaments = [t];
+
+    let page = player_visits(&tournaments, &two.to_uppercase(), &VisitQuery::default());
+    assert_eq!(page.total, 3);
+    let scores: Vec<(u32, u32, u32)> = page
+        .visits
+        .iter()
+        .map(|v| (v.leg, v.visit, v.score))
+        .collect();
+    assert_eq!(scores, [(2, 1, 100), (1, 2, 60), (1, 1, 60)]);
+    assert_eq!(page.visits[0].remaining, 401);
+    assert!(page.visits.iter().all(|v| v.match_id == m));
+
+    let query = VisitQuery {
+        limit: Some(1),
+        offset: Some(1),
+        ..VisitQuery::default()
+    };
+    let page = player_visits(&tournaments, &one, &query);
+    assert_eq!((page.total, page.offset, page.limit), (3, 1, 1));
+    assert_eq!(page.visits[0].score, 180);
+    assert_eq!(page.visits[0].visit, 2);
+
+    let elsewhere = VisitQuery {
+        tournament_id: Some(uuid::Uuid::new_v4()),
+        ..VisitQuery::default()
+    };
+    assert_eq!(player_visits(&tournaments, &one, &elsewhere).total, 0);
+}
+
+#[test]
+fn distribution_counts_bands_and_first_nine_averages() {
+    let (mut t, m, one, two) = knockout();
+    score_legs(&mut t, m);
+    let tournaments = [t];
+
+    let d = visit_distribution(&tournaments, &one, None);
+    assert_eq!(d.visits, 3);
+    let counts: Vec<u32> = d.bands.iter().map(|b| b.count).collect();
+    assert_eq!(counts, [0, 0, 0, 0, 1, 2]);
+    assert_eq!(d.first_nine_average, Some(167.0));
+    assert_eq!(d.legs.len(), 1);
+    assert_eq!((d.legs[0].leg, d.legs[0].darts), (1, 9));
+
+    let d = visit_distribution(&tournaments, &two, None);
+    let counts: Vec<u32> = d.bands.iter().map(|b| b.count).collect();
+    assert_eq!(counts, [0, 0, 2, 1, 0, 0]);
+    let legs: Vec<(u32, f64)> = d.legs.iter().map(|l| (l.leg, l.average)).collect();
+    assert_eq!(legs, [(2, 100.0), (1, 60.0)]);
+    assert_eq!(d.first_nine_average, Some(220.0 * 3.0 / 9.0));
+
+    let nobody = visit_distribution(&tournaments, "Zed", None);
+    assert_eq!((nobody.visits, nobody.first_nine_average), (0, None));
+}
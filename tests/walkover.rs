@@ -0,0 +1,226 @@
+//! Integration tests for walkovers and withdrawals, and how each treats the players' stats.
+
+use dart_tournament_web::archive::EventStats;
+use dart_tournament_web::audit::{changes, Operation};
+use dart_tournament_web::{
+    record_bracket_result, record_match_visit, record_walkover, round_robin_standings,
+    start_tournament, undo_last_action, withdraw_player, BracketMatch, LegScore, Player, PlayerId,
+    ResultType, Team, Tournament, TournamentError, TournamentFormat, TournamentMode,
+    TournamentState, DEFAULT_RATING,
+};
+
+fn tournament(format: TournamentFormat, players: usize, count_walkovers: bool) -> Tournament {
+    let mut t = Tournament::new(3, TournamentMode::OneVOne);
+    t.format = format;
+    for i in 0..players {
+        t.add_player(format!("P{}", i + 1)).unwrap();
+    }
+    t.set_walkover_counts_as_win(count_walkovers).unwrap();
+    start_tournament(&mut t).unwrap();
+    t
+}
+
+fn id(t: &Tournament, name: &str) -> PlayerId {
+    t.players.iter().find(|p| p.name == name).unwrap().id
+}
+
+fn player(t: &Tournament, id: PlayerId) -> &Player {
+    t.find_player(id).unwrap()
+}
+
+fn get(t: &Tournament, match_id: uuid::Uuid) -> BracketMatch {
+    t.bracket.as_ref().unwrap().get(match_id).unwrap().clone()
+}
+
+/// The match between `a` and `b`.
+fn between(t: &Tournament, a: PlayerId, b: PlayerId) -> BracketMatch {
+    t.bracket
+        .as_ref()
+        .unwrap()
+        .matches
+        .iter()
+        .find(|m| m.side_of(a).is_some() && m.side_of(b).is_some())
+        .unwrap()
+        .clone()
+}
+
+fn beat(t: &mut Tournament, winner: PlayerId, loser: PlayerId, legs: (u32, u32)) {
+    let m = between(t, winner, loser);
+    let score = match m.side_of(winner).unwrap() {
+        Team::One => LegScore {
+            team_1: legs.0,
+            team_2: legs.1,
+        },
+        Team::Two => LegScore {
+            team_1: legs.1,
+            team_2: legs.0,
+        },
+    };
+    record_bracket_result(t, m.id, winner, Some(score), false).unwrap();
+}
+
+#[test]
+fn a_walkover_puts_the_opponent_through_without_a_win_or_rating_change() {
+    for count_walkovers in [false, true] {
+        let mut t = tournament(TournamentFormat::SingleElimination, 4, count_walkovers);
+        let m = t.bracket.as_ref().unwrap().round(1).next().unwrap().clone();
+        let (present, absent) = (m.team_1.unwrap(), m.team_2.unwrap());
+        let before = t.clone();
+        record_walkover(&mut t, m.id, absent).unwrap();
+
+        let decided = get(&t, m.id);
+        assert_eq!(decided.winner_id(), Some(present));
+        assert_eq!(decided.result_type, ResultType::Walkover);
+        assert_eq!(decided.score, None);
+        let next = decided.winner_to.unwrap();
+        assert_eq!(get(&t, next.match_id).player(next.team), Some(present));
+
+        assert_eq!(player(&t, present).wins, u32::from(count_walkovers));
+        assert_eq!(player(&t, absent).losses, 1);
+        assert!(player(&t, absent).eliminated);
+        assert!(player(&t, present).rating_history.is_empty());
+        assert!(player(&t, absent).rating_history.is_empty());
+
+        let logged = changes(&before, &t);
+        assert_eq!(logged[0].operation, Operation::ResultRecorded);
+        assert_eq!(logged[0].after["result_type"], "walkover");
+
+        assert_eq!(
+            record_walkover(&mut t, m.id, absent),
+            Err(TournamentError::ResultAlreadyRecorded)
+        );
+        undo_last_action(&mut t, m.id).unwrap();
+        assert_eq!(get(&t, m.id).result_type, ResultType::Played);
+        assert_eq!(player(&t, present).wins, 0);
+        assert_eq!(player(&t, absent).losses, 0);
+        assert!(!player(&t, absent).eliminated);
+    }
+
+    let mut t = tournament(TournamentFormat::SingleElimination, 4, false);
+    assert_eq!(
+        t.set_walkover_counts_as_win(true),
+        Err(TournamentError::InvalidState)
+    );
+    let m = t.bracket.as_ref().unwrap().round(1).next().unwrap().clone();
+    let stranger = Player::new("Nobody").id;
+    assert_eq!(
+        record_walkover(&mut t, m.id, stranger),
+        Err(TournamentError::NotInMatch(stranger))
+    );
+    let final_id = t.bracket.as_ref().unwrap().final_match().unwrap().id;
+    assert_eq!(
+        record_walkover(&mut t, final_id, m.team_1.unwrap()),
+        Err(TournamentError::MatchNotReady)
+    );
+}
+
+#[test]
+fn a_withdrawn_knockout_player_walks_over_once_their_opponent_is_known() {
+    let mut t = tournament(TournamentFormat::SingleElimination, 4, false);
+    let round_1: Vec<BracketMatch> = t.bracket.as_ref().unwrap().round(1).cloned().collect();
+    let (leaver, beaten) = (round_1[0].team_1.unwrap(), round_1[0].team_2.unwrap());
+    beat(&mut t, leaver, beaten, (2, 0));
+
+    withdraw_player(&mut t, leaver, false).unwrap();
+    assert!(player(&t, leaver).withdrawn && player(&t, leaver).eliminated);
+    // Their played result stands; the final waits for its other player.
+    assert_eq!(player(&t, leaver).wins, 1);
+    let final_id = t.bracket.as_ref().unwrap().final_match().unwrap().id;
+    assert_eq!(get(&t, final_id).winner, None);
+    assert_eq!(
+        withdraw_player(&mut t, leaver, false),
+        Err(TournamentError::PlayerWithdrawn(leaver))
+    );
+
+    let finalist = round_1[1].team_1.unwrap();
+    beat(&mut t, finalist, round_1[1].team_2.unwrap(), (2, 1));
+    let final_match = get(&t, final_id);
+    assert_eq!(final_match.winner_id(), Some(finalist));
+    assert_eq!(final_match.result_type, ResultType::Walkover);
+    assert_eq!(t.state, TournamentState::Completed);
+    assert_eq!(player(&t, finalist).wins, 1);
+
+    // Voiding results is a round-robin option only.
+    let mut t = tournament(TournamentFormat::SingleElimination, 4, false);
+    let p1 = id(&t, "P1");
+    assert_eq!(
+        withdraw_player(&mut t, p1, true),
+        Err(TournamentError::InvalidState)
+    );
+}
+
+#[test]
+fn round_robin_withdrawal_keeps_played_results_and_walks_over_the_rest() {
+    let mut t = tournament(TournamentFormat::RoundRobin, 4, false);
+    let (p1, p2, p3, p4) = (id(&t, "P1"), id(&t, "P2"), id(&t, "P3"), id(&t, "P4"));
+    beat(&mut t, p1, p4, (2, 1));
+
+    withdraw_player(&mut t, p4, false).unwrap();
+    for opponent in [p2, p3] {
+        let m = between(&t, opponent, p4);
+        assert_eq!(m.winner_id(), Some(opponent));
+        assert_eq!(m.result_type, ResultType::Walkover);
+        // Not on their win total, but a win in the table.
+        assert_eq!(player(&t, opponent).wins, 0);
+    }
+    assert_eq!(player(&t, p1).wins, 1);
+    assert_eq!(player(&t, p4).losses, 3);
+    let standings = round_robin_standings(&t).unwrap();
+    let row = |id| standings.iter().find(|s| s.player == id).unwrap();
+    assert_eq!((row(p2).wins, row(p2).played, row(p2).legs_for), (1, 1, 0));
+    assert_eq!((row(p1).wins, row(p1).legs_for), (1, 2));
+    assert_eq!(row(p4).losses, 3);
+
+    let m = between(&t, p1, p4);
+    assert_eq!(
+        record_bracket_result(&mut t, m.id, p4, None, true),
+        Err(TournamentError::PlayerWithdrawn(p4))
+    );
+}
+
+#[test]
+fn voiding_takes_back_results_and_ratings_but_not_darts_thrown() {
+    let mut t = tournament(TournamentFormat::RoundRobin, 4, false);
+    let (p1, p2, p3, p4) = (id(&t, "P1"), id(&t, "P2"), id(&t, "P3"), id(&t, "P4"));
+    beat(&mut t, p1, p4, (2, 1));
+    beat(&mut t, p2, p3, (2, 0));
+    // P4 leaves halfway through their match with P3, after P3 has scored a visit.
+    let unfinished = between(&t, p3, p4);
+    let p3_side = unfinished.side_of(p3).unwrap();
+    record_match_visit(&mut t, unfinished.id, p3_side, 60, 3, false, 0).unwrap();
+    assert_ne!(player(&t, p1).rating, DEFAULT_RATING);
+
+    withdraw_player(&mut t, p4, true).unwrap();
+    for opponent in [p1, p2, p3] {
+        let m = between(&t, opponent, p4);
+        assert_eq!(m.result_type, ResultType::Void);
+        assert_eq!(m.winner_id(), Some(opponent));
+    }
+    // The played result is kept for the record but counts for nothing.
+    let voided = between(&t, p1, p4);
+    assert!(voided.score.is_some());
+    let p1_now = player(&t, p1);
+    assert_eq!((p1_now.wins, p1_now.losses), (0, 0));
+    assert_eq!(p1_now.rating, DEFAULT_RATING);
+    assert!(p1_now.rating_history.is_empty());
+    let p4_now = player(&t, p4);
+    assert_eq!((p4_now.wins, p4_now.losses), (0, 0));
+    assert!(p4_now.rating_history.is_empty());
+    assert_eq!(EventStats::of(&t, p1_now).legs_won, 0);
+    // Darts thrown stay in the scoring totals.
+    assert_eq!(player(&t, p3).points_scored, 60);
+    assert_eq!(player(&t, p3).darts_thrown, 3);
+    // Results not involving P4 are untouched.
+    assert_eq!(player(&t, p2).wins, 1);
+
+    let standings = round_robin_standings(&t).unwrap();
+    assert_eq!(standings[0].player, p2);
+    let row = |id| standings.iter().find(|s| s.player == id).unwrap();
+    assert_eq!((row(p1).played, row(p1).legs_for), (0, 0));
+    assert_eq!(row(p4).played, 0);
+
+    assert_eq!(
+        undo_last_action(&mut t, voided.id),
+        Err(TournamentError::PlayerWithdrawn(p4))
+    );
+}
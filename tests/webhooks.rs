@@ -0,0 +1,299 @@
+//! Integration tests for webhooks: events a change fires, deliveries signed and sent to a
+//! local receiver, retries, and a failing endpoint disabled.
+
+mod common;
+
+use common::Knockout;
+use dart_tournament_web::api_error::ApiError;
+use dart_tournament_web::webhooks::{
+    events, sign, DeliveryRecord, Dispatcher, EventKind, WebhookError, WebhookStatus, WebhookStore,
+    DELIVERY_ATTEMPTS, DISABLE_AFTER_FAILURES,
+};
+use dart_tournament_web::{
+    record_bracket_result, start_tournament, BracketMatch, Tournament, TournamentMode,
+    TournamentRegistry, TournamentState,
+};
+use serde_json::Value;
+use std::collections::HashMap;
+use std::io::{BufRead, BufReader, Read, Write};
+use std::net::TcpListener;
+use std::sync::{Arc, Mutex};
+use std::thread;
+use std::time::Duration;
+
+/// A request the receiver got: its headers (names lower-cased) and body.
+struct Received {
+    headers: HashMap<String, String>,
+    body: Vec<u8>,
+}
+
+/// A local HTTP server answering each request with the next of `statuses` (the last one
+/// repeated). Returns its URL and what it has received.
+fn receiver(statuses: &[u16]) -> (String, Arc<Mutex<Vec<Received>>>) {
+    let listener = TcpListener::bind("127.0.0.1:0").unwrap();
+    let url = format!("http://{}/hook", listener.local_addr().unwrap());
+    let received = Arc::new(Mutex::new(Vec::new()));
+    let log = Arc::clone(&received);
+    let statuses = statuses.to_vec();
+    thread::spawn(move || {
+        for (i, stream) in listener.incoming().enumerate() {
+            let mut stream = stream.unwrap();
+            let mut reader = BufReader::new(stream.try_clone().unwrap());
+            let mut headers = HashMap::new();
+            let mut line = String::new();
+            reader.read_line(&mut line).unwrap();
+            loop {
+                line.clear();
+                reader.read_line(&mut line).unwrap();
+                let Some((name, value)) = line.trim_end().split_once(':') else {
+                    break;
+                };
+                headers.insert(name.to_lowercase(), value.trim().to_string());
+            }
+            let length = headers["content-length"].parse().unwrap();
+            let mut body = vec![0; length];
+            reader.read_exact(&mut body).unwrap();
+            log.lock().unwrap().push(Received { headers, body });
+            let status = statuses[i.min(statuses.len() - 1)];
+            let response =
+                format!("HTTP/1.1 {status} X\r\nContent-Length: 0\r\nConnection: close\r\n\r\n");
+            stream.write_all(response.as_bytes()).unwrap();
+        }
+    });
+    (url, received)
+}
+
+/// A started four-player knockout in a registry whose changes go to a dispatcher.
+fn knockout() -> (TournamentRegistry, Dispatcher, Tournament) {
+    let store = Arc::new(WebhookStore::in_memory());
+    let dispatcher = Dispatcher::with_backoff(store, Duration::from_millis(10));
+    let registry = TournamentRegistry::new().with_listener(dispatcher.clone());
+    let t = Knockout::of(&["Ann", "Bob", "Cy", "Di"])
+        .named("Thursday league")
+        .started();
+    let t = registry.insert(t).unwrap();
+    (registry, dispatcher, t)
+}
+
+fn first_ready(t: &Tournament) -> BracketMatch {
+    let b = t.bracket.as_ref().unwrap();
+    b.matches
+        .iter()
+        .find(|m| m.is_ready() && !m.bye)
+        .cloned()
+        .unwrap()
+}
+
+/// Record the next ready match as won by its first player.
+fn play_one(registry: &TournamentRegistry, id: uuid::Uuid) -> Tournament {
+    let t = registry.get(id).unwrap();
+    let m = first_ready(&t);
+    registry
+        .update(id, |t| {
+            record_bracket_result(t, m.id, m.team_1.unwrap(), None, false).map(|_| ())
+        })
+        .unwrap()
+}
+
+#[test]
+fn a_delivery_is_the_event_signed_with_the_webhooks_secret() {
+    let (registry, dispatcher, t) = knockout();
+    let (url, received) = receiver(&[200]);
+    let webhook = dispatcher
+        .webhooks()
+        .register(t.id, &url, Some(&[EventKind::MatchCompleted]))
+        .unwrap();
+    assert_eq!(webhook.secret.len(), 64);
+
+    play_one(&registry, t.id);
+    assert!(dispatcher.wait_idle(Duration::from_secs(10)));
+    let received = received.lock().unwrap();
+    assert_eq!(received.len(), 1);
+    let delivery = &received[0];
+    assert_eq!(delivery.headers["x-dart-event"], "match_completed");
+    assert_eq!(delivery.headers["content-type"], "application/json");
+    assert_eq!(
+        delivery.headers["x-dart-signature"],
+        sign(&webhook.secret, &delivery.body)
+    );
+
+    let body: Value = serde_json::from_slice(&delivery.body).unwrap();
+    assert_eq!(body["event"], "match_completed");
+    assert_eq!(body["id"], delivery.headers["x-dart-delivery"].as_str());
+    assert_eq!(body["tournament_id"], t.id.to_string());
+    assert_eq!(body["tournament_name"], "Thursday league");
+    assert_eq!(body["data"]["round"], "Round 1");
+    assert_eq!(body["data"]["winner"], "one");
+    assert_eq!(body["data"]["team_1"][0]["name"], "Ann");
+    assert_eq!(body["data"]["team_2"][0]["name"], "Di");
+
+    let listed = dispatcher.webhooks().list(t.id);
+    let last = listed[0].last_delivery.as_ref().unwrap();
+    assert!(last.delivered);
+    assert_eq!((last.attempts, last.status), (1, Some(200)));
+    // Listed without the secret.
+    let shown = serde_json::to_value(listed[0].clone().without_secret()).unwrap();
+    assert!(shown.get("secret").is_none());
+}
+
+#[test]
+fn a_failed_delivery_is_tried_again_with_the_same_body() {
+    let (registry, dispatcher, t) = knockout();
+    let (url, received) = receiver(&[500, 503, 200]);
+    dispatcher.webhooks().register(t.id, &url, None).unwrap();
+
+    play_one(&registry, t.id);
+    assert!(dispatcher.wait_idle(Duration::from_secs(10)));
+    let received = received.lock().unwrap();
+    assert_eq!(received.len(), DELIVERY_ATTEMPTS as usize);
+    assert!(received.iter().all(|r| r.body == received[0].body));
+    let webhook = &dispatcher.webhooks().list(t.id)[0];
+    let last = webhook.last_delivery.as_ref().unwrap();
+    assert!(last.delivered);
+    assert_eq!((last.attempts, webhook.consecutive_failures), (3, 0));
+}
+
+#[test]
+fn an_endpoint_failing_delivery_after_delivery_is_disabled() {
+    let (registry, dispatcher, t) = knockout();
+    // Nothing listens on a port just given back.
+    let dead = {
+        let listener = TcpListener::bind("127.0.0.1:0").unwrap();
+        format!("http://{}/hook", listener.local_addr().unwrap())
+    };
+    let webhooks = dispatcher.webhooks();
+    let hook = webhooks.register(t.id, &dead, None).unwrap();
+
+    // Two semi-finals and the final: each result, the final's pairing and the winner.
+    for _ in 0..3 {
+        play_one(&registry, t.id);
+    }
+    assert!(dispatcher.wait_idle(Duration::from_secs(20)));
+    let webhook = webhooks.get(t.id, hook.id).unwrap();
+    assert_eq!(webhook.status, WebhookStatus::Disabled);
+    assert_eq!(webhook.consecutive_failures, DISABLE_AFTER_FAILURES);
+    let last = webhook.last_delivery.unwrap();
+    assert!(!last.delivered);
+    assert_eq!((last.attempts, last.status), (DELIVERY_ATTEMPTS, None));
+
+    let enabled = webhooks.enable(t.id, hook.id).unwrap();
+    assert_eq!(
+        (enabled.status, enabled.consecutive_failures),
+        (WebhookStatus::Active, 0)
+    );
+    assert_eq!(
+        webhooks.register(t.id, "ftp://example.com/x", None),
+        Err(WebhookError::InvalidUrl)
+    );
+    assert_eq!(
+        webhooks.register(t.id, "https://example.com/x", Some(&[])),
+        Err(WebhookError::NoEvents)
+    );
+    let e = ApiError::from(WebhookError::InvalidUrl);
+    assert_eq!((e.status, e.code), (400, "validation_failed"));
+    assert_eq!(e.details["field"], "url");
+}
+
+#[test]
+fn a_delivery_record_that_cant_be_written_still_counts() {
+    let dir = std::env::temp_dir().join(format!("dart-webhooks-{}", uuid::Uuid::new_v4()));
+    let webhooks = WebhookStore::open(&dir).unwrap();
+    let t = Tournament::new(3, TournamentMode::OneVOne);
+    let hook = webhooks
+        .register(t.id, "https://example.com/hook", None)
+        .unwrap();
+    // With the directory gone every write fails.
+    std::fs::remove_dir_all(&dir).unwrap();
+    let failed = DeliveryRecord {
+        event_id: uuid::Uuid::new_v4(),
+        event: EventKind::MatchCompleted,
+        at: chrono::Utc::now(),
+        attempts: DELIVERY_ATTEMPTS,
+        delivered: false,
+        status: Some(500),
+        error: Some("responded 500".to_string()),
+    };
+    for _ in 0..DISABLE_AFTER_FAILURES {
+        let err = webhooks.record(t.id, hook.id, failed.clone()).unwrap_err();
+        assert!(matches!(err, WebhookError::Storage(_)));
+    }
+    let webhook = webhooks.get(t.id, hook.id).unwrap();
+    assert_eq!(webhook.consecutive_failures, DISABLE_AFTER_FAILURES);
+    assert_eq!(webhook.status, WebhookStatus::Disabled);
+    assert_eq!(webhook.last_delivery, Some(failed));
+}
+
+#[test]
+fn webhooks_of_tournaments_cleaned_up_for_inactivity_can_be_dropped() {
+    let dir = std::env::temp_dir().join(format!("dart-webhooks-{}", uuid::Uuid::new_v4()));
+    let webhooks = WebhookStore::open(&dir).unwrap();
+    let registry = TournamentRegistry::new();
+    let t = registry
+        .insert(Tournament::new(3, TournamentMode::OneVOne))
+        .unwrap();
+    webhooks
+        .register(t.id, "https://example.com/hook", None)
+        .unwrap();
+
+    let removed = registry.remove_inactive(Duration::ZERO).unwrap();
+    assert_eq!(removed, [t.id]);
+    for id in removed {
+        webhooks.remove_tournament(id).unwrap();
+    }
+    assert!(webhooks.list(t.id).is_empty());
+    // The file, secrets and all, is gone too.
+    assert_eq!(std::fs::read_dir(&dir).unwrap().count(), 0);
+    std::fs::remove_dir_all(dir).unwrap();
+}
+
+#[test]
+fn a_knockout_fires_its_rounds_results_and_finish() {
+    let mut t = Knockout::of(&["Ann", "Bob", "Cy", "Di"]).entered();
+    let setup = t.clone();
+    start_tournament(&mut t).unwrap();
+    let started = events(&setup, &t);
+    assert_eq!(started.len(), 1);
+    assert_eq!(started[0].event, EventKind::RoundStarted);
+    let pairings = started[0].data["pairings"].as_array().unwrap();
+    let names: Vec<(&str, &str)> = pairings
+        .iter()
+        .map(|p| {
+            (
+                p["team_1"][0]["name"].as_str().unwrap(),
+                p["team_2"][0]["name"].as_str().unwrap(),
+            )
+        })
+        .collect();
+    assert_eq!(names, [("Ann", "Di"), ("Bob", "Cy")]);
+
+    let kinds = |before: &Tournament, after: &Tournament| -> Vec<EventKind> {
+        events(before, after).into_iter().map(|e| e.event).collect()
+    };
+    let play = |t: &mut Tournament| {
+        let before = t.clone();
+        let m = first_ready(t);
+        record_bracket_result(t, m.id, m.team_1.unwrap(), None, false).unwrap();
+        kinds(&before, t)
+    };
+    assert_eq!(play(&mut t), [EventKind::MatchCompleted]);
+    // The second semi-final pairs the final.
+    assert_eq!(
+        play(&mut t),
+        [EventKind::RoundStarted, EventKind::MatchCompleted]
+    );
+    let before = t.clone();
+    assert_eq!(
+        play(&mut t),
+        [EventKind::MatchCompleted, EventKind::TournamentFinished]
+    );
+    assert_eq!(t.state, TournamentState::Completed);
+    let finished = events(&before, &t).pop().unwrap();
+    assert_eq!(finished.data["placements"][0]["name"], "Ann");
+    assert_eq!(finished.data["placements"][0]["place"], 1);
+
+    // RFC 4231, test case 2.
+    assert_eq!(
+        sign("Jefe", b"what do ya want for nothing?"),
+        "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+    );
+}